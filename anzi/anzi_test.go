@@ -1,10 +1,12 @@
 package anzi
 
 import (
+	"bufio"
 	"bytes"
 	"io"
 	"net"
 	"sync/atomic"
+	"testing"
 	"time"
 )
 
@@ -102,3 +104,44 @@ func _createDownStreamConn() (net.Conn, *bytes.Buffer) {
 	}
 	return mconn, buf
 }
+
+// _fakeTarget serves as the target replying OK to all the commands, cmds is
+// the count of received commands.
+func _fakeTarget(t *testing.T) (addr string, cmds *int64) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmds = new(int64)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				for {
+					if _, err := readCommand(br); err != nil {
+						return
+					}
+					atomic.AddInt64(cmds, 1)
+					if _, err := conn.Write([]byte("+OK\r\n")); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return l.Addr().String(), cmds
+}
+
+// _cmd builds the RESP command of args.
+func _cmd(args ...string) []byte {
+	bs := make([][]byte, 0, len(args))
+	for _, arg := range args {
+		bs = append(bs, []byte(arg))
+	}
+	return joinCommand(bs)
+}
@@ -0,0 +1,155 @@
+package anzi
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"overlord/pkg/log"
+	"overlord/proxy"
+)
+
+const (
+	snapshotDialTimeout = time.Second
+	restorePingTimeout  = 10 * time.Second
+)
+
+// define backup errors
+var (
+	ErrSnapshotDiskless = errors.New("diskless sync can not be snapshotted since the rdb size is unknown")
+	ErrRestoreNotReady  = errors.New("restore target is not ready")
+)
+
+type snapshot struct {
+	io.Reader
+	io.Closer
+}
+
+// Snapshot asks upstream addr to full resync like a replica, which makes it
+// BGSAVE and transfer the rdb, and returns the reader of the whole rdb with
+// its size. The reader must be closed after read.
+// NOTICE: repl-diskless-sync of upstream must be disabled.
+func Snapshot(addr string) (rc io.ReadCloser, size int64, err error) {
+	conn, err := net.DialTimeout("tcp", addr, snapshotDialTimeout)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			conn.Close()
+		}
+	}()
+	if err = writeAll(psyncFullSyncCmd, conn); err != nil {
+		return
+	}
+	br := bufio.NewReader(conn)
+	for {
+		var line []byte
+		if line, err = br.ReadBytes(byteLF); err != nil {
+			return
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			// NOTE: upstream sends newlines as keepalive while BGSAVE.
+			continue
+		}
+		switch line[0] {
+		case byteError:
+			err = fmt.Errorf("upstream %s refused to sync: %s", addr, line[1:])
+			return
+		case byteBulkString:
+			if bytes.HasPrefix(line[1:], []byte("EOF:")) {
+				err = ErrSnapshotDiskless
+				return
+			}
+			if size, err = strconv.ParseInt(string(line[1:]), 10, 64); err != nil {
+				return
+			}
+			log.Infof("snapshot rdb of %s with %d bytes", addr, size)
+			rc = snapshot{Reader: io.LimitReader(br, size), Closer: conn}
+			return
+		}
+		log.Infof("receive psync reply of %s as %s", addr, strconv.Quote(string(line)))
+	}
+}
+
+// Restore replays the rdb read from rd into target, which is a redis or the
+// proxy of cluster, and returns after all the commands confirmed by target.
+func Restore(rd io.Reader, target string, window int) (s *Source, err error) {
+	cb := NewProtocolCallbacker(target, window, nil)
+	defer cb.Close()
+	if cb.GetConn() == nil {
+		return nil, ErrPipelineClosed
+	}
+	if _, err = NewRDB(bufio.NewReader(rd), cb).Sync(); err != nil {
+		return
+	}
+	if err = cb.Wait(); err != nil {
+		return
+	}
+	s = &Source{Addr: target, Synced: true}
+	cb.Stat(s)
+	return
+}
+
+// RestoreProc replays the rdb into the cluster through an in-process proxy
+// like migrating, so that the keys are routed as the cluster is now instead
+// of where they were saved.
+type RestoreProc struct {
+	p      *proxy.Proxy
+	target string
+	window int
+}
+
+// NewRestoreProc serves the proxy of cluster to and waits until it's ready.
+func NewRestoreProc(to *proxy.ClusterConfig, window int) (r *RestoreProc, err error) {
+	to.SetDefault()
+	if err = to.Validate(); err != nil {
+		return
+	}
+	_, port, err := net.SplitHostPort(to.ListenAddr)
+	if err != nil {
+		return
+	}
+	p, err := proxy.New(proxy.DefaultConfig())
+	if err != nil {
+		return
+	}
+	defer func() {
+		if perr := recover(); perr != nil {
+			err = fmt.Errorf("serve restore proxy of %s err %v", to.Name, perr)
+		}
+		if err != nil {
+			p.Close()
+			r = nil
+		}
+	}()
+	p.Serve([]*proxy.ClusterConfig{to})
+
+	r = &RestoreProc{p: p, target: "127.0.0.1:" + port, window: window}
+	buf := make([]byte, 7)
+	deadline := time.Now().Add(restorePingTimeout)
+	for ping(r.target, buf) != nil {
+		if time.Now().After(deadline) {
+			err = ErrRestoreNotReady
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return
+}
+
+// Load replays the rdb read from rd into the cluster.
+func (r *RestoreProc) Load(rd io.Reader) (*Source, error) {
+	return Restore(rd, r.target, r.window)
+}
+
+// Close closes the proxy.
+func (r *RestoreProc) Close() error {
+	return r.p.Close()
+}
@@ -0,0 +1,44 @@
+package anzi
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotAndRestore(t *testing.T) {
+	data, err := ioutil.ReadFile("dumps/integer_keys.rdb")
+	assert.NoError(t, err)
+	reply := fmt.Sprintf("+FULLRESYNC 6f1c2a 100\r\n\n\n$%d\r\n%s", len(data), data)
+	addr, cmds := _fakeUpstream(t, reply)
+
+	rc, size, err := Snapshot(addr)
+	assert.NoError(t, err)
+	assert.Equal(t, _cmd("PSYNC", "?", "-1"), <-cmds)
+	assert.Equal(t, int64(len(data)), size)
+	saved, err := ioutil.ReadAll(rc)
+	assert.NoError(t, err)
+	assert.NoError(t, rc.Close())
+	assert.Equal(t, data, saved)
+
+	target, confirmed := _fakeTarget(t)
+	s, err := Restore(bytes.NewReader(saved), target, 2)
+	assert.NoError(t, err)
+	assert.NotZero(t, s.Commands)
+	assert.Equal(t, atomic.LoadInt64(confirmed), s.Commands)
+	assert.Zero(t, s.InFlight)
+}
+
+func TestSnapshotDiskless(t *testing.T) {
+	addr, _ := _fakeUpstream(t, "+FULLRESYNC 6f1c2a 100\r\n$EOF:0123456789012345678901234567890123456789\r\n")
+	_, _, err := Snapshot(addr)
+	assert.Equal(t, ErrSnapshotDiskless, err)
+
+	addr, _ = _fakeUpstream(t, "-NOPERM this user has no permissions\r\n")
+	_, _, err = Snapshot(addr)
+	assert.Error(t, err)
+}
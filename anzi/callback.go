@@ -3,12 +3,11 @@ package anzi
 import (
 	"bufio"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net"
 	"strconv"
 	"sync"
-	"time"
+	"sync/atomic"
 
 	"overlord/pkg/log"
 )
@@ -24,6 +23,14 @@ var (
 	BytesHSet     = []byte("HSET")
 	Bytes         = []byte("SET")
 	BytesExpireAt = []byte("EXPIREAT")
+	// BytesPExpireAt keeps the expiration of rdb in milliseconds.
+	BytesPExpireAt = []byte("PEXPIREAT")
+
+	BytesXAdd     = []byte("XADD")
+	BytesXGroup   = []byte("XGROUP")
+	BytesCreate   = []byte("CREATE")
+	BytesMkStream = []byte("MKSTREAM")
+	BytesXSetID   = []byte("XSETID")
 )
 
 // RDBCallback is the callback interface defined to call
@@ -46,27 +53,32 @@ type RDBCallback interface {
 	CmdHSet(key, field, value []byte)
 	CmdHSetInt(key, field []byte, value int64)
 
+	// Stream
+	CmdXAdd(key, id []byte, fields [][]byte)
+	CmdXGroupCreate(key, group, id []byte)
+	CmdXSetID(key, id []byte)
+
 	// Expire
 	ExpireAt(key []byte, expiry uint64)
 
 	GetConn() net.Conn
 }
 
-// NewProtocolCallbacker convert them as callback
-func NewProtocolCallbacker(addr string) *ProtocolCallbacker {
+// NewProtocolCallbacker convert them as callback, the commands are pipelined
+// to addr with at most window commands in flight, and the offset is added by
+// the delta of forwarded commands after confirmed.
+func NewProtocolCallbacker(addr string, window int, offset *int64) *ProtocolCallbacker {
 	p := &ProtocolCallbacker{
-		addr:     addr,
-		endOfRDB: make(chan struct{}, 1),
+		addr:   addr,
+		window: window,
+		offset: offset,
 	}
 
 	conn, err := net.Dial("tcp", addr)
 	if err != nil {
 		log.Error("fail to dial with remote")
 	} else {
-		p.conn = conn
-		p.bw = bufio.NewWriter(conn)
-		p.br = bufio.NewReader(conn)
-		go p.ignoreRecv()
+		p.pipe = newPipeline(conn, window, offset)
 	}
 
 	return p
@@ -75,34 +87,12 @@ func NewProtocolCallbacker(addr string) *ProtocolCallbacker {
 // ProtocolCallbacker will get the callback data and convert into RESP
 // protocol data into downstream.
 type ProtocolCallbacker struct {
-	addr string
+	addr   string
+	window int
+	offset *int64
 
 	lock sync.RWMutex
-	conn net.Conn
-	bw   *bufio.Writer
-	br   *bufio.Reader
-
-	endOfRDB chan struct{}
-}
-
-func (r *ProtocolCallbacker) ignoreRecv() {
-	for {
-		select {
-		case <-r.endOfRDB:
-			return
-		default:
-		}
-
-		r.lock.RLock()
-		size, err := io.Copy(ioutil.Discard, r.br)
-		r.lock.RUnlock()
-		if size == 0 {
-			time.Sleep(time.Second)
-		}
-		if err != nil {
-			log.Warnf("fail to discard reader due %s", err)
-		}
-	}
+	pipe *pipeline
 }
 
 // SelectDB impl Callback
@@ -112,7 +102,10 @@ func (r *ProtocolCallbacker) SelectDB(dbnum uint64) {
 
 // GetConn returns connection for protocolcallbacker only
 func (r *ProtocolCallbacker) GetConn() net.Conn {
-	return r.conn
+	if r.pipe == nil {
+		return nil
+	}
+	return r.pipe.conn
 }
 
 // AuxField impl Callback
@@ -127,14 +120,13 @@ func (r *ProtocolCallbacker) ResizeDB(size, esize uint64) {
 
 // EndOfRDB impl Callback
 func (r *ProtocolCallbacker) EndOfRDB() {
-	r.endOfRDB <- struct{}{}
 	log.Infof("EndOfRDB...")
-	_ = r.bw.Flush()
+	r.handleErr(r.Flush())
 }
 
 // CmdSet impl Callback
 func (r *ProtocolCallbacker) CmdSet(key, val []byte, expire uint64) {
-	r.handleErr(writePlainCmd(r.bw, BytesSet, key, val))
+	r.handleErr(r.commit(writePlainCmd(r.bw(), BytesSet, key, val)))
 
 	if expire > 0 {
 		r.ExpireAt(key, expire)
@@ -144,46 +136,148 @@ func (r *ProtocolCallbacker) CmdSet(key, val []byte, expire uint64) {
 // CmdRPush impl Callback
 // List Command
 func (r *ProtocolCallbacker) CmdRPush(key, val []byte) {
-	r.handleErr(writePlainCmd(r.bw, BytesRPush, key, val))
+	r.handleErr(r.commit(writePlainCmd(r.bw(), BytesRPush, key, val)))
 }
 
 // CmdSAdd impl Callback
 // Set
 func (r *ProtocolCallbacker) CmdSAdd(key, val []byte) {
-	r.handleErr(writePlainCmd(r.bw, BytesSAdd, key, val))
+	r.handleErr(r.commit(writePlainCmd(r.bw(), BytesSAdd, key, val)))
 }
 
 // CmdZAdd impl Callback
 // ZSet
 func (r *ProtocolCallbacker) CmdZAdd(key []byte, score float64, val []byte) {
-	r.handleErr(writePlainCmd(r.bw, BytesZAdd, key, val))
+	r.handleErr(r.commit(writePlainCmd(r.bw(), BytesZAdd, key, val)))
 }
 
 // CmdHSet impl Callback
 // Hash
 func (r *ProtocolCallbacker) CmdHSet(key, field, value []byte) {
-	r.handleErr(write4ArgsCmd(r.bw, BytesHSet, key, field, value))
+	r.handleErr(r.commit(write4ArgsCmd(r.bw(), BytesHSet, key, field, value)))
 }
 
 // CmdHSetInt impl Callback
 func (r *ProtocolCallbacker) CmdHSetInt(key, field []byte, value int64) {
-	r.handleErr(write4ArgsCmd(r.bw, BytesHSet, key, field, []byte(fmt.Sprintf("%d", value))))
+	r.handleErr(r.commit(write4ArgsCmd(r.bw(), BytesHSet, key, field, []byte(fmt.Sprintf("%d", value)))))
+}
+
+// CmdXAdd impl Callback
+// Stream, fields are the pairs of field and value.
+func (r *ProtocolCallbacker) CmdXAdd(key, id []byte, fields [][]byte) {
+	args := append([][]byte{BytesXAdd, key, id}, fields...)
+	r.handleErr(r.commit(writeArgsCmd(r.bw(), args...)))
+}
+
+// CmdXGroupCreate impl Callback
+func (r *ProtocolCallbacker) CmdXGroupCreate(key, group, id []byte) {
+	r.handleErr(r.commit(writeArgsCmd(r.bw(), BytesXGroup, BytesCreate, key, group, id, BytesMkStream)))
+}
+
+// CmdXSetID impl Callback
+func (r *ProtocolCallbacker) CmdXSetID(key, id []byte) {
+	r.handleErr(r.commit(writePlainCmd(r.bw(), BytesXSetID, key, id)))
 }
 
 // ExpireAt impl Callback
-// Expire
+// Expire, the expiry is unix time in milliseconds.
 func (r *ProtocolCallbacker) ExpireAt(key []byte, expiry uint64) {
 	if expiry == 0 {
 		return
 	}
 
-	r.handleErr(writePlainCmd(r.bw, BytesExpireAt, key, []byte(fmt.Sprintf("%d", expiry)), 3))
+	r.handleErr(r.commit(writePlainCmd(r.bw(), BytesPExpireAt, key, []byte(fmt.Sprintf("%d", expiry)), 3)))
+}
+
+// Forward writes the raw command of upstream with the offset delta, the
+// written commands are flushed if the window is full or flush is true.
+func (r *ProtocolCallbacker) Forward(cmd []byte, delta int64, flush bool) (err error) {
+	if r.pipe == nil {
+		return ErrPipelineClosed
+	}
+	if err = r.pipe.forward(cmd, delta); err != nil || !flush {
+		return
+	}
+	return r.pipe.flush()
+}
+
+// Skip adds the offset delta of commands not forwarded after the commands
+// written before are confirmed.
+func (r *ProtocolCallbacker) Skip(delta int64) {
+	if r.pipe != nil {
+		r.pipe.skip(delta)
+	}
+}
+
+// Pending returns the count of commands not confirmed yet.
+func (r *ProtocolCallbacker) Pending() int64 {
+	if r.pipe == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&r.pipe.pending)
+}
+
+// Flush flushes the written commands into downstream.
+func (r *ProtocolCallbacker) Flush() error {
+	if r.pipe == nil {
+		return ErrPipelineClosed
+	}
+	return r.pipe.flush()
+}
+
+// Wait flushes the written commands and waits until all of them confirmed
+// by downstream.
+func (r *ProtocolCallbacker) Wait() error {
+	r.lock.RLock()
+	pipe := r.pipe
+	r.lock.RUnlock()
+	if pipe == nil {
+		return ErrPipelineClosed
+	}
+	return pipe.wait()
+}
+
+// Stat fills the metrics of the pipeline into s.
+func (r *ProtocolCallbacker) Stat(s *Source) {
+	r.lock.RLock()
+	if r.pipe != nil {
+		r.pipe.stat(s)
+	}
+	r.lock.RUnlock()
+}
+
+// Close closes the connection to downstream.
+func (r *ProtocolCallbacker) Close() error {
+	if r.pipe == nil {
+		return nil
+	}
+	return r.pipe.Close()
+}
+
+// bw returns the writer of pipeline, the commands are discarded if failed to
+// dial and then committing reconnects.
+func (r *ProtocolCallbacker) bw() *bufio.Writer {
+	if r.pipe == nil {
+		return bufio.NewWriter(ioutil.Discard)
+	}
+	return r.pipe.bw
+}
+
+func (r *ProtocolCallbacker) commit(err error) error {
+	if err != nil {
+		return err
+	}
+	if r.pipe == nil {
+		return ErrPipelineClosed
+	}
+	return r.pipe.commit(0)
 }
 
 func (r *ProtocolCallbacker) handleErr(err error) {
 	if err == nil {
 		return
 	}
+	log.Warnf("fail to write into %s due %s, reconnect and the commands in flight are dropped", r.addr, err)
 
 	var conn net.Conn
 	conn, err = net.Dial("tcp", r.addr)
@@ -192,11 +286,11 @@ func (r *ProtocolCallbacker) handleErr(err error) {
 		return
 	}
 
-	_ = r.conn.Close()
 	r.lock.Lock()
-	r.conn = conn
-	r.bw = bufio.NewWriter(r.conn)
-	r.br = bufio.NewReader(r.conn)
+	if r.pipe != nil {
+		_ = r.pipe.Close()
+	}
+	r.pipe = newPipeline(conn, r.window, r.offset)
 	r.lock.Unlock()
 }
 
@@ -221,6 +315,14 @@ func writePlainCmd(w *bufio.Writer, cmd, key, val []byte, size ...int) (err erro
 	return
 }
 
+func writeArgsCmd(w *bufio.Writer, args ...[]byte) (err error) {
+	_ = writeArrayCount(w, len(args))
+	for _, arg := range args {
+		err = writeToBulk(w, arg)
+	}
+	return
+}
+
 func writeArrayCount(w *bufio.Writer, size int) (err error) {
 	_, err = w.WriteString(fmt.Sprintf("*%d\r\n", size))
 	return
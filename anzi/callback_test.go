@@ -8,14 +8,16 @@ import (
 )
 
 func TestCallback(t *testing.T) {
+	addr, _ := _fakeTarget(t)
 	for _, rname := range allRdbs {
 		t.Run(rname, func(tt *testing.T) {
 			buf, err := _loadRDB(rname + ".rdb")
 			assert.NoError(tt, err, "should load db ok")
-			cb := NewProtocolCallbacker("127.0.0.1:6379")
+			cb := NewProtocolCallbacker(addr, 0, nil)
 			rdb := NewRDB(bufio.NewReader(buf), cb)
 			err = rdb.bgSyncProc()
 			assert.NoError(tt, err)
+			cb.Close()
 		})
 	}
 }
@@ -0,0 +1,126 @@
+package anzi
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"overlord/pkg/etcd"
+
+	"go.etcd.io/etcd/client"
+)
+
+const (
+	checkpointSuffix      = ".offset"
+	etcdCheckpointTimeout = 2 * time.Second
+)
+
+// checkpoint persists the replication id and offset confirmed by target of
+// an upstream instance, so that anzi can continue syncing by PSYNC after
+// restarted instead of transferring the whole rdb again.
+type checkpoint interface {
+	// load returns nil meta if there is no checkpoint.
+	load() (*rdbMeta, error)
+	save(meta *rdbMeta) error
+	clean() error
+}
+
+// newCheckpoint returns nil if checkpoint is not configured.
+func newCheckpoint(cfg *MigrateConfig, e *etcd.Etcd, addr string) checkpoint {
+	name := strings.Replace(addr, ":", "_", -1)
+	if e != nil {
+		return &etcdCheckpoint{e: e, key: etcd.AnziCheckpointDir + "/" + name}
+	}
+	if cfg.CheckpointDir != "" {
+		return &fileCheckpoint{dir: cfg.CheckpointDir, path: filepath.Join(cfg.CheckpointDir, name+checkpointSuffix)}
+	}
+	return nil
+}
+
+// fileCheckpoint saves the checkpoint into local file.
+type fileCheckpoint struct {
+	dir  string
+	path string
+}
+
+func (c *fileCheckpoint) load() (*rdbMeta, error) {
+	data, err := ioutil.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	meta := &rdbMeta{}
+	if err = json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+func (c *fileCheckpoint) save(meta *rdbMeta) (err error) {
+	if err = os.MkdirAll(c.dir, 0755); err != nil {
+		return
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return
+	}
+	tmp := c.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return
+	}
+	return os.Rename(tmp, c.path)
+}
+
+func (c *fileCheckpoint) clean() error {
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// etcdCheckpoint saves the checkpoint into etcd, which is shared by the
+// anzi restarted on other machine.
+type etcdCheckpoint struct {
+	e   *etcd.Etcd
+	key string
+}
+
+func (c *etcdCheckpoint) load() (*rdbMeta, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdCheckpointTimeout)
+	defer cancel()
+	v, err := c.e.Get(ctx, c.key)
+	if client.IsKeyNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	meta := &rdbMeta{}
+	if err = json.Unmarshal([]byte(v), meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+func (c *etcdCheckpoint) save(meta *rdbMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), etcdCheckpointTimeout)
+	defer cancel()
+	return c.e.Set(ctx, c.key, string(data))
+}
+
+func (c *etcdCheckpoint) clean() error {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdCheckpointTimeout)
+	defer cancel()
+	if err := c.e.Delete(ctx, c.key); err != nil && !client.IsKeyNotFound(err) {
+		return err
+	}
+	return nil
+}
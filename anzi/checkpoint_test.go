@@ -0,0 +1,119 @@
+package anzi
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileCheckpoint(t *testing.T) {
+	assert.Nil(t, newCheckpoint(&MigrateConfig{}, nil, "127.0.0.1:6379"))
+
+	dir, err := ioutil.TempDir("", "anzi-checkpoint")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cp := newCheckpoint(&MigrateConfig{CheckpointDir: dir}, nil, "127.0.0.1:6379")
+	meta, err := cp.load()
+	assert.NoError(t, err)
+	assert.Nil(t, meta)
+
+	assert.NoError(t, cp.save(&rdbMeta{MasterID: "abc", Offset: 7788}))
+	meta, err = cp.load()
+	assert.NoError(t, err)
+	assert.Equal(t, &rdbMeta{MasterID: "abc", Offset: 7788}, meta)
+
+	assert.NoError(t, cp.clean())
+	assert.NoError(t, cp.clean())
+	meta, err = cp.load()
+	assert.NoError(t, err)
+	assert.Nil(t, meta)
+}
+
+// _fakeUpstream replies the PSYNC command by reply and sends the received
+// command into cmds.
+func _fakeUpstream(t *testing.T, reply string) (addr string, cmds chan []byte) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmds = make(chan []byte, 1)
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		cmd, err := readCommand(bufio.NewReader(conn))
+		if err != nil {
+			return
+		}
+		cmds <- cmd
+		_, _ = conn.Write([]byte(reply))
+	}()
+	return l.Addr().String(), cmds
+}
+
+func TestInstanceResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "anzi-checkpoint")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	target, _ := _fakeTarget(t)
+
+	addr, cmds := _fakeUpstream(t, "+CONTINUE def\r\n")
+	inst := &Instance{Addr: addr, Target: target}
+	inst.checkpoint = newCheckpoint(&MigrateConfig{CheckpointDir: dir}, nil, addr)
+	resumed, err := inst.resume()
+	assert.NoError(t, err)
+	assert.False(t, resumed)
+
+	assert.NoError(t, inst.checkpoint.save(&rdbMeta{MasterID: "abc", Offset: 7788}))
+	resumed, err = inst.resume()
+	assert.NoError(t, err)
+	assert.True(t, resumed)
+	assert.Equal(t, string(_cmd("PSYNC", "abc", "7789")), string(<-cmds))
+	assert.Equal(t, "def", inst.masterID)
+	assert.Equal(t, int64(7788), inst.offset)
+	assert.NotNil(t, inst.cb)
+	inst.Close()
+
+	addr, _ = _fakeUpstream(t, "+FULLRESYNC abc 9900\r\n")
+	inst = &Instance{Addr: addr, Target: target}
+	inst.checkpoint = newCheckpoint(&MigrateConfig{CheckpointDir: dir}, nil, addr)
+	assert.NoError(t, inst.checkpoint.save(&rdbMeta{MasterID: "abc", Offset: 7788}))
+	resumed, err = inst.resume()
+	assert.NoError(t, err)
+	assert.False(t, resumed)
+	inst.Close()
+}
+
+func TestInstanceSaveCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "anzi-checkpoint")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	conn, target := net.Pipe()
+	defer target.Close()
+	inst := &Instance{masterID: "abc", offset: 100}
+	inst.checkpoint = newCheckpoint(&MigrateConfig{CheckpointDir: dir}, nil, "127.0.0.1:6379")
+	inst.cb = &ProtocolCallbacker{pipe: newPipeline(conn, 0, &inst.offset)}
+	defer inst.Close()
+
+	// the commands of rdb are pending at base offset
+	assert.NoError(t, inst.cb.Forward(bytesPingCmd, 0, false))
+	assert.Equal(t, int64(-1), inst.saveCheckpoint(100, -1))
+	meta, err := inst.checkpoint.load()
+	assert.NoError(t, err)
+	assert.Nil(t, meta)
+
+	inst.offset = 150
+	assert.Equal(t, int64(150), inst.saveCheckpoint(100, -1))
+	meta, err = inst.checkpoint.load()
+	assert.NoError(t, err)
+	assert.Equal(t, &rdbMeta{MasterID: "abc", Offset: 150}, meta)
+}
@@ -15,9 +15,51 @@ type Config struct {
 
 // MigrateConfig is the config file which nedd to read/write into target dir.
 type MigrateConfig struct {
-	From              []*proxy.ClusterConfig `toml:"from"`
-	To                *proxy.ClusterConfig   `toml:"to"`
-	MaxRDBConcurrency int                    `toml:"max_rdb_concurrency"`
+	From []*proxy.ClusterConfig `toml:"from"`
+	To   *proxy.ClusterConfig   `toml:"to"`
+	// MaxRDBConcurrency is the size of worker pool to transfer and load rdb,
+	// the other upstream instances wait until a worker is free, default is
+	// the count of cpu.
+	MaxRDBConcurrency int `toml:"max_rdb_concurrency"`
+	// SourceBandwidth is the max bytes per second read from each upstream
+	// instance, 0 means unlimited.
+	SourceBandwidth int64 `toml:"source_bandwidth"`
+	// RDBDir is the dir to save the transferred rdb before loading it, so
+	// that anzi can load it again after crashed instead of transferring
+	// the whole rdb from upstream. Empty means stream rdb without saving.
+	// NOTICE: the repl-backlog-size of upstream must be large enough to
+	// hold all the writes during rdb loading.
+	RDBDir string `toml:"rdb_dir"`
+	// HTTPAddr is the address of control api to report the replication lag
+	// and cut over, empty means disabled.
+	HTTPAddr string `toml:"http_addr"`
+	// PipelineWindow is the max commands in flight to target of each
+	// upstream instance, the forwarding is blocked until the replies come
+	// if the window is full. Default 1024.
+	PipelineWindow int `toml:"pipeline_window"`
+	// Include is the glob patterns of keys to migrate, such as "sessions:*",
+	// empty means all the keys.
+	Include []string `toml:"include"`
+	// Exclude is the glob patterns of keys not to migrate, which is prior
+	// to Include.
+	Exclude []string `toml:"exclude"`
+	// DBs is the databases of upstream to migrate, empty means all.
+	DBs []uint64 `toml:"dbs"`
+	// TTLMax is the max ttl in milliseconds of keys in target, the longer
+	// ttl is capped, 0 means no limit.
+	TTLMax int64 `toml:"ttl_max"`
+	// TTLOffset is the milliseconds added to the ttl of keys with expiration,
+	// negative to shorten.
+	TTLOffset int64 `toml:"ttl_offset"`
+	// TTLDrop drops the ttl of keys not expired yet and persists them.
+	TTLDrop bool `toml:"ttl_drop"`
+	// CheckpointDir is the dir to save the replication id and the offset
+	// confirmed by target of each upstream instance, so that anzi continues
+	// syncing by PSYNC after restarted. Empty means disabled.
+	CheckpointDir string `toml:"checkpoint_dir"`
+	// CheckpointEtcd is the etcd address to save the checkpoint instead of
+	// CheckpointDir, such as "http://127.0.0.1:2379".
+	CheckpointEtcd string `toml:"checkpoint_etcd"`
 }
 
 // SetDefault migrate config
@@ -25,6 +67,9 @@ func (m *MigrateConfig) SetDefault() {
 	if m.MaxRDBConcurrency == 0 {
 		m.MaxRDBConcurrency = runtime.NumCPU()
 	}
+	if m.PipelineWindow <= 0 {
+		m.PipelineWindow = defaultPipelineWindow
+	}
 	for _, from := range m.From {
 		from.SetDefault()
 	}
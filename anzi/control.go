@@ -0,0 +1,291 @@
+package anzi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"overlord/pkg/conv"
+	"overlord/pkg/log"
+	"overlord/proxy"
+)
+
+const (
+	defaultCutoverTimeout = 30 * time.Second
+	masterReplOffsetField = "master_repl_offset:"
+)
+
+var (
+	infoReplicationCmd = []byte("*2\r\n$4\r\nINFO\r\n$11\r\nreplication\r\n")
+	// cutoverCheckInterval is the interval to check the lag while cutting over.
+	cutoverCheckInterval = 100 * time.Millisecond
+)
+
+// define control errors
+var (
+	ErrBadInfoReply    = errors.New("upstream replied bad info replication")
+	ErrCutoverInvalid  = errors.New("cut-over proxy, cluster and nodes are required")
+	ErrCutoverRunning  = errors.New("cut-over is already running")
+	ErrCutoverTimeout  = errors.New("cut-over timeout waiting for replication lag")
+	ErrProxyAdminReply = errors.New("proxy admin api replied error")
+)
+
+// Source is the replication state of an upstream instance.
+type Source struct {
+	Addr string `json:"addr"`
+	// Synced is true if the rdb is loaded and the commands are forwarding.
+	Synced       bool   `json:"synced"`
+	Offset       int64  `json:"offset"`
+	MasterOffset int64  `json:"master_offset"`
+	Lag          int64  `json:"lag"`
+	Error        string `json:"error,omitempty"`
+
+	// Commands is the count of commands confirmed by target.
+	Commands int64 `json:"commands"`
+	// InFlight is the count of commands waiting for the replies of target.
+	InFlight int64 `json:"inflight"`
+	// Errors is the count of error replies of target.
+	Errors int64 `json:"errors"`
+	// OPS is the count of commands confirmed in the last second.
+	OPS int64 `json:"ops"`
+	// RDBSize is the bytes of rdb, 0 if unknown such as diskless sync.
+	RDBSize int64 `json:"rdb_size"`
+	// Received is the bytes received from upstream in current sync.
+	Received int64 `json:"received"`
+}
+
+func (s *Source) caughtUp() bool {
+	return s.Synced && s.Error == "" && s.Lag <= 0
+}
+
+// Cutover is the request to switch the cluster of proxy into the target
+// after the replication caught up.
+type Cutover struct {
+	// Proxy is the stat address of proxy, such as 127.0.0.1:2110.
+	Proxy   string        `json:"proxy"`
+	Cluster string        `json:"cluster"`
+	Nodes   []*proxy.Node `json:"nodes"`
+	// Timeout is the max milliseconds to wait the lag to be zero, default
+	// 30000.
+	Timeout int `json:"timeout"`
+}
+
+// Sources returns the replication state of all the upstream instances, the
+// lag is the bytes of master_repl_offset of upstream ahead of the offset
+// confirmed by target. The master_repl_offset are fetched concurrently.
+func (m *MigrateProc) Sources() []*Source {
+	sources := make([]*Source, len(m.insts))
+	var wg sync.WaitGroup
+	wg.Add(len(m.insts))
+	for i, inst := range m.insts {
+		s := &Source{
+			Addr:   inst.Addr,
+			Synced: atomic.LoadInt32(&inst.synced) == 1,
+			Offset: atomic.LoadInt64(&inst.offset),
+
+			RDBSize:  atomic.LoadInt64(&inst.rdbSize),
+			Received: atomic.LoadInt64(&inst.received),
+		}
+		inst.lock.RLock()
+		if inst.cb != nil {
+			inst.cb.Stat(s)
+		}
+		inst.lock.RUnlock()
+		sources[i] = s
+		go func() {
+			defer wg.Done()
+			mo, err := masterOffset(s.Addr)
+			if err != nil {
+				s.Error = err.Error()
+			} else {
+				s.MasterOffset, s.Lag = mo, mo-s.Offset
+			}
+		}()
+	}
+	wg.Wait()
+	return sources
+}
+
+// Cutover pauses the writes of cluster by the proxy, waits for the lag of
+// all the upstream instances to be zero, switches the nodes of cluster and
+// then resumes the writes, the writes are resumed even if failed.
+func (m *MigrateProc) Cutover(c *Cutover) (sources []*Source, err error) {
+	if c.Proxy == "" || c.Cluster == "" || len(c.Nodes) == 0 {
+		return nil, ErrCutoverInvalid
+	}
+	if !atomic.CompareAndSwapInt32(&m.cutting, 0, 1) {
+		return nil, ErrCutoverRunning
+	}
+	defer atomic.StoreInt32(&m.cutting, 0)
+	timeout := time.Duration(c.Timeout) * time.Millisecond
+	if timeout <= 0 {
+		timeout = defaultCutoverTimeout
+	}
+	addr := c.Proxy
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	base := strings.TrimSuffix(addr, "/") + "/api/v1/clusters/" + url.PathEscape(c.Cluster)
+
+	log.Infof("cut-over cluster %s of proxy %s, pause writes", c.Cluster, c.Proxy)
+	if err = proxyAdmin(http.MethodPost, base+"/writes", &proxy.Writes{Paused: true}); err != nil {
+		return
+	}
+	defer func() {
+		log.Infof("cut-over cluster %s of proxy %s, resume writes", c.Cluster, c.Proxy)
+		if rerr := proxyAdmin(http.MethodPost, base+"/writes", &proxy.Writes{Paused: false}); rerr != nil {
+			log.Errorf("fail to resume writes of cluster %s due %s", c.Cluster, rerr)
+			if err == nil {
+				err = rerr
+			}
+		}
+	}()
+	if sources, err = m.waitCaughtUp(timeout); err != nil {
+		return
+	}
+	log.Infof("cut-over cluster %s of proxy %s, switch nodes", c.Cluster, c.Proxy)
+	err = proxyAdmin(http.MethodPut, base+"/nodes", c.Nodes)
+	return
+}
+
+func (m *MigrateProc) waitCaughtUp(timeout time.Duration) (sources []*Source, err error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		sources = m.Sources()
+		caught := true
+		for _, s := range sources {
+			caught = caught && s.caughtUp()
+		}
+		if caught {
+			return
+		}
+		if time.Now().After(deadline) {
+			return sources, ErrCutoverTimeout
+		}
+		time.Sleep(cutoverCheckInterval)
+	}
+}
+
+func (m *MigrateProc) serveHTTP(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/sources", m.sourcesHandler)
+	mux.HandleFunc("/api/v1/progress", m.progressHandler)
+	mux.HandleFunc("/api/v1/cutover", m.cutoverHandler)
+	go http.Serve(l, mux)
+	return nil
+}
+
+func (m *MigrateProc) sourcesHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(m.Sources())
+}
+
+func (m *MigrateProc) progressHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(m.Progress())
+}
+
+func (m *MigrateProc) cutoverHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	c := &Cutover{}
+	if err := json.NewDecoder(req.Body).Decode(c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sources, err := m.Cutover(c)
+	switch err {
+	case nil:
+		_ = json.NewEncoder(w).Encode(sources)
+	case ErrCutoverInvalid:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case ErrCutoverRunning:
+		http.Error(w, err.Error(), http.StatusConflict)
+	case ErrCutoverTimeout:
+		http.Error(w, err.Error(), http.StatusGatewayTimeout)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// proxyAdmin sends v as json into the admin api of proxy.
+func proxyAdmin(method, api string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(method, api, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: %d %s", ErrProxyAdminReply, api, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
+
+// masterOffset returns the master_repl_offset of upstream addr.
+func masterOffset(addr string) (int64, error) {
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(time.Second))
+	if err = writeAll(infoReplicationCmd, conn); err != nil {
+		return 0, err
+	}
+	br := bufio.NewReader(conn)
+	line, err := br.ReadBytes(byteLF)
+	if err != nil {
+		return 0, err
+	}
+	if len(line) < 4 || line[0] != byteBulkString {
+		return 0, ErrBadInfoReply
+	}
+	size, err := conv.Btoi(line[1 : len(line)-2])
+	if err != nil {
+		return 0, ErrBadInfoReply
+	}
+	data := make([]byte, size+2)
+	if _, err = io.ReadFull(br, data); err != nil {
+		return 0, err
+	}
+	for _, l := range strings.Split(string(data), "\r\n") {
+		if strings.HasPrefix(l, masterReplOffsetField) {
+			return strconv.ParseInt(strings.TrimPrefix(l, masterReplOffsetField), 10, 64)
+		}
+	}
+	return 0, ErrBadInfoReply
+}
@@ -0,0 +1,115 @@
+package anzi
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"overlord/proxy"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// _upstream replies INFO replication with master_repl_offset 100.
+func _upstream(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	info := "# Replication\r\nrole:master\r\nmaster_repl_offset:100\r\n"
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Read(make([]byte, 64))
+			_, _ = fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(info), info)
+			conn.Close()
+		}
+	}()
+	return l.Addr().String()
+}
+
+type _adminProxy struct {
+	lock sync.Mutex
+	reqs []string
+	inst *Instance
+}
+
+func (p *_adminProxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	p.lock.Lock()
+	p.reqs = append(p.reqs, req.Method+" "+req.URL.Path+" "+string(body))
+	p.lock.Unlock()
+	if p.inst != nil && strings.Contains(string(body), `"paused":true`) {
+		// NOTE: catch up after the writes paused
+		atomic.StoreInt64(&p.inst.offset, 100)
+	}
+}
+
+func TestMigrateProcSources(t *testing.T) {
+	inst := &Instance{Addr: _upstream(t), offset: 90, synced: 1}
+	m := &MigrateProc{insts: []*Instance{inst, {Addr: "127.0.0.1:1"}}}
+	sources := m.Sources()
+	assert.Len(t, sources, 2)
+	assert.Equal(t, &Source{Addr: inst.Addr, Synced: true, Offset: 90, MasterOffset: 100, Lag: 10}, sources[0])
+	assert.False(t, sources[0].caughtUp())
+	assert.True(t, sources[1].Error != "")
+}
+
+func TestMigrateProcCutover(t *testing.T) {
+	inst := &Instance{Addr: _upstream(t), offset: 90, synced: 1}
+	m := &MigrateProc{insts: []*Instance{inst}}
+	p := &_adminProxy{inst: inst}
+	ts := httptest.NewServer(p)
+	defer ts.Close()
+	nodes := []*proxy.Node{{Addr: "127.0.0.1:7000", Weight: 1}}
+
+	_, err := m.Cutover(&Cutover{Proxy: ts.URL, Cluster: "c"})
+	assert.Equal(t, ErrCutoverInvalid, err)
+
+	sources, err := m.Cutover(&Cutover{Proxy: strings.TrimPrefix(ts.URL, "http://"), Cluster: "c", Nodes: nodes})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), sources[0].Lag)
+	assert.Equal(t, []string{
+		`POST /api/v1/clusters/c/writes {"paused":true}`,
+		`PUT /api/v1/clusters/c/nodes [{"addr":"127.0.0.1:7000","weight":1}]`,
+		`POST /api/v1/clusters/c/writes {"paused":false}`,
+	}, p.reqs)
+
+	// NOTE: the writes are resumed if timeout
+	p.reqs, p.inst = nil, nil
+	inst.offset = 90
+	_, err = m.Cutover(&Cutover{Proxy: ts.URL, Cluster: "c", Nodes: nodes, Timeout: 50})
+	assert.Equal(t, ErrCutoverTimeout, err)
+	assert.Equal(t, []string{
+		`POST /api/v1/clusters/c/writes {"paused":true}`,
+		`POST /api/v1/clusters/c/writes {"paused":false}`,
+	}, p.reqs)
+}
+
+func TestMigrateProcCutoverHandler(t *testing.T) {
+	m := &MigrateProc{}
+	w := httptest.NewRecorder()
+	m.cutoverHandler(w, httptest.NewRequest(http.MethodPost, "/api/v1/cutover", strings.NewReader(`{"cluster":"c"}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = httptest.NewRecorder()
+	m.cutoverHandler(w, httptest.NewRequest(http.MethodGet, "/api/v1/cutover", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	atomic.StoreInt32(&m.cutting, 1)
+	w = httptest.NewRecorder()
+	body := `{"proxy":"127.0.0.1:2110","cluster":"c","nodes":[{"addr":"127.0.0.1:7000","weight":1}]}`
+	m.cutoverHandler(w, httptest.NewRequest(http.MethodPost, "/api/v1/cutover", strings.NewReader(body)))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = httptest.NewRecorder()
+	m.sourcesHandler(w, httptest.NewRequest(http.MethodGet, "/api/v1/sources", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "[]\n", w.Body.String())
+}
@@ -0,0 +1,345 @@
+package anzi
+
+import (
+	"bytes"
+	"strconv"
+
+	"overlord/pkg/log"
+)
+
+// keyFilter filters the keys and databases of upstream to migrate.
+type keyFilter struct {
+	include [][]byte
+	exclude [][]byte
+	dbs     map[uint64]struct{}
+
+	// db is the current database selected by rdb or replication stream.
+	db uint64
+}
+
+// newKeyFilter returns nil if all the keys of all the databases are migrated.
+func newKeyFilter(cfg *MigrateConfig) *keyFilter {
+	if len(cfg.Include) == 0 && len(cfg.Exclude) == 0 && len(cfg.DBs) == 0 {
+		return nil
+	}
+	f := &keyFilter{}
+	for _, p := range cfg.Include {
+		f.include = append(f.include, []byte(p))
+	}
+	for _, p := range cfg.Exclude {
+		f.exclude = append(f.exclude, []byte(p))
+	}
+	if len(cfg.DBs) > 0 {
+		f.dbs = make(map[uint64]struct{}, len(cfg.DBs))
+		for _, db := range cfg.DBs {
+			f.dbs[db] = struct{}{}
+		}
+	}
+	return f
+}
+
+func (f *keyFilter) selectDB(db uint64) {
+	f.db = db
+}
+
+func (f *keyFilter) dbSelected() bool {
+	if f.dbs == nil {
+		return true
+	}
+	_, ok := f.dbs[f.db]
+	return ok
+}
+
+// match returns true if the key in current database should be migrated.
+func (f *keyFilter) match(key []byte) bool {
+	if !f.dbSelected() {
+		return false
+	}
+	for _, p := range f.exclude {
+		if globMatch(p, key) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, p := range f.include {
+		if globMatch(p, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// define the commands of replication stream which keys are not at the first
+// argument.
+var (
+	keylessCmds = map[string]struct{}{
+		"PING": {}, "MULTI": {}, "EXEC": {}, "DISCARD": {}, "FLUSHALL": {},
+		"FLUSHDB": {}, "SCRIPT": {}, "FUNCTION": {}, "REPLCONF": {},
+	}
+	multiKeyCmds = map[string]int{
+		"DEL": 1, "UNLINK": 1, "EXISTS": 1, "TOUCH": 1, "MSET": 2, "MSETNX": 2,
+	}
+)
+
+// command returns the command of replication stream to forward, the multiple
+// keys command is rewritten with the matched keys only, and nil is returned
+// if the command should be skipped.
+func (f *keyFilter) command(cmd []byte) []byte {
+	args := splitCommand(cmd)
+	if len(args) == 0 {
+		return cmd
+	}
+	name := string(bytes.ToUpper(args[0]))
+	if name == "SELECT" && len(args) == 2 {
+		db, err := strconv.ParseUint(string(args[1]), 10, 64)
+		if err != nil {
+			log.Warnf("upstream select bad db %s", strconv.Quote(string(args[1])))
+		}
+		f.selectDB(db)
+		return cmd
+	}
+	if !f.dbSelected() {
+		return nil
+	}
+	if _, ok := keylessCmds[name]; ok || len(args) < 2 {
+		return cmd
+	}
+	step, ok := multiKeyCmds[name]
+	if !ok {
+		if f.match(args[1]) {
+			return cmd
+		}
+		return nil
+	}
+
+	kept := [][]byte{args[0]}
+	for i := 1; i+step <= len(args); i += step {
+		if f.match(args[i]) {
+			kept = append(kept, args[i:i+step]...)
+		}
+	}
+	if len(kept) == len(args) {
+		return cmd
+	} else if len(kept) == 1 {
+		return nil
+	}
+	return joinCommand(kept)
+}
+
+// splitCommand splits the RESP command read by readCommand into arguments.
+func splitCommand(cmd []byte) (args [][]byte) {
+	for {
+		i := bytes.IndexByte(cmd, byteLF)
+		if i < 0 {
+			return
+		}
+		line := cmd[:i+1]
+		cmd = cmd[i+1:]
+		if line[0] != byteBulkString {
+			continue
+		}
+		size, err := strconv.Atoi(string(bytes.TrimSpace(line[1:])))
+		if err != nil || size < 0 || size+2 > len(cmd) {
+			return
+		}
+		args = append(args, cmd[:size])
+		cmd = cmd[size+2:]
+	}
+}
+
+func joinCommand(args [][]byte) []byte {
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		buf.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n")
+		buf.Write(arg)
+		buf.WriteString("\r\n")
+	}
+	return buf.Bytes()
+}
+
+// globMatch reports whether key matches the glob style pattern as redis
+// KEYS, supporting *, ?, [abc], [^abc], [a-z] and \ to escape.
+func globMatch(pattern, key []byte) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(key); i++ {
+				if globMatch(pattern[1:], key[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(key) == 0 {
+				return false
+			}
+			key = key[1:]
+		case '[':
+			if len(key) == 0 {
+				return false
+			}
+			pattern = pattern[1:]
+			not := len(pattern) > 0 && pattern[0] == '^'
+			if not {
+				pattern = pattern[1:]
+			}
+			matched := false
+			for len(pattern) > 0 && pattern[0] != ']' {
+				if pattern[0] == '\\' && len(pattern) >= 2 {
+					pattern = pattern[1:]
+					matched = matched || pattern[0] == key[0]
+				} else if len(pattern) >= 3 && pattern[1] == '-' {
+					start, end := pattern[0], pattern[2]
+					if start > end {
+						start, end = end, start
+					}
+					matched = matched || (key[0] >= start && key[0] <= end)
+					pattern = pattern[2:]
+				} else {
+					matched = matched || pattern[0] == key[0]
+				}
+				pattern = pattern[1:]
+			}
+			if matched == not {
+				return false
+			}
+			key = key[1:]
+			if len(pattern) == 0 {
+				// NOTE: the class is not closed, which is treated as closed.
+				return len(key) == 0
+			}
+		case '\\':
+			if len(pattern) >= 2 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(key) == 0 || pattern[0] != key[0] {
+				return false
+			}
+			key = key[1:]
+		}
+		pattern = pattern[1:]
+	}
+	return len(key) == 0
+}
+
+// filterCallback skips the keys of rdb not matched by filter.
+type filterCallback struct {
+	RDBCallback
+	f *keyFilter
+
+	key     []byte
+	matched bool
+	skipped int64
+}
+
+func newFilterCallback(cb RDBCallback, f *keyFilter) *filterCallback {
+	return &filterCallback{RDBCallback: cb, f: f}
+}
+
+// accept caches the result of last key because the elements of one key are
+// called one by one.
+func (c *filterCallback) accept(key []byte) bool {
+	if c.key != nil && bytes.Equal(key, c.key) {
+		return c.matched
+	}
+	c.key = append(c.key[:0], key...)
+	c.matched = c.f.match(key)
+	if !c.matched {
+		c.skipped++
+	}
+	return c.matched
+}
+
+// SelectDB impl Callback
+func (c *filterCallback) SelectDB(dbnum uint64) {
+	c.f.selectDB(dbnum)
+	c.key = nil
+	c.RDBCallback.SelectDB(dbnum)
+}
+
+// EndOfRDB impl Callback
+func (c *filterCallback) EndOfRDB() {
+	log.Infof("skip %d keys of rdb by filter", c.skipped)
+	c.RDBCallback.EndOfRDB()
+}
+
+// CmdSet impl Callback
+func (c *filterCallback) CmdSet(key, val []byte, expire uint64) {
+	if c.accept(key) {
+		c.RDBCallback.CmdSet(key, val, expire)
+	}
+}
+
+// CmdRPush impl Callback
+func (c *filterCallback) CmdRPush(key, val []byte) {
+	if c.accept(key) {
+		c.RDBCallback.CmdRPush(key, val)
+	}
+}
+
+// CmdSAdd impl Callback
+func (c *filterCallback) CmdSAdd(key, val []byte) {
+	if c.accept(key) {
+		c.RDBCallback.CmdSAdd(key, val)
+	}
+}
+
+// CmdZAdd impl Callback
+func (c *filterCallback) CmdZAdd(key []byte, score float64, val []byte) {
+	if c.accept(key) {
+		c.RDBCallback.CmdZAdd(key, score, val)
+	}
+}
+
+// CmdHSet impl Callback
+func (c *filterCallback) CmdHSet(key, field, value []byte) {
+	if c.accept(key) {
+		c.RDBCallback.CmdHSet(key, field, value)
+	}
+}
+
+// CmdHSetInt impl Callback
+func (c *filterCallback) CmdHSetInt(key, field []byte, value int64) {
+	if c.accept(key) {
+		c.RDBCallback.CmdHSetInt(key, field, value)
+	}
+}
+
+// CmdXAdd impl Callback
+func (c *filterCallback) CmdXAdd(key, id []byte, fields [][]byte) {
+	if c.accept(key) {
+		c.RDBCallback.CmdXAdd(key, id, fields)
+	}
+}
+
+// CmdXGroupCreate impl Callback
+func (c *filterCallback) CmdXGroupCreate(key, group, id []byte) {
+	if c.accept(key) {
+		c.RDBCallback.CmdXGroupCreate(key, group, id)
+	}
+}
+
+// CmdXSetID impl Callback
+func (c *filterCallback) CmdXSetID(key, id []byte) {
+	if c.accept(key) {
+		c.RDBCallback.CmdXSetID(key, id)
+	}
+}
+
+// ExpireAt impl Callback
+func (c *filterCallback) ExpireAt(key []byte, expiry uint64) {
+	if c.accept(key) {
+		c.RDBCallback.ExpireAt(key, expiry)
+	}
+}
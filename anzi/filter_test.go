@@ -0,0 +1,116 @@
+package anzi
+
+import (
+	"bufio"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"overlord/pkg/mockconn"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGlobMatch(t *testing.T) {
+	cases := []struct {
+		pattern, key string
+		match        bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"sessions:*", "sessions:1", true},
+		{"sessions:*", "session:1", false},
+		{"*:cache:*", "user:cache:1", true},
+		{"*:cache", "user:cache:1", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{"h\\*llo", "h*llo", true},
+		{"h\\*llo", "hello", false},
+		{"a/*", "a/b/c", true},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.match, globMatch([]byte(c.pattern), []byte(c.key)), c.pattern+" "+c.key)
+	}
+}
+
+func TestKeyFilterMatch(t *testing.T) {
+	assert.Nil(t, newKeyFilter(&MigrateConfig{}))
+
+	f := newKeyFilter(&MigrateConfig{
+		Include: []string{"sessions:*", "users:*"},
+		Exclude: []string{"users:admin*"},
+		DBs:     []uint64{0, 2},
+	})
+	assert.True(t, f.match([]byte("sessions:1")))
+	assert.True(t, f.match([]byte("users:1")))
+	assert.False(t, f.match([]byte("users:admin:1")))
+	assert.False(t, f.match([]byte("orders:1")))
+	f.selectDB(1)
+	assert.False(t, f.match([]byte("sessions:1")))
+	f.selectDB(2)
+	assert.True(t, f.match([]byte("sessions:1")))
+}
+
+func TestKeyFilterCommand(t *testing.T) {
+	f := newKeyFilter(&MigrateConfig{Include: []string{"a*"}, DBs: []uint64{0}})
+	assert.Equal(t, _cmd("SET", "a1", "v"), f.command(_cmd("SET", "a1", "v")))
+	assert.Nil(t, f.command(_cmd("SET", "b1", "v")))
+	assert.Equal(t, _cmd("PING"), f.command(_cmd("PING")))
+	assert.Equal(t, _cmd("MULTI"), f.command(_cmd("MULTI")))
+	assert.Equal(t, _cmd("del", "a1", "a2"), f.command(_cmd("del", "a1", "a2")))
+	assert.Equal(t, _cmd("DEL", "a2"), f.command(_cmd("DEL", "b1", "a2")))
+	assert.Nil(t, f.command(_cmd("DEL", "b1", "b2")))
+	assert.Equal(t, _cmd("MSET", "a1", "1"), f.command(_cmd("MSET", "b1", "2", "a1", "1")))
+
+	assert.Equal(t, _cmd("SELECT", "1"), f.command(_cmd("SELECT", "1")))
+	assert.Nil(t, f.command(_cmd("SET", "a1", "v")))
+	assert.Nil(t, f.command(_cmd("PING")))
+	assert.Equal(t, _cmd("SELECT", "0"), f.command(_cmd("SELECT", "0")))
+	assert.Equal(t, _cmd("SET", "a1", "v"), f.command(_cmd("SET", "a1", "v")))
+}
+
+func TestFilterCallback(t *testing.T) {
+	cb := &_cmdCallback{mockRDBCallback: *_buildCB()}
+	f := newKeyFilter(&MigrateConfig{Include: []string{"sessions:*"}, DBs: []uint64{0}})
+	fcb := newFilterCallback(cb, f)
+
+	fcb.SelectDB(0)
+	fcb.CmdRPush([]byte("sessions:1"), []byte("a"))
+	fcb.CmdRPush([]byte("sessions:1"), []byte("b"))
+	fcb.CmdRPush([]byte("users:1"), []byte("c"))
+	fcb.CmdSAdd([]byte("sessions:2"), []byte("d"))
+	fcb.SelectDB(1)
+	fcb.CmdSAdd([]byte("sessions:3"), []byte("e"))
+	assert.Equal(t, []string{"RPUSH sessions:1 a", "RPUSH sessions:1 b", "SADD sessions:2 d"}, cb.cmds)
+	assert.Equal(t, int64(2), fcb.skipped)
+}
+
+func TestCmdForwardFiltered(t *testing.T) {
+	addr, cmds := _fakeTarget(t)
+	data := "*2\r\n$6\r\nSELECT\r\n$1\r\n1\r\n*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\nb\r\n" +
+		"*2\r\n$6\r\nSELECT\r\n$1\r\n0\r\n*3\r\n$3\r\nSET\r\n$1\r\nb\r\n$1\r\nb\r\n*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\nb\r\n" +
+		"*3\r\n$3\r\nSET\r\n$1\r\nb\r\n$1\r\nb\r\n"
+	conn := mockconn.CreateConn([]byte(data), 1)
+	inst := &Instance{
+		Target: addr,
+		conn:   conn,
+		br:     bufio.NewReader(conn),
+		bw:     bufio.NewWriter(conn),
+		filter: newKeyFilter(&MigrateConfig{Include: []string{"a"}, DBs: []uint64{0}}),
+	}
+	inst.cb = NewProtocolCallbacker(addr, 0, &inst.offset)
+	defer inst.Close()
+
+	_ = inst.cmdForward()
+	for i := 0; i < 100 && atomic.LoadInt64(&inst.offset) != int64(len(data)); i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.Equal(t, int64(len(data)), atomic.LoadInt64(&inst.offset))
+	assert.Equal(t, int64(3), atomic.LoadInt64(cmds))
+}
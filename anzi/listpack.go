@@ -0,0 +1,235 @@
+package anzi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// listpack entry encodings, see listpack.c of redis.
+const (
+	lpEncoding7BitUintMask = 0x80
+	lpEncoding6BitStrMask  = 0xC0
+	lpEncoding6BitStr      = 0x80
+	lpEncoding13BitIntMask = 0xE0
+	lpEncoding13BitInt     = 0xC0
+	lpEncoding12BitStrMask = 0xF0
+	lpEncoding12BitStr     = 0xE0
+	lpEncoding32BitStr     = 0xF0
+	lpEncoding16BitInt     = 0xF1
+	lpEncoding24BitInt     = 0xF2
+	lpEncoding32BitInt     = 0xF3
+	lpEncoding64BitInt     = 0xF4
+	lpEOF                  = 0xFF
+
+	// lpHeaderSize is total bytes(uint32) and number of elements(uint16).
+	lpHeaderSize = 6
+)
+
+// readListPack parses all the entries of listpack data, the integers are
+// formatted as decimal strings as ziplist.
+func readListPack(data []byte) (entries [][]byte, err error) {
+	if len(data) < lpHeaderSize+1 {
+		return nil, fmt.Errorf("listpack too short with %d bytes", len(data))
+	}
+	srd := bytes.NewReader(data[lpHeaderSize:])
+	for {
+		var entry []byte
+		entry, err = readListPackEntry(srd)
+		if err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// readListPackEntry reads the next entry of srd and skips its backlen,
+// io.EOF is returned at the end of listpack.
+func readListPackEntry(srd *bytes.Reader) (entry []byte, err error) {
+	header, err := srd.ReadByte()
+	if err != nil {
+		return
+	}
+	var (
+		size  int // NOTE: size of encoding and data for backlen
+		ival  int64
+		isInt = true
+	)
+	switch {
+	case header == lpEOF:
+		return nil, io.EOF
+	case header&lpEncoding7BitUintMask == 0:
+		ival, size = int64(header&0x7f), 1
+	case header&lpEncoding6BitStrMask == lpEncoding6BitStr:
+		entry, err = readListPackString(srd, int(header&0x3f))
+		isInt, size = false, 1+len(entry)
+	case header&lpEncoding13BitIntMask == lpEncoding13BitInt:
+		var next byte
+		if next, err = srd.ReadByte(); err != nil {
+			return
+		}
+		uv := int64(header&0x1f)<<8 | int64(next)
+		if uv >= 1<<12 {
+			uv -= 1 << 13
+		}
+		ival, size = uv, 2
+	case header&lpEncoding12BitStrMask == lpEncoding12BitStr:
+		var next byte
+		if next, err = srd.ReadByte(); err != nil {
+			return
+		}
+		entry, err = readListPackString(srd, int(header&0x0f)<<8|int(next))
+		isInt, size = false, 2+len(entry)
+	case header == lpEncoding32BitStr:
+		var length uint32
+		if err = binary.Read(srd, binary.LittleEndian, &length); err != nil {
+			return
+		}
+		entry, err = readListPackString(srd, int(length))
+		isInt, size = false, 5+len(entry)
+	case header == lpEncoding16BitInt:
+		var v int16
+		err = binary.Read(srd, binary.LittleEndian, &v)
+		ival, size = int64(v), 3
+	case header == lpEncoding24BitInt:
+		var v int32
+		v, err = read24ByteInt(srd)
+		// NOTE: sign extend the 24 bits
+		ival, size = int64(v<<8)>>8, 4
+	case header == lpEncoding32BitInt:
+		var v int32
+		err = binary.Read(srd, binary.LittleEndian, &v)
+		ival, size = int64(v), 5
+	case header == lpEncoding64BitInt:
+		err = binary.Read(srd, binary.LittleEndian, &ival)
+		size = 9
+	default:
+		return nil, fmt.Errorf("invalid listpack entry header %d", header)
+	}
+	if err != nil {
+		return
+	}
+	if isInt {
+		entry = []byte(strconv.FormatInt(ival, 10))
+	}
+	_, err = srd.Seek(int64(lpBacklenSize(size)), io.SeekCurrent)
+	return
+}
+
+func readListPackString(srd *bytes.Reader, length int) (data []byte, err error) {
+	data = make([]byte, length)
+	_, err = io.ReadFull(srd, data)
+	return
+}
+
+// lpBacklenSize returns the bytes of backlen which encodes size in 7 bits
+// each byte.
+func lpBacklenSize(size int) int {
+	switch {
+	case size <= 127:
+		return 1
+	case size < 16383:
+		return 2
+	case size < 2097151:
+		return 3
+	case size < 268435455:
+		return 4
+	default:
+		return 5
+	}
+}
+
+func (r *RDB) readListPackObject() (entries [][]byte, err error) {
+	var data []byte
+	if data, err = r.readString(); err != nil {
+		return
+	}
+	return readListPack(data)
+}
+
+func (r *RDB) readHashFromListPack() (err error) {
+	entries, err := r.readListPackObject()
+	if err != nil {
+		return
+	}
+	if len(entries)%2 != 0 {
+		return fmt.Errorf("read hash from listpack but get odd number %d of element", len(entries))
+	}
+	for i := 0; i < len(entries); i += 2 {
+		r.cb.CmdHSet(r.key, entries[i], entries[i+1])
+	}
+	r.cb.ExpireAt(r.key, r.expiry)
+	return
+}
+
+func (r *RDB) readZSetFromListPack() (err error) {
+	entries, err := r.readListPackObject()
+	if err != nil {
+		return
+	}
+	if len(entries)%2 != 0 {
+		return fmt.Errorf("read zset from listpack but get odd number %d of element", len(entries))
+	}
+	for i := 0; i < len(entries); i += 2 {
+		var score float64
+		if score, err = strconv.ParseFloat(string(entries[i+1]), 64); err != nil {
+			return
+		}
+		r.cb.CmdZAdd(r.key, score, entries[i])
+	}
+	r.cb.ExpireAt(r.key, r.expiry)
+	return
+}
+
+func (r *RDB) readSetFromListPack() (err error) {
+	entries, err := r.readListPackObject()
+	if err != nil {
+		return
+	}
+	for _, member := range entries {
+		r.cb.CmdSAdd(r.key, member)
+	}
+	r.cb.ExpireAt(r.key, r.expiry)
+	return
+}
+
+// readListFromQuickList2 reads the quicklist of which the node is a plain
+// element or a listpack.
+func (r *RDB) readListFromQuickList2() (err error) {
+	count, err := r.readLength()
+	if err != nil {
+		return
+	}
+	for i := uint64(0); i < count; i++ {
+		var (
+			container uint64
+			data      []byte
+		)
+		if container, err = r.readLength(); err != nil {
+			return
+		}
+		if data, err = r.readString(); err != nil {
+			return
+		}
+		switch container {
+		case quickListNodeContainerPlain:
+			r.cb.CmdRPush(r.key, data)
+		case quickListNodeContainerPacked:
+			var entries [][]byte
+			if entries, err = readListPack(data); err != nil {
+				return
+			}
+			for _, entry := range entries {
+				r.cb.CmdRPush(r.key, entry)
+			}
+		default:
+			return fmt.Errorf("unknown quicklist node container %d", container)
+		}
+	}
+	r.cb.ExpireAt(r.key, r.expiry)
+	return
+}
@@ -0,0 +1,204 @@
+package anzi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// _lp encodes entries into listpack, the int entries are encoded as integer.
+func _lp(entries ...interface{}) []byte {
+	buf := make([]byte, lpHeaderSize)
+	for _, e := range entries {
+		var enc []byte
+		switch v := e.(type) {
+		case int:
+			switch {
+			case v >= 0 && v < 128:
+				enc = []byte{byte(v)}
+			case v >= -4096 && v < 4096:
+				uv := uint16(v) & 0x1fff
+				enc = []byte{lpEncoding13BitInt | byte(uv>>8), byte(uv)}
+			case v >= -32768 && v < 32768:
+				enc = []byte{lpEncoding16BitInt, byte(v), byte(v >> 8)}
+			case v >= -(1<<23) && v < 1<<23:
+				enc = []byte{lpEncoding24BitInt, byte(v), byte(v >> 8), byte(v >> 16)}
+			default:
+				enc = make([]byte, 9)
+				enc[0] = lpEncoding64BitInt
+				binary.LittleEndian.PutUint64(enc[1:], uint64(v))
+			}
+		case string:
+			switch {
+			case len(v) < 64:
+				enc = append([]byte{lpEncoding6BitStr | byte(len(v))}, v...)
+			case len(v) < 4096:
+				enc = append([]byte{lpEncoding12BitStr | byte(len(v)>>8), byte(len(v))}, v...)
+			default:
+				enc = make([]byte, 5, 5+len(v))
+				enc[0] = lpEncoding32BitStr
+				binary.LittleEndian.PutUint32(enc[1:], uint32(len(v)))
+				enc = append(enc, v...)
+			}
+		}
+		buf = append(buf, enc...)
+		// NOTE: backlen is skipped by parser
+		buf = append(buf, make([]byte, lpBacklenSize(len(enc)))...)
+	}
+	buf = append(buf, lpEOF)
+	binary.LittleEndian.PutUint32(buf, uint32(len(buf)))
+	binary.LittleEndian.PutUint16(buf[4:], uint16(len(entries)))
+	return buf
+}
+
+func _rdbLen(n int) []byte {
+	switch {
+	case n < 64:
+		return []byte{byte(n)}
+	case n < 16384:
+		return []byte{0x40 | byte(n>>8), byte(n)}
+	default:
+		b := []byte{RDB32BitLen, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(b[1:], uint32(n))
+		return b
+	}
+}
+
+func _rdbStr(s []byte) []byte {
+	return append(_rdbLen(len(s)), s...)
+}
+
+func _streamID(ms, seq uint64) []byte {
+	id := make([]byte, 16)
+	binary.BigEndian.PutUint64(id, ms)
+	binary.BigEndian.PutUint64(id[8:], seq)
+	return id
+}
+
+type _cmdCallback struct {
+	mockRDBCallback
+	cmds []string
+}
+
+func (c *_cmdCallback) add(args ...[]byte) {
+	ss := make([]string, 0, len(args))
+	for _, arg := range args {
+		ss = append(ss, string(arg))
+	}
+	c.cmds = append(c.cmds, strings.Join(ss, " "))
+}
+
+func (c *_cmdCallback) CmdRPush(key, val []byte) { c.add(BytesRPush, key, val) }
+func (c *_cmdCallback) CmdSAdd(key, val []byte)  { c.add(BytesSAdd, key, val) }
+func (c *_cmdCallback) CmdZAdd(key []byte, score float64, val []byte) {
+	c.add(BytesZAdd, key, []byte(strconv.FormatFloat(score, 'f', -1, 64)), val)
+}
+func (c *_cmdCallback) CmdHSet(key, field, value []byte) { c.add(BytesHSet, key, field, value) }
+func (c *_cmdCallback) CmdXAdd(key, id []byte, fields [][]byte) {
+	c.add(append([][]byte{BytesXAdd, key, id}, fields...)...)
+}
+func (c *_cmdCallback) CmdXGroupCreate(key, group, id []byte) {
+	c.add(BytesXGroup, BytesCreate, key, group, id)
+}
+func (c *_cmdCallback) CmdXSetID(key, id []byte) { c.add(BytesXSetID, key, id) }
+
+func _syncRDB(version string, objs ...[]byte) (*_cmdCallback, error) {
+	data := []byte("REDIS" + version)
+	for _, obj := range objs {
+		data = append(data, obj...)
+	}
+	data = append(data, RDBOpcodeEOF)
+	data = append(data, make([]byte, 8)...)
+	cb := &_cmdCallback{mockRDBCallback: *_buildCB()}
+	err := NewRDB(bufio.NewReader(bytes.NewReader(data)), cb).bgSyncProc()
+	return cb, err
+}
+
+func TestReadListPack(t *testing.T) {
+	long, huge := strings.Repeat("a", 100), strings.Repeat("b", 5000)
+	entries, err := readListPack(_lp(5, -100, 1000, -30000, 100000, -100000, 1<<40, -(1 << 40), "s", long, huge))
+	assert.NoError(t, err)
+	expect := []string{"5", "-100", "1000", "-30000", "100000", "-100000", "1099511627776", "-1099511627776", "s", long, huge}
+	assert.Len(t, entries, len(expect))
+	for i, e := range expect {
+		assert.Equal(t, e, string(entries[i]))
+	}
+
+	_, err = readListPack([]byte{1, 2})
+	assert.Error(t, err)
+	_, err = readListPack(append(_lp("a")[:lpHeaderSize], 0xF8, lpEOF))
+	assert.Error(t, err)
+}
+
+func TestParseListPackRDB(t *testing.T) {
+	var ql []byte
+	ql = append(ql, _rdbLen(2)...)
+	ql = append(ql, _rdbLen(quickListNodeContainerPacked)...)
+	ql = append(ql, _rdbStr(_lp("a", 1))...)
+	ql = append(ql, _rdbLen(quickListNodeContainerPlain)...)
+	ql = append(ql, _rdbStr([]byte("plain"))...)
+	cb, err := _syncRDB("0011",
+		append(append([]byte{RDBTypeHashListPack}, _rdbStr([]byte("h"))...), _rdbStr(_lp("f1", "v1", "f2", 2))...),
+		append(append([]byte{RDBTypeZSetListPack}, _rdbStr([]byte("z"))...), _rdbStr(_lp("m1", "1.5", "m2", 2))...),
+		append(append([]byte{RDBTypeSetListPack}, _rdbStr([]byte("s"))...), _rdbStr(_lp("x", 7))...),
+		append(append([]byte{RDBTypeListQuickList2}, _rdbStr([]byte("l"))...), ql...),
+		append([]byte{RDBOpcodeFunction2}, _rdbStr([]byte("#!lua name=lib\n"))...),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"HSET h f1 v1", "HSET h f2 2",
+		"ZADD z 1.5 m1", "ZADD z 2 m2",
+		"SADD s x", "SADD s 7",
+		"RPUSH l a", "RPUSH l 1", "RPUSH l plain",
+	}, cb.cmds)
+
+	_, err = _syncRDB("0012")
+	assert.Error(t, err)
+	_, err = _syncRDB("0010", []byte{RDBOpcodeFunctionPreGA})
+	assert.Error(t, err)
+}
+
+func TestParseStreamListPacks3(t *testing.T) {
+	lp := _lp(
+		2, 1, 2, "f1", "f2", 0, // master entry: count, deleted, fields and terminator
+		streamItemFlagSameFields, 0, 0, "a", "b", 6,
+		streamItemFlagSameFields|streamItemFlagDeleted, 1, 0, "c", "d", 6,
+		0, 5, 1, 1, "g", "h", 7,
+	)
+	obj := append([]byte{RDBTypeStreamListPacks3}, _rdbStr([]byte("st"))...)
+	obj = append(obj, _rdbLen(1)...)
+	obj = append(obj, _rdbStr(_streamID(1000, 0))...)
+	obj = append(obj, _rdbStr(lp)...)
+	obj = append(obj, _rdbLen(2)...)    // items
+	obj = append(obj, _rdbLen(1005)...) // last id
+	obj = append(obj, _rdbLen(1)...)
+	obj = append(obj, append(_rdbLen(1000), _rdbLen(0)...)...) // first id
+	obj = append(obj, append(_rdbLen(1001), _rdbLen(0)...)...) // max deleted id
+	obj = append(obj, _rdbLen(3)...)                           // entries added
+	obj = append(obj, _rdbLen(1)...)                           // groups
+	obj = append(obj, _rdbStr([]byte("g1"))...)
+	obj = append(obj, append(_rdbLen(1000), _rdbLen(0)...)...) // last delivered id
+	obj = append(obj, _rdbLen(1)...)                           // entries read
+	obj = append(obj, _rdbLen(1)...)                           // pending
+	obj = append(obj, _streamID(1000, 0)...)
+	obj = append(obj, make([]byte, 8)...) // delivery time
+	obj = append(obj, _rdbLen(1)...)      // delivery count
+	obj = append(obj, _rdbLen(1)...)      // consumers
+	obj = append(obj, _rdbStr([]byte("c1"))...)
+	obj = append(obj, make([]byte, 16)...) // seen and active time
+	obj = append(obj, _rdbLen(1)...)       // consumer pending
+	obj = append(obj, _streamID(1000, 0)...)
+	cb, err := _syncRDB("0011", obj)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"XADD st 1000-0 f1 a f2 b",
+		"XADD st 1005-1 g h",
+		"XGROUP CREATE st g1 1000-0",
+		"XSETID st 1005-1",
+	}, cb.cmds)
+}
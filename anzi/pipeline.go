@@ -0,0 +1,268 @@
+package anzi
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"overlord/pkg/conv"
+	"overlord/pkg/log"
+)
+
+const (
+	defaultPipelineWindow = 1024
+	byteError             = byte('-')
+)
+
+// define pipeline errors
+var (
+	ErrBadCommand     = errors.New("upstream sent bad command")
+	ErrBadReply       = errors.New("target replied bad reply")
+	ErrPipelineClosed = errors.New("target pipeline is closed")
+)
+
+// pipeline writes the commands into target without waiting for the replies,
+// and the replies are read in order to confirm the commands. At most window
+// commands are in flight, the writer is blocked until the earlier commands
+// are confirmed, which pushes the backpressure to upstream.
+type pipeline struct {
+	conn net.Conn
+	bw   *bufio.Writer
+	br   *bufio.Reader
+
+	// inflight holds the replication offset delta of each command waiting
+	// for reply, and the delta is added into offset after confirmed.
+	inflight chan int64
+	offset   *int64
+	// pending is the count of commands which delta is not added yet.
+	pending int64
+	// skipped is the delta of commands not forwarded, which is added with
+	// the next command or when no command pending.
+	skipped int64
+
+	confirmed int64
+	errors    int64
+	ops       int64
+
+	err  atomic.Value
+	done chan struct{}
+}
+
+func newPipeline(conn net.Conn, window int, offset *int64) *pipeline {
+	if window <= 0 {
+		window = defaultPipelineWindow
+	}
+	if offset == nil {
+		offset = new(int64)
+	}
+	p := &pipeline{
+		conn:     conn,
+		bw:       bufio.NewWriter(conn),
+		br:       bufio.NewReader(conn),
+		inflight: make(chan int64, window),
+		offset:   offset,
+		done:     make(chan struct{}),
+	}
+	go p.recv()
+	go p.sample()
+	return p
+}
+
+// commit marks the command written into bw as in flight, and flushes the
+// written commands if the window is full.
+func (p *pipeline) commit(delta int64) error {
+	atomic.AddInt64(&p.pending, 1)
+	delta += atomic.SwapInt64(&p.skipped, 0)
+	select {
+	case <-p.done:
+		atomic.AddInt64(&p.pending, -1)
+		return p.error()
+	case p.inflight <- delta:
+		return nil
+	default:
+	}
+	// NOTE: flush before waiting, or the replies never come.
+	if err := p.bw.Flush(); err != nil {
+		atomic.AddInt64(&p.pending, -1)
+		return err
+	}
+	select {
+	case <-p.done:
+		atomic.AddInt64(&p.pending, -1)
+		return p.error()
+	case p.inflight <- delta:
+		return nil
+	}
+}
+
+// skip adds the delta of commands not forwarded into offset in order, that is
+// after the commands pending are confirmed.
+func (p *pipeline) skip(delta int64) {
+	atomic.AddInt64(&p.skipped, delta)
+	if atomic.LoadInt64(&p.pending) == 0 {
+		atomic.AddInt64(p.offset, atomic.SwapInt64(&p.skipped, 0))
+	}
+}
+
+// forward writes the raw command with the offset delta of upstream.
+func (p *pipeline) forward(cmd []byte, delta int64) error {
+	if _, err := p.bw.Write(cmd); err != nil {
+		return err
+	}
+	return p.commit(delta)
+}
+
+func (p *pipeline) flush() error {
+	return p.bw.Flush()
+}
+
+// wait flushes the written commands and waits until all of them confirmed.
+func (p *pipeline) wait() error {
+	if err := p.bw.Flush(); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for atomic.LoadInt64(&p.pending) > 0 {
+		select {
+		case <-p.done:
+			return p.error()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+func (p *pipeline) recv() {
+	for {
+		line, err := skipReply(p.br)
+		if err != nil {
+			p.close(err)
+			return
+		}
+		// NOTE: bw may be flushed before the command committed, so the
+		// reply can be read before the delta is put into the window.
+		delta := <-p.inflight
+		if line[0] == byteError {
+			// NOTE: log the error replies at power of 2 to avoid flooding.
+			if n := atomic.AddInt64(&p.errors, 1); n&(n-1) == 0 {
+				log.Warnf("target %s replied error %s, %d errors in total", p.conn.RemoteAddr(), strconv.Quote(string(line)), n)
+			}
+		}
+		atomic.AddInt64(&p.confirmed, 1)
+		atomic.AddInt64(p.offset, delta)
+		if atomic.AddInt64(&p.pending, -1) == 0 {
+			atomic.AddInt64(p.offset, atomic.SwapInt64(&p.skipped, 0))
+		}
+	}
+}
+
+// sample counts the commands confirmed in the last second.
+func (p *pipeline) sample() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	var last int64
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+		confirmed := atomic.LoadInt64(&p.confirmed)
+		atomic.StoreInt64(&p.ops, confirmed-last)
+		last = confirmed
+	}
+}
+
+func (p *pipeline) close(err error) {
+	p.err.Store(err)
+	close(p.done)
+	_ = p.conn.Close()
+}
+
+func (p *pipeline) error() error {
+	if err, ok := p.err.Load().(error); ok && err != io.EOF {
+		return err
+	}
+	return ErrPipelineClosed
+}
+
+// Close closes the connection, the commands in flight are dropped.
+func (p *pipeline) Close() error {
+	return p.conn.Close()
+}
+
+func (p *pipeline) stat(s *Source) {
+	s.Commands = atomic.LoadInt64(&p.confirmed)
+	s.InFlight = int64(len(p.inflight))
+	s.Errors = atomic.LoadInt64(&p.errors)
+	s.OPS = atomic.LoadInt64(&p.ops)
+}
+
+// skipReply reads a whole RESP reply and returns the first line of it.
+func skipReply(br *bufio.Reader) (line []byte, err error) {
+	line, err = br.ReadBytes(byteLF)
+	if err != nil {
+		return
+	}
+	if len(line) < 3 {
+		return nil, ErrBadReply
+	}
+	switch line[0] {
+	case byteBulkString, byteArray:
+		var n int64
+		if n, err = conv.Btoi(bytes.TrimSpace(line[1:])); err != nil {
+			return nil, ErrBadReply
+		}
+		if line[0] == byteBulkString {
+			if n >= 0 {
+				_, err = br.Discard(int(n) + 2)
+			}
+			return
+		}
+		for i := int64(0); i < n; i++ {
+			if _, err = skipReply(br); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// readCommand reads a whole RESP command from upstream, and the line which
+// is not an array, such as the newline keepalive, is returned alone.
+func readCommand(br *bufio.Reader) (cmd []byte, err error) {
+	cmd, err = br.ReadBytes(byteLF)
+	if err != nil || cmd[0] != byteArray {
+		return
+	}
+	n, err := conv.Btoi(bytes.TrimSpace(cmd[1:]))
+	if err != nil {
+		return nil, ErrBadCommand
+	}
+	for i := int64(0); i < n; i++ {
+		var line []byte
+		if line, err = br.ReadBytes(byteLF); err != nil {
+			return
+		}
+		if line[0] != byteBulkString {
+			return nil, ErrBadCommand
+		}
+		var size int64
+		if size, err = conv.Btoi(bytes.TrimSpace(line[1:])); err != nil || size < 0 {
+			return nil, ErrBadCommand
+		}
+		start := len(cmd) + len(line)
+		cmd = append(cmd, line...)
+		cmd = append(cmd, make([]byte, size+2)...)
+		if _, err = io.ReadFull(br, cmd[start:]); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,110 @@
+package anzi
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var bytesPingCmd = []byte("*1\r\n$4\r\nPING\r\n")
+
+func TestPipelineWindow(t *testing.T) {
+	conn, target := net.Pipe()
+	defer target.Close()
+	var offset int64
+	p := newPipeline(conn, 2, &offset)
+	defer p.Close()
+
+	go func() {
+		_, _ = io.Copy(ioutil.Discard, target)
+	}()
+	assert.NoError(t, p.forward(bytesPingCmd, 10))
+	assert.NoError(t, p.forward(bytesPingCmd, 20))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- p.forward(bytesPingCmd, 30)
+	}()
+	select {
+	case <-done:
+		t.Fatal("should be blocked while the window is full")
+	case <-time.After(time.Millisecond * 50):
+	}
+	s := &Source{}
+	p.stat(s)
+	assert.Equal(t, int64(2), s.InFlight)
+	assert.Equal(t, int64(0), atomic.LoadInt64(&offset))
+
+	_, err := target.Write([]byte("+PONG\r\n-ERR unknown\r\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, <-done)
+	_, err = target.Write([]byte("$3\r\nabc\r\n"))
+	assert.NoError(t, err)
+	for i := 0; i < 100 && atomic.LoadInt64(&offset) != 60; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.Equal(t, int64(60), atomic.LoadInt64(&offset))
+	p.stat(s)
+	assert.Equal(t, int64(3), s.Commands)
+	assert.Equal(t, int64(1), s.Errors)
+	assert.Equal(t, int64(0), s.InFlight)
+}
+
+func TestPipelineClosed(t *testing.T) {
+	conn, target := net.Pipe()
+	p := newPipeline(conn, 1, nil)
+	go func() {
+		_, _ = io.Copy(ioutil.Discard, target)
+	}()
+	assert.NoError(t, p.forward(bytesPingCmd, 1))
+	target.Close()
+	err := p.forward(bytesPingCmd, 1)
+	if err == nil {
+		err = p.forward(bytesPingCmd, 1)
+	}
+	assert.Error(t, err)
+}
+
+func TestSkipReply(t *testing.T) {
+	br := bufio.NewReader(bytes.NewBufferString("*3\r\n$1\r\na\r\n$-1\r\n*1\r\n:1\r\n+OK\r\n-ERR bad\r\n"))
+	line, err := skipReply(br)
+	assert.NoError(t, err)
+	assert.Equal(t, "*3\r\n", string(line))
+	line, err = skipReply(br)
+	assert.NoError(t, err)
+	assert.Equal(t, "+OK\r\n", string(line))
+	line, err = skipReply(br)
+	assert.NoError(t, err)
+	assert.Equal(t, "-ERR bad\r\n", string(line))
+	_, err = skipReply(br)
+	assert.Equal(t, io.EOF, err)
+
+	_, err = skipReply(bufio.NewReader(bytes.NewBufferString("$abc\r\n")))
+	assert.Equal(t, ErrBadReply, err)
+}
+
+func TestReadCommand(t *testing.T) {
+	data := "\n*3\r\n$3\r\nSET\r\n$1\r\na\r\n$4\r\nb\r\nc\r\n*1\r\n$4\r\nPING\r\n"
+	br := bufio.NewReader(bytes.NewBufferString(data))
+	cmd, err := readCommand(br)
+	assert.NoError(t, err)
+	assert.Equal(t, "\n", string(cmd))
+	cmd, err = readCommand(br)
+	assert.NoError(t, err)
+	assert.Equal(t, "*3\r\n$3\r\nSET\r\n$1\r\na\r\n$4\r\nb\r\nc\r\n", string(cmd))
+	cmd, err = readCommand(br)
+	assert.NoError(t, err)
+	assert.Equal(t, bytesPingCmd, cmd)
+	_, err = readCommand(br)
+	assert.Equal(t, io.EOF, err)
+
+	_, err = readCommand(bufio.NewReader(bytes.NewBufferString("*1\r\n:1\r\n")))
+	assert.Equal(t, ErrBadCommand, err)
+}
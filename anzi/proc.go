@@ -3,9 +3,9 @@ package anzi
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net"
 	"strconv"
 	"strings"
@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"overlord/pkg/conv"
+	"overlord/pkg/etcd"
 	"overlord/pkg/log"
 	"overlord/pkg/types"
 	"overlord/proxy"
@@ -25,6 +26,7 @@ const (
 	byteArray               = byte('*')
 	byteSpace               = byte(' ')
 	replConfAckCmdFormatter = "*3\r\n$8\r\nREPLCONF\r\n$3\r\nACK\r\n$%d\r\n%d\r\n"
+	psyncCmdFormatter       = "*3\r\n$5\r\nPSYNC\r\n$%d\r\n%s\r\n$%d\r\n%d\r\n"
 )
 
 var (
@@ -32,6 +34,12 @@ var (
 	psyncFullSyncCmd     = []byte("*3\r\n$5\r\nPSYNC\r\n$1\r\n?\r\n$2\r\n-1\r\n")
 	bytesClusterNodesCmd = []byte("*2\r\n$7\r\nCLUSTER\r\n$5\r\nNODES\r\n")
 	pingInlineCMD        = []byte("PING\r\n")
+	bytesPSyncContinue   = []byte("+CONTINUE")
+)
+
+// define errors
+var (
+	ErrPSyncNotContinue = errors.New("upstream refused to continue the partial sync")
 )
 
 // NewMigrateProc create new migrate proc in migrate data
@@ -53,6 +61,8 @@ type MigrateProc struct {
 	barrierC chan struct{}
 	wg       *sync.WaitGroup
 	target   string
+	insts    []*Instance
+	cutting  int32
 }
 
 // Migrate start new migrate process
@@ -69,19 +79,42 @@ func (m *MigrateProc) Migrate() error {
 		return err
 	}
 
+	var e *etcd.Etcd
+	if m.cfg.CheckpointEtcd != "" {
+		if e, err = etcd.New(m.cfg.CheckpointEtcd); err != nil {
+			return err
+		}
+	}
+
 	log.Infof("parsed addrs %s", addrs)
 	m.wg.Add(len(addrs))
 
 	for _, addr := range addrs {
 		inst := &Instance{
-			Addr:     addr,
-			Target:   m.target,
-			barrierC: m.barrierC,
-			wg:       m.wg,
+			Addr:      addr,
+			Target:    m.target,
+			window:    m.cfg.PipelineWindow,
+			bandwidth: m.cfg.SourceBandwidth,
+			filter:    newKeyFilter(m.cfg),
+			ttl:       newTTLRewriter(m.cfg),
+			barrierC:  m.barrierC,
+			wg:        m.wg,
 		}
+		if m.cfg.RDBDir != "" {
+			inst.spool = newRDBSpool(m.cfg.RDBDir, addr)
+		}
+		inst.checkpoint = newCheckpoint(m.cfg, e, addr)
+		m.insts = append(m.insts, inst)
 		go inst.Sync()
 	}
 
+	if m.cfg.HTTPAddr != "" {
+		if err = m.serveHTTP(m.cfg.HTTPAddr); err != nil {
+			return err
+		}
+		log.Infof("serve control api at %s", m.cfg.HTTPAddr)
+	}
+
 	log.Infof("wait for cluster listening at %s", m.target)
 	err = m.CheckPing()
 	if err != nil {
@@ -93,6 +126,7 @@ func (m *MigrateProc) Migrate() error {
 	for i := 0; i < m.cfg.MaxRDBConcurrency; i++ {
 		m.barrierC <- struct{}{}
 	}
+	go m.reportProgress()
 
 	m.wg.Wait()
 	return nil
@@ -184,7 +218,12 @@ func (m *MigrateProc) CheckPing() error {
 }
 
 func (m *MigrateProc) checkPing(buf []byte) error {
-	conn, err := net.Dial("tcp", m.target)
+	return ping(m.target, buf)
+}
+
+// ping sends PING to target and reads the reply into buf.
+func ping(target string, buf []byte) error {
+	conn, err := net.Dial("tcp", target)
 	if err != nil {
 		log.Errorf("fail to dial to target %s", err)
 		return err
@@ -201,18 +240,34 @@ type Instance struct {
 	Addr   string
 	Target string
 
-	tconn net.Conn
-
 	lock sync.RWMutex
 	conn net.Conn
 	br   *bufio.Reader
 	bw   *bufio.Writer
+	// cb pipelines the commands into target with at most window commands
+	// in flight.
+	cb     *ProtocolCallbacker
+	window int
+	// filter skips the keys and databases not to migrate, nil means all.
+	filter *keyFilter
+	// ttl rewrites the ttl of keys, nil means as upstream.
+	ttl *ttlRewriter
+	// checkpoint persists the offset to resume syncing, nil means disabled.
+	checkpoint checkpoint
+	// bandwidth is the max bytes read from upstream per second, 0 means
+	// unlimited.
+	bandwidth int64
+	received  int64
+	rdbSize   int64
 
 	barrierC chan struct{}
 	wg       *sync.WaitGroup
+	spool    *rdbSpool
 
 	offset   int64
 	masterID string
+	// synced is 1 if the rdb is loaded and the commands are forwarding.
+	synced int32
 }
 
 func (inst *Instance) parsePSyncReply(data []byte) error {
@@ -236,7 +291,6 @@ func (inst *Instance) parsePSyncReply(data []byte) error {
 func (inst *Instance) Sync() {
 	defer inst.wg.Done()
 	log.Infof("tring to sync with remote instance %s", inst.Addr)
-	<-inst.barrierC
 
 	for {
 		err := inst.sync()
@@ -252,21 +306,98 @@ func (inst *Instance) sync() (err error) {
 	defer inst.Close()
 
 	atomic.StoreInt64(&inst.offset, 0)
+	atomic.StoreInt32(&inst.synced, 0)
+	atomic.StoreInt64(&inst.received, 0)
+	atomic.StoreInt64(&inst.rdbSize, 0)
+
+	resumed, err := inst.resume()
+	if err != nil {
+		return
+	}
+	if !resumed {
+		if err = inst.loadRDB(); err != nil {
+			return
+		}
+	}
+
+	atomic.StoreInt32(&inst.synced, 1)
+	// 3. trying to receive more command and send back replconf size
+	// 4. dispatch commands into cluster backend(for more, in copy model)
+	go inst.replAck()
+	err = inst.cmdForward()
+	return
+}
+
+// loadRDB transfers and loads the whole rdb, at most max_rdb_concurrency
+// instances load rdb at the same time, and the others wait for the barrier.
+func (inst *Instance) loadRDB() (err error) {
+	<-inst.barrierC
+	defer func() {
+		inst.barrierC <- struct{}{}
+	}()
+
+	if inst.checkpoint != nil {
+		// NOTE: the checkpoint is invalid once the new rdb is loading.
+		if err = inst.checkpoint.clean(); err != nil {
+			return
+		}
+	}
+	if inst.spool != nil {
+		return inst.syncBySpool()
+	}
+	return inst.syncByStream()
+}
 
+// resume continues syncing by PSYNC from the checkpoint without loading rdb,
+// false is returned if there is no checkpoint or upstream refused.
+func (inst *Instance) resume() (bool, error) {
+	if inst.checkpoint == nil {
+		return false, nil
+	}
+	meta, err := inst.checkpoint.load()
+	if err != nil {
+		log.Warnf("fail to load checkpoint of %s due %s, sync fully", inst.Addr, err)
+		return false, nil
+	} else if meta == nil || meta.MasterID == "" {
+		return false, nil
+	}
+
+	log.Infof("resume syncing %s from checkpoint of %s at offset %d", inst.Addr, meta.MasterID, meta.Offset)
+	if err = inst.partialSync(meta); err == ErrPSyncNotContinue {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	inst.newCallbacker()
+	return true, nil
+}
+
+func (inst *Instance) dial() error {
 	conn, err := net.Dial("tcp", inst.Addr)
 	if err != nil {
 		return err
 	}
 	inst.conn = conn
 	inst.bw = bufio.NewWriter(conn)
-	inst.br = bufio.NewReader(conn)
+	var rd io.Reader = conn
+	if inst.bandwidth > 0 {
+		rd = newBandwidthReader(conn, inst.bandwidth)
+	}
+	inst.br = bufio.NewReader(countReader{rd: rd, n: &inst.received})
+	return nil
+}
+
+// fullSync sends psync ? -1 and returns the first line of rdb bulk string.
+func (inst *Instance) fullSync() (data []byte, err error) {
+	if err = inst.dial(); err != nil {
+		return
+	}
 
 	// 1. barrier run syncRDB
 	// 1.1 send psync ? -1
 	log.Infof("start to sync rdb of %s", inst.Addr)
 	_ = writeAll(psyncFullSyncCmd, inst.bw)
 	_ = inst.bw.Flush()
-	var data []byte
 	data, err = inst.br.ReadBytes(byteLF)
 	if err != nil {
 		return
@@ -275,120 +406,185 @@ func (inst *Instance) sync() (err error) {
 	log.Infof("parse psync reply of %s", inst.Addr)
 	err = inst.parsePSyncReply(data)
 	if err != nil {
-		return err
+		return
 	}
 
 	// because rdb was transformed by RESP Bulk String, we need ignore first line
 	for {
 		data, err = inst.br.ReadBytes(byteLF)
 		if err != nil {
-			return err
+			return
 		}
 		log.Infof("read new line addr %s with %s", inst.Addr, strconv.Quote(string(data)))
-		if len(data) > 0 && data[0] == byte('$') {
-			break
+		if len(data) > 0 && data[0] == byteBulkString {
+			// NOTE: the size is unknown for diskless sync as $EOF:<mark>.
+			if size, perr := strconv.ParseInt(string(bytes.TrimSpace(data[1:])), 10, 64); perr == nil {
+				atomic.StoreInt64(&inst.rdbSize, size)
+			}
+			return
 		}
 	}
+}
+
+func (inst *Instance) syncByStream() (err error) {
+	if _, err = inst.fullSync(); err != nil {
+		return
+	}
 
 	// read full rdb
-	err = inst.syncRDB(inst.Target)
+	err = inst.syncRDB(inst.br)
 	if err != nil {
 		log.Warnf("syncing rdb fail of instance %s", inst.Addr)
 		return
 	}
 	log.Infof("syncing rdb done of instance %s", inst.Addr)
-
-	// 2. parsed rdb done then send notify to barrier chan
-	select {
-	case inst.barrierC <- struct{}{}:
-	default:
-	}
-	// 3. trying to receive more command and send back replconf size
-	// 4. dispatch commands into cluster backend(for more, in copy model)
-	go inst.replAck()
-	err = inst.cmdForward()
 	return
 }
 
-func (inst *Instance) cmdForward() error {
-	log.Infof("start forwarding command from %s to %s", inst.Addr, inst.Target)
+// syncBySpool saves the whole rdb into disk before loading it, and then
+// continue syncing by PSYNC with the offset of the saved rdb. If there is
+// already a fully saved rdb, the transfer will be skipped.
+func (inst *Instance) syncBySpool() (err error) {
+	meta, err := inst.spool.load()
+	if err != nil {
+		return
+	}
 
-	var wg sync.WaitGroup
-	wg.Add(2)
-
-	go func() {
-		defer wg.Done()
-		for {
-			inst.lock.RLock()
-			_, err := io.Copy(ioutil.Discard, inst.tconn)
-			inst.lock.RUnlock()
-			if err != nil {
-				log.Infof("closed by upstream due %s", err)
-				return
-			}
+	if meta != nil {
+		log.Infof("found saved rdb of %s at offset %d, load it without transfer", inst.Addr, meta.Offset)
+	} else {
+		var data []byte
+		if data, err = inst.fullSync(); err != nil {
+			return
 		}
-	}()
-
-	go func() {
-		defer wg.Done()
-		for {
-			inst.lock.RLock()
-			size, err := io.Copy(inst.tconn, inst.br)
-			inst.lock.RUnlock()
-			if err != nil {
-				time.Sleep(time.Millisecond * 500)
-				err = inst.reconnectInstance()
-				if err != nil {
-					continue
-				}
-				_ = inst.skipUntilNewCmd()
-			}
-			atomic.AddInt64(&inst.offset, size)
+		var size int64
+		size, err = strconv.ParseInt(string(bytes.TrimSpace(data[1:])), 10, 64)
+		if err != nil {
+			log.Errorf("fail to parse rdb size %s, diskless sync is not supported with rdb_dir", strconv.Quote(string(data)))
+			return
 		}
-	}()
+		meta = &rdbMeta{MasterID: inst.masterID, Offset: inst.offset, Size: size}
+		log.Infof("start to save rdb of %s with %d bytes", inst.Addr, size)
+		err = inst.spool.save(inst.br, meta)
+		inst.conn.Close()
+		if err != nil {
+			return
+		}
+	}
+
+	f, err := inst.spool.open()
+	if err != nil {
+		return
+	}
+	err = inst.syncRDB(bufio.NewReader(f))
+	f.Close()
+	if err != nil {
+		log.Warnf("loading saved rdb fail of instance %s", inst.Addr)
+		return
+	}
+	log.Infof("loading saved rdb done of instance %s", inst.Addr)
+	inst.spool.clean()
 
-	wg.Wait()
+	return inst.partialSync(meta)
+}
+
+// partialSync asks upstream to continue from the offset of meta.
+func (inst *Instance) partialSync(meta *rdbMeta) (err error) {
+	if err = inst.dial(); err != nil {
+		return
+	}
+	_, _ = fmt.Fprintf(inst.bw, psyncCmdFormatter, len(meta.MasterID), meta.MasterID, getStrLen(meta.Offset+1), meta.Offset+1)
+	_ = inst.bw.Flush()
+	data, err := inst.br.ReadBytes(byteLF)
+	if err != nil {
+		return
+	}
+	if !bytes.HasPrefix(data, bytesPSyncContinue) {
+		log.Warnf("upstream %s reply psync as %s, need full sync again", inst.Addr, strconv.Quote(string(data)))
+		return ErrPSyncNotContinue
+	}
+	inst.masterID = meta.MasterID
+	// NOTE: upstream replies +CONTINUE with the new replication id if it
+	// has been switched by failover.
+	if fields := bytes.Fields(data); len(fields) == 2 {
+		inst.masterID = string(fields[1])
+	}
+	atomic.StoreInt64(&inst.offset, meta.Offset)
 	return nil
 }
 
-func (inst *Instance) skipUntilNewCmd() error {
+// cmdForward pipelines the commands of upstream into target, the offset is
+// added only after the commands are confirmed by target.
+func (inst *Instance) cmdForward() error {
+	log.Infof("start forwarding command from %s to %s", inst.Addr, inst.Target)
+
 	for {
-		line, err := inst.br.ReadBytes(byte('\n'))
+		raw, err := readCommand(inst.br)
 		if err != nil {
+			log.Infof("closed by upstream %s due %s", inst.Addr, err)
 			return err
 		}
-		if line[0] == byte('*') {
-			return writeAll(line, inst.tconn)
+		cmd := raw
+		if raw[0] != byteArray {
+			cmd = nil
+		} else if inst.filter != nil {
+			cmd = inst.filter.command(raw)
+		}
+		if cmd != nil && inst.ttl != nil {
+			cmd = inst.ttl.command(cmd)
+		}
+		// NOTE: flush when no more command buffered to be read.
+		flush := inst.br.Buffered() == 0
+		if cmd == nil {
+			// NOTE: the line which is not command and the command filtered
+			// are not forwarded, but still counted into the offset.
+			inst.cb.Skip(int64(len(raw)))
+			if flush {
+				err = inst.cb.Flush()
+			}
+		} else {
+			err = inst.cb.Forward(cmd, int64(len(raw)), flush)
+		}
+		if err != nil {
+			log.Errorf("fail to forward command to %s due %s", inst.Target, err)
+			return err
 		}
 	}
 }
 
-func (inst *Instance) reconnectInstance() error {
-	conn, err := net.Dial("tcp", inst.Addr)
-	if err != nil {
-		return err
-	}
-
-	inst.lock.Lock()
-	defer inst.lock.Unlock()
-	if inst.conn != nil {
-		inst.conn.Close()
-	}
-	inst.conn = conn
-	inst.br = bufio.NewReader(conn)
-	inst.bw = bufio.NewWriter(conn)
-	return nil
-}
 func (inst *Instance) replAck() {
 	log.Infof("repl ack for %s", inst.Addr)
 	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	base, saved := atomic.LoadInt64(&inst.offset), int64(-1)
 	for {
-		inst.replAckConf()
+		if err := inst.replAckConf(); err != nil {
+			return
+		}
+		saved = inst.saveCheckpoint(base, saved)
 		<-ticker.C
 	}
 }
 
-func (inst *Instance) replAckConf() {
+// saveCheckpoint saves the offset confirmed by target if changed and returns
+// the saved offset. The offset equal to base is saved only if no command is
+// pending, because the commands of rdb are confirmed without moving offset.
+func (inst *Instance) saveCheckpoint(base, saved int64) int64 {
+	if inst.checkpoint == nil {
+		return saved
+	}
+	offset := atomic.LoadInt64(&inst.offset)
+	if offset == saved || (offset == base && inst.cb.Pending() > 0) {
+		return saved
+	}
+	if err := inst.checkpoint.save(&rdbMeta{MasterID: inst.masterID, Offset: offset}); err != nil {
+		log.Warnf("fail to save checkpoint of %s due %s", inst.Addr, err)
+		return saved
+	}
+	return offset
+}
+
+func (inst *Instance) replAckConf() error {
 	offset := atomic.LoadInt64(&inst.offset)
 	cmd := fmt.Sprintf(replConfAckCmdFormatter, getStrLen(offset), offset)
 	inst.lock.RLock()
@@ -397,26 +593,41 @@ func (inst *Instance) replAckConf() {
 	inst.lock.RUnlock()
 	if err != nil {
 		log.Errorf("fail to send repl ack command, connection maybe closed soon")
-		return
 	}
+	return err
 }
 
-func (inst *Instance) syncRDB(addr string) (err error) {
+func (inst *Instance) syncRDB(rd *bufio.Reader) (err error) {
 	log.Infof("start syning rdb for %s", inst.Addr)
-	cb := NewProtocolCallbacker(addr)
-	rdb := NewRDB(inst.br, cb)
-	inst.tconn, err = rdb.Sync()
-	log.Infof("receive target connection %v from rdb callback with error %s", inst.tconn, err)
+	cb := inst.newCallbacker()
+	var rcb RDBCallback = cb
+	if inst.ttl != nil {
+		rcb = newTTLCallback(rcb, inst.ttl)
+	}
+	if inst.filter != nil {
+		rcb = newFilterCallback(rcb, inst.filter)
+	}
+	rdb := NewRDB(rd, rcb)
+	tconn, err := rdb.Sync()
+	log.Infof("receive target connection %v from rdb callback with error %s", tconn, err)
 	return
 }
 
+func (inst *Instance) newCallbacker() *ProtocolCallbacker {
+	cb := NewProtocolCallbacker(inst.Target, inst.window, &inst.offset)
+	inst.lock.Lock()
+	inst.cb = cb
+	inst.lock.Unlock()
+	return cb
+}
+
 // Close the up and down stream
 func (inst *Instance) Close() {
 	if inst.conn != nil {
 		inst.conn.Close()
 	}
-	if inst.tconn != nil {
-		inst.tconn.Close()
+	if inst.cb != nil {
+		inst.cb.Close()
 	}
 	return
 }
@@ -2,6 +2,7 @@ package anzi
 
 import (
 	"io"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -54,19 +55,30 @@ func TestWriteAllOk(t *testing.T) {
 }
 
 func TestCmdForwrad(t *testing.T) {
-	tconn := mockconn.CreateConn([]byte(longData), 1)
-	conn := mockconn.CreateConn([]byte(longData), 10)
+	addr, cmds := _fakeTarget(t)
+	data := "\n*1\r\n$4\r\nPING\r\n*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\nb\r\n"
+	conn := mockconn.CreateConn([]byte(data), 10)
 	inst := &Instance{
-		tconn: tconn,
-
-		conn: conn,
-		br:   bufio.NewReader(conn),
-		bw:   bufio.NewWriter(conn),
+		Target: addr,
+		offset: int64(100),
+		conn:   conn,
+		br:     bufio.NewReader(conn),
+		bw:     bufio.NewWriter(conn),
 	}
+	inst.cb = NewProtocolCallbacker(addr, 2, &inst.offset)
+	defer inst.Close()
 
-	go inst.cmdForward()
-	time.Sleep(time.Millisecond * 10)
-	inst.Close()
+	err := inst.cmdForward()
+	assert.Equal(t, io.EOF, err)
+	for i := 0; i < 100 && atomic.LoadInt64(&inst.offset) != int64(100+10*len(data)); i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.Equal(t, int64(100+10*len(data)), atomic.LoadInt64(&inst.offset))
+	assert.Equal(t, int64(20), atomic.LoadInt64(cmds))
+	s := &Source{}
+	inst.cb.Stat(s)
+	assert.Equal(t, int64(20), s.Commands)
+	assert.Equal(t, int64(0), s.InFlight)
 }
 
 func TestParsePSyncReply(t *testing.T) {
@@ -0,0 +1,116 @@
+package anzi
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+
+	"overlord/pkg/log"
+)
+
+const progressReportInterval = 30 * time.Second
+
+// Progress is the aggregate progress of all the upstream instances.
+type Progress struct {
+	Sources int `json:"sources"`
+	// Synced is the count of instances which rdb is loaded.
+	Synced int `json:"synced"`
+	// RDBSize and Received are the total bytes of rdb and the bytes received
+	// from upstream, RDBSize is unknown for diskless sync.
+	RDBSize  int64 `json:"rdb_size"`
+	Received int64 `json:"received"`
+	Lag      int64 `json:"lag"`
+	Commands int64 `json:"commands"`
+	InFlight int64 `json:"inflight"`
+	Errors   int64 `json:"errors"`
+	OPS      int64 `json:"ops"`
+	// Failed is the count of instances failed to report the lag.
+	Failed int `json:"failed"`
+}
+
+// Progress sums the replication state of all the upstream instances.
+func (m *MigrateProc) Progress() *Progress {
+	p := &Progress{}
+	for _, s := range m.Sources() {
+		p.Sources++
+		if s.Synced {
+			p.Synced++
+		}
+		if s.Error != "" {
+			p.Failed++
+		} else if s.Lag > 0 {
+			p.Lag += s.Lag
+		}
+		p.RDBSize += s.RDBSize
+		p.Received += s.Received
+		p.Commands += s.Commands
+		p.InFlight += s.InFlight
+		p.Errors += s.Errors
+		p.OPS += s.OPS
+	}
+	return p
+}
+
+func (m *MigrateProc) reportProgress() {
+	ticker := time.NewTicker(progressReportInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		p := m.Progress()
+		log.Infof("progress: %d/%d synced, received %d/%d bytes of rdb, lag %d bytes, %d commands confirmed at %d ops, %d in flight, %d errors, %d failed",
+			p.Synced, p.Sources, p.Received, p.RDBSize, p.Lag, p.Commands, p.OPS, p.InFlight, p.Errors, p.Failed)
+	}
+}
+
+// countReader counts the bytes read into n.
+type countReader struct {
+	rd io.Reader
+	n  *int64
+}
+
+func (c countReader) Read(p []byte) (n int, err error) {
+	n, err = c.rd.Read(p)
+	atomic.AddInt64(c.n, int64(n))
+	return
+}
+
+// bandwidthReader limits the bytes read per second, the bytes over the rate
+// are paid by sleeping before returned.
+type bandwidthReader struct {
+	rd     io.Reader
+	rate   float64
+	tokens float64
+	last   time.Time
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+func newBandwidthReader(rd io.Reader, rate int64) *bandwidthReader {
+	return &bandwidthReader{
+		rd:     rd,
+		rate:   float64(rate),
+		tokens: float64(rate),
+		now:    time.Now,
+		sleep:  time.Sleep,
+	}
+}
+
+func (b *bandwidthReader) Read(p []byte) (n int, err error) {
+	if len(p) > int(b.rate) {
+		p = p[:int(b.rate)]
+	}
+	n, err = b.rd.Read(p)
+	now := b.now()
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.rate {
+			b.tokens = b.rate
+		}
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens < 0 {
+		b.sleep(time.Duration(-b.tokens / b.rate * float64(time.Second)))
+	}
+	return
+}
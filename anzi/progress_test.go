@@ -0,0 +1,73 @@
+package anzi
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateProcProgress(t *testing.T) {
+	m := &MigrateProc{insts: []*Instance{
+		{Addr: _upstream(t), offset: 90, synced: 1, rdbSize: 1000, received: 1200},
+		{Addr: _upstream(t), offset: 40, rdbSize: 1000, received: 500},
+		{Addr: "127.0.0.1:1"},
+	}}
+	expect := &Progress{Sources: 3, Synced: 1, RDBSize: 2000, Received: 1700, Lag: 70, Failed: 1}
+	assert.Equal(t, expect, m.Progress())
+
+	rec := httptest.NewRecorder()
+	m.progressHandler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/progress", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	p := &Progress{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), p))
+	assert.Equal(t, expect, p)
+
+	rec = httptest.NewRecorder()
+	m.progressHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/progress", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestBandwidthReader(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	var slept []time.Duration
+	b := newBandwidthReader(bytes.NewReader(make([]byte, 250)), 100)
+	b.now = func() time.Time { return now }
+	b.sleep = func(d time.Duration) {
+		slept = append(slept, d)
+		now = now.Add(d)
+	}
+
+	buf := make([]byte, 200)
+	n, err := b.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, n)
+	assert.Len(t, slept, 0)
+
+	n, err = b.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, n)
+	assert.Equal(t, []time.Duration{time.Second}, slept)
+
+	now = now.Add(time.Second / 2)
+	n, err = b.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 50, n)
+	assert.Equal(t, []time.Duration{time.Second}, slept)
+
+	_, err = b.Read(buf)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestInstanceLoadRDBReleaseWorker(t *testing.T) {
+	barrierC := make(chan struct{}, 1)
+	barrierC <- struct{}{}
+	inst := &Instance{Addr: "127.0.0.1:1", barrierC: barrierC}
+	assert.Error(t, inst.loadRDB())
+	assert.Len(t, barrierC, 1)
+}
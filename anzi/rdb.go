@@ -22,15 +22,17 @@ const (
 	RDB64BitLen = 0x81
 	RDBEncVal   = 3
 
-	RDBOpcodeModuleAux    = 247
-	RDBOpcodeIdle         = 248
-	RDBOpcodeFreq         = 249
-	RDBOpcodeAux          = 250
-	RDBOpcodeResizeDB     = 251
-	RDBOpcodeExpireTimeMS = 252
-	RDBOpcodeExpireTime   = 253
-	RDBOpcodeSelectDB     = 254
-	RDBOpcodeEOF          = 255
+	RDBOpcodeFunction2     = 245
+	RDBOpcodeFunctionPreGA = 246
+	RDBOpcodeModuleAux     = 247
+	RDBOpcodeIdle          = 248
+	RDBOpcodeFreq          = 249
+	RDBOpcodeAux           = 250
+	RDBOpcodeResizeDB      = 251
+	RDBOpcodeExpireTimeMS  = 252
+	RDBOpcodeExpireTime    = 253
+	RDBOpcodeSelectDB      = 254
+	RDBOpcodeEOF           = 255
 
 	RDBTypeString          = 0
 	RDBTypeList            = 1
@@ -47,6 +49,17 @@ const (
 	RDBTypeHashZipList     = 13
 	RDBTypeListQuickList   = 14
 	RDBTypeStreamListPacks = 15
+	// RDB 10 of redis 7.0
+	RDBTypeHashListPack     = 16
+	RDBTypeZSetListPack     = 17
+	RDBTypeListQuickList2   = 18
+	RDBTypeStreamListPacks2 = 19
+	// RDB 11 of redis 7.2
+	RDBTypeSetListPack      = 20
+	RDBTypeStreamListPacks3 = 21
+
+	// RDBVersionMax is the max version of rdb supported.
+	RDBVersionMax = 11
 
 	RDBEncodeInt8  = 0
 	RDBEncodeInt16 = 1
@@ -59,6 +72,12 @@ const (
 	RDBModuleOpcodeFloat  = 3
 	RDBModuleOpcodeDouble = 4
 	RDBModuleOpcodeString = 5
+
+	quickListNodeContainerPlain  = 1
+	quickListNodeContainerPacked = 2
+
+	streamItemFlagDeleted    = 1
+	streamItemFlagSameFields = 2
 )
 
 // NewRDB build new rdb from reader
@@ -101,6 +120,9 @@ func (r *RDB) verifyHeader(hd []byte) error {
 		return err
 	}
 	r.version = int(version)
+	if r.version > RDBVersionMax {
+		return fmt.Errorf("unsupported rdb version %d, the max supported is %d", r.version, RDBVersionMax)
+	}
 	return nil
 }
 
@@ -193,6 +215,21 @@ func (r *RDB) bgSyncProc() (err error) {
 			continue
 		}
 
+		if dtype == RDBOpcodeFunction2 {
+			// NOTE: functions are not migrated, which should be loaded
+			// into the target by FUNCTION LOAD.
+			_, err = r.readString()
+			if err != nil {
+				return
+			}
+			log.Warnf("skip function library of rdb")
+			continue
+		}
+
+		if dtype == RDBOpcodeFunctionPreGA {
+			return fmt.Errorf("unable to parse function of redis 7.0 release candidate")
+		}
+
 		if dtype == RDBOpcodeEOF {
 			log.Infof("finish rdb rading of upstream")
 			r.cb.EndOfRDB()
@@ -414,7 +451,7 @@ func (r *RDB) readExpire(dtype byte) (ndtype byte, err error) {
 		if err != nil {
 			return
 		}
-		r.expiry = uint64(expireSecond * 1000)
+		r.expiry = uint64(expireSecond) * 1000
 		ndtype, err = r.rd.ReadByte()
 		if err != nil {
 			return
@@ -560,8 +597,16 @@ func (r *RDB) readObject(dtype byte) (err error) {
 		err = fmt.Errorf("unable to parse module object from value of key %s", strconv.Quote(string(r.key)))
 	} else if dtype == RDBTypeModule2 {
 		err = r.readModule()
-	} else if dtype == RDBTypeStreamListPacks {
-		err = r.readStream()
+	} else if dtype == RDBTypeStreamListPacks || dtype == RDBTypeStreamListPacks2 || dtype == RDBTypeStreamListPacks3 {
+		err = r.readStream(dtype)
+	} else if dtype == RDBTypeHashListPack {
+		err = r.readHashFromListPack()
+	} else if dtype == RDBTypeZSetListPack {
+		err = r.readZSetFromListPack()
+	} else if dtype == RDBTypeSetListPack {
+		err = r.readSetFromListPack()
+	} else if dtype == RDBTypeListQuickList2 {
+		err = r.readListFromQuickList2()
 	} else {
 		err = fmt.Errorf("unreacheable dtype(%d) for key %s", dtype, r.key)
 	}
@@ -1044,26 +1089,33 @@ func (r *RDB) readListFromQuickList() (err error) {
 	return
 }
 
-func (r *RDB) readStream() (err error) {
-	var (
-		entry1, entry2 uint64
-		cgroups        uint64
-		listpacks      uint64
-	)
-	listpacks, err = r.readLength()
+// readStream reads the stream and replays its entries by XADD, the consumer
+// groups are created with their last delivered ids and the last id of
+// stream is set by XSETID. The consumers and pending entries of groups are
+// not migrated.
+func (r *RDB) readStream(dtype byte) (err error) {
+	listpacks, err := r.readLength()
 	if err != nil {
 		return
 	}
 
+	var entries int
 	for i := uint64(0); i < listpacks; i++ {
-		_, err = r.readString()
+		var master, data []byte
+		master, err = r.readString()
+		if err != nil {
+			return
+		}
+		data, err = r.readString()
 		if err != nil {
 			return
 		}
-		_, err = r.readString()
+		var n int
+		n, err = r.replayStreamListPack(master, data)
 		if err != nil {
 			return
 		}
+		entries += n
 	}
 
 	// items
@@ -1072,18 +1124,25 @@ func (r *RDB) readStream() (err error) {
 		return
 	}
 
-	entry1, err = r.readLength()
+	lastID, err := r.readStreamID()
 	if err != nil {
 		return
 	}
 
-	entry2, err = r.readLength()
-	if err != nil {
-		return
+	if dtype >= RDBTypeStreamListPacks2 {
+		// first entry id, max deleted entry id and entries added
+		if _, err = r.readStreamID(); err != nil {
+			return
+		}
+		if _, err = r.readStreamID(); err != nil {
+			return
+		}
+		if _, err = r.readLength(); err != nil {
+			return
+		}
 	}
-	_ = fmt.Sprintf("%d-%d", entry1, entry2)
 
-	cgroups, err = r.readLength()
+	cgroups, err := r.readLength()
 	if err != nil {
 		return
 	}
@@ -1101,17 +1160,19 @@ func (r *RDB) readStream() (err error) {
 			return
 		}
 
-		entry1, err = r.readLength()
+		var lasteCGEntryID string
+		lasteCGEntryID, err = r.readStreamID()
 		if err != nil {
 			return
 		}
 
-		entry2, err = r.readLength()
-		if err != nil {
-			return
+		if dtype >= RDBTypeStreamListPacks2 {
+			// entries read
+			if _, err = r.readLength(); err != nil {
+				return
+			}
 		}
 
-		lasteCGEntryID := fmt.Sprintf("%d-%d", entry1, entry2)
 		pending, err = r.readLength()
 		if err != nil {
 			return
@@ -1169,6 +1230,14 @@ func (r *RDB) readStream() (err error) {
 				return
 			}
 
+			if dtype >= RDBTypeStreamListPacks3 {
+				var atime uint64
+				err = binary.Read(r.rd, binary.LittleEndian, &atime)
+				if err != nil {
+					return
+				}
+			}
+
 			cpending, err = r.readLength()
 			if err != nil {
 				return
@@ -1199,6 +1268,106 @@ func (r *RDB) readStream() (err error) {
 		}
 	}
 
+	if entries == 0 && len(consumerGroups) == 0 {
+		log.Warnf("skip empty stream %s without consumer group", strconv.Quote(string(r.key)))
+		return
+	}
+	for _, cg := range consumerGroups {
+		r.cb.CmdXGroupCreate(r.key, cg.Name, []byte(cg.LastEntryID))
+	}
+	r.cb.CmdXSetID(r.key, []byte(lastID))
+	r.cb.ExpireAt(r.key, r.expiry)
+	return
+}
+
+func (r *RDB) readStreamID() (id string, err error) {
+	var ms, seq uint64
+	ms, err = r.readLength()
+	if err != nil {
+		return
+	}
+	seq, err = r.readLength()
+	if err != nil {
+		return
+	}
+	id = fmt.Sprintf("%d-%d", ms, seq)
+	return
+}
+
+// replayStreamListPack replays the entries of listpack node by XADD, the
+// master is the big endian id of the master entry, whose fields are shared
+// by the entries flagged with same fields.
+func (r *RDB) replayStreamListPack(master, data []byte) (n int, err error) {
+	if len(master) != 16 {
+		return 0, fmt.Errorf("invalid stream master id of %d bytes", len(master))
+	}
+	masterMs, masterSeq := binary.BigEndian.Uint64(master[:8]), binary.BigEndian.Uint64(master[8:])
+	entries, err := readListPack(data)
+	if err != nil {
+		return
+	}
+	it := &streamIter{entries: entries}
+	count, deleted, numFields := it.int(), it.int(), it.int()
+	masterFields := make([][]byte, 0, numFields)
+	for i := int64(0); i < numFields; i++ {
+		masterFields = append(masterFields, it.next())
+	}
+	// master entry terminator
+	_ = it.int()
+
+	for i := int64(0); i < count+deleted && it.err == nil; i++ {
+		flags, msDiff, seqDiff := it.int(), it.int(), it.int()
+		var fields [][]byte
+		if flags&streamItemFlagSameFields != 0 {
+			for _, field := range masterFields {
+				fields = append(fields, field, it.next())
+			}
+		} else {
+			nf := it.int()
+			for j := int64(0); j < nf; j++ {
+				fields = append(fields, it.next(), it.next())
+			}
+		}
+		// lp-count
+		_ = it.int()
+		if flags&streamItemFlagDeleted != 0 || it.err != nil {
+			continue
+		}
+		id := fmt.Sprintf("%d-%d", masterMs+uint64(msDiff), masterSeq+uint64(seqDiff))
+		r.cb.CmdXAdd(r.key, []byte(id), fields)
+		n++
+	}
+	err = it.err
+	return
+}
+
+// streamIter iterates the entries of stream listpack, err is set if out of
+// entries or the integer is bad.
+type streamIter struct {
+	entries [][]byte
+	idx     int
+	err     error
+}
+
+func (it *streamIter) next() (entry []byte) {
+	if it.err != nil {
+		return
+	}
+	if it.idx >= len(it.entries) {
+		it.err = fmt.Errorf("stream listpack ends at %d entries", len(it.entries))
+		return
+	}
+	entry = it.entries[it.idx]
+	it.idx++
+	return
+}
+
+func (it *streamIter) int() (v int64) {
+	entry := it.next()
+	if it.err != nil {
+		return
+	}
+	v, it.err = strconv.ParseInt(string(entry), 10, 64)
 	return
 }
 
@@ -103,6 +103,19 @@ func (r *mockRDBCallback) CmdHSetInt(key, field []byte, value int64) {
 	r.Record(key, field, fmt.Sprintf("%d", value))
 }
 
+// Stream
+func (r *mockRDBCallback) CmdXAdd(key, id []byte, fields [][]byte) {
+	r.Record(key, id, fields)
+}
+
+func (r *mockRDBCallback) CmdXGroupCreate(key, group, id []byte) {
+	r.Record(key, group, id)
+}
+
+func (r *mockRDBCallback) CmdXSetID(key, id []byte) {
+	r.Record(key, id)
+}
+
 // Expire
 func (r *mockRDBCallback) ExpireAt(key []byte, expiry uint64) {
 	r.Record(key, fmt.Sprintf("%d", expiry))
@@ -0,0 +1,137 @@
+package anzi
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"overlord/pkg/log"
+)
+
+const (
+	spoolRDBSuffix  = ".rdb"
+	spoolPartSuffix = ".rdb.part"
+	spoolMetaSuffix = ".meta"
+)
+
+// define errors
+var (
+	ErrSpoolShortRDB = errors.New("rdb transfer was broken before reached full size")
+)
+
+// rdbMeta is the replication state of the saved rdb which used to
+// continue syncing by PSYNC after rdb loaded.
+type rdbMeta struct {
+	MasterID string `json:"master_id"`
+	Offset   int64  `json:"offset"`
+	Size     int64  `json:"size"`
+}
+
+// rdbSpool persists the rdb transferred from upstream into local disk.
+// A transfer can not be resumed from the middle because redis always
+// sends the rdb from the beginning, so an unfinished transfer is kept as
+// *.rdb.part and will be overwritten by the next transfer, while a
+// finished one is renamed into *.rdb and can be loaded again after anzi
+// restarted.
+type rdbSpool struct {
+	dir  string
+	name string
+}
+
+func newRDBSpool(dir, addr string) *rdbSpool {
+	return &rdbSpool{
+		dir:  dir,
+		name: strings.Replace(addr, ":", "_", -1),
+	}
+}
+
+func (s *rdbSpool) path(suffix string) string {
+	return filepath.Join(s.dir, s.name+suffix)
+}
+
+// load returns the meta of fully saved rdb, nil meta means that there is
+// no rdb can be loaded.
+func (s *rdbSpool) load() (*rdbMeta, error) {
+	data, err := ioutil.ReadFile(s.path(spoolMetaSuffix))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	meta := &rdbMeta{}
+	if err = json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(s.path(spoolRDBSuffix))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if stat.Size() != meta.Size {
+		log.Warnf("saved rdb %s size %d not match with meta size %d, drop it", s.path(spoolRDBSuffix), stat.Size(), meta.Size)
+		s.clean()
+		return nil, nil
+	}
+	return meta, nil
+}
+
+// save copies the whole rdb of meta.Size from rd into disk.
+func (s *rdbSpool) save(rd io.Reader, meta *rdbMeta) (err error) {
+	if err = os.MkdirAll(s.dir, 0755); err != nil {
+		return
+	}
+
+	part := s.path(spoolPartSuffix)
+	f, err := os.Create(part)
+	if err != nil {
+		return
+	}
+
+	size, err := io.CopyN(f, rd, meta.Size)
+	if err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err == io.EOF || (err == nil && size != meta.Size) {
+		err = ErrSpoolShortRDB
+	}
+	if err != nil {
+		log.Warnf("rdb transfer into %s broken at %d/%d bytes", part, size, meta.Size)
+		return
+	}
+
+	if err = os.Rename(part, s.path(spoolRDBSuffix)); err != nil {
+		return
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return
+	}
+	tmp := s.path(spoolMetaSuffix + ".tmp")
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return
+	}
+	return os.Rename(tmp, s.path(spoolMetaSuffix))
+}
+
+func (s *rdbSpool) open() (*os.File, error) {
+	return os.Open(s.path(spoolRDBSuffix))
+}
+
+// clean removes all the saved files.
+func (s *rdbSpool) clean() {
+	for _, suffix := range []string{spoolMetaSuffix, spoolRDBSuffix, spoolPartSuffix} {
+		if err := os.Remove(s.path(suffix)); err != nil && !os.IsNotExist(err) {
+			log.Warnf("fail to remove spool file %s due %s", s.path(suffix), err)
+		}
+	}
+}
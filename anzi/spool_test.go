@@ -0,0 +1,59 @@
+package anzi
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpoolSaveAndLoadOk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "anzi-spool")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	spool := newRDBSpool(dir, "127.0.0.1:6379")
+	meta, err := spool.load()
+	assert.NoError(t, err)
+	assert.Nil(t, meta)
+
+	data := []byte("REDIS0009\xff")
+	err = spool.save(bytes.NewReader(append(data, []byte("*1\r\n$4\r\nPING\r\n")...)), &rdbMeta{MasterID: "abc", Offset: 7788, Size: int64(len(data))})
+	assert.NoError(t, err)
+
+	meta, err = spool.load()
+	assert.NoError(t, err)
+	assert.NotNil(t, meta)
+	assert.Equal(t, "abc", meta.MasterID)
+	assert.Equal(t, int64(7788), meta.Offset)
+
+	f, err := spool.open()
+	assert.NoError(t, err)
+	saved, err := ioutil.ReadAll(f)
+	f.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, data, saved)
+
+	spool.clean()
+	meta, err = spool.load()
+	assert.NoError(t, err)
+	assert.Nil(t, meta)
+}
+
+func TestSpoolSaveShortRDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "anzi-spool")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	spool := newRDBSpool(dir, "127.0.0.1:6379")
+	err = spool.save(bytes.NewReader([]byte("REDIS")), &rdbMeta{MasterID: "abc", Size: 10})
+	assert.Equal(t, ErrSpoolShortRDB, err)
+
+	meta, err := spool.load()
+	assert.NoError(t, err)
+	assert.Nil(t, meta)
+	_, err = os.Stat(spool.path(spoolPartSuffix))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,197 @@
+package anzi
+
+import (
+	"bytes"
+	"strconv"
+	"time"
+)
+
+var (
+	bytesPersist = []byte("PERSIST")
+	bytesPXAt    = []byte("PXAT")
+	bytesAbsTTL  = []byte("ABSTTL")
+)
+
+// ttlRewriter caps, extends or drops the ttl of keys during migration.
+type ttlRewriter struct {
+	max    int64
+	offset int64
+	drop   bool
+
+	now func() time.Time
+}
+
+// newTTLRewriter returns nil if the ttl of keys are kept as upstream.
+func newTTLRewriter(cfg *MigrateConfig) *ttlRewriter {
+	if cfg.TTLMax <= 0 && cfg.TTLOffset == 0 && !cfg.TTLDrop {
+		return nil
+	}
+	return &ttlRewriter{
+		max:    cfg.TTLMax,
+		offset: cfg.TTLOffset,
+		drop:   cfg.TTLDrop,
+		now:    time.Now,
+	}
+}
+
+func (t *ttlRewriter) nowMs() int64 {
+	return t.now().UnixNano() / int64(time.Millisecond)
+}
+
+// expireAt rewrites the unix time in milliseconds of expiration, 0 means the
+// key is persisted. The keys already expired are kept as expired.
+func (t *ttlRewriter) expireAt(at int64) int64 {
+	now := t.nowMs()
+	if at <= now {
+		return at
+	}
+	if t.drop {
+		return 0
+	}
+	at += t.offset
+	if t.max > 0 && at-now > t.max {
+		at = now + t.max
+	}
+	return at
+}
+
+// command rewrites the ttl of command in replication stream as absolute
+// milliseconds, the command without ttl is returned as it is.
+func (t *ttlRewriter) command(cmd []byte) []byte {
+	args := splitCommand(cmd)
+	if len(args) < 3 {
+		return cmd
+	}
+	name := string(bytes.ToUpper(args[0]))
+	switch name {
+	case "EXPIRE", "PEXPIRE", "EXPIREAT", "PEXPIREAT":
+		at, ok := t.absolute(name, args[2])
+		if !ok {
+			return cmd
+		}
+		if at = t.expireAt(at); at == 0 {
+			return joinCommand([][]byte{bytesPersist, args[1]})
+		}
+		return joinCommand(append([][]byte{BytesPExpireAt, args[1], itob(at)}, args[3:]...))
+	case "SETEX", "PSETEX":
+		if len(args) != 4 {
+			return cmd
+		}
+		unit := "EX"
+		if name == "PSETEX" {
+			unit = "PX"
+		}
+		at, ok := t.absolute(unit, args[2])
+		if !ok {
+			return cmd
+		}
+		return joinCommand(t.appendPXAt([][]byte{BytesSet, args[1], args[3]}, t.expireAt(at)))
+	case "SET":
+		opts := [][]byte{args[0], args[1], args[2]}
+		at, found := int64(0), false
+		for i := 3; i < len(args); i++ {
+			unit := string(bytes.ToUpper(args[i]))
+			switch unit {
+			case "EX", "PX", "EXAT", "PXAT":
+				if i+1 >= len(args) {
+					return cmd
+				}
+				var ok bool
+				if at, ok = t.absolute(unit, args[i+1]); !ok {
+					return cmd
+				}
+				found = true
+				i++
+			default:
+				opts = append(opts, args[i])
+			}
+		}
+		if !found {
+			return cmd
+		}
+		return joinCommand(t.appendPXAt(opts, t.expireAt(at)))
+	case "RESTORE":
+		if len(args) < 4 {
+			return cmd
+		}
+		ttl, err := strconv.ParseInt(string(args[2]), 10, 64)
+		if err != nil || ttl <= 0 {
+			return cmd
+		}
+		opts := [][]byte{}
+		abs := false
+		for _, arg := range args[4:] {
+			if bytes.EqualFold(arg, bytesAbsTTL) {
+				abs = true
+				continue
+			}
+			opts = append(opts, arg)
+		}
+		if !abs {
+			ttl += t.nowMs()
+		}
+		at := t.expireAt(ttl)
+		if at != 0 {
+			opts = append(opts, bytesAbsTTL)
+		}
+		return joinCommand(append([][]byte{args[0], args[1], itob(at), args[3]}, opts...))
+	}
+	return cmd
+}
+
+// absolute converts the ttl argument into unix time in milliseconds, false
+// is returned if the time is not positive and the command is kept.
+func (t *ttlRewriter) absolute(unit string, arg []byte) (at int64, ok bool) {
+	v, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	switch unit {
+	case "EXPIRE", "EX":
+		at = t.nowMs() + v*1000
+	case "PEXPIRE", "PX":
+		at = t.nowMs() + v
+	case "EXPIREAT", "EXAT":
+		at = v * 1000
+	default:
+		at = v
+	}
+	return at, at > 0
+}
+
+func (t *ttlRewriter) appendPXAt(args [][]byte, at int64) [][]byte {
+	if at == 0 {
+		return args
+	}
+	return append(args, bytesPXAt, itob(at))
+}
+
+func itob(v int64) []byte {
+	return []byte(strconv.FormatInt(v, 10))
+}
+
+// ttlCallback rewrites the expiration of keys in rdb.
+type ttlCallback struct {
+	RDBCallback
+	t *ttlRewriter
+}
+
+func newTTLCallback(cb RDBCallback, t *ttlRewriter) *ttlCallback {
+	return &ttlCallback{RDBCallback: cb, t: t}
+}
+
+// CmdSet impl Callback
+func (c *ttlCallback) CmdSet(key, val []byte, expire uint64) {
+	if expire > 0 {
+		expire = uint64(c.t.expireAt(int64(expire)))
+	}
+	c.RDBCallback.CmdSet(key, val, expire)
+}
+
+// ExpireAt impl Callback
+func (c *ttlCallback) ExpireAt(key []byte, expiry uint64) {
+	if expiry > 0 {
+		expiry = uint64(c.t.expireAt(int64(expiry)))
+	}
+	c.RDBCallback.ExpireAt(key, expiry)
+}
@@ -0,0 +1,101 @@
+package anzi
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// _now is 2020-09-13 12:26:40 UTC, 1600000000000 in milliseconds.
+var _now = time.Unix(1600000000, 0)
+
+func _ttlRewriter(cfg *MigrateConfig) *ttlRewriter {
+	t := newTTLRewriter(cfg)
+	t.now = func() time.Time { return _now }
+	return t
+}
+
+func TestTTLRewriterExpireAt(t *testing.T) {
+	assert.Nil(t, newTTLRewriter(&MigrateConfig{}))
+
+	tr := _ttlRewriter(&MigrateConfig{TTLOffset: 1000, TTLMax: 60000})
+	assert.Equal(t, int64(1599999999000), tr.expireAt(1599999999000))
+	assert.Equal(t, int64(1600000011000), tr.expireAt(1600000010000))
+	assert.Equal(t, int64(1600000060000), tr.expireAt(1600000100000))
+
+	tr = _ttlRewriter(&MigrateConfig{TTLDrop: true})
+	assert.Equal(t, int64(0), tr.expireAt(1600000010000))
+	assert.Equal(t, int64(1599999999000), tr.expireAt(1599999999000))
+}
+
+func TestTTLRewriterCommand(t *testing.T) {
+	tr := _ttlRewriter(&MigrateConfig{TTLOffset: 1000, TTLMax: 60000})
+	cases := []struct {
+		cmd, expect []byte
+	}{
+		{_cmd("EXPIRE", "k", "10"), _cmd("PEXPIREAT", "k", "1600000011000")},
+		{_cmd("pexpire", "k", "10000", "NX"), _cmd("PEXPIREAT", "k", "1600000011000", "NX")},
+		{_cmd("EXPIREAT", "k", "1600000010"), _cmd("PEXPIREAT", "k", "1600000011000")},
+		{_cmd("PEXPIREAT", "k", "1600000100000"), _cmd("PEXPIREAT", "k", "1600000060000")},
+		{_cmd("EXPIREAT", "k", "0"), _cmd("EXPIREAT", "k", "0")},
+		{_cmd("SETEX", "k", "10", "v"), _cmd("SET", "k", "v", "PXAT", "1600000011000")},
+		{_cmd("PSETEX", "k", "10000", "v"), _cmd("SET", "k", "v", "PXAT", "1600000011000")},
+		{_cmd("SET", "k", "v", "NX", "ex", "10", "GET"), _cmd("SET", "k", "v", "NX", "GET", "PXAT", "1600000011000")},
+		{_cmd("SET", "k", "v", "PXAT", "1600000010000"), _cmd("SET", "k", "v", "PXAT", "1600000011000")},
+		{_cmd("SET", "k", "v", "KEEPTTL"), _cmd("SET", "k", "v", "KEEPTTL")},
+		{_cmd("RESTORE", "k", "10000", "dump", "REPLACE"), _cmd("RESTORE", "k", "1600000011000", "dump", "REPLACE", "ABSTTL")},
+		{_cmd("RESTORE", "k", "0", "dump"), _cmd("RESTORE", "k", "0", "dump")},
+		{_cmd("GET", "k"), _cmd("GET", "k")},
+	}
+	for _, c := range cases {
+		assert.Equal(t, string(c.expect), string(tr.command(c.cmd)), strings.Replace(string(c.cmd), "\r\n", " ", -1))
+	}
+
+	tr = _ttlRewriter(&MigrateConfig{TTLDrop: true})
+	assert.Equal(t, _cmd("PERSIST", "k"), tr.command(_cmd("EXPIRE", "k", "10")))
+	assert.Equal(t, _cmd("PEXPIREAT", "k", "1599999990000"), tr.command(_cmd("EXPIRE", "k", "-10")))
+	assert.Equal(t, _cmd("SET", "k", "v"), tr.command(_cmd("SETEX", "k", "10", "v")))
+	assert.Equal(t, _cmd("SET", "k", "v", "XX"), tr.command(_cmd("SET", "k", "v", "EX", "10", "XX")))
+	assert.Equal(t, _cmd("RESTORE", "k", "0", "dump"), tr.command(_cmd("RESTORE", "k", "10000", "dump")))
+}
+
+type _expireCallback struct {
+	mockRDBCallback
+	expires []uint64
+}
+
+func (c *_expireCallback) CmdSet(key, val []byte, expire uint64) {
+	c.expires = append(c.expires, expire)
+}
+
+func (c *_expireCallback) ExpireAt(key []byte, expiry uint64) {
+	c.expires = append(c.expires, expiry)
+}
+
+func TestTTLCallback(t *testing.T) {
+	cb := &_expireCallback{mockRDBCallback: *_buildCB()}
+	tcb := newTTLCallback(cb, _ttlRewriter(&MigrateConfig{TTLMax: 60000}))
+	tcb.CmdSet([]byte("k"), []byte("v"), 0)
+	tcb.CmdSet([]byte("k"), []byte("v"), 1600000100000)
+	tcb.ExpireAt([]byte("k"), 1600000010000)
+	assert.Equal(t, []uint64{0, 1600000060000, 1600000010000}, cb.expires)
+}
+
+func TestProtocolCallbackerExpireAt(t *testing.T) {
+	conn, target := net.Pipe()
+	defer target.Close()
+	cb := &ProtocolCallbacker{pipe: newPipeline(conn, 0, nil)}
+	defer cb.Close()
+
+	go func() {
+		cb.ExpireAt([]byte("k"), 1600000010123)
+		_ = cb.Flush()
+	}()
+	cmd, err := readCommand(bufio.NewReader(target))
+	assert.NoError(t, err)
+	assert.Equal(t, string(_cmd("PEXPIREAT", "k", "1600000010123")), string(cmd))
+}
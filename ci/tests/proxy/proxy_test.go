@@ -12,7 +12,9 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"net"
+	"strings"
 	"testing"
 	"time"
 )
@@ -287,8 +289,8 @@ func testCommandForProxyMemcacheOk(t *testing.T) {
 	key = "bar"
 
 	_ = mc.Set(&memcache.Item{Key: key, Value: data})
-	_, _ = mc.Increment("key", uint64(1024))
-	_, _ = mc.Decrement("key", uint64(10))
+	_, _ = mc.Increment(key, uint64(1024))
+	_, _ = mc.Decrement(key, uint64(10))
 
 	item, err = mc.Get(key)
 	assert.NoError(t, err)
@@ -296,6 +298,7 @@ func testCommandForProxyMemcacheOk(t *testing.T) {
 
 	// ==== judge basicly add
 	key = "add_key"
+	_ = mc.Delete(key)
 	err = mc.Add(&memcache.Item{Key: key, Value: data})
 	assert.NoError(t, err)
 
@@ -309,6 +312,67 @@ func testCommandForProxyMemcacheOk(t *testing.T) {
 	assert.Len(t, items, 2)
 }
 
+// testCommandForProxyMemcacheTextOk sends the text commands by raw socket
+// and checks the replies byte by byte, the noreply commands are followed by
+// a get to make sure nothing is replied.
+func testCommandForProxyMemcacheTextOk(t *testing.T) {
+	conn, err := net.DialTimeout("tcp", "127.0.0.1:21211", time.Second)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	cases := []struct {
+		cmd   string
+		reply string
+	}{
+		{"set txt_a 1 0 1\r\na\r\n", "STORED\r\n"},
+		{"append txt_a 0 0 1\r\nb\r\n", "STORED\r\n"},
+		{"prepend txt_a 0 0 1\r\nc\r\n", "STORED\r\n"},
+		{"append txt_none 0 0 1\r\nb\r\n", "NOT_STORED\r\n"},
+		{"get txt_a\r\n", "VALUE txt_a 1 3\r\ncab\r\nEND\r\n"},
+		{"touch txt_a 100\r\n", "TOUCHED\r\n"},
+		{"touch txt_none 100\r\n", "NOT_FOUND\r\n"},
+		{"gat 100 txt_a txt_none\r\n", "VALUE txt_a 1 3\r\ncab\r\nEND\r\n"},
+		{"cas txt_a 0 0 1 1\r\nd\r\n", "EXISTS\r\n"},
+		{"cas txt_none 0 0 1 1\r\nd\r\n", "NOT_FOUND\r\n"},
+		{"touch txt_a 100 noreply\r\nset txt_b 0 0 1 noreply\r\nb\r\nincr txt_none 1 noreply\r\ndelete txt_none noreply\r\nget txt_b\r\n", "VALUE txt_b 0 1\r\nb\r\nEND\r\n"},
+		{"get txt_a txt_b txt_a txt_none\r\n", "VALUE txt_a 1 3\r\ncab\r\nVALUE txt_b 0 1\r\nb\r\nVALUE txt_a 1 3\r\ncab\r\nEND\r\n"},
+		{"verbosity 1\r\n", "OK\r\n"},
+		{"verbosity 1 noreply\r\nversion\r\n", "VERSION "},
+	}
+	for _, c := range cases {
+		conn.SetDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Write([]byte(c.cmd)); !assert.NoError(t, err) {
+			return
+		}
+		reply := make([]byte, len(c.reply))
+		if _, err := io.ReadFull(br, reply); assert.NoError(t, err, c.cmd) {
+			assert.Equal(t, c.reply, string(reply), c.cmd)
+		}
+		if strings.HasPrefix(c.reply, "VERSION") {
+			_, _ = br.ReadString('\n')
+		}
+	}
+
+	// gats replies the cas of each value
+	conn.SetDeadline(time.Now().Add(time.Second))
+	_, err = conn.Write([]byte("gats 100 txt_a\r\n"))
+	assert.NoError(t, err)
+	line, err := br.ReadString('\n')
+	assert.NoError(t, err)
+	fields := strings.Fields(line)
+	if assert.Len(t, fields, 5) {
+		_, _ = br.ReadString('\n')
+		_, _ = br.ReadString('\n')
+		_, err = fmt.Fprintf(conn, "cas txt_a 0 0 1 %s\r\nd\r\n", fields[4])
+		assert.NoError(t, err)
+		line, err = br.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, "STORED\r\n", line)
+	}
+}
+
 func testReconnOk(t *testing.T) {
 	cancel := _createTCPProxy(t, 11211, 21220)
 	defer cancel()
@@ -384,7 +448,8 @@ func TestIntegration(t *testing.T) {
 
 	t.Run("CommandForProxyRedisOk", testCommandForProxyRedisOk)
 	t.Run("CommandForProxyRedisClusterOk", testCommandForProxyRedisClusterOk)
-	t.Run("CommandForProxyMemcacheOk", testCommandForProxyRedisOk)
+	t.Run("CommandForProxyMemcacheOk", testCommandForProxyMemcacheOk)
+	t.Run("CommandForProxyMemcacheTextOk", testCommandForProxyMemcacheTextOk)
 	t.Run("FeatureReconnect", testReconnOk)
 	t.Run("FeatureNotAvaliableNode", testCmdNotAvaliabeNode)
 }
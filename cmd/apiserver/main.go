@@ -29,6 +29,11 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	if conf.Auth != nil {
+		if err = conf.Auth.Validate(); err != nil {
+			panic(err)
+		}
+	}
 	if log.Init(conf.Config) {
 		defer log.Close()
 	}
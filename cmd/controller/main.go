@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"overlord/pkg/log"
+	"overlord/platform/kube"
+	"overlord/version"
+)
+
+var confPath string
+
+func main() {
+	flag.StringVar(&confPath, "conf", "controller.toml", "controller conf")
+	flag.Parse()
+	if version.ShowVersion() {
+		return
+	}
+
+	conf := new(kube.Config)
+	if _, err := toml.DecodeFile(confPath, conf); err != nil {
+		panic(err)
+	}
+	conf.SetDefault()
+	if err := conf.Validate(); err != nil {
+		panic(err)
+	}
+	if log.Init(conf.Config) {
+		defer log.Close()
+	}
+	var (
+		kc  *kube.Client
+		err error
+	)
+	if conf.Kube == "" {
+		kc, err = kube.NewInClusterClient()
+	} else {
+		var token []byte
+		if conf.KubeTokenFile != "" {
+			token, err = ioutil.ReadFile(conf.KubeTokenFile)
+		}
+		kc = kube.NewClient(conf.Kube, strings.TrimSpace(string(token)), nil)
+	}
+	if err != nil {
+		panic(err)
+	}
+	api := kube.NewAPI(conf.APIServer, conf.APIToken, nil)
+	ctl := kube.New(kc, api, conf.Namespace, time.Duration(conf.Resync), time.Duration(conf.Poll))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT)
+		s := <-c
+		log.Infof("controller got signal %s and exit", s)
+		cancel()
+	}()
+	log.Infof("controller watching namespace %q and reconciling by apiserver %s", conf.Namespace, conf.APIServer)
+	ctl.Run(ctx)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net/http"
@@ -9,16 +10,22 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
+	"overlord/pkg/etcd"
 	"overlord/pkg/log"
 	"overlord/pkg/prom"
 	"overlord/proxy"
+	"overlord/proxy/accesslog"
+	"overlord/proxy/mcstat"
 	"overlord/proxy/slowlog"
+	"overlord/proxy/tracing"
 	"overlord/version"
 )
 
 var (
 	check              bool
+	checkConfig        bool
 	stat               string
 	metrics            bool
 	confFile           string
@@ -28,15 +35,27 @@ var (
 	slowlogSlowerThan  int
 	slowlogMaxBytes    int
 	slowlogBackupCount int
+	etcdAddr           string
+	etcdClusters       stringsFlag
+	sets               stringsFlag
+	drainTimeout       time.Duration
+
+	accessLogFile        string
+	accessLogFormat      string
+	accessLogMaxBytes    int
+	accessLogBackupCount int
+
+	traceEndpoint string
+	traceService  string
 )
 
-type clustersFlag []string
+type stringsFlag []string
 
-func (c *clustersFlag) String() string {
+func (c *stringsFlag) String() string {
 	return strings.Join([]string(*c), " ")
 }
 
-func (c *clustersFlag) Set(n string) error {
+func (c *stringsFlag) Set(n string) error {
 	*c = append(*c, n)
 	return nil
 }
@@ -49,6 +68,7 @@ var usage = func() {
 func init() {
 	flag.Usage = usage
 	flag.BoolVar(&check, "t", false, "conf file check")
+	flag.BoolVar(&checkConfig, "check-config", false, "fully validate conf and cluster files, report all the errors with their lines and exit.")
 	flag.StringVar(&stat, "stat", "", "stat listen addr. high priority than conf.stat.")
 	flag.BoolVar(&metrics, "metrics", false, "proxy support prometheus metrics and reuse stat port.")
 	flag.StringVar(&confFile, "conf", "", "conf file of proxy itself.")
@@ -58,6 +78,16 @@ func init() {
 	flag.IntVar(&slowlogSlowerThan, "slower-than", 0, "slower-than is the microseconds which slowlog must slower than.")
 	flag.IntVar(&slowlogMaxBytes, "slower-max-bytes", 500000000, "slower-max-bytes is maximum size of slow log file.")
 	flag.IntVar(&slowlogBackupCount, "slower-backup-count", 7, "slower-backup-count is maximum backup count of slow log file.")
+	flag.StringVar(&accessLogFile, "access-log", "", "access-log is the file where access log output, sampled by access_log_sample_rate of cluster.")
+	flag.StringVar(&accessLogFormat, "access-log-format", accesslog.FormatJSON, "access-log-format is the format of access log, json or text.")
+	flag.IntVar(&accessLogMaxBytes, "access-log-max-bytes", 500000000, "access-log-max-bytes is maximum size of access log file.")
+	flag.IntVar(&accessLogBackupCount, "access-log-backup-count", 7, "access-log-backup-count is maximum backup count of access log file.")
+	flag.StringVar(&traceEndpoint, "trace-endpoint", "", "trace-endpoint is the OTLP/HTTP traces endpoint where spans export, such as http://127.0.0.1:4318/v1/traces, sampled by trace_sample_rate of cluster.")
+	flag.StringVar(&traceService, "trace-service", "overlord-proxy", "trace-service is the service name of spans.")
+	flag.StringVar(&etcdAddr, "etcd", "", "etcd endpoint to load and watch backend clusters, such as http://127.0.0.1:2379.")
+	flag.Var(&etcdClusters, "etcd-cluster", "name of backend cluster loaded from etcd, can be set multiple times, all clusters if not set.")
+	flag.Var(&sets, "set", "override the config key such as clusters.0.listen_addr=0.0.0.0:26379 or proxy.read_timeout=100, can be set multiple times, higher priority than environment variables such as OVERLORD_CLUSTERS_0_LISTEN_ADDR.")
+	flag.DurationVar(&drainTimeout, "drain-timeout", 30*time.Second, "drain-timeout is the max time to wait clients closed after upgraded by SIGUSR2.")
 }
 
 func main() {
@@ -65,12 +95,18 @@ func main() {
 	if version.ShowVersion() {
 		os.Exit(0)
 	}
+	if err := proxy.SetOverrides(os.Environ(), sets); err != nil {
+		panic(err)
+	}
 
 	if check {
 		parseConfig()
 		os.Exit(0)
 	}
-	c, ccs := parseConfig()
+	if checkConfig {
+		os.Exit(checkConfigFiles())
+	}
+	c, ccs, bases := parseConfig()
 	if log.Init(c.Config) {
 		defer log.Close()
 	}
@@ -79,6 +115,10 @@ func main() {
 	if err != nil {
 		log.Errorf("fail to init slowlog due %s", err)
 	}
+	if err = accesslog.Init(accessLogFile, accessLogFormat, accessLogMaxBytes, accessLogBackupCount); err != nil {
+		log.Errorf("fail to init access log due %s", err)
+	}
+	tracing.Init(traceEndpoint, traceService)
 
 	// new proxy
 	p, err := proxy.New(c)
@@ -87,24 +127,59 @@ func main() {
 	}
 	defer p.Close()
 	p.Serve(ccs)
-	if reload {
+	reloadFunc := func() error { return p.Reload(clusterConfFile) }
+	persistFile := clusterConfFile
+	if etcdAddr != "" {
+		e, err := etcd.New(etcdAddr)
+		if err != nil {
+			panic(err)
+		}
+		go p.MonitorEtcdChange(e, bases, etcdClusters)
+		reloadFunc = func() error { return p.ReloadEtcd(e, bases, etcdClusters) }
+		// NOTE: nodes are managed by etcd
+		persistFile = ""
+	} else if reload {
 		go p.MonitorConfChange(clusterConfFile)
 	}
 	// pprof
 	if c.Stat != "" {
-		go http.ListenAndServe(c.Stat, nil)
+		http.HandleFunc("/clients", p.AdminAuth(p.ServeClients))
+		http.HandleFunc("/memcache/stats", mcstat.ServeHTTP)
+		http.HandleFunc("/reload", p.AdminAuth(proxy.ReloadHandler(reloadFunc)))
+		http.HandleFunc("/api/v1/clusters", p.AdminAuth(p.ServeClusters))
+		http.HandleFunc("/api/v1/clusters/", p.AdminAuth(p.NodesHandler(persistFile)))
+		http.HandleFunc("/api/v1/clients", p.AdminAuth(p.ServeClients))
+		http.HandleFunc("/api/v1/config", p.AdminAuth(p.ServeConfig))
+		http.HandleFunc("/api/v1/slowlog", p.AdminAuth(slowlog.ServeHTTP))
+		l, err := proxy.Listen("tcp", c.Stat)
+		if err != nil {
+			panic(err)
+		}
+		p.Share("tcp", c.Stat, l)
+		go http.Serve(l, nil)
 		if c.Proxy.UseMetrics {
+			if len(c.Proxy.LatencyBuckets) > 0 {
+				prom.LatencyBuckets = c.Proxy.LatencyBuckets
+			}
+			if len(c.Proxy.SizeBuckets) > 0 {
+				prom.SizeBuckets = c.Proxy.SizeBuckets
+			}
+			if len(c.Proxy.BatchBuckets) > 0 {
+				prom.BatchBuckets = c.Proxy.BatchBuckets
+			}
 			prom.Init()
 		} else {
 			prom.On = false
 		}
 	}
 	prom.VersionState(version.Str())
+	// NOTE: tell the old process to drain if upgraded
+	proxy.Ready()
 	// hanlde signal
-	signalHandler()
+	signalHandler(p, reloadFunc)
 }
 
-func parseConfig() (c *proxy.Config, ccs []*proxy.ClusterConfig) {
+func parseConfig() (c *proxy.Config, ccs, bases []*proxy.ClusterConfig) {
 	if confFile != "" {
 		c = &proxy.Config{}
 		if err := c.LoadFromFile(confFile); err != nil {
@@ -112,6 +187,12 @@ func parseConfig() (c *proxy.Config, ccs []*proxy.ClusterConfig) {
 		}
 	} else {
 		c = proxy.DefaultConfig()
+		if err := proxy.ApplyOverrides(c); err != nil {
+			panic(err)
+		}
+		if err := c.Validate(); err != nil {
+			panic(err)
+		}
 	}
 	// high priority start
 	if stat != "" {
@@ -121,9 +202,15 @@ func parseConfig() (c *proxy.Config, ccs []*proxy.ClusterConfig) {
 		c.Proxy.UseMetrics = metrics
 	}
 	// high priority end
-	var tmpCCS, err = proxy.LoadClusterConf(clusterConfFile)
-	if err != nil {
-		panic(err)
+	var (
+		tmpCCS []*proxy.ClusterConfig
+		err    error
+	)
+	// NOTE: the cluster config file is optional and used as bases with etcd
+	if clusterConfFile != "" || etcdAddr == "" {
+		if tmpCCS, err = proxy.LoadClusterConf(clusterConfFile); err != nil {
+			panic(err)
+		}
 	}
 
 	// reset slowlogslowerthan
@@ -134,21 +221,72 @@ func parseConfig() (c *proxy.Config, ccs []*proxy.ClusterConfig) {
 	}
 
 	ccs = tmpCCS
+	if etcdAddr != "" {
+		bases = tmpCCS
+		if slowlogSlowerThan > 0 {
+			def := proxy.DefaultEtcdCluster()
+			def.SlowlogSlowerThan = slowlogSlowerThan
+			bases = append(bases, def)
+		}
+		e, err := etcd.New(etcdAddr)
+		if err != nil {
+			panic(err)
+		}
+		var failed []string
+		if ccs, failed, err = proxy.LoadEtcdClusterConf(context.Background(), e, bases, etcdClusters); err != nil {
+			panic(err)
+		}
+		if len(failed) > 0 {
+			fmt.Fprintf(os.Stderr, "failed to load clusters %v from etcd\n", failed)
+		}
+	}
 	return
 }
 
-func signalHandler() {
+// checkConfigFiles prints the errors of conf and cluster files and returns
+// the exit code.
+func checkConfigFiles() int {
+	if confFile == "" && clusterConfFile == "" {
+		fmt.Fprintf(os.Stderr, "no conf file to check, set -conf or -cluster\n")
+		return 2
+	}
+	errs := proxy.CheckConfig(confFile, clusterConfFile)
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if len(errs) > 0 {
+		fmt.Fprintf(os.Stderr, "%d errors found\n", len(errs))
+		return 1
+	}
+	fmt.Println("conf files are ok")
+	return 0
+}
+
+func signalHandler(p *proxy.Proxy, reload func() error) {
 	var ch = make(chan os.Signal, 1)
-	signal.Notify(ch, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT)
+	signal.Notify(ch, syscall.SIGHUP, syscall.SIGUSR2, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT)
 	for {
 		log.Infof("overlord proxy version[%s] start serving", version.Str())
 		si := <-ch
-		log.Infof("overlord proxy version[%s] signal(%s) stop the process", version.Str(), si.String())
+		log.Infof("overlord proxy version[%s] receive signal(%s)", version.Str(), si.String())
 		switch si {
 		case syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT:
 			log.Infof("overlord proxy version[%s] exited", version.Str())
 			return
 		case syscall.SIGHUP:
+			if err := reload(); err != nil {
+				log.Errorf("overlord proxy reload cluster config error:%v", err)
+			}
+		case syscall.SIGUSR2:
+			pid, err := p.Upgrade()
+			if err != nil {
+				log.Errorf("overlord proxy upgrade error:%v", err)
+				continue
+			}
+			log.Infof("overlord proxy version[%s] upgraded to pid:%d and draining", version.Str(), pid)
+			p.Drain(drainTimeout)
+			log.Infof("overlord proxy version[%s] exited", version.Str())
+			return
 		default:
 			return
 		}
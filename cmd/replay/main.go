@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"time"
+
+	"overlord/pkg/types"
+	"overlord/proxy/capture"
+	"overlord/version"
+)
+
+var (
+	file      string
+	target    string
+	cacheType string
+	qps       int
+	wait      time.Duration
+)
+
+func main() {
+	flag.StringVar(&file, "file", "", "file captured by the capture admin api of proxy.")
+	flag.StringVar(&target, "target", "", "target addr replayed against, such as 127.0.0.1:6379.")
+	flag.StringVar(&cacheType, "type", string(types.CacheTypeRedis), "cache type of the file captured, redis or memcache.")
+	flag.IntVar(&qps, "qps", 0, "requests replayed per second, 0 means as fast as possible.")
+	flag.DurationVar(&wait, "wait", 5*time.Second, "max time to wait the replies after all replayed.")
+	flag.Parse()
+	if version.ShowVersion() {
+		return
+	}
+	ct := types.CacheType(cacheType)
+	if file == "" || target == "" || (ct != types.CacheTypeRedis && ct != types.CacheTypeMemcache) || qps < 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	n, err := replay(ct)
+	fmt.Printf("replayed %d requests\n", n)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "replay error:%v\n", err)
+		os.Exit(1)
+	}
+}
+
+// replay writes the requests of file to target at qps, the replies are
+// discarded.
+func replay(ct types.CacheType) (n int, err error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	conn, err := net.Dial("tcp", target)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	replied := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(ioutil.Discard, conn)
+		close(replied)
+	}()
+	var (
+		rd       = capture.NewReader(f, ct)
+		bw       = bufio.NewWriter(conn)
+		interval time.Duration
+		next     = time.Now()
+		req      []byte
+	)
+	if qps > 0 {
+		interval = time.Second / time.Duration(qps)
+	}
+	for {
+		if req, err = rd.Next(); err == io.EOF {
+			err = nil
+			break
+		} else if err != nil {
+			return
+		}
+		if interval > 0 {
+			if d := time.Until(next); d > 0 {
+				if err = bw.Flush(); err != nil {
+					return
+				}
+				time.Sleep(d)
+			}
+			next = next.Add(interval)
+		}
+		if _, err = bw.Write(req); err != nil {
+			return
+		}
+		n++
+	}
+	if err = bw.Flush(); err != nil {
+		return
+	}
+	if tc, ok := conn.(*net.TCPConn); ok {
+		_ = tc.CloseWrite()
+	}
+	select {
+	case <-replied:
+	case <-time.After(wait):
+	}
+	return
+}
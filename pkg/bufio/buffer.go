@@ -3,6 +3,7 @@ package bufio
 import (
 	"sort"
 	"sync"
+	"sync/atomic"
 )
 
 const (
@@ -45,6 +46,8 @@ func initBufPool(idx int) {
 type Buffer struct {
 	buf  []byte
 	r, w int
+	// ref counts the owner Reader and the holders of data sliced from buf.
+	ref int32
 }
 
 // NewBuffer new buffer.
@@ -93,6 +96,24 @@ func (b *Buffer) Reset() {
 	b.r, b.w = 0, 0
 }
 
+// Retain marks the data of buffer is referred, the buffer will not be
+// compacted or reused until released.
+func (b *Buffer) Retain() {
+	atomic.AddInt32(&b.ref, 1)
+}
+
+// Release drops the reference, the buffer is put back into pool when
+// neither the Reader nor any holder refers to it.
+func (b *Buffer) Release() {
+	if atomic.AddInt32(&b.ref, -1) == 0 {
+		Put(b)
+	}
+}
+
+func (b *Buffer) retained() bool {
+	return atomic.LoadInt32(&b.ref) > 1
+}
+
 // Get the data buffer
 func Get(size int) *Buffer {
 	if size <= defaultBufferSize {
@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"io"
 	"net"
+	"sync/atomic"
 
 	libnet "overlord/pkg/net"
 )
@@ -26,7 +27,9 @@ type Reader struct {
 }
 
 // NewReader returns a new Reader whose buffer has the default size.
+// The Reader owns the buffer b.
 func NewReader(rd io.Reader, b *Buffer) *Reader {
+	atomic.StoreInt32(&b.ref, 1)
 	return &Reader{rd: rd, b: b}
 }
 
@@ -62,6 +65,19 @@ func (r *Reader) Buffer() *Buffer {
 	return r.b
 }
 
+// Retain retains the local buffer and returns it, the data read before is
+// kept untouched until the returned buffer is released, the Reader moves the
+// unread data into a new buffer instead of compacting the retained one.
+func (r *Reader) Retain() *Buffer {
+	r.b.Retain()
+	return r.b
+}
+
+// Size will return the allocated size of local buffer
+func (r *Reader) Size() int {
+	return r.b.len()
+}
+
 // Read will trying to read until the buffer is full
 func (r *Reader) Read() error {
 	if r.err != nil {
@@ -71,7 +87,11 @@ func (r *Reader) Read() error {
 		r.b.grow()
 	}
 	if r.b.w == r.b.len() {
-		r.b.shrink()
+		if r.b.retained() {
+			r.detach()
+		} else {
+			r.b.shrink()
+		}
 	}
 	if err := r.fill(); err != io.EOF {
 		return err
@@ -79,6 +99,16 @@ func (r *Reader) Read() error {
 	return nil
 }
 
+// detach moves the unread data into a new buffer and leaves the retained
+// one to its holders.
+func (r *Reader) detach() {
+	b := Get(r.b.len())
+	atomic.StoreInt32(&b.ref, 1)
+	b.w = copy(b.buf, r.b.buf[r.b.r:r.b.w])
+	r.b.Release()
+	r.b = b
+}
+
 // ReadLine will read until meet the first crlf bytes.
 func (r *Reader) ReadLine() (line []byte, err error) {
 	if r.err != nil {
@@ -127,6 +157,45 @@ func (r *Reader) ReadExact(n int) (data []byte, err error) {
 	return
 }
 
+// ReadAtMost will read at most n size bytes of buffered data, or return
+// ErrBufferFull if nothing is buffered. Unlike ReadExact, the caller can
+// drain a long value chunk by chunk without growing the buffer.
+// It never contains any I/O operation
+func (r *Reader) ReadAtMost(n int) (data []byte, err error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	b := r.b.buffered()
+	if b == 0 {
+		err = ErrBufferFull
+		return
+	}
+	if n > b {
+		n = b
+	}
+	data = r.b.buf[r.b.r : r.b.r+n]
+	r.b.r += n
+	return
+}
+
+// Discard skips the next n bytes, it reads from the underlying reader as
+// needed but never grows the buffer, so a large value can be swallowed.
+func (r *Reader) Discard(n int) (err error) {
+	for n > 0 {
+		var data []byte
+		if data, err = r.ReadAtMost(n); err == ErrBufferFull {
+			if err = r.Read(); err != nil {
+				return
+			}
+			continue
+		} else if err != nil {
+			return
+		}
+		n -= len(data)
+	}
+	return
+}
+
 const (
 	maxWritevSize = 1024
 )
@@ -164,20 +233,33 @@ func (w *Writer) Flush() error {
 	if err != nil {
 		w.err = err
 	}
+	// NOTE: drop the references so that request and reply data gathered
+	// from many messages can be released after the flush.
+	for i := range w.bufs {
+		w.bufs[i] = nil
+	}
+	w.bufsp = nil
 	w.bufs = w.bufs[:0]
 	w.cnt = 0
 	return w.err
 }
 
-// Write writes the contents of p into the buffer.
-// It returns the number of bytes written.
-// If nn < len(p), it also returns an error explaining
-// why the write is short.
+// Buffered returns the number of bytes waiting to be flushed.
+func (w *Writer) Buffered() (n int) {
+	for _, buf := range w.bufs {
+		n += len(buf)
+	}
+	return
+}
+
+// Write appends p to the pending buffers without copying it, so p must
+// stay untouched until the next Flush. The pending buffers of all the
+// messages written between two flushes are sent by one writev call.
 func (w *Writer) Write(p []byte) (err error) {
 	if w.err != nil {
 		return w.err
 	}
-	if p == nil {
+	if len(p) == 0 {
 		return nil
 	}
 	w.bufs = append(w.bufs, p)
@@ -91,6 +91,41 @@ func TestReaderReadExact(t *testing.T) {
 	assert.Equal(t, ErrBufferFull, err)
 }
 
+func TestReaderReadAtMost(t *testing.T) {
+	b := NewReader(bytes.NewBuffer([]byte("abcdefgh")), Get(defaultBufferSize))
+	_, err := b.ReadAtMost(4)
+	assert.Equal(t, ErrBufferFull, err)
+
+	_ = b.Read()
+	data, err := b.ReadAtMost(5)
+	assert.NoError(t, err)
+	assert.Equal(t, "abcde", string(data))
+
+	data, err = b.ReadAtMost(5)
+	assert.NoError(t, err)
+	assert.Equal(t, "fgh", string(data))
+
+	_, err = b.ReadAtMost(5)
+	assert.Equal(t, ErrBufferFull, err)
+}
+
+func TestReaderDiscard(t *testing.T) {
+	data := bytes.Repeat([]byte("a"), 10*1024)
+	data = append(data, "tail"...)
+	b := NewReader(bytes.NewBuffer(data), NewBuffer(1024))
+	err := b.Discard(10 * 1024)
+	assert.NoError(t, err)
+	assert.Equal(t, 1024, b.Size())
+
+	_ = b.Read()
+	tail, err := b.ReadExact(4)
+	assert.NoError(t, err)
+	assert.Equal(t, "tail", string(tail))
+
+	err = b.Discard(1)
+	assert.Error(t, err)
+}
+
 func TestWriterWriteOk(t *testing.T) {
 	data := "Bilibili 干杯 - ( ゜- ゜)つロ"
 	conn := libnet.NewConn(mockconn.CreateConn(nil, 1), time.Second, time.Second)
@@ -114,3 +149,48 @@ func TestWriterWriteOk(t *testing.T) {
 	err = w.Flush()
 	assert.EqualError(t, err, "some error")
 }
+
+func TestWriterFlushGather(t *testing.T) {
+	dconn, buf := mockconn.CreateDownStreamConn()
+	w := NewWriter(libnet.NewConn(dconn, time.Second, time.Second))
+	for _, p := range []string{"GET", "", " ", "a", "\r\n", "GET b\r\n"} {
+		assert.NoError(t, w.Write([]byte(p)))
+	}
+	assert.Len(t, w.bufs, 5)
+	assert.Equal(t, 14, w.Buffered())
+
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, "GET a\r\nGET b\r\n", buf.String())
+	assert.Len(t, w.bufs, 0)
+	assert.Nil(t, w.bufs[:5][0])
+	assert.Equal(t, 0, w.Buffered())
+}
+
+func TestReaderRetain(t *testing.T) {
+	b := NewReader(bytes.NewBuffer([]byte("abcdefghijkl")), NewBuffer(8))
+	_ = b.Read()
+	data, err := b.ReadExact(4)
+	assert.NoError(t, err)
+	held := b.Retain()
+	assert.Equal(t, int32(2), held.ref)
+
+	_, err = b.ReadExact(4)
+	assert.NoError(t, err)
+	_ = b.Read()
+	assert.False(t, held == b.Buffer())
+	assert.Equal(t, int32(1), held.ref)
+	assert.Equal(t, int32(1), b.Buffer().ref)
+	assert.Equal(t, "abcd", string(data))
+	tail, err := b.ReadExact(4)
+	assert.NoError(t, err)
+	assert.Equal(t, "ijkl", string(tail))
+	held.Release()
+	assert.Equal(t, int32(0), held.ref)
+
+	b = NewReader(bytes.NewBuffer([]byte("abcdefghijkl")), NewBuffer(8))
+	buf := b.Buffer()
+	_ = b.Read()
+	_, _ = b.ReadExact(8)
+	_ = b.Read()
+	assert.True(t, buf == b.Buffer())
+}
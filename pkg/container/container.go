@@ -1,17 +1,21 @@
 package container
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"os"
 	"overlord/pkg/log"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 )
 
 // Container define container with cancel.
@@ -86,6 +90,15 @@ func (c *Container) Stop() {
 	c.cancel()
 }
 
+// Restart restart container, which is started again even if exited.
+func (c *Container) Restart() error {
+	if c.id == "" {
+		return fmt.Errorf("container %s absent", c.id)
+	}
+	timeout := 10 * time.Second
+	return c.cli.ContainerRestart(c.ctx, c.id, &timeout)
+}
+
 // Wait wait container to exit.
 func (c *Container) Wait() error {
 	if c.id == "" {
@@ -94,3 +107,28 @@ func (c *Container) Wait() error {
 	_, err := c.cli.ContainerWait(c.ctx, c.id)
 	return err
 }
+
+// Tail returns the last n lines of the stdout and stderr of container.
+func (c *Container) Tail(n int) ([]string, error) {
+	if c.id == "" {
+		return nil, fmt.Errorf("container %s absent", c.id)
+	}
+	// NOTE: c.ctx is canceled once stopped, but the logs are still there.
+	rd, err := c.cli.ContainerLogs(context.Background(), c.id, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Tail:       strconv.Itoa(n),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+	buf := new(bytes.Buffer)
+	if _, err = stdcopy.StdCopy(buf, buf, rd); err != nil {
+		return nil, err
+	}
+	if buf.Len() == 0 {
+		return nil, nil
+	}
+	return strings.Split(strings.TrimRight(buf.String(), "\n"), "\n"), nil
+}
@@ -3,9 +3,11 @@ package etcd
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"overlord/pkg/log"
@@ -18,17 +20,23 @@ const (
 	FRAMEWORK           = "/overlord/framework"
 	ClusterDir          = "/overlord/clusters"
 	ClusterInstancesDir = "/overlord/clusters/%s/instances/"
+	ClusterProxyConf    = "/overlord/clusters/%s/proxy"
 	InstanceDir         = "/overlord/instances/%s:%d"
 	InstanceDirPrefix   = "/overlord/instances"
 	HeartBeatDir        = "/overlord/heartbeat"
 	ConfigDir           = "/overlord/config"
 	JobsDir             = "/overlord/jobs"
 	JobDetailDir        = "/overlord/job_detail"
+	JobLogDir           = "/overlord/job_log"
 	FrameWork           = "/overlord/framework"
 	AppidsDir           = "/overlord/appids"
 	SpecsDir            = "/overlord/specs"
 	FileServer          = "/overlord/fs"
 	PortSequence        = "/overlord/port_sequence"
+	AnziCheckpointDir   = "/overlord/anzi/checkpoints"
+	CapacityDir         = "/overlord/capacity"
+	ApprovalDir         = "/overlord/approvals"
+	AuditDir            = "/overlord/audit"
 )
 
 // define watch event
@@ -45,6 +53,9 @@ const (
 	ActionExpire           = "expire"
 )
 
+// JobLogTTL is the retention of the job execution logs.
+const JobLogTTL = 7 * 24 * time.Hour
+
 // Node etcd kv info.
 type Node struct {
 	Key   string
@@ -175,6 +186,128 @@ func (e *Etcd) SetJobState(ctx context.Context, group, jobID string, state strin
 	return err
 }
 
+// JobLog is a single line of the job execution logs.
+type JobLog struct {
+	Time    int64  `json:"time"`
+	Source  string `json:"source"`
+	Message string `json:"message"`
+}
+
+// AppendJobLog will append a new log line which written by source into the
+// execution logs of the given job, the line expires after JobLogTTL.
+func (e *Etcd) AppendJobLog(ctx context.Context, group, jobID, source, msg string) error {
+	data, err := json.Marshal(&JobLog{Time: time.Now().Unix(), Source: source, Message: msg})
+	if err != nil {
+		return err
+	}
+	_, err = e.kapi.CreateInOrder(ctx, fmt.Sprintf("%s/%s/%s", JobLogDir, group, jobID), string(data), &cli.CreateInOrderOptions{TTL: JobLogTTL})
+	return err
+}
+
+// JobLogs will get all the execution logs of the given job in order.
+func (e *Etcd) JobLogs(ctx context.Context, group, jobID string) ([]*JobLog, error) {
+	nodes, err := e.LS(ctx, fmt.Sprintf("%s/%s/%s", JobLogDir, group, jobID))
+	if cli.IsKeyNotFound(err) {
+		return []*JobLog{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	logs := make([]*JobLog, 0, len(nodes))
+	for _, node := range nodes {
+		jl := new(JobLog)
+		if err = json.Unmarshal([]byte(node.Value), jl); err != nil {
+			log.Warnf("skip bad job log %s due %s", node.Key, err)
+			continue
+		}
+		logs = append(logs, jl)
+	}
+	return logs, nil
+}
+
+// JobEvent is either a state transition or a new execution log line of job.
+type JobEvent struct {
+	State string  `json:"state,omitempty"`
+	Log   *JobLog `json:"log,omitempty"`
+}
+
+// WatchJob sends the current state and execution logs of the given job, and
+// then the following state transitions and logs into the returned channel,
+// which is closed once ctx done or watching failed.
+func (e *Etcd) WatchJob(ctx context.Context, group, jobID string) (<-chan *JobEvent, error) {
+	stateKey := fmt.Sprintf("%s/%s/%s/state", JobDetailDir, group, jobID)
+	logDir := fmt.Sprintf("%s/%s/%s", JobLogDir, group, jobID)
+	sresp, err := e.kapi.Get(ctx, stateKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	evts := []*JobEvent{{State: sresp.Node.Value}}
+	var logIndex uint64
+	lresp, err := e.kapi.Get(ctx, logDir, &cli.GetOptions{Sort: true})
+	if cerr, ok := err.(cli.Error); ok && cerr.Code == cli.ErrorCodeKeyNotFound {
+		logIndex = cerr.Index
+	} else if err != nil {
+		return nil, err
+	} else {
+		logIndex = lresp.Index
+		for _, node := range lresp.Node.Nodes {
+			if evt := jobLogEvent(node); evt != nil {
+				evts = append(evts, evt)
+			}
+		}
+	}
+
+	ch := make(chan *JobEvent, len(evts))
+	for _, evt := range evts {
+		ch <- evt
+	}
+	sub, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	watch := func(key string, index uint64, conv func(*cli.Node) *JobEvent) {
+		defer wg.Done()
+		defer cancel()
+		watcher := e.kapi.Watcher(key, &cli.WatcherOptions{AfterIndex: index, Recursive: true})
+		for {
+			resp, err := watcher.Next(sub)
+			if err != nil {
+				if sub.Err() == nil {
+					log.Errorf("watch job %s/%s on %s err %v", group, jobID, key, err)
+				}
+				return
+			}
+			if resp.Action == ActionExpire || resp.Action == ActionDelete {
+				continue
+			}
+			evt := conv(resp.Node)
+			if evt == nil {
+				continue
+			}
+			select {
+			case ch <- evt:
+			case <-sub.Done():
+				return
+			}
+		}
+	}
+	wg.Add(2)
+	go watch(stateKey, sresp.Index, func(node *cli.Node) *JobEvent { return &JobEvent{State: node.Value} })
+	go watch(logDir, logIndex, jobLogEvent)
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+	return ch, nil
+}
+
+func jobLogEvent(node *cli.Node) *JobEvent {
+	jl := new(JobLog)
+	if err := json.Unmarshal([]byte(node.Value), jl); err != nil {
+		log.Warnf("skip bad job log %s due %s", node.Key, err)
+		return nil
+	}
+	return &JobEvent{Log: jl}
+}
+
 // WatchOnExpire watch expire action in this dir.
 func (e *Etcd) WatchOnExpire(ctx context.Context, dir string) (key chan string, err error) {
 	watcher := e.kapi.Watcher(dir, &cli.WatcherOptions{Recursive: true})
@@ -308,6 +441,72 @@ func (e *Etcd) GetAllSpecs(ctx context.Context) ([]string, error) {
 	return specs, nil
 }
 
+// Capacity is the schedulable resources of an agent seen by scheduler at
+// the last offer, which has taken off the reserved headroom and multiplied
+// by the oversubscription ratio.
+type Capacity struct {
+	Host   string  `json:"host"`
+	CPU    float64 `json:"cpu"`
+	Memory float64 `json:"memory"`
+	Ports  int     `json:"ports"`
+	// Time is the unix seconds of the last offer of the agent.
+	Time int64 `json:"time"`
+}
+
+// SetCapacity saves the schedulable capacity of the agent.
+func (e *Etcd) SetCapacity(ctx context.Context, c *Capacity) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return e.Set(ctx, fmt.Sprintf("%s/%s", CapacityDir, c.Host), string(data))
+}
+
+// Capacities gets the schedulable capacity of all the agents.
+func (e *Etcd) Capacities(ctx context.Context) ([]*Capacity, error) {
+	nodes, err := e.LS(ctx, CapacityDir)
+	if cli.IsKeyNotFound(err) {
+		return []*Capacity{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	cs := make([]*Capacity, 0, len(nodes))
+	for _, node := range nodes {
+		c := new(Capacity)
+		if err = json.Unmarshal([]byte(node.Value), c); err != nil {
+			log.Warnf("skip bad capacity %s due %s", node.Key, err)
+			continue
+		}
+		cs = append(cs, c)
+	}
+	return cs, nil
+}
+
+// ProxyConf is the config of overlord proxy of the cluster written by
+// apiserver, so that all the proxies forward by the same distribution. The
+// zero fields are left to the config of proxy.
+type ProxyConf struct {
+	HashMethod       string `json:"hash_method,omitempty"`
+	HashDistribution string `json:"hash_distribution,omitempty"`
+	HashTag          string `json:"hash_tag,omitempty"`
+	DialTimeout      int    `json:"dial_timeout,omitempty"`
+	ReadTimeout      int    `json:"read_timeout,omitempty"`
+	WriteTimeout     int    `json:"write_timeout,omitempty"`
+	NodeConnections  int32  `json:"node_connections,omitempty"`
+	PingFailLimit    int    `json:"ping_fail_limit,omitempty"`
+	PingAutoEject    *bool  `json:"ping_auto_eject,omitempty"`
+}
+
+// SetProxyConf saves the proxy config of the cluster.
+func (e *Etcd) SetProxyConf(ctx context.Context, cluster string, c *ProxyConf) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return e.Set(ctx, fmt.Sprintf(ClusterProxyConf, cluster), string(data))
+}
+
 // Cas will compareAndSwap with the given value
 func (e *Etcd) Cas(ctx context.Context, key, old, newer string) error {
 	_, err := e.kapi.Set(ctx, key, newer, &cli.SetOptions{PrevValue: old})
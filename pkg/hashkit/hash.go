@@ -1,5 +1,7 @@
 package hashkit
 
+import "bytes"
+
 // constants defines
 const (
 	HashMethodFnv1a64 = "fnv1a_64"
@@ -15,11 +17,31 @@ const (
 	HashMethodOneOnTime = "one_on_time"
 	HashMethodHsieh     = "hsieh"
 	HashMethodMurmur    = "murmur"
+	HashMethodMurmur3   = "murmur3"
+
+	DistributionKetama = "ketama"
+	DistributionModula = "modula"
+	DistributionRandom = "random"
 )
 
+// ValidMethod returns whether or not the hash method is supported.
+func ValidMethod(method string) bool {
+	switch method {
+	case HashMethodFnv1a64, HashMethodFnv164, HashMethodFnv1a32, HashMethodFnv132,
+		HashMethodCRC16, HashMethodCRC32, HashMethodCRC32a,
+		HashMethodMD5, HashMethodOneOnTime, HashMethodHsieh, HashMethodMurmur, HashMethodMurmur3:
+		return true
+	}
+	return false
+}
+
+// ValidDistribution returns whether or not the distribution is supported.
+func ValidDistribution(des string) bool {
+	return des == DistributionKetama || des == DistributionModula || des == DistributionRandom
+}
+
 // NewRing will create new and need init method.
 func NewRing(des, method string) *HashRing {
-
 	var hash func([]byte) uint
 	switch method {
 
@@ -47,8 +69,32 @@ func NewRing(des, method string) *HashRing {
 		hash = hashHsieh
 	case HashMethodMurmur:
 		hash = hashMurmur
+	case HashMethodMurmur3:
+		hash = hashMurmur3
 	default:
 		hash = hashFnv1a64
 	}
-	return newRingWithHash(hash)
+	h := newRingWithHash(hash)
+	if des == DistributionModula || des == DistributionRandom {
+		h.des = des
+	}
+	return h
+}
+
+// TrimHashTag returns the substring of key between the two bytes of tag, as
+// twemproxy and redis cluster, the whole key is returned when tag is not
+// found or the substring is empty.
+func TrimHashTag(key, tag []byte) []byte {
+	if len(tag) != 2 {
+		return key
+	}
+	bidx := bytes.IndexByte(key, tag[0])
+	if bidx == -1 {
+		return key
+	}
+	eidx := bytes.IndexByte(key[bidx+1:], tag[1])
+	if eidx <= 0 {
+		return key
+	}
+	return key[bidx+1 : bidx+1+eidx]
 }
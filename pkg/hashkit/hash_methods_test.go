@@ -19,4 +19,6 @@ func TestAllHashMethods(t *testing.T) {
 	assert.Equal(t, uint(2264676836), hashHsieh(key), "hsieh")
 	assert.Equal(t, uint(1957635836), hashMurmur(key), "murmur")
 	assert.Equal(t, uint(2451084222), hashOneOnTime(key), "hash one on time")
+	assert.Equal(t, uint(613153351), hashMurmur3([]byte("hello")), "murmur3")
+	assert.Equal(t, uint(0), hashMurmur3(nil), "murmur3 empty")
 }
@@ -13,3 +13,79 @@ func TestNewRingOk(t *testing.T) {
 	ring = NewRing("ketama", "fnv1a_64")
 	assert.NotNil(t, ring)
 }
+
+func TestValidOk(t *testing.T) {
+	assert.True(t, ValidMethod(HashMethodMurmur3))
+	assert.False(t, ValidMethod("fnv1a64"))
+	assert.True(t, ValidDistribution(DistributionModula))
+	assert.False(t, ValidDistribution("redis_cluster"))
+}
+
+func TestRingModulaOk(t *testing.T) {
+	ring := NewRing(DistributionModula, HashMethodCRC32a)
+	ring.Init([]string{"a", "b"}, []int{1, 3})
+	key := []byte("key")
+	node, ok := ring.GetNode(key)
+	assert.True(t, ok)
+	expect := "b"
+	if hashCrc32a(key)%4 == 0 {
+		expect = "a"
+	}
+	assert.Equal(t, expect, node)
+
+	counts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		node, _ := ring.GetNode([]byte{byte(i), byte(i >> 8)})
+		counts[node]++
+	}
+	assert.True(t, counts["b"] > 2*counts["a"], "weighted")
+}
+
+func TestRingRandomOk(t *testing.T) {
+	ring := NewRing(DistributionRandom, HashMethodFnv1a64)
+	_, ok := ring.GetNode([]byte("key"))
+	assert.False(t, ok)
+	ring.Init([]string{"a", "b"}, []int{1, 1})
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		node, ok := ring.GetNode([]byte("key"))
+		assert.True(t, ok)
+		seen[node] = true
+	}
+	assert.Len(t, seen, 2)
+}
+
+func TestTrimHashTagOk(t *testing.T) {
+	tag := []byte("{}")
+	assert.Equal(t, []byte("123"), TrimHashTag([]byte("test{123}name"), tag))
+	assert.Equal(t, []byte("123"), TrimHashTag([]byte("{123}{age}"), tag))
+	assert.Equal(t, []byte("a{}b"), TrimHashTag([]byte("a{}b"), tag), "empty tag")
+	assert.Equal(t, []byte("a{b"), TrimHashTag([]byte("a{b"), tag))
+	assert.Equal(t, []byte("a{b}"), TrimHashTag([]byte("a{b}"), nil))
+}
+
+func TestRingRandomWeighted(t *testing.T) {
+	ring := NewRing(DistributionRandom, HashMethodFnv1a64)
+	ring.Init([]string{"a", "b"}, []int{1, 3})
+	counts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		node, _ := ring.GetNode([]byte("key"))
+		counts[node]++
+	}
+	assert.True(t, counts["b"] > 2*counts["a"], "weighted")
+}
+
+func TestRingDrained(t *testing.T) {
+	for _, des := range []string{DistributionKetama, DistributionModula, DistributionRandom} {
+		ring := NewRing(des, HashMethodFnv1a64)
+		ring.Init([]string{"a", "b"}, []int{0, 1})
+		for i := 0; i < 1000; i++ {
+			node, ok := ring.GetNode([]byte{byte(i), byte(i >> 8)})
+			assert.True(t, ok)
+			assert.Equal(t, "b", node, des)
+		}
+		ring.Init([]string{"a"}, []int{0})
+		_, ok := ring.GetNode([]byte("key"))
+		assert.False(t, ok, des)
+	}
+}
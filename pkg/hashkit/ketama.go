@@ -3,6 +3,7 @@ package hashkit
 import (
 	"crypto/md5"
 	"fmt"
+	"math/rand"
 	"sort"
 	"sync"
 	"sync/atomic"
@@ -37,6 +38,8 @@ type HashRing struct {
 	ticks atomic.Value
 	lock  sync.Mutex
 	hash  func([]byte) uint
+	// des is the distribution, ketama if empty.
+	des string
 }
 
 // Ketama new a hash ring with ketama consistency.
@@ -68,6 +71,11 @@ func (h *HashRing) init(nodes []string, spots []int) {
 	}
 	h.nodes = nodes
 	h.spots = spots
+	switch h.des {
+	case DistributionModula, DistributionRandom:
+		h.initWeighted()
+		return
+	}
 	var (
 		ticks          []nodeHash
 		svrn           = len(nodes)
@@ -80,6 +88,10 @@ func (h *HashRing) init(nodes []string, spots []int) {
 		totalw += sp
 	}
 	for idx, node := range nodes {
+		if spots[idx] <= 0 {
+			// NOTE: node of weight 0 is drained and holds no points
+			continue
+		}
 		pct := float64(spots[idx]) / float64(totalw)
 		pointerPerSvr = int((pct*_pointsPerServer/4*float64(svrn) + 0.0000000001) * 4)
 		for pidx := 1; pidx <= pointerPerSvr/pointerPerHash; pidx++ {
@@ -103,6 +115,19 @@ func (h *HashRing) init(nodes []string, spots []int) {
 	h.ticks.Store(ts)
 }
 
+// initWeighted builds ticks as twemproxy modula and random, every node holds
+// the ticks as many as its weight in order.
+func (h *HashRing) initWeighted() {
+	ts := &tickArray{}
+	for idx, node := range h.nodes {
+		for i := 0; i < h.spots[idx]; i++ {
+			ts.nodes = append(ts.nodes, nodeHash{node: node})
+		}
+	}
+	ts.length = len(ts.nodes)
+	h.ticks.Store(ts)
+}
+
 func (h *HashRing) ketamaHash(key string, kl, alignment int) (v uint) {
 	hs := md5.New()
 	_, _ = hs.Write([]byte(key))
@@ -172,6 +197,12 @@ func (h *HashRing) GetNode(key []byte) (string, bool) {
 	if !ok || ts.length == 0 {
 		return "", false
 	}
+	switch h.des {
+	case DistributionModula:
+		return ts.nodes[h.hash(key)%uint(ts.length)].node, true
+	case DistributionRandom:
+		return ts.nodes[rand.Intn(ts.length)].node, true
+	}
 	value := h.hash(key)
 
 	i := sort.Search(ts.length, func(i int) bool { return ts.nodes[i].hash >= value })
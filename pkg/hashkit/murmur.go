@@ -1,9 +1,56 @@
 package hashkit
 
-import "github.com/aviddiviner/go-murmur"
+import (
+	"encoding/binary"
+	"math/bits"
+
+	"github.com/aviddiviner/go-murmur"
+)
 
 func hashMurmur(key []byte) uint {
 	var uklen = uint32(len(key))
 	var seed = 0xdeadbeef * uklen
 	return uint(murmur.MurmurHash2(key, seed))
 }
+
+// hashMurmur3 is the 32 bits MurmurHash3 with seed 0.
+func hashMurmur3(key []byte) uint {
+	const (
+		c1 = 0xcc9e2d51
+		c2 = 0x1b873593
+	)
+	var h uint32
+	nblocks := len(key) / 4
+	for i := 0; i < nblocks; i++ {
+		k := binary.LittleEndian.Uint32(key[i*4:])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+	var k uint32
+	tail := key[nblocks*4:]
+	switch len(tail) {
+	case 3:
+		k ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(tail[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+	h ^= uint32(len(key))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return uint(h)
+}
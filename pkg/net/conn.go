@@ -3,6 +3,7 @@ package net
 import (
 	"errors"
 	"net"
+	"sync/atomic"
 	"time"
 )
 
@@ -21,7 +22,9 @@ type Conn struct {
 	readTimeout  time.Duration
 	writeTimeout time.Duration
 
-	closed bool
+	// closed is atomic since Close may be called by a goroutine other
+	// than the reading one, such as killing the client.
+	closed int32
 }
 
 // DialWithTimeout will create new auto timeout Conn
@@ -42,8 +45,17 @@ func (c *Conn) Dup() *Conn {
 	return DialWithTimeout(c.addr, c.dialTimeout, c.readTimeout, c.writeTimeout)
 }
 
+// SetReadTimeout changes the read timeout, zero means never timeout and the
+// deadline armed by the last read is cleared.
+func (c *Conn) SetReadTimeout(timeout time.Duration) {
+	c.readTimeout = timeout
+	if timeout == 0 && c.Conn != nil {
+		_ = c.SetReadDeadline(time.Time{})
+	}
+}
+
 func (c *Conn) Read(b []byte) (n int, err error) {
-	if c.closed || c.Conn == nil {
+	if atomic.LoadInt32(&c.closed) == 1 || c.Conn == nil {
 		return 0, ErrConnClosed
 	}
 	if timeout := c.readTimeout; timeout != 0 {
@@ -56,7 +68,7 @@ func (c *Conn) Read(b []byte) (n int, err error) {
 }
 
 func (c *Conn) Write(b []byte) (n int, err error) {
-	if c.closed || c.Conn == nil {
+	if atomic.LoadInt32(&c.closed) == 1 || c.Conn == nil {
 		return 0, ErrConnClosed
 	}
 	if timeout := c.writeTimeout; timeout != 0 {
@@ -70,18 +82,24 @@ func (c *Conn) Write(b []byte) (n int, err error) {
 
 // Close close conn.
 func (c *Conn) Close() error {
-	if c.Conn != nil && !c.closed {
-		c.closed = true
+	if c.Conn != nil && atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
 		return c.Conn.Close()
 	}
 	return nil
 }
 
-// Writev impl the net.buffersWriter to support writev
-func (c *Conn) Writev(buf *net.Buffers) (int64, error) {
-	if c.closed || c.Conn == nil {
+// Writev impl the net.buffersWriter to support writev.
+// All the buffers are written by one writev call (split by the kernel
+// iovec limit) under a single write deadline.
+func (c *Conn) Writev(buf *net.Buffers) (n int64, err error) {
+	if atomic.LoadInt32(&c.closed) == 1 || c.Conn == nil {
 		return 0, ErrConnClosed
 	}
-	n, err := buf.WriteTo(c.Conn)
-	return n, err
+	if timeout := c.writeTimeout; timeout != 0 {
+		if err = c.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+			return
+		}
+	}
+	n, err = buf.WriteTo(c.Conn)
+	return
 }
@@ -128,3 +128,33 @@ func TestConnNoConn(t *testing.T) {
 	assert.Equal(t, int64(0), n64)
 	assert.Equal(t, ErrConnClosed, err)
 }
+
+func TestConnWritevMock(t *testing.T) {
+	mconn, buf := mockconn.CreateDownStreamConn()
+	conn := NewConn(mconn, time.Second, time.Second)
+	buffers := net.Buffers([][]byte{[]byte("baka"), []byte("qiu")})
+	n, err := conn.Writev(&buffers)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), n)
+	assert.Equal(t, "bakaqiu", buf.String())
+}
+
+func TestConnSetReadTimeoutZero(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	conn := NewConn(client, 20*time.Millisecond, time.Second)
+	go server.Write([]byte("a"))
+	bs := make([]byte, 1)
+	_, err := conn.Read(bs)
+	assert.NoError(t, err)
+
+	// the deadline armed by the last read is cleared.
+	conn.SetReadTimeout(0)
+	go func() {
+		time.Sleep(60 * time.Millisecond)
+		server.Write([]byte("b"))
+	}()
+	_, err = conn.Read(bs)
+	assert.NoError(t, err)
+	assert.Equal(t, "b", string(bs))
+}
@@ -0,0 +1,306 @@
+// Package objstore is the client of S3 compatible object storage, such as
+// AWS S3, aliyun OSS and minio, which signs the requests by AWS signature
+// version 4.
+package objstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRegion   = "us-east-1"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	amzDateFormat   = "20060102T150405Z"
+	signAlgorithm   = "AWS4-HMAC-SHA256"
+)
+
+// define errors
+var (
+	ErrNotFound      = errors.New("object not found")
+	ErrConfigInvalid = errors.New("object storage config is invalid")
+)
+
+// Config is the config of object storage.
+type Config struct {
+	// Endpoint is the url of storage service, such as
+	// "https://s3.us-east-1.amazonaws.com" or "http://127.0.0.1:9000".
+	Endpoint  string `toml:"endpoint"`
+	Region    string `toml:"region"`
+	Bucket    string `toml:"bucket"`
+	AccessKey string `toml:"access_key"`
+	SecretKey string `toml:"secret_key"`
+	// PathStyle addresses the bucket as endpoint/bucket instead of the
+	// virtual host bucket.endpoint, such as minio.
+	PathStyle bool `toml:"path_style"`
+}
+
+// Object is the object listed in bucket.
+type Object struct {
+	Key          string    `xml:"Key"`
+	Size         int64     `xml:"Size"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+// Store is the client of a bucket.
+type Store struct {
+	cfg    *Config
+	base   *url.URL
+	client *http.Client
+	now    func() time.Time
+}
+
+// New new the client of bucket.
+func New(cfg *Config) (*Store, error) {
+	if cfg == nil || cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, ErrConfigInvalid
+	}
+	base, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("%v: endpoint %s must be url", ErrConfigInvalid, cfg.Endpoint)
+	}
+	if cfg.PathStyle {
+		base.Path = "/" + cfg.Bucket
+	} else {
+		base.Host = cfg.Bucket + "." + base.Host
+		base.Path = ""
+	}
+	return &Store{
+		cfg:    cfg,
+		base:   base,
+		client: &http.Client{},
+		now:    time.Now,
+	}, nil
+}
+
+// Put uploads the object key with size bytes read from body.
+func (s *Store) Put(ctx context.Context, key string, body io.Reader, size int64) error {
+	req, err := s.request(ctx, http.MethodPut, key, nil, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Get downloads the object key, the body must be closed after read.
+func (s *Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := s.request(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Delete deletes the object key, it's ok if not exists.
+func (s *Store) Delete(ctx context.Context, key string) error {
+	req, err := s.request(ctx, http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if err == ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+type listResult struct {
+	Contents              []*Object `xml:"Contents"`
+	IsTruncated           bool      `xml:"IsTruncated"`
+	NextContinuationToken string    `xml:"NextContinuationToken"`
+}
+
+// List lists all the objects whose key has the prefix, ordered by key.
+func (s *Store) List(ctx context.Context, prefix string) (objs []*Object, err error) {
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	for {
+		var req *http.Request
+		if req, err = s.request(ctx, http.MethodGet, "", query, nil); err != nil {
+			return
+		}
+		var resp *http.Response
+		if resp, err = s.do(req); err != nil {
+			return
+		}
+		var result listResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return
+		}
+		objs = append(objs, result.Contents...)
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+func (s *Store) request(ctx context.Context, method, key string, query url.Values, body io.Reader) (*http.Request, error) {
+	u := *s.base
+	if key = strings.TrimPrefix(key, "/"); key != "" || u.Path == "" {
+		u.Path = u.Path + "/" + key
+		u.RawPath = s.base.EscapedPath() + "/" + escapePath(key)
+	}
+	u.RawQuery = canonicalQuery(query)
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	s.sign(req, unsignedPayload, s.now())
+	return req, nil
+}
+
+type errorResult struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// do sends the request and turns the error reply into error.
+func (s *Store) do(req *http.Request) (*http.Response, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound && req.Method != http.MethodPut {
+		return nil, ErrNotFound
+	}
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	var result errorResult
+	if xml.Unmarshal(data, &result) == nil && result.Code != "" {
+		return nil, fmt.Errorf("%s %s err %d %s: %s", req.Method, req.URL.Path, resp.StatusCode, result.Code, result.Message)
+	}
+	return nil, fmt.Errorf("%s %s err %d: %s", req.Method, req.URL.Path, resp.StatusCode, data)
+}
+
+// sign signs the request by AWS signature version 4 with the headers host,
+// range and x-amz-*.
+func (s *Store) sign(req *http.Request, payloadHash string, now time.Time) {
+	region := s.cfg.Region
+	if region == "" {
+		region = defaultRegion
+	}
+	amzDate := now.UTC().Format(amzDateFormat)
+	scope := amzDate[:8] + "/" + region + "/s3/aws4_request"
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, vs := range req.Header {
+		k = strings.ToLower(k)
+		if strings.HasPrefix(k, "x-amz-") || k == "range" || k == "content-md5" {
+			headers[k] = strings.TrimSpace(strings.Join(vs, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	stringToSign := strings.Join([]string{signAlgorithm, amzDate, scope, hashHex(canonicalRequest)}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), amzDate[:8])
+	for _, v := range []string{region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, v)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signAlgorithm, s.cfg.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hashHex(data string) string {
+	h := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(h[:])
+}
+
+// escape encodes s as RFC 3986 which is required by signing, all the bytes
+// except the unreserved characters are encoded.
+func escape(s string, keepSlash bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (keepSlash && c == '/') {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+func escapePath(s string) string {
+	return escape(s, true)
+}
+
+// canonicalQuery encodes the query sorted by key.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vs := append([]string(nil), query[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, escape(k, false)+"="+escape(v, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
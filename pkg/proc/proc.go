@@ -1,26 +1,38 @@
 package proc
 
 import (
+	"bytes"
 	"context"
 	"os/exec"
+	"sync"
+
 	"overlord/pkg/log"
 )
 
+const (
+	maxTailLines = 64
+)
+
 // Proc define process with cancel.
 type Proc struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 	cmd    *exec.Cmd
+	tail   *tailWriter
 }
 
 // NewProc new and return proc with cancel.
 func NewProc(name string, arg ...string) *Proc {
 	ctx, cancel := context.WithCancel(context.Background())
 	cmd := exec.CommandContext(ctx, name, arg...)
+	tail := &tailWriter{}
+	cmd.Stdout = tail
+	cmd.Stderr = tail
 	return &Proc{
 		ctx:    ctx,
 		cancel: cancel,
 		cmd:    cmd,
+		tail:   tail,
 	}
 }
 
@@ -39,3 +51,46 @@ func (p *Proc) Stop() {
 func (p *Proc) Wait() error {
 	return p.cmd.Wait()
 }
+
+// Tail returns the last lines of the stdout and stderr of proc.
+func (p *Proc) Tail() []string {
+	return p.tail.Lines()
+}
+
+// tailWriter keeps only the last maxTailLines lines written into it.
+type tailWriter struct {
+	lock  sync.Mutex
+	lines []string
+	part  []byte
+}
+
+func (t *tailWriter) Write(b []byte) (int, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	data := append(t.part, b...)
+	for {
+		idx := bytes.IndexByte(data, '\n')
+		if idx == -1 {
+			break
+		}
+		t.lines = append(t.lines, string(data[:idx]))
+		data = data[idx+1:]
+	}
+	if len(t.lines) > maxTailLines {
+		t.lines = t.lines[len(t.lines)-maxTailLines:]
+	}
+	t.part = append(t.part[:0:0], data...)
+	return len(b), nil
+}
+
+// Lines returns a copy of the kept lines.
+func (t *tailWriter) Lines() []string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	lines := make([]string, len(t.lines), len(t.lines)+1)
+	copy(lines, t.lines)
+	if len(t.part) > 0 {
+		lines = append(lines, string(t.part))
+	}
+	return lines
+}
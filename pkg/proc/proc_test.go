@@ -0,0 +1,22 @@
+package proc
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTailWriterKeepLastLines(t *testing.T) {
+	tw := &tailWriter{}
+	for i := 0; i < maxTailLines+10; i++ {
+		fmt.Fprintf(tw, "line %d\n", i)
+	}
+	tw.Write([]byte("partial"))
+
+	lines := tw.Lines()
+	assert.Len(t, lines, maxTailLines+1)
+	assert.Equal(t, "line 10", lines[0])
+	assert.Equal(t, fmt.Sprintf("line %d", maxTailLines+9), lines[maxTailLines-1])
+	assert.Equal(t, "partial", lines[maxTailLines])
+}
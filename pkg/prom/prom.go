@@ -2,6 +2,7 @@ package prom
 
 import (
 	"net/http"
+	"net/url"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -11,25 +12,71 @@ const (
 	statConns    = "overlord_proxy_conns"
 	statErr      = "overlord_proxy_err"
 	statVersions = "overlord_proxy_version"
+	statRejected = "overlord_proxy_conn_rejected"
+	statNodePool = "overlord_proxy_node_pool"
+	statRetry    = "overlord_proxy_retry"
+	statHedge    = "overlord_proxy_hedge"
+	statPartial  = "overlord_proxy_partial"
+	statBreaker  = "overlord_proxy_breaker"
+	statInflight = "overlord_proxy_inflight"
+	statShed     = "overlord_proxy_shed"
+	statTimeout  = "overlord_proxy_read_timeout"
 
 	statProxyTimer   = "overlord_proxy_timer"
 	statHandlerTimer = "overlord_proxy_handler_timer"
+	statReqBytes     = "overlord_proxy_request_bytes"
+	statRespBytes    = "overlord_proxy_response_bytes"
+	statBatchSize    = "overlord_proxy_batch_size"
+	statPrefixReqs   = "overlord_proxy_prefix_requests"
+	statPrefixTimer  = "overlord_proxy_prefix_timer"
+	statPrefixHits   = "overlord_proxy_prefix_hits"
+	statMemcache     = "overlord_proxy_memcache_stats"
 )
 
 var (
 	conns        *prometheus.GaugeVec
+	rejected     *prometheus.CounterVec
 	versions     *prometheus.GaugeVec
 	gerr         *prometheus.GaugeVec
+	nodePool     *prometheus.GaugeVec
+	retry        *prometheus.CounterVec
+	hedge        *prometheus.CounterVec
+	partial      *prometheus.CounterVec
+	breaker      *prometheus.GaugeVec
+	inflight     *prometheus.GaugeVec
+	shed         *prometheus.CounterVec
+	readTimeout  *prometheus.GaugeVec
 	proxyTimer   *prometheus.HistogramVec
 	handlerTimer *prometheus.HistogramVec
+	reqBytes     *prometheus.HistogramVec
+	respBytes    *prometheus.HistogramVec
+	batchSize    *prometheus.HistogramVec
+	prefixReqs   *prometheus.CounterVec
+	prefixTimer  *prometheus.HistogramVec
+	prefixHits   *prometheus.CounterVec
+	memcache     *prometheus.CounterVec
 
 	clusterLabels        = []string{"cluster"}
+	clusterReasonLabels  = []string{"cluster", "reason"}
+	clusterStateLabels   = []string{"cluster", "state"}
 	clusterNodeErrLabels = []string{"cluster", "node", "cmd", "error"}
 	clusterCmdLabels     = []string{"cluster", "cmd"}
 	clusterNodeCmdLabels = []string{"cluster", "node", "cmd"}
+	clusterNodeStLabels  = []string{"cluster", "node", "state"}
+	clusterNodeLabels    = []string{"cluster", "node"}
+	clusterNodeStatLabel = []string{"cluster", "node", "stat"}
+	clusterPrefixLabels  = []string{"cluster", "prefix"}
+	clusterPrefixRLabels = []string{"cluster", "prefix", "result"}
 	versionLabels        = []string{"version"}
 	// On Prom switch
 	On = true
+
+	// LatencyBuckets are the buckets of proxy and handler timer in microseconds.
+	LatencyBuckets = []float64{1000, 2000, 4000, 10000}
+	// SizeBuckets are the buckets of request and response bytes.
+	SizeBuckets = []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576}
+	// BatchBuckets are the buckets of keys in one batch command such as MGET.
+	BatchBuckets = []float64{2, 5, 10, 20, 50, 100, 200, 500}
 )
 
 // Init init prometheus.
@@ -40,6 +87,12 @@ func Init() {
 			Help: statConns,
 		}, clusterLabels)
 	prometheus.MustRegister(conns)
+	rejected = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: statRejected,
+			Help: statRejected,
+		}, clusterReasonLabels)
+	prometheus.MustRegister(rejected)
 	versions = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: statVersions,
@@ -52,11 +105,59 @@ func Init() {
 			Help: statErr,
 		}, clusterNodeErrLabels)
 	prometheus.MustRegister(gerr)
+	nodePool = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: statNodePool,
+			Help: statNodePool,
+		}, clusterNodeStLabels)
+	prometheus.MustRegister(nodePool)
+	retry = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: statRetry,
+			Help: statRetry,
+		}, clusterNodeLabels)
+	prometheus.MustRegister(retry)
+	hedge = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: statHedge,
+			Help: statHedge,
+		}, clusterLabels)
+	prometheus.MustRegister(hedge)
+	partial = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: statPartial,
+			Help: statPartial,
+		}, clusterNodeLabels)
+	prometheus.MustRegister(partial)
+	breaker = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: statBreaker,
+			Help: statBreaker,
+		}, clusterNodeStLabels)
+	prometheus.MustRegister(breaker)
+	inflight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: statInflight,
+			Help: statInflight,
+		}, clusterStateLabels)
+	prometheus.MustRegister(inflight)
+	shed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: statShed,
+			Help: statShed,
+		}, clusterLabels)
+	prometheus.MustRegister(shed)
+	readTimeout = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: statTimeout,
+			Help: statTimeout,
+		}, clusterNodeLabels)
+	prometheus.MustRegister(readTimeout)
 	proxyTimer = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    statProxyTimer,
 			Help:    statProxyTimer,
-			Buckets: []float64{1000, 2000, 4000, 10000},
+			Buckets: LatencyBuckets,
 		}, clusterCmdLabels)
 
 	prometheus.MustRegister(proxyTimer)
@@ -64,14 +165,64 @@ func Init() {
 		prometheus.HistogramOpts{
 			Name:    statHandlerTimer,
 			Help:    statHandlerTimer,
-			Buckets: []float64{1000, 2000, 4000, 10000},
+			Buckets: LatencyBuckets,
 		}, clusterNodeCmdLabels)
 	prometheus.MustRegister(handlerTimer)
+	reqBytes = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    statReqBytes,
+			Help:    statReqBytes,
+			Buckets: SizeBuckets,
+		}, clusterLabels)
+	prometheus.MustRegister(reqBytes)
+	respBytes = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    statRespBytes,
+			Help:    statRespBytes,
+			Buckets: SizeBuckets,
+		}, clusterLabels)
+	prometheus.MustRegister(respBytes)
+	batchSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    statBatchSize,
+			Help:    statBatchSize,
+			Buckets: BatchBuckets,
+		}, clusterLabels)
+	prometheus.MustRegister(batchSize)
+	prefixReqs = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: statPrefixReqs,
+			Help: statPrefixReqs,
+		}, clusterPrefixLabels)
+	prometheus.MustRegister(prefixReqs)
+	prefixTimer = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    statPrefixTimer,
+			Help:    statPrefixTimer,
+			Buckets: LatencyBuckets,
+		}, clusterPrefixLabels)
+	prometheus.MustRegister(prefixTimer)
+	prefixHits = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: statPrefixHits,
+			Help: statPrefixHits,
+		}, clusterPrefixRLabels)
+	prometheus.MustRegister(prefixHits)
+	memcache = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: statMemcache,
+			Help: statMemcache,
+		}, clusterNodeStatLabel)
+	prometheus.MustRegister(memcache)
 	// metrics
 	metrics()
 }
 
+// metrics registers /metrics into http.DefaultServeMux if not present.
 func metrics() {
+	if _, pattern := http.DefaultServeMux.Handler(&http.Request{URL: &url.URL{Path: "/metrics"}}); pattern == "/metrics" {
+		return
+	}
 	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
 		h := promhttp.Handler()
 		h.ServeHTTP(w, r)
@@ -105,6 +256,15 @@ func ErrIncr(cluster, node, cmd, err string) {
 	gerr.WithLabelValues(cluster, node, cmd, err).Inc()
 }
 
+// ErrAdd adds n to one stat error counter.
+func ErrAdd(cluster, node, cmd, err string, n int) {
+	if gerr == nil {
+		return
+	}
+	cmd = ""
+	gerr.WithLabelValues(cluster, node, cmd, err).Add(float64(n))
+}
+
 // VersionState set current versioin state.
 func VersionState(version string) {
 	if versions == nil {
@@ -128,3 +288,128 @@ func ConnDecr(cluster string) {
 	}
 	conns.WithLabelValues(cluster).Dec()
 }
+
+// ConnRejectIncr increments one stat rejected conn counter.
+func ConnRejectIncr(cluster, reason string) {
+	if rejected == nil {
+		return
+	}
+	rejected.WithLabelValues(cluster, reason).Inc()
+}
+
+// NodePool set the occupancy of node conns pool.
+func NodePool(cluster, node string, conns, busy, queued int32) {
+	if nodePool == nil {
+		return
+	}
+	nodePool.WithLabelValues(cluster, node, "conns").Set(float64(conns))
+	nodePool.WithLabelValues(cluster, node, "busy").Set(float64(busy))
+	nodePool.WithLabelValues(cluster, node, "queued").Set(float64(queued))
+}
+
+// RetryIncr increments one stat retry counter of the failed node.
+func RetryIncr(cluster, node string) {
+	if retry == nil {
+		return
+	}
+	retry.WithLabelValues(cluster, node).Inc()
+}
+
+// HedgeAdd adds the stat hedge counter by n reads hedged.
+func HedgeAdd(cluster string, n int) {
+	if hedge == nil {
+		return
+	}
+	hedge.WithLabelValues(cluster).Add(float64(n))
+}
+
+// PartialIncr increments one stat partial counter of the failed node
+// whose keys are answered as empty.
+func PartialIncr(cluster, node string) {
+	if partial == nil {
+		return
+	}
+	partial.WithLabelValues(cluster, node).Inc()
+}
+
+// BreakerState sets the stat breaker gauge of node, which is 1 for the
+// current state and 0 for the others.
+func BreakerState(cluster, node, state string) {
+	if breaker == nil {
+		return
+	}
+	for _, st := range []string{"closed", "open", "half_open"} {
+		v := 0.0
+		if st == state {
+			v = 1
+		}
+		breaker.WithLabelValues(cluster, node, st).Set(v)
+	}
+}
+
+// Inflight sets the stat inflight gauge of the requests in flight and
+// queued of cluster.
+func Inflight(cluster string, inflights, queued int) {
+	if inflight == nil {
+		return
+	}
+	inflight.WithLabelValues(cluster, "inflight").Set(float64(inflights))
+	inflight.WithLabelValues(cluster, "queued").Set(float64(queued))
+}
+
+// ShedAdd adds the stat shed counter by n requests shed.
+func ShedAdd(cluster string, n int) {
+	if shed == nil {
+		return
+	}
+	shed.WithLabelValues(cluster).Add(float64(n))
+}
+
+// ReadTimeout sets the stat read timeout gauge of node in milliseconds.
+func ReadTimeout(cluster, node string, ms int64) {
+	if readTimeout == nil {
+		return
+	}
+	readTimeout.WithLabelValues(cluster, node).Set(float64(ms))
+}
+
+// Size log the bytes of request and response.
+func Size(cluster string, req, resp int) {
+	if reqBytes == nil || respBytes == nil {
+		return
+	}
+	reqBytes.WithLabelValues(cluster).Observe(float64(req))
+	respBytes.WithLabelValues(cluster).Observe(float64(resp))
+}
+
+// BatchSize log the number of keys in one batch command.
+func BatchSize(cluster string, n int) {
+	if batchSize == nil {
+		return
+	}
+	batchSize.WithLabelValues(cluster).Observe(float64(n))
+}
+
+// PrefixStat log one request of key prefix with timing (in microseconds)
+// and the keys hit or missed.
+func PrefixStat(cluster, prefix string, ts int64, hits, misses int) {
+	if prefixReqs == nil {
+		return
+	}
+	prefixReqs.WithLabelValues(cluster, prefix).Inc()
+	prefixTimer.WithLabelValues(cluster, prefix).Observe(float64(ts))
+	if hits > 0 {
+		prefixHits.WithLabelValues(cluster, prefix, "hit").Add(float64(hits))
+	}
+	if misses > 0 {
+		prefixHits.WithLabelValues(cluster, prefix, "miss").Add(float64(misses))
+	}
+}
+
+// MemcacheStatIncr increments one memcache stat counter of node such as get_hits.
+func MemcacheStatIncr(cluster, node, stat string) {
+	if memcache == nil {
+		return
+	}
+	memcache.WithLabelValues(cluster, node, stat).Inc()
+}
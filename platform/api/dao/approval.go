@@ -0,0 +1,120 @@
+package dao
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"overlord/pkg/etcd"
+	"overlord/pkg/log"
+	"overlord/platform/api/model"
+	"overlord/platform/job"
+
+	"go.etcd.io/etcd/client"
+)
+
+// saveApproval saves the job waiting for approval out of the jobs dir, so
+// that it's never executed by scheduler until approved.
+func (d *Dao) saveApproval(ctx context.Context, t *job.Job, val string) (string, error) {
+	jobID, err := d.e.GenID(ctx, fmt.Sprintf("%s/%s/", etcd.ApprovalDir, t.Group), val)
+	if err != nil {
+		return "", err
+	}
+	if err = d.e.SetJobState(ctx, t.Group, jobID, job.StateWaitApprove); err != nil {
+		return "", err
+	}
+	_ = d.e.AppendJobLog(ctx, t.Group, jobID, "apiserver", fmt.Sprintf("job %s created, wait for approval", t.OpType))
+	d.notify(ctx, t.Group, jobID, job.StateWaitApprove, t)
+	return fmt.Sprintf("%s.%s", t.Group, jobID), nil
+}
+
+// ApproveJob approves the job waiting for approval, and then the job is
+// moved into the jobs dir and executed by scheduler.
+func (d *Dao) ApproveJob(ctx context.Context, jobID string, p *model.ParamApprove) error {
+	group, id, t, err := d.decide(ctx, jobID, job.StateApproved, p)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	if err = d.e.Set(ctx, fmt.Sprintf("%s/%s/%s", etcd.JobsDir, group, id), string(data)); err != nil {
+		return err
+	}
+	if err = d.e.Delete(ctx, fmt.Sprintf("%s/%s/%s", etcd.ApprovalDir, group, id)); err != nil {
+		log.Warnf("delete approval of job %s err %v", jobID, err)
+	}
+	return nil
+}
+
+// RejectJob rejects the job waiting for approval, which is kept as
+// rejected and never executed.
+func (d *Dao) RejectJob(ctx context.Context, jobID string, p *model.ParamApprove) error {
+	_, _, _, err := d.decide(ctx, jobID, job.StateRejected, p)
+	return err
+}
+
+// decide changes the state of the job waiting for approval into state,
+// the user who decides is appended into the users of job.
+func (d *Dao) decide(ctx context.Context, jobID, state string, p *model.ParamApprove) (group, id string, t *job.Job, err error) {
+	group, id = splitJobID(jobID)
+	if group == "" {
+		err = model.ErrNotFound
+		return
+	}
+	key := fmt.Sprintf("%s/%s/%s", etcd.ApprovalDir, group, id)
+	val, err := d.e.Get(ctx, key)
+	if client.IsKeyNotFound(err) {
+		err = model.ErrNotFound
+		return
+	} else if err != nil {
+		return
+	}
+	t = new(job.Job)
+	if err = json.Unmarshal([]byte(val), t); err != nil {
+		return
+	}
+	err = d.e.Cas(ctx, fmt.Sprintf("%s/%s/%s/state", etcd.JobDetailDir, group, id), job.StateWaitApprove, state)
+	if client.IsKeyNotFound(err) {
+		err = model.ErrNotFound
+		return
+	} else if e, ok := err.(client.Error); ok && e.Code == client.ErrorCodeTestFailed {
+		// NOTE: the job is decided already.
+		err = model.ErrConflict
+		return
+	} else if err != nil {
+		return
+	}
+	if p.User != "" {
+		t.Users = append(t.Users, p.User)
+	}
+	msg := fmt.Sprintf("job %s %s", t.OpType, state)
+	if p.User != "" {
+		msg += " by " + p.User
+	}
+	if p.Reason != "" {
+		msg += ": " + p.Reason
+	}
+	_ = d.e.AppendJobLog(ctx, group, id, "apiserver", msg)
+	d.notify(ctx, group, id, state, t)
+	return
+}
+
+func (d *Dao) notify(ctx context.Context, group, id, state string, t *job.Job) {
+	if d.hook == nil {
+		return
+	}
+	if err := d.hook.Notify(ctx, group+"."+id, state, t); err != nil {
+		log.Warnf("notify job %s.%s %s err %v", group, id, state, err)
+	}
+}
+
+// splitJobID splits the job id as group.id or group/id.
+func splitJobID(jobID string) (group, id string) {
+	if idx := strings.LastIndexAny(jobID, "./"); idx > 0 {
+		return jobID[:idx], jobID[idx+1:]
+	}
+	return "", jobID
+}
@@ -0,0 +1,107 @@
+package dao
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"overlord/pkg/etcd"
+	"overlord/pkg/log"
+	"overlord/platform/api/model"
+
+	"go.etcd.io/etcd/client"
+)
+
+// auditFile appends the audit logs into the file as json lines.
+type auditFile struct {
+	lock sync.Mutex
+	path string
+	f    *os.File
+}
+
+func openAuditFile(path string) (*auditFile, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return nil, err
+	}
+	return &auditFile{path: path, f: f}, nil
+}
+
+func (af *auditFile) append(data []byte) error {
+	af.lock.Lock()
+	defer af.lock.Unlock()
+	_, err := af.f.Write(append(data, '\n'))
+	return err
+}
+
+func (af *auditFile) read() (logs []*model.AuditLog, err error) {
+	f, err := os.Open(af.path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		al := new(model.AuditLog)
+		if err = json.Unmarshal(sc.Bytes(), al); err != nil {
+			log.Warnf("skip bad audit log %s due %s", sc.Text(), err)
+			continue
+		}
+		logs = append(logs, al)
+	}
+	return logs, sc.Err()
+}
+
+// Audit appends the audit log into the file or etcd, which is never
+// changed or deleted by apiserver.
+func (d *Dao) Audit(ctx context.Context, al *model.AuditLog) error {
+	data, err := json.Marshal(al)
+	if err != nil {
+		return err
+	}
+	if d.af != nil {
+		return d.af.append(data)
+	}
+	_, err = d.e.GenID(ctx, etcd.AuditDir, string(data))
+	return err
+}
+
+// AuditLogs gets the latest limit audit logs of user in time order, all the
+// users if user is empty.
+func (d *Dao) AuditLogs(ctx context.Context, user string, limit int) ([]*model.AuditLog, error) {
+	var logs []*model.AuditLog
+	if d.af != nil {
+		var err error
+		if logs, err = d.af.read(); err != nil {
+			return nil, err
+		}
+	} else {
+		nodes, err := d.e.LS(ctx, etcd.AuditDir)
+		if client.IsKeyNotFound(err) {
+			return []*model.AuditLog{}, nil
+		} else if err != nil {
+			return nil, err
+		}
+		for _, node := range nodes {
+			al := new(model.AuditLog)
+			if err = json.Unmarshal([]byte(node.Value), al); err != nil {
+				log.Warnf("skip bad audit log %s due %s", node.Key, err)
+				continue
+			}
+			logs = append(logs, al)
+		}
+	}
+	filtered := make([]*model.AuditLog, 0, len(logs))
+	for _, al := range logs {
+		if user == "" || al.User == user {
+			filtered = append(filtered, al)
+		}
+	}
+	if limit > 0 && len(filtered) > limit {
+		filtered = filtered[len(filtered)-limit:]
+	}
+	return filtered, nil
+}
@@ -0,0 +1,187 @@
+package dao
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"overlord/pkg/log"
+	"overlord/pkg/objstore"
+	"overlord/pkg/types"
+	"overlord/platform/api/model"
+	"overlord/platform/chunk"
+	"overlord/platform/job"
+	"overlord/platform/job/backup"
+	"overlord/platform/job/create"
+	"overlord/platform/job/upgrade"
+)
+
+// GetBackups lists the backup sets of cluster, the latest first.
+func (d *Dao) GetBackups(ctx context.Context, cname string) ([]*backup.Set, error) {
+	if d.b == nil {
+		return nil, ErrBackupNotConfigured
+	}
+	return d.b.Sets(ctx, cname)
+}
+
+// BackupCluster creates the backup job of cluster, which is run by apiserver
+// in background.
+func (d *Dao) BackupCluster(ctx context.Context, cname string) (string, error) {
+	t, err := d.backupCacheInfo(ctx, cname)
+	if err != nil {
+		return "", err
+	}
+	j := &job.Job{
+		OpType:    job.OpBackup,
+		Name:      cname,
+		Group:     t.Group,
+		CacheType: t.CacheType,
+		Version:   t.Version,
+	}
+	jobID, err := d.saveJob(ctx, j)
+	if err != nil {
+		return "", err
+	}
+	j.ID = strings.TrimPrefix(jobID, j.Group+".")
+	go d.runJob(j, func(ctx context.Context) error {
+		return d.backup(ctx, j, t)
+	})
+	return jobID, nil
+}
+
+// RestoreCluster creates the restore job of cluster from the backup set,
+// which is run by apiserver in background.
+func (d *Dao) RestoreCluster(ctx context.Context, cname string, p *model.ParamRestore) (string, error) {
+	t, err := d.backupCacheInfo(ctx, cname)
+	if err != nil {
+		return "", err
+	}
+	from := p.From
+	if from == "" {
+		from = cname
+	}
+	set, err := d.b.Get(ctx, from, p.Backup)
+	if err == objstore.ErrNotFound {
+		return "", model.ErrNotFound
+	} else if err != nil {
+		return "", err
+	}
+	j := &job.Job{
+		OpType:    job.OpRestore,
+		Name:      cname,
+		Group:     t.Group,
+		CacheType: t.CacheType,
+		Version:   t.Version,
+		Params: map[string]string{
+			job.ParamBackup:     p.Backup,
+			job.ParamBackupFrom: from,
+		},
+	}
+	jobID, err := d.saveJob(ctx, j)
+	if err != nil {
+		return "", err
+	}
+	j.ID = strings.TrimPrefix(jobID, j.Group+".")
+	go d.runJob(j, func(ctx context.Context) error {
+		d.jobLog(ctx, j, "restore %s from backup %s of %s with %d rdb", cname, set.ID, set.Cluster, len(set.Nodes))
+		return d.b.Restore(ctx, set, t.CacheType, backupNodes(t), func(format string, args ...interface{}) {
+			d.jobLog(ctx, j, format, args...)
+		})
+	})
+	return jobID, nil
+}
+
+func (d *Dao) backupCacheInfo(ctx context.Context, cname string) (*create.CacheInfo, error) {
+	if d.b == nil {
+		return nil, ErrBackupNotConfigured
+	}
+	info, err := d.e.ClusterInfo(ctx, cname)
+	if err != nil {
+		return nil, err
+	}
+	t := new(create.CacheInfo)
+	if err = json.Unmarshal([]byte(info), t); err != nil {
+		return nil, err
+	}
+	if t.CacheType == types.CacheTypeMemcache {
+		return nil, ErrBackupNotSupport
+	}
+	return t, nil
+}
+
+// backup saves the rdb of the masters of redis cluster or all the redis
+// instances, and then expires the old backup sets.
+func (d *Dao) backup(ctx context.Context, j *job.Job, t *create.CacheInfo) error {
+	nodes := backupNodes(t)
+	if t.CacheType == types.CacheTypeRedisCluster {
+		addrs := make([]string, 0, len(nodes))
+		for _, n := range nodes {
+			addrs = append(addrs, n.Addr)
+		}
+		roles, err := upgrade.Roles(addrs)
+		if err != nil {
+			return err
+		}
+		nodes = nodes[:0]
+		for _, r := range roles {
+			if r.Role == chunk.RoleMaster {
+				nodes = append(nodes, &backup.Node{Addr: r.Addr})
+			}
+		}
+	}
+	set := backup.NewSet(t.Name, t.CacheType, t.Version, nodes, time.Now())
+	d.jobLog(ctx, j, "backup %d instances of %s as %s", len(nodes), t.Name, set.ID)
+	err := d.b.Backup(ctx, set, func(format string, args ...interface{}) {
+		d.jobLog(ctx, j, format, args...)
+	})
+	if err != nil {
+		return err
+	}
+	expired, err := d.b.Expire(ctx, t.Name, time.Now())
+	if err != nil {
+		d.jobLog(ctx, j, "expire old backups fail: %v", err)
+		return nil
+	}
+	for _, s := range expired {
+		d.jobLog(ctx, j, "backup %s expired and deleted", s.ID)
+	}
+	return nil
+}
+
+// backupNodes returns all the instances of cluster.
+func backupNodes(t *create.CacheInfo) (nodes []*backup.Node) {
+	if t.CacheType == types.CacheTypeRedisCluster {
+		for _, ck := range t.Chunks {
+			for _, n := range ck.Nodes {
+				nodes = append(nodes, &backup.Node{Addr: n.Addr()})
+			}
+		}
+		return
+	}
+	for _, addr := range t.Dist.Addrs {
+		nodes = append(nodes, &backup.Node{Addr: addr.String(), Alias: addr.ID})
+	}
+	return
+}
+
+// runJob runs the job in apiserver and sets the job state by the result.
+func (d *Dao) runJob(j *job.Job, run func(ctx context.Context) error) {
+	ctx := context.Background()
+	d.SetJobState(ctx, j.Group, j.ID, job.StateRunning)
+	if err := run(ctx); err != nil {
+		log.Errorf("%s cluster %s err %v", j.OpType, j.Name, err)
+		d.jobLog(ctx, j, "%s %s fail: %v", j.OpType, j.Name, err)
+		d.SetJobState(ctx, j.Group, j.ID, job.StateFail)
+		return
+	}
+	d.jobLog(ctx, j, "%s %s done", j.OpType, j.Name)
+	d.SetJobState(ctx, j.Group, j.ID, job.StateDone)
+}
+
+func (d *Dao) jobLog(ctx context.Context, j *job.Job, format string, args ...interface{}) {
+	if err := d.e.AppendJobLog(ctx, j.Group, j.ID, "apiserver", fmt.Sprintf(format, args...)); err != nil {
+		log.Warnf("append job log of %s err %v", j.ID, err)
+	}
+}
@@ -0,0 +1,71 @@
+package dao
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"overlord/pkg/types"
+	"overlord/platform/api/model"
+	"overlord/platform/job"
+	"overlord/platform/job/balance"
+)
+
+// BalanceCluster plans the slots balancing of redis cluster by the memory of
+// masters. The plan is returned if dry run, or the balance job which
+// migrates the slots is created and run by apiserver in background.
+func (d *Dao) BalanceCluster(ctx context.Context, cname string, p *model.ParamBalance) (string, *balance.Report, error) {
+	t, err := d.cacheInfo(ctx, cname)
+	if err != nil {
+		return "", nil, err
+	}
+	if t.CacheType != types.CacheTypeRedisCluster {
+		return "", nil, ErrBalanceNotSupport
+	}
+	addrs := clusterAddrs(t)
+	if p.DryRun {
+		loads, err := balance.LoadMasters(addrs, func(format string, args ...interface{}) {})
+		if err != nil {
+			return "", nil, err
+		}
+		return "", balance.PlanSlots(loads, p.Tolerance), nil
+	}
+
+	th := &balance.Throttle{KeysPerBatch: p.KeysPerBatch, Pause: balance.DefaultBatchPause}
+	if p.BatchPause > 0 {
+		th.Pause = time.Duration(p.BatchPause) * time.Millisecond
+	}
+	j := &job.Job{
+		OpType:    job.OpBalance,
+		Name:      cname,
+		Group:     t.Group,
+		CacheType: t.CacheType,
+		Version:   t.Version,
+		Params: map[string]string{
+			job.ParamKeysPerBatch: strconv.Itoa(p.KeysPerBatch),
+			job.ParamBatchPause:   strconv.FormatInt(int64(th.Pause/time.Millisecond), 10),
+		},
+	}
+	jobID, err := d.saveJob(ctx, j)
+	if err != nil {
+		return "", nil, err
+	}
+	j.ID = strings.TrimPrefix(jobID, j.Group+".")
+	go d.runJob(j, func(ctx context.Context) error {
+		logf := func(format string, args ...interface{}) {
+			d.jobLog(ctx, j, format, args...)
+		}
+		loads, err := balance.LoadMasters(addrs, logf)
+		if err != nil {
+			return err
+		}
+		r := balance.PlanSlots(loads, p.Tolerance)
+		for _, l := range r.Masters {
+			logf("master %s with %d slots %d keys %d bytes, %d bytes after balanced", l.Addr, l.Slots, l.Keys, l.Memory, l.After)
+		}
+		logf("balance %s by moving %d slots", cname, len(r.Moves))
+		return balance.MigrateSlots(ctx, r, th, logf)
+	})
+	return jobID, nil, nil
+}
@@ -0,0 +1,36 @@
+package dao
+
+import (
+	"context"
+	"math"
+
+	"overlord/platform/api/model"
+)
+
+// GetSchedulableCapacity gets the schedulable capacity of all the agents,
+// and counts how many instances of spec can be placed if spec given.
+func (d *Dao) GetSchedulableCapacity(ctx context.Context, spec string) (*model.SchedulableCapacity, error) {
+	var cpu, mem float64
+	if spec != "" {
+		var err error
+		if cpu, mem, err = d.parseSpecification(spec); err != nil {
+			return nil, err
+		}
+	}
+	cs, err := d.e.Capacities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sc := &model.SchedulableCapacity{Agents: make([]*model.AgentCapacity, 0, len(cs))}
+	for _, c := range cs {
+		ac := &model.AgentCapacity{Capacity: c}
+		if spec != "" {
+			ac.Instances = int(math.Min(math.Min(c.CPU/cpu, c.Memory/mem), float64(c.Ports)))
+			sc.Instances += ac.Instances
+		}
+		sc.CPU += c.CPU
+		sc.Memory += c.Memory
+		sc.Agents = append(sc.Agents, ac)
+	}
+	return sc, nil
+}
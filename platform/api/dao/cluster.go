@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	"overlord/pkg/etcd"
+	"overlord/pkg/hashkit"
 	"overlord/pkg/log"
 	"overlord/pkg/types"
 	"overlord/platform/api/model"
@@ -30,7 +31,7 @@ func (d *Dao) ScaleCluster(ctx context.Context, p *model.ParamScale) (jobID stri
 	defer cancel()
 	var (
 		val  string
-		info *create.CacheInfo
+		info = new(create.CacheInfo)
 	)
 
 	val, err = d.e.Get(sub, fmt.Sprintf("%s/%s/info", etcd.ClusterDir, p.Name))
@@ -44,10 +45,18 @@ func (d *Dao) ScaleCluster(ctx context.Context, p *model.ParamScale) (jobID stri
 		return
 	}
 
+	// NOTE: the job is dispatched by the cache type into the role of group,
+	// so it must be filled with the cluster info.
 	j := &job.Job{
-		Name:   p.Name,
-		Num:    p.Number,
-		OpType: job.OpScale,
+		Name:      p.Name,
+		Num:       p.Number,
+		OpType:    job.OpScale,
+		Group:     info.Group,
+		CacheType: info.CacheType,
+		Version:   info.Version,
+		Image:     info.Image,
+		CPU:       info.CPU,
+		MaxMem:    info.MaxMemory,
 	}
 	return d.saveJob(sub, j)
 }
@@ -101,6 +110,11 @@ func (d *Dao) getClusterInstances(ctx context.Context, info *create.CacheInfo, s
 			continue
 		}
 		inst.State = state
+		restarts, err := d.e.Get(ctx, fmt.Sprintf("%s/%s/restarts", etcd.InstanceDirPrefix, node.Value))
+		if err != nil && !client.IsKeyNotFound(err) {
+			return nil, err
+		}
+		inst.Restarts, _ = strconv.Atoi(restarts)
 		instances = append(instances, inst)
 	}
 	return instances, nil
@@ -141,6 +155,35 @@ func (d *Dao) fillDefaultClusterConfig(cluster *model.Cluster) {
 	cluster.PingAutoEject = d.c.PingAutoEject
 }
 
+// proxyConf builds the proxy config of the cluster of ctype from the
+// cluster config, memcache and redis are sharded by ketama.
+func (d *Dao) proxyConf(ctype types.CacheType) *etcd.ProxyConf {
+	pc := &etcd.ProxyConf{}
+	if d.c != nil {
+		pc.HashMethod = d.c.HashMethod
+		pc.HashDistribution = d.c.HashDistribution
+		pc.HashTag = d.c.HashTag
+		pc.DialTimeout = d.c.DialTimeout
+		pc.ReadTimeout = d.c.ReadTimeout
+		pc.WriteTimeout = d.c.WriteTimeout
+		pc.NodeConnections = int32(d.c.NodeConns)
+		pc.PingFailLimit = d.c.PingFailLimit
+		pc.PingAutoEject = &d.c.PingAutoEject
+	}
+	if ctype == types.CacheTypeRedisCluster {
+		// NOTE: redis cluster is sharded by slots.
+		pc.HashMethod, pc.HashDistribution = "", ""
+		return pc
+	}
+	if pc.HashMethod == "" {
+		pc.HashMethod = hashkit.HashMethodFnv1a64
+	}
+	if pc.HashDistribution == "" {
+		pc.HashDistribution = hashkit.DistributionKetama
+	}
+	return pc
+}
+
 // GetCluster will search clusters by given cluster name
 func (d *Dao) GetCluster(ctx context.Context, cname string) (*model.Cluster, error) {
 	sub, cancel := context.WithCancel(ctx)
@@ -327,6 +370,11 @@ func (d *Dao) CreateCluster(ctx context.Context, p *model.ParamCluster) (string,
 		log.Errorf("fail to set front-end port due to %s", err)
 		return "", err
 	}
+	err = d.e.SetProxyConf(subctx, p.Name, d.proxyConf(ctype))
+	if err != nil {
+		log.Errorf("fail to set proxy config due to %s", err)
+		return "", err
+	}
 
 	t, err := d.createCreateClusterJob(p)
 	if err != nil {
@@ -377,6 +425,10 @@ func (d *Dao) mapCacheType(cacheType string) (types.CacheType, error) {
 
 func (d *Dao) parseSpecification(spec string) (cpu float64, maxMem float64, err error) {
 	ssp := strings.SplitN(spec, "c", 2)
+	if len(ssp) != 2 {
+		err = model.ErrBadSpec
+		return
+	}
 	cpu, err = strconv.ParseFloat(ssp[0], 64)
 	if err != nil {
 		return
@@ -387,6 +439,9 @@ func (d *Dao) parseSpecification(spec string) (cpu float64, maxMem float64, err
 		maxMem, err = strconv.ParseFloat(strings.TrimRight(ssp[1], "g"), 64)
 		maxMem = maxMem * 1024.0
 	}
+	if err == nil && (cpu <= 0 || maxMem <= 0) {
+		err = model.ErrBadSpec
+	}
 	return
 }
 
@@ -409,6 +464,17 @@ func (d *Dao) createCreateClusterJob(p *model.ParamCluster) (*job.Job, error) {
 	t.MaxMem = p.SpecMemory
 	t.CPU = p.SpecCPU
 
+	t.Params = make(map[string]string, len(p.Attributes)+2)
+	for name, val := range p.Attributes {
+		t.Params[job.ParamAttrPrefix+name] = val
+	}
+	if p.AntiAffinity != "" {
+		t.Params[job.ParamAntiAffinity] = p.AntiAffinity
+	}
+	if p.MasterSpread != "" {
+		t.Params[job.ParamMasterSpread] = p.MasterSpread
+	}
+
 	return t, nil
 }
 
@@ -421,6 +487,9 @@ func (d *Dao) saveJob(ctx context.Context, t *job.Job) (string, error) {
 		return "", err
 	}
 
+	if d.hook != nil && d.hook.NeedApprove(t) {
+		return d.saveApproval(ctx, t, sb.String())
+	}
 	jobID, err := d.e.GenID(ctx, fmt.Sprintf("%s/%s/", etcd.JobsDir, t.Group), sb.String())
 	if err != nil {
 		return "", err
@@ -430,6 +499,7 @@ func (d *Dao) saveJob(ctx context.Context, t *job.Job) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	_ = d.e.AppendJobLog(ctx, t.Group, jobID, "apiserver", fmt.Sprintf("job %s created", t.OpType))
 
 	return fmt.Sprintf("%s.%s", t.Group, jobID), nil
 }
@@ -470,6 +540,42 @@ func (d *Dao) assignAppids(ctx context.Context, cluster string, appids ...string
 	return
 }
 
+// UpgradeCluster will create the rolling upgrade job of the given cluster.
+func (d *Dao) UpgradeCluster(ctx context.Context, cname string, p *model.ParamUpgrade) (string, error) {
+	sub, cancel := context.WithCancel(ctx)
+	defer cancel()
+	info, err := d.e.ClusterInfo(sub, cname)
+	if err != nil {
+		return "", err
+	}
+	t := new(create.CacheInfo)
+	if err = json.Unmarshal([]byte(info), t); err != nil {
+		return "", err
+	}
+	if t.Version == p.Version {
+		return "", ErrSameVersion
+	}
+	if !d.supportVersion(string(t.CacheType), p.Version) {
+		return "", ErrVersionNotSupport
+	}
+	j := &job.Job{
+		OpType:    job.OpUpgrade,
+		Name:      cname,
+		Group:     t.Group,
+		CacheType: t.CacheType,
+		Version:   p.Version,
+		Image:     t.Image,
+		Params:    make(map[string]string),
+	}
+	if p.Batch > 0 {
+		j.Params[job.ParamBatch] = strconv.Itoa(p.Batch)
+	}
+	if p.HealthTimeout > 0 {
+		j.Params[job.ParamHealthTimeout] = strconv.Itoa(p.HealthTimeout)
+	}
+	return d.saveJob(sub, j)
+}
+
 // createDestroyClusterJob will create remove cluster job.
 func (d *Dao) createDestroyClusterJob(ctx context.Context, cname string) (j *job.Job, err error) {
 	var info string
@@ -493,6 +599,20 @@ func (d *Dao) createDestroyClusterJob(ctx context.Context, cname string) (j *job
 	return
 }
 
+func (d *Dao) supportVersion(ctype, version string) bool {
+	for _, v := range d.vs {
+		if v.CacheType != ctype {
+			continue
+		}
+		for _, ver := range v.Versions {
+			if ver == version {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (d *Dao) getClusterImage(ctype string) string {
 	for _, v := range d.vs {
 		if v.CacheType == ctype {
@@ -2,7 +2,10 @@ package dao
 
 import (
 	"overlord/pkg/etcd"
+	"overlord/pkg/log"
 	"overlord/platform/api/model"
+	"overlord/platform/job"
+	"overlord/platform/job/backup"
 )
 
 // New create new dao layer
@@ -13,6 +16,19 @@ func New(cfg *model.ServerConfig) *Dao {
 	}
 
 	d := &Dao{e: e, m: cfg.Monitor, c: cfg.Cluster, vs: cfg.Versions}
+	if cfg.Backup != nil {
+		if d.b, err = backup.New(cfg.Backup); err != nil {
+			log.Errorf("backup is disabled due to invalid config %v", err)
+		}
+	}
+	if cfg.Approval != nil {
+		d.hook = job.NewApprovalHook(cfg.Approval)
+	}
+	if cfg.Audit != nil && cfg.Audit.File != "" {
+		if d.af, err = openAuditFile(cfg.Audit.File); err != nil {
+			panic(err)
+		}
+	}
 	return d
 }
 
@@ -22,6 +38,12 @@ type Dao struct {
 	m  *model.MonitorConfig
 	c  *model.DefaultClusterConfig
 	vs []*model.VersionConfig
+	// b is nil if backup is disabled.
+	b *backup.Backuper
+	// hook is nil if no job needs approval.
+	hook job.Hook
+	// af is nil if audit logs are appended into etcd.
+	af *auditFile
 }
 
 func (d *Dao) ETCD() *etcd.Etcd {
@@ -6,4 +6,10 @@ import "errors"
 var (
 	ErrMasterNumMustBeEven = errors.New("master number must be even")
 	ErrCacheTypeNotSupport = errors.New("cache type only support memcache|redis|redis_cluster")
+	ErrVersionNotSupport   = errors.New("version is not configured for the cache type")
+	ErrSameVersion         = errors.New("cluster is already running the version")
+	ErrBackupNotConfigured = errors.New("backup storage is not configured")
+	ErrBackupNotSupport    = errors.New("backup only support redis|redis_cluster")
+	ErrFixNotSupport       = errors.New("fix only support redis_cluster")
+	ErrBalanceNotSupport   = errors.New("slots balance only support redis_cluster")
 )
@@ -0,0 +1,67 @@
+package dao
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"overlord/pkg/types"
+	"overlord/platform/job"
+	"overlord/platform/job/create"
+	"overlord/platform/job/fix"
+)
+
+// FixCluster creates the fix job of redis cluster, which repairs the slot
+// coverage and is run by apiserver in background.
+func (d *Dao) FixCluster(ctx context.Context, cname string) (string, error) {
+	t, err := d.cacheInfo(ctx, cname)
+	if err != nil {
+		return "", err
+	}
+	if t.CacheType != types.CacheTypeRedisCluster {
+		return "", ErrFixNotSupport
+	}
+	j := &job.Job{
+		OpType:    job.OpFix,
+		Name:      cname,
+		Group:     t.Group,
+		CacheType: t.CacheType,
+		Version:   t.Version,
+	}
+	jobID, err := d.saveJob(ctx, j)
+	if err != nil {
+		return "", err
+	}
+	j.ID = strings.TrimPrefix(jobID, j.Group+".")
+	addrs := clusterAddrs(t)
+	go d.runJob(j, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, fix.DefaultTimeout)
+		defer cancel()
+		return fix.Fix(ctx, addrs, func(format string, args ...interface{}) {
+			d.jobLog(ctx, j, format, args...)
+		})
+	})
+	return jobID, nil
+}
+
+func (d *Dao) cacheInfo(ctx context.Context, cname string) (*create.CacheInfo, error) {
+	info, err := d.e.ClusterInfo(ctx, cname)
+	if err != nil {
+		return nil, err
+	}
+	t := new(create.CacheInfo)
+	if err = json.Unmarshal([]byte(info), t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// clusterAddrs returns the addrs of all the instances of redis cluster.
+func clusterAddrs(t *create.CacheInfo) (addrs []string) {
+	for _, ck := range t.Chunks {
+		for _, n := range ck.Nodes {
+			addrs = append(addrs, n.Addr())
+		}
+	}
+	return
+}
@@ -9,7 +9,8 @@ import (
 	"overlord/pkg/etcd"
 	"overlord/pkg/log"
 	"overlord/platform/api/model"
-	"overlord/platform/job"
+
+	"go.etcd.io/etcd/client"
 )
 
 // GetJob will get job info from redis or etcd
@@ -21,6 +22,10 @@ func (d *Dao) GetJob(ctx context.Context, jobID string) (*model.Job, error) {
 		return nil, err
 	}
 	param, err := d.e.Get(subctx, fmt.Sprintf("%s/%s", etcd.JobsDir, jobID))
+	if client.IsKeyNotFound(err) {
+		// NOTE: the job waiting for approval or rejected.
+		param, err = d.e.Get(subctx, fmt.Sprintf("%s/%s", etcd.ApprovalDir, jobID))
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -29,6 +34,26 @@ func (d *Dao) GetJob(ctx context.Context, jobID string) (*model.Job, error) {
 	return t, nil
 }
 
+// GetJobLogs will get the execution logs of the given job.
+func (d *Dao) GetJobLogs(ctx context.Context, jobID string) ([]*etcd.JobLog, error) {
+	subctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	group, id := filepath.Split(jobID)
+	if group == "" {
+		return nil, model.ErrNotFound
+	}
+	return d.e.JobLogs(subctx, strings.TrimSuffix(group, "/"), id)
+}
+
+// WatchJobEvents watches the state transitions and execution logs of the given job.
+func (d *Dao) WatchJobEvents(ctx context.Context, jobID string) (<-chan *etcd.JobEvent, error) {
+	group, id := filepath.Split(jobID)
+	if group == "" {
+		return nil, model.ErrNotFound
+	}
+	return d.e.WatchJob(ctx, strings.TrimSuffix(group, "/"), id)
+}
+
 // SetJobState update job state.
 func (d *Dao) SetJobState(ctx context.Context, group, jobID, state string) {
 	ctx, cancel := context.WithCancel(ctx)
@@ -42,7 +67,19 @@ func (d *Dao) GetJobs(ctx context.Context) ([]*model.Job, error) {
 	sub, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	nodes, err := d.e.LS(sub, etcd.JobsDir)
+	jobs, err := d.listJobs(sub, etcd.JobsDir)
+	if err != nil {
+		return nil, err
+	}
+	approvals, err := d.listJobs(sub, etcd.ApprovalDir)
+	if err != nil && !client.IsKeyNotFound(err) {
+		return nil, err
+	}
+	return append(jobs, approvals...), nil
+}
+
+func (d *Dao) listJobs(sub context.Context, dir string) ([]*model.Job, error) {
+	nodes, err := d.e.LS(sub, dir)
 	if err != nil {
 		return nil, err
 	}
@@ -73,11 +110,6 @@ func getLastField(etcdKey string) string {
 	return file
 }
 
-// ApproveJob will approve the given job
-func (d *Dao) ApproveJob(ctx context.Context, jobID string) error {
-	return d.e.Cas(ctx, fmt.Sprintf("%s/%s/state", etcd.JobsDir, jobID), job.StateWaitApprove, job.StateApproved)
-}
-
 // WatchJob watch on
 func (d *Dao) WatchJob(ctx context.Context) (j chan *model.Job) {
 	key, _ := d.e.WatchOn(ctx, etcd.JobsDir, etcd.ActionSet, etcd.ActionCreate)
@@ -1,8 +1,12 @@
 package model
 
 import (
+	"crypto/subtle"
 	"fmt"
+
 	"overlord/pkg/log"
+	"overlord/platform/job"
+	"overlord/platform/job/backup"
 )
 
 // ServerConfig is apiserver's config
@@ -13,9 +17,97 @@ type ServerConfig struct {
 	Groups   map[string]string     `toml:"groups"`
 	Monitor  *MonitorConfig        `toml:"monitor"`
 	Cluster  *DefaultClusterConfig `toml:"cluster"`
+	Capacity []*CapacityModel      `toml:"capacity"`
+	// Web is the dir of the built front-end served by apiserver, empty
+	// means the front-end is deployed alone.
+	Web string `toml:"web"`
+	// Backup is the object storage and retention policy of backups, nil
+	// means backup is disabled.
+	Backup *backup.Config `toml:"backup"`
+	// Approval is the op types of jobs waiting for approval before executed,
+	// nil means no approval.
+	Approval *job.ApprovalConfig `toml:"approval"`
+	// Auth is the tokens and roles of users, nil means all the requests are
+	// allowed as anonymous admin.
+	Auth *AuthConfig `toml:"auth"`
+	// Audit is where the mutating requests are recorded, they are appended
+	// into etcd if nil.
+	Audit *AuditConfig `toml:"audit"`
 	*log.Config
 }
 
+// define roles of apiserver users, each role is allowed to do anything the
+// lower roles do.
+const (
+	// RoleViewer only reads the clusters, jobs and so on.
+	RoleViewer = "viewer"
+	// RoleOperator creates and changes the clusters and appids by jobs.
+	RoleOperator = "operator"
+	// RoleAdmin approves or rejects the jobs and reads the audit logs.
+	RoleAdmin = "admin"
+)
+
+var roleLevels = map[string]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// RoleAllowed reports whether role has the privileges of required.
+func RoleAllowed(role, required string) bool {
+	level, ok := roleLevels[role]
+	return ok && level >= roleLevels[required]
+}
+
+// AuthConfig is the authentication of apiserver by bearer tokens.
+type AuthConfig struct {
+	Tokens []*TokenConfig `toml:"tokens"`
+}
+
+// TokenConfig is the user and role authenticated by the token.
+type TokenConfig struct {
+	Token string `toml:"token"`
+	User  string `toml:"user"`
+	Role  string `toml:"role"`
+}
+
+// Validate checks the tokens are unique and the roles are known.
+func (ac *AuthConfig) Validate() error {
+	seen := make(map[string]struct{})
+	for _, tc := range ac.Tokens {
+		if tc.Token == "" || tc.User == "" {
+			return fmt.Errorf("auth token and user must not be empty")
+		}
+		if _, ok := roleLevels[tc.Role]; !ok {
+			return fmt.Errorf("auth role %s of user %s must be viewer, operator or admin", tc.Role, tc.User)
+		}
+		if _, ok := seen[tc.Token]; ok {
+			return fmt.Errorf("auth token of user %s is duplicated", tc.User)
+		}
+		seen[tc.Token] = struct{}{}
+	}
+	return nil
+}
+
+// Lookup returns the user of token, nil if token is unknown.
+func (ac *AuthConfig) Lookup(token string) *TokenConfig {
+	var found *TokenConfig
+	for _, tc := range ac.Tokens {
+		// NOTE: compare all the tokens in constant time against timing attack.
+		if subtle.ConstantTimeCompare([]byte(tc.Token), []byte(token)) == 1 {
+			found = tc
+		}
+	}
+	return found
+}
+
+// AuditConfig is the storage of audit logs.
+type AuditConfig struct {
+	// File is the path of the file which audit logs are appended into as
+	// json lines, empty means etcd.
+	File string `toml:"file"`
+}
+
 // DefaultClusterConfig is the config used to write into cluster
 type DefaultClusterConfig struct {
 	DialTimeout   int  `toml:"dial_timeout"`
@@ -24,6 +116,12 @@ type DefaultClusterConfig struct {
 	NodeConns     int  `toml:"node_connections"`
 	PingFailLimit int  `toml:"ping_fail_limit"`
 	PingAutoEject bool `toml:"ping_auto_eject"`
+	// HashMethod and HashDistribution are the sharding of memcache and
+	// redis clusters, fnv1a_64 and ketama by default. HashTag is "{}" by
+	// default.
+	HashMethod       string `toml:"hash_method"`
+	HashDistribution string `toml:"hash_distribution"`
+	HashTag          string `toml:"hash_tag"`
 }
 
 // MonitorConfig types
@@ -46,3 +144,33 @@ type VersionConfig struct {
 	Versions  []string `toml:"versions"`
 	Image     string   `toml:"image"`
 }
+
+// CapacityModel is the capacity of a single instance of the cache type
+// which used to plan the layout of new cluster.
+type CapacityModel struct {
+	CacheType string `toml:"cache_type"`
+	// QPS is the max qps of a single instance with the given CPU.
+	QPS int     `toml:"qps"`
+	CPU float64 `toml:"cpu"`
+	// MaxMemory is the max memory MB of a single instance.
+	MaxMemory int `toml:"max_memory"`
+	// Bandwidth is the max throughput MB/s of a single instance, 0 means no limit.
+	Bandwidth int `toml:"bandwidth"`
+	// MemoryRatio is the ratio of used memory to the raw data size, such as fragmentation.
+	MemoryRatio float64 `toml:"memory_ratio"`
+	// KeyOverhead is the extra memory bytes of each key.
+	KeyOverhead int `toml:"key_overhead"`
+}
+
+// SetDefault set the default value of the capacity model.
+func (cm *CapacityModel) SetDefault() {
+	if cm.CPU == 0 {
+		cm.CPU = 1
+	}
+	if cm.MemoryRatio < 1 {
+		cm.MemoryRatio = 1.3
+	}
+	if cm.KeyOverhead == 0 {
+		cm.KeyOverhead = 64
+	}
+}
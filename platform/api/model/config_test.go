@@ -0,0 +1,48 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleAllowed(t *testing.T) {
+	assert.True(t, RoleAllowed(RoleAdmin, RoleOperator))
+	assert.True(t, RoleAllowed(RoleOperator, RoleOperator))
+	assert.True(t, RoleAllowed(RoleViewer, RoleViewer))
+	assert.False(t, RoleAllowed(RoleViewer, RoleOperator))
+	assert.False(t, RoleAllowed(RoleOperator, RoleAdmin))
+	assert.False(t, RoleAllowed("root", RoleViewer), "unknown role")
+	assert.False(t, RoleAllowed("", RoleViewer))
+}
+
+func TestAuthConfigLookup(t *testing.T) {
+	ac := &AuthConfig{Tokens: []*TokenConfig{
+		{Token: "t1", User: "alice", Role: RoleViewer},
+		{Token: "t2", User: "bob", Role: RoleAdmin},
+	}}
+	assert.Equal(t, "alice", ac.Lookup("t1").User)
+	assert.Equal(t, "bob", ac.Lookup("t2").User)
+	assert.Nil(t, ac.Lookup("t3"))
+	assert.Nil(t, ac.Lookup("t"), "prefix")
+	assert.Nil(t, ac.Lookup(""))
+}
+
+func TestAuthConfigValidate(t *testing.T) {
+	ac := &AuthConfig{Tokens: []*TokenConfig{
+		{Token: "t1", User: "alice", Role: RoleViewer},
+		{Token: "t2", User: "bob", Role: RoleOperator},
+	}}
+	assert.NoError(t, ac.Validate())
+
+	ac.Tokens[1].Role = "root"
+	assert.Error(t, ac.Validate(), "unknown role")
+	ac.Tokens[1].Role = RoleOperator
+	ac.Tokens[1].Token = "t1"
+	assert.Error(t, ac.Validate(), "duplicated token")
+	ac.Tokens[1].Token = ""
+	assert.Error(t, ac.Validate(), "empty token")
+	ac.Tokens[1].Token = "t2"
+	ac.Tokens[1].User = ""
+	assert.Error(t, ac.Validate(), "empty user")
+}
@@ -6,4 +6,5 @@ import "errors"
 var (
 	ErrConflict = errors.New("conflict")
 	ErrNotFound = errors.New("not found")
+	ErrBadSpec  = errors.New("spec must be cpu and memory such as 0.5c2g or 1c512m")
 )
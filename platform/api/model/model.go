@@ -14,6 +14,12 @@ type ParamCluster struct {
 	CacheType   string   `json:"cache_type" validate:"required"`
 	TotalMemory float64  `json:"total_memory" validate:"required"`
 	Group       string   `json:"group" validate:"required"`
+	// Attributes is the required host attributes such as rack, zone and so on.
+	Attributes map[string]string `json:"attributes"`
+	// AntiAffinity is the failure domain which master and slave never share, host, rack or zone.
+	AntiAffinity string `json:"anti_affinity"`
+	// MasterSpread is the failure domain which no two masters share, host, rack or zone.
+	MasterSpread string `json:"master_spread"`
 
 	Number     int     `json:"-"`
 	SpecCPU    float64 `json:"-"`
@@ -22,6 +28,12 @@ type ParamCluster struct {
 
 // Validate will check if the cluster param is right enough.
 func (pc *ParamCluster) Validate() error {
+	if !validDomainLevel(pc.AntiAffinity) {
+		return fmt.Errorf("error: anti_affinity %s must be host, rack or zone", pc.AntiAffinity)
+	}
+	if !validDomainLevel(pc.MasterSpread) {
+		return fmt.Errorf("error: master_spread %s must be host, rack or zone", pc.MasterSpread)
+	}
 	// check appids
 	for _, appid := range pc.Appids {
 		if !strings.Contains(appid, ".") {
@@ -31,6 +43,14 @@ func (pc *ParamCluster) Validate() error {
 	return nil
 }
 
+func validDomainLevel(level string) bool {
+	switch level {
+	case "", "host", "rack", "zone":
+		return true
+	}
+	return false
+}
+
 // ValidateGroup will check if the group param is in the predefined groups.
 func (pc *ParamCluster) ValidateGroup(groups []*Group) error {
 	for _, group := range groups {
@@ -48,12 +68,76 @@ type ParamScale struct {
 	Memory int    `json:"memory"`
 }
 
+// ParamUpgrade is the target of the rolling upgrade of cluster.
+type ParamUpgrade struct {
+	Version string `json:"version" validate:"required"`
+	// Batch is the number of instances restarted at a time, default 1.
+	Batch int `json:"batch" validate:"gte=0"`
+	// HealthTimeout is the seconds waiting for the restarted instances
+	// healthy, default 300.
+	HealthTimeout int `json:"health_timeout" validate:"gte=0"`
+}
+
+// ParamRestore is the backup set restored into cluster.
+type ParamRestore struct {
+	Backup string `json:"backup" validate:"required"`
+	// From is the cluster whose backup set is restored, default is the
+	// cluster itself.
+	From string `json:"from"`
+}
+
+// ParamBalance is the throttle of slots balancing of redis cluster.
+type ParamBalance struct {
+	// DryRun only reports the plan of moving slots without migrating.
+	DryRun bool `json:"dry_run"`
+	// KeysPerBatch is the keys migrated by a MIGRATE command, default 100.
+	KeysPerBatch int `json:"keys_per_batch" validate:"gte=0"`
+	// BatchPause is the milliseconds paused between batches, default 10.
+	BatchPause int `json:"batch_pause" validate:"gte=0"`
+	// Tolerance is the ratio of the memory gap between masters to the
+	// average which is balanced enough, default 0.1.
+	Tolerance float64 `json:"tolerance" validate:"gte=0"`
+}
+
+// ParamApprove is the decision of the job waiting for approval.
+type ParamApprove struct {
+	// User is the approver, which is appended into the users of job.
+	User   string `json:"user"`
+	Reason string `json:"reason"`
+}
+
+// AuditLog is the record of a mutating request of apiserver.
+type AuditLog struct {
+	Time   int64  `json:"time"`
+	User   string `json:"user"`
+	Role   string `json:"role"`
+	Remote string `json:"remote"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Query and Body are the params of the request.
+	Query  string `json:"query,omitempty"`
+	Body   string `json:"body,omitempty"`
+	Status int    `json:"status"`
+	// JobID is the job created by the request if any.
+	JobID string `json:"job_id,omitempty"`
+}
+
 // QueryPage is the pagenation binder.
 type QueryPage struct {
 	PageNum   int `form:"pn,default=1" validate:"gt=0"`
 	PageCount int `form:"pc,default=1000" validate:"gt=0"`
 }
 
+// SetDefault fills the page number and count which not given.
+func (p *QueryPage) SetDefault() {
+	if p.PageNum <= 0 {
+		p.PageNum = 1
+	}
+	if p.PageCount <= 0 {
+		p.PageCount = 1000
+	}
+}
+
 // Bounds returns the upper and lower bounds begins with 0 for this query path.
 func (p *QueryPage) Bounds() (int, int) {
 	return p.PageCount * (p.PageNum - 1), p.PageCount * p.PageNum
@@ -85,3 +169,33 @@ func (p *ParamAssign) Validate() error {
 type ParamScaleWeight struct {
 	Weight int `json:"weight" validate:"required,ne=0"`
 }
+
+// ValueSize is a part of the value size distribution.
+type ValueSize struct {
+	// Size is the bytes of value.
+	Size int `json:"size"`
+	// Ratio is the ratio of the keys with the size.
+	Ratio float64 `json:"ratio"`
+}
+
+// ParamCapacity is the target of capacity planning.
+type ParamCapacity struct {
+	CacheType string `json:"cache_type" validate:"required"`
+	QPS       int    `json:"qps" validate:"required"`
+	// DataSize is the total raw data size with MB.
+	DataSize   float64      `json:"data_size" validate:"required"`
+	ValueSizes []*ValueSize `json:"value_sizes"`
+}
+
+// Validate check the param is ok
+func (p *ParamCapacity) Validate() error {
+	if p.QPS <= 0 || p.DataSize <= 0 {
+		return fmt.Errorf("error: qps and data_size must be positive")
+	}
+	for _, vs := range p.ValueSizes {
+		if vs.Size <= 0 || vs.Ratio < 0 {
+			return fmt.Errorf("error: value size %d with ratio %f is invalid", vs.Size, vs.Ratio)
+		}
+	}
+	return nil
+}
@@ -3,6 +3,8 @@ package model
 import (
 	"fmt"
 	"strings"
+
+	"overlord/pkg/etcd"
 )
 
 // Version is the info or version dir
@@ -64,6 +66,8 @@ type Instance struct {
 	Alias  string `json:"alias"`
 	State  string `json:"state"`
 	Role   string `json:"role"`
+	// Restarts is the times the instance restarted by executor.
+	Restarts int `json:"restarts"`
 }
 
 // Appid is the struct conttains many cluster name
@@ -121,3 +125,29 @@ func BuildTreeAppids(appids []string) []*TreeAppid {
 	}
 	return tas
 }
+
+// CapacityPlan is the recommended layout of capacity planning, and the
+// Cluster can be used to create cluster directly.
+type CapacityPlan struct {
+	Number    int     `json:"number"`
+	CPU       float64 `json:"cpu"`
+	MaxMemory int     `json:"max_memory"`
+	// Bound is the resource which decide the number, qps or memory.
+	Bound   string        `json:"bound"`
+	Cluster *ParamCluster `json:"cluster"`
+}
+
+// SchedulableCapacity is the schedulable capacity of the agents reported by
+// scheduler, the Instances are counted only if spec given.
+type SchedulableCapacity struct {
+	CPU       float64          `json:"cpu"`
+	Memory    float64          `json:"memory"`
+	Instances int              `json:"instances,omitempty"`
+	Agents    []*AgentCapacity `json:"agents"`
+}
+
+// AgentCapacity is the schedulable capacity of an agent.
+type AgentCapacity struct {
+	*etcd.Capacity
+	Instances int `json:"instances,omitempty"`
+}
@@ -3,9 +3,12 @@ package server
 import (
 	"net/http"
 
+	"overlord/platform/api/model"
+
 	"github.com/gin-gonic/gin"
 )
 
+// POST /job/ is kept for the old clients.
 func approveJob(c *gin.Context) {
 	id := c.PostForm("job_id")
 	if id == "" {
@@ -13,7 +16,11 @@ func approveJob(c *gin.Context) {
 		return
 	}
 
-	err := svc.ApproveJob(id)
+	p := &model.ParamApprove{User: c.PostForm("user")}
+	if auth != nil {
+		p.User = user(c)
+	}
+	err := svc.ApproveJob(id, p)
 	if err != nil {
 		eJSON(c, err)
 		return
@@ -21,3 +28,32 @@ func approveJob(c *gin.Context) {
 
 	c.JSON(http.StatusOK, map[string]string{"job": "approved"})
 }
+
+// POST /jobs/:job_id/approve
+func approve(c *gin.Context) {
+	decide(c, svc.ApproveJob, "approved")
+}
+
+// POST /jobs/:job_id/reject
+func reject(c *gin.Context) {
+	decide(c, svc.RejectJob, "rejected")
+}
+
+func decide(c *gin.Context, do func(string, *model.ParamApprove) error, state string) {
+	p := new(model.ParamApprove)
+	if c.Request.ContentLength != 0 {
+		if err := c.BindJSON(p); err != nil {
+			c.JSON(http.StatusBadRequest, err)
+			return
+		}
+	}
+	// NOTE: the approver is the authenticated user if auth enabled.
+	if auth != nil {
+		p.User = user(c)
+	}
+	if err := do(c.Param("job_id"), p); err != nil {
+		eJSON(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, map[string]string{"job": state})
+}
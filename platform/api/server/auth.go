@@ -0,0 +1,164 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"overlord/pkg/log"
+	"overlord/platform/api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ctxUser = "overlord.user"
+	ctxRole = "overlord.role"
+
+	// userAnonymous is the user of all the requests if auth is disabled.
+	userAnonymous = "anonymous"
+	// _auditBodyLimit is the max bytes of body recorded by audit log.
+	_auditBodyLimit = 4096
+	_auditLimit     = 100
+)
+
+// auth is nil if all the requests are allowed as anonymous admin.
+var auth *model.AuthConfig
+
+// authenticate identifies the user by the bearer token, the viewer role is
+// required for GET and the operator role for the others.
+func authenticate(c *gin.Context) {
+	if auth == nil {
+		c.Set(ctxUser, userAnonymous)
+		c.Set(ctxRole, model.RoleAdmin)
+		return
+	}
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if token == "" && isJobEvents(c) {
+		// NOTE: EventSource of browsers can't set headers
+		token = c.Query("token")
+	}
+	tc := auth.Lookup(token)
+	if token == "" || tc == nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, map[string]string{"error": "invalid token"})
+		return
+	}
+	c.Set(ctxUser, tc.User)
+	c.Set(ctxRole, tc.Role)
+	required := model.RoleOperator
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+		required = model.RoleViewer
+	}
+	authorizeRole(c, required)
+}
+
+// isJobEvents reports whether the request is GET /jobs/:job_id/events.
+func isJobEvents(c *gin.Context) bool {
+	path := c.Request.URL.Path
+	return c.Request.Method == http.MethodGet && strings.HasPrefix(path, "/api/v1/jobs/") && strings.HasSuffix(path, "/events")
+}
+
+// authorize requires the role higher than the default of the method.
+func authorize(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authorizeRole(c, role)
+	}
+}
+
+func authorizeRole(c *gin.Context, required string) {
+	if !model.RoleAllowed(c.GetString(ctxRole), required) {
+		c.AbortWithStatusJSON(http.StatusForbidden, map[string]string{
+			"error": "user " + c.GetString(ctxUser) + " requires role " + required,
+		})
+	}
+}
+
+// user returns the authenticated user.
+func user(c *gin.Context) string {
+	return c.GetString(ctxUser)
+}
+
+// auditWriter keeps the head of the response to find the job created.
+type auditWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *auditWriter) Write(data []byte) (int, error) {
+	if left := _auditBodyLimit - w.body.Len(); left > 0 {
+		if len(data) < left {
+			left = len(data)
+		}
+		w.body.Write(data[:left])
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *auditWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// audit records who did what by every mutating request, including the
+// rejected ones.
+func audit(c *gin.Context) {
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+		c.Next()
+		return
+	}
+	var body []byte
+	if c.Request.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(c.Request.Body); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	w := &auditWriter{ResponseWriter: c.Writer}
+	c.Writer = w
+	c.Next()
+
+	al := &model.AuditLog{
+		Time:   time.Now().Unix(),
+		User:   c.GetString(ctxUser),
+		Role:   c.GetString(ctxRole),
+		Remote: c.ClientIP(),
+		Method: c.Request.Method,
+		Path:   c.Request.URL.Path,
+		Query:  c.Request.URL.RawQuery,
+		Status: w.Status(),
+	}
+	if len(body) > _auditBodyLimit {
+		body = body[:_auditBodyLimit]
+	}
+	al.Body = string(body)
+	var j model.Job
+	if json.Unmarshal(w.body.Bytes(), &j) == nil {
+		al.JobID = j.ID
+	}
+	if err := svc.Audit(al); err != nil {
+		log.Errorf("audit %s %s by %s err %v", al.Method, al.Path, al.User, err)
+	}
+}
+
+// GET /audit
+func getAuditLogs(c *gin.Context) {
+	limit := _auditLimit
+	if l := c.Query("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, "limit must be positive integer")
+			return
+		}
+	}
+	logs, err := svc.AuditLogs(c.Query("user"), limit)
+	if err != nil {
+		eJSON(c, err)
+		return
+	}
+	listJSON(c, logs, len(logs))
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"overlord/platform/api/model"
+	"overlord/platform/api/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func _authServer(t *testing.T) (engine *gin.Engine, clean func()) {
+	dir, err := ioutil.TempDir("", "apiserver-audit")
+	assert.NoError(t, err)
+	gin.SetMode(gin.TestMode)
+	// NOTE: etcd is unreachable, the audit logs are appended into file.
+	svc = service.New(&model.ServerConfig{
+		Etcd:  "http://127.0.0.1:1",
+		Audit: &model.AuditConfig{File: filepath.Join(dir, "audit.log")},
+	})
+	auth = &model.AuthConfig{Tokens: []*model.TokenConfig{
+		{Token: "view", User: "alice", Role: model.RoleViewer},
+		{Token: "op", User: "bob", Role: model.RoleOperator},
+		{Token: "admin", User: "carol", Role: model.RoleAdmin},
+	}}
+	engine = gin.New()
+	initRouter(engine)
+	return engine, func() {
+		auth = nil
+		os.RemoveAll(dir)
+	}
+}
+
+func _authDo(engine *gin.Engine, method, url, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuthenticate(t *testing.T) {
+	engine, clean := _authServer(t)
+	defer clean()
+
+	assert.Equal(t, http.StatusUnauthorized, _authDo(engine, http.MethodGet, "/api/v1/clusters/", "", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, _authDo(engine, http.MethodGet, "/api/v1/clusters/", "wrong", "").Code)
+	// NOTE: the token in query is only accepted by job events.
+	assert.Equal(t, http.StatusUnauthorized, _authDo(engine, http.MethodGet, "/api/v1/groups?token=view", "", "").Code)
+	assert.Equal(t, http.StatusForbidden, _authDo(engine, http.MethodGet, "/api/v1/audit?token=admin", "view", "").Code)
+
+	w := _authDo(engine, http.MethodPost, "/api/v1/clusters/", "view", `{"name":"c1"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "user alice requires role operator")
+	assert.Equal(t, http.StatusForbidden, _authDo(engine, http.MethodPost, "/api/v1/jobs/j1/approve", "op", "").Code)
+	assert.Equal(t, http.StatusForbidden, _authDo(engine, http.MethodGet, "/api/v1/audit", "op", "").Code)
+	assert.Equal(t, http.StatusOK, _authDo(engine, http.MethodGet, "/api/v1/audit", "admin", "").Code)
+}
+
+func TestAuthenticateJobEventsToken(t *testing.T) {
+	engine, clean := _authServer(t)
+	defer clean()
+	engine = gin.New()
+	e := engine.Group("/api/v1")
+	e.Use(audit, authenticate)
+	e.GET("/jobs/:job_id/events", func(c *gin.Context) {
+		c.String(http.StatusOK, user(c))
+	})
+
+	assert.Equal(t, http.StatusUnauthorized, _authDo(engine, http.MethodGet, "/api/v1/jobs/j1/events", "", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, _authDo(engine, http.MethodGet, "/api/v1/jobs/j1/events?token=wrong", "", "").Code)
+	w := _authDo(engine, http.MethodGet, "/api/v1/jobs/j1/events?token=view", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "alice", w.Body.String())
+}
+
+func TestAuditRejected(t *testing.T) {
+	engine, clean := _authServer(t)
+	defer clean()
+
+	assert.Equal(t, http.StatusUnauthorized, _authDo(engine, http.MethodPost, "/api/v1/clusters/", "", `{"name":"c1"}`).Code)
+	assert.Equal(t, http.StatusForbidden, _authDo(engine, http.MethodDelete, "/api/v1/clusters/c1", "view", "").Code)
+	// NOTE: GET is never audited.
+	assert.Equal(t, http.StatusForbidden, _authDo(engine, http.MethodGet, "/api/v1/audit", "view", "").Code)
+
+	logs, err := svc.AuditLogs("", 0)
+	assert.NoError(t, err)
+	assert.Len(t, logs, 2)
+	assert.Equal(t, "", logs[0].User)
+	assert.Equal(t, http.MethodPost, logs[0].Method)
+	assert.Equal(t, "/api/v1/clusters/", logs[0].Path)
+	assert.Equal(t, `{"name":"c1"}`, logs[0].Body)
+	assert.Equal(t, http.StatusUnauthorized, logs[0].Status)
+	assert.Equal(t, "alice", logs[1].User)
+	assert.Equal(t, model.RoleViewer, logs[1].Role)
+	assert.Equal(t, http.StatusForbidden, logs[1].Status)
+
+	logs, err = svc.AuditLogs("alice", 0)
+	assert.NoError(t, err)
+	assert.Len(t, logs, 1)
+}
+
+func TestAuditJobID(t *testing.T) {
+	_, clean := _authServer(t)
+	defer clean()
+	engine := gin.New()
+	e := engine.Group("/api/v1")
+	e.Use(audit, authenticate)
+	e.POST("/clusters/", func(c *gin.Context) {
+		c.JSON(http.StatusOK, &model.Job{ID: "overlord/jobs/job1"})
+	})
+	e.POST("/appids/", func(c *gin.Context) {
+		c.JSON(http.StatusOK, "ok")
+	})
+
+	assert.Equal(t, http.StatusOK, _authDo(engine, http.MethodPost, "/api/v1/clusters/", "op", `{"name":"c1"}`).Code)
+	assert.Equal(t, http.StatusOK, _authDo(engine, http.MethodPost, "/api/v1/appids/", "op", `{"name":"a1"}`).Code)
+	logs, err := svc.AuditLogs("bob", 0)
+	assert.NoError(t, err)
+	assert.Len(t, logs, 2)
+	assert.Equal(t, "overlord/jobs/job1", logs[0].JobID)
+	assert.Equal(t, http.StatusOK, logs[0].Status)
+	assert.Equal(t, "", logs[1].JobID, "no job created")
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+
+	"overlord/platform/api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// POST /capacity
+func planCapacity(c *gin.Context) {
+	p := new(model.ParamCapacity)
+	if err := c.BindJSON(p); err != nil {
+		c.JSON(http.StatusBadRequest, err)
+		return
+	}
+	if err := p.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, err)
+		return
+	}
+
+	plan, err := svc.PlanCapacity(p)
+	if err != nil {
+		eJSON(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, plan)
+}
+
+// GET /capacity
+func getCapacity(c *gin.Context) {
+	sc, err := svc.GetSchedulableCapacity(c.Query("spec"))
+	if err != nil {
+		eJSON(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, sc)
+}
@@ -82,6 +82,11 @@ func scaleCluster(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, err)
 		return
 	}
+	p.Name = c.Param("cluster_name")
+	if p.Number <= 0 {
+		c.JSON(http.StatusBadRequest, "number of instances must be positive, destroy the cluster instead")
+		return
+	}
 
 	jobID, err := svc.ScaleCluster(p)
 	if err != nil {
@@ -95,6 +100,92 @@ func scaleCluster(c *gin.Context) {
 	c.JSON(http.StatusOK, &model.Job{ID: jobID, State: job.StatePending})
 }
 
+// POST /clusters/:cluster_name/upgrade
+func upgradeCluster(c *gin.Context) {
+	p := new(model.ParamUpgrade)
+	if err := c.BindJSON(p); err != nil {
+		c.JSON(http.StatusBadRequest, err)
+		return
+	}
+
+	jobID, err := svc.UpgradeCluster(c.Param("cluster_name"), p)
+	if err != nil {
+		eJSON(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, &model.Job{ID: jobID, State: job.StatePending})
+}
+
+// GET /clusters/:cluster_name/backups
+func getBackups(c *gin.Context) {
+	sets, err := svc.GetBackups(c.Param("cluster_name"))
+	if err != nil {
+		eJSON(c, err)
+		return
+	}
+	if len(sets) == 0 {
+		c.JSON(http.StatusOK, empty())
+		return
+	}
+	c.JSON(http.StatusOK, &list{Count: len(sets), Items: sets})
+}
+
+// POST /clusters/:cluster_name/backups
+func backupCluster(c *gin.Context) {
+	jobID, err := svc.BackupCluster(c.Param("cluster_name"))
+	if err != nil {
+		eJSON(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, &model.Job{ID: jobID, State: job.StatePending})
+}
+
+// POST /clusters/:cluster_name/restore
+func restoreCluster(c *gin.Context) {
+	p := new(model.ParamRestore)
+	if err := c.BindJSON(p); err != nil {
+		c.JSON(http.StatusBadRequest, err)
+		return
+	}
+
+	jobID, err := svc.RestoreCluster(c.Param("cluster_name"), p)
+	if err != nil {
+		eJSON(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, &model.Job{ID: jobID, State: job.StatePending})
+}
+
+// POST /clusters/:cluster_name/fix
+func fixCluster(c *gin.Context) {
+	jobID, err := svc.FixCluster(c.Param("cluster_name"))
+	if err != nil {
+		eJSON(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, &model.Job{ID: jobID, State: job.StatePending})
+}
+
+// POST /clusters/:cluster_name/balance
+func balanceCluster(c *gin.Context) {
+	p := new(model.ParamBalance)
+	if err := c.BindJSON(p); err != nil {
+		c.JSON(http.StatusBadRequest, err)
+		return
+	}
+
+	jobID, report, err := svc.BalanceCluster(c.Param("cluster_name"), p)
+	if err != nil {
+		eJSON(c, err)
+		return
+	}
+	if p.DryRun {
+		c.JSON(http.StatusOK, report)
+		return
+	}
+	c.JSON(http.StatusOK, &model.Job{ID: jobID, State: job.StatePending})
+}
+
 func assignAppid(c *gin.Context) {
 	cname := c.Param("cluster_name")
 	p := new(model.ParamAssign)
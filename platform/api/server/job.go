@@ -1,9 +1,13 @@
 package server
 
 import (
+	"io"
 	"net/http"
-
 	"strings"
+	"time"
+
+	"overlord/platform/api/model"
+	"overlord/platform/job"
 
 	"github.com/gin-gonic/gin"
 	"go.etcd.io/etcd/client"
@@ -25,6 +29,75 @@ func getJob(c *gin.Context) {
 	c.JSON(http.StatusOK, t)
 }
 
+// GET /jobs/:job_id/logs
+func getJobLogs(c *gin.Context) {
+	p := new(model.QueryPage)
+	if err := c.ShouldBindQuery(p); err != nil {
+		c.JSON(http.StatusBadRequest, err)
+		return
+	}
+
+	jobID := strings.Replace(c.Param("job_id"), ".", "/", -1)
+	logs, count, err := svc.GetJobLogs(jobID, p)
+	if err != nil {
+		eJSON(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &list{
+		Count: count,
+		Items: logs,
+	})
+}
+
+// _jobKeepalive is the interval of the comments sent to keep the idle
+// event stream alive through proxies.
+const _jobKeepalive = 15 * time.Second
+
+// GET /jobs/:job_id/events
+//
+// watchJob streams the job as server-sent events, the current state and logs
+// first and then the following ones. A "state" event carries the state and a
+// "log" event carries one execution log line, the stream ends once the job
+// is done or failed.
+func watchJob(c *gin.Context) {
+	jobID := strings.Replace(c.Param("job_id"), ".", "/", -1)
+	evts, err := svc.WatchJob(c.Request.Context(), jobID)
+	if client.IsKeyNotFound(err) {
+		c.JSON(http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		eJSON(c, err)
+		return
+	}
+
+	ticker := time.NewTicker(_jobKeepalive)
+	defer ticker.Stop()
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case evt, ok := <-evts:
+			if !ok {
+				return false
+			}
+			if evt.Log != nil {
+				c.SSEvent("log", evt.Log)
+				return true
+			}
+			c.SSEvent("state", evt.State)
+			return !jobFinished(evt.State)
+		case <-ticker.C:
+			_, err := io.WriteString(w, ": keepalive\n\n")
+			return err == nil
+		}
+	})
+}
+
+func jobFinished(state string) bool {
+	return state == job.StateDone || state == job.StateFail || state == job.StateLost || state == job.StateRejected
+}
+
 func getJobs(c *gin.Context) {
 	j, err := svc.GetJobs()
 	if err != nil {
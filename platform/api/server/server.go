@@ -15,8 +15,12 @@ var (
 // Run the whole overlord app
 func Run(cfg *model.ServerConfig, s *service.Service) {
 	svc = s
+	auth = cfg.Auth
 	engine := gin.Default()
 	initRouter(engine)
+	if cfg.Web != "" {
+		initWeb(engine, cfg.Web)
+	}
 	if err := engine.Run(cfg.Listen); err != nil {
 		log.Errorf("engine start fail due to %v", err)
 		panic(err)
@@ -25,6 +29,7 @@ func Run(cfg *model.ServerConfig, s *service.Service) {
 
 func initRouter(ge *gin.Engine) {
 	e := ge.Group("/api/v1")
+	e.Use(audit, authenticate)
 
 	clusters := e.Group("/clusters")
 	clusters.POST("/", createCluster)
@@ -37,6 +42,12 @@ func initRouter(ge *gin.Engine) {
 
 	clusters.PATCH("/:cluster_name/instances/:instance_addr", changeInstanceWeight)
 	clusters.PATCH("/:cluster_name/instances", scaleCluster)
+	clusters.POST("/:cluster_name/upgrade", upgradeCluster)
+	clusters.GET("/:cluster_name/backups", getBackups)
+	clusters.POST("/:cluster_name/backups", backupCluster)
+	clusters.POST("/:cluster_name/restore", restoreCluster)
+	clusters.POST("/:cluster_name/fix", fixCluster)
+	clusters.POST("/:cluster_name/balance", balanceCluster)
 	// TODO: impl it
 	clusters.GET("/:cluster_name/instances", getInstances)
 
@@ -46,14 +57,18 @@ func initRouter(ge *gin.Engine) {
 	// clusters.POST("/:cluster_name/appids", )
 
 	cmds := e.Group("/commands")
-	cmds.POST("/:ip/:port", executeCommand)
+	cmds.POST("/:ip/:port", authorize(model.RoleAdmin), executeCommand)
 
 	jobs := e.Group("/jobs")
 	jobs.GET("/", getJobs)
 	jobs.GET("/:job_id", getJob)
+	jobs.GET("/:job_id/logs", getJobLogs)
+	jobs.GET("/:job_id/events", watchJob)
+	jobs.POST("/:job_id/approve", authorize(model.RoleAdmin), approve)
+	jobs.POST("/:job_id/reject", authorize(model.RoleAdmin), reject)
 
 	job := e.Group("/job")
-	job.POST("/", approveJob)
+	job.POST("/", authorize(model.RoleAdmin), approveJob)
 
 	specs := e.Group("/specs")
 	specs.GET("/", getSpecs)
@@ -67,5 +82,8 @@ func initRouter(ge *gin.Engine) {
 
 	e.GET("/versions", getAllVersions)
 	e.GET("/groups", getAllGroups)
+	e.POST("/capacity", planCapacity)
+	e.GET("/capacity", getCapacity)
+	e.GET("/audit", authorize(model.RoleAdmin), getAuditLogs)
 
 }
@@ -27,6 +27,10 @@ func eJSON(c *gin.Context, err error) {
 		c.JSON(http.StatusConflict, merr)
 		return
 	}
+	if err == model.ErrBadSpec {
+		c.JSON(http.StatusBadRequest, merr)
+		return
+	}
 
 	c.JSON(http.StatusInternalServerError, merr)
 }
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"overlord/pkg/log"
+
+	"github.com/gin-gonic/gin"
+)
+
+// initWeb serves the built front-end in dir, the paths not found fall back
+// to index.html since the front-end routes in history mode.
+func initWeb(ge *gin.Engine, dir string) {
+	index := filepath.Join(dir, "index.html")
+	if _, err := os.Stat(index); err != nil {
+		log.Warnf("web ui disabled due to %v", err)
+		return
+	}
+	fs := http.Dir(dir)
+	files := http.FileServer(fs)
+	ge.NoRoute(func(c *gin.Context) {
+		if strings.HasPrefix(c.Request.URL.Path, "/api/") {
+			c.JSON(http.StatusNotFound, map[string]string{"error": "not found"})
+			return
+		}
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.Status(http.StatusMethodNotAllowed)
+			return
+		}
+		if f, err := fs.Open(c.Request.URL.Path); err == nil {
+			st, err := f.Stat()
+			f.Close()
+			if err == nil && !st.IsDir() {
+				files.ServeHTTP(c.Writer, c.Request)
+				return
+			}
+		}
+		c.File(index)
+	})
+}
@@ -0,0 +1,17 @@
+package service
+
+import (
+	"context"
+
+	"overlord/platform/api/model"
+)
+
+// Audit records the mutating request.
+func (s *Service) Audit(al *model.AuditLog) error {
+	return s.d.Audit(context.Background(), al)
+}
+
+// AuditLogs gets the latest audit logs of user, all the users if empty.
+func (s *Service) AuditLogs(user string, limit int) ([]*model.AuditLog, error) {
+	return s.d.AuditLogs(context.Background(), user, limit)
+}
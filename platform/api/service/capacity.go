@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"overlord/pkg/types"
+	"overlord/platform/api/model"
+)
+
+const (
+	defaultValueSize = 1024
+	megabyte         = 1024 * 1024
+
+	boundQPS    = "qps"
+	boundMemory = "memory"
+)
+
+// PlanCapacity recommends the node number, cpu and memory of each node by
+// the configured capacity model of the cache type.
+func (s *Service) PlanCapacity(p *model.ParamCapacity) (*model.CapacityPlan, error) {
+	var cm *model.CapacityModel
+	for _, m := range s.cfg.Capacity {
+		if m.CacheType == p.CacheType {
+			cm = m
+			break
+		}
+	}
+	if cm == nil {
+		return nil, fmt.Errorf("capacity model of cache type %s is not configured", p.CacheType)
+	}
+	if cm.QPS <= 0 || cm.MaxMemory <= 0 {
+		return nil, fmt.Errorf("capacity model of cache type %s must have positive qps and max_memory", p.CacheType)
+	}
+
+	avgValue := averageValueSize(p.ValueSizes)
+	keys := p.DataSize * megabyte / avgValue
+	memNeed := (p.DataSize + keys*float64(cm.KeyOverhead)/megabyte) * cm.MemoryRatio
+
+	instQPS := float64(cm.QPS)
+	if cm.Bandwidth > 0 {
+		instQPS = math.Min(instQPS, float64(cm.Bandwidth)*megabyte/avgValue)
+	}
+
+	byQPS := int(math.Ceil(float64(p.QPS) / instQPS))
+	byMem := int(math.Ceil(memNeed / float64(cm.MaxMemory)))
+	plan := &model.CapacityPlan{Number: byQPS, Bound: boundQPS, CPU: cm.CPU}
+	if byMem > byQPS {
+		plan.Number = byMem
+		plan.Bound = boundMemory
+	}
+	if plan.Number == 0 {
+		plan.Number = 1
+	}
+	if types.CacheType(p.CacheType) == types.CacheTypeRedisCluster && plan.Number%2 != 0 {
+		plan.Number++
+	}
+	plan.MaxMemory = int(math.Ceil(memNeed / float64(plan.Number)))
+
+	plan.Cluster = &model.ParamCluster{
+		CacheType:   p.CacheType,
+		Spec:        fmt.Sprintf("%gc%dm", plan.CPU, plan.MaxMemory),
+		TotalMemory: float64(plan.MaxMemory * plan.Number),
+	}
+	return plan, nil
+}
+
+// averageValueSize returns the weighted average bytes of the value size distribution.
+func averageValueSize(vss []*model.ValueSize) float64 {
+	var total, ratio float64
+	for _, vs := range vss {
+		total += float64(vs.Size) * vs.Ratio
+		ratio += vs.Ratio
+	}
+	if ratio == 0 {
+		return defaultValueSize
+	}
+	return total / ratio
+}
+
+// GetSchedulableCapacity gets the schedulable capacity of the agents and the
+// number of instances of spec can be placed.
+func (s *Service) GetSchedulableCapacity(spec string) (*model.SchedulableCapacity, error) {
+	return s.d.GetSchedulableCapacity(context.Background(), spec)
+}
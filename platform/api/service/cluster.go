@@ -2,7 +2,10 @@ package service
 
 import (
 	"context"
+
 	"overlord/platform/api/model"
+	"overlord/platform/job/backup"
+	"overlord/platform/job/balance"
 )
 
 // CreateCluster will create new cluster
@@ -33,6 +36,37 @@ func (s *Service) ScaleCluster(p *model.ParamScale) (jobID string, err error) {
 	return
 }
 
+// UpgradeCluster will send the rolling upgrade job of cluster to etcd.
+func (s *Service) UpgradeCluster(cname string, p *model.ParamUpgrade) (string, error) {
+	return s.d.UpgradeCluster(context.Background(), cname, p)
+}
+
+// GetBackups will list the backup sets of cluster.
+func (s *Service) GetBackups(cname string) ([]*backup.Set, error) {
+	return s.d.GetBackups(context.Background(), cname)
+}
+
+// BackupCluster will start the backup job of cluster.
+func (s *Service) BackupCluster(cname string) (string, error) {
+	return s.d.BackupCluster(context.Background(), cname)
+}
+
+// RestoreCluster will start the restore job of cluster from backup set.
+func (s *Service) RestoreCluster(cname string, p *model.ParamRestore) (string, error) {
+	return s.d.RestoreCluster(context.Background(), cname, p)
+}
+
+// FixCluster will start the fix job of redis cluster.
+func (s *Service) FixCluster(cname string) (string, error) {
+	return s.d.FixCluster(context.Background(), cname)
+}
+
+// BalanceCluster will plan the slots balancing of redis cluster and start
+// the balance job unless dry run.
+func (s *Service) BalanceCluster(cname string, p *model.ParamBalance) (string, *balance.Report, error) {
+	return s.d.BalanceCluster(context.Background(), cname, p)
+}
+
 // AssignAppid will asign appid and cluster
 func (s *Service) AssignAppid(cname, appid string) error {
 	sub, cancel := context.WithCancel(context.Background())
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"time"
 
+	"overlord/pkg/etcd"
 	"overlord/pkg/log"
 	"overlord/pkg/types"
 	"overlord/platform/api/model"
@@ -23,9 +24,39 @@ func (s *Service) GetJobs() ([]*model.Job, error) {
 	return s.d.GetJobs(context.Background())
 }
 
-// ApproveJob will approve job and change the state from StateWaitApprove to StateDone
-func (s *Service) ApproveJob(jobID string) error {
-	return s.d.ApproveJob(context.Background(), jobID)
+// GetJobLogs will get the paged execution logs of the given job and the total count.
+func (s *Service) GetJobLogs(jobID string, p *model.QueryPage) ([]*etcd.JobLog, int, error) {
+	logs, err := s.d.GetJobLogs(context.Background(), jobID)
+	if err != nil {
+		return nil, 0, err
+	}
+	p.SetDefault()
+	lower, upper := p.Bounds()
+	if lower > len(logs) {
+		lower = len(logs)
+	}
+	if upper > len(logs) {
+		upper = len(logs)
+	}
+	return logs[lower:upper], len(logs), nil
+}
+
+// WatchJob will stream the state transitions and execution logs of the given
+// job until ctx done.
+func (s *Service) WatchJob(ctx context.Context, jobID string) (<-chan *etcd.JobEvent, error) {
+	return s.d.WatchJobEvents(ctx, jobID)
+}
+
+// ApproveJob will approve job and change the state from StateWaitApprove to
+// StateApproved, then the job is executed.
+func (s *Service) ApproveJob(jobID string, p *model.ParamApprove) error {
+	return s.d.ApproveJob(context.Background(), jobID, p)
+}
+
+// RejectJob will reject job and change the state from StateWaitApprove to
+// StateRejected.
+func (s *Service) RejectJob(jobID string, p *model.ParamApprove) error {
+	return s.d.RejectJob(context.Background(), jobID, p)
 }
 
 func (s *Service) jobManager() (err error) {
@@ -54,9 +85,19 @@ func newJobManager(ctx context.Context, s *Service) (jm *JobManager, err error)
 	}
 	undoneJob := make(map[string]*model.Job)
 	for _, j := range jobs {
-		if j.State != job.StateDone {
-			undoneJob[j.ID] = j
+		if j.State == job.StateDone {
+			continue
 		}
+		if runByAPIServer(j) {
+			if j.State == job.StatePending || j.State == job.StateRunning {
+				// NOTE: the job run by the last apiserver process was interrupted.
+				group, id := splitJobID(j.ID)
+				s.d.SetJobState(ctx, group, id, job.StateFail)
+				log.Warnf("[jobManager] job %s interrupted by apiserver restart", j.ID)
+			}
+			continue
+		}
+		undoneJob[j.ID] = j
 	}
 	log.Infof("[jobManager] recovery jobs for %v", undoneJob)
 	newJob := s.d.WatchJob(ctx)
@@ -211,3 +252,19 @@ func (j *JobManager) bgBalance(ctx context.Context, myJob *job.Job, mJob *model.
 		log.Infof("balance success tracing cluster %s jid %s.%s", cluster, group, jid)
 	}
 }
+
+// runByAPIServer reports whether the job is run by apiserver itself.
+func runByAPIServer(mJob *model.Job) bool {
+	var t job.Job
+	if err := json.Unmarshal([]byte(mJob.Param), &t); err != nil {
+		return false
+	}
+	return job.ByAPIServer(t.OpType)
+}
+
+func splitJobID(jobID string) (group, id string) {
+	if idx := strings.LastIndexByte(jobID, '.'); idx > 0 {
+		return jobID[:idx], jobID[idx+1:]
+	}
+	return "", jobID
+}
@@ -8,6 +8,11 @@ import (
 
 // New create new service of overlord
 func New(cfg *model.ServerConfig) *Service {
+	// NOTE: the capacity models are read by requests concurrently, so they
+	// are defaulted once here.
+	for _, cm := range cfg.Capacity {
+		cm.SetDefault()
+	}
 	s := &Service{
 		cfg:    cfg,
 		client: myredis.New(),
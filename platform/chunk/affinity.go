@@ -0,0 +1,173 @@
+package chunk
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// failure domain levels, the level except host is given by the attribute
+// of the same name of mesos agent.
+const (
+	AntiAffinityHost = "host"
+	AntiAffinityRack = "rack"
+	AntiAffinityZone = "zone"
+)
+
+// errors
+var (
+	ErrAntiAffinity = errors.New("master and its slave can not be placed into different failure domains")
+	ErrMasterSpread = errors.New("masters can not be spread into different failure domains")
+)
+
+// Domains maps host into its failure domain, the host which absent in
+// Domains is a failure domain of itself.
+type Domains map[string]string
+
+func (d Domains) of(host string) string {
+	if domain, ok := d[host]; ok {
+		return domain
+	}
+	return host
+}
+
+// CheckAntiAffinity checks that each master and its slave of the chunks
+// never share the same failure domain.
+func CheckAntiAffinity(chunks []*Chunk, domains Domains) error {
+	for _, ck := range chunks {
+		// NOTICE: Nodes[1] is slave of Nodes[2] and Nodes[3] is slave of Nodes[0]
+		if domains.of(ck.Nodes[1].Name) == domains.of(ck.Nodes[2].Name) ||
+			domains.of(ck.Nodes[3].Name) == domains.of(ck.Nodes[0].Name) {
+			return ErrAntiAffinity
+		}
+	}
+	return nil
+}
+
+// checkDomainDist checks that no failure domain have more than half nodes,
+// otherwise some master must be linked with slave in the same domain.
+func checkDomainDist(hrs []*hostRes, domains Domains, count int) bool {
+	dcount := make(map[string]int)
+	for _, hr := range hrs {
+		dcount[domains.of(hr.name)] += hr.count
+	}
+	for _, c := range dcount {
+		if c > count/2 {
+			return false
+		}
+	}
+	return true
+}
+
+// linkByDomains links the half chunks of hosts and never links two hosts in
+// the same failure domain. It always links the domain with most nodes left
+// to the other domain with most nodes left, so that no domain will be left
+// alone at last.
+func linkByDomains(hrs []*hostRes, lt [][]int, domains Domains) ([]link, error) {
+	links := []link{}
+	for {
+		left := make(map[string]int)
+		for _, hr := range hrs {
+			left[domains.of(hr.name)] += hr.count
+		}
+
+		m := -1
+		for i, hr := range hrs {
+			if hr.count < 2 {
+				continue
+			}
+			if m == -1 || left[domains.of(hr.name)] > left[domains.of(hrs[m].name)] ||
+				(domains.of(hr.name) == domains.of(hrs[m].name) && hr.count > hrs[m].count) {
+				m = i
+			}
+		}
+		if m == -1 {
+			return links, nil
+		}
+
+		base := domains.of(hrs[m].name)
+		llh := -1
+		for i, hr := range hrs {
+			if hr.count < 2 || domains.of(hr.name) == base {
+				continue
+			}
+			if llh == -1 || left[domains.of(hr.name)] > left[domains.of(hrs[llh].name)] ||
+				(domains.of(hr.name) == domains.of(hrs[llh].name) && lt[m][i] < lt[m][llh]) {
+				llh = i
+			}
+		}
+		if llh == -1 {
+			return nil, ErrAntiAffinity
+		}
+
+		links = append(links, link{Base: hrs[m].name, LinkTo: hrs[llh].name})
+		lt[m][llh]++
+		lt[llh][m]++
+		hrs[m].count -= 2
+		hrs[llh].count -= 2
+	}
+}
+
+// CheckMasterSpread checks that no two masters of the chunks share the same
+// failure domain.
+func CheckMasterSpread(chunks []*Chunk, domains Domains) error {
+	masters := make(map[string]string)
+	for _, ck := range chunks {
+		for _, n := range []*Node{ck.Nodes[0], ck.Nodes[2]} {
+			domain := domains.of(n.Name)
+			if other, ok := masters[domain]; ok {
+				return fmt.Errorf("%v: %s and %s are both in %s", ErrMasterSpread, other, n.Addr(), domain)
+			}
+			masters[domain] = n.Addr()
+		}
+	}
+	return nil
+}
+
+// CheckDistSpread checks that no two instances of the dist share the same
+// failure domain.
+func CheckDistSpread(addrs []*Addr, domains Domains) error {
+	used := make(map[string]string)
+	for _, addr := range addrs {
+		domain := domains.of(addr.IP)
+		if other, ok := used[domain]; ok {
+			return fmt.Errorf("%v: %s and %s are both in %s", ErrMasterSpread, other, addr, domain)
+		}
+		used[domain] = addr.String()
+	}
+	return nil
+}
+
+// spreadHostRes limits the count of hosts so that each failure domain holds
+// at most max nodes together with the used ones, the host with more
+// resource takes the domain first. It returns error if the nodes left are
+// less than need.
+func spreadHostRes(hrs []*hostRes, domains Domains, used map[string]int, max, need int) error {
+	sorted := make([]*hostRes, len(hrs))
+	copy(sorted, hrs)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].count > sorted[j].count })
+	left := make(map[string]int)
+	for _, hr := range sorted {
+		domain := domains.of(hr.name)
+		if _, ok := left[domain]; !ok {
+			left[domain] = max - used[domain]
+			if left[domain] < 0 {
+				left[domain] = 0
+			}
+		}
+		if hr.count > left[domain] {
+			hr.count = left[domain]
+		}
+		left[domain] -= hr.count
+	}
+	if !checkIfEnough(hrs, need) {
+		free := make(map[string]struct{})
+		for _, hr := range hrs {
+			if hr.count > 0 {
+				free[domains.of(hr.name)] = struct{}{}
+			}
+		}
+		return fmt.Errorf("%v: need %d free failure domains but only %d offered", ErrMasterSpread, need/max, len(free))
+	}
+	return nil
+}
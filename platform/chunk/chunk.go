@@ -201,6 +201,37 @@ func dpFillHostRes(chunks []*Chunk, disableHost map[string]struct{}, hrs []*host
 	}
 }
 
+// dpFillHostResByDomains fills the hosts like dpFillHostRes, but always
+// fills the failure domain with the least nodes filled, so that the masters
+// filled can be linked with their slaves in the other domains.
+func dpFillHostResByDomains(chunks []*Chunk, hrs []*hostRes, count int, scale int, domains Domains) (hosts []*hostRes) {
+	hosts = dpFillHostRes(chunks, nil, hrs, 0, scale)
+	all := len(chunks)*2 + count
+	filled := make(map[string]int)
+	for left := count; left > 0; left -= scale {
+		i := -1
+		for idx, hr := range hosts {
+			if hr.count >= all || hrs[idx].count-hr.count < scale {
+				continue
+			}
+			if i == -1 {
+				i = idx
+				continue
+			}
+			fd, fi := filled[domains.of(hr.name)], filled[domains.of(hosts[i].name)]
+			if fd < fi || (fd == fi && hr.count < hosts[i].count) {
+				i = idx
+			}
+		}
+		if i == -1 {
+			return
+		}
+		hosts[i].count += scale
+		filled[domains.of(hosts[i].name)] += scale
+	}
+	return
+}
+
 func findMinHrs(hrs, hosts []*hostRes, disableHost map[string]struct{}, max, scale int) (i int) {
 	var min = max
 	for idx, hr := range hosts {
@@ -306,7 +337,30 @@ func checkDist(hrs []*hostRes, count int) bool {
 
 // Chunks will chunks the given offer.
 func Chunks(masterNum int, memory, cpu float64, offers ...ms.Offer) (chunks []*Chunk, err error) {
-	hrs, err := checkChunk(nil, masterNum, memory, cpu, offers...)
+	return ChunksWithDomains(masterNum, memory, cpu, nil, offers...)
+}
+
+// ChunksWithDomains will chunks the given offer and make sure that each
+// master and its slave are placed into different failure domains.
+func ChunksWithDomains(masterNum int, memory, cpu float64, domains Domains, offers ...ms.Offer) (chunks []*Chunk, err error) {
+	return ChunksWithConstraints(masterNum, memory, cpu, &Constraints{AntiAffinity: domains}, offers...)
+}
+
+// Constraints is the placement constraints of the cluster.
+type Constraints struct {
+	// AntiAffinity is the failure domains which each master and its slave
+	// never share, nil means each host is a domain.
+	AntiAffinity Domains
+	// MasterSpread is the failure domains which no two masters share, nil
+	// means no limit.
+	MasterSpread Domains
+}
+
+// ChunksWithConstraints will chunks the given offer and honor the
+// constraints.
+func ChunksWithConstraints(masterNum int, memory, cpu float64, c *Constraints, offers ...ms.Offer) (chunks []*Chunk, err error) {
+	domains := c.AntiAffinity
+	hrs, err := checkChunk(nil, masterNum, memory, cpu, nil, c.MasterSpread, offers...)
 	if err != nil {
 		return
 	}
@@ -314,6 +368,10 @@ func Chunks(masterNum int, memory, cpu float64, offers ...ms.Offer) (chunks []*C
 		err = ErrBadDist
 		return
 	}
+	if !checkDomainDist(hrs, domains, masterNum*2) {
+		err = ErrAntiAffinity
+		return
+	}
 
 	hrmap := make(map[string]int)
 	for i, hr := range hrs {
@@ -329,6 +387,18 @@ func Chunks(masterNum int, memory, cpu float64, offers ...ms.Offer) (chunks []*C
 		}
 	}
 
+	if len(domains) > 0 {
+		links, err := linkByDomains(hrs, linkTable, domains)
+		if err != nil {
+			return nil, err
+		}
+		chunks = links2Chunks(links, mapIntoPortsMap(offers))
+		if err = CheckAntiAffinity(chunks, domains); err != nil {
+			return nil, err
+		}
+		return chunks, checkMasterSpread(chunks, c.MasterSpread)
+	}
+
 	links := []link{}
 	for {
 		name, count := maxHost(hrs)
@@ -351,6 +421,7 @@ func Chunks(masterNum int, memory, cpu float64, offers ...ms.Offer) (chunks []*C
 	}
 	portsMap := mapIntoPortsMap(offers)
 	chunks = links2Chunks(links, portsMap)
+	err = checkMasterSpread(chunks, c.MasterSpread)
 	return
 }
 
@@ -372,7 +443,21 @@ func GetHostCountInChunks(chunks []*Chunk) map[string][]int {
 
 // ChunksAppend scale masternum with origin chunks.
 func ChunksAppend(chunks []*Chunk, masterNum int, memory, cpu float64, offers ...ms.Offer) (newChunks []*Chunk, err error) {
-	hrs, err := checkChunk(chunks, masterNum, memory, cpu, offers...)
+	return ChunksAppendWithSpread(chunks, masterNum, memory, cpu, nil, offers...)
+}
+
+// ChunksAppendWithSpread scale masternum with origin chunks and never place
+// the new master into the failure domain of spread which holds any master.
+func ChunksAppendWithSpread(chunks []*Chunk, masterNum int, memory, cpu float64, spread Domains, offers ...ms.Offer) (newChunks []*Chunk, err error) {
+	return ChunksAppendWithConstraints(chunks, masterNum, memory, cpu, &Constraints{MasterSpread: spread}, offers...)
+}
+
+// ChunksAppendWithConstraints scale masternum with origin chunks and honor
+// the constraints, the new masters and their slaves are linked by failure
+// domains as ChunksWithConstraints does.
+func ChunksAppendWithConstraints(chunks []*Chunk, masterNum int, memory, cpu float64, c *Constraints, offers ...ms.Offer) (newChunks []*Chunk, err error) {
+	domains, spread := c.AntiAffinity, c.MasterSpread
+	hrs, err := checkChunk(chunks, masterNum, memory, cpu, domains, spread, offers...)
 	if err != nil {
 		return
 	}
@@ -412,6 +497,22 @@ func ChunksAppend(chunks []*Chunk, masterNum int, memory, cpu float64, offers ..
 		}
 	}
 
+	portsMap := mapIntoPortsMap(offers)
+	if len(domains) > 0 {
+		if !checkDomainDist(hrs, domains, masterNum*2) {
+			return nil, ErrAntiAffinity
+		}
+		links, err := linkByDomains(hrs, linkTable, domains)
+		if err != nil {
+			return nil, err
+		}
+		newChunks = links2Chunks(links, portsMap)
+		if err = CheckAntiAffinity(newChunks, domains); err != nil {
+			return nil, err
+		}
+		return newChunks, checkMasterSpread(append(newChunks, chunks...), spread)
+	}
+
 	for {
 		name, count := maxHost(hrs)
 		if count == 0 {
@@ -430,12 +531,22 @@ func ChunksAppend(chunks []*Chunk, masterNum int, memory, cpu float64, offers ..
 		hrs[m].count -= 2
 		hrs[llh].count -= 2
 	}
-	portsMap := mapIntoPortsMap(offers)
 	newChunks = links2Chunks(links, portsMap)
+	err = checkMasterSpread(append(newChunks, chunks...), spread)
 	return
 }
 
-func checkChunk(chunk []*Chunk, masterNum int, memory, cpu float64, offers ...ms.Offer) (hrs []*hostRes, err error) {
+func checkMasterSpread(chunks []*Chunk, spread Domains) error {
+	if len(spread) == 0 {
+		return nil
+	}
+	return CheckMasterSpread(chunks, spread)
+}
+
+// checkChunk fills the hosts with the new masters, the hosts are filled by
+// the failure domains if fill given, which balances the few new masters of
+// scaling among the domains.
+func checkChunk(chunk []*Chunk, masterNum int, memory, cpu float64, fill, spread Domains, offers ...ms.Offer) (hrs []*hostRes, err error) {
 	if masterNum%2 != 0 {
 		err = ErrBadMasterNum
 		return
@@ -455,12 +566,28 @@ func checkChunk(chunk []*Chunk, masterNum int, memory, cpu float64, offers ...ms
 		err = ErrNotEnoughResource
 		return
 	}
+	if len(spread) > 0 {
+		// NOTICE: each master is a half chunk, so a domain holds 2 nodes at most.
+		used := make(map[string]int)
+		for _, ck := range chunk {
+			used[spread.of(ck.Nodes[0].Name)] += 2
+			used[spread.of(ck.Nodes[2].Name)] += 2
+		}
+		if err = spreadHostRes(hrs, spread, used, 2, masterNum*2); err != nil {
+			return
+		}
+	}
 	sort.Sort(byCountDesc(hrs))
 	hrmap := make(map[string]int)
 	for i, hr := range hrs {
 		hrmap[hr.name] = i
 	}
-	hrs = dpFillHostRes(chunk, nil, hrs, masterNum*2, 2) // NOTICE: each master is a half chunk
+	// NOTICE: each master is a half chunk
+	if len(fill) > 0 {
+		hrs = dpFillHostResByDomains(chunk, hrs, masterNum*2, 2, fill)
+	} else {
+		hrs = dpFillHostRes(chunk, nil, hrs, masterNum*2, 2)
+	}
 	return
 }
 
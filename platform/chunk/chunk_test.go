@@ -145,3 +145,91 @@ func TestNodeIntoConfLineOk(t *testing.T) {
 	line = node.IntoConfLine(false)
 	assert.Equal(t, "0000000000000000000000000000000000000001 127.0.0.1:7000@17000 master - 0 0 0 connected 1 12-20 700-800\n", line)
 }
+
+func TestChunksWithDomains(t *testing.T) {
+	offers := _createOffers(6, 128*1024, 32, 7000, 8000)
+	domains := Domains{
+		"host-0": "rack-0", "host-1": "rack-0",
+		"host-2": "rack-1", "host-3": "rack-1",
+		"host-4": "rack-2", "host-5": "rack-2",
+	}
+	chunks, err := ChunksWithDomains(6, 100.0, 1.0, domains, offers...)
+	assert.NoError(t, err)
+	assert.Len(t, chunks, 3)
+	assert.NoError(t, CheckAntiAffinity(chunks, domains))
+
+	domains = Domains{"host-0": "rack-0", "host-1": "rack-0", "host-2": "rack-0", "host-3": "rack-0"}
+	_, err = ChunksWithDomains(6, 100.0, 1.0, domains, offers...)
+	assert.Equal(t, ErrAntiAffinity, err)
+}
+
+func TestChunksAppendWithDomains(t *testing.T) {
+	offers := _createOffers(6, 128*1024, 32, 7000, 8000)
+	domains := Domains{
+		"host-0": "rack-0", "host-1": "rack-0",
+		"host-2": "rack-1", "host-3": "rack-1",
+		"host-4": "rack-2", "host-5": "rack-2",
+	}
+	chunks, err := ChunksWithDomains(6, 100.0, 1.0, domains, offers...)
+	assert.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		newChunks, err := ChunksAppendWithConstraints(chunks, 2, 100.0, 1.0, &Constraints{AntiAffinity: domains}, offers...)
+		assert.NoError(t, err)
+		assert.Len(t, newChunks, 1)
+		assert.NoError(t, CheckAntiAffinity(newChunks, domains))
+		chunks = append(chunks, newChunks...)
+	}
+
+	// only one rack offered.
+	_, err = ChunksAppendWithConstraints(chunks, 2, 100.0, 1.0, &Constraints{AntiAffinity: domains}, offers[:2]...)
+	assert.Error(t, err)
+	domains = Domains{"host-0": "rack-0", "host-1": "rack-0", "host-2": "rack-0"}
+	_, err = ChunksAppendWithConstraints(chunks, 2, 100.0, 1.0, &Constraints{AntiAffinity: domains}, offers[:3]...)
+	assert.Equal(t, ErrAntiAffinity, err)
+}
+
+func TestCheckAntiAffinity(t *testing.T) {
+	chunks := []*Chunk{{Nodes: []*Node{
+		{Name: "host-0", Role: RoleMaster},
+		{Name: "host-0", Role: RoleSlave},
+		{Name: "host-1", Role: RoleMaster},
+		{Name: "host-1", Role: RoleSlave},
+	}}}
+	assert.NoError(t, CheckAntiAffinity(chunks, nil))
+	assert.Equal(t, ErrAntiAffinity, CheckAntiAffinity(chunks, Domains{"host-0": "rack-0", "host-1": "rack-0"}))
+}
+
+func TestChunksWithMasterSpread(t *testing.T) {
+	offers := _createOffers(6, 128*1024, 32, 7000, 8000)
+	spread := Domains{
+		"host-0": "rack-0", "host-1": "rack-1", "host-2": "rack-2",
+		"host-3": "rack-3", "host-4": "rack-4", "host-5": "rack-0",
+	}
+	chunks, err := ChunksWithConstraints(4, 100.0, 1.0, &Constraints{MasterSpread: spread}, offers...)
+	assert.NoError(t, err)
+	assert.Len(t, chunks, 2)
+	assert.NoError(t, CheckMasterSpread(chunks, spread))
+
+	_, err = ChunksWithConstraints(6, 100.0, 1.0, &Constraints{MasterSpread: spread}, offers...)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), ErrMasterSpread.Error())
+
+	newChunks, err := ChunksAppendWithSpread(chunks, 0, 100.0, 1.0, spread, offers...)
+	assert.NoError(t, err)
+	assert.Len(t, newChunks, 0)
+	_, err = ChunksAppendWithSpread(chunks, 2, 100.0, 1.0, spread, offers...)
+	assert.Error(t, err)
+}
+
+func TestCheckMasterSpread(t *testing.T) {
+	chunks := []*Chunk{{Nodes: []*Node{
+		{Name: "host-0", Port: 7000, Role: RoleMaster},
+		{Name: "host-0", Port: 7001, Role: RoleSlave},
+		{Name: "host-1", Port: 7000, Role: RoleMaster},
+		{Name: "host-1", Port: 7001, Role: RoleSlave},
+	}}}
+	assert.NoError(t, CheckMasterSpread(chunks, nil))
+	err := CheckMasterSpread(chunks, Domains{"host-0": "zone-0", "host-1": "zone-0"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "zone-0")
+}
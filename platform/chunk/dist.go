@@ -43,7 +43,19 @@ func mapHostResIntoDist(hrs []*hostRes, portsMap map[string][]int) *Dist {
 
 // DistIt will cacluate Dist by the given offer.
 func DistIt(num int, mem, cpu float64, offers ...ms.Offer) (dist *Dist, err error) {
-	hrs := dpFillHostRes(nil, nil, mapIntoHostRes(offers, mem, cpu), num, 1)
+	return DistWithSpread(num, mem, cpu, nil, offers...)
+}
+
+// DistWithSpread will cacluate Dist by the given offer and never place two
+// instances into the same failure domain of spread, nil spread means no limit.
+func DistWithSpread(num int, mem, cpu float64, spread Domains, offers ...ms.Offer) (dist *Dist, err error) {
+	hrs := mapIntoHostRes(offers, mem, cpu)
+	if len(spread) > 0 {
+		if err = spreadHostRes(hrs, spread, nil, 1, num); err != nil {
+			return
+		}
+	}
+	hrs = dpFillHostRes(nil, nil, hrs, num, 1)
 	if !checkDist(hrs, num) {
 		err = ErrBadDist
 		return
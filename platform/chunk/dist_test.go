@@ -34,3 +34,15 @@ func TestDistAppendItNotOffers(t *testing.T) {
 	assert.Len(t, newDist.Addrs, 2)
 	t.Log(dist.Addrs)
 }
+
+func TestDistWithSpread(t *testing.T) {
+	offers := _createOffers(5, 100, 20, 1000, 2000)
+	spread := Domains{"host-0": "rack-0", "host-1": "rack-0", "host-2": "rack-1", "host-3": "rack-2", "host-4": "rack-3"}
+	dist, err := DistWithSpread(4, 10, 1, spread, offers...)
+	assert.NoError(t, err)
+	assert.Len(t, dist.Addrs, 4)
+	assert.NoError(t, CheckDistSpread(dist.Addrs, spread))
+
+	_, err = DistWithSpread(5, 10, 1, spread, offers...)
+	assert.Error(t, err)
+}
@@ -0,0 +1,283 @@
+// Package backup saves the rdb snapshots of cluster instances into the
+// object storage as backup sets, and restores the cluster from them.
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"overlord/anzi"
+	"overlord/pkg/objstore"
+	"overlord/pkg/types"
+	"overlord/proxy"
+)
+
+const (
+	manifestName = "manifest.json"
+	// idFormat makes the id of backup set sorted by time.
+	idFormat = "20060102150405"
+)
+
+// Config is the config of backup storage and retention policy.
+type Config struct {
+	*objstore.Config
+	// Prefix is the prefix of object key, the objects of backup set are
+	// saved as <prefix>/<cluster>/<id>/.
+	Prefix string `toml:"prefix"`
+	// Retention is the count of the latest backup sets kept of each
+	// cluster, 0 means no limit.
+	Retention int `toml:"retention"`
+	// MaxAge is the days to keep the backup set, 0 means no limit. The
+	// latest backup set is always kept.
+	MaxAge int `toml:"max_age"`
+	// PipelineWindow is the max commands in flight of each rdb restoring.
+	PipelineWindow int `toml:"pipeline_window"`
+}
+
+// Node is the rdb of an instance in backup set.
+type Node struct {
+	Addr string `json:"addr"`
+	// Alias is the alias of redis instance in the hash ring of proxy, the
+	// rdb is restored into the instance with the same alias.
+	Alias string `json:"alias,omitempty"`
+	Key   string `json:"key"`
+	Size  int64  `json:"size"`
+}
+
+// Set is the backup of all the instances of a cluster.
+type Set struct {
+	ID        string          `json:"id"`
+	Cluster   string          `json:"cluster"`
+	CacheType types.CacheType `json:"cache_type"`
+	Version   string          `json:"version"`
+	Time      time.Time       `json:"time"`
+	Nodes     []*Node         `json:"nodes"`
+}
+
+// NewSet new the backup set of nodes at now.
+func NewSet(cluster string, cacheType types.CacheType, version string, nodes []*Node, now time.Time) *Set {
+	return &Set{
+		ID:        now.Format(idFormat),
+		Cluster:   cluster,
+		CacheType: cacheType,
+		Version:   version,
+		Time:      now,
+		Nodes:     nodes,
+	}
+}
+
+// Backuper backups and restores clusters by the object storage.
+type Backuper struct {
+	cfg   *Config
+	store *objstore.Store
+}
+
+// New new the backuper, error if the object storage is not configured.
+func New(cfg *Config) (*Backuper, error) {
+	if cfg == nil {
+		return nil, objstore.ErrConfigInvalid
+	}
+	store, err := objstore.New(cfg.Config)
+	if err != nil {
+		return nil, err
+	}
+	return &Backuper{cfg: cfg, store: store}, nil
+}
+
+func (b *Backuper) key(elems ...string) string {
+	return path.Join(append([]string{b.cfg.Prefix}, elems...)...)
+}
+
+// Backup snapshots the rdb of the nodes of set one by one and uploads them,
+// the manifest is uploaded at last so that only the finished set is listed.
+func (b *Backuper) Backup(ctx context.Context, set *Set, logf func(format string, args ...interface{})) (err error) {
+	if set.CacheType == types.CacheTypeMemcache {
+		return fmt.Errorf("backup is not supported by %s", set.CacheType)
+	}
+	for _, n := range set.Nodes {
+		n.Key = b.key(set.Cluster, set.ID, strings.Replace(n.Addr, ":", "_", -1)+".rdb")
+		rc, size, serr := anzi.Snapshot(n.Addr)
+		if serr != nil {
+			return fmt.Errorf("snapshot %s err %v", n.Addr, serr)
+		}
+		err = b.store.Put(ctx, n.Key, rc, size)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("upload rdb of %s err %v", n.Addr, err)
+		}
+		n.Size = size
+		logf("rdb of %s saved as %s with %d bytes", n.Addr, n.Key, size)
+	}
+	data, err := json.Marshal(set)
+	if err != nil {
+		return
+	}
+	return b.store.Put(ctx, b.key(set.Cluster, set.ID, manifestName), bytes.NewReader(data), int64(len(data)))
+}
+
+// Sets lists the backup sets of cluster, the latest first.
+func (b *Backuper) Sets(ctx context.Context, cluster string) ([]*Set, error) {
+	objs, err := b.store.List(ctx, b.key(cluster)+"/")
+	if err != nil {
+		return nil, err
+	}
+	var sets []*Set
+	for _, obj := range objs {
+		if path.Base(obj.Key) != manifestName {
+			continue
+		}
+		set, err := b.manifest(ctx, obj.Key)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, set)
+	}
+	sort.Slice(sets, func(i, j int) bool { return sets[i].ID > sets[j].ID })
+	return sets, nil
+}
+
+// Get gets the backup set id of cluster.
+func (b *Backuper) Get(ctx context.Context, cluster, id string) (*Set, error) {
+	return b.manifest(ctx, b.key(cluster, id, manifestName))
+}
+
+func (b *Backuper) manifest(ctx context.Context, key string) (*Set, error) {
+	rc, err := b.store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	set := &Set{}
+	if err = json.NewDecoder(rc).Decode(set); err != nil {
+		return nil, fmt.Errorf("decode manifest %s err %v", key, err)
+	}
+	return set, nil
+}
+
+// Expire deletes the backup sets of cluster out of the retention policy and
+// returns them.
+func (b *Backuper) Expire(ctx context.Context, cluster string, now time.Time) ([]*Set, error) {
+	sets, err := b.Sets(ctx, cluster)
+	if err != nil {
+		return nil, err
+	}
+	expired := Expired(sets, b.cfg.Retention, time.Duration(b.cfg.MaxAge)*24*time.Hour, now)
+	for _, set := range expired {
+		if err = b.delete(ctx, set); err != nil {
+			return nil, err
+		}
+	}
+	return expired, nil
+}
+
+// delete deletes the manifest first, so that the set is never listed once
+// it's broken.
+func (b *Backuper) delete(ctx context.Context, set *Set) (err error) {
+	if err = b.store.Delete(ctx, b.key(set.Cluster, set.ID, manifestName)); err != nil {
+		return
+	}
+	objs, err := b.store.List(ctx, b.key(set.Cluster, set.ID)+"/")
+	if err != nil {
+		return
+	}
+	for _, obj := range objs {
+		if err = b.store.Delete(ctx, obj.Key); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Expired returns the backup sets out of the latest retention or older than
+// maxAge, sets must be sorted as the latest first and the latest one is
+// never expired.
+func Expired(sets []*Set, retention int, maxAge time.Duration, now time.Time) (expired []*Set) {
+	for i, set := range sets {
+		if i == 0 {
+			continue
+		}
+		if (retention > 0 && i >= retention) || (maxAge > 0 && now.Sub(set.Time) > maxAge) {
+			expired = append(expired, set)
+		}
+	}
+	return
+}
+
+// Restore replays the rdb of set into the instances to of cacheType. The
+// rdb of redis is restored into the instance with the same alias, and the
+// rdb of redis cluster is restored through proxy as the slots are now.
+// NOTICE: the keys not in the set are kept.
+func (b *Backuper) Restore(ctx context.Context, set *Set, cacheType types.CacheType, to []*Node, logf func(format string, args ...interface{})) (err error) {
+	var load func(n *Node, rd io.Reader) (*anzi.Source, error)
+	switch cacheType {
+	case types.CacheTypeRedis:
+		aliases := make(map[string]string)
+		for _, n := range to {
+			aliases[n.Alias] = n.Addr
+		}
+		load = func(n *Node, rd io.Reader) (*anzi.Source, error) {
+			target, ok := aliases[n.Alias]
+			if !ok {
+				return nil, fmt.Errorf("no instance of alias %s to restore", n.Alias)
+			}
+			return anzi.Restore(rd, target, b.cfg.PipelineWindow)
+		}
+	case types.CacheTypeRedisCluster:
+		var proc *anzi.RestoreProc
+		if proc, err = b.restoreProc(set, to); err != nil {
+			return
+		}
+		defer proc.Close()
+		load = func(n *Node, rd io.Reader) (*anzi.Source, error) {
+			return proc.Load(rd)
+		}
+	default:
+		return fmt.Errorf("restore is not supported by %s", cacheType)
+	}
+
+	for _, n := range set.Nodes {
+		var rc io.ReadCloser
+		if rc, err = b.store.Get(ctx, n.Key); err != nil {
+			return fmt.Errorf("download rdb of %s err %v", n.Addr, err)
+		}
+		s, lerr := load(n, rc)
+		rc.Close()
+		if lerr != nil {
+			return fmt.Errorf("restore rdb of %s err %v", n.Addr, lerr)
+		}
+		logf("rdb of %s restored with %d commands, %d replied error", n.Addr, s.Commands, s.Errors)
+	}
+	return
+}
+
+// restoreProc serves the proxy of redis cluster at a free local port.
+func (b *Backuper) restoreProc(set *Set, to []*Node) (*anzi.RestoreProc, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	addr := l.Addr().String()
+	l.Close()
+	servers := make([]string, 0, len(to))
+	for _, n := range to {
+		servers = append(servers, n.Addr)
+	}
+	return anzi.NewRestoreProc(&proxy.ClusterConfig{
+		Name:         "restore-" + set.Cluster + "-" + set.ID,
+		CacheType:    types.CacheTypeRedisCluster,
+		ListenProto:  "tcp",
+		ListenAddr:   addr,
+		DialTimeout:  1000,
+		ReadTimeout:  3000,
+		WriteTimeout: 3000,
+		Servers:      servers,
+	}, b.cfg.PipelineWindow)
+}
@@ -0,0 +1,39 @@
+package backup
+
+import (
+	"testing"
+	"time"
+
+	"overlord/pkg/objstore"
+	"overlord/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpired(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	var sets []*Set
+	for i := 0; i < 5; i++ {
+		// NOTE: the latest first as listed.
+		sets = append(sets, NewSet("c1", types.CacheTypeRedis, "5.0", nil, now.Add(-time.Duration(i)*24*time.Hour)))
+	}
+	assert.Equal(t, "20261016120000", sets[0].ID)
+
+	assert.Empty(t, Expired(sets, 0, 0, now))
+	assert.Equal(t, sets[3:], Expired(sets, 3, 0, now))
+	assert.Equal(t, sets[2:], Expired(sets, 0, 36*time.Hour, now))
+	assert.Equal(t, sets[2:], Expired(sets, 4, 36*time.Hour, now))
+	// the latest one is kept even if too old.
+	assert.Equal(t, sets[1:], Expired(sets, 0, time.Hour, now.Add(48*time.Hour)))
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(nil)
+	assert.Error(t, err)
+	b, err := New(&Config{
+		Config: &objstore.Config{Endpoint: "http://127.0.0.1:9000", Bucket: "overlord", PathStyle: true},
+		Prefix: "backups",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "backups/c1/20261016120000/manifest.json", b.key("c1", "20261016120000", manifestName))
+}
@@ -0,0 +1,297 @@
+package balance
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"overlord/pkg/myredis"
+	"overlord/platform/job/fix"
+)
+
+// define default value of slots balancing
+const (
+	DefaultKeysPerBatch = 100
+	DefaultBatchPause   = 10 * time.Millisecond
+	// DefaultTolerance is the ratio of the gap between the max and min
+	// memory of masters to the average, which is balanced enough.
+	DefaultTolerance = 0.1
+
+	migrateTimeout = 5000
+)
+
+// Load is the data of a master of redis cluster.
+type Load struct {
+	Addr string `json:"addr"`
+	ID   string `json:"id"`
+	// Memory is the bytes of dataset, each slot takes the memory in
+	// proportion to its keys.
+	Memory int64 `json:"memory"`
+	Keys   int64 `json:"keys"`
+	Slots  int   `json:"slots"`
+	// After is the memory after the moves.
+	After int64 `json:"after"`
+
+	keys map[int]int64
+}
+
+func (l *Load) slotMemory(slot int) int64 {
+	if l.Keys == 0 {
+		return 0
+	}
+	return l.Memory * l.keys[slot] / l.Keys
+}
+
+// Move moves the slot and its keys from the master to another.
+type Move struct {
+	Slot   int    `json:"slot"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Keys   int64  `json:"keys"`
+	Memory int64  `json:"memory"`
+}
+
+// Report is the plan of slots balancing, which is the result of dry run.
+type Report struct {
+	Masters []*Load `json:"masters"`
+	Moves   []*Move `json:"moves"`
+}
+
+// Throttle limits the speed of keys migrating.
+type Throttle struct {
+	// KeysPerBatch is the keys migrated by a MIGRATE command.
+	KeysPerBatch int
+	// Pause is the sleep between batches.
+	Pause time.Duration
+}
+
+// LoadMasters gets the memory and the keys of each slot of the alive
+// masters of redis cluster by INFO and CLUSTER COUNTKEYSINSLOT.
+func LoadMasters(addrs []string, logf func(format string, args ...interface{})) ([]*Load, error) {
+	c, err := fix.Load(addrs, logf)
+	if err != nil {
+		return nil, err
+	}
+	if r := c.Diagnose(); len(r.Uncovered) > 0 || len(r.Failed) > 0 || len(r.Conflicts) > 0 {
+		return nil, fmt.Errorf("cluster need fix first: %s", r)
+	}
+	var loads []*Load
+	for _, n := range c.Nodes {
+		if !n.Alive || !n.Master {
+			continue
+		}
+		l, err := loadMaster(n)
+		if err != nil {
+			return nil, err
+		}
+		loads = append(loads, l)
+	}
+	return loads, nil
+}
+
+func loadMaster(n *fix.Node) (*Load, error) {
+	conn := myredis.NewConn(n.Addr)
+	defer conn.Close()
+	resp, err := conn.Exec(myredis.NewCmd("INFO").Arg("memory"))
+	if err != nil {
+		return nil, err
+	}
+	if resp.RType != myredis.RespBulk {
+		return nil, fmt.Errorf("get wrong reply of %s %s", n.Addr, strconv.Quote(string(resp.Data)))
+	}
+	l := &Load{Addr: n.Addr, ID: n.ID, Slots: len(n.Slots), keys: make(map[int]int64)}
+	l.Memory = datasetMemory(resp.Data)
+	for _, slot := range n.Slots {
+		resp, err = conn.Exec(myredis.NewCmd("CLUSTER").Arg("COUNTKEYSINSLOT", strconv.Itoa(slot)))
+		if err != nil {
+			return nil, err
+		}
+		if resp.RType != myredis.RespInt {
+			return nil, fmt.Errorf("count keys in slot %d of %s err %s", slot, n.Addr, resp.Data)
+		}
+		count, _ := strconv.ParseInt(string(resp.Data), 10, 64)
+		if count > 0 {
+			l.keys[slot] = count
+			l.Keys += count
+		}
+	}
+	return l, nil
+}
+
+// datasetMemory returns the used_memory_dataset of INFO memory, or the
+// used_memory before redis 4.0.
+func datasetMemory(data []byte) int64 {
+	info := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if idx := strings.IndexByte(line, ':'); idx > 0 {
+			info[line[:idx]] = line[idx+1:]
+		}
+	}
+	val, ok := info["used_memory_dataset"]
+	if !ok {
+		val = info["used_memory"]
+	}
+	memory, _ := strconv.ParseInt(val, 10, 64)
+	return memory
+}
+
+// PlanSlots plans the moves of slots to equalize the memory of masters
+// rather than the slot counts. The largest slot no more than the half gap
+// between the most and the least loaded masters moves each time, until
+// the gap is within tolerance of the average. Each slot moves once at most
+// and the empty slots never move.
+func PlanSlots(loads []*Load, tolerance float64) *Report {
+	r := &Report{Masters: loads}
+	if len(loads) < 2 {
+		return r
+	}
+	if tolerance <= 0 {
+		tolerance = DefaultTolerance
+	}
+	var total int64
+	for _, l := range loads {
+		l.After = l.Memory
+		total += l.Memory
+	}
+	avg := float64(total) / float64(len(loads))
+	// slots of each master by memory desc.
+	slots := make(map[*Load][]int)
+	for _, l := range loads {
+		for slot := range l.keys {
+			slots[l] = append(slots[l], slot)
+		}
+		ss := slots[l]
+		sort.Slice(ss, func(i, j int) bool {
+			mi, mj := l.slotMemory(ss[i]), l.slotMemory(ss[j])
+			return mi > mj || (mi == mj && ss[i] < ss[j])
+		})
+	}
+	for {
+		src, dst := loads[0], loads[0]
+		for _, l := range loads[1:] {
+			if l.After > src.After {
+				src = l
+			}
+			if l.After < dst.After {
+				dst = l
+			}
+		}
+		gap := src.After - dst.After
+		if float64(gap) <= tolerance*avg {
+			return r
+		}
+		idx := -1
+		for i, slot := range slots[src] {
+			if m := src.slotMemory(slot); m > 0 && m <= gap/2 {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return r
+		}
+		slot := slots[src][idx]
+		slots[src] = append(slots[src][:idx], slots[src][idx+1:]...)
+		m := src.slotMemory(slot)
+		src.After -= m
+		dst.After += m
+		r.Moves = append(r.Moves, &Move{Slot: slot, From: src.Addr, To: dst.Addr, Keys: src.keys[slot], Memory: m})
+	}
+}
+
+// MigrateSlots migrates the slots of moves with the keys throttled, and
+// then announces the new owner to all the masters.
+func MigrateSlots(ctx context.Context, r *Report, th *Throttle, logf func(format string, args ...interface{})) error {
+	if th.KeysPerBatch <= 0 {
+		th.KeysPerBatch = DefaultKeysPerBatch
+	}
+	ids := make(map[string]string)
+	for _, l := range r.Masters {
+		ids[l.Addr] = l.ID
+	}
+	for i, mv := range r.Moves {
+		if err := migrateSlot(ctx, mv, ids, th); err != nil {
+			return fmt.Errorf("migrate slot %d from %s to %s err %v", mv.Slot, mv.From, mv.To, err)
+		}
+		logf("slot %d with %d keys migrated from %s to %s (%d/%d)", mv.Slot, mv.Keys, mv.From, mv.To, i+1, len(r.Moves))
+	}
+	return nil
+}
+
+func migrateSlot(ctx context.Context, mv *Move, ids map[string]string, th *Throttle) (err error) {
+	slot := strconv.Itoa(mv.Slot)
+	src, dst := myredis.NewConn(mv.From), myredis.NewConn(mv.To)
+	defer src.Close()
+	defer dst.Close()
+	if err = do(dst, "CLUSTER", "SETSLOT", slot, "IMPORTING", ids[mv.From]); err != nil {
+		return
+	}
+	if err = do(src, "CLUSTER", "SETSLOT", slot, "MIGRATING", ids[mv.To]); err != nil {
+		return
+	}
+	host, port, err := net.SplitHostPort(mv.To)
+	if err != nil {
+		return
+	}
+	for {
+		resp, err := src.Exec(myredis.NewCmd("CLUSTER").Arg("GETKEYSINSLOT", slot, strconv.Itoa(th.KeysPerBatch)))
+		if err != nil {
+			return err
+		}
+		if resp.RType != myredis.RespArray {
+			return fmt.Errorf("get keys in slot %s err %s", slot, resp.Data)
+		}
+		if len(resp.Array) == 0 {
+			break
+		}
+		args := []string{host, port, "", "0", strconv.Itoa(migrateTimeout), "KEYS"}
+		for _, key := range resp.Array {
+			// NOTE: the bulk data ends with CRLF.
+			args = append(args, string(key.Data[:len(key.Data)-2]))
+		}
+		if err = do(src, "MIGRATE", args...); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(th.Pause):
+		}
+	}
+	// NOTE: the destination first, so that the slot is never lost if the
+	// source fails before the new owner propagated.
+	if err = do(dst, "CLUSTER", "SETSLOT", slot, "NODE", ids[mv.To]); err != nil {
+		return
+	}
+	if err = do(src, "CLUSTER", "SETSLOT", slot, "NODE", ids[mv.To]); err != nil {
+		return
+	}
+	for addr := range ids {
+		if addr == mv.From || addr == mv.To {
+			continue
+		}
+		conn := myredis.NewConn(addr)
+		err = do(conn, "CLUSTER", "SETSLOT", slot, "NODE", ids[mv.To])
+		conn.Close()
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func do(conn *myredis.Conn, cmd string, args ...string) error {
+	resp, err := conn.Exec(myredis.NewCmd(cmd).Arg(args...))
+	if err != nil {
+		return err
+	}
+	if resp.RType == myredis.RespError {
+		return fmt.Errorf("%s %s replied %s", cmd, strings.Join(args, " "), resp.Data)
+	}
+	return nil
+}
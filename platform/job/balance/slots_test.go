@@ -0,0 +1,42 @@
+package balance
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDatasetMemory(t *testing.T) {
+	assert.Equal(t, int64(2048), datasetMemory([]byte("# Memory\r\nused_memory:4096\r\nused_memory_dataset:2048\r\n")))
+	assert.Equal(t, int64(4096), datasetMemory([]byte("# Memory\r\nused_memory:4096\r\n")))
+}
+
+func TestPlanSlots(t *testing.T) {
+	// m1 is 3 times of m2 with the same slots, m3 is new and empty.
+	m1 := &Load{Addr: "127.0.0.1:7000", ID: "m1", Memory: 6000, Keys: 600, Slots: 3,
+		keys: map[int]int64{0: 300, 1: 200, 2: 100}}
+	m2 := &Load{Addr: "127.0.0.1:7001", ID: "m2", Memory: 2000, Keys: 200, Slots: 3,
+		keys: map[int]int64{3: 100, 4: 50, 5: 50}}
+	m3 := &Load{Addr: "127.0.0.1:7002", ID: "m3"}
+	r := PlanSlots([]*Load{m1, m2, m3}, 0)
+	assert.Equal(t, []*Move{
+		{Slot: 0, From: m1.Addr, To: m3.Addr, Keys: 300, Memory: 3000},
+	}, r.Moves)
+	// the gap between m1 and m2 is still out of tolerance, but any slot of
+	// m1 is too large to move.
+	assert.Equal(t, int64(3000), m1.After)
+	assert.Equal(t, int64(2000), m2.After)
+	assert.Equal(t, int64(3000), m3.After)
+
+	// the big slot never moves if it makes the gap larger.
+	big := &Load{Addr: "127.0.0.1:7000", ID: "m1", Memory: 1000, Keys: 10, Slots: 1, keys: map[int]int64{0: 10}}
+	empty := &Load{Addr: "127.0.0.1:7001", ID: "m2"}
+	r = PlanSlots([]*Load{big, empty}, 0)
+	assert.Empty(t, r.Moves)
+
+	// balanced enough within tolerance.
+	a := &Load{Addr: "127.0.0.1:7000", ID: "m1", Memory: 1050, Keys: 2, Slots: 2, keys: map[int]int64{0: 1, 1: 1}}
+	b := &Load{Addr: "127.0.0.1:7001", ID: "m2", Memory: 950, Keys: 2, Slots: 2, keys: map[int]int64{2: 1, 3: 1}}
+	r = PlanSlots([]*Load{a, b}, 0.2)
+	assert.Empty(t, r.Moves)
+}
@@ -44,6 +44,7 @@ func SetWorkDir(path string) {
 type DeployInfo struct {
 	// JobID is the id of global job
 	JobID   string
+	Group   string
 	Cluster string
 
 	CacheType types.CacheType
@@ -96,6 +97,7 @@ func GenDeployInfo(e *etcd.Etcd, ip string, port int) (info *DeployInfo, err err
 	}
 	// NOTE:(everpcpc) more info could be extracted from clusterinfo
 	info.Image = cinfo.Image
+	info.Group = cinfo.Group
 
 	if info.CacheType == types.CacheTypeRedisCluster {
 		val, err = e.Get(sub, fmt.Sprintf("%s/role", instanceDir))
@@ -409,6 +411,14 @@ func SetupCacheService(info *DeployInfo) (p *proc.Proc, err error) {
 	return
 }
 
+// RestartCacheService will start the cache service again in the workdir
+// set up before, so that the data and nodes conf are kept.
+func RestartCacheService(info *DeployInfo) (p *proc.Proc, err error) {
+	p = newproc(info.CacheType, info.Version, info.Port)
+	err = p.Start()
+	return
+}
+
 // SetupCacheContainer will create new cache service with container
 func SetupCacheContainer(info *DeployInfo) (c *container.Container, err error) {
 	workdir, err := setupWorkDir(info)
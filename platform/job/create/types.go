@@ -28,4 +28,9 @@ type CacheInfo struct {
 
 	Chunks []*chunk.Chunk
 	IDMap  map[string]map[int]string
+
+	// AntiAffinity is the failure domain level which master and slave never share.
+	AntiAffinity string
+	// MasterSpread is the failure domain level which no two masters share.
+	MasterSpread string
 }
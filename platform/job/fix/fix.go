@@ -0,0 +1,621 @@
+// Package fix diagnoses the slot coverage of redis cluster by the CLUSTER
+// NODES of its instances, and repairs it by the cluster commands natively.
+package fix
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"overlord/pkg/myredis"
+)
+
+// define default value
+const (
+	SlotsCount = 16384
+
+	DefaultTimeout = 60 * time.Second
+
+	checkInterval = time.Second
+)
+
+// Node is an instance of redis cluster parsed from a line of CLUSTER NODES.
+type Node struct {
+	ID       string
+	Addr     string
+	Myself   bool
+	Master   bool
+	Fail     bool
+	MasterID string
+	Epoch    int64
+	Slots    []int
+	// Alive means the CLUSTER NODES of the node itself is got, which is the
+	// truth of its role, epoch and slots.
+	Alive bool
+}
+
+func (n *Node) String() string {
+	return n.Addr + "(" + n.ID + ")"
+}
+
+// ParseNodes parses the reply of CLUSTER NODES, the slots in migrating or
+// importing state are ignored:
+//
+//	<id> <ip:port@cport> <flags> <master> <ping-sent> <pong-recv> <config-epoch> <link-state> <slot> ...
+func ParseNodes(data []byte) ([]*Node, error) {
+	var nodes []*Node
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 8 {
+			return nil, fmt.Errorf("bad line of cluster nodes %s", strconv.Quote(line))
+		}
+		n := &Node{ID: fields[0], Addr: fields[1]}
+		if idx := strings.IndexAny(n.Addr, "@,"); idx >= 0 {
+			n.Addr = n.Addr[:idx]
+		}
+		for _, flag := range strings.Split(fields[2], ",") {
+			switch flag {
+			case "myself":
+				n.Myself = true
+			case "master":
+				n.Master = true
+			case "fail":
+				n.Fail = true
+			}
+		}
+		if fields[3] != "-" {
+			n.MasterID = fields[3]
+		}
+		epoch, err := strconv.ParseInt(fields[6], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad config epoch of %s %v", n.ID, err)
+		}
+		n.Epoch = epoch
+		for _, item := range fields[8:] {
+			if strings.HasPrefix(item, "[") {
+				continue
+			}
+			begin, end := item, item
+			if idx := strings.IndexByte(item, '-'); idx > 0 {
+				begin, end = item[:idx], item[idx+1:]
+			}
+			b, err := strconv.Atoi(begin)
+			if err != nil {
+				return nil, fmt.Errorf("bad slot %s of %s", item, n.ID)
+			}
+			e, err := strconv.Atoi(end)
+			if err != nil {
+				return nil, fmt.Errorf("bad slot %s of %s", item, n.ID)
+			}
+			if b < 0 || e >= SlotsCount || b > e {
+				return nil, fmt.Errorf("bad slot %s of %s", item, n.ID)
+			}
+			for s := b; s <= e; s++ {
+				n.Slots = append(n.Slots, s)
+			}
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
+
+// Cluster is the merged view of the CLUSTER NODES of all the instances.
+type Cluster struct {
+	Nodes []*Node
+	byID  map[string]*Node
+}
+
+// NewCluster merges views which are the CLUSTER NODES of the alive instances
+// by their addr. The node itself is trusted first, and then the view with
+// the greatest config epoch of the unreachable node. The unreachable node is
+// failed if any view flags it fail.
+func NewCluster(views map[string][]*Node) *Cluster {
+	addrs := make([]string, 0, len(views))
+	for addr := range views {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+
+	c := &Cluster{byID: make(map[string]*Node)}
+	for _, addr := range addrs {
+		for _, n := range views[addr] {
+			if n.Myself {
+				self := *n
+				self.Alive, self.Fail = true, false
+				c.byID[n.ID] = &self
+			}
+		}
+	}
+	failed := make(map[string]bool)
+	for _, addr := range addrs {
+		for _, n := range views[addr] {
+			if n.Myself {
+				continue
+			}
+			if n.Fail {
+				failed[n.ID] = true
+			}
+			if old, ok := c.byID[n.ID]; ok && (old.Alive || old.Epoch >= n.Epoch) {
+				continue
+			}
+			other := *n
+			other.Alive = false
+			c.byID[n.ID] = &other
+		}
+	}
+	for id, n := range c.byID {
+		if !n.Alive {
+			n.Fail = failed[id]
+		}
+		c.Nodes = append(c.Nodes, n)
+	}
+	sort.Slice(c.Nodes, func(i, j int) bool { return c.Nodes[i].Addr < c.Nodes[j].Addr })
+	return c
+}
+
+// Node gets the node by id.
+func (c *Cluster) Node(id string) *Node {
+	return c.byID[id]
+}
+
+// Report is the problems of the cluster found by Diagnose.
+type Report struct {
+	// Uncovered is the slots served by no master.
+	Uncovered []int
+	// Failed is the failed masters which serve slots.
+	Failed []*Failed
+	// Orphans is the alive masters which serve slots without any alive
+	// replica.
+	Orphans []*Node
+	// Collisions is the alive masters sharing the same config epoch.
+	Collisions [][]*Node
+	// Conflicts is the slots served by more than one alive master, which
+	// happens when the cluster is split brain.
+	Conflicts map[int][]*Node
+}
+
+// Failed is a failed master and its alive replicas.
+type Failed struct {
+	Master   *Node
+	Replicas []*Node
+}
+
+// OK reports whether nothing to fix.
+func (r *Report) OK() bool {
+	return len(r.Uncovered) == 0 && len(r.Failed) == 0 && len(r.Orphans) == 0 &&
+		len(r.Collisions) == 0 && len(r.Conflicts) == 0
+}
+
+func (r *Report) String() string {
+	if r.OK() {
+		return "cluster is ok"
+	}
+	var parts []string
+	if len(r.Uncovered) > 0 {
+		parts = append(parts, fmt.Sprintf("%d slots uncovered %s", len(r.Uncovered), Ranges(r.Uncovered)))
+	}
+	for _, f := range r.Failed {
+		parts = append(parts, fmt.Sprintf("master %s failed with %d alive replicas", f.Master, len(f.Replicas)))
+	}
+	for _, n := range r.Orphans {
+		parts = append(parts, fmt.Sprintf("master %s has no alive replica", n))
+	}
+	for _, ns := range r.Collisions {
+		parts = append(parts, fmt.Sprintf("masters %v share config epoch %d", ns, ns[0].Epoch))
+	}
+	if len(r.Conflicts) > 0 {
+		slots := make([]int, 0, len(r.Conflicts))
+		for s := range r.Conflicts {
+			slots = append(slots, s)
+		}
+		sort.Ints(slots)
+		parts = append(parts, fmt.Sprintf("%d slots served by more than one master %s", len(slots), Ranges(slots)))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Diagnose finds the problems of the cluster.
+func (c *Cluster) Diagnose() *Report {
+	r := &Report{Conflicts: make(map[int][]*Node)}
+	covered := make([]bool, SlotsCount)
+	owners := make(map[int][]*Node)
+	epochs := make(map[int64][]*Node)
+	replicas := make(map[string]int)
+	for _, n := range c.Nodes {
+		if n.Master {
+			for _, s := range n.Slots {
+				covered[s] = true
+				if n.Alive {
+					owners[s] = append(owners[s], n)
+				}
+			}
+			if n.Alive && n.Epoch > 0 {
+				epochs[n.Epoch] = append(epochs[n.Epoch], n)
+			}
+		} else if n.Alive && n.MasterID != "" {
+			replicas[n.MasterID]++
+		}
+	}
+	for s, ok := range covered {
+		if !ok {
+			r.Uncovered = append(r.Uncovered, s)
+		}
+	}
+	for _, n := range c.Nodes {
+		if !n.Master || len(n.Slots) == 0 {
+			continue
+		}
+		if n.Fail {
+			f := &Failed{Master: n}
+			for _, rn := range c.Nodes {
+				if rn.Alive && !rn.Master && rn.MasterID == n.ID {
+					f.Replicas = append(f.Replicas, rn)
+				}
+			}
+			r.Failed = append(r.Failed, f)
+		} else if n.Alive && replicas[n.ID] == 0 {
+			r.Orphans = append(r.Orphans, n)
+		}
+	}
+	for _, ns := range epochs {
+		if len(ns) > 1 {
+			sortByID(ns)
+			r.Collisions = append(r.Collisions, ns)
+		}
+	}
+	sort.Slice(r.Collisions, func(i, j int) bool { return r.Collisions[i][0].Epoch < r.Collisions[j][0].Epoch })
+	for s, ns := range owners {
+		if len(ns) > 1 {
+			r.Conflicts[s] = ns
+		}
+	}
+	return r
+}
+
+// Step is a repair step run on the node of Addr.
+type Step struct {
+	Addr string
+	Desc string
+	Cmds [][]string
+	// Takeover means the node takes over its failed master, the next step
+	// runs after it becomes master.
+	Takeover bool
+}
+
+func (s *Step) String() string {
+	return s.Addr + ": " + s.Desc
+}
+
+// Plan plans the repair steps of the problems of report in order:
+//
+//  1. the first alive replica of the failed master takes over it by CLUSTER
+//     FAILOVER TAKEOVER.
+//  2. the uncovered slots and the slots of the failed master without
+//     replica are assigned to the master with the fewest slots by CLUSTER
+//     SETSLOT NODE, which then bumps its epoch to claim them. NOTICE: the
+//     data of the failed master without replica is lost.
+//  3. the spare replica or the master without slots replicates the master
+//     without replica by CLUSTER REPLICATE.
+//  4. the colliding masters bump their epochs by CLUSTER BUMPEPOCH, and the
+//     winner of the conflicting slots bumps at last, which is the one with
+//     the greatest epoch or the smallest id as redis does.
+func (c *Cluster) Plan(r *Report) ([]*Step, error) {
+	var steps []*Step
+	// the master of each alive node after the takeovers, "" for master.
+	masterOf := make(map[string]string)
+	slots := make(map[string]int)
+	for _, n := range c.Nodes {
+		if !n.Alive {
+			continue
+		}
+		if n.Master {
+			masterOf[n.ID] = ""
+			slots[n.ID] = len(n.Slots)
+		} else {
+			masterOf[n.ID] = n.MasterID
+		}
+	}
+
+	lost := append([]int(nil), r.Uncovered...)
+	for _, f := range r.Failed {
+		if len(f.Replicas) == 0 {
+			lost = append(lost, f.Master.Slots...)
+			continue
+		}
+		p := f.Replicas[0]
+		steps = append(steps, &Step{
+			Addr:     p.Addr,
+			Desc:     fmt.Sprintf("take over failed master %s", f.Master),
+			Cmds:     [][]string{{"CLUSTER", "FAILOVER", "TAKEOVER"}},
+			Takeover: true,
+		})
+		// NOTE: the other replicas follow the new master automatically.
+		masterOf[p.ID] = ""
+		slots[p.ID] = len(f.Master.Slots)
+		for _, rn := range f.Replicas[1:] {
+			masterOf[rn.ID] = p.ID
+		}
+	}
+
+	bumped := make(map[string]bool)
+	if len(lost) > 0 {
+		sort.Ints(lost)
+		assigned := make(map[string][]int)
+		var targets []string
+		// NOTE: the masters without slots are spares unless no master
+		// serves slots.
+		var candidates []string
+		for id, m := range masterOf {
+			if m == "" && slots[id] > 0 {
+				candidates = append(candidates, id)
+			}
+		}
+		if len(candidates) == 0 {
+			for id, m := range masterOf {
+				if m == "" {
+					candidates = append(candidates, id)
+				}
+			}
+		}
+		for _, rg := range splitRanges(lost) {
+			target := ""
+			for _, id := range candidates {
+				if target == "" || slots[id] < slots[target] || (slots[id] == slots[target] && id < target) {
+					target = id
+				}
+			}
+			if target == "" {
+				return nil, fmt.Errorf("no alive master to serve %d slots %s", len(lost), Ranges(lost))
+			}
+			if _, ok := assigned[target]; !ok {
+				targets = append(targets, target)
+			}
+			assigned[target] = append(assigned[target], rg...)
+			slots[target] += len(rg)
+		}
+		for _, id := range targets {
+			cmds := make([][]string, 0, len(assigned[id])+1)
+			for _, s := range assigned[id] {
+				cmds = append(cmds, []string{"CLUSTER", "SETSLOT", strconv.Itoa(s), "NODE", id})
+			}
+			cmds = append(cmds, []string{"CLUSTER", "BUMPEPOCH"})
+			steps = append(steps, &Step{
+				Addr: c.byID[id].Addr,
+				Desc: fmt.Sprintf("serve %d slots %s", len(assigned[id]), Ranges(assigned[id])),
+				Cmds: cmds,
+			})
+			bumped[id] = true
+		}
+	}
+
+	steps = append(steps, c.planReplicas(masterOf, slots)...)
+
+	winners := make(map[string]bool)
+	for _, ns := range r.Conflicts {
+		winners[winner(ns).ID] = true
+	}
+	for _, ns := range r.Collisions {
+		for _, n := range ns[:len(ns)-1] {
+			if bumped[n.ID] || winners[n.ID] {
+				continue
+			}
+			steps = append(steps, bumpStep(n, fmt.Sprintf("resolve config epoch %d collision", n.Epoch)))
+			bumped[n.ID] = true
+		}
+	}
+	ids := make([]string, 0, len(winners))
+	for id := range winners {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		steps = append(steps, bumpStep(c.byID[id], "claim the conflicting slots"))
+	}
+	return steps, nil
+}
+
+// planReplicas makes the spare nodes replicate the masters serving slots
+// without replica. The spare node is the alive master without slots or the
+// extra replica of the master with more than one replicas.
+func (c *Cluster) planReplicas(masterOf map[string]string, slots map[string]int) (steps []*Step) {
+	replicas := make(map[string][]string)
+	var orphans, spares []string
+	for id, m := range masterOf {
+		if m != "" {
+			replicas[m] = append(replicas[m], id)
+		}
+	}
+	for id, m := range masterOf {
+		if m != "" {
+			continue
+		}
+		if slots[id] == 0 {
+			spares = append(spares, id)
+		} else if len(replicas[id]) == 0 {
+			orphans = append(orphans, id)
+		} else {
+			rs := replicas[id]
+			sort.Strings(rs)
+			spares = append(spares, rs[1:]...)
+		}
+	}
+	sort.Strings(orphans)
+	sort.Strings(spares)
+	for i, id := range orphans {
+		if i >= len(spares) {
+			break
+		}
+		spare := c.byID[spares[i]]
+		steps = append(steps, &Step{
+			Addr: spare.Addr,
+			Desc: fmt.Sprintf("replicate master %s", c.byID[id]),
+			Cmds: [][]string{{"CLUSTER", "REPLICATE", id}},
+		})
+	}
+	return
+}
+
+// winner returns the master with the greatest epoch or the smallest id.
+func winner(ns []*Node) *Node {
+	w := ns[0]
+	for _, n := range ns[1:] {
+		if n.Epoch > w.Epoch || (n.Epoch == w.Epoch && n.ID < w.ID) {
+			w = n
+		}
+	}
+	return w
+}
+
+func bumpStep(n *Node, desc string) *Step {
+	return &Step{Addr: n.Addr, Desc: desc, Cmds: [][]string{{"CLUSTER", "BUMPEPOCH"}}}
+}
+
+func sortByID(ns []*Node) {
+	sort.Slice(ns, func(i, j int) bool { return ns[i].ID < ns[j].ID })
+}
+
+// splitRanges splits the sorted slots into the continuous ranges.
+func splitRanges(slots []int) (rgs [][]int) {
+	for i, s := range slots {
+		if i == 0 || s != slots[i-1]+1 {
+			rgs = append(rgs, nil)
+		}
+		rgs[len(rgs)-1] = append(rgs[len(rgs)-1], s)
+	}
+	return
+}
+
+// Ranges formats the sorted slots as ranges, such as 0-100,200.
+func Ranges(slots []int) string {
+	var parts []string
+	for _, rg := range splitRanges(slots) {
+		if len(rg) == 1 {
+			parts = append(parts, strconv.Itoa(rg[0]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", rg[0], rg[len(rg)-1]))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// Fix diagnoses the redis cluster of the instances addrs and runs the repair
+// steps, then waits until the problems are gone.
+func Fix(ctx context.Context, addrs []string, logf func(format string, args ...interface{})) error {
+	c, err := Load(addrs, logf)
+	if err != nil {
+		return err
+	}
+	r := c.Diagnose()
+	logf("diagnose: %s", r)
+	if r.OK() {
+		return nil
+	}
+	steps, err := c.Plan(r)
+	if err != nil {
+		return err
+	}
+	for _, step := range steps {
+		logf("fix step %s", step)
+		if err = run(ctx, step); err != nil {
+			return fmt.Errorf("fix step %s err %v", step, err)
+		}
+	}
+	return wait(ctx, func() error {
+		c, err := Load(addrs, func(string, ...interface{}) {})
+		if err != nil {
+			return err
+		}
+		// NOTE: the failed master without replica is still failed after fix.
+		r := c.Diagnose()
+		if len(r.Uncovered) > 0 || len(r.Conflicts) > 0 || len(r.Collisions) > 0 {
+			return fmt.Errorf("cluster is not fixed yet: %s", r)
+		}
+		return nil
+	})
+}
+
+// Load merges the CLUSTER NODES of the alive instances of addrs into the
+// cluster, the unreachable instances are logged by logf.
+func Load(addrs []string, logf func(format string, args ...interface{})) (*Cluster, error) {
+	views := make(map[string][]*Node)
+	for _, addr := range addrs {
+		nodes, err := clusterNodes(addr)
+		if err != nil {
+			logf("get cluster nodes of %s err %v", addr, err)
+			continue
+		}
+		views[addr] = nodes
+	}
+	if len(views) == 0 {
+		return nil, fmt.Errorf("none of %d instances is alive", len(addrs))
+	}
+	return NewCluster(views), nil
+}
+
+func clusterNodes(addr string) ([]*Node, error) {
+	conn := myredis.NewConn(addr)
+	defer conn.Close()
+	resp, err := conn.Exec(myredis.NewCmd("CLUSTER").Arg("NODES"))
+	if err != nil {
+		return nil, err
+	}
+	if resp.RType != myredis.RespBulk {
+		return nil, fmt.Errorf("get wrong reply of %s %s", addr, strconv.Quote(string(resp.Data)))
+	}
+	return ParseNodes(resp.Data)
+}
+
+func run(ctx context.Context, step *Step) error {
+	conn := myredis.NewConn(step.Addr)
+	for _, args := range step.Cmds {
+		resp, err := conn.Exec(myredis.NewCmd(args[0]).Arg(args[1:]...))
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		if resp.RType == myredis.RespError {
+			conn.Close()
+			return fmt.Errorf("%s replied %s", strings.Join(args, " "), resp.Data)
+		}
+	}
+	conn.Close()
+	if !step.Takeover {
+		return nil
+	}
+	return wait(ctx, func() error {
+		nodes, err := clusterNodes(step.Addr)
+		if err != nil {
+			return err
+		}
+		for _, n := range nodes {
+			if n.Myself && n.Master {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s not take over yet", step.Addr)
+	})
+}
+
+// wait calls check every second until it succeeds, the last error is
+// returned if ctx done.
+func wait(ctx context.Context, check func() error) error {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		err := check()
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%v: %v", ctx.Err(), err)
+		case <-ticker.C:
+		}
+	}
+}
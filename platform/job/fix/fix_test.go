@@ -0,0 +1,207 @@
+package fix
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func nodesOf(t *testing.T, lines ...string) []*Node {
+	nodes, err := ParseNodes([]byte(strings.Join(lines, "\n") + "\n"))
+	assert.NoError(t, err)
+	return nodes
+}
+
+func TestParseNodes(t *testing.T) {
+	nodes := nodesOf(t,
+		"aaa 127.0.0.1:7000@17000 myself,master - 0 0 1 connected 0-2 5 [6->-bbb]",
+		"bbb 127.0.0.1:7001@17001,host1 master,fail - 0 0 2 connected 6-8 [9-<-aaa]",
+		"ccc 127.0.0.1:7002@17002 slave aaa 0 0 1 connected",
+	)
+	assert.Len(t, nodes, 3)
+	assert.Equal(t, &Node{ID: "aaa", Addr: "127.0.0.1:7000", Myself: true, Master: true, Epoch: 1, Slots: []int{0, 1, 2, 5}}, nodes[0])
+	assert.Equal(t, &Node{ID: "bbb", Addr: "127.0.0.1:7001", Master: true, Fail: true, Epoch: 2, Slots: []int{6, 7, 8}}, nodes[1])
+	assert.Equal(t, &Node{ID: "ccc", Addr: "127.0.0.1:7002", MasterID: "aaa", Epoch: 1}, nodes[2])
+
+	_, err := ParseNodes([]byte("aaa 127.0.0.1:7000 master"))
+	assert.Error(t, err)
+	_, err = ParseNodes([]byte("aaa 127.0.0.1:7000 master - 0 0 1 connected 16384"))
+	assert.Error(t, err)
+}
+
+func TestRanges(t *testing.T) {
+	assert.Equal(t, "0-2,5,7-8", Ranges([]int{0, 1, 2, 5, 7, 8}))
+	assert.Equal(t, "", Ranges(nil))
+}
+
+// views builds the views of the alive nodes from the lines of the full
+// cluster nodes, the line prefixed by "!" is the dead node.
+func views(t *testing.T, lines ...string) map[string][]*Node {
+	var alive []string
+	for i, line := range lines {
+		if strings.HasPrefix(line, "!") {
+			lines[i] = line[1:]
+		} else {
+			alive = append(alive, line)
+		}
+	}
+	vs := make(map[string][]*Node)
+	for _, self := range alive {
+		var view []string
+		for _, line := range lines {
+			if line == self {
+				fields := strings.Fields(line)
+				fields[2] = "myself," + fields[2]
+				line = strings.Join(fields, " ")
+			}
+			view = append(view, line)
+		}
+		nodes := nodesOf(t, view...)
+		for _, n := range nodes {
+			if n.Myself {
+				vs[n.Addr] = nodes
+			}
+		}
+	}
+	return vs
+}
+
+func TestDiagnoseOK(t *testing.T) {
+	c := NewCluster(views(t,
+		"m1 127.0.0.1:7000 master - 0 0 1 connected 0-8191",
+		"m2 127.0.0.1:7001 master - 0 0 2 connected 8192-16383",
+		"s1 127.0.0.1:7002 slave m1 0 0 1 connected",
+		"s2 127.0.0.1:7003 slave m2 0 0 2 connected",
+	))
+	r := c.Diagnose()
+	assert.True(t, r.OK(), r.String())
+	steps, err := c.Plan(r)
+	assert.NoError(t, err)
+	assert.Empty(t, steps)
+}
+
+func TestFixFailedMasters(t *testing.T) {
+	c := NewCluster(views(t,
+		"!m1 127.0.0.1:7000 master,fail - 0 0 1 connected 0-5460",
+		"m2 127.0.0.1:7001 master - 0 0 2 connected 5461-10922",
+		"!m3 127.0.0.1:7002 master,fail - 0 0 3 connected 10923-16383",
+		"s1 127.0.0.1:7003 slave m1 0 0 1 connected",
+		"s2 127.0.0.1:7004 slave m2 0 0 2 connected",
+		"!s3 127.0.0.1:7005 slave,fail m3 0 0 3 connected",
+	))
+	assert.False(t, c.Node("m1").Alive)
+	assert.True(t, c.Node("m1").Fail)
+	r := c.Diagnose()
+	assert.Empty(t, r.Uncovered)
+	assert.Len(t, r.Failed, 2)
+	assert.Equal(t, "m1", r.Failed[0].Master.ID)
+	assert.Equal(t, []*Node{c.Node("s1")}, r.Failed[0].Replicas)
+	assert.Equal(t, "m3", r.Failed[1].Master.ID)
+	assert.Empty(t, r.Failed[1].Replicas)
+	assert.Empty(t, r.Orphans)
+
+	steps, err := c.Plan(r)
+	assert.NoError(t, err)
+	assert.Len(t, steps, 2)
+	// s1 takes over m1.
+	assert.Equal(t, "127.0.0.1:7003", steps[0].Addr)
+	assert.True(t, steps[0].Takeover)
+	assert.Equal(t, [][]string{{"CLUSTER", "FAILOVER", "TAKEOVER"}}, steps[0].Cmds)
+	// the slots of m3 are served by the master with fewest slots, s1 stays
+	// without replica as no spare node.
+	assert.Equal(t, "127.0.0.1:7003", steps[1].Addr)
+	assert.Len(t, steps[1].Cmds, 5461+1)
+	assert.Equal(t, []string{"CLUSTER", "SETSLOT", "10923", "NODE", "s1"}, steps[1].Cmds[0])
+	assert.Equal(t, []string{"CLUSTER", "BUMPEPOCH"}, steps[1].Cmds[5461])
+	assert.Equal(t, "serve 5461 slots 10923-16383", steps[1].Desc)
+}
+
+func TestFixSpareReplica(t *testing.T) {
+	c := NewCluster(views(t,
+		"!m1 127.0.0.1:7000 master,fail - 0 0 1 connected 0-8191",
+		"m2 127.0.0.1:7001 master - 0 0 2 connected 8192-16383",
+		"s1 127.0.0.1:7002 slave m1 0 0 1 connected",
+		"s2 127.0.0.1:7003 slave m2 0 0 2 connected",
+		"s3 127.0.0.1:7004 slave m2 0 0 2 connected",
+	))
+	steps, err := c.Plan(c.Diagnose())
+	assert.NoError(t, err)
+	assert.Len(t, steps, 2)
+	assert.Equal(t, "127.0.0.1:7002: take over failed master 127.0.0.1:7000(m1)", steps[0].String())
+	// the extra replica of m2 replicates the promoted s1.
+	assert.Equal(t, "127.0.0.1:7004", steps[1].Addr)
+	assert.Equal(t, [][]string{{"CLUSTER", "REPLICATE", "s1"}}, steps[1].Cmds)
+}
+
+func TestFixUncoveredSlots(t *testing.T) {
+	c := NewCluster(views(t,
+		"m1 127.0.0.1:7000 master - 0 0 1 connected 0-5000",
+		"m2 127.0.0.1:7001 master - 0 0 2 connected 5001-9000 12001-16383",
+		"s1 127.0.0.1:7002 slave m1 0 0 1 connected",
+		"s2 127.0.0.1:7003 slave m2 0 0 2 connected",
+	))
+	r := c.Diagnose()
+	assert.Equal(t, "9001-12000", Ranges(r.Uncovered))
+	steps, err := c.Plan(r)
+	assert.NoError(t, err)
+	assert.Len(t, steps, 1)
+	assert.Equal(t, "127.0.0.1:7000", steps[0].Addr)
+	assert.Len(t, steps[0].Cmds, 3000+1)
+
+	// no master at all.
+	c = NewCluster(views(t,
+		"!m1 127.0.0.1:7000 master,fail - 0 0 1 connected 0-16383",
+		"s1 127.0.0.1:7001 slave,fail m1 0 0 1 connected",
+	))
+	r = c.Diagnose()
+	assert.Len(t, r.Failed, 1)
+	assert.Len(t, r.Failed[0].Replicas, 1)
+	c.Node("s1").Alive = false
+	_, err = c.Plan(c.Diagnose())
+	assert.Error(t, err)
+}
+
+func TestFixOrphans(t *testing.T) {
+	c := NewCluster(views(t,
+		"m1 127.0.0.1:7000 master - 0 0 1 connected 0-8191",
+		"m2 127.0.0.1:7001 master - 0 0 2 connected 8192-16383",
+		"m3 127.0.0.1:7002 master - 0 0 0 connected",
+		"s2 127.0.0.1:7003 slave m2 0 0 2 connected",
+	))
+	r := c.Diagnose()
+	assert.Equal(t, []*Node{c.Node("m1")}, r.Orphans)
+	steps, err := c.Plan(r)
+	assert.NoError(t, err)
+	assert.Len(t, steps, 1)
+	assert.Equal(t, "127.0.0.1:7002", steps[0].Addr)
+	assert.Equal(t, [][]string{{"CLUSTER", "REPLICATE", "m1"}}, steps[0].Cmds)
+}
+
+func TestFixSplitBrain(t *testing.T) {
+	// m1 and m3 both claim slots 0-100 with the same epoch.
+	vs := views(t,
+		"m1 127.0.0.1:7000 master - 0 0 3 connected 0-8191",
+		"m2 127.0.0.1:7001 master - 0 0 2 connected 8192-16383",
+		"m3 127.0.0.1:7002 master - 0 0 3 connected 0-100",
+		"s1 127.0.0.1:7003 slave m1 0 0 3 connected",
+		"s2 127.0.0.1:7004 slave m2 0 0 2 connected",
+		"s3 127.0.0.1:7005 slave m3 0 0 3 connected",
+	)
+	c := NewCluster(vs)
+	r := c.Diagnose()
+	assert.Len(t, r.Conflicts, 101)
+	assert.Len(t, r.Collisions, 1)
+	assert.Equal(t, []*Node{c.Node("m1"), c.Node("m3")}, r.Collisions[0])
+	assert.Contains(t, r.String(), "101 slots served by more than one master 0-100")
+
+	steps, err := c.Plan(r)
+	assert.NoError(t, err)
+	var desc []string
+	for _, s := range steps {
+		desc = append(desc, fmt.Sprint(s))
+	}
+	// m1 wins with the smaller id, and bumps at last.
+	assert.Equal(t, []string{"127.0.0.1:7000: claim the conflicting slots"}, desc)
+}
@@ -0,0 +1,104 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Hook is the workflow hook of jobs, which makes the job wait for the
+// external approval before executed.
+type Hook interface {
+	// NeedApprove reports whether the job must be approved before executed.
+	NeedApprove(j *Job) bool
+	// Notify is called when the job is waiting for approval, approved or
+	// rejected, such as notifying the approvers and the committer.
+	Notify(ctx context.Context, jobID, state string, j *Job) error
+}
+
+// ByAPIServer reports whether the job of op is run by apiserver itself
+// instead of scheduler.
+func ByAPIServer(op OpType) bool {
+	switch op {
+	case OpBackup, OpRestore, OpFix, OpBalance:
+		return true
+	}
+	return false
+}
+
+// ApprovalConfig is the config of the approval hook.
+type ApprovalConfig struct {
+	// Ops is the op types must be approved, such as destroy, only the jobs
+	// run by scheduler can wait for approval.
+	Ops []OpType `toml:"ops"`
+	// Webhook is the url which the approval events are posted to as json,
+	// empty means no notification.
+	Webhook string `toml:"webhook"`
+	// Timeout is the seconds of posting webhook, default 5.
+	Timeout int `toml:"timeout"`
+}
+
+// ApprovalEvent is the body posted to the webhook.
+type ApprovalEvent struct {
+	JobID string `json:"job_id"`
+	State string `json:"state"`
+	Job   *Job   `json:"job"`
+}
+
+// ApprovalHook requires the approval of the jobs of the configured ops.
+type ApprovalHook struct {
+	cfg    *ApprovalConfig
+	client *http.Client
+}
+
+// NewApprovalHook new the approval hook by config.
+func NewApprovalHook(cfg *ApprovalConfig) *ApprovalHook {
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &ApprovalHook{cfg: cfg, client: &http.Client{Timeout: timeout}}
+}
+
+// NeedApprove reports whether the op of job is configured.
+func (h *ApprovalHook) NeedApprove(j *Job) bool {
+	if ByAPIServer(j.OpType) {
+		return false
+	}
+	for _, op := range h.cfg.Ops {
+		if op == j.OpType {
+			return true
+		}
+	}
+	return false
+}
+
+// Notify posts the event to the webhook.
+func (h *ApprovalHook) Notify(ctx context.Context, jobID, state string, j *Job) error {
+	if h.cfg.Webhook == "" {
+		return nil
+	}
+	data, err := json.Marshal(&ApprovalEvent{JobID: jobID, State: state, Job: j})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, h.cfg.Webhook, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := h.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("post approval webhook err %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApprovalHook(t *testing.T) {
+	var got ApprovalEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+	}))
+	defer srv.Close()
+
+	h := NewApprovalHook(&ApprovalConfig{Ops: []OpType{OpDestroy, OpBackup}, Webhook: srv.URL})
+	destroy := &Job{OpType: OpDestroy, Name: "test-cluster"}
+	assert.True(t, h.NeedApprove(destroy))
+	assert.False(t, h.NeedApprove(&Job{OpType: OpScale}))
+	// the job run by apiserver never waits for approval.
+	assert.False(t, h.NeedApprove(&Job{OpType: OpBackup}))
+
+	assert.NoError(t, h.Notify(context.Background(), "sh001.0001", StateWaitApprove, destroy))
+	assert.Equal(t, "sh001.0001", got.JobID)
+	assert.Equal(t, StateWaitApprove, got.State)
+	assert.Equal(t, "test-cluster", got.Job.Name)
+
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	assert.Error(t, h.Notify(context.Background(), "sh001.0001", StateApproved, destroy))
+
+	// no webhook.
+	h = NewApprovalHook(&ApprovalConfig{Ops: []OpType{OpDestroy}})
+	assert.NoError(t, h.Notify(context.Background(), "sh001.0001", StateWaitApprove, destroy))
+}
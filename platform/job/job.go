@@ -23,16 +23,70 @@ const (
 	// OpMigrate means delete specified node and restart in new agent.
 	OpMigrate OpType = "migrate"
 
-	// OpFix will trying to run `rustkit fix` to the given cluster(redis cluster only)
+	// OpFix will repair the slot coverage of the given cluster(redis cluster
+	// only): the failed masters are taken over, the uncovered slots are
+	// assigned and the epoch collisions are resolved.
 	OpFix OpType = "fix"
 
-	// Balance will balance the given cluster
+	// OpBalance will move the slots of the given cluster(redis cluster only)
+	// to equalize the memory of masters, run by apiserver. The balance of
+	// master roles after create is run without job.
 	OpBalance OpType = "balance"
 
 	// OpRestart will trying to restart the special node
 	OpRestart OpType = "restart"
+
+	// OpUpgrade will restart the instances in batches onto the new Version,
+	// replicas first and masters last with manual failover for redis cluster.
+	OpUpgrade OpType = "upgrade"
+
+	// OpBackup will snapshot the rdb of instances and upload them as a
+	// backup set into the object storage (redis and redis cluster only).
+	OpBackup OpType = "backup"
+
+	// OpRestore will replay the rdb of the given backup set into cluster.
+	OpRestore OpType = "restore"
 )
 
+// ParamAttrPrefix is the prefix of Params key which means the required
+// host attributes of the mesos agent, such as attr.rack=r1 or attr.zone=z1,z2.
+// Multi values split by comma means any of them is ok.
+const ParamAttrPrefix = "attr."
+
+// ParamAntiAffinity is the Params key of the failure domain level which a
+// master and its slave must never share, "host"(default), "rack" or "zone".
+// The rack or zone of the mesos agent is given by its attribute of the name.
+const ParamAntiAffinity = "anti_affinity"
+
+// ParamMasterSpread is the Params key of the failure domain level which no
+// two masters of the cluster share, "host", "rack" or "zone". It's no limit
+// by default. All the instances of singleton cluster are masters.
+const ParamMasterSpread = "master_spread"
+
+// ParamBatch is the Params key of the number of instances restarted at a
+// time by upgrade, default 1.
+const ParamBatch = "batch"
+
+// ParamHealthTimeout is the Params key of the seconds waiting for the
+// restarted instances healthy before the next batch, the upgrade fails and
+// stops if timeout, default 300.
+const ParamHealthTimeout = "health_timeout"
+
+// ParamBackup is the Params key of the backup set id to restore.
+const ParamBackup = "backup"
+
+// ParamBackupFrom is the Params key of the cluster whose backup set is
+// restored, default is the cluster itself.
+const ParamBackupFrom = "backup_from"
+
+// ParamKeysPerBatch is the Params key of the keys migrated by a MIGRATE
+// command of slots balancing, default 100.
+const ParamKeysPerBatch = "keys_per_batch"
+
+// ParamBatchPause is the Params key of the milliseconds paused between the
+// migrating batches of slots balancing, default 10.
+const ParamBatchPause = "batch_pause"
+
 // Job is a single POD type which represent a single job.
 type Job struct {
 	// Order was generated by etcd post
@@ -18,6 +18,15 @@ var (
 	// fail status
 	StateLost StateType = "lost"
 	StateFail StateType = "fail"
+	// StateRejected is the state of the job rejected to execute by approval.
+	StateRejected StateType = "rejected"
+)
+
+// define instance state enum
+var (
+	// StateFlapping is the state of the instance which is restarted by
+	// executor too often.
+	StateFlapping StateType = "flapping"
 )
 
 // define cluster deploying state enum
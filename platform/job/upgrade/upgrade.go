@@ -0,0 +1,231 @@
+// Package upgrade plans the rolling upgrade of cluster instances and gates
+// each batch by the health of the restarted instances.
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"overlord/pkg/etcd"
+	"overlord/pkg/memcache"
+	"overlord/pkg/myredis"
+	"overlord/pkg/types"
+	"overlord/platform/chunk"
+	"overlord/platform/job"
+)
+
+// define default value
+const (
+	DefaultBatch         = 1
+	DefaultHealthTimeout = 300 * time.Second
+
+	checkInterval = time.Second
+)
+
+// Node is an instance of the cluster to upgrade.
+type Node struct {
+	Addr string
+	// Role is the live role of redis cluster instance, empty for others.
+	Role string
+	// Replica is one online replica of the master, which takes over the
+	// master by manual failover before the master restarts.
+	Replica string
+}
+
+func (n *Node) String() string {
+	if n.Role == "" {
+		return n.Addr
+	}
+	return n.Addr + "(" + n.Role + ")"
+}
+
+// Plan splits the nodes into the batches restarted one after another, all
+// the replicas are restarted before the masters and never in the same batch.
+func Plan(nodes []*Node, batch int) [][]*Node {
+	if batch <= 0 {
+		batch = DefaultBatch
+	}
+	var replicas, masters []*Node
+	for _, n := range nodes {
+		if n.Role == chunk.RoleMaster {
+			masters = append(masters, n)
+		} else {
+			replicas = append(replicas, n)
+		}
+	}
+	var batches [][]*Node
+	for _, ns := range [][]*Node{replicas, masters} {
+		for len(ns) > 0 {
+			size := batch
+			if size > len(ns) {
+				size = len(ns)
+			}
+			batches = append(batches, ns[:size])
+			ns = ns[size:]
+		}
+	}
+	return batches
+}
+
+// Roles gets the live roles of the redis cluster instances, which may be
+// different from the chunks after failover.
+func Roles(addrs []string) ([]*Node, error) {
+	nodes := make([]*Node, 0, len(addrs))
+	for _, addr := range addrs {
+		info, err := replication(addr)
+		if err != nil {
+			return nil, err
+		}
+		n := &Node{Addr: addr, Role: info["role"]}
+		if n.Role == chunk.RoleMaster {
+			n.Replica = onlineReplica(info)
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
+
+// Failover makes the replica take over the master n by CLUSTER FAILOVER and
+// waits until the replica becomes master.
+func Failover(ctx context.Context, n *Node) error {
+	if n.Replica == "" {
+		return fmt.Errorf("master %s has no online replica to failover", n.Addr)
+	}
+	conn := myredis.NewConn(n.Replica)
+	resp, err := conn.Exec(myredis.NewCmd("CLUSTER").Arg("FAILOVER"))
+	conn.Close()
+	if err != nil {
+		return err
+	}
+	if resp.RType == myredis.RespError {
+		return fmt.Errorf("failover %s to %s err %s", n.Addr, n.Replica, resp.Data)
+	}
+	return wait(ctx, func() error {
+		info, err := replication(n.Replica)
+		if err != nil {
+			return err
+		}
+		if info["role"] != chunk.RoleMaster {
+			return fmt.Errorf("replica %s not take over %s yet", n.Replica, n.Addr)
+		}
+		return nil
+	})
+}
+
+// WaitHealthy waits until the restarted instance is running and healthy.
+func WaitHealthy(ctx context.Context, e *etcd.Etcd, cacheType types.CacheType, addr string) error {
+	return wait(ctx, func() error {
+		state, err := e.Get(ctx, fmt.Sprintf("%s/%s/state", etcd.InstanceDirPrefix, addr))
+		if err != nil {
+			return err
+		}
+		if state != job.StateRunning {
+			return fmt.Errorf("instance %s is %s", addr, state)
+		}
+		return Healthy(cacheType, addr)
+	})
+}
+
+// Healthy checks whether the instance serves, the redis cluster instance
+// must see the cluster ok and the replica must be synced with its master.
+func Healthy(cacheType types.CacheType, addr string) error {
+	switch cacheType {
+	case types.CacheTypeMemcache:
+		conn := memcache.New(addr, time.Second, time.Second, time.Second)
+		defer conn.Close()
+		return conn.Ping()
+	case types.CacheTypeRedis:
+		conn := myredis.NewConn(addr)
+		defer conn.Close()
+		return conn.Ping()
+	case types.CacheTypeRedisCluster:
+		conn := myredis.NewConn(addr)
+		resp, err := conn.Exec(myredis.NewCmd("CLUSTER").Arg("INFO"))
+		conn.Close()
+		if err != nil {
+			return err
+		}
+		if state := parseInfo(resp.Data)["cluster_state"]; state != "ok" {
+			return fmt.Errorf("instance %s cluster state %s", addr, state)
+		}
+		info, err := replication(addr)
+		if err != nil {
+			return err
+		}
+		if info["role"] == chunk.RoleSlave && info["master_link_status"] != "up" {
+			return fmt.Errorf("replica %s master link is %s", addr, info["master_link_status"])
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported cache type %s", cacheType)
+}
+
+// wait calls check every second until it succeeds, the last error is
+// returned if ctx done.
+func wait(ctx context.Context, check func() error) error {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		err := check()
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%v: %v", ctx.Err(), err)
+		case <-ticker.C:
+		}
+	}
+}
+
+func replication(addr string) (map[string]string, error) {
+	conn := myredis.NewConn(addr)
+	defer conn.Close()
+	resp, err := conn.Exec(myredis.NewCmd("INFO").Arg("replication"))
+	if err != nil {
+		return nil, err
+	}
+	if resp.RType != myredis.RespBulk {
+		return nil, fmt.Errorf("get wrong reply of %s %s", addr, strconv.Quote(string(resp.Data)))
+	}
+	return parseInfo(resp.Data), nil
+}
+
+// parseInfo parses the reply of INFO and CLUSTER INFO into fields.
+func parseInfo(data []byte) map[string]string {
+	info := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if idx := strings.IndexByte(line, ':'); idx > 0 {
+			info[line[:idx]] = line[idx+1:]
+		}
+	}
+	return info
+}
+
+// onlineReplica returns the address of the first online replica in the
+// replication info of master, such as:
+//
+//	slave0:ip=127.0.0.1,port=7001,state=online,offset=1234,lag=0
+func onlineReplica(info map[string]string) string {
+	count, _ := strconv.Atoi(info["connected_slaves"])
+	for i := 0; i < count; i++ {
+		fields := make(map[string]string)
+		for _, kv := range strings.Split(info[fmt.Sprintf("slave%d", i)], ",") {
+			if idx := strings.IndexByte(kv, '='); idx > 0 {
+				fields[kv[:idx]] = kv[idx+1:]
+			}
+		}
+		if fields["state"] == "online" && fields["ip"] != "" {
+			return net.JoinHostPort(fields["ip"], fields["port"])
+		}
+	}
+	return ""
+}
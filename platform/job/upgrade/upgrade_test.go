@@ -0,0 +1,43 @@
+package upgrade
+
+import (
+	"testing"
+
+	"overlord/platform/chunk"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanReplicasFirst(t *testing.T) {
+	nodes := []*Node{
+		{Addr: "127.0.0.1:7000", Role: chunk.RoleMaster},
+		{Addr: "127.0.0.1:7001", Role: chunk.RoleSlave},
+		{Addr: "127.0.0.1:7002", Role: chunk.RoleMaster},
+		{Addr: "127.0.0.1:7003", Role: chunk.RoleSlave},
+		{Addr: "127.0.0.1:7004", Role: chunk.RoleSlave},
+	}
+	batches := Plan(nodes, 2)
+	assert.Len(t, batches, 3)
+	assert.Equal(t, []*Node{nodes[1], nodes[3]}, batches[0])
+	assert.Equal(t, []*Node{nodes[4]}, batches[1])
+	assert.Equal(t, []*Node{nodes[0], nodes[2]}, batches[2])
+}
+
+func TestPlanSingleton(t *testing.T) {
+	nodes := []*Node{{Addr: "127.0.0.1:7000"}, {Addr: "127.0.0.1:7001"}}
+	batches := Plan(nodes, 0)
+	assert.Equal(t, [][]*Node{{nodes[0]}, {nodes[1]}}, batches)
+	assert.Empty(t, Plan(nil, 1))
+}
+
+func TestParseReplication(t *testing.T) {
+	data := "# Replication\r\nrole:master\r\nconnected_slaves:2\r\n" +
+		"slave0:ip=127.0.0.1,port=7001,state=wait_bgsave,offset=0,lag=0\r\n" +
+		"slave1:ip=127.0.0.1,port=7003,state=online,offset=1234,lag=0\r\n\r\n"
+	info := parseInfo([]byte(data))
+	assert.Equal(t, "master", info["role"])
+	assert.Equal(t, "127.0.0.1:7003", onlineReplica(info))
+
+	info = parseInfo([]byte("role:master\r\nconnected_slaves:0\r\n"))
+	assert.Equal(t, "", onlineReplica(info))
+}
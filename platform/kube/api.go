@@ -0,0 +1,134 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"overlord/platform/api/model"
+)
+
+// APIError is the error replied by apiserver.
+type APIError struct {
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// Rejected reports whether the request is rejected by apiserver, such as the
+// params are invalid, which fails again if retried.
+func (e *APIError) Rejected() bool {
+	return e.Status >= 400 && e.Status < 500 && e.Status != http.StatusConflict && e.Status != http.StatusTooManyRequests
+}
+
+// API is the client of overlord apiserver, the jobs of clusters are
+// executed by the scheduler as created by the other clients.
+type API struct {
+	addr  string
+	token string
+	hc    *http.Client
+}
+
+// NewAPI new a client of apiserver addr, such as http://127.0.0.1:8880,
+// authorized by the bearer token if it's not empty.
+func NewAPI(addr, token string, hc *http.Client) *API {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	if !strings.HasPrefix(addr, "http://") && !strings.HasPrefix(addr, "https://") {
+		addr = "http://" + addr
+	}
+	return &API{addr: strings.TrimSuffix(addr, "/") + "/api/v1", token: token, hc: hc}
+}
+
+func (a *API) do(ctx context.Context, method, path string, body, v interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, a.addr+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	}
+	resp, err := a.hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	bs, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &APIError{Status: resp.StatusCode, Message: fmt.Sprintf("%s %s replied %d %s", method, path, resp.StatusCode, bytes.TrimSpace(bs))}
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(bs, v)
+}
+
+// GetCluster gets the cluster of name, ErrNotFound if it's not created.
+func (a *API) GetCluster(ctx context.Context, name string) (*model.Cluster, error) {
+	c := &model.Cluster{}
+	if err := a.do(ctx, http.MethodGet, "/clusters/"+name, nil, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// CreateCluster creates the cluster by the job returned.
+func (a *API) CreateCluster(ctx context.Context, p *model.ParamCluster) (*model.Job, error) {
+	return a.job(ctx, http.MethodPost, "/clusters/", p)
+}
+
+// ScaleCluster scales the cluster to number instances.
+func (a *API) ScaleCluster(ctx context.Context, name string, number int) (*model.Job, error) {
+	return a.job(ctx, http.MethodPatch, "/clusters/"+name+"/instances", &model.ParamScale{Name: name, Number: number})
+}
+
+// UpgradeCluster upgrades the cluster to version.
+func (a *API) UpgradeCluster(ctx context.Context, name, version string) (*model.Job, error) {
+	return a.job(ctx, http.MethodPost, "/clusters/"+name+"/upgrade", &model.ParamUpgrade{Version: version})
+}
+
+// RemoveCluster removes the cluster and its instances.
+func (a *API) RemoveCluster(ctx context.Context, name string) (*model.Job, error) {
+	return a.job(ctx, http.MethodDelete, "/clusters/"+name, nil)
+}
+
+// GetJob gets the job of id returned by the others.
+func (a *API) GetJob(ctx context.Context, id string) (*model.Job, error) {
+	j := &model.Job{}
+	// NOTE: the "/" in id is replaced by "." in url.
+	if err := a.do(ctx, http.MethodGet, "/jobs/"+strings.Replace(id, "/", ".", -1), nil, j); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (a *API) job(ctx context.Context, method, path string, body interface{}) (*model.Job, error) {
+	j := &model.Job{}
+	if err := a.do(ctx, method, path, body, j); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
@@ -0,0 +1,206 @@
+package kube
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// the files of service account mounted into pod.
+const (
+	serviceAccountToken = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	serviceAccountCA    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+// ErrNotFound is returned if the resource not found.
+var ErrNotFound = errors.New("resource not found")
+
+// Client is the client of kubernetes api server for the custom resources
+// of overlord, by the REST api directly.
+type Client struct {
+	host  string
+	token string
+	hc    *http.Client
+}
+
+// NewClient new a client of the api server host, such as
+// https://10.0.0.1:6443, authorized by the bearer token if it's not empty.
+func NewClient(host, token string, hc *http.Client) *Client {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	return &Client{host: strings.TrimSuffix(host, "/"), token: token, hc: hc}
+}
+
+// NewInClusterClient new a client by the service account of pod.
+func NewInClusterClient() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in kubernetes, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT must be set")
+	}
+	token, err := ioutil.ReadFile(serviceAccountToken)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(serviceAccountCA)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("bad ca of service account %s", serviceAccountCA)
+	}
+	hc := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	return NewClient("https://"+net.JoinHostPort(host, port), strings.TrimSpace(string(token)), hc), nil
+}
+
+// path returns the path of the resources of kind in namespace, all the
+// namespaces if it's empty, and the resource of name if it's not empty.
+func (c *Client) path(kind, namespace, name string) string {
+	p := fmt.Sprintf("/apis/%s/%s", Group, APIVersion)
+	if namespace != "" {
+		p += "/namespaces/" + namespace
+	}
+	p += "/" + Plurals[kind]
+	if name != "" {
+		p += "/" + name
+	}
+	return p
+}
+
+func (c *Client) do(ctx context.Context, method, path, ctype string, body interface{}) (*http.Response, error) {
+	var rd *bytes.Reader
+	if body != nil {
+		bs, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		rd = bytes.NewReader(bs)
+	} else {
+		rd = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, c.host+path, rd)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if ctype != "" {
+		req.Header.Set("Content-Type", ctype)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s replied %d %s", method, path, resp.StatusCode, bytes.TrimSpace(bs))
+	}
+	return resp, nil
+}
+
+func (c *Client) decode(ctx context.Context, method, path, ctype string, body, v interface{}) error {
+	resp, err := c.do(ctx, method, path, ctype, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// List lists the resources of kind in namespace.
+func (c *Client) List(ctx context.Context, kind, namespace string) (*CacheClusterList, error) {
+	l := &CacheClusterList{}
+	if err := c.decode(ctx, http.MethodGet, c.path(kind, namespace, ""), "", nil, l); err != nil {
+		return nil, err
+	}
+	for _, cr := range l.Items {
+		cr.Kind = kind
+	}
+	return l, nil
+}
+
+// Get gets the resource of kind.
+func (c *Client) Get(ctx context.Context, kind, namespace, name string) (*CacheCluster, error) {
+	cr := &CacheCluster{}
+	if err := c.decode(ctx, http.MethodGet, c.path(kind, namespace, name), "", nil, cr); err != nil {
+		return nil, err
+	}
+	cr.Kind = kind
+	return cr, nil
+}
+
+// Event is the event of watching.
+type Event struct {
+	Type   string        `json:"type"`
+	Object *CacheCluster `json:"object"`
+}
+
+// Watch watches the resources of kind in namespace from resource version rv,
+// and calls fn with each event until the watch ends in timeout seconds or
+// ctx done.
+func (c *Client) Watch(ctx context.Context, kind, namespace, rv string, timeout int, fn func(e *Event)) error {
+	q := url.Values{}
+	q.Set("watch", "true")
+	q.Set("resourceVersion", rv)
+	q.Set("timeoutSeconds", fmt.Sprint(timeout))
+	resp, err := c.do(ctx, http.MethodGet, c.path(kind, namespace, "")+"?"+q.Encode(), "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	dec := json.NewDecoder(bufio.NewReader(resp.Body))
+	for {
+		e := &Event{}
+		if err = dec.Decode(e); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if e.Type == "ERROR" || e.Object == nil {
+			// NOTE: such as the resource version is too old, relist.
+			return fmt.Errorf("watch %s error event", Plurals[kind])
+		}
+		e.Object.Kind = kind
+		fn(e)
+	}
+}
+
+// PatchFinalizers replaces the finalizers of cr.
+func (c *Client) PatchFinalizers(ctx context.Context, cr *CacheCluster, finalizers []string) error {
+	if finalizers == nil {
+		finalizers = []string{}
+	}
+	patch := map[string]interface{}{"metadata": map[string]interface{}{"finalizers": finalizers}}
+	return c.decode(ctx, http.MethodPatch, c.path(cr.Kind, cr.Metadata.Namespace, cr.Metadata.Name), "application/merge-patch+json", patch, &CacheCluster{})
+}
+
+// PatchStatus replaces the status of cr by the status subresource.
+func (c *Client) PatchStatus(ctx context.Context, cr *CacheCluster) error {
+	patch := map[string]interface{}{"status": cr.Status}
+	return c.decode(ctx, http.MethodPatch, c.path(cr.Kind, cr.Metadata.Namespace, cr.Metadata.Name)+"/status", "application/merge-patch+json", patch, &CacheCluster{})
+}
@@ -0,0 +1,58 @@
+package kube
+
+import (
+	"errors"
+	"time"
+
+	"overlord/pkg/log"
+)
+
+// Config is the config of controller.
+type Config struct {
+	*log.Config
+	// Kube is the address of kubernetes api server, empty means the
+	// controller runs in pod and the service account is used.
+	Kube string `toml:"kube"`
+	// KubeTokenFile is the bearer token file of Kube.
+	KubeTokenFile string `toml:"kube_token_file"`
+	// Namespace is watched by controller, empty means all the namespaces.
+	Namespace string `toml:"namespace"`
+	// APIServer is the address of overlord apiserver, and APIToken is its
+	// bearer token with the operator role if auth is enabled.
+	APIServer string `toml:"apiserver"`
+	APIToken  string `toml:"api_token"`
+	// Resync is the interval of listing all the resources again, and Poll
+	// is the interval of checking the running jobs.
+	Resync Duration `toml:"resync"`
+	Poll   Duration `toml:"poll"`
+}
+
+// Duration is time.Duration decoded from text like 30s.
+type Duration time.Duration
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Duration) UnmarshalText(text []byte) error {
+	tmp, err := time.ParseDuration(string(text))
+	if err == nil {
+		*d = Duration(tmp)
+	}
+	return err
+}
+
+// SetDefault sets the default value of config.
+func (c *Config) SetDefault() {
+	if c.Resync <= 0 {
+		c.Resync = Duration(5 * time.Minute)
+	}
+	if c.Poll <= 0 {
+		c.Poll = Duration(5 * time.Second)
+	}
+}
+
+// Validate checks the config.
+func (c *Config) Validate() error {
+	if c.APIServer == "" {
+		return errors.New("apiserver must be set")
+	}
+	return nil
+}
@@ -0,0 +1,351 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"overlord/pkg/log"
+	"overlord/platform/api/model"
+	"overlord/platform/job"
+)
+
+// define the ops of jobs created by controller.
+const (
+	opCreate  = "create"
+	opScale   = "scale"
+	opUpgrade = "upgrade"
+	opDelete  = "delete"
+)
+
+// Controller reconciles RedisCluster and MemcacheCluster resources into the
+// clusters of overlord by the jobs of apiserver, and surfaces the results of
+// jobs as the conditions of resources.
+type Controller struct {
+	kube      *Client
+	api       *API
+	namespace string
+	resync    time.Duration
+	poll      time.Duration
+
+	mu      sync.Mutex
+	pending map[string]struct{}
+	keys    chan string
+
+	now func() time.Time
+}
+
+// New new a controller watching the resources in namespace, all the
+// namespaces if it's empty.
+func New(kube *Client, api *API, namespace string, resync, poll time.Duration) *Controller {
+	return &Controller{
+		kube:      kube,
+		api:       api,
+		namespace: namespace,
+		resync:    resync,
+		poll:      poll,
+		pending:   make(map[string]struct{}),
+		keys:      make(chan string, 1024),
+		now:       time.Now,
+	}
+}
+
+// Run watches the resources and reconciles them one by one until ctx done.
+func (c *Controller) Run(ctx context.Context) {
+	for kind := range Plurals {
+		go c.watch(ctx, kind)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case key := <-c.keys:
+			c.mu.Lock()
+			delete(c.pending, key)
+			c.mu.Unlock()
+			c.sync(ctx, key)
+		}
+	}
+}
+
+// watch lists and then watches the resources of kind, the list is done again
+// after each watch ends in resync, so that all the resources are reconciled
+// periodically.
+func (c *Controller) watch(ctx context.Context, kind string) {
+	for ctx.Err() == nil {
+		l, err := c.kube.List(ctx, kind, c.namespace)
+		if err != nil {
+			log.Errorf("list %s error %v", Plurals[kind], err)
+			c.sleep(ctx, c.poll)
+			continue
+		}
+		for _, cr := range l.Items {
+			c.enqueue(key(cr))
+		}
+		err = c.kube.Watch(ctx, kind, c.namespace, l.Metadata.ResourceVersion, int(c.resync/time.Second), func(e *Event) {
+			c.enqueue(key(e.Object))
+		})
+		if err != nil && ctx.Err() == nil {
+			log.Warnf("watch %s error %v", Plurals[kind], err)
+			c.sleep(ctx, c.poll)
+		}
+	}
+}
+
+func (c *Controller) sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
+
+func key(cr *CacheCluster) string {
+	return strings.Join([]string{cr.Kind, cr.Metadata.Namespace, cr.Metadata.Name}, "/")
+}
+
+// enqueue adds key to be reconciled if it's not pending.
+func (c *Controller) enqueue(key string) {
+	c.mu.Lock()
+	if _, ok := c.pending[key]; ok {
+		c.mu.Unlock()
+		return
+	}
+	c.pending[key] = struct{}{}
+	c.mu.Unlock()
+	select {
+	case c.keys <- key:
+	default:
+		// NOTE: never block the watch.
+		go func() { c.keys <- key }()
+	}
+}
+
+// sync reconciles the latest resource of key, it's polled again if a job is
+// running or any error occurs.
+func (c *Controller) sync(ctx context.Context, key string) {
+	ss := strings.SplitN(key, "/", 3)
+	cr, err := c.kube.Get(ctx, ss[0], ss[1], ss[2])
+	if err == ErrNotFound {
+		return
+	}
+	if err == nil {
+		var requeue bool
+		if requeue, err = c.Reconcile(ctx, cr); err == nil && !requeue {
+			return
+		}
+	}
+	if err != nil {
+		log.Errorf("reconcile %s error %v", key, err)
+	}
+	time.AfterFunc(c.poll, func() { c.enqueue(key) })
+}
+
+// Reconcile makes the overlord cluster of cr as desired by a job each time,
+// and updates the status of cr. It reports whether cr should be reconciled
+// again to poll the running job.
+func (c *Controller) Reconcile(ctx context.Context, cr *CacheCluster) (requeue bool, err error) {
+	if cr.Metadata.DeletionTimestamp != "" {
+		if !hasFinalizer(cr) {
+			return false, nil
+		}
+		var removed bool
+		if removed, err = c.remove(ctx, cr); err != nil || removed {
+			return false, err
+		}
+		return true, c.updateStatus(ctx, cr)
+	}
+	if !hasFinalizer(cr) {
+		if err = c.kube.PatchFinalizers(ctx, cr, append(cr.Metadata.Finalizers, Finalizer)); err != nil {
+			return
+		}
+	}
+	orig, _ := json.Marshal(cr.Status)
+	requeue, err = c.reconcile(ctx, cr)
+	if st, _ := json.Marshal(cr.Status); string(st) != string(orig) {
+		if perr := c.updateStatus(ctx, cr); err == nil {
+			err = perr
+		}
+	}
+	return
+}
+
+func (c *Controller) reconcile(ctx context.Context, cr *CacheCluster) (bool, error) {
+	st := &cr.Status
+	if running, err := c.checkJob(ctx, cr); err != nil || running {
+		return running, err
+	}
+	if fc := st.Condition(ConditionFailed); fc != nil && fc.Status == "True" && st.ObservedGeneration == cr.Metadata.Generation {
+		// NOTE: the failed job is not retried until the spec changed.
+		return false, nil
+	}
+	name := cr.ClusterName()
+	cluster, err := c.api.GetCluster(ctx, name)
+	if err == ErrNotFound {
+		return c.create(ctx, cr)
+	} else if err != nil {
+		return false, err
+	}
+	st.Cluster = name
+	st.FrontEndPort = cluster.FrontEndPort
+	st.Instances = cluster.Number
+	st.Version = cluster.Version
+	switch {
+	case cluster.State == model.StateWaiting:
+		// NOTE: deploying by the job created by others.
+		c.progressing(cr, cluster.State, fmt.Sprintf("cluster %s is deploying", name))
+		return true, nil
+	case cr.Spec.Version != "" && cr.Spec.Version != cluster.Version:
+		j, err := c.api.UpgradeCluster(ctx, name, cr.Spec.Version)
+		return c.started(cr, opUpgrade, PhaseUpgrading, j, err)
+	case cr.Spec.Instances > 0 && cr.Spec.Instances != cluster.Number:
+		j, err := c.api.ScaleCluster(ctx, name, cr.Spec.Instances)
+		return c.started(cr, opScale, PhaseScaling, j, err)
+	case cluster.State == model.StateError:
+		st.Phase = PhaseFailed
+		st.ObservedGeneration = cr.Metadata.Generation
+		st.SetCondition(ConditionReady, "False", "ClusterError", fmt.Sprintf("cluster %s is in error state", name), c.timestamp())
+		return false, nil
+	}
+	st.Phase = PhaseRunning
+	st.ObservedGeneration = cr.Metadata.Generation
+	now := c.timestamp()
+	st.SetCondition(ConditionReady, "True", "Deployed", fmt.Sprintf("cluster %s is serving on port %d", name, cluster.FrontEndPort), now)
+	st.SetCondition(ConditionProgressing, "False", "Idle", "", now)
+	st.SetCondition(ConditionFailed, "False", "Idle", "", now)
+	return false, nil
+}
+
+func (c *Controller) create(ctx context.Context, cr *CacheCluster) (bool, error) {
+	ctype, err := cr.CacheType()
+	if err != nil {
+		c.failed(cr, "InvalidSpec", err.Error())
+		return false, nil
+	}
+	p := &model.ParamCluster{
+		Name:         cr.ClusterName(),
+		Appids:       cr.Spec.Appids,
+		Spec:         cr.Spec.Spec,
+		Version:      cr.Spec.Version,
+		CacheType:    string(ctype),
+		TotalMemory:  cr.Spec.TotalMemory,
+		Group:        cr.Spec.Group,
+		Attributes:   cr.Spec.Attributes,
+		AntiAffinity: cr.Spec.AntiAffinity,
+		MasterSpread: cr.Spec.MasterSpread,
+	}
+	if err = p.Validate(); err != nil {
+		c.failed(cr, "InvalidSpec", err.Error())
+		return false, nil
+	}
+	j, err := c.api.CreateCluster(ctx, p)
+	cr.Status.Cluster = p.Name
+	return c.started(cr, opCreate, PhaseCreating, j, err)
+}
+
+// remove removes the cluster of cr, it reports true once the cluster is
+// removed and the finalizer is removed too.
+func (c *Controller) remove(ctx context.Context, cr *CacheCluster) (bool, error) {
+	st := &cr.Status
+	st.Phase = PhaseDeleting
+	if _, err := c.api.GetCluster(ctx, cr.ClusterName()); err == ErrNotFound {
+		var fs []string
+		for _, f := range cr.Metadata.Finalizers {
+			if f != Finalizer {
+				fs = append(fs, f)
+			}
+		}
+		return true, c.kube.PatchFinalizers(ctx, cr, fs)
+	} else if err != nil {
+		return false, err
+	}
+	if st.JobOp == opDelete {
+		running, err := c.checkJob(ctx, cr)
+		if err != nil || running {
+			return false, err
+		}
+	}
+	j, err := c.api.RemoveCluster(ctx, cr.ClusterName())
+	_, err = c.started(cr, opDelete, PhaseDeleting, j, err)
+	return false, err
+}
+
+// checkJob checks the last job of cr and reports whether it's running.
+func (c *Controller) checkJob(ctx context.Context, cr *CacheCluster) (bool, error) {
+	st := &cr.Status
+	if pc := st.Condition(ConditionProgressing); st.Job == "" || pc == nil || pc.Status != "True" {
+		return false, nil
+	}
+	j, err := c.api.GetJob(ctx, st.Job)
+	if err == ErrNotFound {
+		j, err = &model.Job{ID: st.Job, State: job.StateLost}, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	msg := fmt.Sprintf("job %s to %s cluster %s is %s", st.Job, st.JobOp, st.Cluster, j.State)
+	switch j.State {
+	case job.StateDone:
+		now := c.timestamp()
+		st.SetCondition(ConditionProgressing, "False", j.State, msg, now)
+		st.SetCondition(ConditionFailed, "False", j.State, msg, now)
+		return false, nil
+	case job.StateFail, job.StateLost, job.StateRejected:
+		c.failed(cr, j.State, msg)
+		return false, nil
+	}
+	c.progressing(cr, j.State, msg)
+	return true, nil
+}
+
+// started records the job started by op.
+func (c *Controller) started(cr *CacheCluster, op, phase string, j *model.Job, err error) (bool, error) {
+	if err != nil {
+		if ae, ok := err.(*APIError); ok && ae.Rejected() {
+			c.failed(cr, "Rejected", fmt.Sprintf("%s cluster %s error %v", op, cr.ClusterName(), err))
+			return false, nil
+		}
+		// NOTE: retried by the next poll.
+		return false, err
+	}
+	st := &cr.Status
+	st.Job, st.JobOp, st.Phase = j.ID, op, phase
+	st.ObservedGeneration = cr.Metadata.Generation
+	c.progressing(cr, j.State, fmt.Sprintf("job %s to %s cluster %s is %s", j.ID, op, cr.ClusterName(), j.State))
+	return true, nil
+}
+
+func (c *Controller) progressing(cr *CacheCluster, reason, msg string) {
+	now := c.timestamp()
+	cr.Status.SetCondition(ConditionProgressing, "True", reason, msg, now)
+	cr.Status.SetCondition(ConditionReady, "False", reason, msg, now)
+}
+
+func (c *Controller) failed(cr *CacheCluster, reason, msg string) {
+	st := &cr.Status
+	now := c.timestamp()
+	st.Phase = PhaseFailed
+	st.ObservedGeneration = cr.Metadata.Generation
+	st.SetCondition(ConditionFailed, "True", reason, msg, now)
+	st.SetCondition(ConditionProgressing, "False", reason, msg, now)
+	st.SetCondition(ConditionReady, "False", reason, msg, now)
+}
+
+func (c *Controller) updateStatus(ctx context.Context, cr *CacheCluster) error {
+	return c.kube.PatchStatus(ctx, cr)
+}
+
+func (c *Controller) timestamp() string {
+	return c.now().UTC().Format(time.RFC3339)
+}
+
+func hasFinalizer(cr *CacheCluster) bool {
+	for _, f := range cr.Metadata.Finalizers {
+		if f == Finalizer {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,314 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"overlord/platform/api/model"
+	"overlord/platform/job"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeKube serves the resources of a namespace in memory.
+type fakeKube struct {
+	mu  sync.Mutex
+	crs map[string]*CacheCluster
+}
+
+func (f *fakeKube) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// /apis/overlord.io/v1alpha1/namespaces/ns/plural[/name[/status]]
+	ss := strings.Split(strings.TrimPrefix(r.URL.Path, "/apis/overlord.io/v1alpha1/namespaces/"), "/")
+	if len(ss) == 2 {
+		if r.URL.Query().Get("watch") == "true" {
+			// NOTE: no events and the watch ends soon.
+			f.mu.Unlock()
+			time.Sleep(50 * time.Millisecond)
+			f.mu.Lock()
+			return
+		}
+		l := &CacheClusterList{}
+		for _, cr := range f.crs {
+			if Plurals[cr.Kind] == ss[1] {
+				l.Items = append(l.Items, cr)
+			}
+		}
+		json.NewEncoder(w).Encode(l)
+		return
+	}
+	cr, ok := f.crs[ss[2]]
+	if !ok || Plurals[cr.Kind] != ss[1] {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodPatch {
+		patch := &CacheCluster{}
+		json.NewDecoder(r.Body).Decode(patch)
+		if len(ss) == 4 {
+			cr.Status = patch.Status
+		} else {
+			cr.Metadata.Finalizers = patch.Metadata.Finalizers
+			if cr.Metadata.DeletionTimestamp != "" && len(cr.Metadata.Finalizers) == 0 {
+				delete(f.crs, ss[2])
+			}
+		}
+	}
+	json.NewEncoder(w).Encode(cr)
+}
+
+func (f *fakeKube) get(name string) *CacheCluster {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cr, ok := f.crs[name]
+	if !ok {
+		return nil
+	}
+	data, _ := json.Marshal(cr)
+	cp := &CacheCluster{}
+	json.Unmarshal(data, cp)
+	return cp
+}
+
+func (f *fakeKube) update(name string, fn func(cr *CacheCluster)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn(f.crs[name])
+}
+
+// fakeAPI serves the clusters and jobs of apiserver in memory.
+type fakeAPI struct {
+	mu       sync.Mutex
+	clusters map[string]*model.Cluster
+	jobs     map[string]*model.Job
+	ops      []string
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1")
+	if strings.HasPrefix(path, "/jobs/") {
+		j, ok := f.jobs[strings.TrimPrefix(path, "/jobs/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(j)
+		return
+	}
+	ss := strings.Split(strings.TrimPrefix(path, "/clusters/"), "/")
+	if r.Method == http.MethodPost && ss[0] == "" {
+		p := &model.ParamCluster{}
+		json.NewDecoder(r.Body).Decode(p)
+		if p.Group == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.job(w, "create "+p.Name+" "+p.CacheType)
+		return
+	}
+	c, ok := f.clusters[ss[0]]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet:
+		json.NewEncoder(w).Encode(c)
+	case r.Method == http.MethodDelete:
+		f.job(w, "delete "+c.Name)
+	case len(ss) == 2 && ss[1] == "instances":
+		p := &model.ParamScale{}
+		json.NewDecoder(r.Body).Decode(p)
+		f.job(w, "scale "+c.Name)
+	case len(ss) == 2 && ss[1] == "upgrade":
+		p := &model.ParamUpgrade{}
+		json.NewDecoder(r.Body).Decode(p)
+		f.job(w, "upgrade "+c.Name+" "+p.Version)
+	}
+}
+
+func (f *fakeAPI) job(w http.ResponseWriter, op string) {
+	f.ops = append(f.ops, op)
+	j := &model.Job{ID: "sh001." + string(rune('0'+len(f.ops))), State: job.StatePending}
+	f.jobs[j.ID] = j
+	json.NewEncoder(w).Encode(j)
+}
+
+// finish finishes the last job in state and then calls fn.
+func (f *fakeAPI) finish(state string, fn func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.jobs["sh001."+string(rune('0'+len(f.ops)))].State = state
+	if fn != nil {
+		fn()
+	}
+}
+
+func condition(cr *CacheCluster, typ string) string {
+	if c := cr.Status.Condition(typ); c != nil {
+		return c.Status
+	}
+	return ""
+}
+
+func TestReconcile(t *testing.T) {
+	kube := &fakeKube{crs: map[string]*CacheCluster{
+		"cache": {
+			Kind:     KindRedisCluster,
+			Metadata: ObjectMeta{Name: "cache", Namespace: "test", Generation: 1},
+			Spec:     ClusterSpec{Version: "4.0.11", Spec: "1c2g", TotalMemory: 4096, Group: "sh001"},
+		},
+	}}
+	api := &fakeAPI{clusters: map[string]*model.Cluster{}, jobs: map[string]*model.Job{}}
+	ks, as := httptest.NewServer(kube), httptest.NewServer(api)
+	defer ks.Close()
+	defer as.Close()
+	c := New(NewClient(ks.URL, "", nil), NewAPI(as.URL, "", nil), "test", time.Minute, time.Second)
+	ctx := context.Background()
+	reconcile := func() bool {
+		cr, err := c.kube.Get(ctx, KindRedisCluster, "test", "cache")
+		if !assert.NoError(t, err) {
+			return false
+		}
+		requeue, err := c.Reconcile(ctx, cr)
+		assert.NoError(t, err)
+		return requeue
+	}
+
+	// created with finalizer.
+	assert.True(t, reconcile())
+	cr := kube.get("cache")
+	assert.Equal(t, []string{Finalizer}, cr.Metadata.Finalizers)
+	assert.Equal(t, PhaseCreating, cr.Status.Phase)
+	assert.Equal(t, "test-cache", cr.Status.Cluster)
+	assert.Equal(t, "True", condition(cr, ConditionProgressing))
+	assert.Equal(t, []string{"create test-cache redis_cluster"}, api.ops)
+
+	// polled until the job done.
+	assert.True(t, reconcile())
+	api.finish(job.StateDone, func() {
+		api.clusters["test-cache"] = &model.Cluster{Name: "test-cache", State: model.StateDone, FrontEndPort: 7000, Version: "4.0.11", Number: 4}
+	})
+	assert.False(t, reconcile())
+	cr = kube.get("cache")
+	assert.Equal(t, PhaseRunning, cr.Status.Phase)
+	assert.Equal(t, "True", condition(cr, ConditionReady))
+	assert.Equal(t, "False", condition(cr, ConditionProgressing))
+	assert.Equal(t, 7000, cr.Status.FrontEndPort)
+	assert.Equal(t, 4, cr.Status.Instances)
+	assert.Equal(t, int64(1), cr.Status.ObservedGeneration)
+
+	// scaled and failed, not retried until the spec changed.
+	kube.update("cache", func(cr *CacheCluster) {
+		cr.Spec.Instances = 6
+		cr.Metadata.Generation = 2
+	})
+	assert.True(t, reconcile())
+	assert.Equal(t, PhaseScaling, kube.get("cache").Status.Phase)
+	api.finish(job.StateFail, nil)
+	assert.False(t, reconcile())
+	assert.False(t, reconcile())
+	cr = kube.get("cache")
+	assert.Equal(t, PhaseFailed, cr.Status.Phase)
+	assert.Equal(t, "True", condition(cr, ConditionFailed))
+	assert.Equal(t, "False", condition(cr, ConditionReady))
+	assert.Len(t, api.ops, 2)
+
+	// upgraded once the spec changed.
+	kube.update("cache", func(cr *CacheCluster) {
+		cr.Spec.Instances = 0
+		cr.Spec.Version = "5.0.3"
+		cr.Metadata.Generation = 3
+	})
+	assert.True(t, reconcile())
+	assert.Equal(t, "upgrade test-cache 5.0.3", api.ops[2])
+	api.finish(job.StateDone, func() { api.clusters["test-cache"].Version = "5.0.3" })
+	assert.False(t, reconcile())
+	cr = kube.get("cache")
+	assert.Equal(t, "True", condition(cr, ConditionReady))
+	assert.Equal(t, "False", condition(cr, ConditionFailed))
+	assert.Equal(t, "5.0.3", cr.Status.Version)
+
+	// removed and then the finalizer is removed.
+	kube.update("cache", func(cr *CacheCluster) { cr.Metadata.DeletionTimestamp = "2019-01-01T00:00:00Z" })
+	assert.True(t, reconcile())
+	assert.Equal(t, PhaseDeleting, kube.get("cache").Status.Phase)
+	assert.Equal(t, "delete test-cache", api.ops[3])
+	assert.True(t, reconcile())
+	assert.Len(t, api.ops, 4)
+	api.finish(job.StateDone, func() { delete(api.clusters, "test-cache") })
+	assert.False(t, reconcile())
+	assert.Nil(t, kube.get("cache"))
+}
+
+func TestReconcileInvalid(t *testing.T) {
+	kube := &fakeKube{crs: map[string]*CacheCluster{
+		"mc": {
+			Kind:     KindMemcacheCluster,
+			Metadata: ObjectMeta{Name: "mc", Namespace: "test", Generation: 1},
+			Spec:     ClusterSpec{CacheType: "redis", Version: "1.5.12", Spec: "1c2g", TotalMemory: 1024, Group: "sh001"},
+		},
+		"nogroup": {
+			Kind:     KindMemcacheCluster,
+			Metadata: ObjectMeta{Name: "nogroup", Namespace: "test", Generation: 1},
+			Spec:     ClusterSpec{Version: "1.5.12", Spec: "1c2g", TotalMemory: 1024},
+		},
+	}}
+	api := &fakeAPI{clusters: map[string]*model.Cluster{}, jobs: map[string]*model.Job{}}
+	ks, as := httptest.NewServer(kube), httptest.NewServer(api)
+	defer ks.Close()
+	defer as.Close()
+	c := New(NewClient(ks.URL, "", nil), NewAPI(as.URL, "", nil), "test", time.Minute, time.Second)
+	for _, name := range []string{"mc", "nogroup"} {
+		cr, err := c.kube.Get(context.Background(), KindMemcacheCluster, "test", name)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		requeue, err := c.Reconcile(context.Background(), cr)
+		assert.NoError(t, err)
+		assert.False(t, requeue)
+		cr = kube.get(name)
+		assert.Equal(t, PhaseFailed, cr.Status.Phase, name)
+		assert.Equal(t, "True", condition(cr, ConditionFailed), name)
+	}
+	assert.Empty(t, api.ops)
+}
+
+func TestRun(t *testing.T) {
+	kube := &fakeKube{crs: map[string]*CacheCluster{
+		"cache": {
+			Kind:     KindRedisCluster,
+			Metadata: ObjectMeta{Name: "cache", Namespace: "test", Generation: 1},
+			Spec:     ClusterSpec{Version: "4.0.11", Spec: "1c2g", TotalMemory: 4096, Group: "sh001"},
+		},
+	}}
+	api := &fakeAPI{clusters: map[string]*model.Cluster{}, jobs: map[string]*model.Job{}}
+	ks, as := httptest.NewServer(kube), httptest.NewServer(api)
+	defer ks.Close()
+	defer as.Close()
+	c := New(NewClient(ks.URL, "", nil), NewAPI(as.URL, "", nil), "test", time.Second, 10*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Run(ctx)
+	time.Sleep(100 * time.Millisecond)
+	api.finish(job.StateDone, func() {
+		api.clusters["test-cache"] = &model.Cluster{Name: "test-cache", State: model.StateDone, FrontEndPort: 7000, Version: "4.0.11", Number: 4}
+	})
+	for i := 0; i < 100; i++ {
+		if condition(kube.get("cache"), ConditionReady) == "True" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, "True", condition(kube.get("cache"), ConditionReady))
+	assert.Len(t, api.ops, 1)
+}
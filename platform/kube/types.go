@@ -0,0 +1,172 @@
+package kube
+
+import (
+	"fmt"
+
+	"overlord/pkg/types"
+)
+
+// define the custom resources reconciled by controller.
+const (
+	Group      = "overlord.io"
+	APIVersion = "v1alpha1"
+
+	KindRedisCluster    = "RedisCluster"
+	KindMemcacheCluster = "MemcacheCluster"
+
+	// Finalizer keeps the resource until the overlord cluster is removed.
+	Finalizer = "overlord.io/cluster"
+)
+
+// Plurals are the resource names of the kinds.
+var Plurals = map[string]string{
+	KindRedisCluster:    "redisclusters",
+	KindMemcacheCluster: "memcacheclusters",
+}
+
+// define the phases of cluster.
+const (
+	PhaseCreating  = "Creating"
+	PhaseRunning   = "Running"
+	PhaseScaling   = "Scaling"
+	PhaseUpgrading = "Upgrading"
+	PhaseDeleting  = "Deleting"
+	PhaseFailed    = "Failed"
+)
+
+// define the types of conditions.
+const (
+	// ConditionReady is true if the cluster is deployed and no job running.
+	ConditionReady = "Ready"
+	// ConditionProgressing is true if a job of the cluster is running, its
+	// reason is the state of the job.
+	ConditionProgressing = "Progressing"
+	// ConditionFailed is true if the last job failed, which is not retried
+	// until the spec changed.
+	ConditionFailed = "Failed"
+)
+
+// ObjectMeta is the metadata of resource used by controller.
+type ObjectMeta struct {
+	Name              string   `json:"name"`
+	Namespace         string   `json:"namespace,omitempty"`
+	UID               string   `json:"uid,omitempty"`
+	ResourceVersion   string   `json:"resourceVersion,omitempty"`
+	Generation        int64    `json:"generation,omitempty"`
+	DeletionTimestamp string   `json:"deletionTimestamp,omitempty"`
+	Finalizers        []string `json:"finalizers,omitempty"`
+}
+
+// CacheCluster is the resource of RedisCluster and MemcacheCluster.
+type CacheCluster struct {
+	APIVersion string        `json:"apiVersion,omitempty"`
+	Kind       string        `json:"kind,omitempty"`
+	Metadata   ObjectMeta    `json:"metadata"`
+	Spec       ClusterSpec   `json:"spec"`
+	Status     ClusterStatus `json:"status,omitempty"`
+}
+
+// CacheClusterList is the list of CacheCluster.
+type CacheClusterList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []*CacheCluster `json:"items"`
+}
+
+// ClusterSpec is the desired cluster, the same as the params of apiserver.
+type ClusterSpec struct {
+	// CacheType is redis or redis_cluster of RedisCluster, default
+	// redis_cluster, and memcache or memcache_binary of MemcacheCluster,
+	// default memcache.
+	CacheType string `json:"cacheType,omitempty"`
+	Version   string `json:"version"`
+	// Spec is the cpu and memory of each instance, such as 0.5c2g.
+	Spec string `json:"spec"`
+	// TotalMemory is the memory of cluster with MB, which decides the
+	// instances when created.
+	TotalMemory float64 `json:"totalMemory"`
+	// Instances scales the cluster once created if it's set.
+	Instances    int               `json:"instances,omitempty"`
+	Group        string            `json:"group"`
+	Appids       []string          `json:"appids,omitempty"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	AntiAffinity string            `json:"antiAffinity,omitempty"`
+	MasterSpread string            `json:"masterSpread,omitempty"`
+}
+
+// ClusterStatus is the observed cluster and its last job.
+type ClusterStatus struct {
+	ObservedGeneration int64  `json:"observedGeneration,omitempty"`
+	Phase              string `json:"phase,omitempty"`
+	// Cluster is the name of overlord cluster.
+	Cluster      string `json:"cluster,omitempty"`
+	FrontEndPort int    `json:"frontEndPort,omitempty"`
+	Instances    int    `json:"instances,omitempty"`
+	Version      string `json:"version,omitempty"`
+	// Job is the id of the last job and JobOp is its op, such as create.
+	Job        string       `json:"job,omitempty"`
+	JobOp      string       `json:"jobOp,omitempty"`
+	Conditions []*Condition `json:"conditions,omitempty"`
+}
+
+// Condition is the condition of cluster.
+type Condition struct {
+	Type               string `json:"type"`
+	Status             string `json:"status"`
+	Reason             string `json:"reason,omitempty"`
+	Message            string `json:"message,omitempty"`
+	LastTransitionTime string `json:"lastTransitionTime,omitempty"`
+}
+
+// ClusterName is the name of overlord cluster of cr, which is unique in all
+// namespaces.
+func (cr *CacheCluster) ClusterName() string {
+	return fmt.Sprintf("%s-%s", cr.Metadata.Namespace, cr.Metadata.Name)
+}
+
+// CacheType returns the cache type of cr by its kind.
+func (cr *CacheCluster) CacheType() (types.CacheType, error) {
+	ctype := types.CacheType(cr.Spec.CacheType)
+	switch cr.Kind {
+	case KindRedisCluster:
+		if ctype == "" {
+			return types.CacheTypeRedisCluster, nil
+		}
+		if ctype == types.CacheTypeRedis || ctype == types.CacheTypeRedisCluster {
+			return ctype, nil
+		}
+	case KindMemcacheCluster:
+		if ctype == "" {
+			return types.CacheTypeMemcache, nil
+		}
+		if ctype == types.CacheTypeMemcache || ctype == types.CacheTypeMemcacheBinary {
+			return ctype, nil
+		}
+	}
+	return "", fmt.Errorf("cache type %s not support by %s", ctype, cr.Kind)
+}
+
+// Condition returns the condition of type typ, nil if not set.
+func (s *ClusterStatus) Condition(typ string) *Condition {
+	for _, c := range s.Conditions {
+		if c.Type == typ {
+			return c
+		}
+	}
+	return nil
+}
+
+// SetCondition sets the condition of type typ, the transition time is
+// updated only if the status changed.
+func (s *ClusterStatus) SetCondition(typ, status, reason, message, now string) {
+	c := s.Condition(typ)
+	if c == nil {
+		c = &Condition{Type: typ}
+		s.Conditions = append(s.Conditions, c)
+	}
+	if c.Status != status {
+		c.LastTransitionTime = now
+	}
+	c.Status, c.Reason, c.Message = status, reason, message
+}
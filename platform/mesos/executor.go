@@ -5,7 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
-	"os"
+	"sync"
 	"time"
 
 	"overlord/pkg/container"
@@ -49,6 +49,15 @@ type Executor struct {
 	shouldQuit     bool
 	p              *proc.Proc
 	c              *container.Container
+	info           *create.DeployInfo
+	host           string
+
+	// lock protects the instance p and c from healing and stopping.
+	lock     sync.Mutex
+	stopped  bool
+	policy   *restartPolicy
+	restarts int
+	flapping bool
 }
 
 const (
@@ -86,6 +95,7 @@ func New() *Executor {
 		cfg:            cfg,
 		unackedTasks:   make(map[ms.TaskID]ms.TaskInfo),
 		unackedUpdates: make(map[string]executor.Call_Update),
+		policy:         newRestartPolicy(),
 		cli: calls.SenderWith(
 			httpexec.NewSender(http.Send),
 			callOptions...,
@@ -149,6 +159,9 @@ func (ec *Executor) launch(e *executor.Event) (err error) {
 		log.Errorf("get deploy info err %v", err)
 		return
 	}
+	ec.info = dpinfo
+	host := fmt.Sprintf("%s:%d", tdata.IP, tdata.Port)
+	ec.host = host
 	if dpinfo.Image != "" {
 		ec.c, err = create.SetupCacheContainer(dpinfo)
 	} else {
@@ -156,10 +169,11 @@ func (ec *Executor) launch(e *executor.Event) (err error) {
 	}
 	if err != nil {
 		log.Errorf("start cache service err %v", err)
+		ec.jobLog("start cache service %s on agent %s err %v", host, ec.agent.GetHostname(), err)
 		return
 	}
+	ec.jobLog("cache service %s started on agent %s with version %s", host, ec.agent.GetHostname(), dpinfo.Version)
 
-	host := fmt.Sprintf("%s:%d", tdata.IP, tdata.Port)
 	err = ec.db.Set(context.Background(), fmt.Sprintf("%s/%s", etcd.HeartBeatDir, host), task.TaskID.String())
 	if err != nil {
 		log.Errorf("set heartbeat key err %v", err)
@@ -181,12 +195,27 @@ func (ec *Executor) monitor(e *executor.Event, tp types.CacheType, host string)
 	go func() {
 		var errCount int
 		var running = false
+		exited := ec.waitInstance()
 		for {
-			// close monitor when continuous fail over maxErr
-			if errCount > maxErr {
-				cli.Close()
-				ec.shouldQuit = true
-				return
+			// restart the instance when it exits or continuous fail over maxErr
+			var reason string
+			select {
+			case err := <-exited:
+				reason = fmt.Sprintf("exit with err %v", err)
+			default:
+				if errCount > maxErr {
+					reason = fmt.Sprintf("health check fail %d times", errCount)
+				}
+			}
+			if reason != "" {
+				if !ec.heal(reason) {
+					cli.Close()
+					ec.quit()
+					return
+				}
+				errCount = 0
+				exited = ec.waitInstance()
+				continue
 			}
 			err := cli.Ping()
 			// refresh ttl no sucess.
@@ -198,6 +227,7 @@ func (ec *Executor) monitor(e *executor.Event, tp types.CacheType, host string)
 					running = true
 				}
 				errCount = 0
+				ec.recovered()
 				_ = ec.db.Refresh(context.Background(), host, nodeTTL)
 			} else {
 				errCount++
@@ -216,18 +246,11 @@ type Pinger interface {
 
 // Run start executor.
 func (ec *Executor) Run(c context.Context) {
-	defer func() {
-		if ec.c != nil {
-			ec.c.Stop()
-		} else if ec.p != nil {
-			ec.p.Stop()
-		}
-	}()
+	defer ec.stopInstance()
 	var (
 		shouldReconnect = maybeReconnect(ec.cfg)
 		disconnected    = time.Now()
 	)
-	go ec.quitCheck()
 	for {
 		sub := calls.Subscribe(ec.unacknowledgedTasks(), ec.unacknowledgedUpdates())
 		resp, err := ec.subscriber.Send(c, calls.NonStreaming(sub))
@@ -254,17 +277,15 @@ func (ec *Executor) Run(c context.Context) {
 	}
 }
 
-func (ec *Executor) quitCheck() {
-	for {
-		if ec.c != nil {
-			log.Infof("executor exit with err %v", ec.c.Wait())
-			os.Exit(0)
-		} else if ec.p != nil {
-			log.Infof("executor exit with err %v", ec.p.Wait())
-			os.Exit(0)
-		}
-
-		time.Sleep(time.Second * 5)
+// jobLog appends the log line into the execution logs of the job which
+// deployed this instance, the source is the address of the instance.
+func (ec *Executor) jobLog(format string, args ...interface{}) {
+	if ec.db == nil || ec.info == nil || ec.info.JobID == "" {
+		return
+	}
+	err := ec.db.AppendJobLog(context.Background(), ec.info.Group, ec.info.JobID, "executor "+ec.host, fmt.Sprintf(format, args...))
+	if err != nil {
+		log.Warnf("append job log err %v", err)
 	}
 }
 
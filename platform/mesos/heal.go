@@ -0,0 +1,221 @@
+package mesos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"overlord/pkg/etcd"
+	"overlord/pkg/log"
+	"overlord/platform/job"
+	"overlord/platform/job/create"
+)
+
+const (
+	restartBackoffMin = time.Second
+	restartBackoffMax = time.Minute
+	// the instance is flapping if restarted flapRestarts times in flapWindow.
+	flapWindow   = time.Minute * 10
+	flapRestarts = 3
+	// maxRestarts is the restarts in a row without the instance turning
+	// healthy, then executor gives up and quits to let scheduler recover it.
+	maxRestarts = 10
+	// instanceTailLines is the lines of output kept in the exit error of the
+	// instance.
+	instanceTailLines = 64
+)
+
+var errInstanceStopped = errors.New("cache instance is stopped by executor")
+
+// restartPolicy doubles the delay of each restart of the instance from min
+// to max, and resets the delay once the instance keeps healthy in window.
+type restartPolicy struct {
+	min, max time.Duration
+	window   time.Duration
+	flap     int
+	limit    int
+
+	delay    time.Duration
+	inRow    int
+	restarts []time.Time
+}
+
+func newRestartPolicy() *restartPolicy {
+	return &restartPolicy{
+		min:    restartBackoffMin,
+		max:    restartBackoffMax,
+		window: flapWindow,
+		flap:   flapRestarts,
+		limit:  maxRestarts,
+	}
+}
+
+func (p *restartPolicy) trim(now time.Time) {
+	i := 0
+	for ; i < len(p.restarts); i++ {
+		if now.Sub(p.restarts[i]) < p.window {
+			break
+		}
+	}
+	p.restarts = p.restarts[i:]
+}
+
+func (p *restartPolicy) flapping() bool {
+	return len(p.restarts) >= p.flap
+}
+
+// next returns the delay before the restart at now and whether the instance
+// is flapping, giveUp if restarted too many times in a row.
+func (p *restartPolicy) next(now time.Time) (delay time.Duration, flapping, giveUp bool) {
+	p.trim(now)
+	if p.inRow >= p.limit {
+		return 0, p.flapping(), true
+	}
+	if p.delay == 0 {
+		p.delay = p.min
+	} else if p.delay *= 2; p.delay > p.max {
+		p.delay = p.max
+	}
+	p.inRow++
+	p.restarts = append(p.restarts, now)
+	return p.delay, p.flapping(), false
+}
+
+// healthy marks the instance healthy at now and returns whether the
+// instance stops flapping.
+func (p *restartPolicy) healthy(now time.Time) (stable bool) {
+	p.inRow = 0
+	flapping := p.flapping()
+	p.trim(now)
+	if len(p.restarts) == 0 {
+		p.delay = 0
+	}
+	return flapping && !p.flapping()
+}
+
+// heal restarts the failed cache instance with backoff, and reports the
+// flapping instance by its state. It returns false if executor gives up.
+func (ec *Executor) heal(reason string) bool {
+	ec.lock.Lock()
+	stopped := ec.stopped
+	ec.lock.Unlock()
+	if stopped {
+		// NOTE: the instance is stopped as the task killed.
+		return false
+	}
+	delay, flapping, giveUp := ec.policy.next(time.Now())
+	if giveUp {
+		ec.jobLog("cache service %s %s, give up after %d restarts in a row", ec.host, reason, ec.policy.limit)
+		return false
+	}
+	if flapping && !ec.flapping {
+		ec.flapping = true
+		ec.setState(job.StateFlapping)
+		ec.jobLog("cache service %s is flapping, restarted %d times in %v", ec.host, len(ec.policy.restarts), ec.policy.window)
+	}
+	ec.jobLog("cache service %s %s, restart in %v", ec.host, reason, delay)
+	time.Sleep(delay)
+	if err := ec.restartInstance(); err != nil {
+		log.Errorf("restart cache service %s err %v", ec.host, err)
+		ec.jobLog("restart cache service %s err %v", ec.host, err)
+		return err != errInstanceStopped
+	}
+	ec.restarts++
+	ec.setRestarts()
+	return true
+}
+
+// recovered marks the instance healthy and clears the flapping state once
+// it keeps healthy long enough.
+func (ec *Executor) recovered() {
+	if ec.policy.healthy(time.Now()) && ec.flapping {
+		ec.flapping = false
+		ec.setState(job.StateRunning)
+		ec.jobLog("cache service %s stops flapping", ec.host)
+	}
+}
+
+// restartInstance stops the instance if it's still alive and starts it in
+// the origin workdir, so that the data and cluster nodes conf are kept.
+func (ec *Executor) restartInstance() (err error) {
+	ec.lock.Lock()
+	defer ec.lock.Unlock()
+	if ec.stopped {
+		return errInstanceStopped
+	}
+	if ec.c != nil {
+		return ec.c.Restart()
+	}
+	if ec.p != nil {
+		ec.p.Stop()
+	}
+	ec.p, err = create.RestartCacheService(ec.info)
+	return
+}
+
+// stopInstance stops the instance and never restarts it again.
+func (ec *Executor) stopInstance() {
+	ec.lock.Lock()
+	defer ec.lock.Unlock()
+	ec.stopped = true
+	if ec.c != nil {
+		ec.c.Stop()
+	} else if ec.p != nil {
+		ec.p.Stop()
+	}
+}
+
+// waitInstance sends the exit error of the current instance into the
+// returned channel.
+func (ec *Executor) waitInstance() <-chan error {
+	ch := make(chan error, 1)
+	ec.lock.Lock()
+	c, p := ec.c, ec.p
+	ec.lock.Unlock()
+	go func() {
+		if c != nil {
+			err := c.Wait()
+			tail, terr := c.Tail(instanceTailLines)
+			if terr != nil {
+				log.Warnf("get output tail of cache service %s err %v", ec.host, terr)
+			}
+			ch <- withTail(err, tail)
+		} else if p != nil {
+			err := p.Wait()
+			ch <- withTail(err, p.Tail())
+		}
+	}()
+	return ch
+}
+
+// withTail appends the output tail of the instance to its exit error.
+func withTail(err error, tail []string) error {
+	if len(tail) == 0 {
+		return err
+	}
+	return fmt.Errorf("%v, output tail:\n%s", err, strings.Join(tail, "\n"))
+}
+
+// quit stops the instance and exits executor, the task is recovered by
+// scheduler then.
+func (ec *Executor) quit() {
+	ec.stopInstance()
+	ec.shouldQuit = true
+	log.Errorf("executor quit for cache service %s can not be healed", ec.host)
+	os.Exit(0)
+}
+
+func (ec *Executor) setState(state string) {
+	if err := ec.db.Set(context.Background(), fmt.Sprintf("%s/%s/state", etcd.InstanceDirPrefix, ec.host), state); err != nil {
+		log.Warnf("set state of %s err %v", ec.host, err)
+	}
+}
+
+func (ec *Executor) setRestarts() {
+	if err := ec.db.Set(context.Background(), fmt.Sprintf("%s/%s/restarts", etcd.InstanceDirPrefix, ec.host), fmt.Sprint(ec.restarts)); err != nil {
+		log.Warnf("set restarts of %s err %v", ec.host, err)
+	}
+}
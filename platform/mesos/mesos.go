@@ -26,6 +26,8 @@ type Config struct {
 	DBEndPoint string   `toml:"db_end_point"` //Endpoint of the database
 
 	ExecutorURL string `toml:"executor_url"`
+
+	Resource *ResourceConfig `toml:"resource"`
 }
 
 // TaskData encdoing to byte and send by task.
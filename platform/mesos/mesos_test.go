@@ -2,7 +2,11 @@ package mesos
 
 import (
 	"testing"
+	"time"
 
+	"overlord/pkg/etcd"
+
+	ms "github.com/mesos/mesos-go/api/v1/lib"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -10,3 +14,113 @@ func TestMakeResource(t *testing.T) {
 	rs := makeResources(0.1, 100, 31000)
 	assert.Equal(t, "cpus:0.1;mem:100;ports:[31000]", rs.String())
 }
+
+func TestFilterOffersByAttributes(t *testing.T) {
+	rack := func(host, r string) ms.Offer {
+		return ms.Offer{
+			Hostname: host,
+			Attributes: []ms.Attribute{
+				{Name: "rack", Text: &ms.Value_Text{Value: r}},
+				{Name: "disk", Set: &ms.Value_Set{Item: []string{"ssd", "hdd"}}},
+			},
+		}
+	}
+	offers := []ms.Offer{rack("h1", "r1"), rack("h2", "r2"), rack("h3", "r3")}
+
+	matched, unmatched := filterOffers(offers, nil)
+	assert.Len(t, matched, 3)
+	assert.Len(t, unmatched, 0)
+
+	matched, unmatched = filterOffers(offers, map[string]string{"attr.rack": "r1,r3", "attr.disk": "ssd"})
+	assert.Len(t, matched, 2)
+	assert.Equal(t, "h1", matched[0].Hostname)
+	assert.Equal(t, "h3", matched[1].Hostname)
+	assert.Len(t, unmatched, 1)
+
+	matched, _ = filterOffers(offers, map[string]string{"attr.zone": "z1"})
+	assert.Len(t, matched, 0)
+}
+
+func TestSpreadDomains(t *testing.T) {
+	zone := func(host, z string) ms.Offer {
+		return ms.Offer{
+			Hostname:   host,
+			Attributes: []ms.Attribute{{Name: "zone", Text: &ms.Value_Text{Value: z}}},
+		}
+	}
+	offers := []ms.Offer{zone("h1", "z1"), zone("h2", "z1"), {Hostname: "h3"}}
+
+	assert.Nil(t, spreadDomains(offers, ""))
+	assert.Nil(t, failureDomains(offers, "host"))
+	assert.Len(t, spreadDomains(offers, "host"), 3)
+
+	domains := spreadDomains(offers, "zone")
+	assert.Equal(t, "z1", domains["h1"])
+	assert.Equal(t, "z1", domains["h2"])
+	assert.Equal(t, "h3", domains["h3"])
+}
+
+func TestResourceConfig(t *testing.T) {
+	offers := []ms.Offer{{
+		ID:       ms.OfferID{Value: "o1"},
+		Hostname: "10.0.0.1",
+		Resources: []ms.Resource{
+			{Name: "cpus", Scalar: &ms.Value_Scalar{Value: 8}},
+			{Name: "mem", Scalar: &ms.Value_Scalar{Value: 1024}},
+			{Name: "ports", Ranges: &ms.Value_Ranges{Range: []ms.Value_Range{{Begin: 7000, End: 7099}}}},
+		},
+	}}
+
+	var rc *ResourceConfig
+	cpu, mem := rc.demand(1, 512)
+	assert.Equal(t, 1.0, cpu)
+	assert.Equal(t, 512.0, mem)
+	assert.Equal(t, offers, rc.reserve(offers))
+
+	rc = &ResourceConfig{CPURatio: 4, ReservedCPU: 2, ReservedMem: 2048}
+	cpu, mem = rc.demand(1, 512)
+	assert.Equal(t, 0.25, cpu)
+	assert.Equal(t, 512.0, mem)
+
+	reserved := rc.reserve(offers)
+	assert.Equal(t, "o1", reserved[0].ID.Value)
+	assert.Equal(t, 6.0, reserved[0].Resources[0].GetScalar().GetValue())
+	assert.Equal(t, 0.0, reserved[0].Resources[1].GetScalar().GetValue())
+	assert.Equal(t, 8.0, offers[0].Resources[0].GetScalar().GetValue())
+
+	cs := rc.capacities(reserved, time.Unix(100, 0))
+	assert.Len(t, cs, 1)
+	assert.Equal(t, &etcd.Capacity{Host: "10.0.0.1", CPU: 24, Memory: 0, Ports: 100, Time: 100}, cs[0])
+}
+
+func TestRestartPolicy(t *testing.T) {
+	p := newRestartPolicy()
+	now := time.Unix(1000, 0)
+
+	delay, flapping, giveUp := p.next(now)
+	assert.Equal(t, restartBackoffMin, delay)
+	assert.False(t, flapping)
+	assert.False(t, giveUp)
+	delay, _, _ = p.next(now.Add(time.Second))
+	assert.Equal(t, 2*restartBackoffMin, delay)
+	delay, flapping, _ = p.next(now.Add(3 * time.Second))
+	assert.Equal(t, 4*restartBackoffMin, delay)
+	assert.True(t, flapping)
+
+	assert.False(t, p.healthy(now.Add(time.Minute)))
+	delay, _, _ = p.next(now.Add(time.Minute))
+	assert.Equal(t, 8*restartBackoffMin, delay)
+	assert.True(t, p.healthy(now.Add(flapWindow+time.Minute)))
+	assert.False(t, p.healthy(now.Add(2*flapWindow)))
+	delay, flapping, _ = p.next(now.Add(2 * flapWindow))
+	assert.Equal(t, restartBackoffMin, delay)
+	assert.False(t, flapping)
+
+	for i := 0; i < maxRestarts-1; i++ {
+		delay, _, giveUp = p.next(now.Add(2 * flapWindow))
+		assert.False(t, giveUp)
+	}
+	assert.Equal(t, restartBackoffMax, delay)
+	_, _, giveUp = p.next(now.Add(2 * flapWindow))
+	assert.True(t, giveUp)
+}
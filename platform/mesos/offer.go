@@ -0,0 +1,130 @@
+package mesos
+
+import (
+	"strconv"
+	"strings"
+
+	"overlord/platform/chunk"
+	"overlord/platform/job"
+
+	ms "github.com/mesos/mesos-go/api/v1/lib"
+)
+
+// requiredAttrs parses the required host attributes from job params.
+// Value may contains multi values split by comma which means any of them.
+func requiredAttrs(params map[string]string) map[string][]string {
+	attrs := make(map[string][]string)
+	for key, val := range params {
+		if !strings.HasPrefix(key, job.ParamAttrPrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(key, job.ParamAttrPrefix)
+		for _, v := range strings.Split(val, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				attrs[name] = append(attrs[name], v)
+			}
+		}
+	}
+	return attrs
+}
+
+// filterOffers splits the offers by whether the agent attributes fulfilled
+// all the required host attributes of the job params.
+func filterOffers(offers []ms.Offer, params map[string]string) (matched, unmatched []ms.Offer) {
+	attrs := requiredAttrs(params)
+	if len(attrs) == 0 {
+		return offers, nil
+	}
+	for _, offer := range offers {
+		if matchAttrs(offer, attrs) {
+			matched = append(matched, offer)
+		} else {
+			unmatched = append(unmatched, offer)
+		}
+	}
+	return
+}
+
+func matchAttrs(offer ms.Offer, attrs map[string][]string) bool {
+	for name, vals := range attrs {
+		fulfilled := false
+		for _, attr := range offer.GetAttributes() {
+			if attr.GetName() != name {
+				continue
+			}
+			for _, val := range vals {
+				if matchAttr(attr, val) {
+					fulfilled = true
+					break
+				}
+			}
+			break
+		}
+		if !fulfilled {
+			return false
+		}
+	}
+	return true
+}
+
+func matchAttr(attr ms.Attribute, val string) bool {
+	switch {
+	case attr.Text != nil:
+		return attr.GetText().GetValue() == val
+	case attr.Scalar != nil:
+		fval, err := strconv.ParseFloat(val, 64)
+		return err == nil && attr.GetScalar().GetValue() == fval
+	case attr.Set != nil:
+		for _, item := range attr.GetSet().GetItem() {
+			if item == val {
+				return true
+			}
+		}
+	case attr.Ranges != nil:
+		ival, err := strconv.ParseUint(val, 10, 64)
+		if err != nil {
+			return false
+		}
+		for _, rg := range attr.GetRanges().GetRange() {
+			if ival >= rg.GetBegin() && ival <= rg.GetEnd() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// failureDomains builds the failure domains of the offer hosts by the level,
+// which is "host" or the name of agent attribute such as "rack" or "zone".
+// nil means each host is a domain, and so is the host without the attribute.
+func failureDomains(offers []ms.Offer, level string) chunk.Domains {
+	if level == "" || level == chunk.AntiAffinityHost {
+		return nil
+	}
+	domains := make(chunk.Domains)
+	for _, offer := range offers {
+		for _, attr := range offer.GetAttributes() {
+			if attr.GetName() == level && attr.Text != nil {
+				domains[chunk.ValidateIPAddress(offer.GetHostname())] = attr.GetText().GetValue()
+			}
+		}
+	}
+	return domains
+}
+
+// spreadDomains builds the failure domains which no two masters share by
+// the level, nil means no limit.
+func spreadDomains(offers []ms.Offer, level string) chunk.Domains {
+	if level == "" {
+		return nil
+	}
+	domains := make(chunk.Domains)
+	for _, offer := range offers {
+		host := chunk.ValidateIPAddress(offer.GetHostname())
+		domains[host] = host
+	}
+	for host, domain := range failureDomains(offers, level) {
+		domains[host] = domain
+	}
+	return domains
+}
@@ -0,0 +1,122 @@
+package mesos
+
+import (
+	"context"
+	"time"
+
+	"overlord/pkg/etcd"
+	"overlord/pkg/log"
+	"overlord/platform/chunk"
+
+	ms "github.com/mesos/mesos-go/api/v1/lib"
+)
+
+// ResourceConfig is the oversubscription and reservation policy of the
+// resources offered by each agent.
+type ResourceConfig struct {
+	// CPURatio and MemRatio are the oversubscription ratio, an instance takes
+	// 1/ratio of its cpu and memory from the offer. Default 1 means no
+	// oversubscription, memory oversubscription may make the agent OOM.
+	CPURatio float64 `toml:"cpu_ratio"`
+	MemRatio float64 `toml:"mem_ratio"`
+	// ReservedCPU and ReservedMem(MB) are the headroom kept free on each
+	// agent, which are never taken by instances.
+	ReservedCPU float64 `toml:"reserved_cpu"`
+	ReservedMem float64 `toml:"reserved_mem"`
+}
+
+func (rc *ResourceConfig) ratio() (cpu, mem float64) {
+	cpu, mem = 1, 1
+	if rc == nil {
+		return
+	}
+	if rc.CPURatio > 0 {
+		cpu = rc.CPURatio
+	}
+	if rc.MemRatio > 0 {
+		mem = rc.MemRatio
+	}
+	return
+}
+
+// demand returns the cpu and memory taken from the offer by an instance of
+// the given cpu and memory.
+func (rc *ResourceConfig) demand(cpu, mem float64) (float64, float64) {
+	cr, mr := rc.ratio()
+	return cpu / cr, mem / mr
+}
+
+// reserve returns the copy of offers with the headroom taken off, the
+// offers are still accepted by their id.
+func (rc *ResourceConfig) reserve(offers []ms.Offer) []ms.Offer {
+	if rc == nil || (rc.ReservedCPU <= 0 && rc.ReservedMem <= 0) {
+		return offers
+	}
+	reserved := make([]ms.Offer, len(offers))
+	for i, offer := range offers {
+		res := make([]ms.Resource, len(offer.Resources))
+		for j, r := range offer.Resources {
+			res[j] = r
+			var headroom float64
+			switch r.GetName() {
+			case chunk.ResNameCPUs:
+				headroom = rc.ReservedCPU
+			case chunk.ResNameMem:
+				headroom = rc.ReservedMem
+			default:
+				continue
+			}
+			if r.Scalar == nil {
+				continue
+			}
+			left := r.Scalar.Value - headroom
+			if left < 0 {
+				left = 0
+			}
+			res[j].Scalar = &ms.Value_Scalar{Value: left}
+		}
+		offer.Resources = res
+		reserved[i] = offer
+	}
+	return reserved
+}
+
+// capacities sums up the schedulable capacity of the reserved offers by
+// agent, in the cpu and memory of instances.
+func (rc *ResourceConfig) capacities(offers []ms.Offer, now time.Time) []*etcd.Capacity {
+	cr, mr := rc.ratio()
+	hosts := make(map[string]*etcd.Capacity)
+	cs := make([]*etcd.Capacity, 0, len(offers))
+	for _, offer := range offers {
+		host := chunk.ValidateIPAddress(offer.GetHostname())
+		c, ok := hosts[host]
+		if !ok {
+			c = &etcd.Capacity{Host: host, Time: now.Unix()}
+			hosts[host] = c
+			cs = append(cs, c)
+		}
+		for _, r := range offer.GetResources() {
+			switch r.GetName() {
+			case chunk.ResNameCPUs:
+				c.CPU += r.GetScalar().GetValue() * cr
+			case chunk.ResNameMem:
+				c.Memory += r.GetScalar().GetValue() * mr
+			case chunk.ResNamePorts:
+				for _, rg := range r.GetRanges().GetRange() {
+					c.Ports += int(rg.GetEnd() - rg.GetBegin() + 1)
+				}
+			}
+		}
+	}
+	return cs
+}
+
+// saveCapacity saves the schedulable capacity of the agents of offers, so
+// that it can be queried by apiserver.
+func (s *Scheduler) saveCapacity(offers []ms.Offer) {
+	for _, c := range s.c.Resource.capacities(offers, time.Now()) {
+		if err := s.db.SetCapacity(context.Background(), c); err != nil {
+			log.Warnf("save capacity of agent %s err %v", c.Host, err)
+		}
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"overlord/platform/chunk"
 	"overlord/platform/job"
 	"overlord/platform/job/create"
+	"overlord/platform/job/upgrade"
 
 	pb "github.com/golang/protobuf/proto"
 	ms "github.com/mesos/mesos-go/api/v1/lib"
@@ -50,6 +51,11 @@ type Scheduler struct {
 	cli       calls.Caller
 	taskInfos map[string]*ms.TaskInfo // mesos tasks
 	failTask  chan ms.TaskID
+	// restartTask is the killed tasks relaunched on the origin agent.
+	restartTask chan ms.TaskID
+	// pendings is the last dispatch failure of the jobs waiting for offers,
+	// which is logged into the job only once until the reason changes.
+	pendings map[string]string
 }
 
 // NewScheduler new scheduler instance.
@@ -60,6 +66,9 @@ func NewScheduler(c *Config, db *etcd.Etcd) *Scheduler {
 		task:      list.New(),
 		taskInfos: make(map[string]*ms.TaskInfo),
 		failTask:  make(chan ms.TaskID, 100),
+
+		restartTask: make(chan ms.TaskID, 100),
+		pendings:    make(map[string]string),
 	}
 }
 
@@ -107,6 +116,10 @@ func (s *Scheduler) taskEvent(ch chan *cli.Node) {
 			continue
 		}
 		t.ID = splitJobID(n.Key)
+		if job.ByAPIServer(t.OpType) {
+			// NOTE: they need no offers and are run by apiserver.
+			continue
+		}
 		s.task.PushBack(t)
 		log.Infof("get task (%+v)", t)
 		// revive offer when task comming.
@@ -188,38 +201,50 @@ func (s *Scheduler) trackOffersReceived() eventrules.Rule {
 func (s *Scheduler) resourceOffers() events.HandlerFunc {
 	return func(ctx context.Context, e *scheduler.Event) error {
 		var (
-			offers = e.GetOffers().GetOffers()
+			offers = s.c.Resource.reserve(e.GetOffers().GetOffers())
 			// callOption             = calls.RefuseSecondsWithJitter(rand.new, state.config.maxRefuseSeconds)
 		)
+		s.saveCapacity(offers)
 
 		select {
 		case taskid := <-s.failTask:
 			s.tryRecovery(taskid, offers, false)
 			return nil
+		case taskid := <-s.restartTask:
+			s.restart(taskid, offers)
+			return nil
 		default:
 		}
 		for taskEle := s.task.Front(); taskEle != nil; {
 			t := taskEle.Value.(job.Job)
-			imem := t.MaxMem
-			icpu := t.CPU
+			icpu, imem := s.c.Resource.demand(t.CPU, t.MaxMem)
 			inum := t.Num
+			matched, unmatched := filterOffers(offers, t.Params)
 			switch t.CacheType {
 			case types.CacheTypeRedisCluster:
-				err := s.dispatchCluster(t, inum, imem, icpu, offers)
+				err := s.dispatchCluster(t, inum, imem, icpu, matched)
 				if err != nil {
+					s.dispatchFail(t, len(matched), len(unmatched), err)
 					taskEle = taskEle.Next()
 					continue
 				}
+				delete(s.pendings, t.ID)
+				s.jobLog(t, "dispatch %s with %d offers(%d filtered by attributes) done", t.OpType, len(matched), len(unmatched))
+				s.decline(unmatched)
 				ttask := taskEle
 				s.task.Remove(ttask)
 				return nil
 			case types.CacheTypeRedis, types.CacheTypeMemcache:
-				err := s.dispatchSingleton(t, offers)
+				err := s.dispatchSingleton(t, matched)
 				if err != nil {
 					log.Errorf("dispatchSingleton err %v", err)
+					s.dispatchFail(t, len(matched), len(unmatched), err)
 					taskEle = taskEle.Next()
 					continue
 				}
+				delete(s.pendings, t.ID)
+				s.jobLog(t, "dispatch %s with %d offers(%d filtered by attributes) done", t.OpType, len(matched), len(unmatched))
+				s.decline(unmatched)
 				ttask := taskEle
 				s.task.Remove(ttask)
 				return nil
@@ -228,6 +253,8 @@ func (s *Scheduler) resourceOffers() events.HandlerFunc {
 				taskEle = taskEle.Next()
 				s.task.Remove(ttask)
 				log.Errorf("undefine job type,delete undefine task %v", ttask)
+				delete(s.pendings, t.ID)
+				s.jobLog(t, "undefined cache type %s, job dropped", t.CacheType)
 			}
 		}
 		// if there don't have any task,decline all offers and suppress offer envent.
@@ -237,6 +264,30 @@ func (s *Scheduler) resourceOffers() events.HandlerFunc {
 	}
 }
 
+// jobLog appends the scheduler decision into the execution logs of job.
+func (s *Scheduler) jobLog(t job.Job, format string, args ...interface{}) {
+	err := s.db.AppendJobLog(context.Background(), t.Group, t.ID, "scheduler", fmt.Sprintf(format, args...))
+	if err != nil {
+		log.Warnf("append job log of %s err %v", t.ID, err)
+	}
+}
+
+// dispatchFail logs the dispatch failure of job t which waits for more offers,
+// the same failure of the following offer rounds is not logged again.
+func (s *Scheduler) dispatchFail(t job.Job, matched, unmatched int, err error) {
+	if reason := err.Error(); s.pendings[t.ID] != reason {
+		s.pendings[t.ID] = reason
+		s.jobLog(t, "dispatch %s with %d offers(%d filtered by attributes) fail, wait for more offers: %v", t.OpType, matched, unmatched, err)
+	}
+}
+
+func (s *Scheduler) decline(offers []ms.Offer) {
+	for _, offer := range offers {
+		decline := calls.Decline(offer.ID)
+		calls.CallNoData(context.Background(), s.cli, decline)
+	}
+}
+
 func (s *Scheduler) declineAndSuppress(offers []ms.Offer, ctx context.Context) {
 	ofid := make([]ms.OfferID, len(offers))
 	for _, offer := range offers {
@@ -282,11 +333,12 @@ func (s *Scheduler) tryRecovery(t ms.TaskID, offers []ms.Offer, force bool) (err
 		return
 	}
 	uport, _ := strconv.ParseUint(port, 10, 64)
+	cpu, mem := s.c.Resource.demand(info.CPU, info.MaxMemory)
 	task := &ms.TaskInfo{
 		Name:      ip + ":" + port,
 		TaskID:    ms.TaskID{Value: fmt.Sprintf("%s:%s-%s-%d", ip, port, cluster, id+1)},
 		Executor:  s.buildExcutor(fmt.Sprintf("%s:%s", ip, port), []ms.Resource{}),
-		Resources: makeResources(info.CPU, info.MaxMemory, uport),
+		Resources: makeResources(cpu, mem, uport),
 	}
 	data := &TaskData{
 		IP:         ip,
@@ -298,7 +350,7 @@ func (s *Scheduler) tryRecovery(t ms.TaskID, offers []ms.Offer, force bool) (err
 		agentIP := chunk.ValidateIPAddress(offer.Hostname)
 		// try to recover from origin agent with the same info.
 		if agentIP == ip {
-			if err = checkOffer(offer, info.CPU, info.MaxMemory, uport); err != nil {
+			if err = checkOffer(offer, cpu, mem, uport); err != nil {
 				return
 			}
 			task.AgentID = offer.GetAgentID()
@@ -333,7 +385,7 @@ func (s *Scheduler) tryRecovery(t ms.TaskID, offers []ms.Offer, force bool) (err
 				alias = addr.ID
 			}
 		}
-		newDist, err = chunk.DistAppendIt(info.Dist, 1, info.MaxMemory, info.CPU, offers...)
+		newDist, err = chunk.DistAppendIt(info.Dist, 1, mem, cpu, offers...)
 		if err != nil {
 			log.Errorf("chunk,DistAppend err %v", err)
 			return
@@ -373,6 +425,7 @@ func (s *Scheduler) acceptOffer(info *create.CacheInfo, dist *chunk.Dist, offers
 	for _, offer := range offers {
 		ofm[chunk.ValidateIPAddress(offer.GetHostname())] = offer
 	}
+	cpu, mem := s.c.Resource.demand(info.CPU, info.MaxMemory)
 	for _, addr := range dist.Addrs {
 		task := ms.TaskInfo{
 			Name:     addr.String(),
@@ -380,7 +433,7 @@ func (s *Scheduler) acceptOffer(info *create.CacheInfo, dist *chunk.Dist, offers
 			AgentID:  ofm[addr.IP].AgentID,
 			Executor: s.buildExcutor(addr.String(), []ms.Resource{}),
 			//  plus the port obtained by adding 10000 to the data port for redis cluster.
-			Resources: makeResources(info.CPU, info.MaxMemory, uint64(addr.Port)),
+			Resources: makeResources(cpu, mem, uint64(addr.Port)),
 		}
 		s.db.SetTaskID(context.Background(), addr.String(), task.TaskID.GetValue()+","+task.AgentID.GetValue())
 		data := &TaskData{
@@ -473,9 +526,14 @@ func (s *Scheduler) statusUpdate() events.HandlerFunc {
 func (s *Scheduler) dispatchCluster(t job.Job, num int, mem, cpu float64, offers []ms.Offer) (err error) {
 	var chunks []*chunk.Chunk
 	var jobChunks []*chunk.Chunk
+	antiAffinity := t.Params[job.ParamAntiAffinity]
+	masterSpread := t.Params[job.ParamMasterSpread]
 	switch t.OpType {
 	case job.OpCreate:
-		chunks, err = chunk.Chunks(num, mem, cpu, offers...)
+		chunks, err = chunk.ChunksWithConstraints(num, mem, cpu, &chunk.Constraints{
+			AntiAffinity: failureDomains(offers, antiAffinity),
+			MasterSpread: spreadDomains(offers, masterSpread),
+		}, offers...)
 		if err != nil {
 			log.Errorf("task(%v) can not get offer by chunk, err %v", t, err)
 			return
@@ -492,11 +550,20 @@ func (s *Scheduler) dispatchCluster(t job.Job, num int, mem, cpu float64, offers
 			return
 		}
 		chunks = ci.Chunks
-		newChunk, err = chunk.ChunksAppend(chunks, num, mem, cpu, offers...)
+		antiAffinity = ci.AntiAffinity
+		masterSpread = ci.MasterSpread
+		newChunk, err = chunk.ChunksAppendWithConstraints(chunks, num, mem, cpu, &chunk.Constraints{
+			AntiAffinity: failureDomains(offers, antiAffinity),
+			MasterSpread: spreadDomains(offers, masterSpread),
+		}, offers...)
 		if err != nil {
 			log.Errorf("chunk.ChunksAppend with job (%v) err %v", t, err)
 			return
 		}
+		if err = chunk.CheckAntiAffinity(newChunk, failureDomains(offers, antiAffinity)); err != nil {
+			log.Errorf("chunk.ChunksAppend with job (%v) break anti affinity", t)
+			return
+		}
 		jobChunks = newChunk
 		chunks = append(chunks, newChunk...)
 	case job.OpDestroy:
@@ -505,9 +572,13 @@ func (s *Scheduler) dispatchCluster(t job.Job, num int, mem, cpu float64, offers
 	case job.OpRestart:
 		s.restartNode(t, offers)
 		return
+	case job.OpUpgrade:
+		s.upgradeCluster(t, offers)
+		return
 	}
 
 	log.Infof("get chunks(%v) by offers (%v)", chunks, offers)
+	s.jobLog(t, "place %d chunks as %v", len(jobChunks), jobChunks)
 	var (
 		ofm   = make(map[string]ms.Offer)
 		tasks = make(map[string][]ms.TaskInfo)
@@ -522,6 +593,9 @@ func (s *Scheduler) dispatchCluster(t job.Job, num int, mem, cpu float64, offers
 		Image:     t.Image,
 		Number:    t.Num,
 		Group:     t.Group,
+
+		AntiAffinity: antiAffinity,
+		MasterSpread: masterSpread,
 	})
 	err = rtask.Create()
 	if err != nil {
@@ -573,10 +647,13 @@ func (s *Scheduler) dispatchSingleton(t job.Job, offers []ms.Offer) (err error)
 		jobDist *chunk.Dist
 		ctx     = context.Background()
 		ci      *create.CacheInfo
+
+		masterSpread = t.Params[job.ParamMasterSpread]
+		cpu, mem     = s.c.Resource.demand(t.CPU, t.MaxMem)
 	)
 	switch t.OpType {
 	case job.OpCreate:
-		dist, err = chunk.DistIt(t.Num, t.MaxMem, t.CPU, offers...)
+		dist, err = chunk.DistWithSpread(t.Num, mem, cpu, spreadDomains(offers, masterSpread), offers...)
 		if err != nil {
 			err = errors.WithStack(err)
 			return
@@ -595,22 +672,31 @@ func (s *Scheduler) dispatchSingleton(t job.Job, offers []ms.Offer) (err error)
 			return
 		}
 		dist = ci.Dist
+		masterSpread = ci.MasterSpread
 		delta := t.Num - len(dist.Addrs)
-		if delta >= 0 {
-			newDist, err = chunk.DistAppendIt(dist, t.Num, t.MaxMem, t.CPU, offers...)
+		if delta > 0 {
+			newDist, err = chunk.DistAppendIt(dist, delta, mem, cpu, offers...)
 			if err != nil {
 				err = errors.WithStack(err)
 				return
 			}
+			if masterSpread != "" {
+				if err = chunk.CheckDistSpread(append(dist.Addrs, newDist.Addrs...), spreadDomains(offers, masterSpread)); err != nil {
+					return
+				}
+			}
 			jobDist = newDist
 			dist.Addrs = append(dist.Addrs, newDist.Addrs...)
 		} else {
-			// TODO:scale down
+			s.scaleDown(t, ci, -delta, offers)
 			return
 		}
 	case job.OpRestart:
 		s.restartNode(t, offers)
 		return
+	case job.OpUpgrade:
+		s.upgradeCluster(t, offers)
+		return
 	case job.OpMigrate:
 		var (
 			newDist *chunk.Dist
@@ -620,6 +706,7 @@ func (s *Scheduler) dispatchSingleton(t job.Job, offers []ms.Offer) (err error)
 			err = errors.WithStack(err)
 			return
 		}
+		masterSpread = ci.MasterSpread
 		var alias = make([]string, 0)
 
 		for _, node := range t.Nodes {
@@ -643,7 +730,8 @@ func (s *Scheduler) dispatchSingleton(t job.Job, offers []ms.Offer) (err error)
 		}
 
 		num := len(alias)
-		newDist, err = chunk.DistAppendIt(ci.Dist, num, ci.MaxMemory, ci.CPU, offers...)
+		cpu, mem = s.c.Resource.demand(ci.CPU, ci.MaxMemory)
+		newDist, err = chunk.DistAppendIt(ci.Dist, num, mem, cpu, offers...)
 		if err != nil {
 			err = errors.WithStack(err)
 			return
@@ -668,7 +756,10 @@ func (s *Scheduler) dispatchSingleton(t job.Job, offers []ms.Offer) (err error)
 		Image:     t.Image,
 		Dist:      dist,
 		Group:     t.Group,
+
+		MasterSpread: masterSpread,
 	}
+	s.jobLog(t, "place instances at %v", jobDist.Addrs)
 	ctask := create.NewCacheJob(s.db, ci)
 	err = ctask.Create()
 	if err != nil {
@@ -735,6 +826,50 @@ func (s *Scheduler) destroyCluster(t job.Job, offers []ms.Offer) {
 	}
 }
 
+// scaleDown kills the last num instances of the singleton cluster, and
+// removes them from the cluster, so that proxies stop forwarding to them.
+func (s *Scheduler) scaleDown(t job.Job, ci *create.CacheInfo, num int, offers []ms.Offer) {
+	ctx := context.Background()
+	s.declineAndSuppress(offers, ctx)
+	if num == 0 {
+		s.jobLog(t, "cluster %s already has %d instances", t.Name, t.Num)
+		_ = s.db.SetJobState(ctx, t.Group, t.ID, job.StateDone)
+		return
+	}
+	left := len(ci.Dist.Addrs) - num
+	removed := ci.Dist.Addrs[left:]
+	ci.Dist.Addrs = ci.Dist.Addrs[:left]
+	ci.Number = left
+	data, err := json.Marshal(ci)
+	if err == nil {
+		err = s.db.Set(ctx, fmt.Sprintf("%s/%s/info", etcd.ClusterDir, t.Name), string(data))
+	}
+	if err != nil {
+		log.Errorf("scale down cluster %s err %v", t.Name, err)
+		s.jobLog(t, "scale down %s fail: %v", t.Name, err)
+		_ = s.db.SetJobState(ctx, t.Group, t.ID, job.StateFail)
+		return
+	}
+	for _, addr := range removed {
+		// NOTE: remove from the cluster first, so that proxies watching etcd
+		// eject the instance as soon as possible.
+		if err = s.db.Delete(ctx, fmt.Sprintf(etcd.ClusterInstancesDir, t.Name)+addr.ID); err != nil {
+			log.Errorf("remove instance %s from cluster %s err %v", addr, t.Name, err)
+		}
+		var id string
+		if id, err = s.db.TaskID(ctx, addr.String()); err != nil {
+			log.Errorf("get task(%s) err %v", addr, err)
+		} else {
+			s.kill(id)
+		}
+		if err = s.db.RMDir(ctx, etcd.InstanceDirPrefix+"/"+addr.String()); err != nil {
+			log.Errorf("rm instance dir (%s) fail err %v", addr, err)
+		}
+	}
+	s.jobLog(t, "remove instances %v from cluster %s", removed, t.Name)
+	_ = s.db.SetJobState(ctx, t.Group, t.ID, job.StateDone)
+}
+
 func (s *Scheduler) restartNode(job job.Job, offers []ms.Offer) (err error) {
 	ctx := context.Background()
 	// restart one node each time.
@@ -754,6 +889,156 @@ func (s *Scheduler) restartNode(job job.Job, offers []ms.Offer) (err error) {
 	return
 }
 
+// restart relaunches the killed task on its origin agent, the task is
+// queued again until the offer of the agent comes, and never moves to
+// another agent.
+func (s *Scheduler) restart(taskid ms.TaskID, offers []ms.Offer) {
+	_, ip, _, _, err := parseTaskID(taskid)
+	if err != nil {
+		log.Errorf("cannot restart task(%s) with err taskid", taskid.String())
+		return
+	}
+	tried := false
+	for _, offer := range offers {
+		if chunk.ValidateIPAddress(offer.Hostname) == ip {
+			// tryRecovery declines the offers if fail.
+			if err = s.tryRecovery(taskid, offers, true); err == nil {
+				return
+			}
+			tried = true
+			break
+		}
+	}
+	if !tried {
+		s.decline(offers)
+	}
+	log.Infof("wait for the offer of agent %s to restart task(%s), err %v", ip, taskid.String(), err)
+	go func() {
+		// the resources of the killed task may be not released yet.
+		time.Sleep(time.Second)
+		s.restartTask <- taskid
+		revive := calls.Revive()
+		if err := calls.CallNoData(context.Background(), s.cli, revive); err != nil {
+			log.Errorf("revive offer fail err(%v)", err)
+		}
+	}()
+}
+
+// upgradeCluster starts the rolling upgrade of the cluster in background,
+// which needs offers only to relaunch the killed instances.
+func (s *Scheduler) upgradeCluster(t job.Job, offers []ms.Offer) {
+	ctx := context.Background()
+	s.declineAndSuppress(offers, ctx)
+	go func() {
+		_ = s.db.SetJobState(ctx, t.Group, t.ID, job.StateRunning)
+		if err := s.rollingUpgrade(ctx, t); err != nil {
+			log.Errorf("upgrade cluster %s to %s err %v", t.Name, t.Version, err)
+			s.jobLog(t, "upgrade %s to %s fail and stopped: %v", t.Name, t.Version, err)
+			_ = s.db.SetJobState(ctx, t.Group, t.ID, job.StateFail)
+			return
+		}
+		s.jobLog(t, "upgrade %s to %s done", t.Name, t.Version)
+		_ = s.db.SetJobState(ctx, t.Group, t.ID, job.StateDone)
+	}()
+}
+
+// rollingUpgrade restarts the instances onto the new version batch by batch,
+// the next batch starts only after all the instances of the batch healthy.
+// The masters of redis cluster are restarted after the replicas, each one
+// fails over to its replica before restart.
+func (s *Scheduler) rollingUpgrade(ctx context.Context, t job.Job) (err error) {
+	ci, err := s.getInfoFromEtcd(ctx, t.Name)
+	if err != nil {
+		return
+	}
+	batch, _ := strconv.Atoi(t.Params[job.ParamBatch])
+	timeout := upgrade.DefaultHealthTimeout
+	if sec, _ := strconv.Atoi(t.Params[job.ParamHealthTimeout]); sec > 0 {
+		timeout = time.Duration(sec) * time.Second
+	}
+
+	var nodes []*upgrade.Node
+	if ci.CacheType == types.CacheTypeRedisCluster {
+		var addrs []string
+		for _, ck := range ci.Chunks {
+			for _, n := range ck.Nodes {
+				addrs = append(addrs, n.Addr())
+			}
+		}
+		if nodes, err = upgrade.Roles(addrs); err != nil {
+			return
+		}
+	} else {
+		for _, addr := range ci.Dist.Addrs {
+			nodes = append(nodes, &upgrade.Node{Addr: addr.String()})
+		}
+	}
+	batches := upgrade.Plan(nodes, batch)
+	s.jobLog(t, "upgrade %d instances from %s to %s in %d batches", len(nodes), ci.Version, t.Version, len(batches))
+
+	for i, b := range batches {
+		for _, n := range b {
+			if n.Role == chunk.RoleMaster {
+				fctx, cancel := context.WithTimeout(ctx, timeout)
+				err = upgrade.Failover(fctx, n)
+				cancel()
+				if err != nil {
+					return
+				}
+				s.jobLog(t, "master %s failover to %s", n.Addr, n.Replica)
+			}
+			if err = s.upgradeNode(ctx, t, n.Addr); err != nil {
+				return
+			}
+		}
+		hctx, cancel := context.WithTimeout(ctx, timeout)
+		for _, n := range b {
+			if err = upgrade.WaitHealthy(hctx, s.db, ci.CacheType, n.Addr); err != nil {
+				break
+			}
+		}
+		cancel()
+		if err != nil {
+			return
+		}
+		s.jobLog(t, "batch %d/%d %v upgraded", i+1, len(batches), b)
+	}
+
+	ci.Version = t.Version
+	data, err := json.Marshal(ci)
+	if err != nil {
+		return
+	}
+	return s.db.Set(ctx, fmt.Sprintf("%s/%s/info", etcd.ClusterDir, t.Name), string(data))
+}
+
+// upgradeNode kills the task of the instance and relaunches it onto the
+// version of job, whose executor logs into the job.
+func (s *Scheduler) upgradeNode(ctx context.Context, t job.Job, addr string) (err error) {
+	dir := etcd.InstanceDirPrefix + "/" + addr
+	if err = s.db.Set(ctx, dir+"/version", t.Version); err != nil {
+		return
+	}
+	if err = s.db.Set(ctx, dir+"/jobid", t.ID); err != nil {
+		return
+	}
+	if err = s.db.Set(ctx, dir+"/state", job.StatePending); err != nil {
+		return
+	}
+	var id string
+	if id, err = s.db.TaskID(ctx, addr); err != nil {
+		return
+	}
+	s.kill(id)
+	s.jobLog(t, "instance %s restarting onto %s", addr, t.Version)
+	s.restartTask <- ms.TaskID{Value: strings.Split(id, ",")[0]}
+	revive := calls.Revive()
+	if err = calls.CallNoData(ctx, s.cli, revive); err != nil {
+		log.Errorf("revive offer fail err(%v)", err)
+	}
+	return nil
+}
+
 func (s *Scheduler) kill(id string) {
 	ids := strings.Split(id, ",")
 	if len(ids) != 2 {
@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"time"
+
+	"overlord/proxy/accesslog"
+	"overlord/proxy/proto"
+
+	"github.com/pkg/errors"
+)
+
+// accessEntry builds the access log of msg, the sub messages of batch are
+// summed up and the node is the first one.
+func (h *Handler) accessEntry(msg *proto.Message) *accesslog.Entry {
+	e := &accesslog.Entry{
+		Time:     time.Now(),
+		Client:   h.addr,
+		TotalDur: int64(msg.TotalDur() / time.Microsecond),
+	}
+	if req := msg.Request(); req != nil {
+		e.Cmd = req.CmdString()
+		e.Key = string(req.Key())
+	}
+	e.ReqBytes, e.ReplyBytes = messageSize(msg)
+	if msg.IsBatch() {
+		for _, sub := range msg.Batch() {
+			if e.Node == "" {
+				e.Node = sub.Addr()
+			}
+			if d := int64(sub.RemoteDur() / time.Microsecond); d > e.RemoteDur {
+				e.RemoteDur = d
+			}
+		}
+	} else {
+		e.Node = msg.Addr()
+		e.RemoteDur = int64(msg.RemoteDur() / time.Microsecond)
+	}
+	if e.Node == "" || e.RemoteDur < 0 {
+		// NOTE: answered by proxy itself
+		e.RemoteDur = 0
+	}
+	if err := msg.Err(); err != nil {
+		e.Err = errors.Cause(err).Error()
+	}
+	return e
+}
@@ -0,0 +1,120 @@
+package accesslog
+
+import (
+	"encoding/json"
+	errs "errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"overlord/pkg/log"
+)
+
+// access log formats
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// ErrFormat is the error of unknown format.
+var ErrFormat = errs.New("access log format must be json or text")
+
+// Entry is the access log of one command.
+type Entry struct {
+	Time       time.Time `json:"time"`
+	Cluster    string    `json:"cluster"`
+	Client     string    `json:"client"`
+	Cmd        string    `json:"cmd"`
+	Key        string    `json:"key"`
+	ReqBytes   int       `json:"req_bytes"`
+	ReplyBytes int       `json:"reply_bytes"`
+	Node       string    `json:"node"`
+	TotalDur   int64     `json:"total_us"`
+	RemoteDur  int64     `json:"remote_us"`
+	Err        string    `json:"err,omitempty"`
+}
+
+// encode appends e into b as one line in format, the key and error are
+// quoted in text format.
+func (e *Entry) encode(b []byte, format string) ([]byte, error) {
+	if format == FormatJSON {
+		bs, err := json.Marshal(e)
+		if err != nil {
+			return b, err
+		}
+		b = append(b, bs...)
+		return append(b, '\n'), nil
+	}
+	b = e.Time.AppendFormat(b, time.RFC3339Nano)
+	b = append(b, ' ')
+	b = append(b, e.Cluster...)
+	b = append(b, ' ')
+	b = append(b, e.Client...)
+	b = append(b, ' ')
+	b = append(b, e.Cmd...)
+	b = append(b, ' ')
+	b = strconv.AppendQuote(b, e.Key)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, int64(e.ReqBytes), 10)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, int64(e.ReplyBytes), 10)
+	b = append(b, ' ')
+	if e.Node == "" {
+		b = append(b, '-')
+	} else {
+		b = append(b, e.Node...)
+	}
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, e.TotalDur, 10)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, e.RemoteDur, 10)
+	if e.Err != "" {
+		b = append(b, ' ')
+		b = strconv.AppendQuote(b, e.Err)
+	}
+	return append(b, '\n'), nil
+}
+
+// Logger samples the commands of one cluster into access log.
+type Logger struct {
+	cluster string
+	rate    float64
+	count   uint64
+}
+
+// Sampled returns whether or not the next command should be logged, the
+// commands are sampled evenly by rate.
+func (l *Logger) Sampled() bool {
+	if l.rate >= 1 {
+		return true
+	}
+	n := atomic.AddUint64(&l.count, 1)
+	return uint64(float64(n)*l.rate) != uint64(float64(n-1)*l.rate)
+}
+
+// Log writes e asynchronously, it's dropped if the buffer is full.
+func (l *Logger) Log(e *Entry) {
+	e.Cluster = l.cluster
+	fh.save(e)
+}
+
+// Get returns the logger of cluster sampled by rate, nil if rate is zero or
+// access log is not inited.
+func Get(cluster string, rate float64) *Logger {
+	if fh == nil || rate <= 0 {
+		return nil
+	}
+	return &Logger{cluster: cluster, rate: rate}
+}
+
+// Init access log with file in format.
+func Init(fileName, format string, maxBytes int, backupCount int) error {
+	if fileName == "" {
+		return nil
+	}
+	if format != FormatJSON && format != FormatText {
+		return ErrFormat
+	}
+	log.Infof("setup access log for file [%s] in format [%s]", fileName, format)
+	return initFileHandler(fileName, format, maxBytes, backupCount)
+}
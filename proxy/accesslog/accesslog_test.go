@@ -0,0 +1,69 @@
+package accesslog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoggerSampled(t *testing.T) {
+	for _, rate := range []float64{1, 0.5, 0.1, 0.01} {
+		l := &Logger{rate: rate}
+		var n int
+		for i := 0; i < 1000; i++ {
+			if l.Sampled() {
+				n++
+			}
+		}
+		assert.Equal(t, int(1000*rate), n, "rate:%v", rate)
+	}
+}
+
+func TestEntryEncode(t *testing.T) {
+	e := &Entry{
+		Time:       time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC),
+		Cluster:    "test",
+		Client:     "127.0.0.1:5000",
+		Cmd:        "GET",
+		Key:        "a b",
+		ReqBytes:   22,
+		ReplyBytes: 7,
+		Node:       "127.0.0.1:6379",
+		TotalDur:   120,
+		RemoteDur:  100,
+	}
+	b, err := e.encode(nil, FormatText)
+	assert.NoError(t, err)
+	assert.Equal(t, "2019-01-02T03:04:05Z test 127.0.0.1:5000 GET \"a b\" 22 7 127.0.0.1:6379 120 100\n", string(b))
+	b, err = e.encode(nil, FormatJSON)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"time":"2019-01-02T03:04:05Z","cluster":"test","client":"127.0.0.1:5000","cmd":"GET","key":"a b","req_bytes":22,"reply_bytes":7,"node":"127.0.0.1:6379","total_us":120,"remote_us":100}`+"\n", string(b))
+
+	e.Node, e.Err = "", "NOAUTH Authentication required."
+	b, err = e.encode(nil, FormatText)
+	assert.NoError(t, err)
+	assert.Equal(t, "2019-01-02T03:04:05Z test 127.0.0.1:5000 GET \"a b\" 22 7 - 120 100 \"NOAUTH Authentication required.\"\n", string(b))
+}
+
+func TestAccessLogFile(t *testing.T) {
+	assert.Equal(t, ErrFormat, Init("access.log", "xml", 0, 0))
+	assert.Nil(t, Get("test", 1))
+
+	dir, err := ioutil.TempDir("", "accesslog")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "access.log")
+	assert.NoError(t, Init(file, FormatText, 0, 0))
+	assert.Nil(t, Get("test", 0))
+	l := Get("test", 1)
+	l.Log(&Entry{Cmd: "GET", Key: "a"})
+	time.Sleep(flushInterval + 200*time.Millisecond)
+	bs, err := ioutil.ReadFile(file)
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(string(bs), " test  GET \"a\" 0 0 - 0 0\n"), string(bs))
+}
@@ -0,0 +1,116 @@
+package accesslog
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"overlord/pkg/log"
+)
+
+const (
+	exchangeSize  = 8192
+	flushInterval = time.Second
+)
+
+type fileHandler struct {
+	fd       *os.File
+	wr       *bufio.Writer
+	format   string
+	exchange chan *Entry
+	dropped  int64
+
+	fileName    string
+	maxBytes    int
+	backupCount int
+}
+
+// save never blocks the handler, the entry is dropped if the writer can't
+// catch up.
+func (f *fileHandler) save(e *Entry) {
+	select {
+	case f.exchange <- e:
+	default:
+		atomic.AddInt64(&f.dropped, 1)
+	}
+}
+
+func (f *fileHandler) openFile() (err error) {
+	f.fd, err = os.OpenFile(f.fileName, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	f.wr = bufio.NewWriterSize(f.fd, 64*1024)
+	return
+}
+
+// rotate renames the file to file.1 and so on once it's larger than
+// maxBytes, the file more than backupCount is removed.
+func (f *fileHandler) rotate() {
+	if f.maxBytes <= 0 || f.backupCount <= 0 {
+		return
+	}
+	fdStat, err := f.fd.Stat()
+	if err != nil || fdStat.Size() < int64(f.maxBytes) {
+		return
+	}
+	_ = f.wr.Flush()
+	_ = f.fd.Close()
+	for i := f.backupCount - 1; i > 0; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", f.fileName, i), fmt.Sprintf("%s.%d", f.fileName, i+1))
+	}
+	_ = os.Rename(f.fileName, f.fileName+".1")
+	if err = f.openFile(); err != nil {
+		log.Errorf("fail to reopen access log due %s", err)
+	}
+}
+
+func (f *fileHandler) run() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	var buf []byte
+	for {
+		select {
+		case e := <-f.exchange:
+			var err error
+			if buf, err = e.encode(buf[:0], f.format); err != nil {
+				log.Errorf("fail to encode access log due %s", err)
+				continue
+			}
+			if _, err = f.wr.Write(buf); err != nil {
+				log.Errorf("fail to write access log due %s", err)
+			}
+		case <-ticker.C:
+			if f.wr.Buffered() > 0 {
+				if err := f.wr.Flush(); err != nil {
+					log.Errorf("fail to flush access log due %s", err)
+				}
+			}
+			f.rotate()
+			if n := atomic.SwapInt64(&f.dropped, 0); n > 0 {
+				log.Warnf("access log dropped %d entries because writer is busy", n)
+			}
+		}
+	}
+}
+
+var fh *fileHandler
+
+// initFileHandler will init the file handler to the given file
+func initFileHandler(fileName, format string, maxBytes int, backupCount int) error {
+	h := &fileHandler{
+		format:      format,
+		exchange:    make(chan *Entry, exchangeSize),
+		fileName:    fileName,
+		maxBytes:    maxBytes,
+		backupCount: backupCount,
+	}
+	if err := h.openFile(); err != nil {
+		return err
+	}
+	fh = h
+	go fh.run()
+	return nil
+}
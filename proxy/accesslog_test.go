@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"testing"
+
+	"overlord/pkg/types"
+	"overlord/proxy/proto/redis"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlerAccessEntry(t *testing.T) {
+	h := &Handler{cc: &ClusterConfig{CacheType: types.CacheTypeRedis}, addr: "127.0.0.1:5000"}
+	msgs := _decodeRedis(t, "*2\r\n$3\r\nGET\r\n$1\r\na\r\n")
+	msgs[0].MarkAddr("127.0.0.1:6379")
+	msgs[0].Request().(*redis.Request).Reply().SetBulk([]byte("1"))
+	e := h.accessEntry(msgs[0])
+	assert.Equal(t, "127.0.0.1:5000", e.Client)
+	assert.Equal(t, "GET", e.Cmd)
+	assert.Equal(t, "a", e.Key)
+	assert.Equal(t, len("*2\r\n$3\r\nGET\r\n$1\r\na\r\n"), e.ReqBytes)
+	assert.Equal(t, len("$1\r\n1\r\n"), e.ReplyBytes)
+	assert.Equal(t, "127.0.0.1:6379", e.Node)
+	assert.Equal(t, "", e.Err)
+
+	msgs = _decodeRedis(t, "*3\r\n$4\r\nMGET\r\n$1\r\na\r\n$1\r\nb\r\n")
+	msgs[0].WithError(errors.WithStack(ErrAuthRequired))
+	e = h.accessEntry(msgs[0])
+	assert.Equal(t, "MGET", e.Cmd)
+	assert.Equal(t, ErrAuthRequired.Error(), e.Err)
+	assert.Equal(t, "", e.Node)
+	assert.Equal(t, int64(0), e.RemoteDur)
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	errs "errors"
+	"strings"
+
+	"overlord/proxy/proto"
+)
+
+// errors
+var (
+	ErrCommandDenied = errs.New("ERR command denied")
+)
+
+const (
+	aclRead  = "@read"
+	aclWrite = "@write"
+)
+
+// commandACL denies the commands by allowed_commands and forbidden_commands
+// of cluster, the names are case-insensitive and @read or @write means all
+// the reads or writes. The allowed only limits the commands of key which
+// read or write, the others such as PING and AUTH are always allowed unless
+// forbidden.
+type commandACL struct {
+	allowed   map[string]struct{}
+	forbidden map[string]struct{}
+}
+
+func newCommandACL(cc *ClusterConfig) *commandACL {
+	if len(cc.AllowedCommands) == 0 && len(cc.ForbiddenCommands) == 0 {
+		return nil
+	}
+	a := &commandACL{forbidden: aclSet(cc.ForbiddenCommands)}
+	if len(cc.AllowedCommands) > 0 {
+		a.allowed = aclSet(cc.AllowedCommands)
+	}
+	return a
+}
+
+func aclSet(names []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		set[strings.ToLower(name)] = struct{}{}
+	}
+	return set
+}
+
+// validateACL checks the command names of acl.
+func validateACL(names []string) bool {
+	for _, name := range names {
+		if name == "" || strings.ContainsAny(name, " \t\r\n") {
+			return false
+		}
+		if strings.HasPrefix(name, "@") && name != aclRead && name != aclWrite {
+			return false
+		}
+	}
+	return true
+}
+
+// allow reports whether all the requests of msg are allowed.
+func (a *commandACL) allow(msg *proto.Message) bool {
+	for _, req := range msg.Requests() {
+		if !a.allowReq(req) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *commandACL) allowReq(req proto.Request) bool {
+	cmd := strings.ToLower(req.CmdString())
+	var category string
+	if c, ok := req.(proto.Classifier); ok {
+		if c.IsWrite() {
+			category = aclWrite
+		} else if c.IsRead() {
+			category = aclRead
+		}
+	}
+	if _, ok := a.forbidden[cmd]; ok {
+		return false
+	}
+	if _, ok := a.forbidden[category]; ok && category != "" {
+		return false
+	}
+	if a.allowed == nil || category == "" {
+		return true
+	}
+	if _, ok := a.allowed[cmd]; ok {
+		return true
+	}
+	_, ok := a.allowed[category]
+	return ok
+}
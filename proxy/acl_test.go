@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"overlord/pkg/mockconn"
+	libnet "overlord/pkg/net"
+	"overlord/pkg/types"
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/memcache"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandACL(t *testing.T) {
+	assert.Nil(t, newCommandACL(&ClusterConfig{}))
+	assert.True(t, validateACL([]string{"get", "@read", "FLUSHALL"}))
+	assert.False(t, validateACL([]string{"@admin"}))
+	assert.False(t, validateACL([]string{""}))
+
+	msgs := decodeTx(t, "GET a\r\nSET a 1\r\nPING\r\nMGET a b\r\nDEL a\r\nFLUSHALL\r\nKEYS *\r\n", 7)
+	allowed := func(acl *commandACL) (res []bool) {
+		for _, msg := range msgs {
+			res = append(res, acl.allow(msg))
+		}
+		return
+	}
+	acl := newCommandACL(&ClusterConfig{AllowedCommands: []string{"@read"}})
+	assert.Equal(t, []bool{true, false, true, true, false, true, true}, allowed(acl))
+	acl = newCommandACL(&ClusterConfig{AllowedCommands: []string{"@read", "del"}, ForbiddenCommands: []string{"MGET", "ping"}})
+	assert.Equal(t, []bool{true, false, false, false, true, true, true}, allowed(acl))
+	acl = newCommandACL(&ClusterConfig{ForbiddenCommands: []string{"@write"}})
+	assert.Equal(t, []bool{true, false, true, true, false, true, true}, allowed(acl))
+
+	h := &Handler{cc: &ClusterConfig{CacheType: types.CacheTypeRedis}, acl: acl}
+	fwd := h.rejected(msgs)
+	assert.Len(t, fwd, 5)
+	assert.Equal(t, ErrCommandDenied, msgs[1].Err())
+	assert.True(t, h.errReplied(msgs[1].Err()))
+
+	mpc := memcache.NewProxyConn(libnet.NewConn(mockconn.CreateConn([]byte("get a\r\nset a 0 0 1\r\nb\r\ndelete a\r\n"), 1), time.Second, time.Second))
+	msgs, err := mpc.Decode(proto.GetMsgs(3))
+	assert.NoError(t, err)
+	acl = newCommandACL(&ClusterConfig{AllowedCommands: []string{"@read", "DELETE"}})
+	assert.Equal(t, []bool{true, false, true}, allowed(acl))
+}
@@ -0,0 +1,419 @@
+package proxy
+
+import (
+	"encoding/json"
+	errs "errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"overlord/pkg/log"
+	"overlord/pkg/types"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	adminNodesPrefix   = "/api/v1/clusters/"
+	adminNodesSuffix   = "/nodes"
+	adminWritesSuffix  = "/writes"
+	adminCaptureSuffix = "/capture"
+)
+
+// admin errors
+var (
+	ErrAdminClusterNotFound = errs.New("cluster not found")
+	ErrAdminNodeNotFound    = errs.New("node not found")
+	ErrAdminNodeInvalid     = errs.New("node is invalid")
+	ErrAdminCaptureInvalid  = errs.New("capture is invalid")
+	ErrAdminVersionNotFound = errs.New("config version not found")
+)
+
+// Node is the backend node of cluster changed by admin api.
+type Node struct {
+	Addr   string `json:"addr"`
+	Weight int    `json:"weight"`
+	Alias  string `json:"alias,omitempty"`
+	// State is the runtime state only shown while listing.
+	State *NodeState `json:"state,omitempty"`
+}
+
+func (n *Node) String() string {
+	host, port, _ := net.SplitHostPort(n.Addr)
+	svr := host + ":" + port + ":" + strconv.Itoa(n.Weight)
+	if n.Alias != "" {
+		svr += " " + n.Alias
+	}
+	return svr
+}
+
+// Nodes returns the backend nodes of cluster name with their runtime state,
+// the nodes of redis_cluster are the ones discovered.
+func (p *Proxy) Nodes(name string) (nodes []*Node, err error) {
+	p.lock.Lock()
+	cc := p.clusterConfig(name)
+	var servers []string
+	if cc != nil {
+		servers = cc.Servers
+	}
+	p.lock.Unlock()
+	if cc == nil {
+		err = errors.Wrapf(ErrAdminClusterNotFound, "cluster:%s", name)
+		return
+	}
+	nss := p.nodeStats(name)
+	if cc.CacheType == types.CacheTypeRedisCluster {
+		for _, ns := range nss {
+			nodes = append(nodes, &Node{Addr: ns.Addr, State: newNodeState(ns)})
+		}
+		return
+	}
+	if nodes, err = parseNodes(servers); err != nil {
+		return
+	}
+	for _, n := range nodes {
+		for _, ns := range nss {
+			if ns.Addr == n.Addr {
+				n.State = newNodeState(ns)
+			}
+		}
+	}
+	return
+}
+
+// SetNode adds node into cluster name, or changes the weight and address
+// of the node with the same alias (or address if no alias).
+func (p *Proxy) SetNode(ccf, name string, node *Node) error {
+	if err := validateNode(node); err != nil {
+		return err
+	}
+	return p.changeNodes(ccf, name, func(nodes []*Node) ([]*Node, error) {
+		for i, n := range nodes {
+			if n.Alias == node.Alias && (n.Alias != "" || n.Addr == node.Addr) {
+				nodes[i] = node
+				return nodes, nil
+			}
+		}
+		return append(nodes, node), nil
+	})
+}
+
+// SetNodes replaces all the nodes of cluster name by nodes, such as
+// switching to the target cluster after migrated.
+func (p *Proxy) SetNodes(ccf, name string, nodes []*Node) error {
+	for _, node := range nodes {
+		if err := validateNode(node); err != nil {
+			return err
+		}
+	}
+	return p.changeNodes(ccf, name, func([]*Node) ([]*Node, error) {
+		return nodes, nil
+	})
+}
+
+// DelNode removes the node with the same alias (or address if no alias)
+// from cluster name.
+func (p *Proxy) DelNode(ccf, name string, node *Node) error {
+	return p.changeNodes(ccf, name, func(nodes []*Node) ([]*Node, error) {
+		for i, n := range nodes {
+			if matchNode(n, node.Addr, node.Alias) {
+				return append(nodes[:i], nodes[i+1:]...), nil
+			}
+		}
+		return nil, errors.Wrapf(ErrAdminNodeNotFound, "addr:%s alias:%s", node.Addr, node.Alias)
+	})
+}
+
+func validateNode(node *Node) error {
+	if node.Weight < 0 {
+		return errors.Wrapf(ErrAdminNodeInvalid, "weight:%d", node.Weight)
+	}
+	if _, _, err := net.SplitHostPort(node.Addr); err != nil || strings.Contains(node.Alias, " ") {
+		return errors.Wrapf(ErrAdminNodeInvalid, "addr:%s alias:%s", node.Addr, node.Alias)
+	}
+	return nil
+}
+
+// changeNodes updates the servers of cluster name in place by change and
+// persists them into cluster config file ccf if set.
+func (p *Proxy) changeNodes(ccf, name string, change func([]*Node) ([]*Node, error)) (err error) {
+	// NOTE: serialized with reload
+	p.reloadLock.Lock()
+	defer p.reloadLock.Unlock()
+	p.lock.Lock()
+	cc := p.clusterConfig(name)
+	var servers []string
+	if cc != nil {
+		servers = cc.Servers
+	}
+	p.lock.Unlock()
+	if cc == nil {
+		return errors.Wrapf(ErrAdminClusterNotFound, "cluster:%s", name)
+	}
+	if cc.CacheType == types.CacheTypeRedisCluster {
+		return errors.Wrapf(ErrAdminNodeInvalid, "nodes of %s are discovered from cluster", types.CacheTypeRedisCluster)
+	}
+	if cc.Discovery != "" {
+		return errors.Wrapf(ErrAdminNodeInvalid, "nodes of cluster:%s are discovered by %s", name, cc.Discovery)
+	}
+	nodes, err := parseNodes(servers)
+	if err != nil {
+		return
+	}
+	if nodes, err = change(nodes); err != nil {
+		return
+	}
+	servers = make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		servers = append(servers, n.String())
+	}
+	if err = ValidateStandalone(servers); err != nil {
+		return errors.Wrapf(ErrAdminNodeInvalid, "%v", err)
+	}
+	if err = p.updateConfig(&ClusterConfig{Name: name, Servers: servers}); err != nil {
+		return
+	}
+	log.Infof("admin change cluster:%s servers to %v", name, servers)
+	p.lock.Lock()
+	if cc = p.clusterConfig(name); cc != nil {
+		p.versions().record(cc, versionSourceAdmin)
+	}
+	p.lock.Unlock()
+	if ccf != "" {
+		if err = persistServers(ccf, name, servers); err != nil {
+			log.Errorf("admin persist cluster:%s servers into file:%s error:%v", name, ccf, err)
+			err = errors.Wrapf(err, "servers are changed but not persisted")
+		}
+	}
+	return
+}
+
+// clusterConfig returns the serving config of cluster name, p.lock must
+// be held.
+func (p *Proxy) clusterConfig(name string) *ClusterConfig {
+	for _, cc := range p.ccs {
+		if cc.Name == name {
+			return cc
+		}
+	}
+	return nil
+}
+
+// Writes is the state of writes of cluster changed by admin api.
+type Writes struct {
+	Paused bool `json:"paused"`
+}
+
+// NodesHandler returns the http handler of /api/v1/clusters/{name}/nodes,
+// GET lists nodes with their runtime state, POST adds or reweights a node, PUT replaces all the nodes
+// and DELETE removes a node, the changes are persisted into cluster config
+// file ccf. It also serves /api/v1/clusters/{name}/writes, GET shows and
+// POST pauses or resumes the writes of cluster, and
+// /api/v1/clusters/{name}/capture, GET shows, POST starts and DELETE stops
+// the traffic capture of cluster, and /api/v1/clusters/{name}/versions, GET
+// lists the config versions and POST rolls back to one of them, and
+// /api/v1/clusters/{name}/weights, GET lists the reweights in progress and
+// POST changes the weight of a node gradually.
+func (p *Proxy) NodesHandler(ccf string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		path := req.URL.Path
+		if !strings.HasPrefix(path, adminNodesPrefix) {
+			http.NotFound(w, req)
+			return
+		}
+		if strings.HasSuffix(path, adminWritesSuffix) {
+			p.serveWrites(w, req, strings.TrimSuffix(strings.TrimPrefix(path, adminNodesPrefix), adminWritesSuffix))
+			return
+		}
+		if strings.HasSuffix(path, adminVersionsSuffix) {
+			p.serveVersions(w, req, ccf, strings.TrimSuffix(strings.TrimPrefix(path, adminNodesPrefix), adminVersionsSuffix))
+			return
+		}
+		if strings.HasSuffix(path, adminWeightsSuffix) {
+			p.serveWeights(w, req, ccf, strings.TrimSuffix(strings.TrimPrefix(path, adminNodesPrefix), adminWeightsSuffix))
+			return
+		}
+		if strings.HasSuffix(path, adminCaptureSuffix) {
+			p.serveCapture(w, req, strings.TrimSuffix(strings.TrimPrefix(path, adminNodesPrefix), adminCaptureSuffix))
+			return
+		}
+		if !strings.HasSuffix(path, adminNodesSuffix) {
+			http.NotFound(w, req)
+			return
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(path, adminNodesPrefix), adminNodesSuffix)
+		var err error
+		switch req.Method {
+		case http.MethodGet:
+			var nodes []*Node
+			if nodes, err = p.Nodes(name); err == nil {
+				err = json.NewEncoder(w).Encode(nodes)
+			}
+		case http.MethodPut:
+			var nodes []*Node
+			if err = json.NewDecoder(req.Body).Decode(&nodes); err != nil {
+				http.Error(w, fmt.Sprintf("%s", err), http.StatusBadRequest)
+				return
+			}
+			if err = p.SetNodes(ccf, name, nodes); err == nil {
+				_, _ = w.Write([]byte("ok"))
+			}
+		case http.MethodPost, http.MethodDelete:
+			node := &Node{}
+			if err = json.NewDecoder(req.Body).Decode(node); err != nil {
+				http.Error(w, fmt.Sprintf("%s", err), http.StatusBadRequest)
+				return
+			}
+			if req.Method == http.MethodPost {
+				err = p.SetNode(ccf, name, node)
+			} else {
+				err = p.DelNode(ccf, name, node)
+			}
+			if err == nil {
+				_, _ = w.Write([]byte("ok"))
+			}
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		adminError(w, err)
+	}
+}
+
+func (p *Proxy) serveWrites(w http.ResponseWriter, req *http.Request, name string) {
+	var err error
+	switch req.Method {
+	case http.MethodGet:
+		ws := &Writes{}
+		if ws.Paused, err = p.WritesPaused(name); err == nil {
+			err = json.NewEncoder(w).Encode(ws)
+		}
+	case http.MethodPost:
+		ws := &Writes{}
+		if err = json.NewDecoder(req.Body).Decode(ws); err != nil {
+			http.Error(w, fmt.Sprintf("%s", err), http.StatusBadRequest)
+			return
+		}
+		if err = p.PauseWrites(name, ws.Paused); err == nil {
+			log.Infof("admin change cluster:%s writes paused to %t", name, ws.Paused)
+			_, _ = w.Write([]byte("ok"))
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	adminError(w, err)
+}
+
+func (p *Proxy) serveCapture(w http.ResponseWriter, req *http.Request, name string) {
+	var err error
+	switch req.Method {
+	case http.MethodGet:
+		var c *Capture
+		if c, err = p.CaptureState(name); err == nil {
+			err = json.NewEncoder(w).Encode(c)
+		}
+	case http.MethodPost:
+		c := &Capture{}
+		if err = json.NewDecoder(req.Body).Decode(c); err != nil {
+			http.Error(w, fmt.Sprintf("%s", err), http.StatusBadRequest)
+			return
+		}
+		if err = p.StartCapture(name, c.File, time.Duration(c.Seconds)*time.Second, c.KeyOnly); err == nil {
+			_, _ = w.Write([]byte("ok"))
+		}
+	case http.MethodDelete:
+		if err = p.StopCapture(name); err == nil {
+			log.Infof("admin stop capture cluster:%s", name)
+			_, _ = w.Write([]byte("ok"))
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	adminError(w, err)
+}
+
+func adminError(w http.ResponseWriter, err error) {
+	if err == nil {
+		return
+	}
+	switch errors.Cause(err) {
+	case ErrAdminClusterNotFound, ErrAdminNodeNotFound, ErrAdminVersionNotFound:
+		http.Error(w, fmt.Sprintf("%s", err), http.StatusNotFound)
+	case ErrAdminNodeInvalid, ErrAdminCaptureInvalid:
+		http.Error(w, fmt.Sprintf("%s", err), http.StatusBadRequest)
+	default:
+		http.Error(w, fmt.Sprintf("%s", err), http.StatusInternalServerError)
+	}
+}
+
+func parseNodes(servers []string) (nodes []*Node, err error) {
+	addrs, ws, ans, alias, err := parseServers(servers)
+	if err != nil {
+		return
+	}
+	for i, addr := range addrs {
+		n := &Node{Addr: addr, Weight: ws[i]}
+		if alias {
+			n.Alias = ans[i]
+		}
+		nodes = append(nodes, n)
+	}
+	return
+}
+
+// persistServers rewrites the servers of cluster name in config file ccf.
+func persistServers(ccf, name string, servers []string) (err error) {
+	cs, err := readClusterConfigs(ccf)
+	if err != nil {
+		return
+	}
+	for _, cc := range cs.Clusters {
+		if cc.Name == name {
+			cc.Servers = servers
+		}
+	}
+	return writeClusterConfigs(ccf, cs)
+}
+
+// readClusterConfigs reads config file ccf to rewrite, the environment
+// variables are kept unexpanded.
+func readClusterConfigs(ccf string) (*ClusterConfigs, error) {
+	cs := &ClusterConfigs{}
+	data, err := ioutil.ReadFile(ccf)
+	if err == nil {
+		err = decodeConfig(configFormat(ccf), data, cs)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Load From File:%s", ccf)
+	}
+	return cs, nil
+}
+
+// writeClusterConfigs rewrites config file ccf by cs atomically in the
+// format of ccf.
+func writeClusterConfigs(ccf string, cs *ClusterConfigs) (err error) {
+	data, err := encodeConfig(configFormat(ccf), cs)
+	if err != nil {
+		return
+	}
+	tmp := ccf + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		return errors.WithStack(err)
+	}
+	if err = f.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(tmp, ccf))
+}
@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"overlord/pkg/types"
+	"overlord/proxy/proto"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func _adminProxy(servers ...string) (*Proxy, *_updateForwarder) {
+	cc := &ClusterConfig{Name: "admin", CacheType: types.CacheTypeRedis, Servers: servers}
+	f := &_updateForwarder{servers: make(chan []string, 16)}
+	return &Proxy{ccs: []*ClusterConfig{cc}, forwarders: map[string]proto.Forwarder{cc.Name: f}}, f
+}
+
+func TestProxySetDelNode(t *testing.T) {
+	p, f := _adminProxy("127.0.0.1:6379:1 r1", "127.0.0.1:6380:1 r2")
+	assert.NoError(t, p.SetNode("", "admin", &Node{Addr: "127.0.0.1:6381", Weight: 2, Alias: "r3"}))
+	assert.Equal(t, []string{"127.0.0.1:6379:1 r1", "127.0.0.1:6380:1 r2", "127.0.0.1:6381:2 r3"}, <-f.servers)
+	// NOTE: reweight and replace the addr of alias r1
+	assert.NoError(t, p.SetNode("", "admin", &Node{Addr: "127.0.0.2:6379", Weight: 3, Alias: "r1"}))
+	assert.Equal(t, []string{"127.0.0.2:6379:3 r1", "127.0.0.1:6380:1 r2", "127.0.0.1:6381:2 r3"}, <-f.servers)
+	assert.NoError(t, p.DelNode("", "admin", &Node{Alias: "r2"}))
+	assert.Equal(t, []string{"127.0.0.2:6379:3 r1", "127.0.0.1:6381:2 r3"}, p.ccs[0].Servers)
+
+	nodes, err := p.Nodes("admin")
+	assert.NoError(t, err)
+	assert.Len(t, nodes, 2)
+	assert.Equal(t, &Node{Addr: "127.0.0.2:6379", Weight: 3, Alias: "r1"}, nodes[0])
+
+	err = p.SetNode("", "admin", &Node{Addr: "127.0.0.1:6382", Weight: 1})
+	assert.Equal(t, ErrAdminNodeInvalid, errors.Cause(err), "alias required")
+	err = p.SetNode("", "admin", &Node{Addr: "127.0.0.1:6382", Weight: -1, Alias: "r4"})
+	assert.Equal(t, ErrAdminNodeInvalid, errors.Cause(err))
+	err = p.DelNode("", "admin", &Node{Alias: "r4"})
+	assert.Equal(t, ErrAdminNodeNotFound, errors.Cause(err))
+	err = p.DelNode("", "unknown", &Node{Alias: "r1"})
+	assert.Equal(t, ErrAdminClusterNotFound, errors.Cause(err))
+}
+
+func TestProxyNodesHandler(t *testing.T) {
+	p, _ := _adminProxy("127.0.0.1:6379:1", "127.0.0.1:6380:1")
+	h := p.NodesHandler("")
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, "/api/v1/clusters/admin/nodes", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `[{"addr":"127.0.0.1:6379","weight":1},{"addr":"127.0.0.1:6380","weight":1}]`+"\n", w.Body.String())
+
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodDelete, "/api/v1/clusters/admin/nodes", strings.NewReader(`{"addr":"127.0.0.1:6380"}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"127.0.0.1:6379:1"}, p.ccs[0].Servers)
+
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodPost, "/api/v1/clusters/admin/nodes", strings.NewReader(`{"addr":"127.0.0.1:6379","weight":5}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"127.0.0.1:6379:5"}, p.ccs[0].Servers)
+
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodPost, "/api/v1/clusters/admin/nodes", strings.NewReader(`{bad`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodDelete, "/api/v1/clusters/admin/nodes", strings.NewReader(`{"addr":"127.0.0.1:6379"}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code, "the last node can't be removed")
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, "/api/v1/clusters/unknown/nodes", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodPatch, "/api/v1/clusters/admin/nodes", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodPut, "/api/v1/clusters/admin/nodes", strings.NewReader(`[{"addr":"127.0.0.2:6379","weight":1},{"addr":"127.0.0.2:6380","weight":2}]`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"127.0.0.2:6379:1", "127.0.0.2:6380:2"}, p.ccs[0].Servers)
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodPut, "/api/v1/clusters/admin/nodes", strings.NewReader(`[{"addr":"127.0.0.2:6379","weight":0}]`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodPut, "/api/v1/clusters/admin/nodes", strings.NewReader(`[]`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestProxyWritesHandler(t *testing.T) {
+	p, _ := _adminProxy("127.0.0.1:6379:1")
+	h := p.NodesHandler("")
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodPost, "/api/v1/clusters/admin/writes", strings.NewReader(`{"paused":true}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, "/api/v1/clusters/admin/writes", nil))
+	assert.Equal(t, `{"paused":true}`+"\n", w.Body.String())
+
+	hd := &Handler{cc: p.ccs[0], cstat: p.clusterStat("admin")}
+	msgs := decodeTx(t, "GET a\r\nSET a 1\r\nMSET a 1 b 2\r\n", 3)
+	fwd := hd.rejected(msgs)
+	assert.Len(t, fwd, 1)
+	assert.Equal(t, ErrWritesPaused, msgs[1].Err())
+	assert.Equal(t, ErrWritesPaused, msgs[2].Err())
+	assert.True(t, hd.errReplied(msgs[1].Err()))
+
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodPost, "/api/v1/clusters/admin/writes", strings.NewReader(`{"paused":false}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, hd.writesPaused())
+
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodPost, "/api/v1/clusters/unknown/writes", strings.NewReader(`{"paused":true}`)))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodDelete, "/api/v1/clusters/admin/writes", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
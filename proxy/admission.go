@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	errs "errors"
+	"sync/atomic"
+	"time"
+
+	"overlord/pkg/prom"
+	"overlord/proxy/proto"
+)
+
+// ErrInflightShed is replied to the requests shed by the admitter.
+var ErrInflightShed = errs.New("ERR too many requests in flight, try again later")
+
+// admitter bounds the in-flight requests of a cluster shared by all its
+// clients. The requests exceeded max_inflight wait for inflight_queue_timeout
+// in the queue up to inflight_queue, the others are shed with error, so that
+// requests never pile up while a backend slows down.
+type admitter struct {
+	cluster string
+	slots   chan struct{}
+	queue   int32
+	timeout time.Duration
+
+	queued, shed int64
+}
+
+func newAdmitter(cc *ClusterConfig) *admitter {
+	if cc.MaxInflight <= 0 {
+		return nil
+	}
+	return &admitter{
+		cluster: cc.Name,
+		slots:   make(chan struct{}, cc.MaxInflight),
+		queue:   int32(cc.InflightQueue),
+		timeout: time.Duration(cc.InflightQueueTimeout) * time.Millisecond,
+	}
+}
+
+// tryAcquire takes one slot without waiting.
+func (a *admitter) tryAcquire() bool {
+	select {
+	case a.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// acquire takes one slot, it waits in the queue if not full and returns
+// false if timeout.
+func (a *admitter) acquire() bool {
+	if a.tryAcquire() {
+		return true
+	}
+	if atomic.AddInt64(&a.queued, 1) > int64(a.queue) {
+		atomic.AddInt64(&a.queued, -1)
+		return false
+	}
+	a.stat()
+	timer := time.NewTimer(a.timeout)
+	defer func() {
+		timer.Stop()
+		atomic.AddInt64(&a.queued, -1)
+		a.stat()
+	}()
+	select {
+	case a.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (a *admitter) release(n int) {
+	for i := 0; i < n; i++ {
+		<-a.slots
+	}
+	a.stat()
+}
+
+func (a *admitter) stat() {
+	if prom.On {
+		prom.Inflight(a.cluster, len(a.slots), int(atomic.LoadInt64(&a.queued)))
+	}
+}
+
+// admit returns the messages admitted which must be released after replied,
+// the others are shed with error. Only the first message of the pipeline may
+// wait in the queue, the rest never wait while holding slots, otherwise
+// pipelines holding part of the slots wait for each other until timeout.
+// Once one message is shed, the rest of the pipeline are shed as well.
+func (h *Handler) admit(msgs []*proto.Message) []*proto.Message {
+	if h.admitter == nil {
+		return msgs
+	}
+	a := h.admitter
+	for i := range msgs {
+		if i == 0 && a.acquire() || i > 0 && a.tryAcquire() {
+			continue
+		}
+		for _, m := range msgs[i:] {
+			m.WithError(ErrInflightShed)
+		}
+		n := len(msgs) - i
+		atomic.AddInt64(&a.shed, int64(n))
+		if prom.On {
+			prom.ShedAdd(a.cluster, n)
+		}
+		return msgs[:i]
+	}
+	a.stat()
+	return msgs
+}
+
+// unadmit releases the slots of the messages admitted.
+func (h *Handler) unadmit(msgs []*proto.Message) {
+	if h.admitter == nil || len(msgs) == 0 {
+		return
+	}
+	h.admitter.release(len(msgs))
+}
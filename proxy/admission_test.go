@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"overlord/pkg/types"
+	"overlord/proxy/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdmitterQueue(t *testing.T) {
+	a := newAdmitter(&ClusterConfig{Name: "admit", MaxInflight: 1, InflightQueue: 1, InflightQueueTimeout: 20})
+	assert.True(t, a.acquire())
+	// NOTE: timeout in queue
+	assert.False(t, a.acquire())
+
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		a.release(1)
+	}()
+	assert.True(t, a.acquire())
+
+	done := make(chan bool)
+	go func() {
+		done <- a.acquire()
+	}()
+	time.Sleep(5 * time.Millisecond)
+	// NOTE: shed if the queue is full
+	assert.False(t, a.acquire())
+	a.release(1)
+	assert.True(t, <-done)
+	a.release(1)
+	assert.Len(t, a.slots, 0)
+}
+
+func TestHandlerAdmit(t *testing.T) {
+	cc := &ClusterConfig{Name: "admit", CacheType: types.CacheTypeRedis, MaxInflight: 2}
+	h := &Handler{cc: cc, admitter: newAdmitter(cc)}
+	var msgs []*proto.Message
+	for i := 0; i < 3; i++ {
+		msgs = append(msgs, _decodeRedis(t, "*2\r\n$3\r\nGET\r\n$1\r\na\r\n")...)
+	}
+	fwd := h.admit(msgs)
+	assert.Len(t, fwd, 2)
+	assert.Equal(t, ErrInflightShed, msgs[2].Err())
+	assert.Equal(t, int64(1), h.admitter.shed)
+
+	h.unadmit(fwd)
+	assert.Len(t, h.admitter.slots, 0)
+}
+
+func TestHandlerAdmitNoConvoy(t *testing.T) {
+	cc := &ClusterConfig{Name: "admit", CacheType: types.CacheTypeRedis, MaxInflight: 2, InflightQueue: 2, InflightQueueTimeout: 1000}
+	a := newAdmitter(cc)
+	h1 := &Handler{cc: cc, admitter: a}
+	h2 := &Handler{cc: cc, admitter: a}
+	pipe := func(n int) (msgs []*proto.Message) {
+		for i := 0; i < n; i++ {
+			msgs = append(msgs, _decodeRedis(t, "*2\r\n$3\r\nGET\r\n$1\r\na\r\n")...)
+		}
+		return
+	}
+	assert.True(t, a.acquire())
+	// NOTE: holding one slot, the rest of pipeline is shed at once instead of waiting in queue.
+	start := time.Now()
+	fwd1 := h1.admit(pipe(2))
+	assert.Len(t, fwd1, 1)
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+
+	// NOTE: the first message waits in queue while holding nothing.
+	done := make(chan []*proto.Message)
+	go func() {
+		done <- h2.admit(pipe(1))
+	}()
+	time.Sleep(5 * time.Millisecond)
+	h1.unadmit(fwd1)
+	fwd2 := <-done
+	assert.Len(t, fwd2, 1)
+	h2.unadmit(fwd2)
+	a.release(1)
+	assert.Len(t, a.slots, 0)
+	assert.Equal(t, int64(1), a.shed)
+}
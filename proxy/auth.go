@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"bytes"
+	errs "errors"
+
+	"overlord/pkg/types"
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/redis"
+)
+
+// auth errors
+var (
+	ErrAuthRequired = errs.New("NOAUTH Authentication required.")
+)
+
+var (
+	okBytes            = []byte("OK")
+	authInvalidBytes   = []byte("ERR invalid password")
+	authNoPassBytes    = []byte("ERR Client sent AUTH, but no password is set")
+	authWrongArgsBytes = []byte("ERR wrong number of arguments for 'auth' command")
+)
+
+// checkAuth answers AUTH of redis clients and rejects the other commands
+// until the client authenticated by the cluster auth, it returns the
+// messages which can be forwarded.
+func (h *Handler) checkAuth(msgs []*proto.Message) []*proto.Message {
+	if h.cc.CacheType != types.CacheTypeRedis && h.cc.CacheType != types.CacheTypeRedisCluster {
+		return msgs
+	}
+	if h.cc.Auth == "" || h.authed {
+		// NOTE: AUTH and HELLO are control commands which will never be sent to backend
+		for _, msg := range msgs {
+			if req, ok := msg.Request().(*redis.Request); ok && !msg.IsBatch() {
+				if req.IsAuth() {
+					h.replyAuth(req)
+				} else if req.IsHello() {
+					h.replyHello(req)
+				}
+			}
+		}
+		return msgs
+	}
+	var fwd []*proto.Message
+	for _, msg := range msgs {
+		if req, ok := msg.Request().(*redis.Request); ok && !msg.IsBatch() && req.IsAuth() {
+			h.replyAuth(req)
+			continue
+		}
+		if req, ok := msg.Request().(*redis.Request); ok && !msg.IsBatch() && req.IsHello() {
+			// NOTE: HELLO may authenticate by AUTH option
+			h.replyHello(req)
+			continue
+		}
+		if !h.authed {
+			msg.WithError(ErrAuthRequired)
+			continue
+		}
+		fwd = append(fwd, msg)
+	}
+	return fwd
+}
+
+func (h *Handler) replyAuth(req *redis.Request) {
+	args := req.RESP().Array()
+	if len(args) != 2 {
+		req.Reply().SetError(authWrongArgsBytes)
+		return
+	}
+	if h.cc.Auth == "" {
+		req.Reply().SetError(authNoPassBytes)
+		return
+	}
+	if !bytes.Equal(bulkData(args[1].Data()), []byte(h.cc.Auth)) {
+		h.authed = false
+		req.Reply().SetError(authInvalidBytes)
+		return
+	}
+	h.authed = true
+	req.Reply().SetString(okBytes)
+}
@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"overlord/pkg/mockconn"
+	libnet "overlord/pkg/net"
+	"overlord/pkg/types"
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/redis"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func _authReplies(t *testing.T, h *Handler, cmds ...string) (string, int) {
+	rpc := redis.NewProxyConn(libnet.NewConn(mockconn.CreateConn([]byte(strings.Join(cmds, "\r\n")+"\r\n"), 1), time.Second, time.Second), true)
+	msgs, err := rpc.Decode(proto.GetMsgs(len(cmds)))
+	assert.NoError(t, err)
+	assert.Len(t, msgs, len(cmds))
+	fwd := h.checkAuth(msgs)
+
+	mconn, buf := mockconn.CreateDownStreamConn()
+	wpc := redis.NewProxyConn(libnet.NewConn(mconn, time.Second, time.Second), true)
+	for _, msg := range msgs {
+		if msg.Err() != nil || msg.Request().CmdString() == "AUTH" {
+			if err := wpc.Encode(msg); err != ErrAuthRequired {
+				assert.NoError(t, err)
+			}
+		}
+	}
+	assert.NoError(t, wpc.Flush())
+	return buf.String(), len(fwd)
+}
+
+func TestHandlerAuthRequired(t *testing.T) {
+	h := &Handler{cc: &ClusterConfig{CacheType: types.CacheTypeRedis, Auth: "pass"}}
+	replies, fwd := _authReplies(t, h, "get a", "auth wrong")
+	assert.Equal(t, "-NOAUTH Authentication required.\r\n-ERR invalid password\r\n", replies)
+	assert.Equal(t, 0, fwd)
+	assert.False(t, h.authed)
+
+	replies, fwd = _authReplies(t, h, "auth pass", "get a")
+	assert.Equal(t, "+OK\r\n", replies)
+	assert.Equal(t, 1, fwd)
+	assert.True(t, h.authed)
+}
+
+func TestHandlerAuthNoPassword(t *testing.T) {
+	h := &Handler{cc: &ClusterConfig{CacheType: types.CacheTypeRedis}}
+	replies, fwd := _authReplies(t, h, "auth pass", "get a")
+	assert.Equal(t, "-ERR Client sent AUTH, but no password is set\r\n", replies)
+	assert.Equal(t, 2, fwd)
+}
@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"time"
+
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/redis"
+)
+
+var (
+	blockNotSupportBytes = []byte("ERR blocking commands are not supported by the cluster")
+	blockBusyBytes       = []byte("ERR too many blocking commands, try again later")
+)
+
+// blocker bounds the dedicated node connections of the blocking commands
+// such as BLPOP of a cluster.
+type blocker struct {
+	conns  chan struct{}
+	margin time.Duration
+}
+
+func newBlocker(cc *ClusterConfig) *blocker {
+	if cc.BlockingMaxConns <= 0 {
+		return nil
+	}
+	return &blocker{
+		conns:  make(chan struct{}, cc.BlockingMaxConns),
+		margin: time.Duration(cc.BlockingTimeoutMargin) * time.Millisecond,
+	}
+}
+
+// acquire returns false if the connections are exhausted.
+func (b *blocker) acquire() bool {
+	select {
+	case b.conns <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (b *blocker) release() {
+	<-b.conns
+}
+
+// readTimeout returns the read timeout of node for the blocking timeout,
+// zero means blocking forever.
+func (b *blocker) readTimeout(timeout time.Duration) time.Duration {
+	if timeout == 0 {
+		return 0
+	}
+	return timeout + b.margin
+}
+
+// serveBlock sends the blocking command of msg on a dedicated connection to
+// the node of its keys, the client is blocked until the node replies.
+func (h *Handler) serveBlock(msg *proto.Message, req *redis.Request) {
+	if h.blocker == nil || !h.txSupported() {
+		req.Reply().SetError(blockNotSupportBytes)
+		return
+	}
+	if !req.CheckKeys(h.forwarder.(proto.Router).Route) {
+		return
+	}
+	if !h.blocker.acquire() {
+		req.Reply().SetError(blockBusyBytes)
+		return
+	}
+	defer h.blocker.release()
+	node, err := h.pin(req.Key())
+	if err != nil {
+		msg.WithError(err)
+		return
+	}
+	defer node.Close()
+	if timeout, ok := req.BlockTimeout(); ok {
+		node.SetReadTimeout(h.blocker.readTimeout(timeout))
+	}
+	if err = req.Send(node); err != nil {
+		msg.WithError(err)
+	}
+}
@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"overlord/pkg/mockconn"
+	"overlord/pkg/types"
+	"overlord/proxy/proto/redis"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockerReadTimeout(t *testing.T) {
+	assert.Nil(t, newBlocker(&ClusterConfig{}))
+	b := newBlocker(&ClusterConfig{BlockingMaxConns: 1, BlockingTimeoutMargin: 100})
+	assert.Equal(t, time.Duration(0), b.readTimeout(0))
+	assert.Equal(t, 1100*time.Millisecond, b.readTimeout(time.Second))
+	assert.True(t, b.acquire())
+	assert.False(t, b.acquire())
+	b.release()
+	assert.True(t, b.acquire())
+}
+
+func TestHandlerServeBlock(t *testing.T) {
+	f := &_txForwarder{node: mockconn.CreateConn([]byte("*2\r\n$2\r\nab\r\n$1\r\nv\r\n"), 1)}
+	h := &Handler{cc: &ClusterConfig{CacheType: types.CacheTypeRedis}, forwarder: f}
+	reply := func(i int, msgs []*redis.Request) string {
+		r := msgs[i].Reply()
+		return string([]byte{r.Type()}) + string(r.Data())
+	}
+
+	msgs := decodeTx(t, "BLPOP a ab 1.5\r\nGET a\r\nBRPOP a b 0\r\nMULTI\r\nBLPOP a 0\r\n", 5)
+	assert.Equal(t, 0, txIndex(msgs))
+	var reqs []*redis.Request
+	for _, msg := range msgs {
+		reqs = append(reqs, msg.Request().(*redis.Request))
+	}
+	assert.Len(t, h.serveMulti(msgs[:1]), 0)
+	h.serveTx()
+	assert.Equal(t, "-"+string(blockNotSupportBytes), reply(0, reqs))
+
+	h.blocker = newBlocker(&ClusterConfig{BlockingMaxConns: 1})
+	h.serveMulti(msgs[:1])
+	h.serveTx()
+	assert.Equal(t, "a", string(f.pinned))
+	assert.Equal(t, "*2", reply(0, reqs))
+	assert.Equal(t, "*4\r\n$5\r\nBLPOP\r\n$1\r\na\r\n$2\r\nab\r\n$3\r\n1.5\r\n", f.node.(*mockconn.MockConn).Wbuf.String())
+
+	f.pinned = nil
+	h.serveMulti(msgs[2:3])
+	h.serveTx()
+	assert.Equal(t, "-CROSSSLOT", reply(2, reqs)[:10])
+	assert.Nil(t, f.pinned)
+
+	assert.True(t, h.blocker.acquire())
+	h.serveMulti(msgs[:1])
+	h.serveTx()
+	assert.Equal(t, "-"+string(blockBusyBytes), reply(0, reqs))
+	h.blocker.release()
+
+	// NOTE: the blocking commands are queued in transaction
+	assert.Len(t, h.serveMulti(msgs[3:]), 0)
+	assert.Equal(t, "+QUEUED", reply(4, reqs))
+	assert.Nil(t, h.pending)
+}
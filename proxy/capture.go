@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"time"
+
+	"overlord/pkg/log"
+	"overlord/pkg/types"
+	"overlord/proxy/capture"
+	"overlord/proxy/proto"
+
+	"github.com/pkg/errors"
+)
+
+// Capture is the traffic capture of cluster changed by admin api.
+type Capture struct {
+	Capturing bool      `json:"capturing"`
+	File      string    `json:"file"`
+	Seconds   int       `json:"seconds,omitempty"`
+	KeyOnly   bool      `json:"key_only"`
+	Until     time.Time `json:"until"`
+	Captured  int64     `json:"captured"`
+	Dropped   int64     `json:"dropped"`
+}
+
+// StartCapture records the requests of cluster name into file in the wire
+// format of its protocol for d, the values are masked if keyOnly. Only one
+// capture of a cluster runs at a time.
+func (p *Proxy) StartCapture(name, file string, d time.Duration, keyOnly bool) error {
+	p.lock.Lock()
+	cc := p.clusterConfig(name)
+	p.lock.Unlock()
+	if cc == nil {
+		return errors.Wrapf(ErrAdminClusterNotFound, "cluster:%s", name)
+	}
+	if cc.CacheType == types.CacheTypeMemcacheBinary {
+		return errors.Wrapf(ErrAdminCaptureInvalid, "capture not support by %s", types.CacheTypeMemcacheBinary)
+	}
+	if file == "" || d <= 0 {
+		return errors.Wrapf(ErrAdminCaptureInvalid, "file:%s seconds:%d", file, d/time.Second)
+	}
+	cs := p.clusterStat(name)
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	if cs.capturing() != nil {
+		return errors.Wrapf(ErrAdminCaptureInvalid, "cluster:%s is capturing", name)
+	}
+	c, err := capture.Start(file, d, keyOnly)
+	if err != nil {
+		return errors.Wrapf(ErrAdminCaptureInvalid, "%v", err)
+	}
+	cs.capture.Store(c)
+	log.Infof("admin start capture cluster:%s into file:%s for %v key only:%t", name, file, d, keyOnly)
+	go func() {
+		<-c.Done()
+		cs.finish(c)
+		log.Infof("capture cluster:%s into file:%s done captured:%d dropped:%d", name, file, c.Captured(), c.Dropped())
+	}()
+	return nil
+}
+
+// StopCapture stops the capture of cluster name before its duration.
+func (p *Proxy) StopCapture(name string) error {
+	c, err := p.capturing(name)
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		return errors.Wrapf(ErrAdminCaptureInvalid, "cluster:%s is not capturing", name)
+	}
+	c.Stop()
+	<-c.Done()
+	p.clusterStat(name).finish(c)
+	return nil
+}
+
+// CaptureState returns the capture of cluster name.
+func (p *Proxy) CaptureState(name string) (*Capture, error) {
+	c, err := p.capturing(name)
+	if err != nil || c == nil {
+		return &Capture{}, err
+	}
+	return &Capture{
+		Capturing: true,
+		File:      c.File,
+		KeyOnly:   c.KeyOnly,
+		Until:     c.Until,
+		Captured:  c.Captured(),
+		Dropped:   c.Dropped(),
+	}, nil
+}
+
+func (p *Proxy) capturing(name string) (*capture.Capture, error) {
+	p.lock.Lock()
+	cc := p.clusterConfig(name)
+	p.lock.Unlock()
+	if cc == nil {
+		return nil, errors.Wrapf(ErrAdminClusterNotFound, "cluster:%s", name)
+	}
+	return p.clusterStat(name).capturing(), nil
+}
+
+// capturing returns the capture running, nil if not capturing.
+func (cs *clusterStat) capturing() *capture.Capture {
+	c, _ := cs.capture.Load().(*capture.Capture)
+	return c
+}
+
+// finish clears the capture c done.
+func (cs *clusterStat) finish(c *capture.Capture) {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	if cs.capturing() == c {
+		cs.capture.Store((*capture.Capture)(nil))
+	}
+}
+
+// capture records the requests decoded into the capture of cluster, the
+// requests answered by proxy itself are not captured.
+func (h *Handler) capture(msgs []*proto.Message) {
+	if h.cstat == nil {
+		return
+	}
+	c := h.cstat.capturing()
+	if c == nil {
+		return
+	}
+	for _, m := range msgs {
+		if m.Err() != nil {
+			continue
+		}
+		for _, req := range m.Requests() {
+			if l, ok := req.(proto.Localer); ok && l.IsLocal() {
+				continue
+			}
+			c.Record(req)
+		}
+	}
+}
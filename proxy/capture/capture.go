@@ -0,0 +1,125 @@
+package capture
+
+import (
+	"bufio"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"overlord/pkg/log"
+	"overlord/proxy/proto"
+
+	"github.com/pkg/errors"
+)
+
+const exchangeSize = 8192
+
+// Capture records the requests of a cluster into file in the wire format of
+// its protocol for a duration, which can be replayed against another node
+// by Reader. The requests are dropped if the writer can't catch up.
+type Capture struct {
+	File    string
+	KeyOnly bool
+	Until   time.Time
+
+	fd       *os.File
+	wr       *bufio.Writer
+	exchange chan []byte
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+	stopped  int32
+
+	captured, dropped int64
+}
+
+// Start creates file and starts capturing for d, the file must not exist.
+func Start(file string, d time.Duration, keyOnly bool) (*Capture, error) {
+	fd, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	c := &Capture{
+		File:     file,
+		KeyOnly:  keyOnly,
+		Until:    time.Now().Add(d),
+		fd:       fd,
+		wr:       bufio.NewWriter(fd),
+		exchange: make(chan []byte, exchangeSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go c.write()
+	time.AfterFunc(d, c.Stop)
+	return c, nil
+}
+
+// Record appends req into the capture, it never blocks.
+func (c *Capture) Record(req proto.Request) {
+	cr, ok := req.(proto.Capturer)
+	if !ok || atomic.LoadInt32(&c.stopped) == 1 {
+		return
+	}
+	select {
+	case c.exchange <- cr.Capture(nil, c.KeyOnly):
+	default:
+		atomic.AddInt64(&c.dropped, 1)
+	}
+}
+
+// Stop stops capturing, the requests recorded are flushed into file.
+func (c *Capture) Stop() {
+	c.once.Do(func() {
+		atomic.StoreInt32(&c.stopped, 1)
+		close(c.stop)
+	})
+}
+
+// Done returns the channel closed after stopped and the file closed.
+func (c *Capture) Done() <-chan struct{} {
+	return c.done
+}
+
+// Captured returns the number of requests written into file.
+func (c *Capture) Captured() int64 {
+	return atomic.LoadInt64(&c.captured)
+}
+
+// Dropped returns the number of requests dropped.
+func (c *Capture) Dropped() int64 {
+	return atomic.LoadInt64(&c.dropped)
+}
+
+func (c *Capture) write() {
+	defer close(c.done)
+	for {
+		select {
+		case b := <-c.exchange:
+			c.save(b)
+		case <-c.stop:
+			for {
+				select {
+				case b := <-c.exchange:
+					c.save(b)
+				default:
+					if err := c.wr.Flush(); err != nil {
+						log.Errorf("capture flush file:%s error:%v", c.File, err)
+					}
+					if err := c.fd.Close(); err != nil {
+						log.Errorf("capture close file:%s error:%v", c.File, err)
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+func (c *Capture) save(b []byte) {
+	if _, err := c.wr.Write(b); err != nil {
+		atomic.AddInt64(&c.dropped, 1)
+		return
+	}
+	atomic.AddInt64(&c.captured, 1)
+}
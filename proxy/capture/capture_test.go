@@ -0,0 +1,137 @@
+package capture
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"overlord/pkg/mockconn"
+	libnet "overlord/pkg/net"
+	"overlord/pkg/types"
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/memcache"
+	"overlord/proxy/proto/redis"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decode(t *testing.T, cacheType types.CacheType, data string, n int) (reqs []proto.Request) {
+	conn := libnet.NewConn(mockconn.CreateConn([]byte(data), 1), time.Second, time.Second)
+	var pc proto.ProxyConn
+	if cacheType == types.CacheTypeRedis {
+		pc = redis.NewProxyConn(conn, true)
+	} else {
+		pc = memcache.NewProxyConn(conn)
+	}
+	msgs, err := pc.Decode(proto.GetMsgs(n))
+	assert.NoError(t, err)
+	for _, m := range msgs {
+		reqs = append(reqs, m.Requests()...)
+	}
+	return
+}
+
+func readAll(t *testing.T, cacheType types.CacheType, data []byte) (reqs []string) {
+	rd := NewReader(bytes.NewReader(data), cacheType)
+	for {
+		req, err := rd.Next()
+		if err == io.EOF {
+			return
+		}
+		assert.NoError(t, err)
+		reqs = append(reqs, string(req))
+	}
+}
+
+func TestCaptureRedis(t *testing.T) {
+	reqs := decode(t, types.CacheTypeRedis, "*3\r\n$3\r\nSET\r\n$1\r\na\r\n$2\r\nab\r\nGET a\r\n*5\r\n$3\r\nSET\r\n$1\r\nb\r\n$3\r\nabc\r\n$2\r\nEX\r\n$2\r\n10\r\n*3\r\n$4\r\nMGET\r\n$1\r\na\r\n$1\r\nb\r\n", 4)
+	var buf, masked []byte
+	for _, req := range reqs {
+		buf = req.(proto.Capturer).Capture(buf, false)
+		masked = req.(proto.Capturer).Capture(masked, true)
+	}
+	assert.Equal(t, []string{
+		"*3\r\n$3\r\nSET\r\n$1\r\na\r\n$2\r\nab\r\n",
+		"*2\r\n$3\r\nGET\r\n$1\r\na\r\n",
+		"*5\r\n$3\r\nSET\r\n$1\r\nb\r\n$3\r\nabc\r\n$2\r\nEX\r\n$2\r\n10\r\n",
+		"*2\r\n$4\r\nMGET\r\n$1\r\na\r\n",
+		"*2\r\n$4\r\nMGET\r\n$1\r\nb\r\n",
+	}, readAll(t, types.CacheTypeRedis, buf))
+	assert.Equal(t, []string{
+		"*3\r\n$3\r\nSET\r\n$1\r\na\r\n$2\r\nxx\r\n",
+		"*2\r\n$3\r\nGET\r\n$1\r\na\r\n",
+		"*5\r\n$3\r\nSET\r\n$1\r\nb\r\n$3\r\nxxx\r\n$2\r\nxx\r\n$2\r\n10\r\n",
+		"*2\r\n$4\r\nMGET\r\n$1\r\na\r\n",
+		"*2\r\n$4\r\nMGET\r\n$1\r\nb\r\n",
+	}, readAll(t, types.CacheTypeRedis, masked))
+}
+
+func TestCaptureMemcache(t *testing.T) {
+	reqs := decode(t, types.CacheTypeMemcache, "set a 0 10 2\r\nab\r\nget a b\r\ndelete a\r\nms c 3 T10\r\nabc\r\ngat 10 a\r\n", 5)
+	var buf, masked []byte
+	for _, req := range reqs {
+		buf = req.(proto.Capturer).Capture(buf, false)
+		masked = req.(proto.Capturer).Capture(masked, true)
+	}
+	assert.Equal(t, []string{
+		"set a 0 10 2\r\nab\r\n",
+		"get a\r\n",
+		"get b\r\n",
+		"delete a\r\n",
+		"ms c 3 T10\r\nabc\r\n",
+		"gat 10 a\r\n",
+	}, readAll(t, types.CacheTypeMemcache, buf))
+	assert.Equal(t, []string{
+		"set a 0 10 2\r\nxx\r\n",
+		"get a\r\n",
+		"get b\r\n",
+		"delete a\r\n",
+		"ms c 3 T10\r\nxxx\r\n",
+		"gat 10 a\r\n",
+	}, readAll(t, types.CacheTypeMemcache, masked))
+}
+
+func TestReaderBad(t *testing.T) {
+	_, err := NewReader(bytes.NewReader([]byte("*2\r\n$3\r\nGET\r\n")), types.CacheTypeRedis).Next()
+	assert.Error(t, err)
+	_, err = NewReader(bytes.NewReader([]byte("GET a\r\n")), types.CacheTypeRedis).Next()
+	assert.Error(t, err)
+	_, err = NewReader(bytes.NewReader([]byte("set a 0 0 5\r\nab\r\n")), types.CacheTypeMemcache).Next()
+	assert.Error(t, err)
+}
+
+func TestCaptureStart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "capture")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "redis.cap")
+
+	c, err := Start(file, time.Hour, false)
+	assert.NoError(t, err)
+	for _, req := range decode(t, types.CacheTypeRedis, "GET a\r\nSET b 1\r\n", 2) {
+		c.Record(req)
+	}
+	c.Stop()
+	<-c.Done()
+	assert.Equal(t, int64(2), c.Captured())
+	assert.Equal(t, int64(0), c.Dropped())
+	data, err := ioutil.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "*2\r\n$3\r\nGET\r\n$1\r\na\r\n*3\r\n$3\r\nSET\r\n$1\r\nb\r\n$1\r\n1\r\n", string(data))
+
+	// NOTE: never overwrite the file exists
+	_, err = Start(file, time.Hour, false)
+	assert.Error(t, err)
+
+	c, err = Start(filepath.Join(dir, "expired.cap"), 10*time.Millisecond, true)
+	assert.NoError(t, err)
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		t.Fatal("capture not stopped after duration")
+	}
+}
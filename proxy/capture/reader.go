@@ -0,0 +1,137 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	errs "errors"
+	"io"
+	"strconv"
+
+	"overlord/pkg/types"
+
+	"github.com/pkg/errors"
+)
+
+// ErrBadCapture is the error of the malformed capture file.
+var ErrBadCapture = errs.New("bad capture file")
+
+var (
+	crlfBytes = []byte("\r\n")
+	// storageLenIndex is the field index of bytes of memcache storage
+	// commands.
+	storageLenIndex = map[string]int{
+		"set":     4,
+		"add":     4,
+		"replace": 4,
+		"append":  4,
+		"prepend": 4,
+		"cas":     4,
+		"ms":      2,
+	}
+)
+
+// Reader reads the requests captured one by one.
+type Reader struct {
+	br        *bufio.Reader
+	cacheType types.CacheType
+}
+
+// NewReader new the reader of file captured from the cluster of cacheType,
+// redis and memcache are supported.
+func NewReader(rd io.Reader, cacheType types.CacheType) *Reader {
+	return &Reader{br: bufio.NewReader(rd), cacheType: cacheType}
+}
+
+// Next returns the next request in wire format, io.EOF at the end.
+func (r *Reader) Next() ([]byte, error) {
+	if r.cacheType == types.CacheTypeMemcache {
+		return r.nextMemcache()
+	}
+	return r.nextRedis()
+}
+
+func (r *Reader) nextRedis() (req []byte, err error) {
+	line, err := r.line()
+	if err != nil {
+		return
+	}
+	if line[0] != '*' {
+		return nil, errors.Wrapf(ErrBadCapture, "line:%q", line)
+	}
+	n, err := strconv.Atoi(string(line[1 : len(line)-2]))
+	if err != nil {
+		return nil, errors.Wrapf(ErrBadCapture, "line:%q", line)
+	}
+	req = append(req, line...)
+	for i := 0; i < n; i++ {
+		if line, err = r.line(); err != nil {
+			return nil, r.unexpected(err)
+		}
+		if line[0] != '$' {
+			return nil, errors.Wrapf(ErrBadCapture, "line:%q", line)
+		}
+		var size int
+		if size, err = strconv.Atoi(string(line[1 : len(line)-2])); err != nil {
+			return nil, errors.Wrapf(ErrBadCapture, "line:%q", line)
+		}
+		req = append(req, line...)
+		if req, err = r.block(req, size); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (r *Reader) nextMemcache() (req []byte, err error) {
+	line, err := r.line()
+	if err != nil {
+		return
+	}
+	req = append(req, line...)
+	fields := bytes.Fields(line)
+	idx, ok := storageLenIndex[string(fields[0])]
+	if !ok {
+		return
+	}
+	if len(fields) <= idx {
+		return nil, errors.Wrapf(ErrBadCapture, "line:%q", line)
+	}
+	size, err := strconv.Atoi(string(fields[idx]))
+	if err != nil {
+		return nil, errors.Wrapf(ErrBadCapture, "line:%q", line)
+	}
+	return r.block(req, size)
+}
+
+// line reads one line ended with crlf.
+func (r *Reader) line() ([]byte, error) {
+	line, err := r.br.ReadBytes('\n')
+	if err == io.EOF && len(line) == 0 {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, r.unexpected(err)
+	}
+	if len(line) < 3 || !bytes.HasSuffix(line, crlfBytes) {
+		return nil, errors.Wrapf(ErrBadCapture, "line:%q", line)
+	}
+	return line, nil
+}
+
+// block reads the data of size followed by crlf into req.
+func (r *Reader) block(req []byte, size int) ([]byte, error) {
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(r.br, data); err != nil {
+		return nil, r.unexpected(err)
+	}
+	if !bytes.HasSuffix(data, crlfBytes) {
+		return nil, errors.Wrapf(ErrBadCapture, "data:%q", data)
+	}
+	return append(req, data...), nil
+}
+
+func (r *Reader) unexpected(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errors.Wrapf(ErrBadCapture, "unexpected end")
+	}
+	return errors.WithStack(err)
+}
@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyCapture(t *testing.T) {
+	dir, err := ioutil.TempDir("", "capture")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "admin.cap")
+
+	p, _ := _adminProxy("127.0.0.1:6379:1")
+	c, err := p.CaptureState("admin")
+	assert.NoError(t, err)
+	assert.False(t, c.Capturing)
+	assert.Equal(t, ErrAdminCaptureInvalid, errors.Cause(p.StopCapture("admin")))
+	assert.Equal(t, ErrAdminCaptureInvalid, errors.Cause(p.StartCapture("admin", "", time.Second, false)))
+	assert.Equal(t, ErrAdminClusterNotFound, errors.Cause(p.StartCapture("unknown", file, time.Second, false)))
+
+	assert.NoError(t, p.StartCapture("admin", file, time.Hour, true))
+	assert.Equal(t, ErrAdminCaptureInvalid, errors.Cause(p.StartCapture("admin", file+"2", time.Hour, false)), "one capture at a time")
+	h := &Handler{cstat: p.clusterStat("admin")}
+	h.capture(decodeTx(t, "SET a 1\r\nPING\r\nSET b ab\r\n", 3))
+	c, err = p.CaptureState("admin")
+	assert.NoError(t, err)
+	assert.True(t, c.Capturing)
+	assert.True(t, c.KeyOnly)
+
+	assert.NoError(t, p.StopCapture("admin"))
+	data, err := ioutil.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\n1\r\n*3\r\n$3\r\nSET\r\n$1\r\nb\r\n$2\r\nxx\r\n", string(data))
+	assert.Nil(t, h.cstat.capturing())
+}
+
+func TestProxyCaptureHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "capture")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	p, _ := _adminProxy("127.0.0.1:6379:1")
+	h := p.NodesHandler("")
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodPost, "/api/v1/clusters/admin/capture", strings.NewReader(`{"file":"`+filepath.Join(dir, "admin.cap")+`","seconds":60}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, "/api/v1/clusters/admin/capture", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"capturing":true`)
+
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodDelete, "/api/v1/clusters/admin/capture", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodDelete, "/api/v1/clusters/admin/capture", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,364 @@
+package proxy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"overlord/pkg/types"
+
+	"github.com/pkg/errors"
+)
+
+// ConfigError is an error of the config file, located by the key and the
+// line where the key is set.
+type ConfigError struct {
+	File string
+	// Line is 0 if the line is unknown.
+	Line int
+	// Key is the path of the key, such as clusters[1].hash_method.
+	Key string
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	pos := e.File
+	if e.Line > 0 {
+		pos = fmt.Sprintf("%s:%d", pos, e.Line)
+	}
+	if e.Key == "" {
+		return fmt.Sprintf("%s: %v", pos, e.Err)
+	}
+	return fmt.Sprintf("%s: %s: %v", pos, e.Key, e.Err)
+}
+
+// CheckConfig fully validates the proxy config file confFile and the cluster
+// config file clusterConfFile without serving, either is skipped if empty.
+// It reports all the errors found rather than the first one, including the
+// unknown keys which are ignored by loading, each is a *ConfigError.
+func CheckConfig(confFile, clusterConfFile string) (errs []error) {
+	if confFile != "" {
+		errs = append(errs, checkProxyConfig(confFile)...)
+	}
+	if clusterConfFile != "" {
+		errs = append(errs, checkClusterConfig(clusterConfFile)...)
+	}
+	return
+}
+
+func checkProxyConfig(path string) []error {
+	c := &Config{}
+	ki, m, err := readConfig(path, reflect.TypeOf(c))
+	if err != nil {
+		return []error{err}
+	}
+	errs := ki.unknownKeys("", m, reflect.TypeOf(Config{}))
+	if err = ki.decode(c); err != nil {
+		return append(errs, err)
+	}
+	if err = c.Validate(); err != nil {
+		errs = append(errs, ki.locate([]string{"proxy"}, err))
+	}
+	if c.Proxy.ConfigVersions < 0 {
+		errs = append(errs, ki.at("proxy.config_versions", errors.Wrapf(ErrConfInvalid, "config_versions:%d", c.Proxy.ConfigVersions)))
+	}
+	return errs
+}
+
+func checkClusterConfig(path string) []error {
+	cs := &ClusterConfigs{}
+	ki, m, err := readConfig(path, reflect.TypeOf(cs))
+	if err != nil {
+		return []error{err}
+	}
+	errs := ki.unknownKeys("", m, reflect.TypeOf(ClusterConfigs{}))
+	if err = ki.decode(cs); err != nil {
+		return append(errs, err)
+	}
+	var (
+		tables = make([]string, len(cs.Clusters))
+		names  = map[string]string{}
+		ports  = map[string]string{}
+	)
+	for i, cc := range cs.Clusters {
+		tables[i] = fmt.Sprintf("clusters[%d]", i)
+		cc.SetDefault()
+		if err = cc.validateFields(); err != nil {
+			errs = append(errs, ki.locate(tables[i:i+1], err))
+		}
+		errs = append(errs, ki.checkServers(tables[i], cc)...)
+		if cc.Name != "" {
+			if prev, ok := names[cc.Name]; ok {
+				errs = append(errs, ki.at(tables[i]+".name", errors.Wrapf(ErrClusterConfDuplicate, "name:%s is used by %s", cc.Name, prev)))
+			} else {
+				names[cc.Name] = tables[i]
+			}
+		}
+		ipPort := strings.Split(cc.ListenAddr, ":")
+		if len(ipPort) != 2 {
+			errs = append(errs, ki.at(tables[i]+".listen_addr", errors.Wrapf(ErrClusterConfInvalid, "addr:%s", cc.ListenAddr)))
+			continue
+		}
+		if prev, ok := ports[ipPort[1]]; ok {
+			errs = append(errs, ki.at(tables[i]+".listen_addr", errors.Wrapf(ErrClusterConfDuplicate, "addr:%s port is used by %s", cc.ListenAddr, prev)))
+		} else {
+			ports[ipPort[1]] = tables[i]
+		}
+	}
+	if err = validateShadow(cs.Clusters); err != nil {
+		errs = append(errs, ki.locate(tables, err))
+	}
+	if err = validateFallback(cs.Clusters); err != nil {
+		errs = append(errs, ki.locate(tables, err))
+	}
+	return errs
+}
+
+// checkServers checks each server of cc rather than stopping at the first
+// bad one, so that all of them are located.
+func (ki *keyIndex) checkServers(table string, cc *ClusterConfig) (errs []error) {
+	if len(cc.Servers) == 0 {
+		if cc.CacheType != types.CacheTypeRedisCluster && cc.Discovery == "" {
+			errs = append(errs, ki.at(table, errors.Wrapf(ErrClusterConfInvalid, "empty backend server list")))
+		}
+		return
+	}
+	alias := len(strings.Split(cc.Servers[0], " ")) == 2
+	for _, server := range cc.Servers {
+		var err error
+		if cc.CacheType == types.CacheTypeRedisCluster {
+			err = validateSeed(server)
+		} else {
+			err = validateServer(server, alias)
+		}
+		if err != nil {
+			ce := ki.at(table+".servers", err)
+			if line := ki.find(table, `"`+server+`"`); line > 0 {
+				ce.Line = line
+			}
+			errs = append(errs, ce)
+		}
+	}
+	if len(errs) == 0 && cc.CacheType != types.CacheTypeRedisCluster {
+		if err := validateWeights(cc.Servers); err != nil {
+			errs = append(errs, ki.at(table+".servers", err))
+		}
+	}
+	return
+}
+
+var (
+	tomlArrayTable = regexp.MustCompile(`^\[\[\s*([A-Za-z0-9_.-]+)\s*\]\]`)
+	tomlTable      = regexp.MustCompile(`^\[\s*([A-Za-z0-9_.-]+)\s*\]`)
+	tomlKey        = regexp.MustCompile(`^([A-Za-z0-9_-]+)\s*=`)
+)
+
+// keyIndex indexes the lines of the keys and the tables of the toml config,
+// the tables of array are indexed like clusters[0]. The lines of yaml and
+// json are not indexed, so their errors are located by the keys only.
+type keyIndex struct {
+	file   string
+	format string
+	data   []byte
+	lines  []string
+	keys   map[string]int
+}
+
+// readConfig reads the config file of path, and decodes it into the map of
+// keys for the fields of t.
+func readConfig(path string, t reflect.Type) (ki *keyIndex, m map[string]interface{}, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, &ConfigError{File: path, Err: err}
+	}
+	ki = &keyIndex{file: path, format: configFormat(path), data: data, keys: map[string]int{}}
+	if ki.format == formatTOML {
+		ki.index()
+	}
+	if m, err = genericConfig(ki.format, data, t); err != nil {
+		return nil, nil, &ConfigError{File: path, Err: err}
+	}
+	return
+}
+
+// decode decodes the config into v, expands the environment variables and
+// applies the overrides, the same as loading.
+func (ki *keyIndex) decode(v interface{}) error {
+	err := decodeConfig(ki.format, ki.data, v)
+	if err == nil {
+		err = expandEnv(reflect.ValueOf(v))
+	}
+	if err == nil {
+		err = ApplyOverrides(v)
+	}
+	if err != nil {
+		return &ConfigError{File: ki.file, Err: err}
+	}
+	return nil
+}
+
+// index indexes the lines of toml.
+func (ki *keyIndex) index() {
+	ki.lines = strings.Split(string(ki.data), "\n")
+	var (
+		table     string
+		arrays    = map[string]int{}
+		multiline string
+	)
+	for i, line := range ki.lines {
+		line = strings.TrimSpace(line)
+		if multiline != "" {
+			// NOTE: skip the content of multi-line strings.
+			if strings.Count(line, multiline)%2 == 1 {
+				multiline = ""
+			}
+			continue
+		}
+		if sm := tomlArrayTable.FindStringSubmatch(line); sm != nil {
+			table = fmt.Sprintf("%s[%d]", sm[1], arrays[sm[1]])
+			arrays[sm[1]]++
+			ki.keys[table] = i + 1
+		} else if sm = tomlTable.FindStringSubmatch(line); sm != nil {
+			table = sm[1]
+			ki.keys[table] = i + 1
+		} else if sm = tomlKey.FindStringSubmatch(line); sm != nil {
+			ki.keys[ki.path(table, sm[1])] = i + 1
+		}
+		for _, quote := range []string{`"""`, `'''`} {
+			if strings.Count(line, quote)%2 == 1 {
+				multiline = quote
+			}
+		}
+	}
+}
+
+func (ki *keyIndex) path(table, key string) string {
+	if table == "" {
+		return key
+	}
+	return table + "." + key
+}
+
+// at returns the error of key located by its line, or the line of its table
+// if the key is not set.
+func (ki *keyIndex) at(key string, err error) *ConfigError {
+	line, ok := ki.keys[key]
+	if !ok {
+		if idx := strings.LastIndexByte(key, '.'); idx > 0 {
+			line = ki.keys[key[:idx]]
+		}
+	}
+	return &ConfigError{File: ki.file, Line: line, Key: key, Err: err}
+}
+
+// find returns the line of the first one contains s in table, 0 if not found.
+func (ki *keyIndex) find(table, s string) int {
+	start, ok := ki.keys[table]
+	if !ok {
+		return 0
+	}
+	for i := start; i < len(ki.lines); i++ {
+		line := strings.TrimSpace(ki.lines[i])
+		if strings.HasPrefix(line, "[") && (tomlTable.MatchString(line) || tomlArrayTable.MatchString(line)) {
+			break
+		}
+		if strings.Contains(line, s) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// locate locates the validation error err in tables. The error is like
+// "hash_method:xxx: cluster config is invalid", so the key is the leading
+// key of the table, or of the first table where it's set to the value.
+func (ki *keyIndex) locate(tables []string, err error) *ConfigError {
+	msg := err.Error()
+	key, val := msg, ""
+	if idx := strings.IndexByte(msg, ':'); idx > 0 {
+		key, val = msg[:idx], msg[idx+1:]
+		if idx = strings.IndexByte(val, ':'); idx >= 0 {
+			val = val[:idx]
+		}
+	}
+	for _, table := range tables {
+		line, ok := ki.keys[ki.path(table, key)]
+		if ok && (len(tables) == 1 || strings.Contains(ki.lines[line-1], val)) {
+			return &ConfigError{File: ki.file, Line: line, Key: ki.path(table, key), Err: err}
+		}
+	}
+	if len(tables) == 1 {
+		return &ConfigError{File: ki.file, Line: ki.keys[tables[0]], Key: tables[0], Err: err}
+	}
+	return &ConfigError{File: ki.file, Err: err}
+}
+
+// unknownKeys returns the errors of the keys in m which are not the fields
+// of t, they are ignored by decoding silently.
+func (ki *keyIndex) unknownKeys(table string, m map[string]interface{}, t reflect.Type) (errs []error) {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		path := ki.path(table, key)
+		ft, ok := tomlField(t, key)
+		if !ok {
+			errs = append(errs, ki.at(path, errors.Wrapf(ErrConfInvalid, "unknown key")))
+			continue
+		}
+		for ft.Kind() == reflect.Ptr || ft.Kind() == reflect.Slice {
+			ft = ft.Elem()
+		}
+		if ft.Kind() != reflect.Struct {
+			continue
+		}
+		switch v := m[key].(type) {
+		case map[string]interface{}:
+			errs = append(errs, ki.unknownKeys(path, v, ft)...)
+		case []map[string]interface{}:
+			for i, sub := range v {
+				errs = append(errs, ki.unknownKeys(fmt.Sprintf("%s[%d]", path, i), sub, ft)...)
+			}
+		case []interface{}:
+			for i, sub := range v {
+				if sm, ok := sub.(map[string]interface{}); ok {
+					errs = append(errs, ki.unknownKeys(fmt.Sprintf("%s[%d]", path, i), sm, ft)...)
+				}
+			}
+		}
+	}
+	return
+}
+
+// tomlField returns the type of the field of struct t which key is decoded
+// into, the same as toml matches the tag or the name case-insensitively.
+func tomlField(t reflect.Type, key string) (reflect.Type, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if sub, ok := tomlField(ft, key); ok {
+					return sub, true
+				}
+				continue
+			}
+		}
+		name := f.Tag.Get("toml")
+		if name == "" {
+			name = f.Name
+		}
+		if strings.EqualFold(name, key) {
+			return f.Type, true
+		}
+	}
+	return nil, false
+}
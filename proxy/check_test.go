@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const badCluster = `
+[[clusters]]
+name = "mc"
+hash_method = "fnv1a_64"
+hash_methd = "crc32"
+cache_type = "memcache"
+listen_addr = "0.0.0.0:21211"
+servers = [
+    "127.0.0.1:11211:1",
+    "127.0.0.1:11212",
+]
+
+[[clusters]]
+name = "mc"
+hash_distribution = "maglev"
+cache_type = "memcache"
+listen_addr = "0.0.0.0:21211"
+servers = ["127.0.0.1:11213:1"]
+
+[[clusters]]
+name = "rc"
+cache_type = "redis_cluster"
+listen_addr = "0.0.0.0:27000"
+servers = ["127.0.0.1:7000:1 abc", "127.0.0.1"]
+`
+
+func writeConf(t *testing.T, dir, name, data string) string {
+	path := filepath.Join(dir, name)
+	assert.NoError(t, ioutil.WriteFile(path, []byte(data), 0644))
+	return path
+}
+
+func TestCheckConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overlord-check")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ok := writeConf(t, dir, "ok.toml", exampleCluster)
+	conf := writeConf(t, dir, "proxy.toml", defaultConfig)
+	assert.Empty(t, CheckConfig(conf, ok))
+
+	bad := writeConf(t, dir, "bad.toml", badCluster)
+	var msgs []string
+	for _, err := range CheckConfig("", bad) {
+		msgs = append(msgs, err.Error())
+	}
+	assert.Equal(t, []string{
+		bad + ":5: clusters[0].hash_methd: unknown key: config is invalid",
+		bad + ":10: clusters[0].servers: server:127.0.0.1:11212: cluster config is invalid",
+		bad + ":15: clusters[1].hash_distribution: hash_distribution:maglev: cluster config is invalid",
+		bad + ":14: clusters[1].name: name:mc is used by clusters[0]: cluster config is duplicate",
+		bad + ":17: clusters[1].listen_addr: addr:0.0.0.0:21211 port is used by clusters[0]: cluster config is duplicate",
+		bad + ":24: clusters[2].servers: server:127.0.0.1: cluster config is invalid",
+	}, msgs)
+
+	conf = writeConf(t, dir, "bad-proxy.toml", "stat = \"0.0.0.0:2110\"\n[proxy]\nread_timeout = 10\nlatency_buckets = [10, 5]\nmax_conns = 10\n")
+	msgs = msgs[:0]
+	for _, err := range CheckConfig(conf, "") {
+		msgs = append(msgs, err.Error())
+	}
+	assert.Equal(t, []string{
+		conf + ":5: proxy.max_conns: unknown key: config is invalid",
+		conf + ":4: proxy.latency_buckets: latency_buckets:[10 5] must be positive and increasing: config is invalid",
+	}, msgs)
+
+	errs := CheckConfig(filepath.Join(dir, "missing.toml"), "")
+	assert.Len(t, errs, 1)
+	bad = writeConf(t, dir, "syntax.toml", "[[clusters]]\nname = \n")
+	errs = CheckConfig("", bad)
+	assert.Len(t, errs, 1)
+}
@@ -0,0 +1,353 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	errs "errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"overlord/pkg/conv"
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/redis"
+)
+
+// errors
+var (
+	ErrClientKilled = errs.New("client killed")
+)
+
+var (
+	crlfBytes       = []byte("\r\n")
+	clientInfoBytes = []byte("4\r\nINFO")
+	clientListBytes = []byte("4\r\nLIST")
+	clientKillBytes = []byte("4\r\nKILL")
+	clientIDBytes   = []byte("2\r\nID")
+	clientSetName   = []byte("7\r\nSETNAME")
+	clientGetName   = []byte("7\r\nGETNAME")
+
+	clientKillAddr   = "ADDR"
+	clientKillID     = "ID"
+	clientKillSkipme = "SKIPME"
+
+	clientOkBytes       = []byte("OK")
+	clientNotFoundBytes = []byte("ERR no such client")
+	clientNotSupport    = []byte("Error: CLIENT subcommand not support")
+	clientSyntaxErr     = []byte("ERR syntax error")
+	clientNameErr       = []byte("ERR Client names cannot contain spaces, newlines or special characters.")
+)
+
+// ClientInfo is the diagnostics of a client connection.
+type ClientInfo struct {
+	ID      int64  `json:"id"`
+	Addr    string `json:"addr"`
+	Cluster string `json:"cluster"`
+	Name    string `json:"name"`
+	// Age and Idle are seconds since connected and last command.
+	Age      int64   `json:"age"`
+	Idle     int64   `json:"idle"`
+	Commands int64   `json:"commands"`
+	QPS      float64 `json:"qps"`
+	Pending  int32   `json:"pending"`
+	LastCmd  string  `json:"last_cmd"`
+	// ReadBuf is the allocated size of read buffer and WriteBuf is the
+	// bytes of last replies waiting to be flushed.
+	ReadBuf  int32 `json:"read_buf"`
+	WriteBuf int32 `json:"write_buf"`
+}
+
+// String formats info as line of redis CLIENT LIST.
+func (ci *ClientInfo) String() string {
+	return fmt.Sprintf("id=%d addr=%s cluster=%s name=%s age=%d idle=%d cmds=%d qps=%.2f pending=%d cmd=%s rbuf=%d wbuf=%d",
+		ci.ID, ci.Addr, ci.Cluster, ci.Name, ci.Age, ci.Idle, ci.Commands, ci.QPS, ci.Pending, ci.LastCmd, ci.ReadBuf, ci.WriteBuf)
+}
+
+// clientStat is updated by the handler goroutine and read by admin query.
+type clientStat struct {
+	start      time.Time
+	lastActive int64
+	cmds       int64
+	pending    int32
+	rbuf, wbuf int32
+	lastCmd    atomic.Value
+	name       atomic.Value
+}
+
+func (cs *clientStat) decoded(msgs []*proto.Message) {
+	if len(msgs) == 0 {
+		return
+	}
+	atomic.StoreInt64(&cs.lastActive, time.Now().UnixNano())
+	atomic.AddInt64(&cs.cmds, int64(len(msgs)))
+	atomic.StoreInt32(&cs.pending, int32(len(msgs)))
+	if req := msgs[len(msgs)-1].Request(); req != nil {
+		cs.lastCmd.Store(req.CmdString())
+	}
+}
+
+func (cs *clientStat) buffered(pc proto.ProxyConn) {
+	if bs, ok := pc.(proto.BufferSizer); ok {
+		rbuf, wbuf := bs.BufferSizes()
+		atomic.StoreInt32(&cs.rbuf, int32(rbuf))
+		atomic.StoreInt32(&cs.wbuf, int32(wbuf))
+	}
+}
+
+func (cs *clientStat) flushed() {
+	atomic.StoreInt32(&cs.pending, 0)
+}
+
+func (h *Handler) info() *ClientInfo {
+	now := time.Now()
+	ci := &ClientInfo{
+		ID:       h.id,
+		Addr:     h.addr,
+		Cluster:  h.cc.Name,
+		Age:      int64(now.Sub(h.stat.start) / time.Second),
+		Commands: atomic.LoadInt64(&h.stat.cmds),
+		Pending:  atomic.LoadInt32(&h.stat.pending),
+		ReadBuf:  atomic.LoadInt32(&h.stat.rbuf),
+		WriteBuf: atomic.LoadInt32(&h.stat.wbuf),
+	}
+	if last := atomic.LoadInt64(&h.stat.lastActive); last > 0 {
+		ci.Idle = int64(now.Sub(time.Unix(0, last)) / time.Second)
+	} else {
+		ci.Idle = ci.Age
+	}
+	if alive := now.Sub(h.stat.start).Seconds(); alive > 0 {
+		ci.QPS = float64(ci.Commands) / alive
+	}
+	if cmd, ok := h.stat.lastCmd.Load().(string); ok {
+		ci.LastCmd = cmd
+	}
+	if name, ok := h.stat.name.Load().(string); ok {
+		ci.Name = name
+	}
+	return ci
+}
+
+func (p *Proxy) addClient(h *Handler) {
+	p.clientLock.Lock()
+	if p.clients == nil {
+		p.clients = map[string]*Handler{}
+	}
+	p.clients[h.addr] = h
+	p.clientLock.Unlock()
+}
+
+func (p *Proxy) delClient(h *Handler) {
+	p.clientLock.Lock()
+	if p.clients[h.addr] == h {
+		delete(p.clients, h.addr)
+	}
+	p.clientLock.Unlock()
+}
+
+// Clients returns the diagnostics of the client with addr, or all the
+// clients of cluster when addr is empty, and all clients of proxy when
+// both are empty.
+func (p *Proxy) Clients(cluster, addr string) (cis []*ClientInfo) {
+	p.clientLock.RLock()
+	defer p.clientLock.RUnlock()
+	if addr != "" {
+		if h, ok := p.clients[addr]; ok {
+			cis = append(cis, h.info())
+		}
+		return
+	}
+	for _, h := range p.clients {
+		if cluster == "" || h.cc.Name == cluster {
+			cis = append(cis, h.info())
+		}
+	}
+	sort.Slice(cis, func(i, j int) bool { return cis[i].Addr < cis[j].Addr })
+	return
+}
+
+// KillClient closes the client with addr of cluster, any cluster if empty.
+// It returns false if the client is not found.
+func (p *Proxy) KillClient(cluster, addr string) bool {
+	p.clientLock.RLock()
+	h, ok := p.clients[addr]
+	p.clientLock.RUnlock()
+	if !ok || (cluster != "" && h.cc.Name != cluster) {
+		return false
+	}
+	h.closeWithError(ErrClientKilled)
+	return true
+}
+
+// ServeClients will show clients diagnostics to http by query cluster and addr,
+// the client of addr is closed by DELETE.
+func (p *Proxy) ServeClients(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+	if req.Method == http.MethodDelete {
+		if !p.KillClient(q.Get("cluster"), q.Get("addr")) {
+			http.Error(w, string(clientNotFoundBytes), http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+		return
+	}
+	cis := p.Clients(q.Get("cluster"), q.Get("addr"))
+	if q.Get("addr") != "" && len(cis) == 0 {
+		http.Error(w, string(clientNotFoundBytes), http.StatusNotFound)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(cis); err != nil {
+		http.Error(w, fmt.Sprintf("%s", err), http.StatusInternalServerError)
+	}
+}
+
+// replyClient answers CLIENT INFO [addr], CLIENT LIST, CLIENT KILL, CLIENT ID
+// and CLIENT SETNAME/GETNAME of redis by the clients of the same cluster.
+func (h *Handler) replyClient(msg *proto.Message) {
+	if msg.IsBatch() {
+		return
+	}
+	req, ok := msg.Request().(*redis.Request)
+	if !ok || !req.IsClient() {
+		return
+	}
+	args := req.RESP().Array()
+	if len(args) < 2 {
+		req.Reply().SetError(clientNotSupport)
+		return
+	}
+	conv.UpdateToUpper(args[1].Data())
+	var cis []*ClientInfo
+	if bytes.Equal(args[1].Data(), clientInfoBytes) {
+		addr := h.addr
+		if len(args) > 2 {
+			addr = string(bulkData(args[2].Data()))
+		}
+		cis = h.p.Clients(h.cc.Name, addr)
+		if len(cis) == 0 || cis[0].Cluster != h.cc.Name {
+			req.Reply().SetError(clientNotFoundBytes)
+			return
+		}
+	} else if bytes.Equal(args[1].Data(), clientListBytes) {
+		cis = h.p.Clients(h.cc.Name, "")
+	} else if bytes.Equal(args[1].Data(), clientKillBytes) {
+		h.replyClientKill(req, args[2:])
+		return
+	} else if bytes.Equal(args[1].Data(), clientIDBytes) {
+		req.Reply().SetInt(h.id)
+		return
+	} else if bytes.Equal(args[1].Data(), clientSetName) {
+		h.replyClientSetName(req, args[2:])
+		return
+	} else if bytes.Equal(args[1].Data(), clientGetName) {
+		if name, ok := h.stat.name.Load().(string); ok && name != "" {
+			req.Reply().SetBulk([]byte(name))
+		} else {
+			req.Reply().SetNullBulk()
+		}
+		return
+	} else {
+		req.Reply().SetError(clientNotSupport)
+		return
+	}
+	var buf bytes.Buffer
+	for _, ci := range cis {
+		buf.WriteString(ci.String())
+		buf.WriteByte('\n')
+	}
+	req.Reply().SetBulk(buf.Bytes())
+}
+
+// bulkData trims the length prefix of bulk resp data.
+func bulkData(data []byte) []byte {
+	if idx := bytes.Index(data, crlfBytes); idx >= 0 {
+		return data[idx+2:]
+	}
+	return data
+}
+
+// replyClientSetName answers CLIENT SETNAME name, the name is removed if
+// empty and the names with spaces or special characters are rejected like
+// redis.
+func (h *Handler) replyClientSetName(req *redis.Request, args []*redis.RESP) {
+	if len(args) != 1 {
+		req.Reply().SetError(clientSyntaxErr)
+		return
+	}
+	name := bulkData(args[0].Data())
+	for _, c := range name {
+		if c < '!' || c > '~' {
+			req.Reply().SetError(clientNameErr)
+			return
+		}
+	}
+	h.stat.name.Store(string(name))
+	req.Reply().SetString(clientOkBytes)
+}
+
+// replyClientKill answers CLIENT KILL addr by OK, and CLIENT KILL with
+// filters ADDR, ID and SKIPME by the number of killed clients. The client
+// killing itself is closed after replied.
+func (h *Handler) replyClientKill(req *redis.Request, args []*redis.RESP) {
+	if len(args) == 1 {
+		addr := string(bulkData(args[0].Data()))
+		if addr == h.addr {
+			h.killed = true
+		} else if !h.p.KillClient(h.cc.Name, addr) {
+			req.Reply().SetError(clientNotFoundBytes)
+			return
+		}
+		req.Reply().SetString(clientOkBytes)
+		return
+	}
+	if len(args) == 0 || len(args)%2 != 0 {
+		req.Reply().SetError(clientSyntaxErr)
+		return
+	}
+	var (
+		addr   string
+		id     int64
+		skipme = true
+		err    error
+	)
+	for i := 0; i < len(args); i += 2 {
+		val := string(bulkData(args[i+1].Data()))
+		switch strings.ToUpper(string(bulkData(args[i].Data()))) {
+		case clientKillAddr:
+			addr = val
+		case clientKillID:
+			if id, err = strconv.ParseInt(val, 10, 64); err != nil || id <= 0 {
+				req.Reply().SetError(clientSyntaxErr)
+				return
+			}
+		case clientKillSkipme:
+			skipme = strings.ToLower(val) != "no"
+		default:
+			req.Reply().SetError(clientSyntaxErr)
+			return
+		}
+	}
+	var killed []*Handler
+	h.p.clientLock.RLock()
+	for _, c := range h.p.clients {
+		if c.cc.Name != h.cc.Name || (addr != "" && c.addr != addr) || (id != 0 && c.id != id) {
+			continue
+		}
+		if c == h && skipme {
+			continue
+		}
+		killed = append(killed, c)
+	}
+	h.p.clientLock.RUnlock()
+	for _, c := range killed {
+		if c == h {
+			h.killed = true
+		} else {
+			c.closeWithError(ErrClientKilled)
+		}
+	}
+	req.Reply().SetInt(int64(len(killed)))
+}
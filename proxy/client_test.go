@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"overlord/pkg/mockconn"
+	libnet "overlord/pkg/net"
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/redis"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientsInfoOk(t *testing.T) {
+	p := &Proxy{}
+	cc := &ClusterConfig{Name: "test-cluster"}
+	h := &Handler{p: p, cc: cc, addr: "127.0.0.1:12345"}
+	h.stat.start = time.Now().Add(-2 * time.Second)
+	p.addClient(h)
+	other := &Handler{p: p, cc: &ClusterConfig{Name: "other"}, addr: "127.0.0.1:23456"}
+	other.stat.start = time.Now()
+	p.addClient(other)
+
+	conn := libnet.NewConn(mockconn.CreateConn([]byte("*2\r\n$3\r\nGET\r\n$1\r\na\r\n"), 1), time.Second, time.Second)
+	pc := redis.NewProxyConn(conn, true)
+	msgs, err := pc.Decode(proto.GetMsgs(2))
+	assert.NoError(t, err)
+	h.stat.decoded(msgs)
+	h.stat.buffered(pc)
+
+	cis := p.Clients("", "127.0.0.1:12345")
+	assert.Len(t, cis, 1)
+	assert.Equal(t, "test-cluster", cis[0].Cluster)
+	assert.Equal(t, int64(1), cis[0].Commands)
+	assert.Equal(t, int32(1), cis[0].Pending)
+	assert.Equal(t, "GET", cis[0].LastCmd)
+	assert.True(t, cis[0].ReadBuf > 0)
+	assert.True(t, cis[0].QPS > 0)
+
+	h.stat.flushed()
+	assert.Equal(t, int32(0), p.Clients("", "127.0.0.1:12345")[0].Pending)
+	assert.Len(t, p.Clients("", ""), 2)
+	assert.Len(t, p.Clients("other", ""), 1)
+
+	p.delClient(other)
+	assert.Len(t, p.Clients("", ""), 1)
+}
+
+func TestClientReplyInfo(t *testing.T) {
+	p := &Proxy{}
+	h := &Handler{p: p, cc: &ClusterConfig{Name: "test-cluster"}, addr: "127.0.0.1:12345"}
+	h.stat.start = time.Now()
+	p.addClient(h)
+
+	mconn, buf := mockconn.CreateDownStreamConn()
+	wpc := redis.NewProxyConn(libnet.NewConn(mconn, time.Second, time.Second), true)
+	for _, cmd := range []string{"client info", "client list", "client info 127.0.0.1:1", "client pause 10"} {
+		rpc := redis.NewProxyConn(libnet.NewConn(mockconn.CreateConn([]byte(cmd+"\r\n"), 1), time.Second, time.Second), true)
+		msgs, err := rpc.Decode(proto.GetMsgs(1))
+		assert.NoError(t, err)
+		h.replyClient(msgs[0])
+		assert.NoError(t, wpc.Encode(msgs[0]))
+	}
+	assert.NoError(t, wpc.Flush())
+
+	replies := buf.String()
+	assert.Equal(t, 2, strings.Count(replies, "addr=127.0.0.1:12345 cluster=test-cluster"))
+	assert.Contains(t, replies, "-ERR no such client\r\n")
+	assert.Contains(t, replies, "-Error: CLIENT subcommand not support\r\n")
+}
+
+func TestClientReplyName(t *testing.T) {
+	p := &Proxy{}
+	h := &Handler{p: p, cc: &ClusterConfig{Name: "test-cluster"}, id: 7, addr: "127.0.0.1:12345"}
+	h.stat.start = time.Now()
+	p.addClient(h)
+
+	mconn, buf := mockconn.CreateDownStreamConn()
+	wpc := redis.NewProxyConn(libnet.NewConn(mconn, time.Second, time.Second), true)
+	for _, cmd := range []string{"client getname", "client setname worker-1", "client getname", "client id", "client setname", "*3\r\n$6\r\nclient\r\n$7\r\nsetname\r\n$3\r\na b"} {
+		rpc := redis.NewProxyConn(libnet.NewConn(mockconn.CreateConn([]byte(cmd+"\r\n"), 1), time.Second, time.Second), true)
+		msgs, err := rpc.Decode(proto.GetMsgs(1))
+		assert.NoError(t, err)
+		h.replyClient(msgs[0])
+		assert.NoError(t, wpc.Encode(msgs[0]))
+	}
+	assert.NoError(t, wpc.Flush())
+	assert.Equal(t, "$-1\r\n+OK\r\n$8\r\nworker-1\r\n:7\r\n-ERR syntax error\r\n-"+string(clientNameErr)+"\r\n", buf.String())
+	assert.Equal(t, "worker-1", p.Clients("", "127.0.0.1:12345")[0].Name)
+}
+
+func newKillHandler(p *Proxy, id int64, addr string) *Handler {
+	h := &Handler{p: p, cc: &ClusterConfig{Name: "test-cluster"}, id: id, addr: addr}
+	h.conn = libnet.NewConn(mockconn.CreateConn(nil, 1), time.Second, time.Second)
+	h.stat.start = time.Now()
+	p.addClient(h)
+	return h
+}
+
+func TestClientReplyKill(t *testing.T) {
+	p := &Proxy{}
+	h := newKillHandler(p, 1, "127.0.0.1:12345")
+	newKillHandler(p, 2, "127.0.0.1:12346")
+	newKillHandler(p, 3, "127.0.0.1:12347")
+
+	mconn, buf := mockconn.CreateDownStreamConn()
+	wpc := redis.NewProxyConn(libnet.NewConn(mconn, time.Second, time.Second), true)
+	for _, cmd := range []string{"client kill 127.0.0.1:12346", "client kill 127.0.0.1:1", "client kill id 3 skipme yes", "client kill id 2 skipme", "client kill addr 127.0.0.1:12345 skipme yes"} {
+		rpc := redis.NewProxyConn(libnet.NewConn(mockconn.CreateConn([]byte(cmd+"\r\n"), 1), time.Second, time.Second), true)
+		msgs, err := rpc.Decode(proto.GetMsgs(1))
+		assert.NoError(t, err)
+		h.replyClient(msgs[0])
+		assert.NoError(t, wpc.Encode(msgs[0]))
+	}
+	assert.NoError(t, wpc.Flush())
+	assert.Equal(t, "+OK\r\n-ERR no such client\r\n:1\r\n-ERR syntax error\r\n:0\r\n", buf.String())
+	assert.Len(t, p.Clients("", ""), 1)
+	assert.False(t, h.killed)
+
+	rpc := redis.NewProxyConn(libnet.NewConn(mockconn.CreateConn([]byte("client kill 127.0.0.1:12345\r\n"), 1), time.Second, time.Second), true)
+	msgs, err := rpc.Decode(proto.GetMsgs(1))
+	assert.NoError(t, err)
+	h.replyClient(msgs[0])
+	assert.True(t, h.killed)
+}
+
+func TestServeClientsKill(t *testing.T) {
+	p := &Proxy{}
+	newKillHandler(p, 1, "127.0.0.1:12345")
+
+	w := httptest.NewRecorder()
+	p.ServeClients(w, httptest.NewRequest(http.MethodDelete, "/clients?cluster=other&addr=127.0.0.1:12345", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	p.ServeClients(w, httptest.NewRequest(http.MethodDelete, "/clients?addr=127.0.0.1:12345", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", w.Body.String())
+	assert.Len(t, p.Clients("", ""), 0)
+	assert.False(t, p.KillClient("", "127.0.0.1:12345"))
+}
@@ -4,11 +4,15 @@ import (
 	errs "errors"
 	"fmt"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 
+	"overlord/pkg/hashkit"
 	"overlord/pkg/log"
 	"overlord/pkg/types"
+	"overlord/proxy/proto/memcache"
+	rclstr "overlord/proxy/proto/redis/cluster"
 
 	"github.com/BurntSushi/toml"
 	"github.com/Pallinder/go-randomdata"
@@ -17,6 +21,7 @@ import (
 
 // errs
 var (
+	ErrConfInvalid          = errs.New("config is invalid")
 	ErrClusterConfInvalid   = errs.New("cluster config is invalid")
 	ErrClusterConfDuplicate = errs.New("cluster config is duplicate")
 )
@@ -26,10 +31,19 @@ type Config struct {
 	Stat string
 	*log.Config
 	Proxy struct {
-		ReadTimeout    int   `toml:"read_timeout"`
-		WriteTimeout   int   `toml:"write_timeout"`
-		MaxConnections int32 `toml:"max_connections"`
-		UseMetrics     bool  `toml:"use_metrics"`
+		ReadTimeout    int       `toml:"read_timeout"`
+		WriteTimeout   int       `toml:"write_timeout"`
+		MaxConnections int32     `toml:"max_connections"`
+		UseMetrics     bool      `toml:"use_metrics"`
+		LatencyBuckets []float64 `toml:"latency_buckets"`
+		SizeBuckets    []float64 `toml:"size_buckets"`
+		BatchBuckets   []float64 `toml:"batch_buckets"`
+		AdminToken     string    `toml:"admin_token"`
+		// ConfigVersions is the applied config versions kept of each cluster
+		// for rollback, ConfigVersionsDir is where they are saved to survive
+		// restart, empty means in memory only.
+		ConfigVersions    int    `toml:"config_versions"`
+		ConfigVersionsDir string `toml:"config_versions_dir"`
 	}
 }
 
@@ -45,11 +59,11 @@ func DefaultConfig() *Config {
 	return c
 }
 
-// LoadFromFile load from file.
+// LoadFromFile load from file, toml by default, yaml or json by the
+// extension, and ${VAR} in the values are expanded by the environment.
 func (c *Config) LoadFromFile(path string) error {
-	_, err := toml.DecodeFile(path, c)
-	if err != nil {
-		return errors.Wrapf(err, "Load From File:%s", path)
+	if err := decodeFile(path, c); err != nil {
+		return err
 	}
 	return c.Validate()
 }
@@ -57,28 +71,113 @@ func (c *Config) LoadFromFile(path string) error {
 // Validate validate config field value.
 func (c *Config) Validate() error {
 	// TODO(felix): complete validates
+	for name, buckets := range map[string][]float64{
+		"latency_buckets": c.Proxy.LatencyBuckets,
+		"size_buckets":    c.Proxy.SizeBuckets,
+		"batch_buckets":   c.Proxy.BatchBuckets,
+	} {
+		for i, b := range buckets {
+			if b <= 0 || (i > 0 && b <= buckets[i-1]) {
+				return errors.Wrapf(ErrConfInvalid, "%s:%v must be positive and increasing", name, buckets)
+			}
+		}
+	}
 	return nil
 }
 
 // ClusterConfig cluster config.
 type ClusterConfig struct {
-	Name              string
-	HashMethod        string          `toml:"hash_method"`
-	HashDistribution  string          `toml:"hash_distribution"`
-	HashTag           string          `toml:"hash_tag"`
-	CacheType         types.CacheType `toml:"cache_type"`
-	ListenProto       string          `toml:"listen_proto"`
-	ListenAddr        string          `toml:"listen_addr"`
-	RedisAuth         string          `toml:"redis_auth"`
-	DialTimeout       int             `toml:"dial_timeout"`
-	ReadTimeout       int             `toml:"read_timeout"`
-	WriteTimeout      int             `toml:"write_timeout"`
-	NodeConnections   int32           `toml:"node_connections"`
-	NodePipeCount     int             `toml:"node_pipe_count"`
-	PingFailLimit     int             `toml:"ping_fail_limit"`
-	PingAutoEject     bool            `toml:"ping_auto_eject"`
-	SlowlogSlowerThan int             `toml:"slowlog_slower_than"`
-	Servers           []string        `toml:"servers"`
+	Name                   string
+	HashMethod             string          `toml:"hash_method"`
+	HashDistribution       string          `toml:"hash_distribution"`
+	HashTag                string          `toml:"hash_tag"`
+	CacheType              types.CacheType `toml:"cache_type"`
+	BackendType            types.CacheType `toml:"backend_type"`
+	BackendFlags           string          `toml:"backend_flags"`
+	ListenProto            string          `toml:"listen_proto"`
+	ListenAddr             string          `toml:"listen_addr"`
+	TLSCert                string          `toml:"tls_cert"`
+	TLSKey                 string          `toml:"tls_key"`
+	TLSMinVersion          string          `toml:"tls_min_version"`
+	TLSCiphers             []string        `toml:"tls_ciphers"`
+	TLSALPN                []string        `toml:"tls_alpn"`
+	Auth                   string          `toml:"auth"`
+	RedisAuth              string          `toml:"redis_auth"`
+	DB                     int             `toml:"db"`
+	QuietBatch             bool            `toml:"quiet_batch"`
+	HotKeyThreshold        int             `toml:"hotkey_threshold"`
+	HotKeyTTL              int             `toml:"hotkey_ttl"`
+	HotKeyMaxMemory        int             `toml:"hotkey_max_memory"`
+	RateLimitRead          int             `toml:"ratelimit_read"`
+	RateLimitWrite         int             `toml:"ratelimit_write"`
+	RateLimitPrefixes      []string        `toml:"ratelimit_prefixes"`
+	RateLimitError         string          `toml:"ratelimit_error"`
+	AllowedCommands        []string        `toml:"allowed_commands"`
+	ForbiddenCommands      []string        `toml:"forbidden_commands"`
+	DialTimeout            int             `toml:"dial_timeout"`
+	ReadTimeout            int             `toml:"read_timeout"`
+	WriteTimeout           int             `toml:"write_timeout"`
+	NodeConnections        int32           `toml:"node_connections"`
+	NodePipeCount          int             `toml:"node_pipe_count"`
+	NodeMaxConnections     int32           `toml:"node_max_connections"`
+	NodeIdleTimeout        int             `toml:"node_idle_timeout"`
+	NodeWaitQueue          int             `toml:"node_wait_queue"`
+	NodeBatchCount         int             `toml:"node_batch_count"`
+	NodeBatchWait          int             `toml:"node_batch_wait"`
+	NodeWorkers            int             `toml:"node_workers"`
+	PingFailLimit          int             `toml:"ping_fail_limit"`
+	PingAutoEject          bool            `toml:"ping_auto_eject"`
+	PingInterval           int             `toml:"ping_interval"`
+	ServerRetryTimeout     int             `toml:"server_retry_timeout"`
+	RetryTimes             int             `toml:"retry_times"`
+	RetryBackoff           int             `toml:"retry_backoff"`
+	Partial                string          `toml:"partial"`
+	BreakerErrors          int             `toml:"breaker_errors"`
+	BreakerSlow            int             `toml:"breaker_slow"`
+	BreakerTimeout         int             `toml:"breaker_timeout"`
+	MaxInflight            int             `toml:"max_inflight"`
+	InflightQueue          int             `toml:"inflight_queue"`
+	InflightQueueTimeout   int             `toml:"inflight_queue_timeout"`
+	ReadTimeoutFactor      float64         `toml:"read_timeout_factor"`
+	ReadTimeoutMin         int             `toml:"read_timeout_min"`
+	ReadTimeoutMax         int             `toml:"read_timeout_max"`
+	FaultLatency           int             `toml:"fault_latency"`
+	FaultLatencyRate       float64         `toml:"fault_latency_rate"`
+	FaultResetRate         float64         `toml:"fault_reset_rate"`
+	FaultCorruptRate       float64         `toml:"fault_corrupt_rate"`
+	HedgePercentile        int             `toml:"hedge_percentile"`
+	HedgeMinDelay          int             `toml:"hedge_min_delay"`
+	BlockingMaxConns       int             `toml:"blocking_max_conns"`
+	ShadowCluster          string          `toml:"shadow_cluster"`
+	ShadowMaxPending       int             `toml:"shadow_max_pending"`
+	MirrorCluster          string          `toml:"mirror_cluster"`
+	MirrorPercent          int             `toml:"mirror_percent"`
+	MirrorCommands         string          `toml:"mirror_commands"`
+	MirrorMaxPending       int             `toml:"mirror_max_pending"`
+	FallbackCluster        string          `toml:"fallback_cluster"`
+	FallbackTTL            int             `toml:"fallback_ttl"`
+	BlockingTimeoutMargin  int             `toml:"blocking_timeout_margin"`
+	ClusterRefreshInterval int             `toml:"cluster_refresh_interval"`
+	ReadPreference         string          `toml:"read_preference"`
+	SlowlogSlowerThan      int             `toml:"slowlog_slower_than"`
+	AccessLogSampleRate    float64         `toml:"access_log_sample_rate"`
+	TraceSampleRate        float64         `toml:"trace_sample_rate"`
+	MetricsPrefixDelims    string          `toml:"metrics_prefix_delimiters"`
+	MetricsPrefixRegex     string          `toml:"metrics_prefix_regex"`
+	MetricsPrefixMax       int             `toml:"metrics_prefix_max"`
+	MaxKeyLen              int             `toml:"max_key_len"`
+	KeyPrefix              string          `toml:"key_prefix"`
+	MaxValueSize           int             `toml:"max_value_size"`
+	StreamThreshold        int             `toml:"stream_threshold"`
+	StreamBuffer           int             `toml:"stream_buffer"`
+	MaxConnections         int32           `toml:"max_connections"`
+	MaxConnectionsPerIP    int32           `toml:"max_connections_per_ip"`
+	ClientIdleTimeout      int             `toml:"client_idle_timeout"`
+	InfoBackendSections    []string        `toml:"info_backend_sections"`
+	Sentinels              []string        `toml:"sentinels"`
+	Discovery              string          `toml:"discovery"`
+	DiscoveryInterval      int             `toml:"discovery_interval"`
+	Servers                []string        `toml:"servers"`
 }
 
 // ValidateStandalone validate redis/memcache address is valid or not
@@ -86,42 +185,247 @@ func ValidateStandalone(servers []string) (err error) {
 	if len(servers) == 0 {
 		return errs.New("empty backend server list")
 	}
-	var hasAlias bool
-	for i, server := range servers {
-		ipAlias := strings.Split(server, " ")
-		if i == 0 && len(ipAlias) == 2 {
-			hasAlias = true
-		}
-		if (hasAlias && len(ipAlias) != 2) || (!hasAlias && len(ipAlias) != 1) {
-			err = errors.Wrapf(ErrClusterConfInvalid, "server:%s", server)
+	hasAlias := len(strings.Split(servers[0], " ")) == 2
+	for _, server := range servers {
+		if err = validateServer(server, hasAlias); err != nil {
 			return
 		}
-		ipPort := strings.Split(ipAlias[0], ":")
-		if len(ipPort) != 3 {
-			err = errors.Wrapf(ErrClusterConfInvalid, "server:%s", server)
-			return
-		}
-		if port, e := strconv.Atoi(ipPort[1]); e != nil || port <= 0 {
-			err = errors.Wrapf(ErrClusterConfInvalid, "server:%s", server)
-			return
-		}
-		if weight, e := strconv.Atoi(ipPort[2]); e != nil || weight < 0 {
-			err = errors.Wrapf(ErrClusterConfInvalid, "server:%s", server)
-			return
+	}
+	return validateWeights(servers)
+}
+
+// validateServer checks the server is ip:port:weight, followed by the alias
+// name if alias.
+func validateServer(server string, alias bool) error {
+	ipAlias := strings.Split(server, " ")
+	if (alias && len(ipAlias) != 2) || (!alias && len(ipAlias) != 1) {
+		return errors.Wrapf(ErrClusterConfInvalid, "server:%s", server)
+	}
+	ipPort := strings.Split(ipAlias[0], ":")
+	if len(ipPort) != 3 {
+		return errors.Wrapf(ErrClusterConfInvalid, "server:%s", server)
+	}
+	if port, e := strconv.Atoi(ipPort[1]); e != nil || port <= 0 {
+		return errors.Wrapf(ErrClusterConfInvalid, "server:%s", server)
+	}
+	if weight, e := strconv.Atoi(ipPort[2]); e != nil || weight < 0 {
+		return errors.Wrapf(ErrClusterConfInvalid, "server:%s", server)
+	}
+	return nil
+}
+
+// validateWeights checks not all the valid servers are drained, the node of
+// weight 0 is kept in the cluster but gets no requests.
+func validateWeights(servers []string) error {
+	for _, server := range servers {
+		ipPort := strings.Split(strings.Split(server, " ")[0], ":")
+		if weight, _ := strconv.Atoi(ipPort[2]); weight > 0 {
+			return nil
 		}
 	}
-	return
+	return errors.Wrapf(ErrClusterConfInvalid, "servers:%v all weight 0", servers)
+}
+
+// validateSeed checks the seed node of redis cluster is ip:port, the
+// weight and alias are allowed but ignored.
+func validateSeed(server string) error {
+	ipPort := strings.Split(strings.Split(server, " ")[0], ":")
+	if len(ipPort) < 2 || len(ipPort) > 3 || ipPort[0] == "" {
+		return errors.Wrapf(ErrClusterConfInvalid, "server:%s", server)
+	}
+	if port, e := strconv.Atoi(ipPort[1]); e != nil || port <= 0 || port > 65535 {
+		return errors.Wrapf(ErrClusterConfInvalid, "server:%s", server)
+	}
+	return nil
 }
 
 // Validate validate config field value.
 func (cc *ClusterConfig) Validate() error {
-	// TODO(felix): complete validates
-	if cc.CacheType != types.CacheTypeRedisCluster {
+	if err := cc.validateFields(); err != nil {
+		return err
+	}
+	if cc.CacheType != types.CacheTypeRedisCluster && (cc.Discovery == "" || len(cc.Servers) > 0) {
 		return ValidateStandalone(cc.Servers)
 	}
 	return nil
 }
 
+// validateFields validates the fields except the servers.
+func (cc *ClusterConfig) validateFields() error {
+	// TODO(felix): complete validates
+	if cc.BackendType != "" && !(cc.CacheType == types.CacheTypeMemcache && cc.BackendType == types.CacheTypeRedis) &&
+		!(cc.CacheType == types.CacheTypeRedis && cc.BackendType == types.CacheTypeMemcache) {
+		return errors.Wrapf(ErrClusterConfInvalid, "backend_type:%s only support %s by %s and %s by %s", cc.BackendType,
+			types.CacheTypeRedis, types.CacheTypeMemcache, types.CacheTypeMemcache, types.CacheTypeRedis)
+	}
+	if !memcache.ValidFlags(cc.BackendFlags) || (cc.BackendFlags != "" && cc.BackendType != types.CacheTypeRedis) {
+		return errors.Wrapf(ErrClusterConfInvalid, "backend_flags:%s", cc.BackendFlags)
+	}
+	if cc.BackendType == types.CacheTypeMemcache && (cc.DB != 0 || len(cc.Sentinels) > 0 || len(cc.InfoBackendSections) > 0) {
+		return errors.Wrapf(ErrClusterConfInvalid, "db, sentinels and info_backend_sections not support by backend_type:%s", cc.BackendType)
+	}
+	if cc.DB < 0 || (cc.DB != 0 && cc.CacheType != types.CacheTypeRedis && cc.BackendType != types.CacheTypeRedis) {
+		return errors.Wrapf(ErrClusterConfInvalid, "db:%d only support by redis", cc.DB)
+	}
+	if cc.HashMethod != "" && !hashkit.ValidMethod(cc.HashMethod) {
+		return errors.Wrapf(ErrClusterConfInvalid, "hash_method:%s", cc.HashMethod)
+	}
+	if cc.HashDistribution != "" && !hashkit.ValidDistribution(cc.HashDistribution) {
+		return errors.Wrapf(ErrClusterConfInvalid, "hash_distribution:%s", cc.HashDistribution)
+	}
+	if cc.HashTag != "" && len(cc.HashTag) != 2 {
+		return errors.Wrapf(ErrClusterConfInvalid, "hash_tag:%s must be two characters", cc.HashTag)
+	}
+	if !rclstr.ValidReadPreference(cc.ReadPreference) {
+		return errors.Wrapf(ErrClusterConfInvalid, "read_preference:%s", cc.ReadPreference)
+	}
+	if cc.ReadPreference != "" && cc.ReadPreference != rclstr.ReadMaster && cc.CacheType != types.CacheTypeRedisCluster {
+		return errors.Wrapf(ErrClusterConfInvalid, "read_preference only support by %s", types.CacheTypeRedisCluster)
+	}
+	if err := cc.validateSentinels(); err != nil {
+		return err
+	}
+	if err := cc.validateDiscovery(); err != nil {
+		return err
+	}
+	if cc.QuietBatch && cc.CacheType != types.CacheTypeMemcacheBinary {
+		return errors.Wrapf(ErrClusterConfInvalid, "quiet_batch only support by %s", types.CacheTypeMemcacheBinary)
+	}
+	if cc.HotKeyThreshold > 0 && cc.CacheType != types.CacheTypeRedis && cc.CacheType != types.CacheTypeRedisCluster {
+		return errors.Wrapf(ErrClusterConfInvalid, "hotkey_threshold only support by %s and %s", types.CacheTypeRedis, types.CacheTypeRedisCluster)
+	}
+	if cc.RateLimitRead < 0 || cc.RateLimitWrite < 0 {
+		return errors.Wrapf(ErrClusterConfInvalid, "ratelimit_read:%d ratelimit_write:%d", cc.RateLimitRead, cc.RateLimitWrite)
+	}
+	if cc.MaxConnections < 0 || cc.MaxConnectionsPerIP < 0 {
+		return errors.Wrapf(ErrClusterConfInvalid, "max_connections:%d max_connections_per_ip:%d", cc.MaxConnections, cc.MaxConnectionsPerIP)
+	}
+	if cc.ClientIdleTimeout < 0 {
+		return errors.Wrapf(ErrClusterConfInvalid, "client_idle_timeout:%d", cc.ClientIdleTimeout)
+	}
+	if len(cc.InfoBackendSections) > 0 && cc.CacheType != types.CacheTypeRedis {
+		return errors.Wrapf(ErrClusterConfInvalid, "info_backend_sections only support by %s", types.CacheTypeRedis)
+	}
+	for _, section := range cc.InfoBackendSections {
+		if _, ok := infoSections[strings.ToLower(section)]; ok || section == "" {
+			return errors.Wrapf(ErrClusterConfInvalid, "info_backend_sections:%s is answered by proxy", section)
+		}
+	}
+	if cc.PingInterval < 0 || cc.ServerRetryTimeout < 0 {
+		return errors.Wrapf(ErrClusterConfInvalid, "ping_interval:%d server_retry_timeout:%d", cc.PingInterval, cc.ServerRetryTimeout)
+	}
+	if cc.RetryTimes < 0 || cc.RetryBackoff < 0 {
+		return errors.Wrapf(ErrClusterConfInvalid, "retry_times:%d retry_backoff:%d", cc.RetryTimes, cc.RetryBackoff)
+	}
+	if cc.AccessLogSampleRate < 0 || cc.AccessLogSampleRate > 1 {
+		return errors.Wrapf(ErrClusterConfInvalid, "access_log_sample_rate:%v", cc.AccessLogSampleRate)
+	}
+	if cc.TraceSampleRate < 0 || cc.TraceSampleRate > 1 {
+		return errors.Wrapf(ErrClusterConfInvalid, "trace_sample_rate:%v", cc.TraceSampleRate)
+	}
+	if cc.MetricsPrefixDelims != "" && cc.MetricsPrefixRegex != "" {
+		return errors.Wrapf(ErrClusterConfInvalid, "metrics_prefix_delimiters and metrics_prefix_regex can't be both set")
+	}
+	if cc.MetricsPrefixRegex != "" {
+		if _, err := regexp.Compile(cc.MetricsPrefixRegex); err != nil {
+			return errors.Wrapf(ErrClusterConfInvalid, "metrics_prefix_regex:%s %v", cc.MetricsPrefixRegex, err)
+		}
+	}
+	if cc.MetricsPrefixMax < 0 {
+		return errors.Wrapf(ErrClusterConfInvalid, "metrics_prefix_max:%d", cc.MetricsPrefixMax)
+	}
+	if cc.MaxKeyLen < 0 || cc.MaxValueSize < 0 {
+		return errors.Wrapf(ErrClusterConfInvalid, "max_key_len:%d max_value_size:%d", cc.MaxKeyLen, cc.MaxValueSize)
+	}
+	if cc.KeyPrefix != "" && cc.CacheType != types.CacheTypeRedis && cc.CacheType != types.CacheTypeRedisCluster {
+		return errors.Wrapf(ErrClusterConfInvalid, "key_prefix not support by %s", cc.CacheType)
+	}
+	if cc.StreamThreshold < 0 || cc.StreamBuffer < 0 {
+		return errors.Wrapf(ErrClusterConfInvalid, "stream_threshold:%d stream_buffer:%d", cc.StreamThreshold, cc.StreamBuffer)
+	}
+	if cc.StreamThreshold > 0 && cc.CacheType == types.CacheTypeMemcacheBinary {
+		return errors.Wrapf(ErrClusterConfInvalid, "stream_threshold not support by %s", types.CacheTypeMemcacheBinary)
+	}
+	if cc.Partial != "" && cc.Partial != partialError && cc.Partial != partialNil {
+		return errors.Wrapf(ErrClusterConfInvalid, "partial:%s", cc.Partial)
+	}
+	if cc.Partial == partialNil && cc.CacheType != types.CacheTypeRedis && cc.CacheType != types.CacheTypeRedisCluster {
+		return errors.Wrapf(ErrClusterConfInvalid, "partial:%s only support by %s and %s", cc.Partial, types.CacheTypeRedis, types.CacheTypeRedisCluster)
+	}
+	if cc.ReadTimeoutFactor < 0 || cc.ReadTimeoutMin < 0 || cc.ReadTimeoutMax < 0 || cc.ReadTimeoutMin > cc.ReadTimeoutMax ||
+		(cc.ReadTimeoutFactor > 0 && cc.ReadTimeoutMax == 0) {
+		return errors.Wrapf(ErrClusterConfInvalid, "read_timeout_factor:%v read_timeout_min:%d read_timeout_max:%d", cc.ReadTimeoutFactor, cc.ReadTimeoutMin, cc.ReadTimeoutMax)
+	}
+	if cc.ReadTimeoutFactor > 0 && cc.CacheType == types.CacheTypeRedisCluster {
+		return errors.Wrapf(ErrClusterConfInvalid, "read_timeout_factor not support by %s", types.CacheTypeRedisCluster)
+	}
+	if cc.MaxInflight < 0 || cc.InflightQueue < 0 || cc.InflightQueueTimeout < 0 {
+		return errors.Wrapf(ErrClusterConfInvalid, "max_inflight:%d inflight_queue:%d inflight_queue_timeout:%d", cc.MaxInflight, cc.InflightQueue, cc.InflightQueueTimeout)
+	}
+	if cc.BreakerErrors < 0 || cc.BreakerSlow < 0 || cc.BreakerTimeout < 0 {
+		return errors.Wrapf(ErrClusterConfInvalid, "breaker_errors:%d breaker_slow:%d breaker_timeout:%d", cc.BreakerErrors, cc.BreakerSlow, cc.BreakerTimeout)
+	}
+	if cc.BreakerErrors > 0 && cc.CacheType == types.CacheTypeRedisCluster {
+		return errors.Wrapf(ErrClusterConfInvalid, "breaker_errors not support by %s", types.CacheTypeRedisCluster)
+	}
+	if cc.FaultLatency < 0 || !validRate(cc.FaultLatencyRate) || !validRate(cc.FaultResetRate) || !validRate(cc.FaultCorruptRate) ||
+		(cc.FaultLatencyRate > 0 && cc.FaultLatency == 0) {
+		return errors.Wrapf(ErrClusterConfInvalid, "fault_latency:%d fault_latency_rate:%v fault_reset_rate:%v fault_corrupt_rate:%v",
+			cc.FaultLatency, cc.FaultLatencyRate, cc.FaultResetRate, cc.FaultCorruptRate)
+	}
+	if cc.faulty() && cc.CacheType == types.CacheTypeRedisCluster {
+		return errors.Wrapf(ErrClusterConfInvalid, "fault injection not support by %s", types.CacheTypeRedisCluster)
+	}
+	if cc.HedgePercentile < 0 || cc.HedgePercentile >= 100 || cc.HedgeMinDelay < 0 {
+		return errors.Wrapf(ErrClusterConfInvalid, "hedge_percentile:%d hedge_min_delay:%d", cc.HedgePercentile, cc.HedgeMinDelay)
+	}
+	if cc.ShadowCluster == cc.Name || cc.ShadowMaxPending < 0 {
+		return errors.Wrapf(ErrClusterConfInvalid, "shadow_cluster:%s shadow_max_pending:%d", cc.ShadowCluster, cc.ShadowMaxPending)
+	}
+	if cc.MirrorCluster == cc.Name || cc.MirrorPercent < 0 || cc.MirrorPercent > 100 || cc.MirrorMaxPending < 0 {
+		return errors.Wrapf(ErrClusterConfInvalid, "mirror_cluster:%s mirror_percent:%d mirror_max_pending:%d", cc.MirrorCluster, cc.MirrorPercent, cc.MirrorMaxPending)
+	}
+	switch cc.MirrorCommands {
+	case "", mirrorReads, mirrorWrites, mirrorAll:
+	default:
+		return errors.Wrapf(ErrClusterConfInvalid, "mirror_commands:%s", cc.MirrorCommands)
+	}
+	if cc.FallbackCluster == cc.Name || cc.FallbackTTL < 0 {
+		return errors.Wrapf(ErrClusterConfInvalid, "fallback_cluster:%s fallback_ttl:%d", cc.FallbackCluster, cc.FallbackTTL)
+	}
+	if cc.FallbackCluster != "" && cc.CacheType == types.CacheTypeMemcacheBinary {
+		return errors.Wrapf(ErrClusterConfInvalid, "fallback_cluster not support by %s", types.CacheTypeMemcacheBinary)
+	}
+	if !validateACL(cc.AllowedCommands) || !validateACL(cc.ForbiddenCommands) {
+		return errors.Wrapf(ErrClusterConfInvalid, "allowed_commands:%v forbidden_commands:%v", cc.AllowedCommands, cc.ForbiddenCommands)
+	}
+	if cc.BlockingMaxConns < 0 || cc.BlockingTimeoutMargin < 0 {
+		return errors.Wrapf(ErrClusterConfInvalid, "blocking_max_conns:%d blocking_timeout_margin:%d", cc.BlockingMaxConns, cc.BlockingTimeoutMargin)
+	}
+	if cc.NodeMaxConnections < 0 || (cc.NodeMaxConnections > 0 && cc.NodeMaxConnections < cc.NodeConnections) || cc.NodeIdleTimeout < 0 || cc.NodeWaitQueue < 0 {
+		return errors.Wrapf(ErrClusterConfInvalid, "node_connections:%d node_max_connections:%d node_idle_timeout:%d node_wait_queue:%d", cc.NodeConnections, cc.NodeMaxConnections, cc.NodeIdleTimeout, cc.NodeWaitQueue)
+	}
+	if cc.NodeMaxConnections > cc.NodeConnections && cc.CacheType == types.CacheTypeRedisCluster {
+		return errors.Wrapf(ErrClusterConfInvalid, "node_max_connections not support by %s", types.CacheTypeRedisCluster)
+	}
+	if cc.NodeBatchCount < 0 || cc.NodeBatchWait < 0 {
+		return errors.Wrapf(ErrClusterConfInvalid, "node_batch_count:%d node_batch_wait:%d", cc.NodeBatchCount, cc.NodeBatchWait)
+	}
+	if cc.NodeBatchWait > 0 && cc.CacheType == types.CacheTypeRedisCluster {
+		return errors.Wrapf(ErrClusterConfInvalid, "node_batch_wait not support by %s", types.CacheTypeRedisCluster)
+	}
+	if cc.NodeWorkers < 0 {
+		return errors.Wrapf(ErrClusterConfInvalid, "node_workers:%d", cc.NodeWorkers)
+	}
+	if _, err := cc.RateLimitRules(); err != nil {
+		return err
+	}
+	if _, err := cc.TLSConfig(); err != nil {
+		return err
+	}
+	return nil
+}
+
 // SetDefault config content with cluster config
 func (cc *ClusterConfig) SetDefault() {
 	if len(cc.Servers) == 0 {
@@ -132,17 +436,21 @@ func (cc *ClusterConfig) SetDefault() {
 	}
 
 	if cc.HashMethod == "" {
-		cc.HashMethod = "fnv1a64"
+		cc.HashMethod = hashkit.HashMethodFnv1a64
 	}
 
 	if cc.HashDistribution == "" {
-		cc.HashDistribution = "ketama"
+		cc.HashDistribution = hashkit.DistributionKetama
 	}
 
 	if cc.HashTag == "" {
 		cc.HashTag = "{}"
 	}
 
+	if cc.BackendType == types.CacheTypeRedis && cc.BackendFlags == "" {
+		cc.BackendFlags = memcache.FlagsNone
+	}
+
 	if cc.ListenProto == "" {
 		cc.ListenProto = "tcp"
 	}
@@ -155,6 +463,91 @@ func (cc *ClusterConfig) SetDefault() {
 		cc.NodePipeCount = 32
 	}
 
+	if cc.NodeMaxConnections == 0 {
+		cc.NodeMaxConnections = cc.NodeConnections
+	}
+
+	if cc.PingInterval == 0 {
+		cc.PingInterval = 1000
+	}
+
+	if cc.ServerRetryTimeout == 0 {
+		cc.ServerRetryTimeout = 300000
+	}
+
+	if cc.RetryTimes > 0 && cc.RetryBackoff == 0 {
+		cc.RetryBackoff = 10
+	}
+	if cc.Partial == "" {
+		cc.Partial = partialError
+	}
+	if cc.BreakerErrors > 0 && cc.BreakerTimeout == 0 {
+		cc.BreakerTimeout = 1000
+	}
+	if cc.InflightQueue > 0 && cc.InflightQueueTimeout == 0 {
+		cc.InflightQueueTimeout = 100
+	}
+	if cc.ReadTimeoutFactor > 0 && cc.ReadTimeoutMax == 0 {
+		cc.ReadTimeoutMax = cc.ReadTimeout
+	}
+
+	if cc.HedgePercentile > 0 && cc.HedgeMinDelay == 0 {
+		cc.HedgeMinDelay = 5
+	}
+
+	if cc.CacheType == types.CacheTypeRedis || cc.CacheType == types.CacheTypeRedisCluster {
+		if cc.BlockingMaxConns == 0 {
+			cc.BlockingMaxConns = 64
+		}
+		if cc.BlockingTimeoutMargin == 0 {
+			cc.BlockingTimeoutMargin = 1000
+		}
+	}
+
+	if cc.ShadowCluster != "" && cc.ShadowMaxPending == 0 {
+		cc.ShadowMaxPending = 1024
+	}
+	if cc.MirrorCluster != "" {
+		if cc.MirrorPercent == 0 {
+			cc.MirrorPercent = 100
+		}
+		if cc.MirrorCommands == "" {
+			cc.MirrorCommands = mirrorAll
+		}
+		if cc.MirrorMaxPending == 0 {
+			cc.MirrorMaxPending = 1024
+		}
+	}
+
+	if cc.StreamThreshold > 0 && cc.StreamBuffer == 0 {
+		cc.StreamBuffer = 1024 * 1024
+	}
+
+	if (cc.MetricsPrefixDelims != "" || cc.MetricsPrefixRegex != "") && cc.MetricsPrefixMax == 0 {
+		cc.MetricsPrefixMax = 64
+	}
+
+	if cc.CacheType == types.CacheTypeRedisCluster && cc.ClusterRefreshInterval == 0 {
+		cc.ClusterRefreshInterval = 60
+	}
+
+	if cc.Discovery != "" && cc.DiscoveryInterval == 0 {
+		cc.DiscoveryInterval = 30
+	}
+
+	if cc.RateLimitError == "" {
+		cc.RateLimitError = "ERR rate limited"
+	}
+
+	if cc.HotKeyThreshold > 0 {
+		if cc.HotKeyTTL == 0 {
+			cc.HotKeyTTL = 1000
+		}
+		if cc.HotKeyMaxMemory == 0 {
+			cc.HotKeyMaxMemory = 16 << 20
+		}
+	}
+
 	if len(cc.ListenAddr) == 0 {
 		fmt.Fprint(os.Stderr, "checking out ListenAddr may only using for [anzi] from\n")
 	} else if !strings.Contains(cc.ListenAddr, ":") {
@@ -166,14 +559,15 @@ func (cc *ClusterConfig) SetDefault() {
 
 // ClusterConfigs cluster configs.
 type ClusterConfigs struct {
-	Clusters []*ClusterConfig
+	Clusters []*ClusterConfig `toml:"clusters"`
 }
 
-// LoadFromFile load from file.
+// LoadFromFile load from file, toml by default, yaml or json by the
+// extension, and ${VAR} in the values are expanded by the environment.
 func (ccs *ClusterConfigs) LoadFromFile(path string) error {
-	_, err := toml.DecodeFile(path, ccs)
+	err := decodeFile(path, ccs)
 	if err != nil {
-		return errors.Wrapf(err, "Load From File:%s", path)
+		return err
 	}
 	for _, cc := range ccs.Clusters {
 		cc.SetDefault()
@@ -196,6 +590,61 @@ func (ccs *ClusterConfigs) LoadFromFile(path string) error {
 	return nil
 }
 
+// faulty reports whether faults are injected into the node connections.
+func (cc *ClusterConfig) faulty() bool {
+	return cc.FaultLatencyRate > 0 || cc.FaultResetRate > 0 || cc.FaultCorruptRate > 0
+}
+
+func validRate(rate float64) bool {
+	return rate >= 0 && rate <= 1
+}
+
+// validateShadow checks the shadow and mirror clusters of ccs are ones of
+// ccs in the same cache type.
+func validateShadow(ccs []*ClusterConfig) error {
+	cacheTypes := map[string]types.CacheType{}
+	for _, cc := range ccs {
+		cacheTypes[cc.Name] = cc.CacheType
+	}
+	for _, cc := range ccs {
+		if cc.ShadowCluster != "" {
+			if t, ok := cacheTypes[cc.ShadowCluster]; !ok || t != cc.CacheType {
+				return errors.Wrapf(ErrClusterConfInvalid, "shadow_cluster:%s", cc.ShadowCluster)
+			}
+		}
+		if cc.MirrorCluster != "" {
+			if t, ok := cacheTypes[cc.MirrorCluster]; !ok || t != cc.CacheType {
+				return errors.Wrapf(ErrClusterConfInvalid, "mirror_cluster:%s", cc.MirrorCluster)
+			}
+		}
+	}
+	return nil
+}
+
+// validateFallback checks the fallback cluster of ccs is one of ccs in the
+// same protocol, redis and redis_cluster are interchangeable.
+func validateFallback(ccs []*ClusterConfig) error {
+	protocol := func(t types.CacheType) types.CacheType {
+		if t == types.CacheTypeRedisCluster {
+			return types.CacheTypeRedis
+		}
+		return t
+	}
+	cacheTypes := map[string]types.CacheType{}
+	for _, cc := range ccs {
+		cacheTypes[cc.Name] = protocol(cc.CacheType)
+	}
+	for _, cc := range ccs {
+		if cc.FallbackCluster == "" {
+			continue
+		}
+		if t, ok := cacheTypes[cc.FallbackCluster]; !ok || t != protocol(cc.CacheType) {
+			return errors.Wrapf(ErrClusterConfInvalid, "fallback_cluster:%s", cc.FallbackCluster)
+		}
+	}
+	return nil
+}
+
 // LoadClusterConf load cluster config.
 func LoadClusterConf(path string) (ccs []*ClusterConfig, err error) {
 	cs := &ClusterConfigs{}
@@ -221,6 +670,12 @@ func LoadClusterConf(path string) (ccs []*ClusterConfig, err error) {
 		}
 		checks[port] = struct{}{}
 	}
+	if err = validateShadow(cs.Clusters); err != nil {
+		return
+	}
+	if err = validateFallback(cs.Clusters); err != nil {
+		return
+	}
 	ccs = append(ccs, cs.Clusters...)
 	return
 }
@@ -234,10 +689,11 @@ const defaultConfig = `
 #                 written in Go                  #
 #                                                #
 ##################################################
-pprof = "0.0.0.0:2110"
+# The listen addr of stat, pprof, metrics and admin api. By default, disabled.
+# stat = "0.0.0.0:2110"
 debug = false
 log = ""
-log_lv = 0
+log_vl = 0
 
 [proxy]
 # The read timeout value in msec that we wait for to receive a response from the client. By default, we wait indefinitely.
@@ -248,4 +704,14 @@ write_timeout = 0
 max_connections = 0
 # proxy support prometheus metrics, reuse the pprof port. By default, we use it.
 use_metrics = true
+# The buckets of metrics histograms, latency in microseconds, size in bytes and batch in keys. By default, we use the builtin buckets.
+# latency_buckets = [1000, 2000, 4000, 10000]
+# size_buckets = [64, 256, 1024, 4096, 16384, 65536, 262144, 1048576]
+# batch_buckets = [2, 5, 10, 20, 50, 100, 200, 500]
+# The token of admin api on the stat port, requested by header "Authorization: Bearer <token>". By default, no token is required.
+# admin_token = ""
+# The applied config versions kept of each cluster for rollback by admin api. By default, 10.
+# config_versions = 10
+# The dir where the config versions are saved to survive restart. By default, in memory only.
+# config_versions_dir = ""
 `
@@ -4,6 +4,10 @@ import (
 	"os"
 	"testing"
 
+	"overlord/pkg/hashkit"
+	"overlord/pkg/types"
+	"overlord/proxy/proto/memcache"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -130,3 +134,125 @@ func TestClusterConfigLoadFromFile(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Len(t, ccs.Clusters, 3)
 }
+
+func TestConfigValidateBuckets(t *testing.T) {
+	c := &Config{}
+	assert.NoError(t, c.Validate())
+	c.Proxy.LatencyBuckets = []float64{100, 1000, 10000}
+	c.Proxy.SizeBuckets = []float64{64, 1024}
+	assert.NoError(t, c.Validate())
+	c.Proxy.BatchBuckets = []float64{10, 5}
+	assert.Error(t, c.Validate())
+	c.Proxy.BatchBuckets = []float64{0, 5}
+	assert.Error(t, c.Validate())
+}
+
+func TestClusterConfigValidateBackend(t *testing.T) {
+	cc := &ClusterConfig{Name: "mc", CacheType: types.CacheTypeMemcache, BackendType: types.CacheTypeRedis, Servers: []string{"127.0.0.1:6379:1"}}
+	assert.NoError(t, cc.Validate())
+	cc.DB = 1
+	cc.BackendFlags = memcache.FlagsPrefix
+	assert.NoError(t, cc.Validate())
+	cc.BackendFlags = "hash"
+	assert.Error(t, cc.Validate())
+	cc.BackendFlags = ""
+	cc.CacheType = types.CacheTypeMemcacheBinary
+	assert.Error(t, cc.Validate())
+
+	cc = &ClusterConfig{Name: "rd", CacheType: types.CacheTypeRedis, BackendType: types.CacheTypeMemcache, Servers: []string{"127.0.0.1:11211:1"}}
+	assert.NoError(t, cc.Validate())
+	cc.BackendFlags = memcache.FlagsPrefix
+	assert.Error(t, cc.Validate())
+	cc.BackendFlags = ""
+	cc.DB = 1
+	assert.Error(t, cc.Validate())
+}
+
+func TestClusterConfigValidatePartial(t *testing.T) {
+	cc := &ClusterConfig{Name: "partial", CacheType: types.CacheTypeRedis, Partial: partialNil, Servers: []string{"127.0.0.1:6379:1"}}
+	assert.NoError(t, cc.Validate())
+	cc.Partial = "skip"
+	assert.Error(t, cc.Validate())
+	cc.Partial = partialNil
+	cc.CacheType = types.CacheTypeMemcache
+	assert.Error(t, cc.Validate())
+}
+
+func TestClusterConfigBreaker(t *testing.T) {
+	cc := &ClusterConfig{Name: "breaker", CacheType: types.CacheTypeRedis, BreakerErrors: 5, Servers: []string{"127.0.0.1:6379:1"}}
+	cc.SetDefault()
+	assert.NoError(t, cc.Validate())
+	assert.Equal(t, 1000, cc.BreakerTimeout)
+	cc.BreakerSlow = -1
+	assert.Error(t, cc.Validate())
+	cc.BreakerSlow = 0
+	cc.CacheType = types.CacheTypeRedisCluster
+	assert.Error(t, cc.Validate())
+}
+
+func TestClusterConfigInflight(t *testing.T) {
+	cc := &ClusterConfig{Name: "inflight", CacheType: types.CacheTypeRedis, MaxInflight: 100, InflightQueue: 10, Servers: []string{"127.0.0.1:6379:1"}}
+	cc.SetDefault()
+	assert.NoError(t, cc.Validate())
+	assert.Equal(t, 100, cc.InflightQueueTimeout)
+	cc.InflightQueue = -1
+	assert.Error(t, cc.Validate())
+}
+
+func TestClusterConfigWeight(t *testing.T) {
+	cc := &ClusterConfig{Name: "weight", CacheType: types.CacheTypeRedis, Servers: []string{"127.0.0.1:6379:1", "127.0.0.1:6380:0"}}
+	cc.SetDefault()
+	for _, des := range []string{hashkit.DistributionKetama, hashkit.DistributionModula, hashkit.DistributionRandom} {
+		cc.HashDistribution = des
+		assert.NoError(t, cc.Validate(), des)
+	}
+	cc.Servers[0] = "127.0.0.1:6379:0"
+	assert.Error(t, cc.Validate(), "all drained")
+	cc.Servers[1] = "127.0.0.1:6380:-1"
+	assert.Error(t, cc.Validate())
+}
+
+func TestClusterConfigReadTimeoutFactor(t *testing.T) {
+	cc := &ClusterConfig{Name: "adaptive", CacheType: types.CacheTypeRedis, ReadTimeout: 1000, ReadTimeoutFactor: 3, ReadTimeoutMin: 10, Servers: []string{"127.0.0.1:6379:1"}}
+	cc.SetDefault()
+	assert.NoError(t, cc.Validate())
+	assert.Equal(t, 1000, cc.ReadTimeoutMax)
+	cc.ReadTimeoutMin = 2000
+	assert.Error(t, cc.Validate())
+
+	cc = &ClusterConfig{Name: "adaptive", CacheType: types.CacheTypeRedis, ReadTimeoutFactor: 3, Servers: []string{"127.0.0.1:6379:1"}}
+	cc.SetDefault()
+	assert.Error(t, cc.Validate())
+}
+
+func TestClusterConfigMirror(t *testing.T) {
+	cc := &ClusterConfig{Name: "mirror", CacheType: types.CacheTypeRedis, MirrorCluster: "staging", Servers: []string{"127.0.0.1:6379:1"}}
+	cc.SetDefault()
+	assert.NoError(t, cc.Validate())
+	assert.Equal(t, 100, cc.MirrorPercent)
+	assert.Equal(t, mirrorAll, cc.MirrorCommands)
+	assert.Equal(t, 1024, cc.MirrorMaxPending)
+	cc.MirrorCommands = "deletes"
+	assert.Error(t, cc.Validate())
+	cc.MirrorCommands = mirrorReads
+	cc.MirrorPercent = 101
+	assert.Error(t, cc.Validate())
+	cc.MirrorPercent = 10
+	cc.MirrorCluster = "mirror"
+	assert.Error(t, cc.Validate())
+}
+
+func TestClusterConfigFault(t *testing.T) {
+	cc := &ClusterConfig{Name: "fault", CacheType: types.CacheTypeRedis, FaultLatency: 100, FaultLatencyRate: 0.1, FaultResetRate: 0.01, Servers: []string{"127.0.0.1:6379:1"}}
+	cc.SetDefault()
+	assert.NoError(t, cc.Validate())
+	assert.True(t, cc.faulty())
+	cc.FaultCorruptRate = 1.5
+	assert.Error(t, cc.Validate())
+	cc.FaultCorruptRate = 0
+	cc.FaultLatency = 0
+	assert.Error(t, cc.Validate())
+	cc.FaultLatency = 100
+	cc.CacheType = types.CacheTypeRedisCluster
+	assert.Error(t, cc.Validate())
+}
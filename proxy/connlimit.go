@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"overlord/pkg/log"
+	libnet "overlord/pkg/net"
+	"overlord/pkg/prom"
+	"overlord/pkg/types"
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/memcache"
+	mcbin "overlord/proxy/proto/memcache/binary"
+	"overlord/proxy/proto/redis"
+	rclstr "overlord/proxy/proto/redis/cluster"
+)
+
+// connLimiter counts the client conns of a cluster listener in total and
+// by client ip.
+type connLimiter struct {
+	max, perIP int32
+
+	lock  sync.Mutex
+	conns int32
+	ips   map[string]int32
+}
+
+func newConnLimiter(cc *ClusterConfig) *connLimiter {
+	return &connLimiter{
+		max:   cc.MaxConnections,
+		perIP: cc.MaxConnectionsPerIP,
+		ips:   make(map[string]int32),
+	}
+}
+
+// acquire counts the conn from addr if the limits are not exceeded.
+func (cl *connLimiter) acquire(addr string) error {
+	ip := hostOf(addr)
+	cl.lock.Lock()
+	defer cl.lock.Unlock()
+	if cl.max > 0 && cl.conns >= cl.max {
+		return ErrProxyMoreMaxConns
+	}
+	if cl.perIP > 0 && cl.ips[ip] >= cl.perIP {
+		return ErrProxyMoreIPConns
+	}
+	cl.conns++
+	cl.ips[ip]++
+	return nil
+}
+
+func (cl *connLimiter) release(addr string) {
+	ip := hostOf(addr)
+	cl.lock.Lock()
+	cl.conns--
+	if cl.ips[ip]--; cl.ips[ip] <= 0 {
+		delete(cl.ips, ip)
+	}
+	cl.lock.Unlock()
+}
+
+func hostOf(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// reject replies err to the client and closes conn.
+func reject(cc *ClusterConfig, conn net.Conn, err error) {
+	var encoder proto.ProxyConn
+	switch cc.CacheType {
+	case types.CacheTypeMemcache:
+		encoder = memcache.NewProxyConn(libnet.NewConn(conn, time.Second, time.Second))
+	case types.CacheTypeMemcacheBinary:
+		encoder = mcbin.NewProxyConn(libnet.NewConn(conn, time.Second, time.Second))
+	case types.CacheTypeRedis:
+		encoder = redis.NewProxyConn(libnet.NewConn(conn, time.Second, time.Second), true)
+	case types.CacheTypeRedisCluster:
+		encoder = rclstr.NewProxyConn(libnet.NewConn(conn, time.Second, time.Second), nil)
+	}
+	if encoder != nil {
+		_ = encoder.Encode(proto.ErrMessage(err))
+		_ = encoder.Flush()
+	}
+	_ = conn.Close()
+	if prom.On {
+		prom.ConnRejectIncr(cc.Name, err.Error())
+	}
+	if log.V(4) {
+		log.Warnf("cluster(%s) reject connection from(%s) error:%v", cc.Name, conn.RemoteAddr(), err)
+	}
+}
@@ -0,0 +1,33 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"overlord/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnLimiterOk(t *testing.T) {
+	cl := newConnLimiter(&ClusterConfig{MaxConnections: 3, MaxConnectionsPerIP: 2})
+	assert.NoError(t, cl.acquire("10.0.0.1:1000"))
+	assert.NoError(t, cl.acquire("10.0.0.1:1001"))
+	assert.Equal(t, ErrProxyMoreIPConns, cl.acquire("10.0.0.1:1002"))
+	assert.NoError(t, cl.acquire("10.0.0.2:1000"))
+	assert.Equal(t, ErrProxyMoreMaxConns, cl.acquire("10.0.0.3:1000"))
+
+	cl.release("10.0.0.1:1000")
+	assert.NoError(t, cl.acquire("10.0.0.1:1002"))
+	cl.release("10.0.0.2:1000")
+	assert.Len(t, cl.ips, 1)
+}
+
+func TestRejectOk(t *testing.T) {
+	server, client := net.Pipe()
+	go reject(&ClusterConfig{Name: "test", CacheType: types.CacheTypeRedis}, server, ErrProxyMoreIPConns)
+	bs, err := ioutil.ReadAll(client)
+	assert.NoError(t, err)
+	assert.Equal(t, "-"+ErrProxyMoreIPConns.Error()+"\r\n", string(bs))
+}
@@ -0,0 +1,363 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"overlord/pkg/log"
+	"overlord/pkg/types"
+
+	"github.com/pkg/errors"
+)
+
+// schemes of discovery.
+const (
+	discoverySRV    = "srv"
+	discoveryConsul = "consul"
+)
+
+const (
+	discoveryTimeout = 5 * time.Second
+	// discoveryRemoveRounds is the resolutions in a row a node must be absent
+	// from before it's removed, so that a flapping resolution never moves
+	// the keys of the node.
+	discoveryRemoveRounds = 2
+)
+
+// lookups of dns, replaced by tests.
+var (
+	lookupSRV  = net.DefaultResolver.LookupSRV
+	lookupHost = net.DefaultResolver.LookupHost
+)
+
+// validateDiscovery checks the discovery of servers.
+func (cc *ClusterConfig) validateDiscovery() error {
+	if cc.Discovery == "" {
+		return nil
+	}
+	if cc.CacheType == types.CacheTypeRedisCluster || len(cc.Sentinels) > 0 {
+		return errors.Wrapf(ErrClusterConfInvalid, "discovery not support by %s and sentinels", types.CacheTypeRedisCluster)
+	}
+	if _, err := newResolver(cc.Discovery); err != nil {
+		return errors.Wrapf(ErrClusterConfInvalid, "discovery:%s %v", cc.Discovery, err)
+	}
+	if cc.DiscoveryInterval < 0 {
+		return errors.Wrapf(ErrClusterConfInvalid, "discovery_interval:%d", cc.DiscoveryInterval)
+	}
+	for _, svr := range cc.Servers {
+		if len(strings.Split(svr, " ")) != 2 {
+			return errors.Wrapf(ErrClusterConfInvalid, "server:%s must be aliased with discovery", svr)
+		}
+	}
+	return nil
+}
+
+// resolver resolves the servers in the form of "ip:port:weight alias".
+type resolver interface {
+	resolve(ctx context.Context) ([]string, error)
+}
+
+// newResolver new the resolver of discovery, which is the dns SRV name like
+// srv://_memcache._tcp.cache.example.com, or the consul service like
+// consul://127.0.0.1:8500/cache?tag=master&dc=sh&token=secret.
+func newResolver(discovery string) (resolver, error) {
+	u, err := url.Parse(discovery)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case discoverySRV:
+		if u.Host == "" {
+			return nil, errors.New("srv name is empty")
+		}
+		return &srvResolver{name: u.Host}, nil
+	case discoveryConsul:
+		service := strings.Trim(u.Path, "/")
+		if u.Host == "" || service == "" || strings.Contains(service, "/") {
+			return nil, errors.New("must be consul://host:port/service")
+		}
+		return &consulResolver{addr: u.Host, service: service, query: u.Query(), hc: &http.Client{Timeout: discoveryTimeout}}, nil
+	}
+	return nil, errors.Errorf("scheme %s not support", u.Scheme)
+}
+
+// srvResolver resolves the dns SRV records, the target is the alias and the
+// weight of record is the weight of node.
+type srvResolver struct {
+	name string
+}
+
+func (r *srvResolver) resolve(ctx context.Context) (servers []string, err error) {
+	_, srvs, err := lookupSRV(ctx, "", "", r.name)
+	if err != nil {
+		return
+	}
+	targets := make(map[string]int, len(srvs))
+	for _, srv := range srvs {
+		targets[srv.Target]++
+	}
+	for _, srv := range srvs {
+		host := strings.TrimSuffix(srv.Target, ".")
+		ip, err := lookupIPv4(ctx, host)
+		if err != nil {
+			log.Warnf("discovery srv:%s target:%s lookup error:%v", r.name, host, err)
+			continue
+		}
+		alias := host
+		if targets[srv.Target] > 1 {
+			alias = host + ":" + strconv.Itoa(int(srv.Port))
+		}
+		servers = append(servers, discoveredServer(ip, int(srv.Port), int(srv.Weight), alias))
+	}
+	return
+}
+
+// consulResolver resolves the passing instances of the consul service, the
+// service id is the alias and the passing weight is the weight of node.
+type consulResolver struct {
+	addr    string
+	service string
+	query   url.Values
+	hc      *http.Client
+}
+
+type consulEntry struct {
+	Node struct {
+		Address string
+	}
+	Service struct {
+		ID      string
+		Address string
+		Port    int
+		Weights struct {
+			Passing int
+		}
+	}
+}
+
+func (r *consulResolver) resolve(ctx context.Context) (servers []string, err error) {
+	q := url.Values{"passing": {"1"}}
+	for _, key := range []string{"tag", "dc"} {
+		if val := r.query.Get(key); val != "" {
+			q.Set(key, val)
+		}
+	}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s/v1/health/service/%s?%s", r.addr, r.service, q.Encode()), nil)
+	if err != nil {
+		return
+	}
+	if token := r.query.Get("token"); token != "" {
+		req.Header.Set("X-Consul-Token", token)
+	}
+	resp, err := r.hc.Do(req.WithContext(ctx))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = errors.Errorf("consul:%s replied %s", r.addr, resp.Status)
+		return
+	}
+	var entries []*consulEntry
+	if err = json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return
+	}
+	for _, e := range entries {
+		host := e.Service.Address
+		if host == "" {
+			host = e.Node.Address
+		}
+		ip, err := lookupIPv4(ctx, host)
+		if err != nil {
+			log.Warnf("discovery consul service:%s id:%s lookup error:%v", r.service, e.Service.ID, err)
+			continue
+		}
+		servers = append(servers, discoveredServer(ip, e.Service.Port, e.Service.Weights.Passing, strings.Replace(e.Service.ID, " ", "_", -1)))
+	}
+	return
+}
+
+func lookupIPv4(ctx context.Context, host string) (string, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.To4() == nil {
+			return "", errors.Errorf("ip:%s is not ipv4", host)
+		}
+		return host, nil
+	}
+	ips, err := lookupHost(ctx, host)
+	if err != nil {
+		return "", err
+	}
+	for _, ip := range ips {
+		if pip := net.ParseIP(ip); pip != nil && pip.To4() != nil {
+			return ip, nil
+		}
+	}
+	return "", errors.Errorf("host:%s has no ipv4", host)
+}
+
+func discoveredServer(ip string, port, weight int, alias string) string {
+	if weight <= 0 {
+		weight = 1
+	}
+	return fmt.Sprintf("%s:%d:%d %s", ip, port, weight, alias)
+}
+
+// discovery resolves the servers of cluster periodically and applies the
+// membership changes safely.
+type discovery struct {
+	cc *ClusterConfig
+	r  resolver
+
+	lock    sync.Mutex
+	servers []string
+	missing map[string]int
+	closed  bool
+	done    chan struct{}
+}
+
+func newDiscovery(cc *ClusterConfig) (*discovery, error) {
+	r, err := newResolver(cc.Discovery)
+	if err != nil {
+		return nil, err
+	}
+	return &discovery{cc: cc, r: r, missing: make(map[string]int), done: make(chan struct{})}, nil
+}
+
+// init resolves the servers at first, the servers configured are used if
+// failed.
+func (d *discovery) init() error {
+	ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+	defer cancel()
+	servers, err := d.r.resolve(ctx)
+	if err == nil && len(servers) == 0 {
+		err = errors.New("no servers resolved")
+	}
+	if err != nil {
+		if len(d.cc.Servers) == 0 {
+			return errors.Wrapf(err, "discovery:%s", d.cc.Discovery)
+		}
+		log.Warnf("overlord proxy cluster[%s] resolve servers by discovery:%s error:%v and use servers configured", d.cc.Name, d.cc.Discovery, err)
+		servers = d.cc.Servers
+	}
+	d.lock.Lock()
+	d.servers = sortServers(servers)
+	d.lock.Unlock()
+	return nil
+}
+
+// merge merges the servers resolved into the current ones and reports
+// whether they are changed. The nodes are identified by alias, the new
+// nodes and the changed address or weight are applied at once, but the
+// nodes absent are removed only after discoveryRemoveRounds resolutions.
+// Nothing is changed if none resolved, which is more likely a failure of
+// discovery than all nodes gone.
+func (d *discovery) merge(resolved []string) (changed bool) {
+	if len(resolved) == 0 {
+		return false
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	byAlias := make(map[string]string, len(resolved))
+	for _, svr := range resolved {
+		byAlias[serverAlias(svr)] = svr
+	}
+	servers := make([]string, 0, len(resolved))
+	for _, svr := range d.servers {
+		alias := serverAlias(svr)
+		if nsvr, ok := byAlias[alias]; ok {
+			delete(d.missing, alias)
+			delete(byAlias, alias)
+			changed = changed || nsvr != svr
+			servers = append(servers, nsvr)
+			continue
+		}
+		if d.missing[alias]++; d.missing[alias] < discoveryRemoveRounds {
+			servers = append(servers, svr)
+			continue
+		}
+		delete(d.missing, alias)
+		changed = true
+	}
+	for _, svr := range byAlias {
+		servers = append(servers, svr)
+		changed = true
+	}
+	if changed {
+		d.servers = sortServers(servers)
+	}
+	return
+}
+
+// rewrite returns the servers discovered, the servers are kept if none.
+func (d *discovery) rewrite(servers []string) []string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if len(d.servers) == 0 {
+		return servers
+	}
+	return append([]string(nil), d.servers...)
+}
+
+func (d *discovery) close() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if !d.closed {
+		d.closed = true
+		close(d.done)
+	}
+}
+
+func serverAlias(svr string) string {
+	if ss := strings.Split(svr, " "); len(ss) == 2 {
+		return ss[1]
+	}
+	return svr
+}
+
+func sortServers(servers []string) []string {
+	servers = append([]string(nil), servers...)
+	sort.Slice(servers, func(i, j int) bool { return serverAlias(servers[i]) < serverAlias(servers[j]) })
+	return servers
+}
+
+// watchDiscovery resolves the servers of cluster cc each discovery interval
+// and updates the forwarder if changed until the discovery is closed.
+func (p *Proxy) watchDiscovery(cc *ClusterConfig, d *discovery) {
+	ticker := time.NewTicker(time.Duration(cc.DiscoveryInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+		servers, err := d.r.resolve(ctx)
+		cancel()
+		if err != nil {
+			log.Warnf("cluster(%s) resolve servers by discovery:%s error:%v", cc.Name, cc.Discovery, err)
+			continue
+		}
+		if !d.merge(servers) {
+			continue
+		}
+		p.lock.Lock()
+		servers = cc.Servers
+		p.lock.Unlock()
+		if err = p.updateConfig(&ClusterConfig{Name: cc.Name, Servers: servers}); err != nil {
+			log.Errorf("cluster(%s) update discovered servers error:%v", cc.Name, err)
+			continue
+		}
+		log.Infof("cluster(%s) update discovered servers to %v", cc.Name, d.rewrite(nil))
+	}
+}
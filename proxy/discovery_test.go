@@ -0,0 +1,157 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"overlord/pkg/types"
+	"overlord/proxy/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateDiscovery(t *testing.T) {
+	cc := &ClusterConfig{CacheType: types.CacheTypeMemcache, Discovery: "srv://_memcache._tcp.cache.example.com"}
+	assert.NoError(t, cc.validateDiscovery())
+	cc.Servers = []string{"127.0.0.1:11211:1"}
+	assert.Error(t, cc.validateDiscovery())
+	cc.Servers = []string{"127.0.0.1:11211:1 mc1"}
+	assert.NoError(t, cc.validateDiscovery())
+	for _, discovery := range []string{"srv://", "consul://127.0.0.1:8500", "consul://127.0.0.1:8500/a/b", "http://127.0.0.1"} {
+		cc.Discovery = discovery
+		assert.Error(t, cc.validateDiscovery(), discovery)
+	}
+	cc.Discovery = "consul://127.0.0.1:8500/cache?tag=master"
+	assert.NoError(t, cc.validateDiscovery())
+	cc.CacheType = types.CacheTypeRedisCluster
+	assert.Error(t, cc.validateDiscovery())
+}
+
+func TestSRVResolve(t *testing.T) {
+	defer func(srv func(context.Context, string, string, string) (string, []*net.SRV, error), host func(context.Context, string) ([]string, error)) {
+		lookupSRV, lookupHost = srv, host
+	}(lookupSRV, lookupHost)
+	lookupSRV = func(_ context.Context, _, _, name string) (string, []*net.SRV, error) {
+		assert.Equal(t, "_memcache._tcp.cache.example.com", name)
+		return name, []*net.SRV{
+			{Target: "mc-0.cache.example.com.", Port: 11211, Weight: 2},
+			{Target: "mc-1.cache.example.com.", Port: 11211},
+			{Target: "mc-2.cache.example.com.", Port: 11211, Weight: 5},
+			{Target: "mc-2.cache.example.com.", Port: 11212, Weight: 5},
+		}, nil
+	}
+	lookupHost = func(_ context.Context, host string) ([]string, error) {
+		switch host {
+		case "mc-0.cache.example.com":
+			return []string{"::1", "10.0.0.1"}, nil
+		case "mc-2.cache.example.com":
+			return []string{"10.0.0.3"}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host}
+	}
+	r, err := newResolver("srv://_memcache._tcp.cache.example.com")
+	assert.NoError(t, err)
+	servers, err := r.resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"10.0.0.1:11211:2 mc-0.cache.example.com",
+		"10.0.0.3:11211:5 mc-2.cache.example.com:11211",
+		"10.0.0.3:11212:5 mc-2.cache.example.com:11212",
+	}, servers)
+}
+
+func TestConsulResolve(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/health/service/cache", r.URL.Path)
+		assert.Equal(t, "1", r.URL.Query().Get("passing"))
+		assert.Equal(t, "master", r.URL.Query().Get("tag"))
+		assert.Equal(t, "secret", r.Header.Get("X-Consul-Token"))
+		w.Write([]byte(`[
+			{"Node": {"Address": "10.0.0.1"}, "Service": {"ID": "cache-1", "Port": 6379, "Weights": {"Passing": 3}}},
+			{"Node": {"Address": "10.0.0.1"}, "Service": {"ID": "cache 2", "Address": "10.0.0.2", "Port": 6380}}
+		]`))
+	}))
+	defer ts.Close()
+	r, err := newResolver("consul://" + strings.TrimPrefix(ts.URL, "http://") + "/cache?tag=master&token=secret")
+	assert.NoError(t, err)
+	servers, err := r.resolve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1:6379:3 cache-1", "10.0.0.2:6380:1 cache_2"}, servers)
+}
+
+func TestDiscoveryMerge(t *testing.T) {
+	d := &discovery{missing: make(map[string]int), servers: []string{"10.0.0.1:11211:1 a", "10.0.0.2:11211:1 b"}}
+	// nothing resolved is ignored.
+	assert.False(t, d.merge(nil))
+	assert.False(t, d.merge([]string{"10.0.0.2:11211:1 b", "10.0.0.1:11211:1 a"}))
+	// added and changed at once.
+	assert.True(t, d.merge([]string{"10.0.0.1:11211:1 a", "10.0.0.9:11211:2 b", "10.0.0.3:11211:1 c"}))
+	assert.Equal(t, []string{"10.0.0.1:11211:1 a", "10.0.0.9:11211:2 b", "10.0.0.3:11211:1 c"}, d.rewrite(nil))
+	// removed after absent in rounds.
+	assert.False(t, d.merge([]string{"10.0.0.1:11211:1 a", "10.0.0.9:11211:2 b"}))
+	assert.Len(t, d.rewrite(nil), 3)
+	assert.True(t, d.merge([]string{"10.0.0.1:11211:1 a", "10.0.0.9:11211:2 b"}))
+	assert.Equal(t, []string{"10.0.0.1:11211:1 a", "10.0.0.9:11211:2 b"}, d.rewrite(nil))
+	// absent rounds are reset once resolved again.
+	assert.False(t, d.merge([]string{"10.0.0.1:11211:1 a"}))
+	assert.False(t, d.merge([]string{"10.0.0.1:11211:1 a", "10.0.0.9:11211:2 b"}))
+	assert.False(t, d.merge([]string{"10.0.0.1:11211:1 a"}))
+	assert.Len(t, d.rewrite(nil), 2)
+}
+
+type _staticResolver struct {
+	servers chan []string
+}
+
+func (r *_staticResolver) resolve(context.Context) ([]string, error) {
+	return <-r.servers, nil
+}
+
+func TestWatchDiscovery(t *testing.T) {
+	cc := &ClusterConfig{
+		Name:              "discovery",
+		CacheType:         types.CacheTypeMemcache,
+		Discovery:         "srv://_memcache._tcp.cache.example.com",
+		DiscoveryInterval: 1,
+		Servers:           []string{"10.0.0.1:11211:1 a"},
+	}
+	r := &_staticResolver{servers: make(chan []string, 1)}
+	d := &discovery{cc: cc, r: r, missing: make(map[string]int), done: make(chan struct{})}
+	r.servers <- []string{"10.0.0.1:11211:1 a", "10.0.0.2:11211:1 b"}
+	assert.NoError(t, d.init())
+	cc.Servers = d.rewrite(cc.Servers)
+	assert.Equal(t, []string{"10.0.0.1:11211:1 a", "10.0.0.2:11211:1 b"}, cc.Servers)
+
+	f := &_updateForwarder{servers: make(chan []string, 1)}
+	p := &Proxy{ccs: []*ClusterConfig{cc}, forwarders: map[string]proto.Forwarder{cc.Name: f}, discovers: map[string]*discovery{cc.Name: d}}
+	go p.watchDiscovery(cc, d)
+	defer d.close()
+	r.servers <- []string{"10.0.0.1:11211:1 a", "10.0.0.2:11211:1 b", "10.0.0.3:11211:1 c"}
+	select {
+	case servers := <-f.servers:
+		assert.Equal(t, []string{"10.0.0.1:11211:1 a", "10.0.0.2:11211:1 b", "10.0.0.3:11211:1 c"}, servers)
+	case <-time.After(3 * time.Second):
+		t.Fatal("discovery timeout")
+	}
+
+	// the servers of file are replaced by the discovered ones while reload.
+	assert.NoError(t, p.updateConfig(&ClusterConfig{Name: cc.Name, Servers: []string{"10.0.0.1:11211:1 a"}}))
+	assert.Equal(t, []string{"10.0.0.1:11211:1 a", "10.0.0.2:11211:1 b", "10.0.0.3:11211:1 c"}, <-f.servers)
+}
+
+func TestDiscoveryInitFallback(t *testing.T) {
+	cc := &ClusterConfig{Name: "discovery", Discovery: "srv://x", Servers: []string{"10.0.0.1:11211:1 a"}}
+	r := &_staticResolver{servers: make(chan []string, 1)}
+	d := &discovery{cc: cc, r: r, missing: make(map[string]int), done: make(chan struct{})}
+	r.servers <- nil
+	assert.NoError(t, d.init())
+	assert.Equal(t, cc.Servers, d.rewrite(nil))
+	cc.Servers = nil
+	r.servers <- nil
+	assert.Error(t, d.init())
+}
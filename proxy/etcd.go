@@ -0,0 +1,236 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"overlord/pkg/etcd"
+	"overlord/pkg/log"
+	"overlord/pkg/types"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// etcdReloadDelay merges the burst of changes written by one job.
+	etcdReloadDelay = time.Second
+)
+
+// etcdStore is the part of etcd to load cluster configs.
+type etcdStore interface {
+	Get(ctx context.Context, k string) (string, error)
+	LS(ctx context.Context, dir string) ([]*etcd.Node, error)
+}
+
+// etcdClusterInfo is the part of cluster info written by apiserver and
+// scheduler.
+type etcdClusterInfo struct {
+	Name      string
+	CacheType types.CacheType
+}
+
+// DefaultEtcdCluster returns the base config of clusters loaded from etcd
+// which are not configured in bases.
+func DefaultEtcdCluster() *ClusterConfig {
+	return &ClusterConfig{
+		DialTimeout:   1000,
+		ReadTimeout:   1000,
+		WriteTimeout:  1000,
+		PingFailLimit: 3,
+		PingAutoEject: true,
+	}
+}
+
+// LoadEtcdClusterConf loads the clusters of names, or all the clusters if
+// names is empty, from etcd. The cache type, listen port (fe-port), servers
+// and the proxy config written by apiserver are from etcd, the other fields
+// are from the config with same name in bases, or the one without name, or
+// DefaultEtcdCluster. The names of clusters failed to load are returned.
+func LoadEtcdClusterConf(ctx context.Context, s etcdStore, bases []*ClusterConfig, names []string) (ccs []*ClusterConfig, failed []string, err error) {
+	if len(names) == 0 {
+		var nodes []*etcd.Node
+		if nodes, err = s.LS(ctx, etcd.ClusterDir); err != nil {
+			err = errors.WithStack(err)
+			return
+		}
+		for _, node := range nodes {
+			names = append(names, node.Key[strings.LastIndexByte(node.Key, '/')+1:])
+		}
+	}
+	for _, name := range names {
+		base := DefaultEtcdCluster()
+		for _, cc := range bases {
+			if cc.Name == name {
+				base = cc
+				break
+			} else if cc.Name == "" {
+				base = cc
+			}
+		}
+		cc, lerr := loadEtcdCluster(ctx, s, base, name)
+		if lerr != nil {
+			log.Warnf("load cluster:%s from etcd error:%v", name, lerr)
+			failed = append(failed, name)
+			continue
+		}
+		ccs = append(ccs, cc)
+	}
+	return
+}
+
+func loadEtcdCluster(ctx context.Context, s etcdStore, base *ClusterConfig, name string) (cc *ClusterConfig, err error) {
+	val, err := s.Get(ctx, fmt.Sprintf("%s/%s/info", etcd.ClusterDir, name))
+	if err != nil {
+		return
+	}
+	info := &etcdClusterInfo{}
+	if err = json.Unmarshal([]byte(val), info); err != nil {
+		return
+	}
+	port, err := s.Get(ctx, fmt.Sprintf("%s/%s/fe-port", etcd.ClusterDir, name))
+	if err != nil {
+		return
+	}
+	nodes, err := s.LS(ctx, fmt.Sprintf(etcd.ClusterInstancesDir, name))
+	if err != nil {
+		return
+	}
+	cc = &ClusterConfig{}
+	*cc = *base
+	cc.Name = name
+	cc.CacheType = info.CacheType
+	if val, gerr := s.Get(ctx, fmt.Sprintf(etcd.ClusterProxyConf, name)); gerr == nil {
+		pc := &etcd.ProxyConf{}
+		if err = json.Unmarshal([]byte(val), pc); err != nil {
+			return nil, errors.Wrapf(ErrClusterConfInvalid, "cluster:%s proxy:%s", name, val)
+		}
+		cc.applyProxyConf(pc)
+	}
+	if host := strings.Split(cc.ListenAddr, ":")[0]; host != "" {
+		cc.ListenAddr = host + ":" + port
+	} else {
+		cc.ListenAddr = "0.0.0.0:" + port
+	}
+	cc.Servers = make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		if cc.CacheType == types.CacheTypeRedisCluster {
+			cc.Servers = append(cc.Servers, node.Value)
+			continue
+		}
+		weight := 1
+		if w, gerr := s.Get(ctx, fmt.Sprintf("%s/%s/weight", etcd.InstanceDirPrefix, node.Value)); gerr == nil {
+			if weight, err = strconv.Atoi(w); err != nil {
+				return nil, errors.Wrapf(ErrClusterConfInvalid, "node:%s weight:%s", node.Value, w)
+			}
+		}
+		svr := node.Value + ":" + strconv.Itoa(weight)
+		if alias, gerr := s.Get(ctx, fmt.Sprintf("%s/%s/alias", etcd.InstanceDirPrefix, node.Value)); gerr == nil && alias != "" {
+			svr += " " + alias
+		}
+		cc.Servers = append(cc.Servers, svr)
+	}
+	if len(cc.Servers) == 0 {
+		return nil, errors.Wrapf(ErrClusterConfInvalid, "cluster:%s without instances", name)
+	}
+	cc.SetDefault()
+	if err = cc.Validate(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// applyProxyConf overrides the config by the non-zero fields of the proxy
+// config of cluster written by apiserver.
+func (cc *ClusterConfig) applyProxyConf(pc *etcd.ProxyConf) {
+	if pc.HashMethod != "" {
+		cc.HashMethod = pc.HashMethod
+	}
+	if pc.HashDistribution != "" {
+		cc.HashDistribution = pc.HashDistribution
+	}
+	if pc.HashTag != "" {
+		cc.HashTag = pc.HashTag
+	}
+	if pc.DialTimeout > 0 {
+		cc.DialTimeout = pc.DialTimeout
+	}
+	if pc.ReadTimeout > 0 {
+		cc.ReadTimeout = pc.ReadTimeout
+	}
+	if pc.WriteTimeout > 0 {
+		cc.WriteTimeout = pc.WriteTimeout
+	}
+	if pc.NodeConnections > 0 {
+		cc.NodeConnections = pc.NodeConnections
+	}
+	if pc.PingFailLimit > 0 {
+		cc.PingFailLimit = pc.PingFailLimit
+	}
+	if pc.PingAutoEject != nil {
+		cc.PingAutoEject = *pc.PingAutoEject
+	}
+}
+
+// MonitorEtcdChange watches the clusters in etcd and applies the changes
+// in place, the clusters failed to load are kept as they are.
+func (p *Proxy) MonitorEtcdChange(e *etcd.Etcd, bases []*ClusterConfig, names []string) {
+	ctx := context.Background()
+	clusters, err := e.WatchOn(ctx, etcd.ClusterDir)
+	if err != nil {
+		log.Errorf("failed to watch etcd dir:%s error:%v", etcd.ClusterDir, err)
+		return
+	}
+	// NOTE: alias and weight of instances
+	instances, err := e.WatchOn(ctx, etcd.InstanceDirPrefix)
+	if err != nil {
+		log.Errorf("failed to watch etcd dir:%s error:%v", etcd.InstanceDirPrefix, err)
+		return
+	}
+	for {
+		if p.isClosed() {
+			log.Infof("proxy is closed and exit etcd monitor")
+			return
+		}
+		select {
+		case <-clusters:
+		case <-instances:
+		}
+		timer := time.After(etcdReloadDelay)
+	merge:
+		for {
+			select {
+			case <-clusters:
+			case <-instances:
+			case <-timer:
+				break merge
+			}
+		}
+		if err = p.reloadEtcd(ctx, e, bases, names); err != nil {
+			log.Errorf("failed to reload clusters from etcd error:%v", err)
+		}
+	}
+}
+
+// ReloadEtcd reloads the clusters from etcd like MonitorEtcdChange.
+func (p *Proxy) ReloadEtcd(e *etcd.Etcd, bases []*ClusterConfig, names []string) error {
+	return p.reloadEtcd(context.Background(), e, bases, names)
+}
+
+func (p *Proxy) reloadEtcd(ctx context.Context, s etcdStore, bases []*ClusterConfig, names []string) error {
+	ccs, failed, err := LoadEtcdClusterConf(ctx, s, bases, names)
+	if err != nil {
+		return errors.Wrapf(ErrProxyReloadFail, "etcd error:%v", err)
+	}
+	p.lock.Lock()
+	for _, name := range failed {
+		if cc := p.clusterConfig(name); cc != nil {
+			ccs = append(ccs, cc)
+		}
+	}
+	p.lock.Unlock()
+	return p.apply(ccs)
+}
@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"overlord/pkg/etcd"
+	"overlord/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type _etcdStore map[string]string
+
+func (s _etcdStore) Get(ctx context.Context, k string) (string, error) {
+	if v, ok := s[k]; ok {
+		return v, nil
+	}
+	return "", errors.New("key not found")
+}
+
+func (s _etcdStore) LS(ctx context.Context, dir string) (nodes []*etcd.Node, err error) {
+	dir = strings.TrimSuffix(dir, "/") + "/"
+	children := map[string]string{}
+	for k, v := range s {
+		if !strings.HasPrefix(k, dir) {
+			continue
+		}
+		child := strings.SplitN(k[len(dir):], "/", 2)
+		if len(child) == 2 {
+			v = ""
+		}
+		children[dir+child[0]] = v
+	}
+	for k, v := range children {
+		nodes = append(nodes, &etcd.Node{Key: k, Value: v})
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Key < nodes[j].Key })
+	return
+}
+
+func TestLoadEtcdClusterConf(t *testing.T) {
+	s := _etcdStore{
+		"/overlord/clusters/mc/info":                 `{"Name":"mc","CacheType":"memcache","Number":2}`,
+		"/overlord/clusters/mc/fe-port":              "21211",
+		"/overlord/clusters/mc/instances/01":         "127.0.0.1:11211",
+		"/overlord/clusters/mc/instances/02":         "127.0.0.1:11212",
+		"/overlord/instances/127.0.0.1:11211/alias":  "mc1",
+		"/overlord/instances/127.0.0.1:11211/weight": "2",
+		"/overlord/instances/127.0.0.1:11212/alias":  "mc2",
+		"/overlord/clusters/rc/info":                 `{"Name":"rc","CacheType":"redis_cluster"}`,
+		"/overlord/clusters/rc/fe-port":              "26379",
+		"/overlord/clusters/rc/instances/01":         "127.0.0.1:7000",
+		"/overlord/clusters/creating/info":           `{"Name":"creating","CacheType":"redis"}`,
+	}
+	bases := []*ClusterConfig{{Name: "mc", ListenAddr: "127.0.0.1:1", DialTimeout: 100, NodeConnections: 1}}
+	ccs, failed, err := LoadEtcdClusterConf(context.TODO(), s, bases, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"creating"}, failed)
+	assert.Len(t, ccs, 2)
+
+	mc := ccs[0]
+	assert.Equal(t, types.CacheTypeMemcache, mc.CacheType)
+	assert.Equal(t, "127.0.0.1:21211", mc.ListenAddr)
+	assert.Equal(t, 100, mc.DialTimeout)
+	assert.Equal(t, int32(1), mc.NodeConnections)
+	assert.Equal(t, []string{"127.0.0.1:11211:2 mc1", "127.0.0.1:11212:1 mc2"}, mc.Servers)
+	assert.Equal(t, "127.0.0.1:1", bases[0].ListenAddr, "base is not changed")
+
+	rc := ccs[1]
+	assert.Equal(t, types.CacheTypeRedisCluster, rc.CacheType)
+	assert.Equal(t, "0.0.0.0:26379", rc.ListenAddr)
+	assert.Equal(t, 1000, rc.DialTimeout)
+	assert.Equal(t, []string{"127.0.0.1:7000"}, rc.Servers)
+
+	ccs, failed, err = LoadEtcdClusterConf(context.TODO(), s, nil, []string{"mc", "unknown"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"unknown"}, failed)
+	assert.Len(t, ccs, 1)
+}
+
+func TestLoadEtcdProxyConf(t *testing.T) {
+	s := _etcdStore{
+		"/overlord/clusters/mc/info":         `{"Name":"mc","CacheType":"memcache"}`,
+		"/overlord/clusters/mc/fe-port":      "21211",
+		"/overlord/clusters/mc/proxy":        `{"hash_method":"fnv1a_32","hash_distribution":"ketama","dial_timeout":200,"node_connections":4,"ping_auto_eject":false}`,
+		"/overlord/clusters/mc/instances/01": "127.0.0.1:11211",
+	}
+	bases := []*ClusterConfig{{DialTimeout: 100, ReadTimeout: 300, PingAutoEject: true}}
+	ccs, failed, err := LoadEtcdClusterConf(context.TODO(), s, bases, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, failed)
+	assert.Len(t, ccs, 1)
+	mc := ccs[0]
+	assert.Equal(t, "fnv1a_32", mc.HashMethod)
+	assert.Equal(t, "ketama", mc.HashDistribution)
+	assert.Equal(t, 200, mc.DialTimeout)
+	assert.Equal(t, 300, mc.ReadTimeout)
+	assert.Equal(t, int32(4), mc.NodeConnections)
+	assert.False(t, mc.PingAutoEject)
+	assert.Equal(t, 100, bases[0].DialTimeout, "base is not changed")
+
+	s["/overlord/clusters/mc/proxy"] = "{"
+	_, failed, err = LoadEtcdClusterConf(context.TODO(), s, bases, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"mc"}, failed)
+}
+
+func TestProxyReloadEtcdKeepFailed(t *testing.T) {
+	p, f := _adminProxy("127.0.0.1:6379:1 r1")
+	s := _etcdStore{
+		"/overlord/clusters/admin/info":            `{"Name":"admin","CacheType":"redis"}`,
+		"/overlord/clusters/admin/fe-port":         "26379",
+		"/overlord/clusters/admin/instances/01":    "127.0.0.1:6380",
+		"/overlord/instances/127.0.0.1:6380/alias": "r1",
+	}
+	p.ccs[0].ListenAddr = "0.0.0.0:26379"
+	p.ccs[0].SetDefault()
+	base := *p.ccs[0]
+	assert.NoError(t, p.reloadEtcd(context.TODO(), s, []*ClusterConfig{&base}, nil))
+	assert.Equal(t, []string{"127.0.0.1:6380:1 r1"}, <-f.servers)
+
+	// NOTE: the cluster failed to load is kept
+	delete(s, "/overlord/clusters/admin/instances/01")
+	s["/overlord/clusters/admin/instances"] = ""
+	assert.NoError(t, p.reloadEtcd(context.TODO(), s, []*ClusterConfig{&base}, []string{"admin"}))
+	assert.Len(t, p.ccs, 1)
+	assert.Equal(t, []string{"127.0.0.1:6380:1 r1"}, p.ccs[0].Servers)
+}
@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"overlord/pkg/prom"
+	"overlord/proxy/proto"
+)
+
+// fallbacker reads the missed gets of a cluster from its fallback cluster
+// such as the old cluster migrated from, the values found are answered and
+// filled back into the cluster with ttl without waiting.
+type fallbacker struct {
+	p        *Proxy
+	cluster  string
+	fallback string
+	ttl      time.Duration
+
+	hits, misses, failed int64
+}
+
+func newFallbacker(p *Proxy, cc *ClusterConfig) *fallbacker {
+	if cc.FallbackCluster == "" {
+		return nil
+	}
+	return &fallbacker{
+		p:        p,
+		cluster:  cc.Name,
+		fallback: cc.FallbackCluster,
+		ttl:      time.Duration(cc.FallbackTTL) * time.Millisecond,
+	}
+}
+
+// answer reads the missed gets of msgs from the fallback cluster and waits,
+// the values found are filled back by forwarder.
+func (fb *fallbacker) answer(forwarder proto.Forwarder, msgs []*proto.Message) {
+	var (
+		reqs []proto.Fallbacker
+		cms  []*proto.Message
+		wg   = &sync.WaitGroup{}
+	)
+	for _, m := range msgs {
+		if m.Err() != nil {
+			continue
+		}
+		for _, req := range m.Requests() {
+			r, ok := req.(proto.Fallbacker)
+			if !ok || !r.Missed() {
+				continue
+			}
+			cm := proto.NewMessage()
+			cm.Type = m.Type
+			cm.WithRequest(r.Fallback())
+			cm.WithWaitGroup(wg)
+			reqs = append(reqs, r)
+			cms = append(cms, cm)
+		}
+	}
+	if len(cms) == 0 {
+		return
+	}
+	f, ok := fb.p.forwarder(fb.fallback)
+	if !ok {
+		for _, cm := range cms {
+			cm.Request().Put()
+		}
+		fb.count(&fb.failed, "fallback failed", len(cms))
+		return
+	}
+	_ = f.Forward(cms)
+	wg.Wait()
+	var (
+		fms    []*proto.Message
+		fwg    = &sync.WaitGroup{}
+		misses int
+		failed int
+	)
+	for i, cm := range cms {
+		if cm.Err() != nil {
+			failed++
+		} else if w := reqs[i].Answer(cm.Request(), fb.ttl); w != nil {
+			fm := proto.NewMessage()
+			fm.Type = cm.Type
+			fm.WithRequest(w)
+			fm.WithWaitGroup(fwg)
+			fms = append(fms, fm)
+		} else {
+			misses++
+		}
+		cm.Request().Put()
+	}
+	atomic.AddInt64(&fb.hits, int64(len(fms)))
+	atomic.AddInt64(&fb.misses, int64(misses))
+	if failed > 0 {
+		fb.count(&fb.failed, "fallback failed", failed)
+	}
+	if len(fms) > 0 {
+		go fb.fill(forwarder, fms, fwg)
+	}
+}
+
+// fill writes the values read from the fallback cluster back into cluster.
+func (fb *fallbacker) fill(forwarder proto.Forwarder, fms []*proto.Message, wg *sync.WaitGroup) {
+	_ = forwarder.Forward(fms)
+	wg.Wait()
+	var failed int
+	for _, fm := range fms {
+		if fm.Err() != nil {
+			failed++
+		}
+		fm.Request().Put()
+	}
+	if failed > 0 && prom.On {
+		prom.ErrAdd(fb.cluster, "", "", "fallback fill failed", failed)
+	}
+}
+
+func (fb *fallbacker) count(n *int64, err string, delta int) {
+	atomic.AddInt64(n, int64(delta))
+	if prom.On {
+		prom.ErrAdd(fb.cluster, fb.fallback, "", err, delta)
+	}
+}
@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"overlord/pkg/types"
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/redis"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type _fallbackForwarder struct {
+	_updateForwarder
+	keys []string
+}
+
+func (f *_fallbackForwarder) Forward(msgs []*proto.Message) error {
+	for _, m := range msgs {
+		key := string(m.Request().Key())
+		f.keys = append(f.keys, key)
+		switch key {
+		case "a":
+			m.Request().(*redis.Request).Reply().SetBulk([]byte("va"))
+		case "bad":
+			m.WithError(errors.New("mock error"))
+		default:
+			m.Request().(*redis.Request).Reply().SetNullBulk()
+		}
+	}
+	return nil
+}
+
+func TestFallbackerAnswer(t *testing.T) {
+	assert.Nil(t, newFallbacker(nil, &ClusterConfig{}))
+	ff := &_fallbackForwarder{}
+	p := &Proxy{forwarders: map[string]proto.Forwarder{"b": ff}}
+	fb := newFallbacker(p, &ClusterConfig{Name: "a", FallbackCluster: "b", FallbackTTL: 1000})
+	assert.Equal(t, time.Second, fb.ttl)
+
+	msgs := decodeTx(t, "GET a\r\nGET b\r\nGET bad\r\nGET c\r\nSET d 1\r\n", 5)
+	for _, m := range msgs[:3] {
+		m.Request().(*redis.Request).Reply().SetNullBulk()
+	}
+	msgs[3].Request().(*redis.Request).Reply().SetBulk([]byte("vc"))
+	msgs[4].Request().(*redis.Request).Reply().SetString([]byte("OK"))
+	sf := &_shadowForwarder{}
+	fb.answer(sf, msgs)
+	assert.Equal(t, []string{"a", "b", "bad"}, ff.keys)
+	assert.Equal(t, "2\r\nva", string(msgs[0].Request().(*redis.Request).Reply().Data()))
+	assert.Equal(t, int64(1), atomic.LoadInt64(&fb.hits))
+	assert.Equal(t, int64(1), atomic.LoadInt64(&fb.misses))
+	assert.Equal(t, int64(1), atomic.LoadInt64(&fb.failed))
+	for i := 0; i < 100 && len(sf.forwarded()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, []string{"a"}, sf.forwarded())
+
+	fb = newFallbacker(p, &ClusterConfig{Name: "a", FallbackCluster: "c"})
+	msgs = decodeTx(t, "GET a\r\n", 1)
+	msgs[0].Request().(*redis.Request).Reply().SetNullBulk()
+	fb.answer(sf, msgs)
+	assert.Equal(t, int64(1), atomic.LoadInt64(&fb.failed))
+}
+
+func TestValidateFallback(t *testing.T) {
+	ccs := []*ClusterConfig{
+		{Name: "a", CacheType: types.CacheTypeRedis, FallbackCluster: "b"},
+		{Name: "b", CacheType: types.CacheTypeRedisCluster},
+	}
+	assert.NoError(t, validateFallback(ccs))
+	ccs[1].CacheType = types.CacheTypeMemcache
+	assert.Error(t, validateFallback(ccs))
+	ccs[0].FallbackCluster = "c"
+	assert.Error(t, validateFallback(ccs))
+}
@@ -0,0 +1,259 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// formats of config file detected by the extension, toml by default.
+const (
+	formatTOML = "toml"
+	formatYAML = "yaml"
+	formatJSON = "json"
+)
+
+// envVar matches ${VAR} and ${VAR:-default}, and $${ escapes ${.
+var envVar = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(:-[^}]*)?\}`)
+
+func configFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return formatYAML
+	case ".json":
+		return formatJSON
+	}
+	return formatTOML
+}
+
+// decodeFile decodes the config file of path into v by its format, and
+// expands the environment variables in the string values, and then applies
+// the overrides. The config is set by the overrides only if path is empty.
+func decodeFile(path string, v interface{}) error {
+	if path == "" && len(overrides) > 0 {
+		return ApplyOverrides(v)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "Load From File:%s", path)
+	}
+	if err = decodeConfig(configFormat(path), data, v); err != nil {
+		return errors.Wrapf(err, "Load From File:%s", path)
+	}
+	if err = expandEnv(reflect.ValueOf(v)); err != nil {
+		return errors.Wrapf(err, "Load From File:%s", path)
+	}
+	return ApplyOverrides(v)
+}
+
+// decodeConfig decodes data of format into v. The keys of yaml and json are
+// the same as toml, so they are converted into toml and then decoded.
+func decodeConfig(format string, data []byte, v interface{}) error {
+	if format == formatTOML {
+		_, err := toml.Decode(string(data), v)
+		return err
+	}
+	m, err := genericConfig(format, data, reflect.TypeOf(v))
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	if err = toml.NewEncoder(buf).Encode(m); err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = toml.Decode(buf.String(), v)
+	return err
+}
+
+// genericConfig decodes data of format into the map of keys, and the numbers
+// are converted into the kinds of the fields of t which they are decoded into.
+func genericConfig(format string, data []byte, t reflect.Type) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+	switch format {
+	case formatTOML:
+		if _, err := toml.Decode(string(data), &m); err != nil {
+			return nil, err
+		}
+		return m, nil
+	case formatYAML:
+		if err := yaml.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+	case formatJSON:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&m); err != nil {
+			return nil, err
+		}
+	}
+	return normalize(m, t).(map[string]interface{}), nil
+}
+
+// normalize converts the value v of yaml or json into the value of toml,
+// which decodes into the field of type t, t is nil if it's unknown.
+func normalize(v interface{}, t reflect.Type) interface{} {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var float, integer bool
+	if t != nil {
+		switch t.Kind() {
+		case reflect.Float32, reflect.Float64:
+			float = true
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			integer = true
+		}
+	}
+	switch vv := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(vv))
+		for k, e := range vv {
+			m[fmt.Sprint(k)] = e
+		}
+		return normalize(m, t)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(vv))
+		for k, e := range vv {
+			if e == nil {
+				continue
+			}
+			var ft reflect.Type
+			if t != nil && t.Kind() == reflect.Struct {
+				ft, _ = tomlField(t, k)
+			}
+			m[k] = normalize(e, ft)
+		}
+		return m
+	case []interface{}:
+		var et reflect.Type
+		if t != nil && t.Kind() == reflect.Slice {
+			et = t.Elem()
+		}
+		s := make([]interface{}, 0, len(vv))
+		tables := make([]map[string]interface{}, 0, len(vv))
+		for _, e := range vv {
+			e = normalize(e, et)
+			if m, ok := e.(map[string]interface{}); ok {
+				tables = append(tables, m)
+			}
+			s = append(s, e)
+		}
+		if len(vv) > 0 && len(tables) == len(vv) {
+			// NOTE: encoded as the array of tables.
+			return tables
+		}
+		return s
+	case json.Number:
+		if i, err := vv.Int64(); err == nil && !float {
+			return i
+		}
+		f, _ := vv.Float64()
+		return normalize(f, t)
+	case int:
+		return normalize(int64(vv), t)
+	case uint64:
+		return normalize(int64(vv), t)
+	case int64:
+		if float {
+			return float64(vv)
+		}
+		return vv
+	case float64:
+		if integer && vv == math.Trunc(vv) {
+			return int64(vv)
+		}
+		return vv
+	}
+	return v
+}
+
+// encodeConfig encodes v into the format.
+func encodeConfig(format string, v interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := toml.NewEncoder(buf).Encode(v); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if format == formatTOML {
+		return buf.Bytes(), nil
+	}
+	m := map[string]interface{}{}
+	if _, err := toml.Decode(buf.String(), &m); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if format == formatYAML {
+		data, err := yaml.Marshal(m)
+		return data, errors.WithStack(err)
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	return data, errors.WithStack(err)
+}
+
+// expandEnv replaces ${VAR} in the string values of v by the environment
+// variable VAR, or the default of ${VAR:-default} if it's unset or empty.
+// It's an error if VAR is unset without default.
+func expandEnv(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			return expandEnv(v.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath != "" {
+				continue
+			}
+			if err := expandEnv(v.Field(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := expandEnv(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.String:
+		s, err := expandString(v.String())
+		if err != nil {
+			return err
+		}
+		if v.CanSet() {
+			v.SetString(s)
+		}
+	}
+	return nil
+}
+
+func expandString(s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var err error
+	s = envVar.ReplaceAllStringFunc(s, func(m string) string {
+		if strings.HasPrefix(m, "$$") {
+			return m[1:]
+		}
+		sm := envVar.FindStringSubmatch(m)
+		val, ok := os.LookupEnv(sm[1])
+		if sm[2] != "" && val == "" {
+			return sm[2][2:]
+		}
+		if !ok && err == nil {
+			err = errors.Wrapf(ErrConfInvalid, "environment variable %s is not set", sm[1])
+		}
+		return val
+	})
+	return s, err
+}
@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"overlord/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const yamlCluster = `
+clusters:
+  - name: test-mc
+    cache_type: memcache
+    listen_addr: 0.0.0.0:21211
+    node_connections: 4
+    access_log_sample_rate: 1
+    redis_auth: ${OVERLORD_TEST_AUTH}
+    servers:
+      - ${OVERLORD_TEST_HOST:-127.0.0.1}:11211:1
+  - name: test-redis
+    cache_type: redis
+    listen_addr: 0.0.0.0:26379
+    servers: ["127.0.0.1:6379:1"]
+`
+
+const jsonCluster = `{
+  "clusters": [
+    {
+      "name": "test-mc",
+      "cache_type": "memcache",
+      "listen_addr": "0.0.0.0:21211",
+      "node_connections": 4,
+      "access_log_sample_rate": 1,
+      "redis_auth": "${OVERLORD_TEST_AUTH}",
+      "servers": ["${OVERLORD_TEST_HOST:-127.0.0.1}:11211:1"]
+    }
+  ]
+}`
+
+func TestLoadClusterConfFormats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overlord-format")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("OVERLORD_TEST_AUTH", "secret")
+	defer os.Unsetenv("OVERLORD_TEST_AUTH")
+
+	for _, name := range []string{"cluster.yaml", "cluster.json"} {
+		data := yamlCluster
+		if name == "cluster.json" {
+			data = jsonCluster
+		}
+		path := writeConf(t, dir, name, data)
+		ccs, err := LoadClusterConf(path)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		cc := ccs[0]
+		assert.Equal(t, "test-mc", cc.Name)
+		assert.Equal(t, types.CacheTypeMemcache, cc.CacheType)
+		assert.Equal(t, int32(4), cc.NodeConnections)
+		assert.Equal(t, 1.0, cc.AccessLogSampleRate)
+		assert.Equal(t, "secret", cc.RedisAuth)
+		assert.Equal(t, []string{"127.0.0.1:11211:1"}, cc.Servers)
+		assert.Empty(t, CheckConfig("", path), name)
+
+		// rewritten in the same format and the variables are kept.
+		assert.NoError(t, persistServers(path, "test-mc", []string{"127.0.0.2:11211:1"}))
+		cs, err := readClusterConfigs(path)
+		assert.NoError(t, err)
+		assert.Equal(t, "${OVERLORD_TEST_AUTH}", cs.Clusters[0].RedisAuth)
+		ccs, err = LoadClusterConf(path)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"127.0.0.2:11211:1"}, ccs[0].Servers)
+	}
+
+	os.Unsetenv("OVERLORD_TEST_AUTH")
+	path := writeConf(t, dir, "unset.yml", yamlCluster)
+	_, err = LoadClusterConf(path)
+	assert.Error(t, err)
+	assert.Len(t, CheckConfig("", path), 1)
+}
+
+func TestExpandString(t *testing.T) {
+	os.Setenv("OVERLORD_TEST_VAR", "v")
+	defer os.Unsetenv("OVERLORD_TEST_VAR")
+	for in, out := range map[string]string{
+		"plain":                        "plain",
+		"a-${OVERLORD_TEST_VAR}-b":     "a-v-b",
+		"${OVERLORD_TEST_VAR:-d}":      "v",
+		"${OVERLORD_TEST_UNSET:-d}":    "d",
+		"${OVERLORD_TEST_UNSET:-}":     "",
+		"$${OVERLORD_TEST_VAR}":        "${OVERLORD_TEST_VAR}",
+		"$OVERLORD_TEST_VAR and ${ x}": "$OVERLORD_TEST_VAR and ${ x}",
+	} {
+		s, err := expandString(in)
+		assert.NoError(t, err, in)
+		assert.Equal(t, out, s, in)
+	}
+	_, err := expandString("${OVERLORD_TEST_UNSET}")
+	assert.Error(t, err)
+}
+
+func TestConfigFormat(t *testing.T) {
+	assert.Equal(t, formatTOML, configFormat("proxy.toml"))
+	assert.Equal(t, formatTOML, configFormat("proxy.conf"))
+	assert.Equal(t, formatYAML, configFormat(filepath.Join("conf", "proxy.YML")))
+	assert.Equal(t, formatJSON, configFormat("proxy.json"))
+}
@@ -1,7 +1,6 @@
 package proxy
 
 import (
-	"bytes"
 	"context"
 	errs "errors"
 	"net"
@@ -35,6 +34,7 @@ var (
 	ErrForwarderHashNoNode = errs.New("forwarder hash no hit node")
 	ErrForwarderClosed     = errs.New("forwarder already closed")
 	ErrConnectionNotExist  = errs.New("connection of forwarder is not initialized")
+	ErrForwarderPinBackend = errs.New("forwarder pin not support by memcache backend")
 )
 
 var (
@@ -55,7 +55,8 @@ func NewForwarder(cc *ClusterConfig) proto.Forwarder {
 		dto := time.Duration(cc.DialTimeout) * time.Millisecond
 		rto := time.Duration(cc.ReadTimeout) * time.Millisecond
 		wto := time.Duration(cc.WriteTimeout) * time.Millisecond
-		return rclstr.NewForwarder(cc.Name, cc.ListenAddr, cc.Servers, cc.NodeConnections, cc.NodePipeCount, dto, rto, wto, []byte(cc.HashTag))
+		refresh := time.Duration(cc.ClusterRefreshInterval) * time.Second
+		return rclstr.NewForwarder(cc.Name, cc.ListenAddr, cc.Servers, cc.NodeConnections, cc.NodePipeCount, dto, rto, wto, refresh, []byte(cc.HashTag), cc.RedisAuth, cc.ReadPreference, newWorkerPool(cc))
 	}
 	panic("unsupported protocol")
 }
@@ -66,6 +67,8 @@ type defaultForwarder struct {
 	hashTag []byte
 	conns   atomic.Value
 	state   int32
+	// pool serves the node conns by shared workers if not nil.
+	pool *proto.WorkerPool
 }
 
 // newDefaultForwarder must combinf.
@@ -77,7 +80,9 @@ func newDefaultForwarder(cc *ClusterConfig) proto.Forwarder {
 	if err != nil {
 		panic(err)
 	}
+	f.pool = newWorkerPool(cc)
 	conns := newConnections(cc)
+	conns.pool = f.pool
 	conns.init(addrs, ans, ws, alias, nil)
 	conns.startPinger()
 	f.conns.Store(conns)
@@ -111,6 +116,27 @@ func (f *defaultForwarder) Forward(msgs []*proto.Message) error {
 			}
 			f.batchPush(ctxMap)
 		} else {
+			if req, ok := m.Request().(*redis.Request); ok && req.IsMultiKey() && !req.CheckKeys(conns.route(f.trimHashTag)) {
+				continue
+			}
+			if req, ok := m.Request().(*redis.Request); ok && req.IsScan() {
+				// NOTE: SCAN iterates nodes one by one in the order of config.
+				if idx, ok := req.ScanNode(len(conns.addrs)); ok {
+					m.MarkStartPipe()
+					conns.nodePipe[conns.addrs[idx]].Push(m)
+				}
+				continue
+			}
+			if req, ok := m.Request().(*memcache.MCRequest); ok && req.IsStats() && len(conns.addrs) > 1 {
+				memcache.WithStatsReqs(m, len(conns.addrs))
+				f.forwardAll(conns, m)
+				continue
+			}
+			if req, ok := m.Request().(*redis.Request); ok && req.IsInfo() {
+				redis.WithInfoReqs(m, len(conns.addrs))
+				f.forwardAll(conns, m)
+				continue
+			}
 			key := m.Request().Key()
 			ncp, ok := conns.getPipes(f.trimHashTag(key))
 			if !ok {
@@ -124,6 +150,45 @@ func (f *defaultForwarder) Forward(msgs []*proto.Message) error {
 	return nil
 }
 
+// Pin impl proto.Pinner, the pinned conn never timeout when reading
+// because it's used to wait pushed messages.
+func (f *defaultForwarder) Pin(key []byte) (*libnet.Conn, error) {
+	if closed := atomic.LoadInt32(&f.state); closed == forwarderStateClosed {
+		return nil, ErrForwarderClosed
+	}
+	if f.cc.BackendType == types.CacheTypeMemcache {
+		// NOTE: pubsub and blocking commands can't be translated into memcache
+		return nil, errors.WithStack(ErrForwarderPinBackend)
+	}
+	conns, ok := f.conns.Load().(*connections)
+	if !ok {
+		return nil, errors.WithStack(ErrConnectionNotExist)
+	}
+	addr, ok := conns.getAddr(f.trimHashTag(key))
+	if !ok {
+		return nil, errors.WithStack(ErrForwarderHashNoNode)
+	}
+	dto := time.Duration(f.cc.DialTimeout) * time.Millisecond
+	wto := time.Duration(f.cc.WriteTimeout) * time.Millisecond
+	conn := libnet.DialWithTimeout(addr, dto, 0, wto)
+	if f.cc.CacheType == types.CacheTypeRedis {
+		if err := redis.Prepare(conn, f.cc.RedisAuth, f.cc.DB); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// Route impl proto.Router by the node of key.
+func (f *defaultForwarder) Route(key []byte) string {
+	conns, ok := f.conns.Load().(*connections)
+	if !ok {
+		return ""
+	}
+	return conns.route(f.trimHashTag)(key)
+}
+
 func (f *defaultForwarder) Update(servers []string) error {
 	addrs, ws, ans, alias, err := parseServers(servers)
 	if err != nil {
@@ -134,6 +199,7 @@ func (f *defaultForwarder) Update(servers []string) error {
 		return errors.WithStack(ErrConnectionNotExist)
 	}
 	newConns := newConnections(f.cc)
+	newConns.pool = f.pool
 	copyed := newConns.init(addrs, ans, ws, alias, oldConns.nodePipe)
 	f.conns.Store(newConns)
 	oldConns.cancel()
@@ -161,11 +227,48 @@ func (f *defaultForwarder) Close() error {
 			go np.Close()
 		}
 		curConns.cancel()
+		if f.pool != nil {
+			f.pool.Close()
+		}
 		return nil
 	}
 	return nil
 }
 
+// NodeStats impl proto.NodeStater in the order of config.
+func (f *defaultForwarder) NodeStats() (nss []*proto.NodeStat) {
+	conns, ok := f.conns.Load().(*connections)
+	if !ok {
+		return
+	}
+	for idx, addr := range conns.addrs {
+		ns := &proto.NodeStat{Addr: addr, Alias: addr, Role: "master", Up: true}
+		if conns.alias {
+			ns.Alias = conns.ans[idx]
+		}
+		if p, ok := conns.pingers[addr]; ok {
+			ns.Up = !p.isEjected()
+		}
+		if ncp, ok := conns.nodePipe[addr]; ok {
+			ns.Conns, ns.Busy, ns.Queued = ncp.Stats()
+			ns.Breaker = ncp.BreakerState()
+			ns.ReadTimeout = ncp.ReadTimeout()
+			ns.Latency = ncp.Latency()
+		}
+		nss = append(nss, ns)
+	}
+	return
+}
+
+// forwardAll sends the requests of m to all nodes in the order of config
+// as batch, the replies are merged when encoding.
+func (f *defaultForwarder) forwardAll(conns *connections, m *proto.Message) {
+	for i, subm := range m.Batch() {
+		subm.MarkStartPipe()
+		conns.nodePipe[conns.addrs[i]].Push(subm)
+	}
+}
+
 func (f *defaultForwarder) batchPush(ctxMap map[string]*nodeConnPipeContext) {
 	for _, ctx := range ctxMap {
 		mainMsg := ctx.msgs[0]
@@ -182,18 +285,7 @@ func (f *defaultForwarder) batchPush(ctxMap map[string]*nodeConnPipeContext) {
 }
 
 func (f *defaultForwarder) trimHashTag(key []byte) []byte {
-	if len(f.hashTag) != 2 {
-		return key
-	}
-	bidx := bytes.IndexByte(key, f.hashTag[0])
-	if bidx == -1 {
-		return key
-	}
-	eidx := bytes.IndexByte(key[bidx+1:], f.hashTag[1])
-	if eidx == -1 {
-		return key
-	}
-	return key[bidx+1 : bidx+1+eidx]
+	return hashkit.TrimHashTag(key, f.hashTag)
 }
 
 type connections struct {
@@ -207,6 +299,8 @@ type connections struct {
 	aliasMap   map[string]string
 	nodePipe   map[string]*proto.NodeConnPipe
 	ring       *hashkit.HashRing
+	pool       *proto.WorkerPool
+	pingers    map[string]*pinger
 }
 
 func newConnections(cc *ClusterConfig) *connections {
@@ -241,9 +335,37 @@ func (c *connections) init(addrs, ans []string, ws []int, alias bool, oldNcps ma
 			c.nodePipe[toAddr] = cnn
 			copyed[toAddr] = true
 		} else {
-			c.nodePipe[toAddr] = proto.NewNodeConnPipe(c.cc.NodeConnections, c.cc.NodePipeCount, func() proto.NodeConn {
+			newNc := func() proto.NodeConn {
 				return newNodeConn(c.cc, toAddr)
-			})
+			}
+			var ncp *proto.NodeConnPipe
+			if c.pool != nil {
+				ncp = c.pool.NewNodeConnPipe(c.cc.NodeConnections, c.cc.NodeMaxConnections, c.cc.NodePipeCount, c.cc.NodeWaitQueue, newNc)
+			} else {
+				idle := time.Duration(c.cc.NodeIdleTimeout) * time.Millisecond
+				ncp = proto.NewNodeConnPool(c.cc.NodeConnections, c.cc.NodeMaxConnections, c.cc.NodePipeCount, c.cc.NodeWaitQueue, idle, newNc)
+			}
+			ncp.SetBatch(c.cc.NodeBatchCount, time.Duration(c.cc.NodeBatchWait)*time.Microsecond)
+			if c.cc.BreakerErrors > 0 {
+				ncp.SetBreaker(proto.NewBreaker(c.cc.Name, toAddr, c.cc.BreakerErrors,
+					time.Duration(c.cc.BreakerSlow)*time.Millisecond, time.Duration(c.cc.BreakerTimeout)*time.Millisecond))
+			}
+			if c.cc.ReadTimeoutFactor > 0 {
+				ncp.SetTimeout(proto.NewAdaptiveTimeout(c.cc.Name, toAddr, c.cc.ReadTimeoutFactor,
+					time.Duration(c.cc.ReadTimeoutMin)*time.Millisecond, time.Duration(c.cc.ReadTimeoutMax)*time.Millisecond))
+			}
+			c.nodePipe[toAddr] = ncp
+		}
+	}
+	if c.cc.PingAutoEject {
+		// NOTE: created before stored for NodeStats, started later
+		c.pingers = make(map[string]*pinger, len(addrs))
+		for idx, addr := range addrs {
+			p := &pinger{cc: c.cc, addr: addr, alias: addr, weight: ws[idx]}
+			if alias {
+				p.alias = ans[idx]
+			}
+			c.pingers[addr] = p
 		}
 	}
 	return copyed
@@ -255,20 +377,33 @@ type nodeConnPipeContext struct {
 	msgs       []*proto.Message
 }
 
-func (c *connections) getPipes(key []byte) (ncp *proto.NodeConnPipe, ok bool) {
-	var addr string
+func (c *connections) getAddr(key []byte) (addr string, ok bool) {
 	if addr, ok = c.ring.GetNode(key); !ok {
 		return
 	}
 	if c.alias {
-		if addr, ok = c.aliasMap[addr]; !ok {
-			return
-		}
+		addr, ok = c.aliasMap[addr]
+	}
+	return
+}
+
+func (c *connections) getPipes(key []byte) (ncp *proto.NodeConnPipe, ok bool) {
+	var addr string
+	if addr, ok = c.getAddr(key); !ok {
+		return
 	}
 	ncp, ok = c.nodePipe[addr]
 	return
 }
 
+// route returns the func which maps key to the node name.
+func (c *connections) route(trim func([]byte) []byte) func([]byte) string {
+	return func(key []byte) string {
+		node, _ := c.ring.GetNode(trim(key))
+		return node
+	}
+}
+
 func (c *connections) getPipesContext(key []byte) (ctx *nodeConnPipeContext, ok bool) {
 	var addr string
 	if addr, ok = c.ring.GetNode(key); !ok {
@@ -294,80 +429,119 @@ func (c *connections) startPinger() {
 	if !c.cc.PingAutoEject {
 		return
 	}
-	for idx, addr := range c.addrs {
-		p := &pinger{cc: c.cc, addr: addr, alias: addr, weight: c.ws[idx]}
-		if c.alias {
-			p.alias = c.ans[idx]
-		}
-		go c.processPing(p)
+	for addr, p := range c.pingers {
+		go c.processPing(p, c.nodePipe[addr].ErrorEvent())
 	}
 }
 
-// pingSleepTime for unit test override!!!
-var pingSleepTime = func(t bool) time.Duration {
-	if t {
-		return 5 * time.Minute
+// processPing checks the node by ping every ping_interval and by the errors
+// of requests, the node is ejected from ring after ping_fail_limit failures
+// in a row and pinged again after server_retry_timeout to be readded.
+func (c *connections) processPing(p *pinger, reqErrs <-chan error) {
+	interval := time.Duration(c.cc.PingInterval) * time.Millisecond
+	retry := time.Duration(c.cc.ServerRetryTimeout) * time.Millisecond
+	if interval <= 0 {
+		interval = time.Second
+	}
+	if retry <= 0 {
+		retry = interval
 	}
-	return time.Second
-}
-
-func (c *connections) processPing(p *pinger) {
-	var (
-		err error
-		del bool
-	)
 	p.ping = newPingConn(p.cc, p.addr)
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
 	for {
 		select {
 		case <-c.ctx.Done():
 			_ = p.ping.Close()
 			log.Infof("node:%s addr:%s pinger is closed return directly", p.alias, p.addr)
 			return
-		default:
-			err = p.ping.Ping()
-			if err == nil {
-				p.failure = 0
-				if del {
-					del = false
-					c.ring.AddNode(p.alias, p.weight)
-					if log.V(4) {
-						log.Infof("node ping node:%s addr:%s success and readd", p.alias, p.addr)
-					}
-				}
-				time.Sleep(pingSleepTime(false))
+		case err, ok := <-reqErrs:
+			if !ok {
+				reqErrs = nil
 				continue
-			} else {
-				_ = p.ping.Close()
-				if prom.On {
-					prom.ErrIncr(c.cc.Name, p.addr, "ping", "network err")
-				}
-			}
-
-			p.failure++
-			if log.V(3) {
-				log.Warnf("ping node:%s addr:%s fail:%d times with err:%v", p.alias, p.addr, p.failure, err)
 			}
-			if p.failure < c.cc.PingFailLimit {
-				time.Sleep(pingSleepTime(false))
-				p.ping = newPingConn(p.cc, p.addr)
+			if p.isEjected() {
 				continue
 			}
-			if !del {
-				c.ring.DelNode(p.alias)
-				if prom.On {
-					prom.ErrIncr(c.cc.Name, p.addr, "ping", "del node")
-				}
-				del = true
-				if log.V(2) {
-					log.Errorf("ping node:%s addr:%s fail times:%d ge to limit:%d then del", p.alias, p.addr, p.failure, c.cc.PingFailLimit)
+			if prom.On {
+				prom.ErrIncr(c.cc.Name, p.addr, "request", "network err")
+			}
+			p.reqErrored = true
+			p.reqFailure++
+			if c.fail(p, p.reqFailure, err) {
+				resetTimer(timer, retry)
+			}
+			continue
+		case <-timer.C:
+		}
+		err := p.ping.Ping()
+		if err == nil {
+			p.failure = 0
+			// NOTE: request failures are reset by one interval without error
+			if !p.reqErrored {
+				p.reqFailure = 0
+			}
+			p.reqErrored = false
+			if p.isEjected() {
+				p.setEjected(false)
+				p.reqFailure = 0
+				c.ring.AddNode(p.alias, p.weight)
+				if log.V(4) {
+					log.Infof("node ping node:%s addr:%s success and readd", p.alias, p.addr)
 				}
-			} else if log.V(3) {
-				log.Errorf("ping node:%s addr:%s fail times:%d ge to limit:%d and already deled", p.alias, p.addr, p.failure, c.cc.PingFailLimit)
 			}
-			time.Sleep(pingSleepTime(true))
-			p.ping = newPingConn(p.cc, p.addr)
+			timer.Reset(interval)
+			continue
+		}
+		_ = p.ping.Close()
+		if prom.On {
+			prom.ErrIncr(c.cc.Name, p.addr, "ping", "network err")
+		}
+		p.failure++
+		c.fail(p, p.failure, err)
+		p.ping = newPingConn(p.cc, p.addr)
+		if p.isEjected() {
+			timer.Reset(retry)
+		} else {
+			timer.Reset(interval)
+		}
+	}
+}
+
+// fail ejects the node if failure reaches ping_fail_limit and returns true
+// if the node is ejected just now.
+func (c *connections) fail(p *pinger, failure int, err error) bool {
+	if log.V(3) {
+		log.Warnf("ping node:%s addr:%s fail:%d times with err:%v", p.alias, p.addr, failure, err)
+	}
+	if failure < c.cc.PingFailLimit {
+		return false
+	}
+	if p.isEjected() {
+		if log.V(3) {
+			log.Errorf("ping node:%s addr:%s fail times:%d ge to limit:%d and already deled", p.alias, p.addr, failure, c.cc.PingFailLimit)
 		}
+		return false
 	}
+	c.ring.DelNode(p.alias)
+	if prom.On {
+		prom.ErrIncr(c.cc.Name, p.addr, "ping", "del node")
+	}
+	p.setEjected(true)
+	if log.V(2) {
+		log.Errorf("ping node:%s addr:%s fail times:%d ge to limit:%d then del", p.alias, p.addr, failure, c.cc.PingFailLimit)
+	}
+	return true
+}
+
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
 }
 
 type pinger struct {
@@ -377,20 +551,64 @@ type pinger struct {
 	alias  string // NOTE: default is addr
 	weight int
 
-	failure int
+	failure    int
+	reqFailure int
+	reqErrored bool
+	// ejected is read by NodeStats concurrently.
+	ejected int32
+}
+
+func (p *pinger) isEjected() bool {
+	return atomic.LoadInt32(&p.ejected) == 1
+}
+
+func (p *pinger) setEjected(ejected bool) {
+	var v int32
+	if ejected {
+		v = 1
+	}
+	atomic.StoreInt32(&p.ejected, v)
+}
+
+// newWorkerPool returns the workers serving the node conns, nil means the
+// conns are served by their own goroutines.
+func newWorkerPool(cc *ClusterConfig) *proto.WorkerPool {
+	if cc.NodeWorkers <= 0 {
+		return nil
+	}
+	return proto.NewWorkerPool(cc.NodeWorkers, time.Duration(cc.NodeIdleTimeout)*time.Millisecond)
 }
 
 func newNodeConn(cc *ClusterConfig, addr string) proto.NodeConn {
+	nc := newBackendConn(cc, addr)
+	if cc.faulty() {
+		nc = proto.NewFaultNodeConn(nc, &proto.Faults{
+			Latency:     time.Duration(cc.FaultLatency) * time.Millisecond,
+			LatencyRate: cc.FaultLatencyRate,
+			ResetRate:   cc.FaultResetRate,
+			CorruptRate: cc.FaultCorruptRate,
+		})
+	}
+	return nc
+}
+
+func newBackendConn(cc *ClusterConfig, addr string) proto.NodeConn {
 	dto := time.Duration(cc.DialTimeout) * time.Millisecond
 	rto := time.Duration(cc.ReadTimeout) * time.Millisecond
 	wto := time.Duration(cc.WriteTimeout) * time.Millisecond
 	switch cc.CacheType {
 	case types.CacheTypeMemcache:
+		if cc.BackendType == types.CacheTypeRedis {
+			return memcache.NewRedisNodeConn(cc.Name, addr, cc.RedisAuth, cc.DB, cc.BackendFlags, dto, rto, wto)
+		}
 		return memcache.NewNodeConn(cc.Name, addr, dto, rto, wto)
 	case types.CacheTypeMemcacheBinary:
-		return mcbin.NewNodeConn(cc.Name, addr, dto, rto, wto)
+		return mcbin.NewNodeConn(cc.Name, addr, dto, rto, wto, cc.QuietBatch)
 	case types.CacheTypeRedis:
-		return redis.NewNodeConn(cc.Name, addr, dto, rto, wto)
+		if cc.BackendType == types.CacheTypeMemcache {
+			return redis.NewMemcacheNodeConn(cc.Name, addr, dto, rto, wto)
+		}
+		return redis.NewNodeConn(cc.Name, addr, cc.RedisAuth, cc.DB, dto, rto, wto)
 	default:
 		panic(types.ErrNoSupportCacheType)
 	}
@@ -401,10 +619,24 @@ func newPingConn(cc *ClusterConfig, addr string) proto.Pinger {
 	conn := libnet.DialWithTimeout(addr, timeout, timeout, timeout)
 	switch cc.CacheType {
 	case types.CacheTypeMemcache:
+		if cc.BackendType == types.CacheTypeRedis {
+			if err := redis.Prepare(conn, cc.RedisAuth, cc.DB); err != nil {
+				log.Errorf("cluster(%s) fail to prepare ping node(%s) error:%v", cc.Name, addr, err)
+				_ = conn.Close()
+			}
+			return redis.NewPinger(conn)
+		}
 		return memcache.NewPinger(conn)
 	case types.CacheTypeMemcacheBinary:
 		return mcbin.NewPinger(conn)
 	case types.CacheTypeRedis:
+		if cc.BackendType == types.CacheTypeMemcache {
+			return memcache.NewPinger(conn)
+		}
+		if err := redis.Prepare(conn, cc.RedisAuth, cc.DB); err != nil {
+			log.Errorf("cluster(%s) fail to prepare ping node(%s) error:%v", cc.Name, addr, err)
+			_ = conn.Close()
+		}
 		return redis.NewPinger(conn)
 	default:
 		panic(types.ErrNoSupportCacheType)
@@ -441,7 +673,7 @@ func parseServers(svrs []string) (addrs []string, ws []int, ans []string, alias
 		}
 		addrs = append(addrs, net.JoinHostPort(ss[0], ss[1]))
 		w, we := conv.Btoi([]byte(ss[2]))
-		if we != nil || w <= 0 {
+		if we != nil || w < 0 {
 			err = errors.Wrapf(ErrConfigServerFormat, "server:%s", svr)
 			return
 		}
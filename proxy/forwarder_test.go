@@ -0,0 +1,240 @@
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"overlord/pkg/hashkit"
+	"overlord/pkg/mockconn"
+	libnet "overlord/pkg/net"
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/memcache"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// _mcPingServer replies the ping of memcache pinger.
+func _mcPingServer(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				for {
+					if _, err := br.ReadString('\n'); err != nil {
+						return
+					}
+					if _, err := br.ReadString('\n'); err != nil {
+						return
+					}
+					if _, err := conn.Write([]byte("STORED\r\n")); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return l
+}
+
+func _pingConnections(addr string) (*connections, *pinger) {
+	cc := _clusters([3]string{"ping", "127.0.0.1:0", addr + ":1"})[0]
+	cc.PingAutoEject = true
+	cc.PingFailLimit = 2
+	cc.PingInterval = 10
+	cc.ServerRetryTimeout = 100
+	c := newConnections(cc)
+	c.ring.Init([]string{addr}, []int{1})
+	return c, &pinger{cc: cc, addr: addr, alias: addr, weight: 1}
+}
+
+func _inRing(r *hashkit.HashRing) bool {
+	_, ok := r.GetNode([]byte("key"))
+	return ok
+}
+
+func TestProcessPingEjectByRequests(t *testing.T) {
+	l := _mcPingServer(t)
+	defer l.Close()
+	c, p := _pingConnections(l.Addr().String())
+	defer c.cancel()
+	reqErrs := make(chan error, 1)
+	go c.processPing(p, reqErrs)
+
+	// NOTE: the failure is reset by ping interval without error
+	reqErrs <- errors.New("read timeout")
+	time.Sleep(50 * time.Millisecond)
+	reqErrs <- errors.New("read timeout")
+	time.Sleep(5 * time.Millisecond)
+	assert.True(t, _inRing(c.ring))
+	reqErrs <- errors.New("read timeout")
+	time.Sleep(5 * time.Millisecond)
+	assert.False(t, _inRing(c.ring))
+
+	// NOTE: readded by ping after server_retry_timeout
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, _inRing(c.ring))
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, _inRing(c.ring))
+}
+
+func TestProcessPingEjectByPing(t *testing.T) {
+	c, p := _pingConnections(_freeAddr(t))
+	defer c.cancel()
+	go c.processPing(p, nil)
+	time.Sleep(100 * time.Millisecond)
+	assert.False(t, _inRing(c.ring))
+	assert.True(t, p.isEjected())
+}
+
+// _mcStatsServer replies the stats with curr_items n.
+func _mcStatsServer(t *testing.T, n int) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				for {
+					if _, err := br.ReadString('\n'); err != nil {
+						return
+					}
+					if _, err := fmt.Fprintf(conn, "STAT pid %d\r\nSTAT curr_items %d\r\nEND\r\n", n, n); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return l
+}
+
+func TestForwardStatsAllNodes(t *testing.T) {
+	la, lb := _mcStatsServer(t, 1), _mcStatsServer(t, 2)
+	defer la.Close()
+	defer lb.Close()
+	cc := _clusters([3]string{"stats", "127.0.0.1:0", la.Addr().String() + ":1"})[0]
+	cc.Servers = append(cc.Servers, lb.Addr().String()+":1")
+	f := NewForwarder(cc)
+	defer f.Close()
+
+	wg := &sync.WaitGroup{}
+	m := proto.GetMsgs(1)[0]
+	m.WithWaitGroup(wg)
+	memcache.WithReq(m, memcache.RequestTypeStats, nil, []byte("\r\n"))
+	assert.NoError(t, f.Forward([]*proto.Message{m}))
+	wg.Wait()
+	assert.NoError(t, m.Err())
+	assert.Len(t, m.Requests(), 2)
+
+	conn := libnet.NewConn(mockconn.CreateConn(nil, 1), time.Second, time.Second)
+	pc := memcache.NewProxyConn(conn)
+	assert.NoError(t, pc.Encode(m))
+	assert.NoError(t, pc.Flush())
+	buf := make([]byte, 1024)
+	size, err := conn.Conn.(*mockconn.MockConn).Wbuf.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "STAT pid 1\r\nSTAT curr_items 3\r\nEND\r\n", string(buf[:size]))
+
+	nss := f.(proto.NodeStater).NodeStats()
+	assert.Len(t, nss, 2)
+	assert.Equal(t, la.Addr().String(), nss[0].Addr)
+	assert.True(t, nss[1].Up)
+	assert.True(t, nss[0].Conns > 0)
+}
+
+// _mcGetServer replies the value of each key by the key itself.
+func _mcGetServer(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				for {
+					line, err := br.ReadString('\n')
+					if err != nil {
+						return
+					}
+					reply := ""
+					for _, key := range strings.Fields(line)[1:] {
+						reply += fmt.Sprintf("VALUE %s 0 %d\r\n%s\r\n", key, len(key), key)
+					}
+					if _, err = conn.Write([]byte(reply + "END\r\n")); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return l
+}
+
+func TestForwardMergedGets(t *testing.T) {
+	l := _mcGetServer(t)
+	defer l.Close()
+	cc := _clusters([3]string{"gets", "127.0.0.1:0", l.Addr().String() + ":1"})[0]
+	f := NewForwarder(cc)
+	defer f.Close()
+
+	wg := &sync.WaitGroup{}
+	m := proto.GetMsgs(1)[0]
+	m.WithWaitGroup(wg)
+	for _, key := range []string{"a", "bb", "ccc"} {
+		memcache.WithReq(m, memcache.RequestTypeGet, []byte(key), []byte("\r\n"))
+	}
+	assert.NoError(t, f.Forward([]*proto.Message{m}))
+	wg.Wait()
+	assert.NoError(t, m.Err())
+
+	conn := libnet.NewConn(mockconn.CreateConn(nil, 1), time.Second, time.Second)
+	pc := memcache.NewProxyConn(conn)
+	assert.NoError(t, pc.Encode(m))
+	assert.NoError(t, pc.Flush())
+	assert.Equal(t, "VALUE a 0 1\r\na\r\nVALUE bb 0 2\r\nbb\r\nVALUE ccc 0 3\r\nccc\r\nEND\r\n", conn.Conn.(*mockconn.MockConn).Wbuf.String())
+}
+
+func TestForwardDrainedNode(t *testing.T) {
+	l := _mcGetServer(t)
+	defer l.Close()
+	// NOTE: the drained node is unreachable and never gets requests
+	cc := _clusters([3]string{"drained", "127.0.0.1:0", l.Addr().String() + ":1"})[0]
+	cc.Servers = append(cc.Servers, "127.0.0.1:1:0")
+	assert.NoError(t, cc.Validate())
+	f := NewForwarder(cc)
+	defer f.Close()
+
+	wg := &sync.WaitGroup{}
+	msgs := proto.GetMsgs(16)
+	for i, m := range msgs {
+		m.WithWaitGroup(wg)
+		memcache.WithReq(m, memcache.RequestTypeGet, []byte(fmt.Sprintf("key%d", i)), []byte("\r\n"))
+	}
+	assert.NoError(t, f.Forward(msgs))
+	wg.Wait()
+	for _, m := range msgs {
+		assert.NoError(t, m.Err())
+	}
+}
@@ -11,12 +11,15 @@ import (
 	libnet "overlord/pkg/net"
 	"overlord/pkg/prom"
 	"overlord/pkg/types"
+	"overlord/proxy/accesslog"
+	"overlord/proxy/hotkey"
 	"overlord/proxy/proto"
 	"overlord/proxy/proto/memcache"
 	mcbin "overlord/proxy/proto/memcache/binary"
 	"overlord/proxy/proto/redis"
 	rclstr "overlord/proxy/proto/redis/cluster"
 	"overlord/proxy/slowlog"
+	"overlord/proxy/tracing"
 
 	"github.com/pkg/errors"
 )
@@ -40,11 +43,43 @@ type Handler struct {
 
 	slog       slowlog.Handler
 	slowerThan time.Duration
+	alog       *accesslog.Logger
+	tracer     *tracing.Tracer
 
 	forwarder proto.Forwarder
+	cache     *hotkey.Cache
+	limiter   *rateLimiter
+	admitter  *admitter
+	acl       *commandACL
+	hedger    *hedger
+	blocker   *blocker
+	shadower  *shadower
+	mirrorer  *shadower
+	fallback  *fallbacker
+	prefix    *prefixMetrics
+	cstat     *clusterStat
+	connLimit *connLimiter
+	streamer  *proto.Streamer
 
-	conn *libnet.Conn
-	pc   proto.ProxyConn
+	arena  *proto.Arena
+	conn   *libnet.Conn
+	pc     proto.ProxyConn
+	addr   string
+	stat   clientStat
+	authed bool
+	// id is the client id of HELLO.
+	id int64
+	// readTimeout is the idle timeout of client.
+	readTimeout time.Duration
+	// killed is set when the client kills itself, closed after replied.
+	killed bool
+	// tx is the transaction after MULTI, exec is the one of EXEC and
+	// pending is the EXEC, WATCH or blocking command which are served after
+	// forwarding.
+	tx      *redis.Tx
+	exec    *redis.Tx
+	watch   *redis.Watch
+	pending *proto.Message
 
 	closed int32
 	err    error
@@ -56,14 +91,32 @@ func NewHandler(p *Proxy, cc *ClusterConfig, conn net.Conn, forwarder proto.Forw
 		p:         p,
 		cc:        cc,
 		forwarder: forwarder,
+		arena:     proto.NewArena(),
 	}
 
 	if cc.SlowlogSlowerThan != 0 {
 		h.slowerThan = time.Duration(cc.SlowlogSlowerThan) * time.Microsecond
 		h.slog = slowlog.Get(cc.Name)
 	}
+	h.alog = accesslog.Get(cc.Name, cc.AccessLogSampleRate)
+	h.tracer = tracing.Get(cc.Name, cc.TraceSampleRate)
+	if cc.StreamThreshold > 0 {
+		h.streamer = &proto.Streamer{
+			Threshold: cc.StreamThreshold,
+			Buffer:    cc.StreamBuffer,
+			Timeout:   time.Duration(cc.WriteTimeout) * time.Millisecond,
+		}
+	}
 
-	h.conn = libnet.NewConn(conn, time.Second*time.Duration(h.p.c.Proxy.ReadTimeout), time.Second*time.Duration(h.p.c.Proxy.WriteTimeout))
+	h.cstat = p.clusterStat(cc.Name)
+	h.addr = conn.RemoteAddr().String()
+	h.id = atomic.AddInt64(&clientID, 1)
+	h.stat.start = time.Now()
+	h.readTimeout = time.Second * time.Duration(h.p.c.Proxy.ReadTimeout)
+	if cc.ClientIdleTimeout > 0 {
+		h.readTimeout = time.Second * time.Duration(cc.ClientIdleTimeout)
+	}
+	h.conn = libnet.NewConn(conn, h.readTimeout, time.Second*time.Duration(h.p.c.Proxy.WriteTimeout))
 	// cache type
 	switch cc.CacheType {
 	case types.CacheTypeMemcache:
@@ -77,7 +130,18 @@ func NewHandler(p *Proxy, cc *ClusterConfig, conn net.Conn, forwarder proto.Forw
 	default:
 		panic(types.ErrNoSupportCacheType)
 	}
+	if cc.MaxKeyLen > 0 || cc.MaxValueSize > 0 {
+		if sl, ok := h.pc.(proto.SizeLimiter); ok {
+			sl.LimitSize(cc.MaxKeyLen, cc.MaxValueSize)
+		}
+	}
+	if cc.KeyPrefix != "" {
+		if kp, ok := h.pc.(proto.KeyPrefixer); ok {
+			kp.PrefixKeys([]byte(cc.KeyPrefix))
+		}
+	}
 	prom.ConnIncr(cc.Name)
+	p.addClient(h)
 	return
 }
 
@@ -98,46 +162,190 @@ func (h *Handler) handle() {
 	for {
 		// 1. read until limit or error
 		if msgs, err = h.pc.Decode(messages); err != nil {
-			h.deferHandle(messages, err)
+			h.deferHandle(err)
 			return
 		}
-		// 2. send to cluster
-		h.forwarder.Forward(msgs)
-		wg.Wait()
-		// 3. encode
-		for _, msg := range msgs {
-			msg.MarkEndPipe()
-			if err = h.pc.Encode(msg); err != nil {
-				h.pc.Flush()
-				h.deferHandle(messages, err)
-				return
-			}
-			msg.MarkEnd()
-			if prom.On {
-				prom.ProxyTime(h.cc.Name, msg.Request().CmdString(), int64(msg.TotalDur()/time.Microsecond))
+		h.stat.decoded(msgs)
+		h.capture(msgs)
+		if idx := subscribeIndex(msgs); idx >= 0 {
+			if err = h.processTx(wg, msgs[:idx]); err == nil {
+				if h.cc.Auth == "" || h.authed {
+					err = h.subscribe(messages, msgs[idx:])
+				} else {
+					err = h.processTx(wg, msgs[idx:])
+				}
 			}
+		} else {
+			err = h.processTx(wg, msgs)
 		}
-		if err = h.pc.Flush(); err != nil {
-			h.deferHandle(messages, err)
+		if err != nil {
+			h.deferHandle(err)
 			return
 		}
+		// 5. alloc MaxConcurrent
+		messages = h.allocMaxConcurrent(wg, messages, len(msgs))
+	}
+}
 
-		// 4. check slowlog before release resource
-		if h.slowerThan != 0 {
-			for _, msg := range msgs {
-				if msg.TotalDur() > h.slowerThan {
-					h.slog.Record(msg.Slowlog())
-				}
+// rejected returns the messages which are not rejected while decoding,
+// such as exceeding the size limits or denied by the commands acl, the
+// rejected are replied with error.
+func (h *Handler) rejected(msgs []*proto.Message) []*proto.Message {
+	var fwd []*proto.Message
+	for i, msg := range msgs {
+		if msg.Err() == nil && h.acl != nil && !h.acl.allow(msg) {
+			msg.WithError(ErrCommandDenied)
+		}
+		if msg.Err() == nil && h.writesPaused() && isWrite(msg) {
+			msg.WithError(ErrWritesPaused)
+		}
+		if msg.Err() == nil {
+			if fwd != nil {
+				fwd = append(fwd, msg)
+			}
+			continue
+		}
+		if fwd == nil {
+			fwd = append(msgs[:0:0], msgs[:i]...)
+		}
+		if prom.On {
+			prom.ErrIncr(h.cc.Name, h.cc.Name, msg.Request().CmdString(), "rejected")
+		}
+	}
+	if fwd == nil {
+		return msgs
+	}
+	return fwd
+}
+
+// serveLocal returns the messages except the ones answered by proxy itself,
+// so that they never wait for nodes such as PING of health check.
+func (h *Handler) serveLocal(msgs []*proto.Message) []*proto.Message {
+	var fwd []*proto.Message
+	for i, msg := range msgs {
+		if l, ok := msg.Request().(proto.Localer); !ok || !l.IsLocal() || msg.IsBatch() {
+			if fwd != nil {
+				fwd = append(fwd, msg)
 			}
+			continue
+		}
+		if fwd == nil {
+			fwd = append(msgs[:0:0], msgs[:i]...)
 		}
+	}
+	if fwd == nil {
+		return msgs
+	}
+	return fwd
+}
 
+// allowStream allows the large value to be streamed only if the client sends
+// one single key command, for the other replies of pipeline or batch must
+// be waited before encoding. The hedged or cached reply is never streamed.
+func (h *Handler) allowStream(msgs []*proto.Message) {
+	if h.streamer == nil || h.hedger != nil || h.cache != nil {
+		return
+	}
+	if len(msgs) == 1 && !msgs[0].IsBatch() {
+		msgs[0].WithStreamer(h.streamer)
+	}
+}
+
+// process forwards msgs to cluster and writes the replies into client.
+func (h *Handler) process(wg *sync.WaitGroup, msgs []*proto.Message) (err error) {
+	// 2. send to cluster
+	if h.tracer != nil {
 		for _, msg := range msgs {
-			msg.ResetSubs()
-			msg.Reset()
+			h.tracer.Sample(msg)
 		}
-		// 5. alloc MaxConcurrent
-		messages = h.allocMaxConcurrent(wg, messages, len(msgs))
 	}
+	h.allowStream(msgs)
+	fwd := h.admit(h.rateLimit(h.serveCache(h.serveInfo(h.serveLocal(h.serveMulti(h.checkAuth(h.rejected(msgs))))))))
+	hfwd, hwait := h.hedge(fwd)
+	h.forwarder.Forward(hfwd)
+	hwait()
+	wg.Wait()
+	h.retry(wg, fwd)
+	h.randomKey(wg, fwd)
+	h.partial(fwd)
+	if h.fallback != nil {
+		h.fallback.answer(h.forwarder, fwd)
+	}
+	if h.shadower != nil {
+		h.shadower.mirror(fwd)
+	}
+	if h.mirrorer != nil {
+		h.mirrorer.mirror(fwd)
+	}
+	h.fillCache(fwd)
+	h.serveTx()
+	h.unadmit(fwd)
+	// 3. encode
+	for _, msg := range msgs {
+		msg.MarkEndPipe()
+		h.replyClient(msg)
+		h.replySelect(msg)
+		h.replySlowlog(msg)
+		h.replyInfo(msg)
+		if err = h.pc.Encode(msg); err != nil && !h.errReplied(err) {
+			h.pc.Flush()
+			return
+		}
+		msg.MarkEnd()
+		h.cstat.record(msg)
+		if prom.On {
+			prom.ProxyTime(h.cc.Name, msg.Request().CmdString(), int64(msg.TotalDur()/time.Microsecond))
+			reqBytes, replyBytes := messageSize(msg)
+			prom.Size(h.cc.Name, reqBytes, replyBytes)
+			if msg.IsBatch() {
+				prom.BatchSize(h.cc.Name, len(msg.Requests()))
+			}
+			if h.prefix != nil {
+				h.prefixStat(msg)
+			}
+		}
+	}
+	h.stat.buffered(h.pc)
+	if err = h.pc.Flush(); err != nil {
+		return
+	}
+	h.stat.flushed()
+
+	// 4. check slowlog, access log and trace before release resource
+	if h.slowerThan != 0 {
+		for _, msg := range msgs {
+			if msg.TotalDur() > h.slowerThan {
+				h.slog.Record(msg.Slowlog())
+			}
+		}
+	}
+	if h.alog != nil {
+		for _, msg := range msgs {
+			if h.alog.Sampled() {
+				h.alog.Log(h.accessEntry(msg))
+			}
+		}
+	}
+	if h.tracer != nil {
+		for _, msg := range msgs {
+			if msg.TraceID() == "" {
+				continue
+			}
+			if err := msg.Err(); err != nil {
+				log.Errorf("cluster(%s) remoteAddr(%s) trace(%s) request error:%+v", h.cc.Name, h.addr, msg.TraceID(), err)
+			}
+			h.tracer.Finish(msg, h.addr)
+		}
+	}
+
+	for _, msg := range msgs {
+		msg.ResetSubs()
+		msg.Reset()
+	}
+	if h.killed {
+		err = ErrClientKilled
+	}
+	return
 }
 
 func (h *Handler) allocMaxConcurrent(wg *sync.WaitGroup, msgs []*proto.Message, lastCount int) []*proto.Message {
@@ -148,8 +356,7 @@ func (h *Handler) allocMaxConcurrent(wg *sync.WaitGroup, msgs []*proto.Message,
 		alloc = msgsLength * concurrent
 	}
 	if alloc > 0 {
-		proto.PutMsgs(msgs)
-		msgs = proto.GetMsgs(alloc) // TODO: change the msgs by lastCount trending
+		msgs = h.arena.Msgs(alloc) // TODO: change the msgs by lastCount trending
 		for _, msg := range msgs {
 			msg.WithWaitGroup(wg)
 		}
@@ -157,8 +364,13 @@ func (h *Handler) allocMaxConcurrent(wg *sync.WaitGroup, msgs []*proto.Message,
 	return msgs
 }
 
-func (h *Handler) deferHandle(msgs []*proto.Message, err error) {
-	proto.PutMsgs(msgs)
+func (h *Handler) deferHandle(err error) {
+	if h.tx != nil {
+		h.tx.Close()
+		h.tx = nil
+	}
+	h.unwatch()
+	h.arena.Release()
 	h.closeWithError(err)
 	return
 }
@@ -167,7 +379,11 @@ func (h *Handler) closeWithError(err error) {
 	if atomic.CompareAndSwapInt32(&h.closed, handlerOpening, handlerClosed) {
 		h.err = err
 		_ = h.conn.Close()
+		h.p.delClient(h)
 		atomic.AddInt32(&h.p.conns, -1) // NOTE: decr!!!
+		if h.connLimit != nil {
+			h.connLimit.release(h.addr)
+		}
 		if err == proto.ErrQuit {
 			return
 		}
@@ -179,3 +395,16 @@ func (h *Handler) closeWithError(err error) {
 		}
 	}
 }
+
+// messageSize returns the bytes of requests and replies of msg, the sub
+// requests of batch are summed up.
+func messageSize(msg *proto.Message) (req, reply int) {
+	for _, r := range msg.Requests() {
+		if s, ok := r.(proto.Sizer); ok {
+			reqBytes, replyBytes := s.Size()
+			req += reqBytes
+			reply += replyBytes
+		}
+	}
+	return
+}
@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"overlord/pkg/mockconn"
+	libnet "overlord/pkg/net"
+	"overlord/pkg/types"
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/memcache"
+	"overlord/proxy/proto/redis"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlerRejected(t *testing.T) {
+	h := &Handler{cc: &ClusterConfig{CacheType: types.CacheTypeRedis}}
+	cmd := "*3\r\n$3\r\nSET\r\n$1\r\na\r\n$6\r\nbbbbbb\r\n*2\r\n$3\r\nGET\r\n$1\r\na\r\n"
+	rpc := redis.NewProxyConn(libnet.NewConn(mockconn.CreateConn([]byte(cmd), 1), time.Second, time.Second), true)
+	msgs, err := rpc.Decode(proto.GetMsgs(2))
+	assert.NoError(t, err)
+	assert.Len(t, h.rejected(msgs), 2)
+
+	rpc = redis.NewProxyConn(libnet.NewConn(mockconn.CreateConn([]byte(cmd), 1), time.Second, time.Second), true)
+	rpc.(proto.SizeLimiter).LimitSize(0, 5)
+	msgs, err = rpc.Decode(proto.GetMsgs(2))
+	assert.NoError(t, err)
+	fwd := h.rejected(msgs)
+	assert.Len(t, fwd, 1)
+	assert.Equal(t, msgs[1], fwd[0])
+	assert.True(t, h.errReplied(msgs[0].Err()))
+}
+
+func TestHandlerServeLocal(t *testing.T) {
+	h := &Handler{cc: &ClusterConfig{CacheType: types.CacheTypeRedis}}
+	cmd := "PING\r\nGET a\r\nECHO hi\r\nTIME\r\nMGET a b\r\nFLUSHALL\r\n"
+	rpc := redis.NewProxyConn(libnet.NewConn(mockconn.CreateConn([]byte(cmd), 1), time.Second, time.Second), true)
+	msgs, err := rpc.Decode(proto.GetMsgs(6))
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 6)
+	fwd := h.serveLocal(msgs)
+	assert.Len(t, fwd, 2)
+	assert.Equal(t, msgs[1], fwd[0])
+	assert.Equal(t, msgs[4], fwd[1])
+
+	fwd = h.serveLocal(msgs[4:5])
+	assert.Len(t, fwd, 1)
+
+	h = &Handler{cc: &ClusterConfig{CacheType: types.CacheTypeMemcache}}
+	cmd = "version\r\nget a\r\nmn\r\n"
+	mpc := memcache.NewProxyConn(libnet.NewConn(mockconn.CreateConn([]byte(cmd), 1), time.Second, time.Second))
+	msgs, err = mpc.Decode(proto.GetMsgs(3))
+	assert.NoError(t, err)
+	fwd = h.serveLocal(msgs)
+	assert.Len(t, fwd, 1)
+	assert.Equal(t, msgs[1], fwd[0])
+}
@@ -0,0 +1,207 @@
+package proxy
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"overlord/pkg/prom"
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/redis"
+)
+
+const (
+	hedgeSamples = 1024
+	// hedgeRecalc is the number of samples to recalculate the delay.
+	hedgeRecalc = 64
+)
+
+// hedger tracks the latency of reads and returns the delay to hedge, which
+// is the hedge_percentile of recent latencies and at least hedge_min_delay.
+type hedger struct {
+	percentile int
+	minDelay   time.Duration
+
+	lock    sync.Mutex
+	samples []time.Duration
+	idx     int
+	count   int
+	delay   int64
+}
+
+func newHedger(cc *ClusterConfig) *hedger {
+	if cc.HedgePercentile <= 0 {
+		return nil
+	}
+	return &hedger{
+		percentile: cc.HedgePercentile,
+		minDelay:   time.Duration(cc.HedgeMinDelay) * time.Millisecond,
+		samples:    make([]time.Duration, 0, hedgeSamples),
+	}
+}
+
+func (hg *hedger) observe(d time.Duration) {
+	hg.lock.Lock()
+	defer hg.lock.Unlock()
+	if len(hg.samples) < hedgeSamples {
+		hg.samples = append(hg.samples, d)
+	} else {
+		hg.samples[hg.idx] = d
+		hg.idx = (hg.idx + 1) % hedgeSamples
+	}
+	if hg.count++; hg.count%hedgeRecalc != 0 {
+		return
+	}
+	sorted := append([]time.Duration(nil), hg.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	atomic.StoreInt64(&hg.delay, int64(sorted[len(sorted)*hg.percentile/100]))
+}
+
+// Delay returns the delay to hedge the reads not answered.
+func (hg *hedger) Delay() time.Duration {
+	if d := time.Duration(atomic.LoadInt64(&hg.delay)); d > hg.minDelay {
+		return d
+	}
+	return hg.minDelay
+}
+
+// hedgeCall is the read forwarded by clones, the first answered is used.
+type hedgeCall struct {
+	m       *proto.Message
+	ch      chan *proto.Message
+	pending int
+	winner  *proto.Message
+}
+
+// clone returns the clone of read and its wait group, which must be watched
+// after forwarded.
+func (c *hedgeCall) clone(hedge bool) (cm *proto.Message, wg *sync.WaitGroup) {
+	cm = proto.NewMessage()
+	cm.Type = c.m.Type
+	cm.WithRequest(c.m.Request().(proto.Hedger).Clone())
+	wg = &sync.WaitGroup{}
+	cm.WithWaitGroup(wg)
+	if hedge {
+		cm.WithHedge()
+	}
+	c.pending++
+	return
+}
+
+func (c *hedgeCall) watch(cm *proto.Message, wg *sync.WaitGroup) {
+	go func() {
+		wg.Wait()
+		c.ch <- cm
+	}()
+}
+
+// hedge replaces the reads of msgs by clones to be hedged, the others are
+// forwarded as they are. The returned func waits the reads after forwarded.
+func (h *Handler) hedge(msgs []*proto.Message) (fwd []*proto.Message, wait func()) {
+	wait = func() {}
+	if h.hedger == nil {
+		return msgs, wait
+	}
+	var (
+		calls []*hedgeCall
+		cms   []*proto.Message
+		wgs   []*sync.WaitGroup
+	)
+	fwd = make([]*proto.Message, 0, len(msgs))
+	for _, m := range msgs {
+		if !hedgeable(m) {
+			fwd = append(fwd, m)
+			continue
+		}
+		c := &hedgeCall{m: m, ch: make(chan *proto.Message, 2)}
+		cm, wg := c.clone(false)
+		fwd = append(fwd, cm)
+		calls = append(calls, c)
+		cms = append(cms, cm)
+		wgs = append(wgs, wg)
+	}
+	if len(calls) == 0 {
+		return
+	}
+	wait = func() {
+		for i, c := range calls {
+			c.watch(cms[i], wgs[i])
+		}
+		h.waitHedges(calls)
+	}
+	return
+}
+
+// waitHedges waits the reads of calls. The reads not answered in delay are
+// forwarded again, which are sent by another connection of pool, the first
+// successful reply is used and the other one is dropped.
+func (h *Handler) waitHedges(calls []*hedgeCall) {
+	start := time.Now()
+	timer := time.NewTimer(h.hedger.Delay())
+	defer timer.Stop()
+	timeout := timer.C
+	for i, c := range calls {
+		for c.winner == nil {
+			select {
+			case cm := <-c.ch:
+				c.pending--
+				if cm.Err() != nil && c.pending > 0 {
+					continue
+				}
+				c.winner = cm
+			case <-timeout:
+				timeout = nil
+				h.forwardHedges(calls[i:])
+			}
+		}
+		if c.winner.Err() == nil {
+			h.hedger.observe(time.Since(start))
+		}
+		c.m.Request().(proto.Hedger).CopyReply(c.winner.Request())
+		c.m.WithError(c.winner.Err())
+		c.m.MarkAddr(c.winner.Addr())
+	}
+}
+
+func (h *Handler) forwardHedges(calls []*hedgeCall) {
+	var (
+		hcs []*hedgeCall
+		cms []*proto.Message
+		wgs []*sync.WaitGroup
+	)
+	for _, c := range calls {
+		if len(c.ch) > 0 {
+			continue
+		}
+		cm, wg := c.clone(true)
+		hcs = append(hcs, c)
+		cms = append(cms, cm)
+		wgs = append(wgs, wg)
+	}
+	if len(hcs) == 0 {
+		return
+	}
+	_ = h.forwarder.Forward(cms)
+	for i, c := range hcs {
+		c.watch(cms[i], wgs[i])
+	}
+	if prom.On {
+		prom.HedgeAdd(h.cc.Name, len(hcs))
+	}
+}
+
+func hedgeable(m *proto.Message) bool {
+	if m.IsBatch() {
+		return false
+	}
+	req := m.Request()
+	if c, ok := req.(proto.Classifier); !ok || !c.IsRead() {
+		return false
+	}
+	if r, ok := req.(*redis.Request); ok && r.IsScan() {
+		return false
+	}
+	_, ok := req.(proto.Hedger)
+	return ok
+}
@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"overlord/pkg/types"
+	"overlord/proxy/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// _slowForwarder answers the first forward after slow, and the hedges at once.
+type _slowForwarder struct {
+	proto.Forwarder
+	slow   time.Duration
+	hedges int
+}
+
+func (f *_slowForwarder) Forward(msgs []*proto.Message) error {
+	for _, m := range msgs {
+		m.Add()
+		if m.IsHedge() {
+			f.hedges++
+			m.MarkAddr("fast")
+			m.Done()
+			continue
+		}
+		go func(m *proto.Message) {
+			time.Sleep(f.slow)
+			m.MarkAddr("slow")
+			m.Done()
+		}(m)
+	}
+	return nil
+}
+
+func _hedgeHandler(fwd proto.Forwarder) *Handler {
+	cc := &ClusterConfig{CacheType: types.CacheTypeRedis, HedgePercentile: 90, HedgeMinDelay: 20}
+	return &Handler{cc: cc, forwarder: fwd, hedger: newHedger(cc)}
+}
+
+func TestHedgerDelay(t *testing.T) {
+	assert.Nil(t, newHedger(&ClusterConfig{}))
+	hg := newHedger(&ClusterConfig{HedgePercentile: 90, HedgeMinDelay: 5})
+	assert.Equal(t, 5*time.Millisecond, hg.Delay())
+	for i := 0; i < hedgeRecalc; i++ {
+		hg.observe(time.Duration(i) * time.Millisecond)
+	}
+	assert.Equal(t, time.Duration(hedgeRecalc*90/100)*time.Millisecond, hg.Delay())
+}
+
+func TestHandlerHedgeSlowRead(t *testing.T) {
+	fwd := &_slowForwarder{slow: 500 * time.Millisecond}
+	h := _hedgeHandler(fwd)
+	msgs, wg := _retryMsgs(t, "*2\r\n$3\r\nGET\r\n$1\r\na\r\n")
+	start := time.Now()
+	out, wait := h.hedge(msgs)
+	assert.False(t, msgs[0] == out[0])
+	_ = fwd.Forward(out)
+	wait()
+	wg.Wait()
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+	assert.Equal(t, 1, fwd.hedges)
+	assert.Equal(t, "fast", msgs[0].Addr())
+	assert.NoError(t, msgs[0].Err())
+}
+
+func TestHandlerHedgeIgnore(t *testing.T) {
+	fwd := &_slowForwarder{slow: 50 * time.Millisecond}
+	h := _hedgeHandler(fwd)
+	for _, cmd := range []string{
+		"*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\nb\r\n",
+		"*3\r\n$4\r\nMGET\r\n$1\r\na\r\n$1\r\nb\r\n",
+	} {
+		msgs, _ := _retryMsgs(t, cmd)
+		out, _ := h.hedge(msgs)
+		assert.Equal(t, msgs, out, cmd)
+	}
+
+	// NOTE: the read answered in delay isn't hedged
+	fwd.slow = time.Millisecond
+	msgs, wg := _retryMsgs(t, "*2\r\n$3\r\nGET\r\n$1\r\na\r\n")
+	out, wait := h.hedge(msgs)
+	_ = fwd.Forward(out)
+	wait()
+	wg.Wait()
+	assert.Equal(t, 0, fwd.hedges)
+	assert.Equal(t, "slow", msgs[0].Addr())
+}
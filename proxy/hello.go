@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"bytes"
+	"strconv"
+	"sync/atomic"
+
+	"overlord/pkg/conv"
+	"overlord/pkg/types"
+	"overlord/proxy/proto/redis"
+	"overlord/version"
+)
+
+var (
+	helloAuthBytes    = []byte("4\r\nAUTH")
+	helloSetNameBytes = []byte("7\r\nSETNAME")
+
+	helloNoProtoBytes   = []byte("NOPROTO unsupported protocol version")
+	helloSyntaxBytes    = []byte("ERR syntax error in HELLO option")
+	helloWrongPassBytes = []byte("WRONGPASS invalid username-password pair or user is disabled.")
+	helloNoAuthBytes    = []byte("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+)
+
+var clientID int64
+
+// replyHello answers HELLO of redis clients. Only RESP2 is supported, for
+// the backend connections are shared by all the clients and always speak
+// RESP2, HELLO 3 is answered with NOPROTO so that clients fall back to RESP2.
+func (h *Handler) replyHello(req *redis.Request) {
+	args := req.RESP().Array()
+	if len(args) > 1 {
+		if v, err := strconv.Atoi(string(bulkData(args[1].Data()))); err != nil || v != 2 {
+			req.Reply().SetError(helloNoProtoBytes)
+			return
+		}
+	}
+	authed := h.cc.Auth == "" || h.authed
+	for i := 2; i < len(args); i++ {
+		opt := args[i].Data()
+		conv.UpdateToUpper(opt)
+		switch {
+		case bytes.Equal(opt, helloAuthBytes) && i+2 < len(args):
+			// NOTE: only the default user, so username is ignored
+			if h.cc.Auth == "" || !bytes.Equal(bulkData(args[i+2].Data()), []byte(h.cc.Auth)) {
+				req.Reply().SetError(helloWrongPassBytes)
+				return
+			}
+			authed = true
+			i += 2
+		case bytes.Equal(opt, helloSetNameBytes) && i+1 < len(args):
+			i++
+		default:
+			req.Reply().SetError(helloSyntaxBytes)
+			return
+		}
+	}
+	if !authed {
+		req.Reply().SetError(helloNoAuthBytes)
+		return
+	}
+	if h.cc.Auth != "" {
+		h.authed = true
+	}
+	mode := "standalone"
+	if h.cc.CacheType == types.CacheTypeRedisCluster {
+		mode = "cluster"
+	}
+	if h.id == 0 {
+		h.id = atomic.AddInt64(&clientID, 1)
+	}
+	req.Reply().SetHello(&redis.HelloInfo{
+		Server:  "overlord",
+		Version: version.Str(),
+		Proto:   2,
+		ID:      h.id,
+		Mode:    mode,
+		Role:    "master",
+	})
+}
@@ -0,0 +1,134 @@
+package proxy
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"overlord/pkg/mockconn"
+	libnet "overlord/pkg/net"
+	"overlord/pkg/types"
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/redis"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func _helloReply(t *testing.T, h *Handler, cmd string) string {
+	rpc := redis.NewProxyConn(libnet.NewConn(mockconn.CreateConn([]byte(cmd+"\r\n"), 1), time.Second, time.Second), true)
+	msgs, err := rpc.Decode(proto.GetMsgs(1))
+	assert.NoError(t, err)
+	h.checkAuth(msgs)
+
+	mconn, buf := mockconn.CreateDownStreamConn()
+	wpc := redis.NewProxyConn(libnet.NewConn(mconn, time.Second, time.Second), true)
+	assert.NoError(t, wpc.Encode(msgs[0]))
+	assert.NoError(t, wpc.Flush())
+	return buf.String()
+}
+
+func TestHandlerHelloOk(t *testing.T) {
+	h := &Handler{cc: &ClusterConfig{CacheType: types.CacheTypeRedisCluster}}
+	reply := _helloReply(t, h, "hello")
+	assert.True(t, strings.HasPrefix(reply, "*14\r\n"))
+	assert.Contains(t, reply, "$4\r\nmode\r\n$7\r\ncluster\r\n")
+
+	reply = _helloReply(t, h, "hello 2 setname app")
+	assert.True(t, strings.HasPrefix(reply, "*14\r\n"))
+	assert.Contains(t, reply, "$5\r\nproto\r\n:2\r\n")
+
+	assert.Equal(t, "-NOPROTO unsupported protocol version\r\n", _helloReply(t, h, "hello 3"))
+	assert.Equal(t, "-NOPROTO unsupported protocol version\r\n", _helloReply(t, h, "hello 4"))
+	assert.Equal(t, "-ERR syntax error in HELLO option\r\n", _helloReply(t, h, "hello 2 foo"))
+}
+
+func TestHandlerHelloAuth(t *testing.T) {
+	h := &Handler{cc: &ClusterConfig{CacheType: types.CacheTypeRedis, Auth: "pass"}}
+	assert.True(t, strings.HasPrefix(_helloReply(t, h, "hello 2"), "-NOAUTH HELLO must be called"))
+	assert.True(t, strings.HasPrefix(_helloReply(t, h, "hello 2 auth default wrong"), "-WRONGPASS"))
+	assert.False(t, h.authed)
+
+	assert.True(t, strings.HasPrefix(_helloReply(t, h, "hello 2 auth default pass"), "*14\r\n"))
+	assert.True(t, h.authed)
+}
+
+// _redisServer replies the commands by reply of the arguments.
+func _redisServer(t *testing.T, reply func(args []string) string) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				for {
+					line, err := br.ReadString('\n')
+					if err != nil {
+						return
+					}
+					n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+					var args []string
+					for i := 0; i < n; i++ {
+						if _, err = br.ReadString('\n'); err != nil {
+							return
+						}
+						arg, err := br.ReadString('\n')
+						if err != nil {
+							return
+						}
+						args = append(args, strings.TrimSpace(arg))
+					}
+					if _, err = conn.Write([]byte(reply(args))); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return l
+}
+
+func TestHandlerHello3ThenHgetall(t *testing.T) {
+	// NOTE: HGETALL is replied by RESP2 flat array.
+	l := _redisServer(t, func(args []string) string {
+		if len(args) > 0 && strings.EqualFold(args[0], "HGETALL") {
+			return "*2\r\n$1\r\nf\r\n$1\r\nv\r\n"
+		}
+		return "+OK\r\n"
+	})
+	defer l.Close()
+	cc := &ClusterConfig{Name: "hello", CacheType: types.CacheTypeRedis, Servers: []string{l.Addr().String() + ":1"}}
+	cc.SetDefault()
+	f := NewForwarder(cc)
+	defer f.Close()
+	h := &Handler{cc: cc, forwarder: f}
+
+	rpc := redis.NewProxyConn(libnet.NewConn(mockconn.CreateConn([]byte("HELLO 3\r\nHGETALL h\r\n"), 1), time.Second, time.Second), true)
+	msgs, err := rpc.Decode(proto.GetMsgs(2))
+	assert.NoError(t, err)
+	wg := &sync.WaitGroup{}
+	for _, m := range msgs {
+		m.WithWaitGroup(wg)
+	}
+	fwd := h.serveLocal(h.checkAuth(msgs))
+	assert.Len(t, fwd, 1)
+	assert.NoError(t, f.Forward(fwd))
+	wg.Wait()
+
+	mconn, buf := mockconn.CreateDownStreamConn()
+	wpc := redis.NewProxyConn(libnet.NewConn(mconn, time.Second, time.Second), true)
+	for _, m := range msgs {
+		assert.NoError(t, wpc.Encode(m))
+	}
+	assert.NoError(t, wpc.Flush())
+	// NOTE: the client stays in RESP2, so the reply of HGETALL is a flat array rather than a map
+	assert.Equal(t, "-NOPROTO unsupported protocol version\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n", buf.String())
+}
@@ -0,0 +1,304 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"overlord/pkg/log"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultConfigVersions is the versions of each cluster kept by default.
+	defaultConfigVersions = 10
+
+	adminVersionsSuffix = "/versions"
+
+	// sources of config versions.
+	versionSourceServe    = "serve"
+	versionSourceReload   = "reload"
+	versionSourceAdmin    = "admin"
+	versionSourceRollback = "rollback"
+)
+
+// ConfigVersion is a version of the config of cluster applied by proxy.
+type ConfigVersion struct {
+	// Version increases by each applied config of the cluster.
+	Version int64 `json:"version"`
+	Time    int64 `json:"time"`
+	// Source is how the config is applied, serve, reload, admin or rollback.
+	Source string         `json:"source"`
+	Config *ClusterConfig `json:"config"`
+}
+
+// configHistory keeps the latest limit versions of each cluster, and saves
+// them as snapshots into dir if set, so that they are kept after restart.
+type configHistory struct {
+	lock     sync.Mutex
+	limit    int
+	dir      string
+	versions map[string][]*ConfigVersion
+}
+
+func newConfigHistory(limit int, dir string) *configHistory {
+	if limit <= 0 {
+		limit = defaultConfigVersions
+	}
+	ch := &configHistory{limit: limit, dir: dir, versions: map[string][]*ConfigVersion{}}
+	if dir != "" {
+		ch.load()
+	}
+	return ch
+}
+
+// load reads the snapshots of all the clusters from dir.
+func (ch *configHistory) load() {
+	dirs, err := ioutil.ReadDir(ch.dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("load config versions from dir:%s error:%v", ch.dir, err)
+		}
+		return
+	}
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		files, err := ioutil.ReadDir(filepath.Join(ch.dir, d.Name()))
+		if err != nil {
+			log.Warnf("load config versions of cluster:%s error:%v", d.Name(), err)
+			continue
+		}
+		var vs []*ConfigVersion
+		for _, f := range files {
+			if filepath.Ext(f.Name()) != ".json" {
+				continue
+			}
+			data, err := ioutil.ReadFile(filepath.Join(ch.dir, d.Name(), f.Name()))
+			if err != nil {
+				log.Warnf("load config version file:%s error:%v", f.Name(), err)
+				continue
+			}
+			v := &ConfigVersion{}
+			if err = json.Unmarshal(data, v); err != nil || v.Config == nil {
+				log.Warnf("skip bad config version file:%s error:%v", f.Name(), err)
+				continue
+			}
+			vs = append(vs, v)
+		}
+		sort.Slice(vs, func(i, j int) bool { return vs[i].Version < vs[j].Version })
+		if len(vs) > ch.limit {
+			vs = vs[len(vs)-ch.limit:]
+		}
+		if len(vs) > 0 {
+			ch.versions[d.Name()] = vs
+		}
+	}
+}
+
+// record adds the copy of cc as the new version if it's changed.
+func (ch *configHistory) record(cc *ClusterConfig, source string) {
+	ch.lock.Lock()
+	defer ch.lock.Unlock()
+	vs := ch.versions[cc.Name]
+	if len(vs) > 0 && reflect.DeepEqual(vs[len(vs)-1].Config, cc) {
+		return
+	}
+	v := &ConfigVersion{Version: 1, Time: time.Now().Unix(), Source: source, Config: cloneClusterConfig(cc)}
+	if len(vs) > 0 {
+		v.Version = vs[len(vs)-1].Version + 1
+	}
+	vs = append(vs, v)
+	var expired []*ConfigVersion
+	if len(vs) > ch.limit {
+		expired = vs[:len(vs)-ch.limit]
+		vs = vs[len(vs)-ch.limit:]
+	}
+	ch.versions[cc.Name] = vs
+	if ch.dir != "" {
+		if err := ch.save(cc.Name, v, expired); err != nil {
+			log.Errorf("save config version:%d of cluster:%s error:%v", v.Version, cc.Name, err)
+		}
+	}
+}
+
+func (ch *configHistory) save(name string, v *ConfigVersion, expired []*ConfigVersion) (err error) {
+	dir := filepath.Join(ch.dir, name)
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	// NOTE: the config may contain the auth of cluster.
+	if err = ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("%d.json", v.Version)), data, 0600); err != nil {
+		return
+	}
+	for _, e := range expired {
+		_ = os.Remove(filepath.Join(dir, fmt.Sprintf("%d.json", e.Version)))
+	}
+	return
+}
+
+// list returns the versions of cluster name from the oldest.
+func (ch *configHistory) list(name string) []*ConfigVersion {
+	ch.lock.Lock()
+	defer ch.lock.Unlock()
+	return append([]*ConfigVersion(nil), ch.versions[name]...)
+}
+
+// get returns the copy of the config of version, nil if not kept.
+func (ch *configHistory) get(name string, version int64) *ClusterConfig {
+	ch.lock.Lock()
+	defer ch.lock.Unlock()
+	for _, v := range ch.versions[name] {
+		if v.Version == version {
+			return cloneClusterConfig(v.Config)
+		}
+	}
+	return nil
+}
+
+func cloneClusterConfig(cc *ClusterConfig) *ClusterConfig {
+	c := *cc
+	c.Servers = append([]string(nil), cc.Servers...)
+	c.Sentinels = append([]string(nil), cc.Sentinels...)
+	return &c
+}
+
+// versions returns the config history of proxy.
+func (p *Proxy) versions() *configHistory {
+	p.historyOnce.Do(func() {
+		limit, dir := 0, ""
+		if p.c != nil {
+			limit, dir = p.c.Proxy.ConfigVersions, p.c.Proxy.ConfigVersionsDir
+		}
+		p.history = newConfigHistory(limit, dir)
+	})
+	return p.history
+}
+
+// ConfigVersions returns the versions of the config of cluster name kept by
+// proxy from the oldest.
+func (p *Proxy) ConfigVersions(name string) []*ConfigVersion {
+	return p.versions().list(name)
+}
+
+// Rollback applies the config of version to cluster name as a reload, and
+// persists it into cluster config file ccf if set. The cluster keeps the
+// current config if the version fails to serve.
+func (p *Proxy) Rollback(ccf, name string, version int64) (err error) {
+	cc := p.versions().get(name, version)
+	if cc == nil {
+		return errors.Wrapf(ErrAdminVersionNotFound, "cluster:%s version:%d", name, version)
+	}
+	p.reloadLock.Lock()
+	defer p.reloadLock.Unlock()
+	p.lock.Lock()
+	cur := p.clusterConfig(name)
+	newConfs := make([]*ClusterConfig, 0, len(p.ccs))
+	for _, c := range p.ccs {
+		if c.Name == name {
+			c = cc
+		}
+		newConfs = append(newConfs, c)
+	}
+	p.lock.Unlock()
+	if cur == nil {
+		return errors.Wrapf(ErrAdminClusterNotFound, "cluster:%s", name)
+	}
+	old := cloneClusterConfig(cur)
+	if err = p.applyConfs(newConfs, versionSourceRollback); err != nil {
+		p.lock.Lock()
+		serving := p.clusterConfig(name) != nil
+		p.lock.Unlock()
+		if !serving {
+			// NOTE: serve the current config again as the version failed.
+			for i, c := range newConfs {
+				if c == cc {
+					newConfs[i] = old
+				}
+			}
+			if rerr := p.applyConfs(newConfs, versionSourceRollback); rerr != nil {
+				log.Errorf("rollback cluster:%s failed to restore the current config error:%v", name, rerr)
+			}
+		}
+		return
+	}
+	log.Infof("admin rollback cluster:%s to version:%d", name, version)
+	if ccf != "" {
+		if err = persistCluster(ccf, cc); err != nil {
+			log.Errorf("admin persist cluster:%s into file:%s error:%v", name, ccf, err)
+			err = errors.Wrapf(err, "config is rolled back but not persisted")
+		}
+	}
+	return
+}
+
+// persistCluster rewrites the config of cluster cc in config file ccf.
+func persistCluster(ccf string, cc *ClusterConfig) (err error) {
+	cs, err := readClusterConfigs(ccf)
+	if err != nil {
+		return
+	}
+	for i, c := range cs.Clusters {
+		if c.Name == cc.Name {
+			cs.Clusters[i] = cc
+		}
+	}
+	return writeClusterConfigs(ccf, cs)
+}
+
+// Version is the version of config to roll back to by admin api.
+type Version struct {
+	Version int64 `json:"version"`
+}
+
+// serveVersions lists the config versions of cluster by GET, and rolls back
+// to the version by POST.
+func (p *Proxy) serveVersions(w http.ResponseWriter, req *http.Request, ccf, name string) {
+	var err error
+	switch req.Method {
+	case http.MethodGet:
+		vs := p.ConfigVersions(name)
+		res := make([]map[string]interface{}, 0, len(vs))
+		for _, v := range vs {
+			var c map[string]interface{}
+			if c, err = redactedConfig(v.Config); err != nil {
+				break
+			}
+			res = append(res, map[string]interface{}{
+				"version": v.Version,
+				"time":    v.Time,
+				"source":  v.Source,
+				"config":  c,
+			})
+		}
+		if err == nil {
+			err = json.NewEncoder(w).Encode(res)
+		}
+	case http.MethodPost:
+		v := &Version{}
+		if err = json.NewDecoder(req.Body).Decode(v); err != nil {
+			http.Error(w, fmt.Sprintf("%s", err), http.StatusBadRequest)
+			return
+		}
+		if err = p.Rollback(ccf, name, v.Version); err == nil {
+			_, _ = w.Write([]byte("ok"))
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	adminError(w, err)
+}
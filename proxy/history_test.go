@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overlord-versions")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ch := newConfigHistory(2, dir)
+	cc := &ClusterConfig{Name: "a", Servers: []string{"127.0.0.1:1:1"}}
+	ch.record(cc, versionSourceServe)
+	ch.record(cc, versionSourceReload)
+	assert.Len(t, ch.list("a"), 1, "the same config is recorded once")
+	cc.Servers = []string{"127.0.0.1:2:1"}
+	ch.record(cc, versionSourceAdmin)
+	cc.Servers = []string{"127.0.0.1:3:1"}
+	ch.record(cc, versionSourceReload)
+
+	vs := ch.list("a")
+	assert.Len(t, vs, 2)
+	assert.Equal(t, int64(2), vs[0].Version)
+	assert.Equal(t, versionSourceAdmin, vs[0].Source)
+	assert.Equal(t, []string{"127.0.0.1:2:1"}, vs[0].Config.Servers)
+	assert.Equal(t, int64(3), vs[1].Version)
+	assert.Nil(t, ch.get("a", 1))
+	assert.Equal(t, []string{"127.0.0.1:2:1"}, ch.get("a", 2).Servers)
+
+	// NOTE: loaded from the snapshots after restart
+	ch = newConfigHistory(2, dir)
+	vs = ch.list("a")
+	assert.Len(t, vs, 2)
+	assert.Equal(t, int64(2), vs[0].Version)
+	assert.Equal(t, []string{"127.0.0.1:3:1"}, vs[1].Config.Servers)
+	files, err := ioutil.ReadDir(dir + "/a")
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+}
+
+func TestProxyRollback(t *testing.T) {
+	p, f := _adminProxy("127.0.0.1:6379:1 r1", "127.0.0.1:6380:1 r2")
+	p.versions().record(p.ccs[0], versionSourceServe)
+	assert.NoError(t, p.DelNode("", "admin", &Node{Alias: "r2"}))
+	<-f.servers
+
+	vs := p.ConfigVersions("admin")
+	assert.Len(t, vs, 2)
+	assert.Equal(t, versionSourceAdmin, vs[1].Source)
+
+	h := p.NodesHandler("")
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, "/api/v1/clusters/admin/versions", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"source":"admin"`)
+
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodPost, "/api/v1/clusters/admin/versions", strings.NewReader(`{"version":1}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"127.0.0.1:6379:1 r1", "127.0.0.1:6380:1 r2"}, <-f.servers)
+	assert.Equal(t, []string{"127.0.0.1:6379:1 r1", "127.0.0.1:6380:1 r2"}, p.ccs[0].Servers)
+	vs = p.ConfigVersions("admin")
+	assert.Len(t, vs, 3)
+	assert.Equal(t, versionSourceRollback, vs[2].Source)
+
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodPost, "/api/v1/clusters/admin/versions", strings.NewReader(`{"version":9}`)))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, ErrAdminVersionNotFound, errors.Cause(p.Rollback("", "admin", 9)))
+}
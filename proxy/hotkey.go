@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/redis"
+)
+
+// serveCache replies GET and MGET of redis by the hot key cache and
+// invalidates the keys of write commands, it returns the messages which
+// need to be forwarded.
+func (h *Handler) serveCache(msgs []*proto.Message) []*proto.Message {
+	if h.cache == nil {
+		return msgs
+	}
+	fwd := msgs[:0:0]
+	for _, msg := range msgs {
+		if !h.cacheHit(msg) {
+			fwd = append(fwd, msg)
+		}
+	}
+	return fwd
+}
+
+func (h *Handler) cacheHit(msg *proto.Message) bool {
+	var reqs []*redis.Request
+	for _, req := range msg.Requests() {
+		rreq, ok := req.(*redis.Request)
+		if !ok {
+			return false
+		}
+		reqs = append(reqs, rreq)
+	}
+	if len(reqs) == 0 {
+		return false
+	}
+	if !reqs[0].IsGet() {
+		for _, req := range reqs {
+			if req.IsWrite() {
+				h.cache.Del(req.Key())
+			}
+		}
+		return false
+	}
+	// NOTE: MGET is replied only when all the keys are hit.
+	values := make([][]byte, len(reqs))
+	for i, req := range reqs {
+		value, ok := h.cache.Get(req.Key())
+		if !ok {
+			return false
+		}
+		values[i] = value
+	}
+	for i, req := range reqs {
+		req.Reply().SetBulk(values[i])
+	}
+	return true
+}
+
+// fillCache stores the values of hot keys replied by backend and
+// invalidates the keys of write commands again, because the reads sent
+// before write may be replied after it.
+func (h *Handler) fillCache(msgs []*proto.Message) {
+	if h.cache == nil {
+		return
+	}
+	for _, msg := range msgs {
+		if msg.Err() != nil {
+			continue
+		}
+		for _, req := range msg.Requests() {
+			rreq, ok := req.(*redis.Request)
+			if !ok {
+				continue
+			}
+			if rreq.IsGet() {
+				rreq.Values(h.cache.Set)
+			} else if rreq.IsWrite() {
+				h.cache.Del(rreq.Key())
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package hotkey
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const (
+	// entryOverhead is the estimated memory of an entry besides key and value.
+	entryOverhead = 64
+	// maxCounted limits the keys counted in one window.
+	maxCounted = 1 << 17
+)
+
+// Config is the config of hot key cache.
+type Config struct {
+	// Threshold is the accesses per second of a key to become hot.
+	Threshold int
+	TTL       time.Duration
+	MaxMemory int
+}
+
+type entry struct {
+	key    string
+	value  []byte
+	expire time.Time
+}
+
+// Cache is a small LRU cache of hot keys. The accesses of keys are counted
+// in window of a second, and only the values of keys which are hot in the
+// current window are stored.
+type Cache struct {
+	c *Config
+
+	lock   sync.Mutex
+	window int64
+	counts map[string]int
+	lru    *list.List
+	items  map[string]*list.Element
+	memory int
+
+	now func() time.Time
+}
+
+// New new a hot key cache.
+func New(c *Config) *Cache {
+	return &Cache{
+		c:      c,
+		counts: make(map[string]int),
+		lru:    list.New(),
+		items:  make(map[string]*list.Element),
+		now:    time.Now,
+	}
+}
+
+// Get records the access of key and returns the value if cached, the
+// value must not be changed.
+func (c *Cache) Get(key []byte) (value []byte, ok bool) {
+	now := c.now()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.count(key, now)
+	elem, ok := c.items[string(key)]
+	if !ok {
+		return
+	}
+	e := elem.Value.(*entry)
+	if now.After(e.expire) {
+		c.remove(elem)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return e.value, true
+}
+
+// Set stores the copy of value if the key is hot.
+func (c *Cache) Set(key, value []byte) {
+	size := len(key) + len(value) + entryOverhead
+	if size > c.c.MaxMemory {
+		return
+	}
+	now := c.now()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.window != now.Unix() || c.counts[string(key)] < c.c.Threshold {
+		return
+	}
+	if elem, ok := c.items[string(key)]; ok {
+		c.remove(elem)
+	}
+	e := &entry{key: string(key), value: append([]byte(nil), value...), expire: now.Add(c.c.TTL)}
+	c.items[e.key] = c.lru.PushFront(e)
+	c.memory += size
+	for c.memory > c.c.MaxMemory {
+		c.remove(c.lru.Back())
+	}
+}
+
+// Del invalidates the value of key.
+func (c *Cache) Del(key []byte) {
+	c.lock.Lock()
+	if elem, ok := c.items[string(key)]; ok {
+		c.remove(elem)
+	}
+	c.lock.Unlock()
+}
+
+// Len returns the count of cached keys.
+func (c *Cache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.lru.Len()
+}
+
+func (c *Cache) count(key []byte, now time.Time) {
+	if sec := now.Unix(); sec != c.window {
+		c.window = sec
+		c.counts = make(map[string]int)
+	}
+	if n, ok := c.counts[string(key)]; ok || len(c.counts) < maxCounted {
+		c.counts[string(key)] = n + 1
+	}
+}
+
+func (c *Cache) remove(elem *list.Element) {
+	e := c.lru.Remove(elem).(*entry)
+	delete(c.items, e.key)
+	c.memory -= len(e.key) + len(e.value) + entryOverhead
+}
@@ -0,0 +1,55 @@
+package hotkey
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheHotOk(t *testing.T) {
+	now := time.Unix(100, 0)
+	c := New(&Config{Threshold: 2, TTL: time.Second, MaxMemory: 1024})
+	c.now = func() time.Time { return now }
+
+	_, ok := c.Get([]byte("a"))
+	assert.False(t, ok)
+	// NOTE: not hot yet
+	c.Set([]byte("a"), []byte("va"))
+	assert.Equal(t, 0, c.Len())
+
+	_, ok = c.Get([]byte("a"))
+	assert.False(t, ok)
+	c.Set([]byte("a"), []byte("va"))
+	v, ok := c.Get([]byte("a"))
+	assert.True(t, ok)
+	assert.Equal(t, []byte("va"), v)
+
+	c.Del([]byte("a"))
+	_, ok = c.Get([]byte("a"))
+	assert.False(t, ok)
+
+	c.Set([]byte("a"), []byte("va"))
+	now = now.Add(2 * time.Second)
+	_, ok = c.Get([]byte("a"))
+	assert.False(t, ok, "expired")
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestCacheEvict(t *testing.T) {
+	c := New(&Config{Threshold: 1, TTL: time.Minute, MaxMemory: 2 * (entryOverhead + 4)})
+	for _, k := range []string{"a", "b", "c"} {
+		c.Get([]byte(k))
+		c.Set([]byte(k), []byte("vvv"))
+	}
+	assert.Equal(t, 2, c.Len())
+	_, ok := c.Get([]byte("a"))
+	assert.False(t, ok)
+	_, ok = c.Get([]byte("c"))
+	assert.True(t, ok)
+
+	c.Get([]byte("big"))
+	c.Set([]byte("big"), make([]byte, 1024))
+	_, ok = c.Get([]byte("big"))
+	assert.False(t, ok)
+}
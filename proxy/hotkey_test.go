@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"overlord/pkg/mockconn"
+	libnet "overlord/pkg/net"
+	"overlord/proxy/hotkey"
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/redis"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func _decodeRedis(t *testing.T, cmd string) []*proto.Message {
+	rpc := redis.NewProxyConn(libnet.NewConn(mockconn.CreateConn([]byte(cmd), 1), time.Second, time.Second), true)
+	msgs, err := rpc.Decode(proto.GetMsgs(1))
+	assert.NoError(t, err)
+	return msgs
+}
+
+func _encodeRedis(t *testing.T, msg *proto.Message) string {
+	mconn, buf := mockconn.CreateDownStreamConn()
+	wpc := redis.NewProxyConn(libnet.NewConn(mconn, time.Second, time.Second), true)
+	assert.NoError(t, wpc.Encode(msg))
+	assert.NoError(t, wpc.Flush())
+	return buf.String()
+}
+
+func TestHandlerServeCacheOk(t *testing.T) {
+	h := &Handler{cache: hotkey.New(&hotkey.Config{Threshold: 1, TTL: time.Minute, MaxMemory: 1024})}
+
+	msgs := _decodeRedis(t, "*2\r\n$3\r\nGET\r\n$1\r\na\r\n")
+	fwd := h.serveCache(msgs)
+	assert.Len(t, fwd, 1)
+	fwd[0].Request().(*redis.Request).Reply().SetBulk([]byte("va"))
+	h.fillCache(fwd)
+
+	msgs = _decodeRedis(t, "*2\r\n$3\r\nGET\r\n$1\r\na\r\n")
+	assert.Len(t, h.serveCache(msgs), 0)
+	assert.Equal(t, "$2\r\nva\r\n", _encodeRedis(t, msgs[0]))
+
+	// NOTE: MGET is served only when all keys hit
+	msgs = _decodeRedis(t, "*3\r\n$4\r\nMGET\r\n$1\r\na\r\n$1\r\nb\r\n")
+	assert.Len(t, h.serveCache(msgs), 1)
+	msgs = _decodeRedis(t, "*2\r\n$4\r\nMGET\r\n$1\r\na\r\n")
+	assert.Len(t, h.serveCache(msgs), 0)
+	assert.Equal(t, "*1\r\n$2\r\nva\r\n", _encodeRedis(t, msgs[0]))
+
+	msgs = _decodeRedis(t, "*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\nb\r\n")
+	assert.Len(t, h.serveCache(msgs), 1)
+	assert.Equal(t, 0, h.cache.Len())
+}
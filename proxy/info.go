@@ -0,0 +1,295 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"overlord/pkg/types"
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/redis"
+	"overlord/version"
+)
+
+// the sections of INFO answered by proxy in order.
+const (
+	infoServer  = "server"
+	infoClients = "clients"
+	infoStats   = "stats"
+	infoNodes   = "nodes"
+)
+
+var (
+	infoSectionOrder = []string{infoServer, infoClients, infoStats, infoNodes}
+	infoSections     = map[string]struct{}{
+		infoServer:   {},
+		infoClients:  {},
+		infoStats:    {},
+		infoNodes:    {},
+		"default":    {},
+		"all":        {},
+		"everything": {},
+	}
+)
+
+// clusterStat is the counters of cluster reported by INFO, it lives as long
+// as proxy so that it is kept across reloads.
+type clusterStat struct {
+	cmds, hits, misses int64
+	// paused is 1 if the writes of cluster are paused by admin api, such as
+	// the cut-over of migration.
+	paused int32
+	// capture is the *capture.Capture started by admin api, nil if not
+	// capturing.
+	capture atomic.Value
+
+	lock sync.Mutex
+	// last and prev are the samples to calculate ops per second.
+	last, prev opsSample
+}
+
+type opsSample struct {
+	at   time.Time
+	cmds int64
+}
+
+// clusterStat returns the stat of cluster name, created if not exists.
+func (p *Proxy) clusterStat(name string) *clusterStat {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.stats == nil {
+		p.stats = map[string]*clusterStat{}
+	}
+	cs, ok := p.stats[name]
+	if !ok {
+		now := opsSample{at: time.Now()}
+		cs = &clusterStat{last: now, prev: now}
+		p.stats[name] = cs
+	}
+	return cs
+}
+
+// record counts msg and its hits, nil cs records nothing.
+func (cs *clusterStat) record(msg *proto.Message) {
+	if cs == nil {
+		return
+	}
+	atomic.AddInt64(&cs.cmds, 1)
+	if hits, misses := messageHits(msg); hits > 0 || misses > 0 {
+		atomic.AddInt64(&cs.hits, int64(hits))
+		atomic.AddInt64(&cs.misses, int64(misses))
+	}
+}
+
+// ops returns the commands per second between the last two samples, the
+// sample is taken if the last one is older than one second.
+func (cs *clusterStat) ops() float64 {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	now := time.Now()
+	if now.Sub(cs.last.at) >= time.Second {
+		cs.prev = cs.last
+		cs.last = opsSample{at: now, cmds: atomic.LoadInt64(&cs.cmds)}
+	}
+	if dur := cs.last.at.Sub(cs.prev.at).Seconds(); dur > 0 {
+		return float64(cs.last.cmds-cs.prev.cmds) / dur
+	}
+	return 0
+}
+
+// messageHits returns the keys found and not found in the replies of msg.
+func messageHits(msg *proto.Message) (hits, misses int) {
+	if msg.Err() != nil {
+		return
+	}
+	for _, r := range msg.Requests() {
+		if hr, ok := r.(proto.Hitter); ok {
+			hit, miss := hr.Hits()
+			hits += hit
+			misses += miss
+		}
+	}
+	return
+}
+
+// infoRequest returns the INFO request of msg and the sections of proxy
+// and nodes requested.
+func (h *Handler) infoRequest(msg *proto.Message) (req *redis.Request, local, backend []string) {
+	req, ok := msg.Request().(*redis.Request)
+	if !ok || !req.IsInfo() {
+		return nil, nil, nil
+	}
+	sections := req.InfoSections()
+	all := len(sections) == 0
+	wanted := map[string]bool{}
+	for _, s := range sections {
+		switch s {
+		case "default", "all", "everything":
+			all = true
+		default:
+			wanted[s] = true
+		}
+	}
+	for _, s := range infoSectionOrder {
+		if all || wanted[s] {
+			local = append(local, s)
+		}
+	}
+	for _, s := range h.cc.InfoBackendSections {
+		if s = strings.ToLower(s); all || wanted[s] {
+			backend = append(backend, s)
+		}
+	}
+	return
+}
+
+// serveInfo returns the messages to be forwarded except the INFO answered
+// by proxy only, INFO is sent to all nodes if their sections are requested.
+func (h *Handler) serveInfo(msgs []*proto.Message) []*proto.Message {
+	if h.cc.CacheType != types.CacheTypeRedis && h.cc.CacheType != types.CacheTypeRedisCluster {
+		return msgs
+	}
+	var fwd []*proto.Message
+	for i, msg := range msgs {
+		if req, _, backend := h.infoRequest(msg); req == nil || len(backend) > 0 {
+			if fwd != nil {
+				fwd = append(fwd, msg)
+			}
+			continue
+		}
+		if fwd == nil {
+			fwd = append(msgs[:0:0], msgs[:i]...)
+		}
+	}
+	if fwd == nil {
+		return msgs
+	}
+	return fwd
+}
+
+// replyInfo answers INFO of redis by the sections of proxy followed by the
+// sections merged from nodes.
+func (h *Handler) replyInfo(msg *proto.Message) {
+	req, local, backend := h.infoRequest(msg)
+	if req == nil || msg.Err() != nil {
+		return
+	}
+	var buf bytes.Buffer
+	for _, s := range local {
+		if buf.Len() > 0 {
+			buf.WriteString("\r\n")
+		}
+		h.writeInfo(&buf, s)
+	}
+	if len(backend) > 0 {
+		if merged := redis.MergeInfo(msg, backend); len(merged) > 0 {
+			if buf.Len() > 0 {
+				buf.WriteString("\r\n")
+			}
+			buf.Write(merged)
+		}
+	}
+	req.Reply().SetBulk(buf.Bytes())
+}
+
+func (h *Handler) writeInfo(buf *bytes.Buffer, section string) {
+	field := func(name string, value interface{}) {
+		fmt.Fprintf(buf, "%s:%v\r\n", name, value)
+	}
+	switch section {
+	case infoServer:
+		buf.WriteString("# Server\r\n")
+		uptime := int64(time.Since(h.p.start) / time.Second)
+		field("overlord_version", version.Str())
+		field("cache_type", h.cc.CacheType)
+		field("cluster_name", h.cc.Name)
+		field("listen_addr", h.cc.ListenAddr)
+		field("process_id", os.Getpid())
+		field("uptime_in_seconds", uptime)
+		field("uptime_in_days", uptime/86400)
+	case infoClients:
+		buf.WriteString("# Clients\r\n")
+		var clients int
+		h.p.clientLock.RLock()
+		for _, c := range h.p.clients {
+			if c.cc.Name == h.cc.Name {
+				clients++
+			}
+		}
+		h.p.clientLock.RUnlock()
+		field("connected_clients", clients)
+		field("proxy_connected_clients", atomic.LoadInt32(&h.p.conns))
+	case infoStats:
+		buf.WriteString("# Stats\r\n")
+		var (
+			cmds, hits, misses int64
+			ops, ratio         float64
+		)
+		if cs := h.cstat; cs != nil {
+			cmds, hits, misses = atomic.LoadInt64(&cs.cmds), atomic.LoadInt64(&cs.hits), atomic.LoadInt64(&cs.misses)
+			ops = cs.ops()
+		}
+		if hits+misses > 0 {
+			ratio = float64(hits) / float64(hits+misses)
+		}
+		field("total_commands_processed", cmds)
+		field("instantaneous_ops_per_sec", fmt.Sprintf("%.2f", ops))
+		field("keyspace_hits", hits)
+		field("keyspace_misses", misses)
+		field("keyspace_hit_ratio", fmt.Sprintf("%.4f", ratio))
+		if cs := h.cstat; cs != nil {
+			field("writes_paused", atomic.LoadInt32(&cs.paused))
+		}
+		if a := h.admitter; a != nil {
+			field("inflight", len(a.slots))
+			field("inflight_queued", atomic.LoadInt64(&a.queued))
+			field("inflight_shed", atomic.LoadInt64(&a.shed))
+		}
+		if s := h.shadower; s != nil {
+			field("shadow_cluster", s.shadow)
+			field("shadow_mirrored", atomic.LoadInt64(&s.mirrored))
+			field("shadow_failed", atomic.LoadInt64(&s.failed))
+			field("shadow_dropped", atomic.LoadInt64(&s.dropped))
+			field("shadow_pending", atomic.LoadInt32(&s.pending))
+		}
+		if s := h.mirrorer; s != nil {
+			field("mirror_cluster", s.shadow)
+			field("mirror_mirrored", atomic.LoadInt64(&s.mirrored))
+			field("mirror_failed", atomic.LoadInt64(&s.failed))
+			field("mirror_dropped", atomic.LoadInt64(&s.dropped))
+			field("mirror_pending", atomic.LoadInt32(&s.pending))
+		}
+		if fb := h.fallback; fb != nil {
+			field("fallback_cluster", fb.fallback)
+			field("fallback_hits", atomic.LoadInt64(&fb.hits))
+			field("fallback_misses", atomic.LoadInt64(&fb.misses))
+			field("fallback_failed", atomic.LoadInt64(&fb.failed))
+		}
+	case infoNodes:
+		buf.WriteString("# Nodes\r\n")
+		var nss []*proto.NodeStat
+		if ns, ok := h.forwarder.(proto.NodeStater); ok {
+			nss = ns.NodeStats()
+		}
+		field("node_count", len(nss))
+		for i, ns := range nss {
+			status := "up"
+			if !ns.Up {
+				status = "down"
+			}
+			stat := fmt.Sprintf("addr=%s,alias=%s,role=%s,status=%s,conns=%d,busy=%d,queued=%d",
+				ns.Addr, ns.Alias, ns.Role, status, ns.Conns, ns.Busy, ns.Queued)
+			if ns.Breaker != "" {
+				stat += ",breaker=" + ns.Breaker
+			}
+			if ns.ReadTimeout > 0 {
+				stat += fmt.Sprintf(",read_timeout=%d", ns.ReadTimeout/time.Millisecond)
+			}
+			field(fmt.Sprintf("node%d", i), stat)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"overlord/pkg/mockconn"
+	libnet "overlord/pkg/net"
+	"overlord/pkg/types"
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/redis"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type _statForwarder struct {
+	_updateForwarder
+}
+
+func (f *_statForwarder) NodeStats() []*proto.NodeStat {
+	return []*proto.NodeStat{
+		{Addr: "127.0.0.1:6379", Alias: "a", Role: "master", Up: true, Conns: 2},
+		{Addr: "127.0.0.1:6380", Alias: "b", Role: "master"},
+	}
+}
+
+func decodeInfo(t *testing.T, cmd string) *proto.Message {
+	rpc := redis.NewProxyConn(libnet.NewConn(mockconn.CreateConn([]byte(cmd+"\r\n"), 1), time.Second, time.Second), true)
+	msgs, err := rpc.Decode(proto.GetMsgs(1))
+	assert.NoError(t, err)
+	return msgs[0]
+}
+
+func TestHandlerReplyInfo(t *testing.T) {
+	p := &Proxy{start: time.Now()}
+	cc := &ClusterConfig{Name: "info-test", CacheType: types.CacheTypeRedis, InfoBackendSections: []string{"keyspace"}}
+	h := &Handler{p: p, cc: cc, addr: "127.0.0.1:12345", forwarder: &_statForwarder{}, cstat: p.clusterStat(cc.Name)}
+	p.addClient(h)
+
+	get := decodeInfo(t, "get a")
+	get.Request().(*redis.Request).Reply().SetBulk([]byte("1"))
+	h.cstat.record(get)
+	get = decodeInfo(t, "get b")
+	get.Request().(*redis.Request).Reply().SetNullBulk()
+	h.cstat.record(get)
+
+	msgs := []*proto.Message{decodeInfo(t, "info"), decodeInfo(t, "info stats nodes"), decodeInfo(t, "info keyspace")}
+	fwd := h.serveInfo(msgs)
+	assert.Len(t, fwd, 2)
+	assert.True(t, fwd[0] == msgs[0])
+	assert.True(t, fwd[1] == msgs[2])
+
+	for _, msg := range msgs {
+		h.replyInfo(msg)
+	}
+	reply := func(msg *proto.Message) string {
+		return string(msg.Request().(*redis.Request).Reply().Data())
+	}
+	all := reply(msgs[0])
+	for _, s := range []string{"# Server\r\n", "cluster_name:info-test\r\n", "# Clients\r\n", "connected_clients:1\r\n"} {
+		assert.Contains(t, all, s)
+	}
+	stats := reply(msgs[1])
+	assert.False(t, strings.Contains(stats, "# Server"))
+	for _, s := range []string{"total_commands_processed:2\r\n", "keyspace_hits:1\r\n", "keyspace_misses:1\r\n", "keyspace_hit_ratio:0.5000\r\n",
+		"node_count:2\r\n", "node0:addr=127.0.0.1:6379,alias=a,role=master,status=up,conns=2,busy=0,queued=0\r\n", "node1:addr=127.0.0.1:6380,alias=b,role=master,status=down"} {
+		assert.Contains(t, stats, s)
+	}
+	assert.Equal(t, "0\r\n", reply(msgs[2]))
+}
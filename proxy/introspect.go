@@ -0,0 +1,198 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"overlord/pkg/types"
+	"overlord/proxy/proto"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+)
+
+const redactedValue = "******"
+
+// redactedKeys are the secrets redacted from the config shown by admin api.
+var redactedKeys = []string{"auth", "redis_auth", "admin_token"}
+
+// ClusterState is the runtime state of cluster shown by admin api.
+type ClusterState struct {
+	Name         string          `json:"name"`
+	CacheType    types.CacheType `json:"cache_type"`
+	ListenAddr   string          `json:"listen_addr"`
+	Nodes        int             `json:"nodes"`
+	Clients      int             `json:"clients"`
+	Cmds         int64           `json:"cmds"`
+	Ops          float64         `json:"ops"`
+	Hits         int64           `json:"hits"`
+	Misses       int64           `json:"misses"`
+	WritesPaused bool            `json:"writes_paused"`
+}
+
+// NodeState is the runtime state of node shown by admin api.
+type NodeState struct {
+	Role string `json:"role"`
+	// Up is false if the node is ejected by ping.
+	Up      bool   `json:"up"`
+	Conns   int32  `json:"conns"`
+	Busy    int32  `json:"busy"`
+	Queued  int32  `json:"queued"`
+	Breaker string `json:"breaker,omitempty"`
+	// ReadTimeout is the adaptive read timeout in milliseconds.
+	ReadTimeout int64 `json:"read_timeout_ms,omitempty"`
+	// Latency is the moving average latency in microseconds.
+	Latency int64 `json:"latency_us"`
+}
+
+func newNodeState(ns *proto.NodeStat) *NodeState {
+	return &NodeState{
+		Role:        ns.Role,
+		Up:          ns.Up,
+		Conns:       ns.Conns,
+		Busy:        ns.Busy,
+		Queued:      ns.Queued,
+		Breaker:     ns.Breaker,
+		ReadTimeout: int64(ns.ReadTimeout / time.Millisecond),
+		Latency:     int64(ns.Latency / time.Microsecond),
+	}
+}
+
+// Clusters returns the state of all the clusters serving.
+func (p *Proxy) Clusters() []*ClusterState {
+	p.lock.Lock()
+	ccs := append([]*ClusterConfig(nil), p.ccs...)
+	p.lock.Unlock()
+	clients := map[string]int{}
+	for _, ci := range p.Clients("", "") {
+		clients[ci.Cluster]++
+	}
+	css := make([]*ClusterState, 0, len(ccs))
+	for _, cc := range ccs {
+		stat := p.clusterStat(cc.Name)
+		cs := &ClusterState{
+			Name:         cc.Name,
+			CacheType:    cc.CacheType,
+			ListenAddr:   cc.ListenAddr,
+			Nodes:        len(p.nodeStats(cc.Name)),
+			Clients:      clients[cc.Name],
+			Cmds:         atomic.LoadInt64(&stat.cmds),
+			Ops:          stat.ops(),
+			Hits:         atomic.LoadInt64(&stat.hits),
+			Misses:       atomic.LoadInt64(&stat.misses),
+			WritesPaused: atomic.LoadInt32(&stat.paused) == 1,
+		}
+		css = append(css, cs)
+	}
+	return css
+}
+
+// nodeStats returns the stats of nodes of cluster name, nil if the
+// forwarder doesn't report.
+func (p *Proxy) nodeStats(name string) []*proto.NodeStat {
+	f, ok := p.forwarder(name)
+	if !ok {
+		return nil
+	}
+	if ns, ok := f.(proto.NodeStater); ok {
+		return ns.NodeStats()
+	}
+	return nil
+}
+
+// EffectiveConfig returns the config of proxy and clusters serving in the
+// keys of config file, the secrets are redacted.
+func (p *Proxy) EffectiveConfig() (map[string]interface{}, error) {
+	c, err := redactedConfig(p.c)
+	if err != nil {
+		return nil, err
+	}
+	p.lock.Lock()
+	ccs := append([]*ClusterConfig(nil), p.ccs...)
+	p.lock.Unlock()
+	clusters := make([]map[string]interface{}, 0, len(ccs))
+	for _, cc := range ccs {
+		m, err := redactedConfig(cc)
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, m)
+	}
+	return map[string]interface{}{"proxy": c, "clusters": clusters}, nil
+}
+
+// redactedConfig converts v into the map of its toml keys.
+func redactedConfig(v interface{}) (map[string]interface{}, error) {
+	buf := &bytes.Buffer{}
+	if err := toml.NewEncoder(buf).Encode(v); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	m := map[string]interface{}{}
+	if _, err := toml.Decode(buf.String(), &m); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	redact(m)
+	return m, nil
+}
+
+func redact(m map[string]interface{}) {
+	for k, v := range m {
+		if sub, ok := v.(map[string]interface{}); ok {
+			redact(sub)
+			continue
+		}
+		for _, key := range redactedKeys {
+			if k == key && v != "" {
+				m[k] = redactedValue
+			}
+		}
+	}
+}
+
+// ServeClusters shows the state of all clusters by GET /api/v1/clusters.
+func (p *Proxy) ServeClusters(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(p.Clusters()); err != nil {
+		http.Error(w, fmt.Sprintf("%s", err), http.StatusInternalServerError)
+	}
+}
+
+// ServeConfig shows the effective config by GET /api/v1/config.
+func (p *Proxy) ServeConfig(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	c, err := p.EffectiveConfig()
+	if err == nil {
+		err = json.NewEncoder(w).Encode(c)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s", err), http.StatusInternalServerError)
+	}
+}
+
+// AdminAuth requires the admin token of config by header
+// "Authorization: Bearer <token>" before serving h, no token is required if
+// not configured.
+func (p *Proxy) AdminAuth(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if token := p.c.Proxy.AdminToken; token != "" {
+			got := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		h(w, req)
+	}
+}
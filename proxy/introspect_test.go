@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"overlord/pkg/types"
+	"overlord/proxy/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func _introspectProxy() *Proxy {
+	cc := &ClusterConfig{Name: "admin", CacheType: types.CacheTypeRedis, ListenAddr: "0.0.0.0:26379", RedisAuth: "secret",
+		Servers: []string{"127.0.0.1:6379:1", "127.0.0.1:6380:1"}}
+	c := DefaultConfig()
+	c.Proxy.AdminToken = "token"
+	return &Proxy{c: c, ccs: []*ClusterConfig{cc}, forwarders: map[string]proto.Forwarder{cc.Name: &_statForwarder{}}}
+}
+
+func TestProxyClusters(t *testing.T) {
+	p := _introspectProxy()
+	css := p.Clusters()
+	assert.Len(t, css, 1)
+	assert.Equal(t, "admin", css[0].Name)
+	assert.Equal(t, types.CacheTypeRedis, css[0].CacheType)
+	assert.Equal(t, 2, css[0].Nodes)
+
+	nodes, err := p.Nodes("admin")
+	assert.NoError(t, err)
+	assert.Len(t, nodes, 2)
+	assert.Equal(t, &NodeState{Role: "master", Up: true, Conns: 2}, nodes[0].State)
+	assert.False(t, nodes[1].State.Up)
+
+	p.ccs[0].CacheType = types.CacheTypeRedisCluster
+	nodes, err = p.Nodes("admin")
+	assert.NoError(t, err)
+	assert.Len(t, nodes, 2, "the nodes discovered")
+}
+
+func TestProxyEffectiveConfig(t *testing.T) {
+	p := _introspectProxy()
+	c, err := p.EffectiveConfig()
+	assert.NoError(t, err)
+	clusters := c["clusters"].([]map[string]interface{})
+	assert.Len(t, clusters, 1)
+	assert.Equal(t, "0.0.0.0:26379", clusters[0]["listen_addr"])
+	assert.Equal(t, redactedValue, clusters[0]["redis_auth"])
+	assert.Equal(t, "", clusters[0]["auth"])
+	proxy := c["proxy"].(map[string]interface{})["Proxy"].(map[string]interface{})
+	assert.Equal(t, redactedValue, proxy["admin_token"])
+	assert.Equal(t, "secret", p.ccs[0].RedisAuth, "the serving config is not changed")
+}
+
+func TestProxyAdminAuth(t *testing.T) {
+	p := _introspectProxy()
+	h := p.AdminAuth(p.ServeClusters)
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, "/api/v1/clusters", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/clusters", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	h(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var css []*ClusterState
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &css))
+	assert.Len(t, css, 1)
+
+	p.c.Proxy.AdminToken = ""
+	w = httptest.NewRecorder()
+	p.AdminAuth(p.ServeConfig)(w, httptest.NewRequest(http.MethodGet, "/api/v1/config", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"redis_auth":"******"`)
+}
@@ -7,8 +7,11 @@ import (
 	"github.com/pkg/errors"
 )
 
-// Listen listen.
+// Listen listen, the listener inherited from the old process is used first.
 func Listen(proto string, addr string) (net.Listener, error) {
+	if l, ok, err := inherit(proto, addr); ok {
+		return l, err
+	}
 	switch proto {
 	case "tcp":
 		return listenTCP(addr)
@@ -0,0 +1,15 @@
+package mcstat
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// ServeHTTP shows the memcache stats of nodes, only of the cluster if given.
+func ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(Stats(req.URL.Query().Get("cluster"))); err != nil {
+		http.Error(w, fmt.Sprintf("%s", err), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,122 @@
+package mcstat
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"overlord/pkg/prom"
+)
+
+// Stat is the kind of memcache reply counted as native memcached stats.
+type Stat int
+
+// Stats mirrors the counters of memcached stats command.
+const (
+	GetHits Stat = iota
+	GetMisses
+	Stored
+	NotStored
+	CasHits
+	CasMisses
+	CasBadval
+	TouchHits
+	TouchMisses
+
+	statCount
+)
+
+var statNames = [statCount]string{
+	GetHits:     "get_hits",
+	GetMisses:   "get_misses",
+	Stored:      "stored",
+	NotStored:   "not_stored",
+	CasHits:     "cas_hits",
+	CasMisses:   "cas_misses",
+	CasBadval:   "cas_badval",
+	TouchHits:   "touch_hits",
+	TouchMisses: "touch_misses",
+}
+
+func (s Stat) String() string {
+	if s < 0 || s >= statCount {
+		return "unknown"
+	}
+	return statNames[s]
+}
+
+// Stater is the request which classifies its reply into Stat, ok is false
+// if the reply is not counted.
+type Stater interface {
+	Stat() (s Stat, ok bool)
+}
+
+// counters is the stats of one node.
+type counters [statCount]int64
+
+var (
+	statMap  = map[string]map[string]*counters{}
+	statLock sync.RWMutex
+)
+
+func get(cluster, node string) *counters {
+	statLock.RLock()
+	c, ok := statMap[cluster][node]
+	statLock.RUnlock()
+	if ok {
+		return c
+	}
+	statLock.Lock()
+	defer statLock.Unlock()
+	nodes, ok := statMap[cluster]
+	if !ok {
+		nodes = map[string]*counters{}
+		statMap[cluster] = nodes
+	}
+	if c, ok = nodes[node]; !ok {
+		c = &counters{}
+		nodes[node] = c
+	}
+	return c
+}
+
+// Incr increments the stat s of node in cluster.
+func Incr(cluster, node string, s Stat) {
+	if s < 0 || s >= statCount {
+		return
+	}
+	atomic.AddInt64(&get(cluster, node)[s], 1)
+	if prom.On {
+		prom.MemcacheStatIncr(cluster, node, s.String())
+	}
+}
+
+// NodeStats is the snapshot of stats of one node.
+type NodeStats map[string]float64
+
+// Stats returns the snapshot of nodes stats by cluster, only of the cluster
+// if given. get_hit_ratio is get_hits / (get_hits + get_misses).
+func Stats(cluster string) map[string]map[string]NodeStats {
+	statLock.RLock()
+	defer statLock.RUnlock()
+	all := make(map[string]map[string]NodeStats, len(statMap))
+	for name, nodes := range statMap {
+		if cluster != "" && cluster != name {
+			continue
+		}
+		ns := make(map[string]NodeStats, len(nodes))
+		for node, c := range nodes {
+			st := make(NodeStats, statCount+1)
+			for i := range c {
+				st[Stat(i).String()] = float64(atomic.LoadInt64(&c[i]))
+			}
+			var ratio float64
+			if gets := st[GetHits.String()] + st[GetMisses.String()]; gets > 0 {
+				ratio = st[GetHits.String()] / gets
+			}
+			st["get_hit_ratio"] = ratio
+			ns[node] = st
+		}
+		all[name] = ns
+	}
+	return all
+}
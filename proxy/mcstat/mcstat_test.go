@@ -0,0 +1,49 @@
+package mcstat
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatString(t *testing.T) {
+	assert.Equal(t, "get_hits", GetHits.String())
+	assert.Equal(t, "cas_badval", CasBadval.String())
+	assert.Equal(t, "unknown", statCount.String())
+}
+
+func TestIncrStats(t *testing.T) {
+	Incr("mcstat-test", "127.0.0.1:11211", GetHits)
+	Incr("mcstat-test", "127.0.0.1:11211", GetHits)
+	Incr("mcstat-test", "127.0.0.1:11211", GetHits)
+	Incr("mcstat-test", "127.0.0.1:11211", GetMisses)
+	Incr("mcstat-test", "127.0.0.1:11212", Stored)
+	Incr("mcstat-test", "127.0.0.1:11212", statCount)
+	Incr("mcstat-other", "127.0.0.1:11211", CasBadval)
+
+	all := Stats("mcstat-test")
+	assert.Len(t, all, 1)
+	nodes := all["mcstat-test"]
+	assert.Len(t, nodes, 2)
+	assert.Equal(t, float64(3), nodes["127.0.0.1:11211"]["get_hits"])
+	assert.Equal(t, float64(1), nodes["127.0.0.1:11211"]["get_misses"])
+	assert.Equal(t, 0.75, nodes["127.0.0.1:11211"]["get_hit_ratio"])
+	assert.Equal(t, float64(1), nodes["127.0.0.1:11212"]["stored"])
+	assert.Equal(t, float64(0), nodes["127.0.0.1:11212"]["get_hit_ratio"])
+
+	all = Stats("")
+	assert.Equal(t, float64(1), all["mcstat-other"]["127.0.0.1:11211"]["cas_badval"])
+}
+
+func TestServeHTTP(t *testing.T) {
+	Incr("mcstat-http", "127.0.0.1:11211", TouchMisses)
+	w := httptest.NewRecorder()
+	ServeHTTP(w, httptest.NewRequest("GET", "/memcache/stats?cluster=mcstat-http", nil))
+	assert.Equal(t, 200, w.Code)
+	var all map[string]map[string]NodeStats
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &all))
+	assert.Len(t, all, 1)
+	assert.Equal(t, float64(1), all["mcstat-http"]["127.0.0.1:11211"]["touch_misses"])
+}
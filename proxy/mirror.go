@@ -0,0 +1,27 @@
+package proxy
+
+// mirror commands.
+const (
+	mirrorReads  = "reads"
+	mirrorWrites = "writes"
+	mirrorAll    = "all"
+)
+
+// newMirrorer new the shadower which mirrors mirror_percent of the reads
+// and/or writes succeeded into the staging cluster for replay and testing,
+// the replies of mirror cluster are discarded.
+func newMirrorer(p *Proxy, cc *ClusterConfig) *shadower {
+	if cc.MirrorCluster == "" {
+		return nil
+	}
+	return &shadower{
+		p:       p,
+		kind:    "mirror",
+		cluster: cc.Name,
+		shadow:  cc.MirrorCluster,
+		max:     int32(cc.MirrorMaxPending),
+		percent: cc.MirrorPercent,
+		reads:   cc.MirrorCommands != mirrorWrites,
+		writes:  cc.MirrorCommands != mirrorReads,
+	}
+}
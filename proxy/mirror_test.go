@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"overlord/pkg/types"
+	"overlord/proxy/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMirrorerMirror(t *testing.T) {
+	assert.Nil(t, newMirrorer(nil, &ClusterConfig{}))
+	f := &_shadowForwarder{}
+	p := &Proxy{forwarders: map[string]proto.Forwarder{"b": f}}
+
+	s := newMirrorer(p, &ClusterConfig{Name: "a", MirrorCluster: "b", MirrorPercent: 100, MirrorCommands: mirrorAll, MirrorMaxPending: 4})
+	s.mirror(decodeTx(t, "SET a 1\r\nGET b\r\nPING\r\n", 3))
+	waitShadow(t, s)
+	assert.Equal(t, []string{"a", "b"}, f.forwarded())
+	assert.Equal(t, int64(2), atomic.LoadInt64(&s.mirrored))
+
+	f.cmds = nil
+	s = newMirrorer(p, &ClusterConfig{Name: "a", MirrorCluster: "b", MirrorPercent: 100, MirrorCommands: mirrorReads, MirrorMaxPending: 4})
+	s.mirror(decodeTx(t, "SET a 1\r\nGET b\r\n", 2))
+	waitShadow(t, s)
+	assert.Equal(t, []string{"b"}, f.forwarded())
+
+	f.cmds = nil
+	s = newMirrorer(p, &ClusterConfig{Name: "a", MirrorCluster: "b", MirrorPercent: 100, MirrorCommands: mirrorWrites, MirrorMaxPending: 4})
+	s.mirror(decodeTx(t, "SET a 1\r\nGET b\r\n", 2))
+	waitShadow(t, s)
+	assert.Equal(t, []string{"a"}, f.forwarded())
+
+	// NOTE: about half of messages are sampled
+	f.cmds = nil
+	s = newMirrorer(p, &ClusterConfig{Name: "a", MirrorCluster: "b", MirrorPercent: 50, MirrorCommands: mirrorAll, MirrorMaxPending: 1000})
+	for i := 0; i < 20; i++ {
+		s.mirror(decodeTx(t, strings.Repeat("GET a\r\n", 20), 20))
+		waitShadow(t, s)
+	}
+	assert.InDelta(t, 200, len(f.forwarded()), 60)
+}
+
+func TestValidateMirror(t *testing.T) {
+	ccs := []*ClusterConfig{
+		{Name: "a", CacheType: types.CacheTypeRedis, MirrorCluster: "b"},
+		{Name: "b", CacheType: types.CacheTypeRedis},
+	}
+	assert.NoError(t, validateShadow(ccs))
+	ccs[1].CacheType = types.CacheTypeMemcache
+	assert.Error(t, validateShadow(ccs))
+	ccs[0].MirrorCluster = "c"
+	assert.Error(t, validateShadow(ccs))
+}
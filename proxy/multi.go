@@ -0,0 +1,240 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+
+	libnet "overlord/pkg/net"
+	"overlord/pkg/types"
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/redis"
+)
+
+var (
+	multiNestedBytes     = []byte("ERR MULTI calls can not be nested")
+	multiNotSupportBytes = []byte("ERR MULTI is not supported by the cluster")
+	execNoMultiBytes     = []byte("ERR EXEC without MULTI")
+	discardNoMultiBytes  = []byte("ERR DISCARD without MULTI")
+	watchInMultiBytes    = []byte("ERR WATCH inside MULTI is not allowed")
+	watchCrossNodeBytes  = []byte("CROSSSLOT Keys in request don't hash to the same node as the watched keys")
+)
+
+// txIndex returns the index of the first EXEC, WATCH or blocking command in
+// msgs which are served after forwarding, or -1 if none.
+func txIndex(msgs []*proto.Message) int {
+	for i, msg := range msgs {
+		if msg.IsBatch() {
+			continue
+		}
+		if req, ok := msg.Request().(*redis.Request); ok && (req.IsExec() || req.IsWatch() || req.IsBlocking()) {
+			return i
+		}
+	}
+	return -1
+}
+
+// processTx processes msgs split after each EXEC, WATCH and blocking command,
+// so that they are served in the order of the commands forwarded.
+func (h *Handler) processTx(wg *sync.WaitGroup, msgs []*proto.Message) (err error) {
+	for len(msgs) > 0 {
+		idx := txIndex(msgs) + 1
+		if idx == 0 {
+			idx = len(msgs)
+		}
+		if err = h.process(wg, msgs[:idx]); err != nil {
+			return
+		}
+		msgs = msgs[idx:]
+	}
+	return
+}
+
+// serveMulti answers MULTI, DISCARD and UNWATCH of redis clients and queues
+// the commands between MULTI and EXEC, it returns the messages which can be
+// forwarded. The commands answered by proxy such as PING are never queued.
+func (h *Handler) serveMulti(msgs []*proto.Message) []*proto.Message {
+	if h.cc.CacheType != types.CacheTypeRedis && h.cc.CacheType != types.CacheTypeRedisCluster {
+		return msgs
+	}
+	var fwd []*proto.Message
+	for i, msg := range msgs {
+		if !h.queueMulti(msg) {
+			if fwd != nil {
+				fwd = append(fwd, msg)
+			}
+			continue
+		}
+		if fwd == nil {
+			fwd = append(msgs[:0:0], msgs[:i]...)
+		}
+	}
+	if fwd == nil {
+		return msgs
+	}
+	return fwd
+}
+
+// queueMulti returns true if msg is answered or queued by the transaction.
+func (h *Handler) queueMulti(msg *proto.Message) bool {
+	req, ok := msg.Request().(*redis.Request)
+	if !ok {
+		return false
+	}
+	if msg.IsBatch() {
+		if h.tx == nil {
+			return false
+		}
+		h.tx.Queue(msg, h.forwarder.(proto.Router).Route)
+		return true
+	}
+	switch {
+	case req.IsMulti():
+		if h.tx != nil {
+			req.Reply().SetError(multiNestedBytes)
+			return true
+		}
+		if !h.txSupported() {
+			req.Reply().SetError(multiNotSupportBytes)
+			return true
+		}
+		h.tx = redis.NewTx()
+		if h.watch != nil {
+			h.tx.WithTarget(h.watch.Target())
+		}
+		req.Reply().SetString(okBytes)
+	case req.IsDiscard():
+		if h.tx == nil {
+			req.Reply().SetError(discardNoMultiBytes)
+			return true
+		}
+		h.tx.Close()
+		h.tx = nil
+		h.unwatch()
+		req.Reply().SetString(okBytes)
+	case req.IsExec():
+		if h.tx == nil {
+			req.Reply().SetError(execNoMultiBytes)
+			return true
+		}
+		h.exec, h.pending = h.tx, msg
+		h.tx = nil
+	case req.IsWatch():
+		if h.tx != nil {
+			req.Reply().SetError(watchInMultiBytes)
+			return true
+		}
+		if !h.txSupported() {
+			req.Reply().SetError(multiNotSupportBytes)
+			return true
+		}
+		h.pending = msg
+	case req.IsUnwatch():
+		h.unwatch()
+		req.Reply().SetString(okBytes)
+	case h.tx == nil && req.IsBlocking():
+		// NOTE: the blocking commands in transaction never block.
+		h.pending = msg
+	case h.tx == nil || req.IsLocal() || req.IsInfo():
+		return false
+	default:
+		h.tx.Queue(msg, h.forwarder.(proto.Router).Route)
+	}
+	return true
+}
+
+func (h *Handler) txSupported() bool {
+	_, pin := h.forwarder.(proto.Pinner)
+	_, route := h.forwarder.(proto.Router)
+	return pin && route
+}
+
+// pin returns a dedicated connection to the node of key.
+func (h *Handler) pin(key []byte) (*libnet.Conn, error) {
+	node, err := h.forwarder.(proto.Pinner).Pin(key)
+	if err != nil {
+		return nil, err
+	}
+	node.SetReadTimeout(time.Duration(h.cc.ReadTimeout) * time.Millisecond)
+	return node, nil
+}
+
+// serveTx serves the EXEC, WATCH or blocking command pending on the dedicated
+// connection to the node of their keys, it must be called after the
+// forwarded are done.
+func (h *Handler) serveTx() {
+	msg := h.pending
+	if msg == nil {
+		return
+	}
+	h.pending = nil
+	req := msg.Request().(*redis.Request)
+	switch {
+	case req.IsWatch():
+		h.watchKeys(msg, req)
+	case req.IsBlocking():
+		h.serveBlock(msg, req)
+	default:
+		h.execTx(msg, req)
+	}
+}
+
+// watchKeys sends WATCH into the node pinned by the first WATCH, the keys
+// of client must be served by the same node until unwatched.
+func (h *Handler) watchKeys(msg *proto.Message, req *redis.Request) {
+	target, ok := req.WatchTarget(h.forwarder.(proto.Router).Route)
+	if !ok {
+		return
+	}
+	if h.watch == nil {
+		node, err := h.pin(req.Key())
+		if err != nil {
+			msg.WithError(err)
+			return
+		}
+		h.watch = redis.NewWatch(node, target)
+	} else if h.watch.Target() != target {
+		req.Reply().SetError(watchCrossNodeBytes)
+		return
+	}
+	if err := h.watch.Send(req); err != nil {
+		msg.WithError(err)
+		h.unwatch()
+	}
+}
+
+// execTx executes the transaction of EXEC on the connection pinned by WATCH
+// or a dedicated connection to the node of its keys.
+func (h *Handler) execTx(msg *proto.Message, req *redis.Request) {
+	tx := h.exec
+	h.exec = nil
+	defer tx.Close()
+	defer h.unwatch()
+	if h.watch != nil {
+		if err := h.watch.Exec(tx, req.Reply()); err != nil {
+			msg.WithError(err)
+		}
+		return
+	}
+	key, ok := tx.Key()
+	if !ok {
+		_ = tx.Exec(nil, req.Reply())
+		return
+	}
+	node, err := h.pin(key)
+	if err != nil {
+		msg.WithError(err)
+		return
+	}
+	defer node.Close()
+	if err = tx.Exec(node, req.Reply()); err != nil {
+		msg.WithError(err)
+	}
+}
+
+// unwatch releases the connection pinned by WATCH.
+func (h *Handler) unwatch() {
+	if h.watch != nil {
+		_ = h.watch.Close()
+		h.watch = nil
+	}
+}
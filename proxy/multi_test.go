@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"overlord/pkg/mockconn"
+	libnet "overlord/pkg/net"
+	"overlord/pkg/types"
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/redis"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type _txForwarder struct {
+	_updateForwarder
+	node   net.Conn
+	pinned []byte
+}
+
+func (f *_txForwarder) Route(key []byte) string { return string(key[:1]) }
+
+func (f *_txForwarder) Pin(key []byte) (*libnet.Conn, error) {
+	f.pinned = key
+	return libnet.NewConn(f.node, time.Second, time.Second), nil
+}
+
+func decodeTx(t *testing.T, cmd string, n int) []*proto.Message {
+	rpc := redis.NewProxyConn(libnet.NewConn(mockconn.CreateConn([]byte(cmd), 1), time.Second, time.Second), true)
+	msgs, err := rpc.Decode(proto.GetMsgs(n))
+	assert.NoError(t, err)
+	assert.Len(t, msgs, n)
+	return msgs
+}
+
+func TestTxIndex(t *testing.T) {
+	msgs := decodeTx(t, "MULTI\r\nSET a 1\r\nEXEC\r\nGET a\r\nWATCH a\r\n", 5)
+	assert.Equal(t, 2, txIndex(msgs))
+	assert.Equal(t, 1, txIndex(msgs[3:]))
+	assert.Equal(t, -1, txIndex(msgs[3:4]))
+}
+
+func TestHandlerServeMulti(t *testing.T) {
+	f := &_txForwarder{node: mockconn.CreateConn([]byte("+OK\r\n+QUEUED\r\n+QUEUED\r\n*2\r\n+OK\r\n:1\r\n"), 1)}
+	h := &Handler{cc: &ClusterConfig{CacheType: types.CacheTypeRedis}, forwarder: f}
+	reply := func(msg *proto.Message) string {
+		r := msg.Request().(*redis.Request).Reply()
+		return string([]byte{r.Type()}) + string(r.Data())
+	}
+
+	msgs := decodeTx(t, "GET b\r\nMULTI\r\nSET a 1\r\nPING\r\nMULTI\r\nDEL a ab\r\nEXEC\r\n", 7)
+	fwd := h.serveMulti(msgs)
+	assert.Len(t, fwd, 2)
+	assert.Equal(t, msgs[0], fwd[0])
+	assert.Equal(t, msgs[3], fwd[1])
+	assert.Equal(t, "+OK", reply(msgs[1]))
+	assert.Equal(t, "+QUEUED", reply(msgs[2]))
+	assert.Equal(t, "-"+string(multiNestedBytes), reply(msgs[4]))
+	assert.Equal(t, "+QUEUED", reply(msgs[5]))
+	assert.Nil(t, h.tx)
+
+	h.serveTx()
+	assert.Nil(t, h.exec)
+	assert.Equal(t, "a", string(f.pinned))
+	r := msgs[6].Request().(*redis.Request).Reply()
+	assert.Equal(t, 2, len(r.Array()))
+	assert.NoError(t, msgs[6].Err())
+
+	msgs = decodeTx(t, "EXEC\r\nDISCARD\r\nMULTI\r\nSET a 1\r\nDISCARD\r\nMULTI\r\nSET a 1\r\nSET b 1\r\nEXEC\r\n", 9)
+	fwd = h.serveMulti(msgs)
+	assert.Len(t, fwd, 0)
+	assert.Equal(t, "-"+string(execNoMultiBytes), reply(msgs[0]))
+	assert.Equal(t, "-"+string(discardNoMultiBytes), reply(msgs[1]))
+	assert.Equal(t, "+QUEUED", reply(msgs[3]))
+	assert.Equal(t, "+OK", reply(msgs[4]))
+	assert.Equal(t, "+QUEUED", reply(msgs[6]))
+	assert.Equal(t, "-CROSSSLOT", reply(msgs[7])[:10])
+	f.pinned = nil
+	h.serveTx()
+	assert.Nil(t, f.pinned)
+	assert.Equal(t, "-"+"EXECABORT", reply(msgs[8])[:10])
+}
+
+func TestHandlerServeWatch(t *testing.T) {
+	f := &_txForwarder{node: mockconn.CreateConn([]byte("+OK\r\n+OK\r\n"), 1)}
+	h := &Handler{cc: &ClusterConfig{CacheType: types.CacheTypeRedis}, forwarder: f}
+	reply := func(msg *proto.Message) string {
+		r := msg.Request().(*redis.Request).Reply()
+		return string([]byte{r.Type()}) + string(r.Data())
+	}
+
+	msgs := decodeTx(t, "WATCH a ab\r\nWATCH a1\r\nWATCH b\r\nWATCH a b\r\nMULTI\r\nWATCH a\r\nSET b 1\r\nSET a 1\r\nEXEC\r\n", 9)
+	assert.Len(t, h.serveMulti(msgs[:1]), 0)
+	h.serveTx()
+	assert.Equal(t, "+OK", reply(msgs[0]))
+	assert.Equal(t, "a", string(f.pinned))
+	assert.NotNil(t, h.watch)
+
+	f.pinned = nil
+	h.serveMulti(msgs[1:2])
+	h.serveTx()
+	assert.Equal(t, "+OK", reply(msgs[1]))
+	h.serveMulti(msgs[2:3])
+	h.serveTx()
+	assert.Equal(t, "-"+string(watchCrossNodeBytes), reply(msgs[2]))
+	h.serveMulti(msgs[3:4])
+	h.serveTx()
+	assert.Equal(t, "-CROSSSLOT", reply(msgs[3])[:10])
+	assert.Nil(t, f.pinned)
+
+	assert.Len(t, h.serveMulti(msgs[4:]), 0)
+	assert.Equal(t, "+OK", reply(msgs[4]))
+	assert.Equal(t, "-"+string(watchInMultiBytes), reply(msgs[5]))
+	assert.Equal(t, "-CROSSSLOT", reply(msgs[6])[:10])
+	assert.Equal(t, "+QUEUED", reply(msgs[7]))
+	h.serveTx()
+	assert.Equal(t, "-EXECABORT", reply(msgs[8])[:10])
+	assert.Nil(t, h.watch)
+	assert.Nil(t, f.pinned)
+
+	msgs = decodeTx(t, "UNWATCH\r\n", 1)
+	assert.Len(t, h.serveMulti(msgs), 0)
+	assert.Equal(t, "+OK", reply(msgs[0]))
+
+	// NOTE: the watched key changed and EXEC replies null
+	f.node = mockconn.CreateConn([]byte("+OK\r\n+OK\r\n+QUEUED\r\n*-1\r\n"), 1)
+	msgs = decodeTx(t, "WATCH a\r\nMULTI\r\nSET a 1\r\nEXEC\r\n", 4)
+	h.serveMulti(msgs[:1])
+	h.serveTx()
+	assert.Len(t, h.serveMulti(msgs[1:]), 0)
+	h.serveTx()
+	assert.Equal(t, "+QUEUED", reply(msgs[2]))
+	assert.Equal(t, "*", reply(msgs[3]))
+	assert.Len(t, msgs[3].Request().(*redis.Request).Reply().Array(), 0)
+	assert.Nil(t, h.watch)
+	assert.NoError(t, msgs[3].Err())
+	assert.Equal(t, "*1\r\n$5\r\nMULTI\r\n*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\n1\r\n*1\r\n$4\r\nEXEC\r\n",
+		f.node.(*mockconn.MockConn).Wbuf.String()[len("*2\r\n$5\r\nWATCH\r\n$1\r\na\r\n"):])
+}
@@ -0,0 +1,239 @@
+package proxy
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// envPrefix is the prefix of the environment variables overriding config.
+	envPrefix = "OVERLORD_"
+	// maxOverrideIndex limits the index of array to extend by overrides.
+	maxOverrideIndex = 1024
+)
+
+// override sets the value of key over the config files. The key is the path
+// of toml keys and indexes of array, split by "." of flag like
+// clusters.0.listen_addr, or "_" of environment variable like
+// OVERLORD_CLUSTERS_0_LISTEN_ADDR, which is matched greedily.
+type override struct {
+	key    string
+	tokens []string
+	value  string
+}
+
+// overrides are applied to the config each time it's loaded, so that they
+// are kept after reload.
+var overrides []*override
+
+// SetOverrides sets the overrides by the environment variables prefixed by
+// OVERLORD_ in env, and then by flags in the form of key=value, the later
+// has higher priority. The variables not matching any key are ignored, as
+// OVERLORD_ is also used by others, but the flags must match.
+func SetOverrides(env []string, flags []string) error {
+	var ovs []*override
+	for _, kv := range env {
+		idx := strings.IndexByte(kv, '=')
+		if idx < 0 || !strings.HasPrefix(kv, envPrefix) {
+			continue
+		}
+		key := kv[len(envPrefix):idx]
+		o := &override{key: kv[:idx], tokens: strings.Split(strings.ToLower(key), "_"), value: kv[idx+1:]}
+		if o.resolve() {
+			ovs = append(ovs, o)
+		}
+	}
+	sort.SliceStable(ovs, func(i, j int) bool { return ovs[i].key < ovs[j].key })
+	for _, kv := range flags {
+		idx := strings.IndexByte(kv, '=')
+		if idx <= 0 {
+			return errors.Wrapf(ErrConfInvalid, "override:%s must be key=value", kv)
+		}
+		o := &override{key: kv[:idx], tokens: strings.Split(strings.ToLower(kv[:idx]), "."), value: kv[idx+1:]}
+		if !o.resolve() {
+			return errors.Wrapf(ErrConfInvalid, "override:%s unknown key", o.key)
+		}
+		ovs = append(ovs, o)
+	}
+	overrides = ovs
+	return nil
+}
+
+// resolve reports whether the override matches a key of proxy config or
+// cluster config.
+func (o *override) resolve() bool {
+	for _, t := range []reflect.Type{reflect.TypeOf(Config{}), reflect.TypeOf(ClusterConfigs{})} {
+		if _, ok := resolvePath(t, o.tokens); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyOverrides applies the overrides to v, which is *Config or
+// *ClusterConfigs, the overrides of the other are skipped.
+func ApplyOverrides(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for _, o := range overrides {
+		path, ok := resolvePath(rv.Type(), o.tokens)
+		if !ok {
+			continue
+		}
+		if err := setPath(rv, path, o.value); err != nil {
+			return errors.Wrapf(ErrConfInvalid, "override:%s=%s %v", o.key, o.value, err)
+		}
+	}
+	return nil
+}
+
+// resolvePath resolves tokens into the path of the keys and the indexes from
+// type t to a field of value, the tokens of a key joined by "_" are matched
+// greedily.
+func resolvePath(t reflect.Type, tokens []string) ([]string, bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if len(tokens) == 0 {
+		return nil, isValue(t)
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		for n := len(tokens); n > 0; n-- {
+			key := strings.Join(tokens[:n], "_")
+			ft, ok := tomlField(t, key)
+			if !ok {
+				continue
+			}
+			if path, ok := resolvePath(ft, tokens[n:]); ok {
+				return append([]string{key}, path...), true
+			}
+		}
+	case reflect.Slice:
+		if idx, err := strconv.Atoi(tokens[0]); err == nil && idx >= 0 && idx < maxOverrideIndex && !isValue(t) {
+			if path, ok := resolvePath(t.Elem(), tokens[1:]); ok {
+				return append([]string{tokens[0]}, path...), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// isValue reports whether t is set by a value of override, the values of
+// slice are split by ",".
+func isValue(t reflect.Type) bool {
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// setPath sets the field of v at path to value, the nil pointers are
+// allocated and the slices are extended to the indexes.
+func setPath(v reflect.Value, path []string, value string) error {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if len(path) == 0 {
+		return setValue(v, value)
+	}
+	if v.Kind() == reflect.Slice {
+		idx, _ := strconv.Atoi(path[0])
+		for v.Len() <= idx {
+			v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+		}
+		return setPath(v.Index(idx), path[1:], value)
+	}
+	return setPath(tomlFieldValue(v, path[0]), path[1:], value)
+}
+
+// tomlFieldValue returns the field of struct v matched by key, the embedded
+// pointer is allocated if the field is in it.
+func tomlFieldValue(v reflect.Value, key string) reflect.Value {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() != reflect.Struct {
+				continue
+			}
+			if _, ok := tomlField(ft, key); ok {
+				fv := v.Field(i)
+				if fv.Kind() == reflect.Ptr {
+					if fv.IsNil() {
+						fv.Set(reflect.New(ft))
+					}
+					fv = fv.Elem()
+				}
+				return tomlFieldValue(fv, key)
+			}
+			continue
+		}
+		name := f.Tag.Get("toml")
+		if name == "" {
+			name = f.Name
+		}
+		if strings.EqualFold(name, key) {
+			return v.Field(i)
+		}
+	}
+	panic("toml field not found: " + key)
+}
+
+func setValue(v reflect.Value, value string) (err error) {
+	if v.Kind() == reflect.Slice {
+		var vals []string
+		if value != "" {
+			vals = strings.Split(value, ",")
+		}
+		s := reflect.MakeSlice(v.Type(), len(vals), len(vals))
+		for i, val := range vals {
+			if err = setValue(s.Index(i), strings.TrimSpace(val)); err != nil {
+				return
+			}
+		}
+		v.Set(s)
+		return
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(value); err == nil {
+			v.SetBool(b)
+		}
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		if f, err = strconv.ParseFloat(value, v.Type().Bits()); err == nil {
+			v.SetFloat(f)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		if i, err = strconv.ParseInt(value, 10, v.Type().Bits()); err == nil {
+			v.SetInt(i)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var u uint64
+		if u, err = strconv.ParseUint(value, 10, v.Type().Bits()); err == nil {
+			v.SetUint(u)
+		}
+	}
+	return
+}
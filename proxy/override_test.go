@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"overlord/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetOverrides(t *testing.T) {
+	defer func() { overrides = nil }()
+	err := SetOverrides([]string{
+		"PATH=/bin",
+		"OVERLORD_LISTEN_FDS=3,4",
+		"OVERLORD_CLUSTERS_0_LISTEN_ADDR=0.0.0.0:21311",
+		"OVERLORD_CLUSTERS_0_NODE_CONNECTIONS=8",
+		"OVERLORD_PROXY_READ_TIMEOUT=100",
+		"OVERLORD_DEBUG=true",
+	}, []string{
+		"clusters.0.node_connections=4",
+		"clusters.3.name=added",
+		"clusters.3.cache_type=redis",
+		"clusters.3.listen_addr=0.0.0.0:26380",
+		"clusters.3.servers=127.0.0.1:6379:1, 127.0.0.1:6380:1",
+		"clusters.3.access_log_sample_rate=0.5",
+		"proxy.latency_buckets=100,1000",
+		"stat=0.0.0.0:2110",
+	})
+	assert.NoError(t, err)
+	assert.Len(t, overrides, 12)
+
+	c := DefaultConfig()
+	assert.NoError(t, ApplyOverrides(c))
+	assert.Equal(t, "0.0.0.0:2110", c.Stat)
+	assert.True(t, c.Debug)
+	assert.Equal(t, 100, c.Proxy.ReadTimeout)
+	assert.Equal(t, []float64{100, 1000}, c.Proxy.LatencyBuckets)
+
+	f, err := ioutil.TempFile("", "overlord-override*.toml")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.Remove(f.Name())
+	_, _ = f.WriteString(exampleCluster)
+	f.Close()
+	ccs, err := LoadClusterConf(f.Name())
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, ccs, 4)
+	assert.Equal(t, "0.0.0.0:21311", ccs[0].ListenAddr)
+	assert.Equal(t, int32(4), ccs[0].NodeConnections)
+	assert.Equal(t, "added", ccs[3].Name)
+	assert.Equal(t, types.CacheTypeRedis, ccs[3].CacheType)
+	assert.Equal(t, []string{"127.0.0.1:6379:1", "127.0.0.1:6380:1"}, ccs[3].Servers)
+	assert.Equal(t, 0.5, ccs[3].AccessLogSampleRate)
+
+	// the clusters are set by overrides only without file.
+	ccs, err = LoadClusterConf("")
+	assert.Error(t, err, "clusters 0 to 2 have no servers")
+
+	assert.Error(t, SetOverrides(nil, []string{"clusters.0.listen"}))
+	assert.Error(t, SetOverrides(nil, []string{"clusters.0.listen=1"}))
+	assert.Error(t, SetOverrides(nil, []string{"clusters.x.name=a"}))
+	assert.Error(t, SetOverrides(nil, []string{"proxy=a"}))
+	assert.NoError(t, SetOverrides(nil, []string{"clusters.0.node_connections=many"}))
+	assert.Error(t, ApplyOverrides(&ClusterConfigs{}))
+}
@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"overlord/pkg/prom"
+	"overlord/proxy/proto"
+)
+
+// partial policies of multi-key commands when some sub requests failed.
+const (
+	// partialError fails the whole command by the error of any node.
+	partialError = "error"
+	// partialNil answers the keys of failed nodes as nils of MGET, and
+	// skips them from the counts of DEL and EXISTS.
+	partialNil = "nil"
+)
+
+// partial answers the failed sub requests of multi-key commands as empty by
+// partial policy nil, so that one bad node doesn't fail the whole MGET. The
+// sub request is also failed if its reply doesn't match the keys.
+func (h *Handler) partial(msgs []*proto.Message) {
+	if h.cc.Partial != partialNil {
+		return
+	}
+	for _, m := range msgs {
+		subs := []*proto.Message{m}
+		if m.IsBatch() {
+			subs = m.Batch()
+		}
+		for _, sub := range subs {
+			p, ok := sub.Request().(proto.Partialer)
+			if !ok || (sub.Err() == nil && !p.Broken()) || !p.Partial() {
+				continue
+			}
+			sub.WithError(nil)
+			if prom.On {
+				prom.PartialIncr(h.cc.Name, sub.Addr())
+			}
+		}
+	}
+}
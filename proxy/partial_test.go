@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"io"
+	"testing"
+
+	"overlord/pkg/types"
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/redis"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func _partialHandler(partial string) *Handler {
+	return &Handler{cc: &ClusterConfig{Name: "partial", CacheType: types.CacheTypeRedis, Partial: partial}}
+}
+
+func _subReply(sub *proto.Message) *redis.RESP {
+	return sub.Request().(*redis.Request).Reply()
+}
+
+func TestHandlerPartialMGet(t *testing.T) {
+	msgs := _decodeRedis(t, "*4\r\n$4\r\nMGET\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n")
+	subs := msgs[0].Batch()
+	// NOTE: a and c are on the failed node
+	assert.NoError(t, subs[0].Request().Merge([]proto.Request{subs[2].Request()}))
+	subs[0].WithError(io.EOF)
+	_subReply(subs[1]).SetBulk([]byte("vb"))
+
+	_partialHandler(partialError).partial(msgs)
+	assert.Equal(t, io.EOF, msgs[0].Err())
+
+	_partialHandler(partialNil).partial(msgs)
+	assert.NoError(t, msgs[0].Err())
+	assert.Equal(t, "*3\r\n$-1\r\n$2\r\nvb\r\n$-1\r\n", _encodeRedis(t, msgs[0]))
+}
+
+func TestHandlerPartialBroken(t *testing.T) {
+	msgs := _decodeRedis(t, "*3\r\n$4\r\nMGET\r\n$1\r\na\r\n$1\r\nb\r\n")
+	subs := msgs[0].Batch()
+	_subReply(subs[0]).SetError([]byte("ERR node down"))
+	_subReply(subs[1]).SetBulk([]byte("vb"))
+	_partialHandler(partialNil).partial(msgs)
+	assert.Equal(t, "*2\r\n$-1\r\n$2\r\nvb\r\n", _encodeRedis(t, msgs[0]))
+}
+
+func TestHandlerPartialCount(t *testing.T) {
+	msgs := _decodeRedis(t, "*3\r\n$3\r\nDEL\r\n$1\r\na\r\n$1\r\nb\r\n")
+	subs := msgs[0].Batch()
+	subs[0].WithError(io.EOF)
+	_subReply(subs[1]).SetInt(1)
+	_partialHandler(partialNil).partial(msgs)
+	assert.NoError(t, msgs[0].Err())
+	assert.Equal(t, ":1\r\n", _encodeRedis(t, msgs[0]))
+
+	// NOTE: the writes of MSET are never answered partially
+	msgs = _decodeRedis(t, "*5\r\n$4\r\nMSET\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nb\r\n$1\r\n2\r\n")
+	subs = msgs[0].Batch()
+	subs[0].WithError(io.EOF)
+	_partialHandler(partialNil).partial(msgs)
+	assert.Equal(t, io.EOF, msgs[0].Err())
+}
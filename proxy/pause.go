@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	errs "errors"
+	"sync/atomic"
+
+	"overlord/proxy/proto"
+
+	"github.com/pkg/errors"
+)
+
+// errors
+var (
+	ErrWritesPaused = errs.New("ERR writes are paused")
+)
+
+// PauseWrites pauses or resumes the writes of cluster name, the paused
+// writes are rejected until resumed and the reads are not affected. It is
+// kept across reloads.
+func (p *Proxy) PauseWrites(name string, paused bool) error {
+	p.lock.Lock()
+	cc := p.clusterConfig(name)
+	p.lock.Unlock()
+	if cc == nil {
+		return errors.Wrapf(ErrAdminClusterNotFound, "cluster:%s", name)
+	}
+	var v int32
+	if paused {
+		v = 1
+	}
+	atomic.StoreInt32(&p.clusterStat(name).paused, v)
+	return nil
+}
+
+// WritesPaused reports whether the writes of cluster name are paused.
+func (p *Proxy) WritesPaused(name string) (bool, error) {
+	p.lock.Lock()
+	cc := p.clusterConfig(name)
+	p.lock.Unlock()
+	if cc == nil {
+		return false, errors.Wrapf(ErrAdminClusterNotFound, "cluster:%s", name)
+	}
+	return atomic.LoadInt32(&p.clusterStat(name).paused) == 1, nil
+}
+
+func (h *Handler) writesPaused() bool {
+	return h.cstat != nil && atomic.LoadInt32(&h.cstat.paused) == 1
+}
+
+// isWrite reports whether any request of msg writes.
+func isWrite(msg *proto.Message) bool {
+	for _, req := range msg.Requests() {
+		if c, ok := req.(proto.Classifier); ok && c.IsWrite() {
+			return true
+		}
+	}
+	return false
+}
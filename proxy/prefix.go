@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"bytes"
+	"regexp"
+	"sync"
+	"time"
+
+	"overlord/pkg/prom"
+	"overlord/proxy/proto"
+)
+
+// prefixOther is the prefix of keys without prefix or more than max.
+const prefixOther = "other"
+
+// prefixMetrics maps keys to prefix by delimiters or the first submatch of
+// regex, the prefixes more than max are counted as other.
+type prefixMetrics struct {
+	delims []byte
+	re     *regexp.Regexp
+	max    int
+
+	lock  sync.RWMutex
+	known map[string]string
+}
+
+func newPrefixMetrics(cc *ClusterConfig) *prefixMetrics {
+	if cc.MetricsPrefixDelims == "" && cc.MetricsPrefixRegex == "" {
+		return nil
+	}
+	pm := &prefixMetrics{
+		delims: []byte(cc.MetricsPrefixDelims),
+		max:    cc.MetricsPrefixMax,
+		known:  make(map[string]string, cc.MetricsPrefixMax),
+	}
+	if cc.MetricsPrefixRegex != "" {
+		// NOTE: validated by cluster config
+		pm.re = regexp.MustCompile(cc.MetricsPrefixRegex)
+	}
+	return pm
+}
+
+// prefix returns the prefix label of key.
+func (pm *prefixMetrics) prefix(key []byte) string {
+	var p []byte
+	if pm.re != nil {
+		if m := pm.re.FindSubmatch(key); len(m) > 1 {
+			p = m[1]
+		} else if len(m) == 1 {
+			p = m[0]
+		}
+	} else if idx := bytes.IndexAny(key, string(pm.delims)); idx > 0 {
+		p = key[:idx]
+	}
+	if len(p) == 0 {
+		return prefixOther
+	}
+	pm.lock.RLock()
+	label, ok := pm.known[string(p)]
+	full := len(pm.known) >= pm.max
+	pm.lock.RUnlock()
+	if ok {
+		return label
+	}
+	if full {
+		return prefixOther
+	}
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+	if label, ok = pm.known[string(p)]; ok {
+		return label
+	}
+	if len(pm.known) >= pm.max {
+		return prefixOther
+	}
+	label = string(p)
+	pm.known[label] = label
+	return label
+}
+
+// prefixStat records the request, latency and hits of msg by the prefix of
+// its first key.
+func (h *Handler) prefixStat(msg *proto.Message) {
+	req := msg.Request()
+	if req == nil || len(req.Key()) == 0 {
+		return
+	}
+	hits, misses := messageHits(msg)
+	prom.PrefixStat(h.cc.Name, h.prefix.prefix(req.Key()), int64(msg.TotalDur()/time.Microsecond), hits, misses)
+}
@@ -0,0 +1,29 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixMetricsDelims(t *testing.T) {
+	assert.Nil(t, newPrefixMetrics(&ClusterConfig{}))
+
+	pm := newPrefixMetrics(&ClusterConfig{MetricsPrefixDelims: ":|", MetricsPrefixMax: 2})
+	assert.Equal(t, "user", pm.prefix([]byte("user:1")))
+	assert.Equal(t, "feed", pm.prefix([]byte("feed|1")))
+	assert.Equal(t, prefixOther, pm.prefix([]byte("noprefix")))
+	assert.Equal(t, prefixOther, pm.prefix([]byte(":leading")))
+	// NOTE: more than max
+	assert.Equal(t, prefixOther, pm.prefix([]byte("item:1")))
+	assert.Equal(t, "user", pm.prefix([]byte("user:2")))
+}
+
+func TestPrefixMetricsRegex(t *testing.T) {
+	pm := newPrefixMetrics(&ClusterConfig{MetricsPrefixRegex: `^([a-z]+)_\d+`, MetricsPrefixMax: 64})
+	assert.Equal(t, "user", pm.prefix([]byte("user_1")))
+	assert.Equal(t, prefixOther, pm.prefix([]byte("USER_1")))
+
+	pm = newPrefixMetrics(&ClusterConfig{MetricsPrefixRegex: `^[a-z]+`, MetricsPrefixMax: 64})
+	assert.Equal(t, "feed", pm.prefix([]byte("feed123")))
+}
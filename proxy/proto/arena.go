@@ -0,0 +1,46 @@
+package proto
+
+const (
+	// arenaSlab is the number of messages allocated by arena at once.
+	arenaSlab = 64
+)
+
+// Arena allocates the messages of one front connection. The messages are
+// allocated in slabs and kept with their requests and subs, so they are
+// reused by every pipeline of the connection instead of churning through
+// the global pools, and released wholesale when the connection is closed.
+// Arena is not safe for concurrent use.
+type Arena struct {
+	msgs []*Message
+	slab []Message
+}
+
+// NewArena new an Arena.
+func NewArena() *Arena {
+	return &Arena{}
+}
+
+func (a *Arena) alloc() *Message {
+	if len(a.slab) == 0 {
+		a.slab = make([]Message, arenaSlab)
+	}
+	m := &a.slab[0]
+	a.slab = a.slab[1:]
+	m.arena = a
+	return m
+}
+
+// Msgs returns n messages, the messages returned before are reused.
+func (a *Arena) Msgs(n int) []*Message {
+	for len(a.msgs) < n {
+		a.msgs = append(a.msgs, a.alloc())
+	}
+	return a.msgs[:n]
+}
+
+// Release releases all the messages and their requests, the messages must
+// not be used after released.
+func (a *Arena) Release() {
+	PutMsgs(a.msgs)
+	a.msgs, a.slab = nil, nil
+}
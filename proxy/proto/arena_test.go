@@ -0,0 +1,75 @@
+package proto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArena(t *testing.T) {
+	a := NewArena()
+	msgs := a.Msgs(2)
+	assert.Len(t, msgs, 2)
+	m := msgs[0]
+	m.WithRequest(&mockRequest{})
+	m.WithRequest(&mockRequest{})
+	subs := m.Batch()
+	assert.Len(t, subs, 2)
+	assert.True(t, subs[0].arena == a)
+
+	m.ResetSubs()
+	m.Reset()
+	msgs = a.Msgs(arenaSlab + 1)
+	assert.Len(t, msgs, arenaSlab+1)
+	assert.True(t, m == msgs[0])
+	assert.Len(t, m.req, 2)
+	assert.Len(t, m.subs, 2)
+
+	a.Release()
+	assert.Nil(t, a.msgs)
+	assert.Nil(t, m.req)
+	assert.Nil(t, m.subs)
+	assert.True(t, m.arena == a)
+}
+
+// pipelines is the depths of pipelines sent by one connection of benchmark.
+var pipelines = []int{2, 4, 8, 16, 32, 64}
+
+func pipeline(msgs []*Message) {
+	for _, m := range msgs {
+		for i := 0; i < 3; i++ {
+			if m.NextReq() == nil {
+				m.WithRequest(&mockRequest{})
+			}
+		}
+		m.Batch()
+	}
+	for _, m := range msgs {
+		m.ResetSubs()
+		m.Reset()
+	}
+}
+
+func BenchmarkConnPool(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var msgs []*Message
+		for _, n := range pipelines {
+			PutMsgs(msgs)
+			msgs = GetMsgs(n)
+			pipeline(msgs)
+		}
+		PutMsgs(msgs)
+	}
+}
+
+func BenchmarkConnArena(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		a := NewArena()
+		for _, n := range pipelines {
+			pipeline(a.Msgs(n))
+		}
+		a.Release()
+	}
+}
@@ -0,0 +1,116 @@
+package proto
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"overlord/pkg/prom"
+)
+
+// breaker states.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// ErrBreakerOpen is the error of the messages failed fast by the open
+// breaker of node.
+var ErrBreakerOpen = errors.New("node circuit breaker is open")
+
+// Breaker is the circuit breaker of a node. It opens after the consecutive
+// failures, which are the network errors and the responses slower than
+// slow, and fails the messages immediately while open. After timeout one
+// message is let through to probe the node, the breaker is closed if the
+// probe succeeds, or opens again.
+type Breaker struct {
+	cluster, addr string
+	failures      int
+	slow          time.Duration
+	timeout       time.Duration
+
+	lock    sync.Mutex
+	state   string
+	fails   int
+	openAt  time.Time
+	probing bool
+}
+
+// NewBreaker new the breaker of node addr, which opens after failures
+// consecutive failures. Zero slow means no response is too slow.
+func NewBreaker(cluster, addr string, failures int, slow, timeout time.Duration) *Breaker {
+	return &Breaker{
+		cluster:  cluster,
+		addr:     addr,
+		failures: failures,
+		slow:     slow,
+		timeout:  timeout,
+		state:    BreakerClosed,
+	}
+}
+
+// Allow reports whether the message could be sent to node, only one probe
+// is allowed at a time after open for timeout.
+func (b *Breaker) Allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	switch b.state {
+	case BreakerClosed:
+		return true
+	case BreakerOpen:
+		if time.Since(b.openAt) < b.timeout {
+			return false
+		}
+		b.setState(BreakerHalfOpen)
+	}
+	if b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// Record records the result of the message sent to node in d.
+func (b *Breaker) Record(err error, d time.Duration) {
+	failed := err != nil || (b.slow > 0 && d > b.slow)
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	switch b.state {
+	case BreakerClosed:
+		if !failed {
+			b.fails = 0
+			return
+		}
+		if b.fails++; b.fails >= b.failures {
+			b.open()
+		}
+	case BreakerHalfOpen:
+		b.probing = false
+		if failed {
+			b.open()
+			return
+		}
+		b.fails = 0
+		b.setState(BreakerClosed)
+	}
+}
+
+// State returns the state of breaker.
+func (b *Breaker) State() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.state
+}
+
+func (b *Breaker) open() {
+	b.openAt = time.Now()
+	b.setState(BreakerOpen)
+}
+
+func (b *Breaker) setState(state string) {
+	b.state = state
+	if prom.On {
+		prom.BreakerState(b.cluster, b.addr, state)
+	}
+}
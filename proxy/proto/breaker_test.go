@@ -0,0 +1,60 @@
+package proto
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreaker(t *testing.T) {
+	b := NewBreaker("c", "n", 2, 10*time.Millisecond, 20*time.Millisecond)
+	err := errors.New("some error")
+	assert.True(t, b.Allow())
+	b.Record(err, 0)
+	// NOTE: the success resets the consecutive failures
+	b.Record(nil, time.Millisecond)
+	b.Record(err, 0)
+	assert.Equal(t, BreakerClosed, b.State())
+	// NOTE: the slow response is failed
+	b.Record(nil, 20*time.Millisecond)
+	assert.Equal(t, BreakerOpen, b.State())
+	assert.False(t, b.Allow())
+
+	time.Sleep(30 * time.Millisecond)
+	assert.True(t, b.Allow())
+	assert.Equal(t, BreakerHalfOpen, b.State())
+	// NOTE: one probe at a time
+	assert.False(t, b.Allow())
+	b.Record(err, 0)
+	assert.Equal(t, BreakerOpen, b.State())
+	assert.False(t, b.Allow())
+
+	time.Sleep(30 * time.Millisecond)
+	assert.True(t, b.Allow())
+	b.Record(nil, time.Millisecond)
+	assert.Equal(t, BreakerClosed, b.State())
+	assert.True(t, b.Allow())
+}
+
+func TestPipeBreaker(t *testing.T) {
+	nc := &mockNodeConn{err: errors.New("some error")}
+	ncp := NewNodeConnPipe(1, 32, func() NodeConn {
+		return nc
+	})
+	defer ncp.Close()
+	ncp.SetBreaker(NewBreaker("c", "n", 2, 0, time.Minute))
+	assert.Equal(t, BreakerClosed, ncp.BreakerState())
+	for i := 0; i < 2; i++ {
+		m, wg := pushKey(ncp, "a")
+		assert.True(t, waitTimeout(wg, time.Second))
+		assert.EqualError(t, m.Err(), "some error")
+	}
+	assert.Equal(t, BreakerOpen, ncp.BreakerState())
+	m, wg := pushKey(ncp, "a")
+	assert.True(t, waitTimeout(wg, time.Second))
+	assert.Equal(t, ErrBreakerOpen, m.Err())
+	conns, busy, queued := ncp.Stats()
+	assert.Equal(t, [3]int32{1, 0, 0}, [3]int32{conns, busy, queued})
+}
@@ -0,0 +1,80 @@
+package proto
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	"overlord/pkg/prom"
+)
+
+// fault errors
+var (
+	ErrFaultReset   = errors.New("fault injected connection reset")
+	ErrFaultCorrupt = errors.New("fault injected corrupted reply")
+)
+
+// Faults are the probabilities of the faults injected into the node
+// connections, which are only used to test the clients.
+type Faults struct {
+	// Latency is delayed before reading the reply by LatencyRate.
+	Latency     time.Duration
+	LatencyRate float64
+	// ResetRate is the probability of closing the connection while writing.
+	ResetRate float64
+	// CorruptRate is the probability of the reply read being corrupted,
+	// which fails the message and closes the connection as the real one.
+	CorruptRate float64
+}
+
+type faultNodeConn struct {
+	NodeConn
+	faults *Faults
+}
+
+// NewFaultNodeConn wraps nc to inject faults, the message failed by fault
+// breaks the connection which is renewed by pipe.
+func NewFaultNodeConn(nc NodeConn, faults *Faults) NodeConn {
+	return &faultNodeConn{NodeConn: nc, faults: faults}
+}
+
+func (f *faultNodeConn) Write(m *Message) error {
+	if hit(f.faults.ResetRate) {
+		f.count(m, "fault reset")
+		_ = f.NodeConn.Close()
+		return ErrFaultReset
+	}
+	return f.NodeConn.Write(m)
+}
+
+func (f *faultNodeConn) Read(m *Message) error {
+	if hit(f.faults.LatencyRate) {
+		f.count(m, "fault latency")
+		time.Sleep(f.faults.Latency)
+	}
+	if err := f.NodeConn.Read(m); err != nil {
+		return err
+	}
+	if hit(f.faults.CorruptRate) {
+		f.count(m, "fault corrupt")
+		return ErrFaultCorrupt
+	}
+	return nil
+}
+
+// SetReadTimeout impl ReadTimeouter if the conn wrapped is.
+func (f *faultNodeConn) SetReadTimeout(timeout time.Duration) {
+	if rt, ok := f.NodeConn.(ReadTimeouter); ok {
+		rt.SetReadTimeout(timeout)
+	}
+}
+
+func (f *faultNodeConn) count(m *Message, fault string) {
+	if prom.On {
+		prom.ErrIncr(f.Cluster(), f.Addr(), m.Request().CmdString(), fault)
+	}
+}
+
+func hit(rate float64) bool {
+	return rate > 0 && rand.Float64() < rate
+}
@@ -0,0 +1,50 @@
+package proto
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFaultNodeConn(t *testing.T) {
+	nc := &mockNodeConn{num: 100}
+	fc := NewFaultNodeConn(nc, &Faults{})
+	m := getMsg()
+	m.WithRequest(&keyRequest{key: "a"})
+	assert.NoError(t, fc.Write(m))
+	assert.NoError(t, fc.Read(m))
+	assert.Equal(t, "mock", fc.Addr())
+
+	fc = NewFaultNodeConn(nc, &Faults{ResetRate: 1})
+	assert.Equal(t, ErrFaultReset, fc.Write(m))
+	assert.True(t, nc.closed)
+
+	nc = &mockNodeConn{num: 100}
+	fc = NewFaultNodeConn(nc, &Faults{CorruptRate: 1})
+	assert.NoError(t, fc.Write(m))
+	assert.Equal(t, ErrFaultCorrupt, fc.Read(m))
+	assert.Equal(t, 1, nc.count, "the reply is read before corrupted")
+
+	fc = NewFaultNodeConn(nc, &Faults{Latency: 20 * time.Millisecond, LatencyRate: 1})
+	start := time.Now()
+	assert.NoError(t, fc.Read(m))
+	assert.True(t, time.Since(start) >= 20*time.Millisecond)
+}
+
+func TestPipeFault(t *testing.T) {
+	var conns int32
+	ncp := NewNodeConnPipe(1, 32, func() NodeConn {
+		atomic.AddInt32(&conns, 1)
+		return NewFaultNodeConn(&mockNodeConn{num: 100}, &Faults{ResetRate: 1})
+	})
+	defer ncp.Close()
+	m, wg := pushKey(ncp, "a")
+	assert.True(t, waitTimeout(wg, time.Second))
+	assert.Equal(t, ErrFaultReset, m.Err())
+	m, wg = pushKey(ncp, "a")
+	assert.True(t, waitTimeout(wg, time.Second))
+	assert.Equal(t, ErrFaultReset, m.Err())
+	assert.True(t, atomic.LoadInt32(&conns) >= 2, "the conn reset is renewed")
+}
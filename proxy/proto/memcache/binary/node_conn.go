@@ -28,11 +28,17 @@ type nodeConn struct {
 	bw   *bufio.Writer
 	br   *bufio.Reader
 
+	// quiet sends GETQ/GETKQ as they are and terminates them by NOOP,
+	// the misses are answered by nothing and must be filled by node conn.
+	quiet bool
+	qs    quietState
+
 	state int32
 }
 
-// NewNodeConn returns node conn.
-func NewNodeConn(cluster, addr string, dialTimeout, readTimeout, writeTimeout time.Duration) (nc proto.NodeConn) {
+// NewNodeConn returns node conn, the quiet gets are batched to backend
+// when quiet is true.
+func NewNodeConn(cluster, addr string, dialTimeout, readTimeout, writeTimeout time.Duration, quiet bool) (nc proto.NodeConn) {
 	conn := libnet.DialWithTimeout(addr, dialTimeout, readTimeout, writeTimeout)
 	nc = &nodeConn{
 		cluster: cluster,
@@ -40,6 +46,7 @@ func NewNodeConn(cluster, addr string, dialTimeout, readTimeout, writeTimeout ti
 		conn:    conn,
 		bw:      bufio.NewWriter(conn),
 		br:      bufio.NewReader(conn, bufio.Get(nodeReadBufSize)),
+		quiet:   quiet,
 	}
 	return
 }
@@ -69,7 +76,11 @@ func (n *nodeConn) Write(m *proto.Message) (err error) {
 	_ = n.bw.Write(magicReqBytes)
 
 	cmd := mcr.respType
-	if noq, ok := qReplaceNoQTypes[cmd]; ok {
+	opaque := mcr.opaque
+	if n.quiet {
+		opaque = n.qs.push(mcr)
+	}
+	if noq, ok := qReplaceNoQTypes[cmd]; ok && !(n.quiet && isQuietGet(cmd)) {
 		cmd = noq
 	}
 	_ = n.bw.Write(cmd.Bytes())
@@ -78,7 +89,7 @@ func (n *nodeConn) Write(m *proto.Message) (err error) {
 	_ = n.bw.Write(zeroBytes)
 	_ = n.bw.Write(zeroTwoBytes)
 	_ = n.bw.Write(mcr.bodyLen)
-	_ = n.bw.Write(mcr.opaque)
+	_ = n.bw.Write(opaque)
 	err = n.bw.Write(mcr.cas)
 	if !bytes.Equal(mcr.bodyLen, zeroFourBytes) {
 		err = n.bw.Write(mcr.data)
@@ -90,6 +101,18 @@ func (n *nodeConn) Flush() error {
 	if n.Closed() {
 		return errors.WithStack(ErrClosed)
 	}
+	if n.quiet && n.qs.needNoop() {
+		// NOTE: NOOP makes the misses of quiet gets before it be known
+		_ = n.bw.Write(magicReqBytes)
+		_ = n.bw.Write(noopBytes)
+		_ = n.bw.Write(zeroTwoBytes)
+		_ = n.bw.Write(zeroBytes)
+		_ = n.bw.Write(zeroBytes)
+		_ = n.bw.Write(zeroTwoBytes)
+		_ = n.bw.Write(zeroFourBytes)
+		_ = n.bw.Write(n.qs.noop())
+		_ = n.bw.Write(zeroEightBytes)
+	}
 	return n.bw.Flush()
 }
 
@@ -112,6 +135,10 @@ func (n *nodeConn) Read(m *proto.Message) (err error) {
 		}
 		return
 	}
+	if n.quiet {
+		err = n.readQuiet(mcr)
+		return
+	}
 
 REREAD:
 	var bs []byte
@@ -146,6 +173,11 @@ REREADData:
 	return
 }
 
+// SetReadTimeout impl proto.ReadTimeouter.
+func (n *nodeConn) SetReadTimeout(timeout time.Duration) {
+	n.conn.SetReadTimeout(timeout)
+}
+
 func (n *nodeConn) Close() error {
 	if atomic.CompareAndSwapInt32(&n.state, opened, closed) {
 		return n.conn.Close()
@@ -291,6 +291,6 @@ func TestNewNodeConnWithClosedBinder(t *testing.T) {
 		sock, _ := listener.Accept()
 		defer sock.Close()
 	}()
-	nc := NewNodeConn("anyName", addr.String(), time.Second, time.Second, time.Second)
+	nc := NewNodeConn("anyName", addr.String(), time.Second, time.Second, time.Second, false)
 	assert.NotNil(t, nc)
 }
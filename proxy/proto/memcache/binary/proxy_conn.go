@@ -22,6 +22,9 @@ type proxyConn struct {
 	br        *bufio.Reader
 	bw        *bufio.Writer
 	completed bool
+
+	maxKeyLen    int
+	maxValueSize int
 }
 
 // NewProxyConn new a memcache decoder and encode.
@@ -35,6 +38,11 @@ func NewProxyConn(rw *libnet.Conn) proto.ProxyConn {
 	return p
 }
 
+// LimitSize impl proto.SizeLimiter.
+func (p *proxyConn) LimitSize(maxKeyLen, maxValueSize int) {
+	p.maxKeyLen, p.maxValueSize = maxKeyLen, maxValueSize
+}
+
 func (p *proxyConn) Decode(msgs []*proto.Message) ([]*proto.Message, error) {
 	var err error
 	// if completed, means that we have parsed all the buffered
@@ -84,6 +92,7 @@ NEXTGET:
 	case RequestTypeNoop, RequestTypeVersion, RequestTypeQuit, RequestTypeQuitQ:
 		req.key = req.key[:0]
 		req.data = req.data[:0]
+		req.size = requestHeaderLen
 		return
 	case RequestTypeSet, RequestTypeAdd, RequestTypeReplace, RequestTypeGet, RequestTypeGetK,
 		RequestTypeDelete, RequestTypeIncr, RequestTypeDecr, RequestTypeAppend, RequestTypePrepend,
@@ -110,6 +119,14 @@ NEXTGET:
 
 func (p *proxyConn) decodeCommon(m *proto.Message, req *MCRequest) (err error) {
 	bl := binary.BigEndian.Uint32(req.bodyLen)
+	el := uint8(req.extraLen[0])
+	kl := binary.BigEndian.Uint16(req.keyLen)
+	if p.maxKeyLen > 0 && int(kl) > p.maxKeyLen {
+		return p.reject(m, req, int(bl), ErrKeyTooLong)
+	}
+	if p.maxValueSize > 0 && int(bl)-int(el)-int(kl) > p.maxValueSize {
+		return p.reject(m, req, int(bl), ErrValueTooLarge)
+	}
 	body, err := p.br.ReadExact(int(bl))
 	if err == bufio.ErrBufferFull {
 		return
@@ -117,16 +134,31 @@ func (p *proxyConn) decodeCommon(m *proto.Message, req *MCRequest) (err error) {
 		err = errors.WithStack(err)
 		return
 	}
-	el := uint8(req.extraLen[0])
-	kl := binary.BigEndian.Uint16(req.keyLen)
 	// copy
 	req.key = req.key[:0]
 	req.key = append(req.key, body[int(el):int(el)+int(kl)]...)
 	req.data = req.data[:0]
 	req.data = append(req.data, body...)
+	req.size = requestHeaderLen + len(body)
 	return
 }
 
+// reject swallows the body of request exceeds the size limits, the reply
+// carries the status of err without body.
+func (p *proxyConn) reject(m *proto.Message, req *MCRequest, bl int, err error) error {
+	if de := p.br.Discard(bl); de != nil {
+		return errors.WithStack(de)
+	}
+	copy(req.keyLen, zeroTwoBytes)
+	copy(req.extraLen, zeroBytes)
+	copy(req.bodyLen, zeroFourBytes)
+	req.key = req.key[:0]
+	req.data = req.data[:0]
+	req.size = requestHeaderLen + bl
+	m.WithError(err)
+	return nil
+}
+
 func (p *proxyConn) request(m *proto.Message) *MCRequest {
 	req := m.NextReq()
 	if req == nil {
@@ -166,7 +198,7 @@ func (p *proxyConn) Encode(m *proto.Message) (err error) {
 		_ = p.bw.Write(mcr.extraLen)
 		_ = p.bw.Write(zeroBytes)
 		if me := m.Err(); me != nil {
-			_ = p.bw.Write(resopnseStatusInternalErrBytes)
+			_ = p.bw.Write(errStatusBytes(me))
 		} else {
 			_ = p.bw.Write(mcr.status)
 		}
@@ -181,6 +213,21 @@ func (p *proxyConn) Encode(m *proto.Message) (err error) {
 	return
 }
 
+func errStatusBytes(err error) []byte {
+	switch errors.Cause(err) {
+	case ErrKeyTooLong:
+		return responseStatusInvalidArgBytes
+	case ErrValueTooLarge:
+		return responseStatusValueTooLargeBytes
+	}
+	return resopnseStatusInternalErrBytes
+}
+
 func (p *proxyConn) Flush() (err error) {
 	return p.bw.Flush()
 }
+
+// BufferSizes impl proto.BufferSizer.
+func (pc *proxyConn) BufferSizes() (rbuf, wbuf int) {
+	return pc.br.Size(), pc.bw.Buffered()
+}
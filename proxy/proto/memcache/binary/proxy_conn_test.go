@@ -376,3 +376,50 @@ func TestProxyConnEncodeErr(t *testing.T) {
 	c.Wbuf.Read(buf)
 	assert.Equal(t, resopnseStatusInternalErrBytes, buf[6:8])
 }
+
+func TestProxyConnDecodeLimitSize(t *testing.T) {
+	set := append([]byte{}, setTestData...)
+	set[11] = 0x10 // NOTE: body len of flags, expiration, key and value
+	data := append(set, getTestData...)
+	ts := []struct {
+		Name         string
+		MaxKeyLen    int
+		MaxValueSize int
+		Errs         []error
+	}{
+		{"NoLimit", 0, 0, []error{nil, nil}},
+		{"ValueTooLarge", 0, 2, []error{ErrValueTooLarge, nil}},
+		{"KeyTooLong", 2, 0, []error{ErrKeyTooLong, ErrKeyTooLong}},
+	}
+	for _, tt := range ts {
+		t.Run(tt.Name, func(t *testing.T) {
+			conn := libcon.NewConn(mockconn.CreateConn(data, 1), time.Second, time.Second)
+			p := NewProxyConn(conn)
+			p.(proto.SizeLimiter).LimitSize(tt.MaxKeyLen, tt.MaxValueSize)
+			msgs, err := p.Decode(proto.GetMsgs(2))
+			assert.NoError(t, err)
+			assert.Len(t, msgs, 2)
+			for i, msg := range msgs {
+				assert.Equal(t, tt.Errs[i], msg.Err())
+			}
+		})
+	}
+}
+
+func TestProxyConnEncodeLimitSize(t *testing.T) {
+	set := append([]byte{}, setTestData...)
+	set[11] = 0x10
+	conn := libcon.NewConn(mockconn.CreateConn(set, 1), time.Second, time.Second)
+	p := NewProxyConn(conn)
+	p.(proto.SizeLimiter).LimitSize(0, 2)
+	msgs, err := p.Decode(proto.GetMsgs(1))
+	assert.NoError(t, err)
+	assert.NoError(t, p.Encode(msgs[0]))
+	assert.NoError(t, p.Flush())
+	c := conn.Conn.(*mockconn.MockConn)
+	buf := make([]byte, 1024)
+	size, _ := c.Wbuf.Read(buf)
+	assert.Equal(t, requestHeaderLen, size)
+	assert.Equal(t, responseStatusValueTooLargeBytes, buf[6:8])
+	assert.Equal(t, zeroFourBytes, buf[8:12])
+}
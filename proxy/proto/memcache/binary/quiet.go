@@ -0,0 +1,142 @@
+package binary
+
+import (
+	"encoding/binary"
+
+	"overlord/pkg/bufio"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	keyNotFoundBytes = []byte{0x00, ResponseStatusKeyNotFound}
+)
+
+// quietReq is the request written into node and waiting for reply.
+type quietReq struct {
+	seq    uint32
+	opaque [4]byte
+	quiet  bool
+}
+
+// quietState tracks the requests of quiet gets batching. All the requests
+// are sent with sequence as opaque, so the replies can be matched and the
+// missing replies of quiet gets are known as misses.
+type quietState struct {
+	seq     uint32
+	reqs    []quietReq
+	noopSeq uint32
+	nooping bool
+	queued  bool
+
+	// peeked reply which is not consumed.
+	peeked bool
+	head   [requestHeaderLen]byte
+	body   []byte
+}
+
+func isQuietGet(rt RequestType) bool {
+	return rt == RequestTypeGetQ || rt == RequestTypeGetKQ
+}
+
+// push records mcr and returns the opaque sent to node.
+func (qs *quietState) push(mcr *MCRequest) []byte {
+	qs.seq++
+	qr := quietReq{seq: qs.seq, quiet: isQuietGet(mcr.respType)}
+	copy(qr.opaque[:], mcr.opaque)
+	qs.reqs = append(qs.reqs, qr)
+	if qr.quiet {
+		qs.queued = true
+	}
+	opaque := make([]byte, 4)
+	binary.BigEndian.PutUint32(opaque, qs.seq)
+	return opaque
+}
+
+func (qs *quietState) needNoop() bool {
+	return qs.queued && !qs.nooping
+}
+
+// noop returns the opaque of NOOP terminates quiet gets.
+func (qs *quietState) noop() []byte {
+	qs.seq++
+	qs.noopSeq, qs.nooping, qs.queued = qs.seq, true, false
+	opaque := make([]byte, 4)
+	binary.BigEndian.PutUint32(opaque, qs.seq)
+	return opaque
+}
+
+// readQuiet reads the reply of mcr, the quiet get is filled as miss if the
+// next reply is not for it.
+func (n *nodeConn) readQuiet(mcr *MCRequest) (err error) {
+	if len(n.qs.reqs) == 0 {
+		return errors.WithStack(ErrBadResponse)
+	}
+	qr := n.qs.reqs[0]
+	n.qs.reqs = n.qs.reqs[1:]
+	if err = n.peek(); err != nil {
+		return
+	}
+	if binary.BigEndian.Uint32(n.qs.head[12:16]) == qr.seq {
+		parseHeader(n.qs.head[:], mcr, false)
+		mcr.data = append(mcr.data, n.qs.body...)
+		n.qs.peeked = false
+	} else if qr.quiet {
+		copy(mcr.keyLen, zeroTwoBytes)
+		copy(mcr.extraLen, zeroBytes)
+		copy(mcr.status, keyNotFoundBytes)
+		copy(mcr.bodyLen, zeroFourBytes)
+		copy(mcr.cas, zeroEightBytes)
+	} else {
+		return errors.WithStack(ErrBadResponse)
+	}
+	copy(mcr.opaque, qr.opaque[:])
+	if len(n.qs.reqs) == 0 && n.qs.nooping {
+		// NOTE: all the requests are replied, consume the NOOP
+		if err = n.peek(); err != nil {
+			return
+		}
+		if binary.BigEndian.Uint32(n.qs.head[12:16]) != n.qs.noopSeq {
+			return errors.WithStack(ErrBadResponse)
+		}
+		n.qs.peeked, n.qs.nooping = false, false
+	}
+	return
+}
+
+// peek reads the next reply if no reply is peeked.
+func (n *nodeConn) peek() (err error) {
+	if n.qs.peeked {
+		return
+	}
+	var bs []byte
+	for {
+		if bs, err = n.br.ReadExact(requestHeaderLen); err != bufio.ErrBufferFull {
+			break
+		}
+		if err = n.br.Read(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	copy(n.qs.head[:], bs)
+	n.qs.body = n.qs.body[:0]
+	if bl := int(binary.BigEndian.Uint32(n.qs.head[8:12])); bl > 0 {
+		for {
+			if bs, err = n.br.ReadExact(bl); err != bufio.ErrBufferFull {
+				break
+			}
+			if err = n.br.Read(); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		n.qs.body = append(n.qs.body, bs...)
+	}
+	n.qs.peeked = true
+	return
+}
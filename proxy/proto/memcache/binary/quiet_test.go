@@ -0,0 +1,65 @@
+package binary
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"overlord/pkg/mockconn"
+	"overlord/proxy/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func _binPacket(magic byte, rt RequestType, opaque uint32, key, value []byte) []byte {
+	bs := make([]byte, requestHeaderLen)
+	bs[0] = magic
+	bs[1] = byte(rt)
+	binary.BigEndian.PutUint16(bs[2:4], uint16(len(key)))
+	binary.BigEndian.PutUint32(bs[8:12], uint32(len(key)+len(value)))
+	binary.BigEndian.PutUint32(bs[12:16], opaque)
+	bs = append(bs, key...)
+	return append(bs, value...)
+}
+
+func TestNodeConnQuietBatchOk(t *testing.T) {
+	var replies []byte
+	replies = append(replies, _binPacket(magicResp, RequestTypeGetKQ, 1, []byte("a"), []byte("va"))...)
+	replies = append(replies, _binPacket(magicResp, RequestTypeGet, 3, nil, []byte("vc"))...)
+	replies = append(replies, _binPacket(magicResp, RequestTypeNoop, 5, nil, nil)...)
+	nc := _createNodeConn(replies)
+	nc.quiet = true
+
+	var msgs []*proto.Message
+	for i, rt := range []RequestType{RequestTypeGetKQ, RequestTypeGetQ, RequestTypeGet, RequestTypeGetKQ} {
+		key := []byte{byte('a' + i)}
+		msgs = append(msgs, _createReqMsg(_binPacket(magicReq, rt, uint32(100+i), key, nil)))
+	}
+	for _, msg := range msgs {
+		assert.NoError(t, nc.Write(msg))
+	}
+	assert.NoError(t, nc.Flush())
+
+	written := nc.conn.Conn.(*mockconn.MockConn).Wbuf.Bytes()
+	// NOTE: quiet gets are sent as they are and terminated by NOOP
+	assert.Equal(t, byte(RequestTypeGetQ), written[requestHeaderLen+1+1])
+	assert.True(t, bytes.HasSuffix(written, _binPacket(magicReq, RequestTypeNoop, 5, nil, nil)))
+
+	for _, msg := range msgs {
+		assert.NoError(t, nc.Read(msg))
+	}
+	for i, msg := range msgs {
+		mcr := msg.Request().(*MCRequest)
+		assert.Equal(t, uint32(100+i), binary.BigEndian.Uint32(mcr.opaque))
+	}
+	hit := msgs[0].Request().(*MCRequest)
+	assert.Equal(t, []byte("ava"), hit.data)
+	assert.Equal(t, zeroTwoBytes, hit.status)
+	miss := msgs[1].Request().(*MCRequest)
+	assert.Equal(t, keyNotFoundBytes, miss.status)
+	assert.Equal(t, zeroFourBytes, miss.bodyLen)
+	assert.Equal(t, []byte("vc"), msgs[2].Request().(*MCRequest).data)
+	assert.Equal(t, keyNotFoundBytes, msgs[3].Request().(*MCRequest).status)
+	assert.False(t, nc.qs.nooping)
+	assert.Len(t, nc.qs.reqs, 0)
+}
@@ -1,10 +1,12 @@
 package binary
 
 import (
+	"encoding/binary"
 	errs "errors"
 	"fmt"
 	"sync"
 
+	"overlord/proxy/mcstat"
 	"overlord/proxy/proto"
 )
 
@@ -278,7 +280,9 @@ const (
 )
 
 var (
-	resopnseStatusInternalErrBytes = []byte{0x00, 0x84}
+	resopnseStatusInternalErrBytes   = []byte{0x00, 0x84}
+	responseStatusValueTooLargeBytes = []byte{0x00, 0x03}
+	responseStatusInvalidArgBytes    = []byte{0x00, 0x04}
 )
 
 // errors
@@ -304,6 +308,11 @@ var (
 	ErrPingerPong  = errs.New("SERVER_ERROR Pinger pong unexpected")
 	ErrAssertReq   = errs.New("SERVER_ERROR assert request not ok")
 	ErrBadResponse = errs.New("SERVER_ERROR bad response")
+
+	// NOTE: replied with status Invalid arguments and Value too large when
+	// the request exceeds the size limits of cluster.
+	ErrKeyTooLong    = errs.New("key too long")
+	ErrValueTooLarge = errs.New("value too large")
 )
 
 // MCRequest is the mc client Msg type and data.
@@ -321,6 +330,9 @@ type MCRequest struct {
 
 	key  []byte
 	data []byte
+	// size is the bytes of request decoded, the data is replaced by the
+	// reply after read.
+	size int
 }
 
 var msgPool = &sync.Pool{
@@ -351,6 +363,7 @@ func (r *MCRequest) Put() {
 	r.respType = RequestTypeUnknown
 	r.key = r.key[:0]
 	r.data = r.data[:0]
+	r.size = 0
 	msgPool.Put(r)
 }
 
@@ -369,6 +382,122 @@ func (r *MCRequest) Key() []byte {
 	return r.key
 }
 
+// IsRead returns whether or not get/getq/getk/getkq.
+func (r *MCRequest) IsRead() bool {
+	switch r.respType {
+	case RequestTypeGet, RequestTypeGetQ, RequestTypeGetK, RequestTypeGetKQ:
+		return true
+	}
+	return false
+}
+
+// IsWrite returns whether or not the command changes value, gat/gatq
+// changes the expiration of key so they are writes too.
+func (r *MCRequest) IsWrite() bool {
+	switch r.respType {
+	case RequestTypeSet, RequestTypeAdd, RequestTypeReplace, RequestTypeDelete, RequestTypeIncr,
+		RequestTypeDecr, RequestTypeAppend, RequestTypePrepend, RequestTypeSetQ, RequestTypeAddQ,
+		RequestTypeReplaceQ, RequestTypeIncrQ, RequestTypeDecrQ, RequestTypeAppendQ, RequestTypePrependQ,
+		RequestTypeTouch, RequestTypeGat, RequestTypeGatQ:
+		return true
+	}
+	return false
+}
+
+// Clone impl proto.Hedger.
+func (r *MCRequest) Clone() proto.Request {
+	c := GetReq()
+	c.copyFrom(r)
+	c.respType = r.respType
+	c.key = append(c.key[:0], r.key...)
+	return c
+}
+
+// CopyReply impl proto.Hedger.
+func (r *MCRequest) CopyReply(o proto.Request) {
+	if or, ok := o.(*MCRequest); ok {
+		r.copyFrom(or)
+	}
+}
+
+// Hits impl proto.Hitter, the status of get is key not found if missed.
+func (r *MCRequest) Hits() (hits, misses int) {
+	switch r.respType {
+	case RequestTypeGet, RequestTypeGetQ, RequestTypeGetK, RequestTypeGetKQ, RequestTypeGat, RequestTypeGatQ:
+	default:
+		return
+	}
+	switch binary.BigEndian.Uint16(r.status) {
+	case ResponseStatusNoErr:
+		hits = 1
+	case ResponseStatusKeyNotFound:
+		misses = 1
+	}
+	return
+}
+
+// Stat impl mcstat.Stater by the response status, the cas is replaced by
+// the reply so that the stored cas is counted as stored and key exists as
+// cas badval.
+func (r *MCRequest) Stat() (s mcstat.Stat, ok bool) {
+	status := binary.BigEndian.Uint16(r.status)
+	switch r.respType {
+	case RequestTypeGet, RequestTypeGetQ, RequestTypeGetK, RequestTypeGetKQ, RequestTypeGat, RequestTypeGatQ:
+		if hits, misses := r.Hits(); hits > 0 {
+			return mcstat.GetHits, true
+		} else if misses > 0 {
+			return mcstat.GetMisses, true
+		}
+	case RequestTypeSet, RequestTypeSetQ, RequestTypeReplace, RequestTypeReplaceQ,
+		RequestTypeAppend, RequestTypeAppendQ, RequestTypePrepend, RequestTypePrependQ:
+		switch status {
+		case ResponseStatusNoErr:
+			return mcstat.Stored, true
+		case ResponseStatusKeyExists:
+			return mcstat.CasBadval, true
+		case ResponseStatusKeyNotFound:
+			if r.respType == RequestTypeSet || r.respType == RequestTypeSetQ {
+				return mcstat.CasMisses, true
+			}
+			return mcstat.NotStored, true
+		case ResponseStatusItemNotStored:
+			return mcstat.NotStored, true
+		}
+	case RequestTypeAdd, RequestTypeAddQ:
+		switch status {
+		case ResponseStatusNoErr:
+			return mcstat.Stored, true
+		case ResponseStatusKeyExists, ResponseStatusItemNotStored:
+			return mcstat.NotStored, true
+		}
+	case RequestTypeTouch:
+		switch status {
+		case ResponseStatusNoErr:
+			return mcstat.TouchHits, true
+		case ResponseStatusKeyNotFound:
+			return mcstat.TouchMisses, true
+		}
+	}
+	return
+}
+
+// Size impl proto.Sizer.
+func (r *MCRequest) Size() (req, reply int) {
+	return r.size, requestHeaderLen + len(r.data)
+}
+
+// copyFrom copies the header and data of o.
+func (r *MCRequest) copyFrom(o *MCRequest) {
+	r.magic = o.magic
+	copy(r.keyLen, o.keyLen)
+	copy(r.extraLen, o.extraLen)
+	copy(r.status, o.status)
+	copy(r.bodyLen, o.bodyLen)
+	copy(r.opaque, o.opaque)
+	copy(r.cas, o.cas)
+	r.data = append(r.data[:0], o.data...)
+}
+
 func (r *MCRequest) Merge([]proto.Request) (err error) {
 	return
 }
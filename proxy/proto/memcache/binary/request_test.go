@@ -3,6 +3,8 @@ package binary
 import (
 	"testing"
 
+	"overlord/proxy/mcstat"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -68,3 +70,31 @@ func TestMCRequestFuncsOk(t *testing.T) {
 	assert.Len(t, req.key, 0)
 	assert.Len(t, req.data, 0)
 }
+
+func TestMCRequestStat(t *testing.T) {
+	for _, c := range []struct {
+		typ    RequestType
+		status byte
+		st     mcstat.Stat
+		ok     bool
+	}{
+		{RequestTypeGetK, ResponseStatusNoErr, mcstat.GetHits, true},
+		{RequestTypeGetQ, ResponseStatusKeyNotFound, mcstat.GetMisses, true},
+		{RequestTypeSet, ResponseStatusNoErr, mcstat.Stored, true},
+		{RequestTypeSet, ResponseStatusKeyExists, mcstat.CasBadval, true},
+		{RequestTypeSet, ResponseStatusKeyNotFound, mcstat.CasMisses, true},
+		{RequestTypeReplace, ResponseStatusKeyNotFound, mcstat.NotStored, true},
+		{RequestTypeAdd, ResponseStatusKeyExists, mcstat.NotStored, true},
+		{RequestTypeTouch, ResponseStatusKeyNotFound, mcstat.TouchMisses, true},
+		{RequestTypeDelete, ResponseStatusNoErr, 0, false},
+	} {
+		req := newReq()
+		req.respType = c.typ
+		req.status[1] = c.status
+		st, ok := req.Stat()
+		assert.Equal(t, c.ok, ok, c.typ.String())
+		if ok {
+			assert.Equal(t, c.st, st, c.typ.String())
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package memcache
+
+import (
+	"bytes"
+)
+
+// maskByte is the byte filling the masked values.
+const maskByte = 'x'
+
+// Capture impl proto.Capturer, the request is appended as the command line
+// followed by the data block of storage commands, whose data is masked if
+// keyOnly.
+func (r *MCRequest) Capture(buf []byte, keyOnly bool) []byte {
+	buf = append(buf, r.respType.Bytes()...)
+	start := len(buf)
+	switch {
+	case isMeta(r.respType) || r.respType == RequestTypeStats:
+		buf = append(buf, r.data...) // NOTE: key and flags with crlf
+	case r.respType == RequestTypeGat || r.respType == RequestTypeGats:
+		buf = append(buf, spaceByte)
+		buf = append(buf, r.data...) // NOTE: exp time
+		buf = append(buf, spaceByte)
+		buf = append(buf, r.key...)
+		buf = append(buf, crlfBytes...)
+	default:
+		buf = append(buf, spaceByte)
+		buf = append(buf, r.key...)
+		buf = append(buf, r.data...)
+	}
+	if !keyOnly {
+		return buf
+	}
+	// NOTE: the data block is between the first and the last crlf.
+	line := bytes.Index(buf[start:], crlfBytes)
+	if line < 0 || start+line+2 >= len(buf)-2 {
+		return buf
+	}
+	for i := start + line + 2; i < len(buf)-2; i++ {
+		buf[i] = maskByte
+	}
+	return buf
+}
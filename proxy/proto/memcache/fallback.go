@@ -0,0 +1,82 @@
+package memcache
+
+import (
+	"bytes"
+	"strconv"
+	"time"
+
+	"overlord/proxy/proto"
+)
+
+// maxRelativeExptime is the max exptime in seconds taken as relative by
+// memcached, the larger is taken as unix time.
+const maxRelativeExptime = 60 * 60 * 24 * 30
+
+// Missed impl proto.Fallbacker, only get and gets of one key are missed by
+// END.
+func (r *MCRequest) Missed() bool {
+	if r.respType != RequestTypeGet && r.respType != RequestTypeGets {
+		return false
+	}
+	return bytes.Equal(r.data, endBytes)
+}
+
+// Fallback impl proto.Fallbacker.
+func (r *MCRequest) Fallback() proto.Request {
+	c := GetReq()
+	c.respType = r.respType
+	c.key = append(c.key[:0], r.key...)
+	c.data = append(c.data[:0], crlfBytes...)
+	return c
+}
+
+// Answer impl proto.Fallbacker, the value is written back by set with the
+// exptime of ttl, zero means never expired.
+func (r *MCRequest) Answer(fr proto.Request, ttl time.Duration) proto.Request {
+	o, ok := fr.(*MCRequest)
+	if !ok {
+		return nil
+	}
+	flags, value, ok := parseValue(o.data)
+	if !ok {
+		return nil
+	}
+	r.data = append(r.data[:0], o.data...)
+	exptime := int64((ttl + time.Second - 1) / time.Second)
+	if exptime > maxRelativeExptime {
+		exptime += time.Now().Unix()
+	}
+	w := GetReq()
+	w.respType = RequestTypeSet
+	w.key = append(w.key[:0], r.key...)
+	w.data = append(w.data[:0], spaceByte)
+	w.data = append(w.data, flags...)
+	w.data = append(w.data, spaceByte)
+	w.data = strconv.AppendInt(w.data, exptime, 10)
+	w.data = append(w.data, spaceByte)
+	w.data = strconv.AppendInt(w.data, int64(len(value)), 10)
+	w.data = append(w.data, crlfBytes...)
+	w.data = append(w.data, value...)
+	w.data = append(w.data, crlfBytes...)
+	return w
+}
+
+// parseValue parses the flags and data of the VALUE reply of one key.
+func parseValue(reply []byte) (flags, value []byte, ok bool) {
+	if !bytes.HasPrefix(reply, valueBytes) {
+		return
+	}
+	i := bytes.Index(reply, crlfBytes)
+	if i < 0 {
+		return
+	}
+	fields := bytes.Fields(reply[:i])
+	if len(fields) < 4 {
+		return
+	}
+	n, err := strconv.Atoi(string(fields[3]))
+	if err != nil || n < 0 || i+2+n+2 > len(reply) {
+		return
+	}
+	return fields[2], reply[i+2 : i+2+n], true
+}
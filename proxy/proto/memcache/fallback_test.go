@@ -0,0 +1,33 @@
+package memcache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMCRequestFallback(t *testing.T) {
+	req := &MCRequest{respType: RequestTypeGets, key: []byte("a"), data: []byte("END\r\n")}
+	assert.True(t, req.Missed())
+	fr := req.Fallback().(*MCRequest)
+	assert.Equal(t, RequestTypeGets, fr.respType)
+	assert.Equal(t, "a", string(fr.key))
+	assert.Equal(t, "\r\n", string(fr.data))
+
+	fr.data = []byte("VALUE a 3 2 7\r\nva\r\nEND\r\n")
+	w := req.Answer(fr, 1500*time.Millisecond).(*MCRequest)
+	assert.Equal(t, "VALUE a 3 2 7\r\nva\r\nEND\r\n", string(req.data))
+	assert.Equal(t, RequestTypeSet, w.respType)
+	assert.Equal(t, "a", string(w.key))
+	assert.Equal(t, " 3 2 2\r\nva\r\n", string(w.data))
+	assert.False(t, req.Missed())
+
+	fr.data = []byte("END\r\n")
+	req.data = []byte("END\r\n")
+	assert.Nil(t, req.Answer(fr, 0))
+	assert.Equal(t, "END\r\n", string(req.data))
+
+	req = &MCRequest{respType: RequestTypeGat, data: []byte("END\r\n")}
+	assert.False(t, req.Missed())
+}
@@ -0,0 +1,211 @@
+package memcache
+
+import (
+	"bytes"
+	"encoding/base64"
+
+	"overlord/pkg/bufio"
+	"overlord/pkg/conv"
+	"overlord/proxy/mcstat"
+	"overlord/proxy/proto"
+
+	"github.com/pkg/errors"
+)
+
+// meta protocol of memcached 1.6:
+//
+//	mg <key> <flags>*\r\n
+//	ms <key> <datalen> <flags>*\r\n<data>\r\n
+//	md <key> <flags>*\r\n
+//	ma <key> <flags>*\r\n
+//	mn\r\n
+//
+// The flags such as opaque O<token> are passed through except q. The quiet
+// requests are sent without q so that every request has one reply, and the
+// replies hidden by q are dropped when encoding.
+var (
+	mgBytes = []byte("mg")
+	msBytes = []byte("ms")
+	mdBytes = []byte("md")
+	maBytes = []byte("ma")
+	mnBytes = []byte("mn")
+
+	metaValueBytes = []byte("VA ")
+	metaHitBytes   = []byte("HD")
+	metaMissBytes  = []byte("EN\r\n")
+	metaNSBytes    = []byte("NS")
+	metaEXBytes    = []byte("EX")
+	metaNFBytes    = []byte("NF")
+	metaNoopBytes  = []byte("MN\r\n")
+
+	metaQuietFlag  = []byte("q")
+	metaBase64Flag = []byte("b")
+)
+
+const (
+	mgString = "mg"
+	msString = "ms"
+	mdString = "md"
+	maString = "ma"
+	mnString = "mn"
+)
+
+func isMeta(rt RequestType) bool {
+	switch rt {
+	case RequestTypeMetaGet, RequestTypeMetaSet, RequestTypeMetaDelete, RequestTypeMetaArithmetic:
+		return true
+	}
+	return false
+}
+
+// decodeMeta decodes the meta command bs after the command name, the line
+// is the whole command line which is rewound if the data is not buffered.
+func (p *proxyConn) decodeMeta(m *proto.Message, line, bs []byte, rtype RequestType) (err error) {
+	if rtype == RequestTypeMetaNoop {
+		WithReq(m, rtype, nil, crlfBytes)
+		return
+	}
+	keyB, keyE := nextField(bs)
+	key := bs[keyB:keyE]
+	if len(key) == 0 || !legalKey(key) {
+		err = errors.WithStack(ErrBadKey)
+		return
+	}
+	var (
+		fields = bytes.Fields(bs[keyE:])
+		data   = make([]byte, 0, len(bs))
+		quiet  bool
+		length = -1
+	)
+	data = append(data, spaceByte)
+	data = append(data, key...)
+	for i, f := range fields {
+		if rtype == RequestTypeMetaSet && i == 0 {
+			var l int64
+			if l, err = conv.Btoi(f); err != nil || l < 0 {
+				err = errors.WithStack(ErrBadLength)
+				return
+			}
+			length = int(l)
+		} else if bytes.Equal(f, metaQuietFlag) {
+			quiet = true
+			continue
+		} else if bytes.Equal(f, metaBase64Flag) {
+			// NOTE: route by the decoded key as the classic commands.
+			dec := make([]byte, base64.StdEncoding.DecodedLen(len(key)))
+			var n int
+			if n, err = base64.StdEncoding.Decode(dec, key); err != nil {
+				err = errors.WithStack(ErrBadKey)
+				return
+			}
+			key = dec[:n]
+		}
+		data = append(data, spaceByte)
+		data = append(data, f...)
+	}
+	data = append(data, crlfBytes...)
+	if rtype == RequestTypeMetaSet {
+		if length == -1 {
+			err = errors.WithStack(ErrBadLength)
+			return
+		}
+		if p.maxValueSize > 0 && length > p.maxValueSize {
+			return p.rejectValue(m, rtype, key, length)
+		}
+		var value []byte
+		if value, err = p.br.ReadExact(length + 2); err == bufio.ErrBufferFull {
+			p.br.Advance(-len(line))
+			return
+		} else if err != nil {
+			err = errors.WithStack(err)
+			return
+		}
+		if !bytes.HasSuffix(value, crlfBytes) {
+			err = errors.WithStack(ErrBadRequest)
+			return
+		}
+		data = append(data, value...)
+	}
+	WithReq(m, rtype, key, data)
+	m.Request().(*MCRequest).quiet = quiet
+	return
+}
+
+// readMeta reads the reply line, and the data of VA.
+func (n *nodeConn) readMeta(mcr *MCRequest) (err error) {
+	var bs []byte
+	for {
+		if bs, err = n.br.ReadLine(); err == bufio.ErrBufferFull {
+			if err = n.br.Read(); err != nil {
+				err = errors.WithStack(err)
+				return
+			}
+			continue
+		} else if err != nil {
+			err = errors.WithStack(err)
+			return
+		}
+		break
+	}
+	mcr.data = append(mcr.data, bs...)
+	if !bytes.HasPrefix(bs, metaValueBytes) {
+		return
+	}
+	var length int
+	if length, err = parseLen(bs, 2); err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+	var data []byte
+	for {
+		if data, err = n.br.ReadExact(length + 2); err == bufio.ErrBufferFull {
+			if err = n.br.Read(); err != nil {
+				err = errors.WithStack(err)
+				return
+			}
+			continue
+		} else if err != nil {
+			err = errors.WithStack(err)
+			return
+		}
+		break
+	}
+	mcr.data = append(mcr.data, data...)
+	return
+}
+
+// metaHidden returns true if the reply is hidden by the q flag, EN of mg
+// and HD of the others.
+func (r *MCRequest) metaHidden() bool {
+	if !r.quiet {
+		return false
+	}
+	if r.respType == RequestTypeMetaGet {
+		return bytes.Equal(r.data, metaMissBytes)
+	}
+	return bytes.HasPrefix(r.data, metaHitBytes)
+}
+
+// metaStat returns the mcstat of meta reply.
+func (r *MCRequest) metaStat() (s mcstat.Stat, ok bool) {
+	switch r.respType {
+	case RequestTypeMetaGet:
+		if bytes.HasPrefix(r.data, metaValueBytes) || bytes.HasPrefix(r.data, metaHitBytes) {
+			return mcstat.GetHits, true
+		} else if bytes.Equal(r.data, metaMissBytes) {
+			return mcstat.GetMisses, true
+		}
+	case RequestTypeMetaSet:
+		switch {
+		case bytes.HasPrefix(r.data, metaHitBytes):
+			return mcstat.Stored, true
+		case bytes.HasPrefix(r.data, metaNSBytes):
+			return mcstat.NotStored, true
+		case bytes.HasPrefix(r.data, metaEXBytes):
+			return mcstat.CasBadval, true
+		case bytes.HasPrefix(r.data, metaNFBytes):
+			return mcstat.CasMisses, true
+		}
+	}
+	return
+}
@@ -0,0 +1,127 @@
+package memcache
+
+import (
+	"testing"
+	"time"
+
+	"overlord/pkg/mockconn"
+	libcon "overlord/pkg/net"
+	"overlord/proxy/mcstat"
+	"overlord/proxy/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyConnDecodeMeta(t *testing.T) {
+	ts := []struct {
+		Name  string
+		Data  string
+		Err   error
+		Type  RequestType
+		Key   string
+		Sent  string
+		Quiet bool
+	}{
+		{"MgOk", "mg mykey v k O123\r\n", nil, RequestTypeMetaGet, "mykey", "mg mykey v k O123\r\n", false},
+		{"MgQuiet", "mg mykey q v\r\n", nil, RequestTypeMetaGet, "mykey", "mg mykey v\r\n", true},
+		{"MgBase64", "mg bXlrZXk= b v\r\n", nil, RequestTypeMetaGet, "mykey", "mg bXlrZXk= b v\r\n", false},
+		{"MgBadBase64", "mg !!!! b v\r\n", ErrBadKey, 0, "", "", false},
+		{"MgNoKey", "mg\r\n", ErrBadKey, 0, "", "", false},
+		{"MsOk", "ms mykey 2 T30 F5 q\r\nab\r\n", nil, RequestTypeMetaSet, "mykey", "ms mykey 2 T30 F5\r\nab\r\n", true},
+		{"MsBadLength", "ms mykey abc\r\nab\r\n", ErrBadLength, 0, "", "", false},
+		{"MsNoLength", "ms mykey\r\nab\r\n", ErrBadLength, 0, "", "", false},
+		{"MsNoCRLF", "ms mykey 2\r\nabcd", ErrBadRequest, 0, "", "", false},
+		{"MdOk", "md mykey q O1\r\n", nil, RequestTypeMetaDelete, "mykey", "md mykey O1\r\n", true},
+		{"MaOk", "ma mykey MI D5 v\r\n", nil, RequestTypeMetaArithmetic, "mykey", "ma mykey MI D5 v\r\n", false},
+	}
+	for _, tt := range ts {
+		t.Run(tt.Name, func(t *testing.T) {
+			conn := libcon.NewConn(mockconn.CreateConn([]byte(tt.Data), 1), time.Second, time.Second)
+			p := NewProxyConn(conn)
+			msgs, err := p.Decode(proto.GetMsgs(1))
+			if tt.Err != nil {
+				_causeEqual(t, tt.Err, err)
+				return
+			}
+			assert.NoError(t, err)
+			mcr := msgs[0].Request().(*MCRequest)
+			assert.Equal(t, tt.Type, mcr.respType)
+			assert.Equal(t, tt.Key, string(mcr.Key()))
+			assert.Equal(t, tt.Quiet, mcr.quiet)
+			assert.False(t, mcr.noreply)
+
+			nc := _createNodeConn(nil)
+			assert.NoError(t, nc.Write(msgs[0]))
+			assert.NoError(t, nc.Flush())
+			assert.Equal(t, tt.Sent, nc.conn.Conn.(*mockconn.MockConn).Wbuf.String())
+		})
+	}
+}
+
+func TestProxyConnDecodeMetaSetNotBuffered(t *testing.T) {
+	conn := libcon.NewConn(mockconn.CreateConn([]byte("ms mykey 2048\r\nab"), 1), time.Second, time.Second)
+	p := NewProxyConn(conn)
+	msgs, err := p.Decode(proto.GetMsgs(1))
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 0)
+	line, err := p.(*proxyConn).br.ReadLine()
+	assert.NoError(t, err)
+	assert.Equal(t, "ms mykey 2048\r\n", string(line))
+}
+
+func TestProxyConnEncodeMeta(t *testing.T) {
+	ts := []struct {
+		Name   string
+		Req    string
+		Resp   string
+		Except string
+	}{
+		{"MgHit", "mg mykey v\r\n", "VA 2 f0\r\nab\r\n", "VA 2 f0\r\nab\r\n"},
+		{"MgMiss", "mg mykey v\r\n", "EN\r\n", "EN\r\n"},
+		{"MgQuietMiss", "mg mykey v q\r\n", "EN\r\n", ""},
+		{"MgQuietHit", "mg mykey v q\r\n", "VA 1\r\na\r\n", "VA 1\r\na\r\n"},
+		{"MsQuietStored", "ms mykey 1 q\r\na\r\n", "HD\r\n", ""},
+		{"MsQuietNotStored", "ms mykey 1 q\r\na\r\n", "NS\r\n", "NS\r\n"},
+		{"MdOpaque", "md mykey O9\r\n", "HD O9\r\n", "HD O9\r\n"},
+		{"MaValue", "ma mykey v\r\n", "VA 2\r\n11\r\n", "VA 2\r\n11\r\n"},
+		{"MnOk", "mn\r\n", "", "MN\r\n"},
+	}
+	for _, tt := range ts {
+		t.Run(tt.Name, func(t *testing.T) {
+			conn := libcon.NewConn(mockconn.CreateConn(nil, 1), time.Second, time.Second)
+			p := NewProxyConn(conn)
+			msg := _createRespMsg(t, []byte(tt.Req), [][]byte{[]byte(tt.Resp)})
+			assert.NoError(t, p.Encode(msg))
+			assert.NoError(t, p.Flush())
+			assert.Equal(t, tt.Except, conn.Conn.(*mockconn.MockConn).Wbuf.String())
+		})
+	}
+}
+
+func TestMCRequestMetaStat(t *testing.T) {
+	ts := []struct {
+		typ  RequestType
+		data string
+		st   mcstat.Stat
+		ok   bool
+	}{
+		{RequestTypeMetaGet, "VA 1\r\na\r\n", mcstat.GetHits, true},
+		{RequestTypeMetaGet, "HD\r\n", mcstat.GetHits, true},
+		{RequestTypeMetaGet, "EN\r\n", mcstat.GetMisses, true},
+		{RequestTypeMetaSet, "HD\r\n", mcstat.Stored, true},
+		{RequestTypeMetaSet, "NS\r\n", mcstat.NotStored, true},
+		{RequestTypeMetaSet, "EX\r\n", mcstat.CasBadval, true},
+		{RequestTypeMetaDelete, "HD\r\n", 0, false},
+	}
+	for _, tt := range ts {
+		req := &MCRequest{respType: tt.typ, data: []byte(tt.data)}
+		st, ok := req.Stat()
+		assert.Equal(t, tt.ok, ok, tt.data)
+		if ok {
+			assert.Equal(t, tt.st, st, tt.data)
+		}
+	}
+	hits, misses := (&MCRequest{respType: RequestTypeMetaGet, data: []byte("EN\r\n")}).Hits()
+	assert.Equal(t, 0, hits)
+	assert.Equal(t, 1, misses)
+}
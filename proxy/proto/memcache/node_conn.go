@@ -7,6 +7,7 @@ import (
 
 	"overlord/pkg/bufio"
 	libnet "overlord/pkg/net"
+	"overlord/proxy/mcstat"
 	"overlord/proxy/proto"
 
 	"github.com/pkg/errors"
@@ -66,15 +67,34 @@ func (n *nodeConn) Write(m *proto.Message) (err error) {
 		err = errors.WithStack(ErrAssertReq)
 		return
 	}
-	if mcr.respType == RequestTypeQuit || mcr.respType == RequestTypeVersion {
+	if mcr.IsLocal() {
 		return
 	}
 	_ = n.bw.Write(mcr.respType.Bytes())
+	if isMeta(mcr.respType) {
+		err = n.bw.Write(mcr.data) // NOTE: key and flags with crlf
+		return
+	}
+	if mcr.respType == RequestTypeStats {
+		err = n.bw.Write(mcr.data) // NOTE: args with crlf
+		return
+	}
 	_ = n.bw.Write(spaceBytes)
 	if mcr.respType == RequestTypeGat || mcr.respType == RequestTypeGats {
 		_ = n.bw.Write(mcr.data) // NOTE: exp time
 		_ = n.bw.Write(spaceBytes)
 		_ = n.bw.Write(mcr.key)
+		for _, sub := range mcr.subs {
+			_ = n.bw.Write(spaceBytes)
+			_ = n.bw.Write(sub.key)
+		}
+		err = n.bw.Write(crlfBytes)
+	} else if len(mcr.subs) > 0 {
+		_ = n.bw.Write(mcr.key)
+		for _, sub := range mcr.subs {
+			_ = n.bw.Write(spaceBytes)
+			_ = n.bw.Write(sub.key)
+		}
 		err = n.bw.Write(crlfBytes)
 	} else {
 		_ = n.bw.Write(mcr.key)
@@ -100,11 +120,21 @@ func (n *nodeConn) Read(m *proto.Message) (err error) {
 		err = errors.WithStack(ErrAssertReq)
 		return
 	}
-	if mcr.respType == RequestTypeQuit || mcr.respType == RequestTypeSetNoreply || mcr.respType == RequestTypeVersion {
+	if mcr.respType == RequestTypeQuit || mcr.respType == RequestTypeSetNoreply || mcr.respType == RequestTypeVersion ||
+		mcr.respType == RequestTypeVerbosity || mcr.respType == RequestTypeMetaNoop || mcr.noreply {
 		return
 	}
 
 	mcr.data = mcr.data[:0]
+	if mcr.respType == RequestTypeStats {
+		return n.readStats(mcr)
+	}
+	if len(mcr.subs) > 0 {
+		return n.readMerged(mcr)
+	}
+	if isMeta(mcr.respType) {
+		return n.readMeta(mcr)
+	}
 REREAD:
 	var bs []byte
 	if bs, err = n.br.ReadLine(); err == bufio.ErrBufferFull {
@@ -129,6 +159,10 @@ REREAD:
 	}
 	ds := length + 2 + len(endBytes)
 	mcr.data = append(mcr.data, bs...)
+	if st := m.Streamer(); st != nil && length > st.Threshold {
+		m.WithStream(st.NewStream(n.br, ds))
+		return
+	}
 
 REREADData:
 	var data []byte
@@ -146,6 +180,110 @@ REREADData:
 	return
 }
 
+// readMerged reads the values of merged retrievals until END, and fills
+// them into the requests of same key in order. Every request ends with END
+// as if it's sent alone.
+func (n *nodeConn) readMerged(mcr *MCRequest) (err error) {
+	reqs := append([]*MCRequest{mcr}, mcr.subs...)
+	for _, r := range mcr.subs {
+		r.data = r.data[:0]
+	}
+	filled := make([]bool, len(reqs))
+	for {
+		var bs []byte
+		if bs, err = n.br.ReadLine(); err == bufio.ErrBufferFull {
+			if err = n.br.Read(); err != nil {
+				err = errors.WithStack(err)
+				return
+			}
+			continue
+		} else if err != nil {
+			err = errors.WithStack(err)
+			return
+		}
+		if bytes.Equal(bs, endBytes) {
+			break
+		}
+		if !bytes.HasPrefix(bs, valueBytes) {
+			// NOTE: ERROR or SERVER_ERROR replied by node
+			mcr.data = append(mcr.data, bs...)
+			return
+		}
+		kB, kE := nextField(bs[len(valueBytes):])
+		key := bs[len(valueBytes)+kB : len(valueBytes)+kE]
+		idx := -1
+		for i, r := range reqs {
+			if !filled[i] && bytes.Equal(r.key, key) {
+				idx = i
+				break
+			}
+		}
+		if idx == -1 {
+			err = errors.WithStack(ErrBadResponse)
+			return
+		}
+		var length int
+		if length, err = parseLen(bs, 4); err != nil {
+			err = errors.WithStack(err)
+			return
+		}
+		filled[idx] = true
+		reqs[idx].data = append(reqs[idx].data, bs...)
+		var data []byte
+		for {
+			if data, err = n.br.ReadExact(length + 2); err == bufio.ErrBufferFull {
+				if err = n.br.Read(); err != nil {
+					err = errors.WithStack(err)
+					return
+				}
+				continue
+			} else if err != nil {
+				err = errors.WithStack(err)
+				return
+			}
+			break
+		}
+		reqs[idx].data = append(reqs[idx].data, data...)
+	}
+	for _, r := range reqs {
+		r.data = append(r.data, endBytes...)
+	}
+	for _, r := range mcr.subs {
+		// NOTE: the merged request is recorded by pipe
+		if s, ok := r.Stat(); ok {
+			mcstat.Incr(n.cluster, n.addr, s)
+		}
+	}
+	return
+}
+
+// readStats reads the STAT or ITEM lines until END, or the single line such
+// as RESET and ERROR.
+func (n *nodeConn) readStats(mcr *MCRequest) (err error) {
+	for {
+		var bs []byte
+		if bs, err = n.br.ReadLine(); err == bufio.ErrBufferFull {
+			if err = n.br.Read(); err != nil {
+				err = errors.WithStack(err)
+				return
+			}
+			continue
+		} else if err != nil {
+			err = errors.WithStack(err)
+			return
+		}
+		mcr.data = append(mcr.data, bs...)
+		if !bytes.HasPrefix(bs, statBytes) && !bytes.HasPrefix(bs, itemBytes) {
+			return
+		}
+	}
+}
+
+// SetReadTimeout impl proto.ReadTimeouter.
+func (n *nodeConn) SetReadTimeout(timeout time.Duration) {
+	n.conn.SetReadTimeout(timeout)
+}
+
 func (n *nodeConn) Close() error {
 	if atomic.CompareAndSwapInt32(&n.state, opened, closed) {
 		return n.conn.Close()
@@ -52,6 +52,7 @@ func TestNodeConnWriteOk(t *testing.T) {
 	}{
 		{rtype: RequestTypeSet, key: "mykey", data: " 0 0 1\r\na\r\n", except: "set mykey 0 0 1\r\na\r\n"},
 		{rtype: RequestTypeGat, key: "mykey", data: "1024", except: "gat 1024 mykey\r\n"},
+		{rtype: RequestTypeStats, data: " slabs\r\n", except: "stats slabs\r\n"},
 	}
 
 	for _, tt := range ts {
@@ -224,6 +225,16 @@ func TestNodeConnReadOk(t *testing.T) {
 			rtype:  RequestTypeSet, key: "mykey", data: " 0 0 1\r\nb\r\n",
 			cData: "STORED\r\n", except: "STORED\r\n",
 		},
+		{
+			suffix: "Ok",
+			rtype:  RequestTypeStats, data: "\r\n",
+			cData: "STAT pid 1\r\nSTAT curr_items 2\r\nEND\r\n", except: "STAT pid 1\r\nSTAT curr_items 2\r\nEND\r\n",
+		},
+		{
+			suffix: "Reset",
+			rtype:  RequestTypeStats, data: " reset\r\n",
+			cData: "RESET\r\n", except: "RESET\r\n",
+		},
 	}
 	for _, tt := range ts {
 		t.Run(fmt.Sprintf("%v%s", tt.rtype, tt.suffix), func(t *testing.T) {
@@ -266,6 +277,54 @@ func TestNodeConnReadWithLargeValue(t *testing.T) {
 
 }
 
+func TestNodeConnReadStream(t *testing.T) {
+	bodySize := 1048576
+	head := []byte("VALUE a 1 1048576\r\n")
+	tail := "\r\nEND\r\n"
+	small := "VALUE b 0 1\r\nb\r\nEND\r\n"
+
+	data := []byte{}
+	for i := 0; i < 2; i++ {
+		data = append(data, head...)
+		data = append(data, make([]byte, bodySize)...)
+		data = append(data, tail...)
+	}
+	data = append(data, small...)
+
+	nc := _createNodeConn(data)
+	for i := 0; i < 2; i++ {
+		t.Run(fmt.Sprintf("times-%d", i+1), func(t *testing.T) {
+			msg := _createReqMsg(RequestTypeGet, []byte("a"), []byte("\r\n"))
+			msg.WithStreamer(&proto.Streamer{Threshold: 1024, Buffer: 64 * 1024})
+			err := nc.Read(msg)
+			assert.NoError(t, err)
+			mcr := msg.Request().(*MCRequest)
+			assert.Equal(t, head, mcr.data)
+			s := msg.Stream()
+			assert.NotNil(t, s)
+
+			go s.Pump()
+			n := 0
+			for {
+				bs, err := s.Next()
+				if err != nil {
+					break
+				}
+				n += len(bs)
+			}
+			assert.Equal(t, bodySize+len(tail), n)
+			assert.True(t, nc.br.Size() < bodySize)
+		})
+	}
+
+	msg := _createReqMsg(RequestTypeGet, []byte("b"), []byte("\r\n"))
+	msg.WithStreamer(&proto.Streamer{Threshold: 1024, Buffer: 64 * 1024})
+	err := nc.Read(msg)
+	assert.NoError(t, err)
+	assert.Nil(t, msg.Stream())
+	assert.Equal(t, small, string(msg.Request().(*MCRequest).data))
+}
+
 func TestNodeConnReadHasErr(t *testing.T) {
 	msg := _createReqMsg(RequestTypeGet, []byte("mykey"), []byte("\r\n"))
 	nc := _createNodeConn([]byte("END\r\n"))
@@ -324,3 +383,59 @@ func TestNewNodeConnWithClosedBinder(t *testing.T) {
 	nc := NewNodeConn("anyName", addr.String(), time.Second, time.Second, time.Second)
 	assert.NotNil(t, nc)
 }
+
+func TestNodeConnWriteMerged(t *testing.T) {
+	ts := []struct {
+		rtype  RequestType
+		data   string
+		except string
+	}{
+		{rtype: RequestTypeGet, data: "\r\n", except: "get a b a\r\n"},
+		{rtype: RequestTypeGats, data: "10", except: "gats 10 a b a\r\n"},
+	}
+	for _, tt := range ts {
+		msg := _createReqMsg(tt.rtype, []byte("a"), []byte(tt.data))
+		mcr := msg.Request().(*MCRequest)
+		assert.NoError(t, mcr.Merge([]proto.Request{
+			&MCRequest{respType: tt.rtype, key: []byte("b"), data: []byte(tt.data)},
+			&MCRequest{respType: tt.rtype, key: []byte("a"), data: []byte(tt.data)},
+		}))
+		nc := _createNodeConn(nil)
+		assert.NoError(t, nc.Write(msg))
+		assert.NoError(t, nc.Flush())
+		m := nc.conn.Conn.(*mockconn.MockConn)
+		assert.Equal(t, tt.except, m.Wbuf.String())
+	}
+}
+
+func TestNodeConnReadMerged(t *testing.T) {
+	msg := _createReqMsg(RequestTypeGets, []byte("a"), []byte("\r\n"))
+	mcr := msg.Request().(*MCRequest)
+	b := &MCRequest{respType: RequestTypeGets, key: []byte("b"), data: []byte("\r\n")}
+	a := &MCRequest{respType: RequestTypeGets, key: []byte("a"), data: []byte("\r\n")}
+	c := &MCRequest{respType: RequestTypeGets, key: []byte("c"), data: []byte("\r\n")}
+	assert.NoError(t, mcr.Merge([]proto.Request{b, a, c}))
+
+	nc := _createNodeConn([]byte("VALUE a 0 1 7\r\n1\r\nVALUE b 0 2 8\r\n22\r\nVALUE a 0 1 7\r\n1\r\nEND\r\n"))
+	assert.NoError(t, nc.Read(msg))
+	assert.Equal(t, "VALUE a 0 1 7\r\n1\r\nEND\r\n", string(mcr.data))
+	assert.Equal(t, "VALUE b 0 2 8\r\n22\r\nEND\r\n", string(b.data))
+	assert.Equal(t, "VALUE a 0 1 7\r\n1\r\nEND\r\n", string(a.data))
+	assert.Equal(t, "END\r\n", string(c.data))
+
+	nc = _createNodeConn([]byte("VALUE x 0 1\r\n1\r\nEND\r\n"))
+	_causeEqual(t, ErrBadResponse, nc.Read(msg))
+
+	nc = _createNodeConn([]byte("SERVER_ERROR out of memory\r\n"))
+	assert.NoError(t, nc.Read(msg))
+	assert.Equal(t, "SERVER_ERROR out of memory\r\n", string(mcr.data))
+	assert.Len(t, c.data, 0)
+}
+
+func TestNodeConnReadNoreply(t *testing.T) {
+	msg := _createReqMsg(RequestTypeTouch, []byte("a"), []byte(" 10 noreply\r\n"))
+	msg.Request().(*MCRequest).noreply = true
+	nc := _createNodeConn(nil)
+	assert.NoError(t, nc.Read(msg))
+	assert.Equal(t, " 10 noreply\r\n", string(msg.Request().(*MCRequest).data))
+}
@@ -23,12 +23,16 @@ const (
 var (
 	serverErrorBytes  = []byte(serverErrorPrefix)
 	versionReplyBytes = []byte("VERSION ")
+	okBytes           = []byte("OK\r\n")
 )
 
 type proxyConn struct {
 	br        *bufio.Reader
 	bw        *bufio.Writer
 	completed bool
+
+	maxKeyLen    int
+	maxValueSize int
 }
 
 // NewProxyConn new a memcache decoder and encode.
@@ -42,6 +46,11 @@ func NewProxyConn(rw *libnet.Conn) proto.ProxyConn {
 	return p
 }
 
+// LimitSize impl proto.SizeLimiter.
+func (p *proxyConn) LimitSize(maxKeyLen, maxValueSize int) {
+	p.maxKeyLen, p.maxValueSize = maxKeyLen, maxValueSize
+}
+
 func (p *proxyConn) Decode(msgs []*proto.Message) ([]*proto.Message, error) {
 	var err error
 	// if completed, means that we have parsed all the buffered
@@ -67,11 +76,35 @@ func (p *proxyConn) Decode(msgs []*proto.Message) ([]*proto.Message, error) {
 			msgs[i].Reset()
 			return msgs[:i], err
 		}
+		if p.maxKeyLen > 0 {
+			p.checkKeyLen(msgs[i])
+		}
 		msgs[i].MarkStart()
 	}
 	return msgs, nil
 }
 
+func (p *proxyConn) checkKeyLen(m *proto.Message) {
+	for _, req := range m.Requests() {
+		if len(req.Key()) > p.maxKeyLen {
+			m.WithError(ErrKeyTooLong)
+			return
+		}
+	}
+}
+
+// rejectValue swallows the value larger than maxValueSize as memcached,
+// and keeps the client conn alive.
+func (p *proxyConn) rejectValue(m *proto.Message, rtype RequestType, key []byte, length int) (err error) {
+	if err = p.br.Discard(length + 2); err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+	WithReq(m, rtype, key, crlfBytes)
+	m.WithError(ErrValueTooLarge)
+	return
+}
+
 func (p *proxyConn) decode(m *proto.Message) (err error) {
 	// bufio reset buffer
 	line, err := p.br.ReadLine()
@@ -122,6 +155,21 @@ func (p *proxyConn) decode(m *proto.Message) (err error) {
 		return p.decodeQuit(m, line[ed:])
 	case versionString:
 		return p.decodeVersion(m, line[ed:])
+	case statsString:
+		return p.decodeStats(m, line[ed:])
+	case verbosityString:
+		return p.decodeVerbosity(m, line[ed:])
+	// Meta commands:
+	case mgString:
+		return p.decodeMeta(m, line, line[ed:], RequestTypeMetaGet)
+	case msString:
+		return p.decodeMeta(m, line, line[ed:], RequestTypeMetaSet)
+	case mdString:
+		return p.decodeMeta(m, line, line[ed:], RequestTypeMetaDelete)
+	case maString:
+		return p.decodeMeta(m, line, line[ed:], RequestTypeMetaArithmetic)
+	case mnString:
+		return p.decodeMeta(m, line, line[ed:], RequestTypeMetaNoop)
 	}
 	err = errors.WithStack(ErrBadRequest)
 	return
@@ -132,6 +180,24 @@ func (p *proxyConn) decodeVersion(m *proto.Message, key []byte) (err error) {
 	return
 }
 
+// decodeStats keeps the arguments such as " slabs\r\n" as data.
+func (p *proxyConn) decodeStats(m *proto.Message, args []byte) (err error) {
+	WithReq(m, RequestTypeStats, nil, args)
+	return
+}
+
+// decodeVerbosity is answered by proxy because the verbosity of nodes is
+// managed by operators.
+func (p *proxyConn) decodeVerbosity(m *proto.Message, bs []byte) (err error) {
+	lB, lE := nextField(bs)
+	if _, err = conv.Btoi(bs[lB:lE]); err != nil {
+		err = errors.WithStack(ErrBadRequest)
+		return
+	}
+	WithReq(m, RequestTypeVerbosity, nil, bs)
+	return
+}
+
 func (p *proxyConn) decodeQuit(m *proto.Message, key []byte) (err error) {
 	WithReq(m, RequestTypeQuit, key, crlfBytes)
 	return
@@ -157,6 +223,10 @@ func (p *proxyConn) decodeStorage(m *proto.Message, bs []byte, mtype RequestType
 		return
 	}
 
+	if p.maxValueSize > 0 && length > p.maxValueSize {
+		return p.rejectValue(m, mtype, key, length)
+	}
+
 	keyOffset := len(bs) - keyE
 	p.br.Advance(-keyOffset) // NOTE: data contains "<flags> <exptime> <bytes> <cas unique> [noreply]\r\n"
 	data, err := p.br.ReadExact(keyOffset + length + 2)
@@ -203,7 +273,7 @@ func (p *proxyConn) decodeDelete(m *proto.Message, bs []byte, reqType RequestTyp
 		err = errors.WithStack(ErrBadKey)
 		return
 	}
-	WithReq(m, reqType, key, crlfBytes)
+	WithReq(m, reqType, key, bs[keyE:]) // NOTE: data contains "[noreply]\r\n"
 	return
 }
 
@@ -285,6 +355,8 @@ func WithReq(m *proto.Message, rtype RequestType, key []byte, data []byte) {
 		req.key = append(req.key, key...)
 		req.data = req.data[:0]
 		req.data = append(req.data, data...)
+		req.size = len(key) + len(data)
+		req.noreply = isNoreply(rtype, data)
 		m.WithRequest(req)
 	} else {
 		mcreq := req.(*MCRequest)
@@ -293,9 +365,23 @@ func WithReq(m *proto.Message, rtype RequestType, key []byte, data []byte) {
 		mcreq.key = append(mcreq.key, key...)
 		mcreq.data = mcreq.data[:0]
 		mcreq.data = append(mcreq.data, data...)
+		mcreq.size = len(key) + len(data)
+		mcreq.noreply = isNoreply(rtype, data)
 	}
 }
 
+// isNoreply returns true if the last field of the command line is noreply,
+// the data of storage commands is followed by the value.
+func isNoreply(rtype RequestType, data []byte) bool {
+	if _, ok := withValueTypes[rtype]; ok || rtype == RequestTypeStats || rtype == RequestTypeMetaNoop || isMeta(rtype) {
+		return false
+	}
+	if idx := bytes.Index(data, crlfBytes); idx != -1 {
+		data = data[:idx]
+	}
+	return bytes.HasSuffix(data, noreplyBytes) && (len(data) == len(noreplyBytes) || data[len(data)-len(noreplyBytes)-1] == spaceByte)
+}
+
 func nextField(bs []byte) (begin, end int) {
 	begin = noSpaceIdx(bs)
 	offset := bytes.IndexByte(bs[begin:], spaceByte)
@@ -395,14 +481,32 @@ func (p *proxyConn) Encode(m *proto.Message) (err error) {
 			err = p.bw.Write(crlfBytes)
 			return
 		}
-		if mcr.respType == RequestTypeSetNoreply {
+		if mcr.respType == RequestTypeSetNoreply || mcr.noreply {
+			return
+		}
+		if mcr.respType == RequestTypeVerbosity {
+			err = p.bw.Write(okBytes)
+			return
+		}
+		if mcr.respType == RequestTypeMetaNoop {
+			err = p.bw.Write(metaNoopBytes)
+			return
+		}
+		if mcr.metaHidden() {
 			return
 		}
 
 		err = p.bw.Write(mcr.data)
+		if s := m.Stream(); s != nil && err == nil {
+			err = s.WriteTo(p.bw)
+		}
 		return
 	}
 
+	if mcr, ok := m.Request().(*MCRequest); ok && mcr.IsStats() {
+		err = p.bw.Write(mergeStats(m.Requests()))
+		return
+	}
 	for _, req := range m.Requests() {
 		mcr, ok := req.(*MCRequest)
 		if !ok {
@@ -430,3 +534,8 @@ func (p *proxyConn) Encode(m *proto.Message) (err error) {
 func (p *proxyConn) Flush() (err error) {
 	return p.bw.Flush()
 }
+
+// BufferSizes impl proto.BufferSizer.
+func (pc *proxyConn) BufferSizes() (rbuf, wbuf int) {
+	return pc.br.Size(), pc.bw.Buffered()
+}
@@ -3,6 +3,7 @@ package memcache
 import (
 	"bytes"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -137,6 +138,14 @@ func TestProxyConnDecodeOk(t *testing.T) {
 		{"GatBadExpire", "gat abcdef mykey\r\n", ErrBadRequest, "", ""},
 		{"GatsOk", "gats 10 mykey\r\n", nil, "mykey", "gats"},
 		{"GatsMultiKeyOk", "gats 10 mykey yourkey yuki\r\n", nil, "mykey", "gats"},
+
+		// Verbosity
+		{"VerbosityOk", "verbosity 1\r\n", nil, "", "verbosity"},
+		{"VerbosityBadLevel", "verbosity abc\r\n", ErrBadRequest, "", ""},
+
+		// Stats
+		{"StatsOk", "stats\r\n", nil, "", "stats"},
+		{"StatsArgsOk", "stats slabs\r\n", nil, "", "stats"},
 		// Not support
 		{"NotSupportCmd", "baka 10 mykey\r\n", ErrBadRequest, "", ""},
 		// {"NotFullLine", "baka 10", ErrBadRequest, "", ""},
@@ -263,3 +272,75 @@ func TestEncodeErr(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Contains(t, string(buf[:size]), "SERVER_ERR")
 }
+
+func TestProxyConnDecodeNoreply(t *testing.T) {
+	ts := []struct {
+		Data    string
+		Noreply bool
+	}{
+		{"set mykey 0 0 2 noreply\r\nab\r\n", true},
+		{"add mykey 0 0 7\r\nnoreply\r\n", false},
+		{"cas mykey 0 0 2 47 noreply\r\nab\r\n", true},
+		{"append mykey 0 0 2 noreply\r\nab\r\n", true},
+		{"delete mykey noreply\r\n", true},
+		{"delete mykey\r\n", false},
+		{"incr mykey 10 noreply\r\n", true},
+		{"touch mykey 10 noreply\r\n", true},
+		{"touch mykey 10\r\n", false},
+		{"verbosity 1 noreply\r\n", true},
+		{"get noreply\r\n", false},
+	}
+	for _, tt := range ts {
+		conn := libcon.NewConn(mockconn.CreateConn([]byte(tt.Data), 1), time.Second, time.Second)
+		p := NewProxyConn(conn)
+		msgs, err := p.Decode(proto.GetMsgs(1))
+		assert.NoError(t, err, tt.Data)
+		assert.Equal(t, tt.Noreply, msgs[0].Request().(*MCRequest).noreply, tt.Data)
+	}
+}
+
+func TestProxyConnEncodeNoreplyAndVerbosity(t *testing.T) {
+	ts := []struct {
+		Req    string
+		Except string
+	}{
+		{"touch mykey 10 noreply\r\n", ""},
+		{"verbosity 1 noreply\r\n", ""},
+		{"verbosity 1\r\n", "OK\r\n"},
+	}
+	for _, tt := range ts {
+		conn := libcon.NewConn(mockconn.CreateConn(nil, 1), time.Second, time.Second)
+		p := NewProxyConn(conn)
+		msg := _createRespMsg(t, []byte(tt.Req), [][]byte{nil})
+		assert.NoError(t, p.Encode(msg))
+		assert.NoError(t, p.Flush())
+		c := conn.Conn.(*mockconn.MockConn)
+		assert.Equal(t, tt.Except, c.Wbuf.String(), tt.Req)
+	}
+}
+
+func TestProxyConnDecodeLimitSize(t *testing.T) {
+	value := strings.Repeat("a", 4096)
+	data := "set a 0 0 4096\r\n" + value + "\r\nget kkkkkkkk\r\nms b 4096\r\n" + value + "\r\nget a b\r\n"
+	conn := libcon.NewConn(mockconn.CreateConn([]byte(data), 1), time.Second, time.Second)
+	p := NewProxyConn(conn)
+	p.(proto.SizeLimiter).LimitSize(4, 1024)
+
+	var errs []error
+	for len(errs) < 4 {
+		msgs, err := p.Decode(proto.GetMsgs(4))
+		assert.NoError(t, err)
+		for _, msg := range msgs {
+			errs = append(errs, msg.Err())
+		}
+	}
+	assert.Equal(t, []error{ErrValueTooLarge, ErrKeyTooLong, ErrValueTooLarge, nil}, errs)
+	assert.True(t, p.(*proxyConn).br.Size() < 4096)
+
+	msg := proto.NewMessage()
+	msg.WithError(ErrValueTooLarge)
+	assert.NoError(t, p.Encode(msg))
+	assert.NoError(t, p.Flush())
+	c := conn.Conn.(*mockconn.MockConn)
+	assert.Equal(t, "SERVER_ERROR object too large for cache\r\n", c.Wbuf.String())
+}
@@ -0,0 +1,420 @@
+package memcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	errs "errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"overlord/pkg/bufio"
+	"overlord/pkg/log"
+	libnet "overlord/pkg/net"
+	"overlord/proxy/mcstat"
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/redis"
+
+	"github.com/pkg/errors"
+)
+
+// The strategies to keep the flags of memcache values in redis.
+const (
+	// FlagsNone drops the flags, the values are stored as is and replied
+	// with flags 0, so that they are shared with redis clients.
+	FlagsNone = "none"
+	// FlagsPrefix stores the flags as 4 bytes big endian before the value.
+	FlagsPrefix = "prefix"
+)
+
+// the translation of memcache text protocol into redis:
+//
+//	get|gets <key>          GET <key>, MGET <key>* if merged
+//	set <key>               SET <key> <value> [EX <exptime>]
+//	add|replace <key>       SET <key> <value> NX|XX [EX <exptime>]
+//	delete <key>            DEL <key>
+//	incr|decr <key> <delta> INCRBY|DECRBY <key> <delta>
+//	touch <key> <exptime>   EXPIRE <key> <exptime>, PERSIST if exptime is 0
+//
+// The cas unique of gets is always 0. Storing an expired value deletes the
+// key instead. The other commands are replied with SERVER_ERROR.
+var (
+	redisGetBytes     = []byte("GET")
+	redisMGetBytes    = []byte("MGET")
+	redisSetBytes     = []byte("SET")
+	redisDelBytes     = []byte("DEL")
+	redisIncrByBytes  = []byte("INCRBY")
+	redisDecrByBytes  = []byte("DECRBY")
+	redisExpireBytes  = []byte("EXPIRE")
+	redisEvalBytes    = []byte("EVAL")
+	redisNXBytes      = []byte("NX")
+	redisXXBytes      = []byte("XX")
+	redisEXBytes      = []byte("EX")
+	redisOneKeyBytes  = []byte("1")
+	redisPersistBytes = []byte("if redis.call('EXISTS',KEYS[1])==1 then redis.call('PERSIST',KEYS[1]) return 1 end return 0")
+
+	deletedBytes = []byte("DELETED\r\n")
+	casZeroBytes = []byte(" 0")
+)
+
+// errors
+var (
+	ErrRedisUnsupported = errs.New("command not supported by redis backend")
+	ErrBadCommandLine   = errs.New("CLIENT_ERROR bad command line format")
+	ErrNonNumeric       = errs.New("CLIENT_ERROR cannot increment or decrement non-numeric value")
+)
+
+// ValidFlags reports whether s is one of the flags strategies, empty is
+// FlagsNone.
+func ValidFlags(s string) bool {
+	return s == "" || s == FlagsNone || s == FlagsPrefix
+}
+
+type redisNodeConn struct {
+	cluster string
+	addr    string
+	prefix  bool
+
+	conn  *libnet.Conn
+	bw    *bufio.Writer
+	br    *bufio.Reader
+	reply *redis.RESP
+
+	state int32
+}
+
+// NewRedisNodeConn returns the node conn which translates the memcache
+// requests into redis commands and the replies back, the flags of values
+// are kept by the strategy flags.
+func NewRedisNodeConn(cluster, addr, auth string, db int, flags string, dialTimeout, readTimeout, writeTimeout time.Duration) proto.NodeConn {
+	conn := libnet.DialWithTimeout(addr, dialTimeout, readTimeout, writeTimeout)
+	if err := redis.Prepare(conn, auth, db); err != nil {
+		log.Errorf("cluster(%s) fail to prepare redis node(%s) error:%v", cluster, addr, err)
+		_ = conn.Close()
+	}
+	return newRedisNodeConn(cluster, addr, flags, conn)
+}
+
+func newRedisNodeConn(cluster, addr, flags string, conn *libnet.Conn) *redisNodeConn {
+	return &redisNodeConn{
+		cluster: cluster,
+		addr:    addr,
+		prefix:  flags == FlagsPrefix,
+		conn:    conn,
+		bw:      bufio.NewWriter(conn),
+		br:      bufio.NewReader(conn, bufio.Get(nodeReadBufSize)),
+		reply:   &redis.RESP{},
+	}
+}
+
+func (n *redisNodeConn) Addr() string {
+	return n.addr
+}
+
+func (n *redisNodeConn) Cluster() string {
+	return n.cluster
+}
+
+func (n *redisNodeConn) Write(m *proto.Message) (err error) {
+	if n.Closed() {
+		err = errors.WithStack(ErrClosed)
+		return
+	}
+	mcr, ok := m.Request().(*MCRequest)
+	if !ok {
+		err = errors.WithStack(ErrAssertReq)
+		return
+	}
+	if mcr.IsLocal() {
+		return
+	}
+	args, terr := n.translate(mcr)
+	if terr != nil {
+		// NOTE: replied by Read without sending
+		return
+	}
+	_ = n.bw.Write([]byte("*" + strconv.Itoa(len(args)) + "\r\n"))
+	for _, arg := range args {
+		_ = n.bw.Write([]byte("$" + strconv.Itoa(len(arg)) + "\r\n"))
+		_ = n.bw.Write(arg)
+		err = n.bw.Write(crlfBytes)
+	}
+	return
+}
+
+func (n *redisNodeConn) Flush() error {
+	if n.Closed() {
+		return errors.WithStack(ErrClosed)
+	}
+	return n.bw.Flush()
+}
+
+func (n *redisNodeConn) Read(m *proto.Message) (err error) {
+	if n.Closed() {
+		err = errors.WithStack(ErrClosed)
+		return
+	}
+	mcr, ok := m.Request().(*MCRequest)
+	if !ok {
+		err = errors.WithStack(ErrAssertReq)
+		return
+	}
+	if mcr.IsLocal() {
+		return
+	}
+	if _, terr := n.translate(mcr); terr != nil {
+		mcr.data = mcr.data[:0]
+		if terr == ErrRedisUnsupported {
+			mcr.data = append(mcr.data, serverErrorBytes...)
+		}
+		mcr.data = append(mcr.data, terr.Error()...)
+		mcr.data = append(mcr.data, crlfBytes...)
+		return
+	}
+	for {
+		if err = n.reply.Decode(n.br); err == bufio.ErrBufferFull {
+			if err = n.br.Read(); err != nil {
+				err = errors.WithStack(err)
+				return
+			}
+			continue
+		} else if err != nil {
+			err = errors.WithStack(err)
+			return
+		}
+		break
+	}
+	if len(mcr.subs) > 0 {
+		n.replyMerged(mcr)
+		return
+	}
+	n.replyOne(mcr, n.reply)
+	return
+}
+
+// translate returns the redis command of mcr, the error is replied to
+// client if mcr can't be translated.
+func (n *redisNodeConn) translate(mcr *MCRequest) (args [][]byte, err error) {
+	switch mcr.respType {
+	case RequestTypeGet, RequestTypeGets:
+		if len(mcr.subs) == 0 {
+			return [][]byte{redisGetBytes, mcr.key}, nil
+		}
+		args = append(args, redisMGetBytes, mcr.key)
+		for _, sub := range mcr.subs {
+			args = append(args, sub.key)
+		}
+		return
+	case RequestTypeSet, RequestTypeSetNoreply, RequestTypeAdd, RequestTypeReplace:
+		return n.translateStorage(mcr)
+	case RequestTypeDelete:
+		return [][]byte{redisDelBytes, mcr.key}, nil
+	case RequestTypeIncr, RequestTypeDecr:
+		b, e := nextField(mcr.data)
+		delta := mcr.data[b:e]
+		if _, perr := strconv.ParseUint(string(delta), 10, 64); perr != nil {
+			return nil, ErrNonNumeric
+		}
+		if mcr.respType == RequestTypeIncr {
+			return [][]byte{redisIncrByBytes, mcr.key, delta}, nil
+		}
+		return [][]byte{redisDecrByBytes, mcr.key, delta}, nil
+	case RequestTypeTouch:
+		b, e := nextField(mcr.data)
+		exptime, perr := strconv.ParseInt(string(mcr.data[b:e]), 10, 64)
+		if perr != nil {
+			return nil, ErrBadCommandLine
+		}
+		sec, expired := redisExptime(exptime)
+		if expired {
+			return [][]byte{redisDelBytes, mcr.key}, nil
+		}
+		if sec == 0 {
+			return [][]byte{redisEvalBytes, redisPersistBytes, redisOneKeyBytes, mcr.key}, nil
+		}
+		return [][]byte{redisExpireBytes, mcr.key, strconv.AppendInt(nil, sec, 10)}, nil
+	}
+	return nil, ErrRedisUnsupported
+}
+
+// translateStorage translates set, add and replace whose data is
+// " <flags> <exptime> <bytes> [noreply]\r\n<value>\r\n".
+func (n *redisNodeConn) translateStorage(mcr *MCRequest) (args [][]byte, err error) {
+	idx := bytes.Index(mcr.data, crlfBytes)
+	if idx < 0 {
+		return nil, ErrBadCommandLine
+	}
+	fields := bytes.Fields(mcr.data[:idx])
+	if len(fields) < 3 {
+		return nil, ErrBadCommandLine
+	}
+	flags, ferr := strconv.ParseUint(string(fields[0]), 10, 32)
+	exptime, eerr := strconv.ParseInt(string(fields[1]), 10, 64)
+	length, lerr := strconv.Atoi(string(fields[2]))
+	if ferr != nil || eerr != nil || lerr != nil || idx+2+length > len(mcr.data) {
+		return nil, ErrBadCommandLine
+	}
+	sec, expired := redisExptime(exptime)
+	if expired {
+		return [][]byte{redisDelBytes, mcr.key}, nil
+	}
+	value := mcr.data[idx+2 : idx+2+length]
+	if n.prefix {
+		pv := make([]byte, 4+len(value))
+		binary.BigEndian.PutUint32(pv, uint32(flags))
+		copy(pv[4:], value)
+		value = pv
+	}
+	args = [][]byte{redisSetBytes, mcr.key, value}
+	switch mcr.respType {
+	case RequestTypeAdd:
+		args = append(args, redisNXBytes)
+	case RequestTypeReplace:
+		args = append(args, redisXXBytes)
+	}
+	if sec > 0 {
+		args = append(args, redisEXBytes, strconv.AppendInt(nil, sec, 10))
+	}
+	return
+}
+
+// redisExptime converts the exptime of memcache into the seconds to live,
+// zero means never expired. The exptime larger than 30 days is unix time.
+func redisExptime(exptime int64) (sec int64, expired bool) {
+	if exptime < 0 {
+		return 0, true
+	}
+	if exptime > maxRelativeExptime {
+		if exptime -= time.Now().Unix(); exptime <= 0 {
+			return 0, true
+		}
+	}
+	return exptime, false
+}
+
+// replyOne fills the memcache reply of mcr by the redis reply r.
+func (n *redisNodeConn) replyOne(mcr *MCRequest, r *redis.RESP) {
+	mcr.data = mcr.data[:0]
+	if r.Type() == '-' {
+		if mcr.respType == RequestTypeIncr || mcr.respType == RequestTypeDecr {
+			mcr.data = append(mcr.data, ErrNonNumeric.Error()...)
+		} else {
+			mcr.data = append(mcr.data, serverErrorBytes...)
+			mcr.data = append(mcr.data, r.Data()...)
+		}
+		mcr.data = append(mcr.data, crlfBytes...)
+		return
+	}
+	switch mcr.respType {
+	case RequestTypeGet, RequestTypeGets:
+		if value, ok := bulkValue(r); ok {
+			n.appendValue(mcr, value)
+		}
+		mcr.data = append(mcr.data, endBytes...)
+	case RequestTypeSet, RequestTypeSetNoreply, RequestTypeAdd, RequestTypeReplace:
+		// NOTE: the expired value is deleted and replied as stored
+		if _, ok := bulkValue(r); r.Type() == '$' && !ok {
+			mcr.data = append(mcr.data, notStoredBytes...)
+		} else {
+			mcr.data = append(mcr.data, storedBytes...)
+		}
+	case RequestTypeDelete:
+		if isZero(r) {
+			mcr.data = append(mcr.data, notFoundBytes...)
+		} else {
+			mcr.data = append(mcr.data, deletedBytes...)
+		}
+	case RequestTypeIncr, RequestTypeDecr:
+		mcr.data = append(mcr.data, r.Data()...)
+		mcr.data = append(mcr.data, crlfBytes...)
+	case RequestTypeTouch:
+		if isZero(r) {
+			mcr.data = append(mcr.data, notFoundBytes...)
+		} else {
+			mcr.data = append(mcr.data, touchedBytes...)
+		}
+	}
+}
+
+// replyMerged fills the replies of merged gets by the array of MGET in
+// order, every request ends with END as if it's sent alone.
+func (n *redisNodeConn) replyMerged(mcr *MCRequest) {
+	reqs := append([]*MCRequest{mcr}, mcr.subs...)
+	if n.reply.Type() != '*' {
+		for _, r := range reqs {
+			n.replyOne(r, n.reply)
+		}
+		return
+	}
+	values := n.reply.Array()
+	for i, r := range reqs {
+		r.data = r.data[:0]
+		if i < len(values) {
+			if value, ok := bulkValue(values[i]); ok {
+				n.appendValue(r, value)
+			}
+		}
+		r.data = append(r.data, endBytes...)
+	}
+	for _, r := range mcr.subs {
+		// NOTE: the merged request is recorded by pipe
+		if s, ok := r.Stat(); ok {
+			mcstat.Incr(n.cluster, n.addr, s)
+		}
+	}
+}
+
+// appendValue appends "VALUE <key> <flags> <bytes> [<cas unique>]\r\n<data>\r\n"
+// into the reply of mcr.
+func (n *redisNodeConn) appendValue(mcr *MCRequest, value []byte) {
+	var flags uint32
+	if n.prefix && len(value) >= 4 {
+		flags = binary.BigEndian.Uint32(value)
+		value = value[4:]
+	}
+	mcr.data = append(mcr.data, valueBytes...)
+	mcr.data = append(mcr.data, mcr.key...)
+	mcr.data = append(mcr.data, spaceByte)
+	mcr.data = strconv.AppendUint(mcr.data, uint64(flags), 10)
+	mcr.data = append(mcr.data, spaceByte)
+	mcr.data = strconv.AppendInt(mcr.data, int64(len(value)), 10)
+	if mcr.respType == RequestTypeGets {
+		mcr.data = append(mcr.data, casZeroBytes...)
+	}
+	mcr.data = append(mcr.data, crlfBytes...)
+	mcr.data = append(mcr.data, value...)
+	mcr.data = append(mcr.data, crlfBytes...)
+}
+
+// bulkValue returns the value of bulk string r, ok is false if r is null.
+func bulkValue(r *redis.RESP) (value []byte, ok bool) {
+	if r.Type() != '$' {
+		return
+	}
+	data := r.Data()
+	idx := bytes.Index(data, crlfBytes)
+	if idx < 0 {
+		return
+	}
+	return data[idx+2:], true
+}
+
+func isZero(r *redis.RESP) bool {
+	return r.Type() == ':' && bytes.Equal(r.Data(), zeroBytes)
+}
+
+// SetReadTimeout impl proto.ReadTimeouter.
+func (n *redisNodeConn) SetReadTimeout(timeout time.Duration) {
+	n.conn.SetReadTimeout(timeout)
+}
+
+func (n *redisNodeConn) Close() error {
+	if atomic.CompareAndSwapInt32(&n.state, opened, closed) {
+		return n.conn.Close()
+	}
+	return nil
+}
+
+func (n *redisNodeConn) Closed() bool {
+	return atomic.LoadInt32(&n.state) == closed
+}
@@ -0,0 +1,103 @@
+package memcache
+
+import (
+	"testing"
+	"time"
+
+	"overlord/pkg/mockconn"
+	libnet "overlord/pkg/net"
+	"overlord/proxy/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func _createRedisNodeConn(data []byte, flags string) *redisNodeConn {
+	conn := libnet.NewConn(mockconn.CreateConn(data, 1), time.Second, time.Second)
+	return newRedisNodeConn("clusterA", "127.0.0.1:6379", flags, conn)
+}
+
+func TestRedisNodeConnWrite(t *testing.T) {
+	ts := []struct {
+		name   string
+		rtype  RequestType
+		key    string
+		data   string
+		except string
+	}{
+		{name: "get", rtype: RequestTypeGet, key: "a", data: "\r\n", except: "*2\r\n$3\r\nGET\r\n$1\r\na\r\n"},
+		{name: "set", rtype: RequestTypeSet, key: "a", data: " 0 0 2\r\nab\r\n", except: "*3\r\n$3\r\nSET\r\n$1\r\na\r\n$2\r\nab\r\n"},
+		{name: "add", rtype: RequestTypeAdd, key: "a", data: " 0 10 2\r\nab\r\n", except: "*6\r\n$3\r\nSET\r\n$1\r\na\r\n$2\r\nab\r\n$2\r\nNX\r\n$2\r\nEX\r\n$2\r\n10\r\n"},
+		{name: "set expired", rtype: RequestTypeSet, key: "a", data: " 0 -1 2\r\nab\r\n", except: "*2\r\n$3\r\nDEL\r\n$1\r\na\r\n"},
+		{name: "delete", rtype: RequestTypeDelete, key: "a", data: "\r\n", except: "*2\r\n$3\r\nDEL\r\n$1\r\na\r\n"},
+		{name: "decr", rtype: RequestTypeDecr, key: "a", data: " 5\r\n", except: "*3\r\n$6\r\nDECRBY\r\n$1\r\na\r\n$1\r\n5\r\n"},
+		{name: "touch", rtype: RequestTypeTouch, key: "a", data: " 10\r\n", except: "*3\r\n$6\r\nEXPIRE\r\n$1\r\na\r\n$2\r\n10\r\n"},
+		{name: "append", rtype: RequestTypeAppend, key: "a", data: " 0 0 2\r\nab\r\n", except: ""},
+	}
+	for _, tt := range ts {
+		t.Run(tt.name, func(t *testing.T) {
+			nc := _createRedisNodeConn(nil, FlagsNone)
+			assert.NoError(t, nc.Write(_createReqMsg(tt.rtype, []byte(tt.key), []byte(tt.data))))
+			assert.NoError(t, nc.Flush())
+			m := nc.conn.Conn.(*mockconn.MockConn)
+			assert.Equal(t, tt.except, m.Wbuf.String())
+		})
+	}
+}
+
+func TestRedisNodeConnRead(t *testing.T) {
+	ts := []struct {
+		name   string
+		rtype  RequestType
+		data   string
+		reply  string
+		except string
+	}{
+		{name: "get hit", rtype: RequestTypeGet, data: "\r\n", reply: "$2\r\nab\r\n", except: "VALUE a 0 2\r\nab\r\nEND\r\n"},
+		{name: "get miss", rtype: RequestTypeGet, data: "\r\n", reply: "$-1\r\n", except: "END\r\n"},
+		{name: "gets hit", rtype: RequestTypeGets, data: "\r\n", reply: "$2\r\nab\r\n", except: "VALUE a 0 2 0\r\nab\r\nEND\r\n"},
+		{name: "set", rtype: RequestTypeSet, data: " 0 0 2\r\nab\r\n", reply: "+OK\r\n", except: "STORED\r\n"},
+		{name: "add exists", rtype: RequestTypeAdd, data: " 0 0 2\r\nab\r\n", reply: "$-1\r\n", except: "NOT_STORED\r\n"},
+		{name: "delete", rtype: RequestTypeDelete, data: "\r\n", reply: ":1\r\n", except: "DELETED\r\n"},
+		{name: "delete miss", rtype: RequestTypeDelete, data: "\r\n", reply: ":0\r\n", except: "NOT_FOUND\r\n"},
+		{name: "incr", rtype: RequestTypeIncr, data: " 2\r\n", reply: ":12\r\n", except: "12\r\n"},
+		{name: "incr non-numeric", rtype: RequestTypeIncr, data: " 2\r\n", reply: "-ERR value is not an integer or out of range\r\n", except: "CLIENT_ERROR cannot increment or decrement non-numeric value\r\n"},
+		{name: "touch miss", rtype: RequestTypeTouch, data: " 10\r\n", reply: ":0\r\n", except: "NOT_FOUND\r\n"},
+		{name: "cas", rtype: RequestTypeCas, data: " 0 0 2 1\r\nab\r\n", except: "SERVER_ERROR command not supported by redis backend\r\n"},
+	}
+	for _, tt := range ts {
+		t.Run(tt.name, func(t *testing.T) {
+			nc := _createRedisNodeConn([]byte(tt.reply), FlagsNone)
+			msg := _createReqMsg(tt.rtype, []byte("a"), []byte(tt.data))
+			assert.NoError(t, nc.Read(msg))
+			assert.Equal(t, tt.except, string(msg.Request().(*MCRequest).data))
+		})
+	}
+}
+
+func TestRedisNodeConnFlagsPrefix(t *testing.T) {
+	nc := _createRedisNodeConn([]byte("$4\r\n\x00\x00\x00\x07\r\n"), FlagsPrefix)
+	set := _createReqMsg(RequestTypeSet, []byte("a"), []byte(" 3 0 2\r\nab\r\n"))
+	assert.NoError(t, nc.Write(set))
+	assert.NoError(t, nc.Flush())
+	m := nc.conn.Conn.(*mockconn.MockConn)
+	assert.Equal(t, "*3\r\n$3\r\nSET\r\n$1\r\na\r\n$6\r\n\x00\x00\x00\x03ab\r\n", m.Wbuf.String())
+
+	get := _createReqMsg(RequestTypeGet, []byte("a"), []byte("\r\n"))
+	assert.NoError(t, nc.Read(get))
+	assert.Equal(t, "VALUE a 7 0\r\n\r\nEND\r\n", string(get.Request().(*MCRequest).data))
+}
+
+func TestRedisNodeConnReadMerged(t *testing.T) {
+	nc := _createRedisNodeConn([]byte("*2\r\n$2\r\nva\r\n$-1\r\n"), FlagsNone)
+	a := &MCRequest{respType: RequestTypeGet, key: []byte("a"), data: []byte("\r\n")}
+	b := &MCRequest{respType: RequestTypeGet, key: []byte("b"), data: []byte("\r\n")}
+	assert.NoError(t, a.Merge([]proto.Request{b}))
+	msg := proto.NewMessage()
+	msg.WithRequest(a)
+	assert.NoError(t, nc.Write(msg))
+	assert.NoError(t, nc.Flush())
+	assert.Equal(t, "*3\r\n$4\r\nMGET\r\n$1\r\na\r\n$1\r\nb\r\n", nc.conn.Conn.(*mockconn.MockConn).Wbuf.String())
+	assert.NoError(t, nc.Read(msg))
+	assert.Equal(t, "VALUE a 0 2\r\nva\r\nEND\r\n", string(a.data))
+	assert.Equal(t, "END\r\n", string(b.data))
+}
@@ -1,9 +1,11 @@
 package memcache
 
 import (
+	"bytes"
 	errs "errors"
 	"fmt"
 	"overlord/pkg/types"
+	"overlord/proxy/mcstat"
 	"overlord/proxy/proto"
 	"sync"
 )
@@ -19,6 +21,7 @@ var (
 	crlfBytes    = []byte("\r\n")
 	noreplyBytes = []byte("noreply")
 	endBytes     = []byte("END\r\n")
+	valueBytes   = []byte("VALUE ")
 	errorBytes   = []byte("ERROR\r\n")
 
 	setBytes        = []byte("set")
@@ -38,13 +41,14 @@ var (
 	quitBytes       = []byte("quit")
 	setNoreplyBytes = []byte("set")
 	versionBytes    = []byte("version")
+	statsBytes      = []byte("stats")
+	verbosityBytes  = []byte("verbosity")
 	unknownBytes    = []byte("unknown")
-	// storedBytes = []byte("STORED\r\n")
-	// notStoredBytes = []byte("NOT_STORED\r\n")
-	// existsBytes    = []byte("EXISTS\r\n")
-	// notFoundBytes  = []byte("NOT_FOUND\r\n")
-	// deletedBytes   = []byte("DELETED\r\n")
-	// touchedBytes   = []byte("TOUCHED\r\n")
+	storedBytes     = []byte("STORED\r\n")
+	notStoredBytes  = []byte("NOT_STORED\r\n")
+	existsBytes     = []byte("EXISTS\r\n")
+	notFoundBytes   = []byte("NOT_FOUND\r\n")
+	touchedBytes    = []byte("TOUCHED\r\n")
 )
 
 const (
@@ -64,6 +68,8 @@ const (
 	gatsString       = "gats"
 	quitString       = "quit"
 	versionString    = "version"
+	statsString      = "stats"
+	verbosityString  = "verbosity"
 	setNoreplyString = "set"
 	unknownString    = "unknown"
 )
@@ -107,6 +113,20 @@ func (rt RequestType) String() string {
 		return setNoreplyString
 	case RequestTypeVersion:
 		return versionString
+	case RequestTypeStats:
+		return statsString
+	case RequestTypeVerbosity:
+		return verbosityString
+	case RequestTypeMetaGet:
+		return mgString
+	case RequestTypeMetaSet:
+		return msString
+	case RequestTypeMetaDelete:
+		return mdString
+	case RequestTypeMetaArithmetic:
+		return maString
+	case RequestTypeMetaNoop:
+		return mnString
 	}
 	return unknownString
 }
@@ -148,6 +168,20 @@ func (rt RequestType) Bytes() []byte {
 		return setNoreplyBytes
 	case RequestTypeVersion:
 		return versionBytes
+	case RequestTypeStats:
+		return statsBytes
+	case RequestTypeVerbosity:
+		return verbosityBytes
+	case RequestTypeMetaGet:
+		return mgBytes
+	case RequestTypeMetaSet:
+		return msBytes
+	case RequestTypeMetaDelete:
+		return mdBytes
+	case RequestTypeMetaArithmetic:
+		return maBytes
+	case RequestTypeMetaNoop:
+		return mnBytes
 	}
 
 	return unknownBytes
@@ -173,6 +207,13 @@ const (
 	RequestTypeQuit
 	RequestTypeSetNoreply
 	RequestTypeVersion
+	RequestTypeStats
+	RequestTypeVerbosity
+	RequestTypeMetaGet
+	RequestTypeMetaSet
+	RequestTypeMetaDelete
+	RequestTypeMetaArithmetic
+	RequestTypeMetaNoop
 )
 
 var (
@@ -211,6 +252,11 @@ var (
 	ErrPingerPong  = errs.New("SERVER_ERROR Pinger pong unexpected")
 	ErrAssertReq   = errs.New("SERVER_ERROR assert request not ok")
 	ErrBadResponse = errs.New("SERVER_ERROR bad response")
+
+	// NOTE: replied with SERVER_ERROR prefix as memcached when the request
+	// exceeds the size limits of cluster.
+	ErrKeyTooLong    = errs.New("key too long")
+	ErrValueTooLarge = errs.New("object too large for cache")
 )
 
 // MCRequest is the mc client Msg type and data.
@@ -231,6 +277,15 @@ type MCRequest struct {
 	respType RequestType
 	key      []byte
 	data     []byte
+	// size is the bytes of key and data decoded, the data is replaced by
+	// the reply after read.
+	size int
+	// noreply is true if the node never replies.
+	noreply bool
+	// quiet is true if the meta command has q flag.
+	quiet bool
+	// subs are the retrievals of other keys merged into one command.
+	subs []*MCRequest
 }
 
 var msgPool = &sync.Pool{
@@ -254,6 +309,10 @@ func (r *MCRequest) Put() {
 	r.respType = RequestTypeUnknown
 	r.key = r.key[:0]
 	r.data = r.data[:0]
+	r.size = 0
+	r.noreply = false
+	r.quiet = false
+	r.subs = r.subs[:0]
 	msgPool.Put(r)
 }
 
@@ -272,7 +331,133 @@ func (r *MCRequest) Key() []byte {
 	return r.key
 }
 
-func (r *MCRequest) Merge([]proto.Request) (err error) {
+// IsRead returns whether or not get/gets/mg.
+func (r *MCRequest) IsRead() bool {
+	return r.respType == RequestTypeGet || r.respType == RequestTypeGets || r.respType == RequestTypeMetaGet
+}
+
+// IsStats returns whether or not stats which is sent to all nodes.
+func (r *MCRequest) IsStats() bool {
+	return r.respType == RequestTypeStats
+}
+
+// IsLocal impl proto.Localer, quit, version, verbosity and mn are answered
+// by proxy itself.
+func (r *MCRequest) IsLocal() bool {
+	switch r.respType {
+	case RequestTypeQuit, RequestTypeVersion, RequestTypeVerbosity, RequestTypeMetaNoop:
+		return true
+	}
+	return false
+}
+
+// IsWrite returns whether or not the command changes value, gat/gats
+// changes the expiration of key so they are writes too.
+func (r *MCRequest) IsWrite() bool {
+	switch r.respType {
+	case RequestTypeSet, RequestTypeAdd, RequestTypeReplace, RequestTypeAppend, RequestTypePrepend,
+		RequestTypeCas, RequestTypeDelete, RequestTypeIncr, RequestTypeDecr, RequestTypeTouch,
+		RequestTypeGat, RequestTypeGats, RequestTypeSetNoreply,
+		RequestTypeMetaSet, RequestTypeMetaDelete, RequestTypeMetaArithmetic:
+		return true
+	}
+	return false
+}
+
+// Clone impl proto.Hedger.
+func (r *MCRequest) Clone() proto.Request {
+	c := GetReq()
+	c.respType = r.respType
+	c.key = append(c.key[:0], r.key...)
+	c.data = append(c.data[:0], r.data...)
+	c.noreply = r.noreply
+	c.quiet = r.quiet
+	return c
+}
+
+// CopyReply impl proto.Hedger.
+func (r *MCRequest) CopyReply(o proto.Request) {
+	if or, ok := o.(*MCRequest); ok {
+		r.data = append(r.data[:0], or.data...)
+	}
+}
+
+// Hits impl proto.Hitter, the reply of get starts with VALUE if hit and
+// only END if missed.
+func (r *MCRequest) Hits() (hits, misses int) {
+	if r.respType == RequestTypeMetaGet {
+		if s, ok := r.metaStat(); ok && s == mcstat.GetHits {
+			hits = 1
+		} else if ok {
+			misses = 1
+		}
+		return
+	}
+	if _, ok := withValueTypes[r.respType]; !ok {
+		return
+	}
+	if bytes.HasPrefix(r.data, valueBytes) {
+		hits = 1
+	} else if bytes.Equal(r.data, endBytes) {
+		misses = 1
+	}
+	return
+}
+
+// Stat impl mcstat.Stater by the reply line.
+func (r *MCRequest) Stat() (s mcstat.Stat, ok bool) {
+	if isMeta(r.respType) {
+		return r.metaStat()
+	}
+	switch r.respType {
+	case RequestTypeGet, RequestTypeGets, RequestTypeGat, RequestTypeGats:
+		if hits, misses := r.Hits(); hits > 0 {
+			return mcstat.GetHits, true
+		} else if misses > 0 {
+			return mcstat.GetMisses, true
+		}
+	case RequestTypeSet, RequestTypeAdd, RequestTypeReplace, RequestTypeAppend, RequestTypePrepend:
+		if bytes.Equal(r.data, storedBytes) {
+			return mcstat.Stored, true
+		} else if bytes.Equal(r.data, notStoredBytes) {
+			return mcstat.NotStored, true
+		}
+	case RequestTypeCas:
+		switch {
+		case bytes.Equal(r.data, storedBytes):
+			return mcstat.CasHits, true
+		case bytes.Equal(r.data, existsBytes):
+			return mcstat.CasBadval, true
+		case bytes.Equal(r.data, notFoundBytes):
+			return mcstat.CasMisses, true
+		}
+	case RequestTypeTouch:
+		if bytes.Equal(r.data, touchedBytes) {
+			return mcstat.TouchHits, true
+		} else if bytes.Equal(r.data, notFoundBytes) {
+			return mcstat.TouchMisses, true
+		}
+	}
+	return
+}
+
+// Size impl proto.Sizer.
+func (r *MCRequest) Size() (req, reply int) {
+	return r.size, len(r.data)
+}
+
+// Merge merges the retrievals of same node into one command such as
+// get <key>*, the others are ignored.
+func (r *MCRequest) Merge(reqs []proto.Request) (err error) {
+	r.subs = r.subs[:0]
+	if _, ok := withValueTypes[r.respType]; !ok {
+		return
+	}
+	for _, req := range reqs {
+		if mcr, ok := req.(*MCRequest); ok && mcr.respType == r.respType {
+			r.subs = append(r.subs, mcr)
+		}
+	}
 	return
 }
 
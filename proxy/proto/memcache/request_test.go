@@ -4,6 +4,8 @@ import (
 	"regexp"
 	"testing"
 
+	"overlord/proxy/mcstat"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -49,3 +51,46 @@ func TestMCRequestFuncsOk(t *testing.T) {
 	assert.Equal(t, []byte{}, req.key)
 	assert.Equal(t, []byte{}, req.data)
 }
+
+func TestMCRequestHits(t *testing.T) {
+	req := &MCRequest{respType: RequestTypeGet, data: []byte("VALUE a 0 1\r\n1\r\nEND\r\n")}
+	hits, misses := req.Hits()
+	assert.Equal(t, 1, hits)
+	assert.Equal(t, 0, misses)
+
+	req.data = endBytes
+	hits, misses = req.Hits()
+	assert.Equal(t, 0, hits)
+	assert.Equal(t, 1, misses)
+
+	req = &MCRequest{respType: RequestTypeSet, data: []byte("STORED\r\n")}
+	hits, misses = req.Hits()
+	assert.Equal(t, 0, hits+misses)
+}
+
+func TestMCRequestStat(t *testing.T) {
+	for _, c := range []struct {
+		typ  RequestType
+		data string
+		st   mcstat.Stat
+		ok   bool
+	}{
+		{RequestTypeGets, "VALUE a 0 1 1\r\n1\r\nEND\r\n", mcstat.GetHits, true},
+		{RequestTypeGat, "END\r\n", mcstat.GetMisses, true},
+		{RequestTypeSet, "STORED\r\n", mcstat.Stored, true},
+		{RequestTypeAdd, "NOT_STORED\r\n", mcstat.NotStored, true},
+		{RequestTypeCas, "STORED\r\n", mcstat.CasHits, true},
+		{RequestTypeCas, "EXISTS\r\n", mcstat.CasBadval, true},
+		{RequestTypeCas, "NOT_FOUND\r\n", mcstat.CasMisses, true},
+		{RequestTypeTouch, "TOUCHED\r\n", mcstat.TouchHits, true},
+		{RequestTypeSet, "SERVER_ERROR out of memory\r\n", 0, false},
+		{RequestTypeDelete, "DELETED\r\n", 0, false},
+	} {
+		req := &MCRequest{respType: c.typ, data: []byte(c.data)}
+		st, ok := req.Stat()
+		assert.Equal(t, c.ok, ok, c.data)
+		if ok {
+			assert.Equal(t, c.st, st, c.data)
+		}
+	}
+}
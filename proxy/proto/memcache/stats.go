@@ -0,0 +1,111 @@
+package memcache
+
+import (
+	"bytes"
+	"strconv"
+
+	"overlord/proxy/proto"
+)
+
+var (
+	statBytes = []byte("STAT ")
+	itemBytes = []byte("ITEM ")
+
+	// statsFirstFields are the stats of one node process which make no
+	// sense if summed, the value of the first node is kept.
+	statsFirstFields = map[string]struct{}{
+		"pid":             struct{}{},
+		"uptime":          struct{}{},
+		"time":            struct{}{},
+		"version":         struct{}{},
+		"libevent":        struct{}{},
+		"pointer_size":    struct{}{},
+		"threads":         struct{}{},
+		"max_connections": struct{}{},
+		"reserved_fds":    struct{}{},
+	}
+)
+
+// WithStatsReqs copies the stats request of m until n requests, one for
+// each node.
+func WithStatsReqs(m *proto.Message, n int) {
+	req, ok := m.Request().(*MCRequest)
+	if !ok {
+		return
+	}
+	for i := len(m.Requests()); i < n; i++ {
+		WithReq(m, RequestTypeStats, nil, req.data)
+	}
+}
+
+// mergeStats merges the stats replies of all nodes, the numeric fields are
+// summed in the order of the first node and the others are kept as the
+// first one. The reply without END such as RESET is returned as is.
+func mergeStats(reqs []proto.Request) []byte {
+	var (
+		names  []string
+		values = make(map[string][]byte)
+		others [][]byte
+	)
+	for _, req := range reqs {
+		mcr, ok := req.(*MCRequest)
+		if !ok {
+			continue
+		}
+		if !bytes.HasSuffix(mcr.data, endBytes) {
+			return mcr.data
+		}
+		for _, line := range bytes.SplitAfter(mcr.data[:len(mcr.data)-len(endBytes)], crlfBytes) {
+			if len(line) == 0 {
+				continue
+			}
+			if !bytes.HasPrefix(line, statBytes) {
+				others = append(others, line)
+				continue
+			}
+			field := bytes.TrimSuffix(line[len(statBytes):], crlfBytes)
+			var value []byte
+			if idx := bytes.IndexByte(field, spaceByte); idx != -1 {
+				field, value = field[:idx], field[idx+1:]
+			}
+			name := string(field)
+			old, ok := values[name]
+			if !ok {
+				names = append(names, name)
+				values[name] = append([]byte(nil), value...)
+				continue
+			}
+			if _, ok := statsFirstFields[name]; !ok {
+				values[name] = addStat(old, value)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	for _, name := range names {
+		buf.Write(statBytes)
+		buf.WriteString(name)
+		buf.WriteByte(spaceByte)
+		buf.Write(values[name])
+		buf.Write(crlfBytes)
+	}
+	for _, line := range others {
+		buf.Write(line)
+	}
+	buf.Write(endBytes)
+	return buf.Bytes()
+}
+
+// addStat sums a and b if both are numeric, or returns a.
+func addStat(a, b []byte) []byte {
+	if x, err := strconv.ParseUint(string(a), 10, 64); err == nil {
+		if y, err := strconv.ParseUint(string(b), 10, 64); err == nil {
+			return strconv.AppendUint(a[:0], x+y, 10)
+		}
+	}
+	if x, err := strconv.ParseFloat(string(a), 64); err == nil {
+		if y, err := strconv.ParseFloat(string(b), 64); err == nil {
+			return strconv.AppendFloat(a[:0], x+y, 'f', 6, 64)
+		}
+	}
+	return a
+}
@@ -0,0 +1,59 @@
+package memcache
+
+import (
+	"testing"
+	"time"
+
+	"overlord/pkg/mockconn"
+	libcon "overlord/pkg/net"
+	"overlord/proxy/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeStats(t *testing.T) {
+	reqs := []proto.Request{
+		&MCRequest{respType: RequestTypeStats, data: []byte("STAT pid 1\r\nSTAT version 1.6.9\r\nSTAT curr_items 2\r\nSTAT rusage_user 0.100000\r\nEND\r\n")},
+		&MCRequest{respType: RequestTypeStats, data: []byte("STAT pid 2\r\nSTAT version 1.6.9\r\nSTAT curr_items 3\r\nSTAT rusage_user 0.200000\r\nSTAT evictions 4\r\nEND\r\n")},
+	}
+	assert.Equal(t, "STAT pid 1\r\nSTAT version 1.6.9\r\nSTAT curr_items 5\r\nSTAT rusage_user 0.300000\r\nSTAT evictions 4\r\nEND\r\n", string(mergeStats(reqs)))
+
+	reqs = []proto.Request{
+		&MCRequest{respType: RequestTypeStats, data: []byte("ITEM a [1 b; 0 s]\r\nEND\r\n")},
+		&MCRequest{respType: RequestTypeStats, data: []byte("ITEM b [1 b; 0 s]\r\nEND\r\n")},
+	}
+	assert.Equal(t, "ITEM a [1 b; 0 s]\r\nITEM b [1 b; 0 s]\r\nEND\r\n", string(mergeStats(reqs)))
+
+	reqs = []proto.Request{
+		&MCRequest{respType: RequestTypeStats, data: []byte("RESET\r\n")},
+		&MCRequest{respType: RequestTypeStats, data: []byte("RESET\r\n")},
+	}
+	assert.Equal(t, "RESET\r\n", string(mergeStats(reqs)))
+}
+
+func TestProxyConnEncodeStats(t *testing.T) {
+	conn := libcon.NewConn(mockconn.CreateConn([]byte("stats\r\n"), 1), time.Second, time.Second)
+	p := NewProxyConn(conn)
+	msgs, err := p.Decode(proto.GetMsgs(1))
+	assert.NoError(t, err)
+	m := msgs[0]
+	assert.True(t, m.Request().(*MCRequest).IsStats())
+
+	WithStatsReqs(m, 3)
+	assert.True(t, m.IsBatch())
+	subs := m.Batch()
+	assert.Len(t, subs, 3)
+	for i, sub := range subs {
+		nc := _createNodeConn([]byte("STAT curr_connections " + string('1'+byte(i)) + "\r\nEND\r\n"))
+		assert.NoError(t, nc.Read(sub))
+	}
+
+	conn = libcon.NewConn(mockconn.CreateConn(nil, 1), time.Second, time.Second)
+	p = NewProxyConn(conn)
+	assert.NoError(t, p.Encode(m))
+	assert.NoError(t, p.Flush())
+	buf := make([]byte, 1024)
+	size, err := conn.Conn.(*mockconn.MockConn).Wbuf.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "STAT curr_connections 6\r\nEND\r\n", string(buf[:size]))
+}
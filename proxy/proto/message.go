@@ -5,6 +5,7 @@ import (
 	"sync"
 	"time"
 
+	"overlord/pkg/bufio"
 	"overlord/pkg/types"
 )
 
@@ -56,8 +57,11 @@ func getMsg() *Message {
 	return msgPool.Get().(*Message)
 }
 
-// putMsg put the msg into pool
+// putMsg put the msg into pool, the msg of arena is kept by arena.
 func putMsg(m *Message) {
+	if m.arena != nil {
+		return
+	}
 	msgPool.Put(m)
 }
 
@@ -74,6 +78,12 @@ type Message struct {
 	st, wt, rt, et, spt, ept, sit, eit time.Time
 	addr                               string
 	err                                error
+	hedge                              bool
+	traceID                            string
+	streamer                           *Streamer
+	stream                             *Stream
+	buf                                *bufio.Buffer
+	arena                              *Arena
 }
 
 // NewMessage will create new message object.
@@ -88,6 +98,19 @@ func (m *Message) Reset() {
 	m.reqNum = 0
 	m.st, m.wt, m.rt, m.et, m.spt, m.ept, m.sit, m.eit = defaultTime, defaultTime, defaultTime, defaultTime, defaultTime, defaultTime, defaultTime, defaultTime
 	m.err = nil
+	for _, s := range m.subs {
+		s.err = nil
+	}
+	m.hedge = false
+	m.traceID = ""
+	if m.stream != nil {
+		m.stream.Close()
+	}
+	m.streamer, m.stream = nil, nil
+	if m.buf != nil {
+		m.buf.Release()
+		m.buf = nil
+	}
 }
 
 // clear will clean the msg
@@ -128,6 +151,72 @@ func (m *Message) InputDur() time.Duration {
 	return m.eit.Sub(m.sit)
 }
 
+// Timeline is the times of message lifecycle.
+type Timeline struct {
+	Start   time.Time // decoded from client
+	Forward time.Time // forwarded to node
+	Queue   time.Time // queued into node conn pipe
+	Dequeue time.Time // taken by node conn
+	Write   time.Time // written into node
+	Read    time.Time // read from node
+	Reply   time.Time // all replies are ready
+	End     time.Time // encoded to client
+}
+
+// Timeline returns the times of message lifecycle, the times not passed
+// through are earlier than Start.
+func (m *Message) Timeline() Timeline {
+	return Timeline{
+		Start:   m.st,
+		Forward: m.spt,
+		Queue:   m.sit,
+		Dequeue: m.eit,
+		Write:   m.wt,
+		Read:    m.rt,
+		Reply:   m.ept,
+		End:     m.et,
+	}
+}
+
+// WithTraceID marks the message is traced by id.
+func (m *Message) WithTraceID(id string) {
+	m.traceID = id
+}
+
+// TraceID returns the trace id, empty if not traced.
+func (m *Message) TraceID() string {
+	return m.traceID
+}
+
+// WithStreamer allows the large value of reply to be streamed.
+func (m *Message) WithStreamer(st *Streamer) {
+	m.streamer = st
+}
+
+// Streamer returns the streamer, nil if streaming is not allowed.
+func (m *Message) Streamer() *Streamer {
+	return m.streamer
+}
+
+// WithStream sets the stream of the rest value of reply.
+func (m *Message) WithStream(s *Stream) {
+	m.stream = s
+}
+
+// Stream returns the stream of reply, nil if the reply is fully read.
+func (m *Message) Stream() *Stream {
+	return m.stream
+}
+
+// WithBuffer sets the read buffer which the request refers to, the buffer
+// is retained by caller and released on Reset.
+func (m *Message) WithBuffer(b *bufio.Buffer) {
+	if m.buf != nil {
+		m.buf.Release()
+	}
+	m.buf = b
+}
+
 // Addr ...
 func (m *Message) Addr() string {
 	return m.addr
@@ -244,7 +333,12 @@ func (m *Message) Batch() []*Message {
 	}
 	delta := slen - len(m.subs)
 	for i := 0; i < delta; i++ {
-		msg := getMsg()
+		var msg *Message
+		if m.arena != nil {
+			msg = m.arena.alloc()
+		} else {
+			msg = getMsg()
+		}
 		msg.Type = m.Type
 		msg.st = m.st
 		msg.setRequest(m.req[min+i])
@@ -273,6 +367,17 @@ func (m *Message) Done() {
 	}
 }
 
+// WithHedge marks the message is the hedge of a slow read, which should be
+// sent by another connection.
+func (m *Message) WithHedge() {
+	m.hedge = true
+}
+
+// IsHedge returns whether or not the hedge of a slow read.
+func (m *Message) IsHedge() bool {
+	return m.hedge
+}
+
 // WithError with error.
 func (m *Message) WithError(err error) {
 	m.err = err
@@ -286,7 +391,7 @@ func (m *Message) Err() error {
 	if !m.IsBatch() {
 		return nil
 	}
-	for _, s := range m.subs[:m.reqNum] {
+	for _, s := range m.subs[:minInt(len(m.subs), m.reqNum)] {
 		if s.err != nil {
 			return s.err
 		}
@@ -333,5 +438,6 @@ func (m *Message) Slowlog() (slog *SlowlogEntry) {
 		slog.InputDur = m.InputDur()
 		slog.Addr = m.Addr()
 	}
+	slog.TraceID = m.traceID
 	return
 }
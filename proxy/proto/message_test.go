@@ -62,3 +62,19 @@ func TestMessage(t *testing.T) {
 	err = emsg.Err()
 	assert.EqualError(t, err, "some error")
 }
+
+func TestMessageErrBeforeBatch(t *testing.T) {
+	msg := NewMessage()
+	msg.WithRequest(&mockRequest{})
+	msg.WithRequest(&mockRequest{})
+	assert.NoError(t, msg.Err())
+
+	subs := msg.Batch()
+	subs[1].WithError(errors.New("some error"))
+	assert.EqualError(t, msg.Err(), "some error")
+
+	msg.Reset()
+	msg.WithRequest(&mockRequest{})
+	msg.WithRequest(&mockRequest{})
+	assert.NoError(t, msg.Err())
+}
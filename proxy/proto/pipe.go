@@ -8,78 +8,211 @@ import (
 	"time"
 
 	"overlord/pkg/hashkit"
+	"overlord/proxy/mcstat"
 )
 
 const (
 	opened = int32(0)
 	closed = int32(1)
+
+	// slotsPerConn is the number of slots per max conn, the messages of one
+	// slot are sent in order by one conn at a time.
+	slotsPerConn = 4
+	// latencyWeight is the reciprocal of the weight of latest latency.
+	latencyWeight = 8
 )
 
 var (
 	errPipeChanFull = errors.New("pipe chan is full")
+	errPipeClosed   = errors.New("pipe is closed")
 )
 
-// NodeConnPipe multi MsgPipe for node conns.
+// NodeConnPipe is the pool of node conns. The messages are hashed by key
+// into slots and any free conn takes the ready slots, so a slow response
+// only blocks the slots it's sending instead of all messages to the node.
 type NodeConnPipe struct {
-	conns  int32
-	inputs []chan *Message
-	mps    []*msgPipe
-	l      sync.RWMutex
+	// latency is the moving average of the latencies of messages succeeded,
+	// which is first for the alignment of atomic.
+	latency int64
+
+	minConns    int32
+	maxConns    int32
+	conns       int32
+	busy        int32
+	queued      int32
+	waitQueue   int32
+	idleTimeout time.Duration
+	newNc       func() NodeConn
+
+	slots []*pipeSlot
+	ready chan *pipeSlot
+	done  chan struct{}
+	l     sync.RWMutex
 
 	errCh chan error
 
 	state        int32
 	pipeMaxCount int
+	batchCount   int
+	batchWait    time.Duration
+
+	breaker *Breaker
+	timeout *AdaptiveTimeout
+
+	// pool and free are used when the conns are served by WorkerPool.
+	pool *WorkerPool
+	free chan *idleConn
 }
 
-// NewNodeConnPipe new NodeConnPipe.
+// NewNodeConnPipe new NodeConnPipe with fixed conns.
 func NewNodeConnPipe(conns int32, pipeMaxCount int, newNc func() NodeConn) (ncp *NodeConnPipe) {
-	if conns <= 0 {
+	return NewNodeConnPool(conns, conns, pipeMaxCount, 0, 0, newNc)
+}
+
+// NewNodeConnPool new NodeConnPipe with minConns to maxConns conns. More
+// conns are opened when messages are waiting and closed after idle for
+// idleTimeout, never closed if zero. The messages more than waitQueue are
+// failed, pipeMaxCount*pipeMaxCount*16 per max conn if zero.
+func NewNodeConnPool(minConns, maxConns int32, pipeMaxCount, waitQueue int, idleTimeout time.Duration, newNc func() NodeConn) (ncp *NodeConnPipe) {
+	if minConns <= 0 {
 		panic("the number of connections cannot be zero")
 	}
+	if maxConns < minConns {
+		maxConns = minConns
+	}
+	if waitQueue <= 0 {
+		waitQueue = pipeMaxCount * pipeMaxCount * 16 * int(maxConns)
+	}
 	ncp = &NodeConnPipe{
-		conns:        conns,
-		inputs:       make([]chan *Message, conns),
-		mps:          make([]*msgPipe, conns),
+		minConns:     minConns,
+		maxConns:     maxConns,
+		waitQueue:    int32(waitQueue),
+		idleTimeout:  idleTimeout,
+		newNc:        newNc,
+		slots:        make([]*pipeSlot, maxConns*slotsPerConn),
+		done:         make(chan struct{}),
 		errCh:        make(chan error, 1),
 		pipeMaxCount: pipeMaxCount,
 	}
-	for i := int32(0); i < ncp.conns; i++ {
-		ncp.inputs[i] = make(chan *Message, pipeMaxCount*pipeMaxCount*16)
-		ncp.mps[i] = newMsgPipe(pipeMaxCount, ncp.inputs[i], newNc, ncp)
+	for i := range ncp.slots {
+		ncp.slots[i] = &pipeSlot{}
+	}
+	ncp.ready = make(chan *pipeSlot, len(ncp.slots))
+	for i := int32(0); i < minConns; i++ {
+		ncp.conns++
+		go ncp.work(newNc())
 	}
 	return
 }
 
-// Push push message into input chan.
+// SetBatch makes the conns coalesce the messages of deep pipeline, which is
+// detected when more than one message is taken at once, up to count messages
+// or waiting for wait before flushing. The single message is always flushed
+// immediately. It must be called before any message is pushed.
+func (ncp *NodeConnPipe) SetBatch(count int, wait time.Duration) {
+	if count <= 0 || count > ncp.pipeMaxCount {
+		count = ncp.pipeMaxCount
+	}
+	ncp.batchCount, ncp.batchWait = count, wait
+}
+
+// SetBreaker makes the messages fail fast by b while the node is broken. It
+// must be called before any message is pushed.
+func (ncp *NodeConnPipe) SetBreaker(b *Breaker) {
+	ncp.breaker = b
+}
+
+// Push push message into the slot of its key.
 func (ncp *NodeConnPipe) Push(m *Message) {
 	m.Add()
-	var input chan *Message
 	ncp.l.RLock()
-	if ncp.state == opened {
-		if ncp.conns == 1 {
-			input = ncp.inputs[0]
-		} else {
-			req := m.Request()
-			if req != nil {
-				crc := int32(hashkit.Crc16(req.Key()))
-				input = ncp.inputs[crc%ncp.conns]
-			} else {
-				// NOTE: impossible!!!
-			}
+	if ncp.state != opened {
+		ncp.l.RUnlock()
+		m.WithError(errPipeClosed)
+		m.Done()
+		return
+	}
+	if atomic.AddInt32(&ncp.queued, 1) > ncp.waitQueue {
+		atomic.AddInt32(&ncp.queued, -1)
+		ncp.l.RUnlock()
+		m.WithError(errPipeChanFull)
+		m.Done()
+		return
+	}
+	if ncp.breaker != nil && !ncp.breaker.Allow() {
+		atomic.AddInt32(&ncp.queued, -1)
+		ncp.l.RUnlock()
+		if prom.On {
+			prom.ErrIncr(ncp.breaker.cluster, ncp.breaker.addr, m.Request().CmdString(), "breaker open")
 		}
+		m.WithError(ErrBreakerOpen)
+		m.Done()
+		return
 	}
-	ncp.l.RUnlock()
-	if input != nil {
-		select {
-		case input <- m:
-			m.MarkStartInput()
-			return
-		default:
+	var idx int
+	if req := m.Request(); req != nil && len(ncp.slots) > 1 {
+		idx = int(hashkit.Crc16(req.Key())) % len(ncp.slots)
+		if m.IsHedge() {
+			// NOTE: not queued behind the slow one
+			idx = (idx + len(ncp.slots)/2) % len(ncp.slots)
 		}
 	}
-	m.WithError(errPipeChanFull)
-	m.Done()
+	s := ncp.slots[idx]
+	m.MarkStartInput()
+	if s.push(m) {
+		ncp.signal(s)
+	}
+	ncp.l.RUnlock()
+	if ncp.pool == nil && len(ncp.ready) > 0 {
+		ncp.grow()
+	}
+}
+
+// Stats returns the number of opened conns, the conns sending messages and
+// the messages waiting for conns.
+func (ncp *NodeConnPipe) Stats() (conns, busy, queued int32) {
+	return atomic.LoadInt32(&ncp.conns), atomic.LoadInt32(&ncp.busy), atomic.LoadInt32(&ncp.queued)
+}
+
+// SetTimeout makes the conns read by the adaptive timeout at. It must be
+// called before any message is pushed.
+func (ncp *NodeConnPipe) SetTimeout(at *AdaptiveTimeout) {
+	ncp.timeout = at
+}
+
+// ReadTimeout returns the adaptive read timeout, zero if not adaptive.
+func (ncp *NodeConnPipe) ReadTimeout() time.Duration {
+	if ncp.timeout == nil {
+		return 0
+	}
+	return ncp.timeout.Timeout()
+}
+
+// Latency returns the moving average latency of node.
+func (ncp *NodeConnPipe) Latency() time.Duration {
+	return time.Duration(atomic.LoadInt64(&ncp.latency))
+}
+
+// observe moves the average latency by d, the concurrent updates may be
+// lost which is tolerable.
+func (ncp *NodeConnPipe) observe(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	avg := atomic.LoadInt64(&ncp.latency)
+	if avg == 0 {
+		atomic.StoreInt64(&ncp.latency, int64(d))
+		return
+	}
+	atomic.StoreInt64(&ncp.latency, avg+(int64(d)-avg)/latencyWeight)
+}
+
+// BreakerState returns the state of breaker, empty if no breaker.
+func (ncp *NodeConnPipe) BreakerState() string {
+	if ncp.breaker == nil {
+		return ""
+	}
+	return ncp.breaker.State()
 }
 
 // ErrorEvent return error chan.
@@ -90,132 +223,317 @@ func (ncp *NodeConnPipe) ErrorEvent() <-chan error {
 // Close close pipe.
 func (ncp *NodeConnPipe) Close() {
 	ncp.l.Lock()
+	if ncp.state == closed {
+		ncp.l.Unlock()
+		return
+	}
 	close(ncp.errCh)
 	ncp.state = closed
-	for _, input := range ncp.inputs {
-		close(input)
-	}
+	close(ncp.done)
 	ncp.l.Unlock()
+	if ncp.pool != nil {
+		ncp.pool.remove(ncp)
+		ncp.drain()
+		ncp.closeFree()
+	}
 }
 
-// msgPipe message pipeline.
-type msgPipe struct {
-	nc    atomic.Value
-	newNc func() NodeConn
-	input <-chan *Message
-
-	batch        []*Message
-	pipeMaxCount int
-	count        int
-
-	ncp *NodeConnPipe
+// grow opens one more conn if less than maxConns.
+func (ncp *NodeConnPipe) grow() {
+	for {
+		conns := atomic.LoadInt32(&ncp.conns)
+		if conns >= ncp.maxConns {
+			return
+		}
+		if atomic.CompareAndSwapInt32(&ncp.conns, conns, conns+1) {
+			break
+		}
+	}
+	// NOTE: dial out of Push
+	go func() {
+		ncp.work(ncp.newNc())
+	}()
 }
 
-// newMsgPipe new msgPipe and return.
-func newMsgPipe(pipeMaxCount int, input <-chan *Message, newNc func() NodeConn, ncp *NodeConnPipe) (mp *msgPipe) {
-	mp = &msgPipe{
-		newNc:        newNc,
-		input:        input,
-		ncp:          ncp,
-		batch:        make([]*Message, pipeMaxCount),
-		pipeMaxCount: pipeMaxCount,
+// shrink returns true if the idle conn could be closed.
+func (ncp *NodeConnPipe) shrink() bool {
+	for {
+		conns := atomic.LoadInt32(&ncp.conns)
+		if conns <= ncp.minConns {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&ncp.conns, conns, conns-1) {
+			return true
+		}
 	}
-	mp.nc.Store(newNc())
-	go mp.pipe()
-	return
 }
 
-func (mp *msgPipe) pipe() {
+func (ncp *NodeConnPipe) work(nc NodeConn) {
 	var (
-		nc  = mp.nc.Load().(NodeConn)
-		m   *Message
-		ok  bool
-		err error
+		batch = make([]*Message, 0, ncp.pipeMaxCount)
+		owned []*pipeSlot
+		idle  *time.Timer
+		idleC <-chan time.Time
 	)
+	if ncp.idleTimeout > 0 && ncp.maxConns > ncp.minConns {
+		idle = time.NewTimer(ncp.idleTimeout)
+		defer idle.Stop()
+		idleC = idle.C
+	}
 	for {
-		for {
-			if m == nil {
+		var s *pipeSlot
+		select {
+		case s = <-ncp.ready:
+		case <-ncp.done:
+			ncp.drain()
+			atomic.AddInt32(&ncp.conns, -1)
+			nc.Close()
+			return
+		case <-idleC:
+			if ncp.shrink() {
+				nc.Close()
+				ncp.stat(nc)
+				return
+			}
+			idle.Reset(ncp.idleTimeout)
+			continue
+		}
+		nc, batch, owned = ncp.send(nc, s, batch, owned)
+		ncp.stat(nc)
+		if idle != nil {
+			if !idle.Stop() {
 				select {
-				case m, ok = <-mp.input:
-					if !ok {
-						nc.Close()
-						return
-					}
-					m.MarkEndInput()
+				case <-idle.C:
 				default:
 				}
-				if m == nil {
-					break
-				}
 			}
-			mp.batch[mp.count] = m
-			mp.count++
-			m.MarkWrite()
-			nc.Addr()
-			err = nc.Write(m)
-			m = nil
+			idle.Reset(ncp.idleTimeout)
+		}
+	}
+}
+
+// send takes the messages of ready slots beginning with s and sends them by
+// nc, it returns the new conn if nc is broken and the buffers to be reused.
+func (ncp *NodeConnPipe) send(nc NodeConn, s *pipeSlot, batch []*Message, owned []*pipeSlot) (NodeConn, []*Message, []*pipeSlot) {
+	owned = append(owned[:0], s)
+	batch = s.take(batch[:0], ncp.pipeMaxCount)
+collect:
+	for len(batch) < ncp.pipeMaxCount {
+		select {
+		case s = <-ncp.ready:
+			owned = append(owned, s)
+			batch = s.take(batch, ncp.pipeMaxCount)
+		default:
+			break collect
+		}
+	}
+	if ncp.batchWait > 0 && len(batch) > 1 && len(batch) < ncp.batchCount {
+		batch, owned = ncp.coalesce(batch, owned)
+	}
+	atomic.AddInt32(&ncp.queued, -int32(len(batch)))
+	atomic.AddInt32(&ncp.busy, 1)
+	nc = ncp.roundTrip(nc, batch)
+	atomic.AddInt32(&ncp.busy, -1)
+	for _, s := range owned {
+		if s.release() {
+			ncp.signal(s)
+		}
+	}
+	for i := range batch {
+		batch[i] = nil
+	}
+	return nc, batch, owned
+}
+
+// signal makes the slot s ready to be sent.
+func (ncp *NodeConnPipe) signal(s *pipeSlot) {
+	// NOTE: never blocked because one slot is ready at most once
+	ncp.ready <- s
+	if ncp.pool != nil {
+		ncp.pool.schedule(ncp)
+	}
+}
+
+// coalesce waits for more ready slots until batchCount messages or batchWait
+// elapsed, then takes the messages pushed into owned slots meanwhile.
+func (ncp *NodeConnPipe) coalesce(batch []*Message, owned []*pipeSlot) ([]*Message, []*pipeSlot) {
+	timer := time.NewTimer(ncp.batchWait)
+	defer timer.Stop()
+wait:
+	for len(batch) < ncp.batchCount {
+		select {
+		case s := <-ncp.ready:
+			owned = append(owned, s)
+			batch = s.take(batch, ncp.batchCount)
+		case <-timer.C:
+			break wait
+		case <-ncp.done:
+			break wait
+		}
+	}
+	for _, s := range owned {
+		if len(batch) >= ncp.batchCount {
+			break
+		}
+		batch = s.take(batch, ncp.batchCount)
+	}
+	return batch, owned
+}
+
+// roundTrip sends batch by nc and returns the new conn if nc is broken.
+func (ncp *NodeConnPipe) roundTrip(nc NodeConn, batch []*Message) NodeConn {
+	var err error
+	for _, m := range batch {
+		m.MarkWrite()
+		if err = nc.Write(m); err != nil {
+			break
+		}
+	}
+	if err == nil && len(batch) > 0 {
+		err = nc.Flush()
+	}
+	if rt, ok := nc.(ReadTimeouter); ok && ncp.timeout != nil {
+		rt.SetReadTimeout(ncp.timeout.Timeout())
+	}
+	if err == nil {
+		for i, m := range batch {
+			err = nc.Read(m)
+			m.MarkRead()
+			m.MarkAddr(nc.Addr())
 			if err != nil {
-				goto MEND
-			}
-			if mp.count >= mp.pipeMaxCount {
 				break
 			}
-		}
-		if err == nil && mp.count > 0 {
-			if err = nc.Flush(); err != nil {
-				goto MEND
-			}
-			for i := 0; i < mp.count; i++ {
-				if err == nil {
-					err = nc.Read(mp.batch[i])
-					mp.batch[i].MarkRead()
-					mp.batch[i].MarkAddr(nc.Addr())
-				} else {
-					goto MEND
+			if st, ok := m.Request().(mcstat.Stater); ok {
+				if s, ok := st.Stat(); ok {
+					mcstat.Incr(nc.Cluster(), nc.Addr(), s)
 				}
 			}
-		}
-	MEND:
-		for i := 0; i < mp.count; i++ {
-			msg := mp.batch[i]
-			msg.WithError(err) // NOTE: maybe err is nil
-			if prom.On {
-				cmd := msg.Request().CmdString()
-				duration := msg.RemoteDur()
-				msg.Done()
-				if err != nil {
-					prom.ErrIncr(nc.Cluster(), nc.Addr(), cmd, "network err")
-				} else {
-					prom.HandleTime(nc.Cluster(), nc.Addr(), cmd, int64(duration/time.Microsecond))
+			if s := m.Stream(); s != nil {
+				// NOTE: done before pumping, client takes the value while reading from node.
+				ncp.finish(nc, m, nil)
+				batch[i] = nil
+				if err = s.Pump(); err != nil {
+					break
 				}
-			} else {
-				msg.Done()
 			}
 		}
-		mp.count = 0
-		if err != nil {
-			nc = mp.reNewNc(nc, err)
-			err = nil
+	}
+	for _, msg := range batch {
+		if msg != nil {
+			ncp.finish(nc, msg, err) // NOTE: maybe err is nil
 		}
-		m, ok = <-mp.input // NOTE: avoid infinite loop
-		if !ok {
-			nc.Close()
-			return
+	}
+	if err == nil {
+		return nc
+	}
+	ncp.l.Lock()
+	if ncp.state == opened {
+		select {
+		case ncp.errCh <- err: // NOTE: action
+		default:
 		}
-		m.MarkEndInput()
+	}
+	ncp.l.Unlock()
+	nc.Close()
+	return ncp.newNc()
+}
+
+func (ncp *NodeConnPipe) finish(nc NodeConn, msg *Message, err error) {
+	msg.WithError(err)
+	if ncp.breaker != nil {
+		ncp.breaker.Record(err, msg.RemoteDur())
+	}
+	if ncp.timeout != nil {
+		// NOTE: the message timed out is observed as slow as the timeout
+		ncp.timeout.Observe(msg.RemoteDur())
+	}
+	if err == nil {
+		ncp.observe(msg.RemoteDur())
+	}
+	if prom.On {
+		cmd := msg.Request().CmdString()
+		duration := msg.RemoteDur()
+		msg.Done()
+		if err != nil {
+			prom.ErrIncr(nc.Cluster(), nc.Addr(), cmd, "network err")
+		} else {
+			prom.HandleTime(nc.Cluster(), nc.Addr(), cmd, int64(duration/time.Microsecond))
+		}
+	} else {
+		msg.Done()
 	}
 }
 
-func (mp *msgPipe) reNewNc(nc NodeConn, err error) NodeConn {
-	if err != nil {
-		mp.ncp.l.Lock()
+// drain fails the messages of ready slots after closed.
+func (ncp *NodeConnPipe) drain() {
+	for {
 		select {
-		case mp.ncp.errCh <- err: // NOTE: action
+		case s := <-ncp.ready:
+			msgs := s.take(nil, int(^uint(0)>>1))
+			atomic.AddInt32(&ncp.queued, -int32(len(msgs)))
+			for _, m := range msgs {
+				m.WithError(errPipeClosed)
+				m.Done()
+			}
 		default:
+			return
 		}
-		mp.ncp.l.Unlock()
 	}
-	nc.Close()
-	mp.nc.Store(mp.newNc())
-	return mp.nc.Load().(NodeConn)
+}
+
+func (ncp *NodeConnPipe) stat(nc NodeConn) {
+	if prom.On {
+		conns, busy, queued := ncp.Stats()
+		prom.NodePool(nc.Cluster(), nc.Addr(), conns, busy, queued)
+	}
+}
+
+// pipeSlot is the queue of messages sent in order.
+type pipeSlot struct {
+	lock      sync.Mutex
+	msgs      []*Message
+	scheduled bool
+}
+
+// push appends m and returns true if the slot should be ready.
+func (s *pipeSlot) push(m *Message) (ready bool) {
+	s.lock.Lock()
+	s.msgs = append(s.msgs, m)
+	ready = !s.scheduled
+	s.scheduled = true
+	s.lock.Unlock()
+	return
+}
+
+// take moves the messages into batch up to max.
+func (s *pipeSlot) take(batch []*Message, max int) []*Message {
+	s.lock.Lock()
+	n := max - len(batch)
+	if n > len(s.msgs) {
+		n = len(s.msgs)
+	}
+	for _, m := range s.msgs[:n] {
+		m.MarkEndInput()
+	}
+	batch = append(batch, s.msgs[:n]...)
+	rest := copy(s.msgs, s.msgs[n:])
+	for i := rest; i < len(s.msgs); i++ {
+		s.msgs[i] = nil
+	}
+	s.msgs = s.msgs[:rest]
+	s.lock.Unlock()
+	return batch
+}
+
+// release returns true if the slot has more messages and should be ready
+// again.
+func (s *pipeSlot) release() (ready bool) {
+	s.lock.Lock()
+	if len(s.msgs) > 0 {
+		ready = true
+	} else {
+		s.scheduled = false
+	}
+	s.lock.Unlock()
+	return
 }
@@ -101,3 +101,177 @@ func TestPipe(t *testing.T) {
 		assert.EqualError(t, msg.Err(), "some error")
 	}
 }
+
+type keyRequest struct {
+	mockRequest
+	key string
+}
+
+func (r *keyRequest) Key() []byte { return []byte(r.key) }
+
+// slowNodeConn blocks reading the message of key slow until released.
+type slowNodeConn struct {
+	mockNodeConn
+	release chan struct{}
+	lock    *sync.Mutex
+	order   *[]string
+}
+
+func (n *slowNodeConn) Write(m *Message) error {
+	n.lock.Lock()
+	*n.order = append(*n.order, m.Request().(*keyRequest).key)
+	n.lock.Unlock()
+	return nil
+}
+
+func (n *slowNodeConn) Read(m *Message) error {
+	if m.Request().(*keyRequest).key == "slow" {
+		<-n.release
+	}
+	return nil
+}
+
+func pushKey(ncp *NodeConnPipe, key string) (*Message, *sync.WaitGroup) {
+	wg := &sync.WaitGroup{}
+	m := getMsg()
+	m.WithRequest(&keyRequest{key: key})
+	m.WithWaitGroup(wg)
+	ncp.Push(m)
+	return m, wg
+}
+
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	ch := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+	select {
+	case <-ch:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func TestPipePool(t *testing.T) {
+	var (
+		release = make(chan struct{})
+		lock    = &sync.Mutex{}
+		order   []string
+	)
+	ncp := NewNodeConnPool(1, 2, 32, 0, 50*time.Millisecond, func() NodeConn {
+		return &slowNodeConn{release: release, lock: lock, order: &order}
+	})
+	defer ncp.Close()
+	conns, _, _ := ncp.Stats()
+	assert.Equal(t, int32(1), conns)
+
+	_, slow := pushKey(ncp, "slow")
+	time.Sleep(10 * time.Millisecond)
+	// NOTE: the other key is sent by a new conn without waiting slow
+	_, fast := pushKey(ncp, "fast")
+	assert.True(t, waitTimeout(fast, time.Second))
+	conns, busy, queued := ncp.Stats()
+	assert.Equal(t, int32(2), conns)
+	assert.Equal(t, int32(1), busy)
+	assert.Equal(t, int32(0), queued)
+
+	// NOTE: the same key waits slow to keep the order
+	_, same := pushKey(ncp, "slow")
+	assert.False(t, waitTimeout(same, 50*time.Millisecond))
+	close(release)
+	assert.True(t, waitTimeout(slow, time.Second))
+	assert.True(t, waitTimeout(same, time.Second))
+	lock.Lock()
+	assert.Equal(t, []string{"slow", "fast", "slow"}, order)
+	lock.Unlock()
+
+	// NOTE: the conn more than min is closed after idle
+	time.Sleep(200 * time.Millisecond)
+	conns, _, _ = ncp.Stats()
+	assert.Equal(t, int32(1), conns)
+}
+
+func TestPipePoolWaitQueue(t *testing.T) {
+	release := make(chan struct{})
+	ncp := NewNodeConnPool(1, 1, 32, 1, 0, func() NodeConn {
+		return &slowNodeConn{release: release, lock: &sync.Mutex{}, order: &[]string{}}
+	})
+	_, slow := pushKey(ncp, "slow")
+	time.Sleep(10 * time.Millisecond)
+	queued, wg := pushKey(ncp, "a")
+	full, fwg := pushKey(ncp, "b")
+	assert.True(t, waitTimeout(fwg, time.Second))
+	assert.Equal(t, errPipeChanFull, full.Err())
+	close(release)
+	assert.True(t, waitTimeout(slow, time.Second))
+	assert.True(t, waitTimeout(wg, time.Second))
+	assert.NoError(t, queued.Err())
+
+	ncp.Close()
+	closed, cwg := pushKey(ncp, "c")
+	assert.True(t, waitTimeout(cwg, time.Second))
+	assert.Equal(t, errPipeClosed, closed.Err())
+}
+
+// batchNodeConn records the number of messages of each flush.
+type batchNodeConn struct {
+	slowNodeConn
+	flushed []int
+	written int
+}
+
+func (n *batchNodeConn) Write(m *Message) error {
+	n.written++
+	return n.slowNodeConn.Write(m)
+}
+
+func (n *batchNodeConn) Flush() error {
+	n.lock.Lock()
+	n.flushed = append(n.flushed, n.written)
+	n.lock.Unlock()
+	n.written = 0
+	return nil
+}
+
+func TestPipeBatch(t *testing.T) {
+	nc := &batchNodeConn{slowNodeConn: slowNodeConn{release: make(chan struct{}), lock: &sync.Mutex{}, order: &[]string{}}}
+	ncp := NewNodeConnPool(1, 1, 32, 0, 0, func() NodeConn {
+		return nc
+	})
+	ncp.SetBatch(4, 200*time.Millisecond)
+	defer ncp.Close()
+
+	// NOTE: the single message is flushed immediately
+	_, wg := pushKey(ncp, "a")
+	assert.True(t, waitTimeout(wg, 100*time.Millisecond))
+
+	// NOTE: the messages queued behind slow are coalesced up to 4
+	_, slow := pushKey(ncp, "slow")
+	time.Sleep(10 * time.Millisecond)
+	_, b := pushKey(ncp, "b")
+	_, c := pushKey(ncp, "c")
+	close(nc.release)
+	assert.True(t, waitTimeout(slow, time.Second))
+	time.Sleep(20 * time.Millisecond)
+	_, d := pushKey(ncp, "d")
+	_, e := pushKey(ncp, "e")
+	for _, wg := range []*sync.WaitGroup{b, c, d, e} {
+		assert.True(t, waitTimeout(wg, time.Second))
+	}
+	nc.lock.Lock()
+	assert.Equal(t, []int{1, 1, 4}, nc.flushed)
+	nc.lock.Unlock()
+}
+
+func TestPipeLatency(t *testing.T) {
+	ncp := &NodeConnPipe{}
+	assert.Equal(t, time.Duration(0), ncp.Latency())
+	ncp.observe(8 * time.Millisecond)
+	assert.Equal(t, 8*time.Millisecond, ncp.Latency())
+	ncp.observe(16 * time.Millisecond)
+	assert.Equal(t, 9*time.Millisecond, ncp.Latency())
+	ncp.observe(-time.Millisecond)
+	assert.Equal(t, 9*time.Millisecond, ncp.Latency())
+}
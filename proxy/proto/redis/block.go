@@ -0,0 +1,79 @@
+package redis
+
+import (
+	"strconv"
+	"time"
+
+	"overlord/pkg/bufio"
+	libnet "overlord/pkg/net"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// blockCmds are the blocking commands and the index of their timeout,
+	// -1 is the last argument.
+	blockCmds = map[string]int{
+		"5\r\nBLPOP":       -1,
+		"5\r\nBRPOP":       -1,
+		"10\r\nBRPOPLPUSH": -1,
+		"6\r\nBLMOVE":      -1,
+		"8\r\nBZPOPMIN":    -1,
+		"8\r\nBZPOPMAX":    -1,
+		"6\r\nBLMPOP":      1,
+		"6\r\nBZMPOP":      1,
+	}
+	// lastTimeoutCmds are the blocking commands of keys followed by timeout,
+	// such as BLPOP key [key ...] timeout.
+	lastTimeoutCmds = map[string]struct{}{
+		"5\r\nBLPOP":    {},
+		"5\r\nBRPOP":    {},
+		"8\r\nBZPOPMIN": {},
+		"8\r\nBZPOPMAX": {},
+	}
+)
+
+// IsBlocking is the command which blocks the connection until data arrives
+// or timeout, such as BLPOP.
+func (r *Request) IsBlocking() bool {
+	if r.resp.arraySize < 1 {
+		return false
+	}
+	_, ok := blockCmds[string(r.resp.array[0].data)]
+	return ok
+}
+
+// BlockTimeout returns the timeout of blocking command, zero means blocking
+// forever. ok is false if the timeout is bad, which is left to the node.
+func (r *Request) BlockTimeout() (timeout time.Duration, ok bool) {
+	idx, found := blockCmds[string(r.resp.array[0].data)]
+	if !found {
+		return 0, false
+	}
+	if idx < 0 {
+		idx += r.resp.arraySize
+	}
+	if idx < 1 || idx >= r.resp.arraySize {
+		return 0, false
+	}
+	sec, err := strconv.ParseFloat(string(bulkData(r.resp.array[idx])), 64)
+	if err != nil || sec < 0 {
+		return 0, false
+	}
+	return time.Duration(sec * float64(time.Second)), true
+}
+
+// Send sends r into the dedicated node connection and reads the reply,
+// it blocks until the node replies or the read timeout of node.
+func (r *Request) Send(node *libnet.Conn) (err error) {
+	bw := bufio.NewWriter(node)
+	if err = r.resp.encode(bw); err != nil {
+		return errors.WithStack(err)
+	}
+	if err = bw.Flush(); err != nil {
+		return errors.WithStack(err)
+	}
+	br := bufio.NewReader(node, bufio.Get(txReadBufSize))
+	defer bufio.Put(br.Buffer())
+	return readReply(br, r.reply)
+}
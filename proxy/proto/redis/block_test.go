@@ -0,0 +1,40 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestBlockTimeout(t *testing.T) {
+	msgs := decodeMsgs(t, "BLPOP a b 1.5\r\nBLMPOP 0 2 a b LEFT\r\nBRPOP a x\r\nBLMOVE a b LEFT RIGHT 2\r\nLPOP a\r\n", 5)
+	var reqs []*Request
+	for _, msg := range msgs {
+		reqs = append(reqs, msg.Request().(*Request))
+	}
+	for _, req := range reqs[:4] {
+		assert.True(t, req.IsBlocking())
+		assert.True(t, req.IsMultiKey())
+	}
+	assert.False(t, reqs[4].IsBlocking())
+
+	d, ok := reqs[0].BlockTimeout()
+	assert.True(t, ok)
+	assert.Equal(t, 1500*time.Millisecond, d)
+	d, ok = reqs[1].BlockTimeout()
+	assert.True(t, ok)
+	assert.Equal(t, time.Duration(0), d)
+	_, ok = reqs[2].BlockTimeout()
+	assert.False(t, ok)
+	d, _ = reqs[3].BlockTimeout()
+	assert.Equal(t, 2*time.Second, d)
+
+	keys, err := reqs[0].multiKeys()
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+	keys, err = reqs[1].multiKeys()
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+	assert.Equal(t, "a", string(reqs[1].Key()))
+}
@@ -0,0 +1,38 @@
+package redis
+
+import (
+	"bytes"
+	"strconv"
+
+	"overlord/pkg/conv"
+)
+
+// maskByte is the byte filling the masked values.
+const maskByte = 'x'
+
+// Capture impl proto.Capturer, the request is appended as the array of bulk
+// strings. The arguments except the key and integers such as the expiration
+// are masked if keyOnly.
+func (r *Request) Capture(buf []byte, keyOnly bool) []byte {
+	if r.resp.arraySize < 1 {
+		return buf
+	}
+	key := r.Key()
+	buf = append(buf, respArray)
+	buf = strconv.AppendInt(buf, int64(r.resp.arraySize), 10)
+	buf = append(buf, crlfBytes...)
+	for i, arg := range r.resp.array[:r.resp.arraySize] {
+		data := bulkData(arg)
+		buf = append(buf, respBulk)
+		buf = strconv.AppendInt(buf, int64(len(data)), 10)
+		buf = append(buf, crlfBytes...)
+		if keyOnly && i > 0 && !bytes.Equal(data, key) {
+			if _, err := conv.Btoi(data); err != nil {
+				data = bytes.Repeat([]byte{maskByte}, len(data))
+			}
+		}
+		buf = append(buf, data...)
+		buf = append(buf, crlfBytes...)
+	}
+	return buf
+}
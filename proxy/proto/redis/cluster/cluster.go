@@ -1,9 +1,10 @@
 package cluster
 
 import (
-	"bytes"
 	errs "errors"
+	"math/rand"
 	"net"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -14,6 +15,7 @@ import (
 	"overlord/pkg/log"
 	libnet "overlord/pkg/net"
 	"overlord/proxy/proto"
+	"overlord/proxy/proto/redis"
 )
 
 const (
@@ -21,6 +23,11 @@ const (
 	closed  = int32(1)
 
 	musk = 0x3fff
+
+	// fetchMinInterval and fetchMaxInterval bound the backoff between
+	// fetches, MOVED during resharding triggers a lot of fetches.
+	fetchMinInterval = time.Second
+	fetchMaxInterval = 30 * time.Second
 )
 
 // errors
@@ -47,9 +54,17 @@ type cluster struct {
 	conns         int32
 	dto, rto, wto time.Duration
 	hashTag       []byte
+	auth          string
 
 	slotNode atomic.Value
 	action   chan struct{}
+	// refresh is the interval to fetch slots periodically, 0 means only
+	// fetch when conn errors or redirections.
+	refresh time.Duration
+	// readPref is the read preference routing reads to replicas.
+	readPref string
+	// rtts is the smoothed rtts of nodes measured by probeproc for nearest.
+	rtts atomic.Value
 
 	fakeNodesBytes []byte
 	fakeSlotsBytes []byte
@@ -57,10 +72,12 @@ type cluster struct {
 
 	state     int32
 	pipeCount int
+	// pool serves the node conns by shared workers if not nil.
+	pool *proto.WorkerPool
 }
 
 // NewForwarder new proto Forwarder.
-func NewForwarder(name, listen string, servers []string, conns int32, pipeCount int, dto, rto, wto time.Duration, hashTag []byte) proto.Forwarder {
+func NewForwarder(name, listen string, servers []string, conns int32, pipeCount int, dto, rto, wto, refresh time.Duration, hashTag []byte, auth, readPref string, pool *proto.WorkerPool) proto.Forwarder {
 	c := &cluster{
 		name:      name,
 		servers:   servers,
@@ -69,8 +86,12 @@ func NewForwarder(name, listen string, servers []string, conns int32, pipeCount
 		rto:       rto,
 		wto:       wto,
 		hashTag:   hashTag,
+		auth:      auth,
 		action:    make(chan struct{}),
+		refresh:   refresh,
+		readPref:  readPref,
 		pipeCount: pipeCount,
+		pool:      pool,
 	}
 	if !c.tryFetch() {
 		_ = c.Close()
@@ -79,6 +100,9 @@ func NewForwarder(name, listen string, servers []string, conns int32, pipeCount
 	}
 	c.fake(listen)
 	go c.fetchproc()
+	if readPref == ReadNearest {
+		go c.probeproc()
+	}
 	return c
 }
 
@@ -88,13 +112,20 @@ func (c *cluster) Forward(msgs []*proto.Message) error {
 	}
 	for _, m := range msgs {
 		if m.IsBatch() {
-			for _, subm := range m.Batch() {
-				ncp := c.getPipe(subm.Request().Key())
-				subm.MarkStartPipe()
-				ncp.Push(subm)
-			}
+			c.batchForward(m)
 		} else {
-			ncp := c.getPipe(m.Request().Key())
+			if req, ok := m.Request().(*redis.Request); ok && req.IsMultiKey() && !req.CheckKeys(c.slot) {
+				continue
+			}
+			if req, ok := m.Request().(*redis.Request); ok && req.IsScan() {
+				c.scan(m, req)
+				continue
+			}
+			ncp, err := c.getPipe(m.Request())
+			if err != nil {
+				m.WithError(err)
+				continue
+			}
 			m.MarkStartPipe()
 			ncp.Push(m)
 		}
@@ -102,6 +133,77 @@ func (c *cluster) Forward(msgs []*proto.Message) error {
 	return nil
 }
 
+// batchForward merges the sub messages of the same slot into one request,
+// the slots are dispatched to nodes in parallel.
+func (c *cluster) batchForward(m *proto.Message) {
+	var (
+		slots []int
+		group = make(map[int][]*proto.Message)
+	)
+	for _, subm := range m.Batch() {
+		slot := int(hashkit.Crc16(c.trimHashTag(subm.Request().Key())) & musk)
+		if _, ok := group[slot]; !ok {
+			slots = append(slots, slot)
+		}
+		group[slot] = append(group[slot], subm)
+		subm.MarkStartPipe()
+	}
+	sn := c.slotNode.Load().(*slotNode)
+	for _, slot := range slots {
+		subms := group[slot]
+		mainMsg := subms[0]
+		if len(subms) > 1 {
+			reqs := make([]proto.Request, 0, len(subms)-1)
+			for _, subm := range subms[1:] {
+				reqs = append(reqs, subm.Request())
+			}
+			if err := mainMsg.Request().Merge(reqs); err != nil {
+				mainMsg.WithError(err)
+				continue
+			}
+		}
+		ncp, err := c.slotPipe(sn, slot, mainMsg.Request())
+		if err != nil {
+			mainMsg.WithError(err)
+			continue
+		}
+		ncp.Push(mainMsg)
+	}
+}
+
+// scan forwards SCAN to one of the masters which are sorted by address.
+func (c *cluster) scan(m *proto.Message, req *redis.Request) {
+	sn := c.slotNode.Load().(*slotNode)
+	masters := sn.nSlots.getMasters()
+	sort.Strings(masters)
+	if idx, ok := req.ScanNode(len(masters)); ok {
+		m.MarkStartPipe()
+		sn.nodePipe[masters[idx]].Push(m)
+	}
+}
+
+// Route impl proto.Router by the slot of key.
+func (c *cluster) Route(key []byte) string {
+	return c.slot(key)
+}
+
+// Pin impl proto.Pinner by the node of the slot of key.
+func (c *cluster) Pin(key []byte) (*libnet.Conn, error) {
+	if state := atomic.LoadInt32(&c.state); state == closed {
+		return nil, ErrClusterClosed
+	}
+	crc := hashkit.Crc16(c.trimHashTag(key)) & musk
+	sn := c.slotNode.Load().(*slotNode)
+	conn := libnet.DialWithTimeout(sn.nSlots.slots[crc], c.dto, 0, c.wto)
+	if c.auth != "" {
+		if err := redis.Auth(conn, c.auth); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
 // Don't support update backend server list now
 func (c *cluster) Update([]string) error {
 	return nil
@@ -119,44 +221,116 @@ func (c *cluster) Close() error {
 		}
 		return nil
 	}
+	if c.pool != nil {
+		// NOTE: the pipes must be closed to fail their messages before the
+		// workers are stopped
+		if sn, ok := c.slotNode.Load().(*slotNode); ok && sn != nil {
+			for _, ncp := range sn.nodePipe {
+				ncp.Close()
+			}
+			for _, ncp := range sn.replicaPipe {
+				ncp.Close()
+			}
+		}
+		c.pool.Close()
+	}
 	return nil
 }
 
-func (c *cluster) getPipe(key []byte) (ncp *proto.NodeConnPipe) {
-	realKey := c.trimHashTag(key)
-	crc := hashkit.Crc16(realKey) & musk
-	sn := c.slotNode.Load().(*slotNode)
-	addr := sn.nSlots.slots[crc]
-	ncp = sn.nodePipe[addr]
+// NodeStats impl proto.NodeStater, the masters and replicas are sorted by
+// address and always up since they are discovered from cluster.
+func (c *cluster) NodeStats() (nss []*proto.NodeStat) {
+	sn, ok := c.slotNode.Load().(*slotNode)
+	if !ok || sn == nil {
+		return
+	}
+	add := func(pipes map[string]*proto.NodeConnPipe, role string) {
+		addrs := make([]string, 0, len(pipes))
+		for addr := range pipes {
+			addrs = append(addrs, addr)
+		}
+		sort.Strings(addrs)
+		for _, addr := range addrs {
+			ns := &proto.NodeStat{Addr: addr, Alias: addr, Role: role, Up: true}
+			ns.Conns, ns.Busy, ns.Queued = pipes[addr].Stats()
+			ns.Latency = pipes[addr].Latency()
+			nss = append(nss, ns)
+		}
+	}
+	add(sn.nodePipe, "master")
+	add(sn.replicaPipe, "slave")
 	return
 }
 
-func (c *cluster) trimHashTag(key []byte) []byte {
-	if len(c.hashTag) != 2 {
-		return key
-	}
-	bidx := bytes.IndexByte(key, c.hashTag[0])
-	if bidx == -1 {
-		return key
-	}
-	eidx := bytes.IndexByte(key[bidx+1:], c.hashTag[1])
-	if eidx == -1 {
-		return key
+// slot returns the slot of key which used to check script keys.
+func (c *cluster) slot(key []byte) string {
+	return strconv.Itoa(int(hashkit.Crc16(c.trimHashTag(key)) & musk))
+}
+
+func (c *cluster) getPipe(req proto.Request) (ncp *proto.NodeConnPipe, err error) {
+	slot := int(hashkit.Crc16(c.trimHashTag(req.Key())) & musk)
+	sn := c.slotNode.Load().(*slotNode)
+	return c.slotPipe(sn, slot, req)
+}
+
+// slotPipe returns the pipe of slot, the reads may be routed to replicas.
+func (c *cluster) slotPipe(sn *slotNode, slot int, req proto.Request) (ncp *proto.NodeConnPipe, err error) {
+	if c.readPref != "" && c.readPref != ReadMaster {
+		if rreq, ok := req.(*redis.Request); ok && rreq.IsRead() {
+			return c.readPipe(sn, slot)
+		}
 	}
-	return key[bidx+1 : bidx+1+eidx]
+	return sn.nodePipe[sn.nSlots.slots[slot]], nil
 }
 
+func (c *cluster) trimHashTag(key []byte) []byte {
+	return hashkit.TrimHashTag(key, c.hashTag)
+}
+
+// fetchproc refreshes the slots periodically and when toFetch is called
+// by conn errors and redirections, the slots are swapped atomically.
 func (c *cluster) fetchproc() {
+	interval := c.refresh
+	if interval <= 0 {
+		interval = 7 * 24 * time.Hour
+	}
+	timer := time.NewTimer(jitter(interval))
+	defer timer.Stop()
 	for {
 		select {
 		case <-c.action:
-		case <-time.After(7 * 24 * time.Hour):
+		case <-timer.C:
 		}
-		c.tryFetch()
-		time.Sleep(time.Second)
+		if atomic.LoadInt32(&c.state) == closed {
+			return
+		}
+		backoff := fetchMinInterval
+		for !c.tryFetch() {
+			if atomic.LoadInt32(&c.state) == closed {
+				return
+			}
+			time.Sleep(jitter(backoff))
+			if backoff *= 2; backoff > fetchMaxInterval {
+				backoff = fetchMaxInterval
+			}
+		}
+		time.Sleep(jitter(fetchMinInterval))
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(jitter(interval))
 	}
 }
 
+// jitter returns a random duration in [d/2, d] so that proxies don't fetch
+// from the cluster at the same time.
+func jitter(d time.Duration) time.Duration {
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
 func (c *cluster) toFetch() {
 	select {
 	case c.action <- struct{}{}:
@@ -172,6 +346,13 @@ func (c *cluster) tryFetch() bool {
 	}
 	for server := range shuffleMap {
 		conn := libnet.DialWithTimeout(server, c.dto, c.rto, c.wto)
+		if c.auth != "" {
+			if err := redis.Auth(conn, c.auth); err != nil {
+				log.Errorf("Redis Cluster fail to auth node:%s error:%v", server, err)
+				_ = conn.Close()
+				continue
+			}
+		}
 		f := newFetcher(conn)
 		nSlots, err := f.fetch()
 		if err != nil {
@@ -207,7 +388,7 @@ func (c *cluster) initSlotNode(nSlots *nodeSlots) {
 		ncp, ok := oncp[addr]
 		if !ok {
 			toAddr := addr // NOTE: avoid closure
-			ncp = proto.NewNodeConnPipe(c.conns, c.pipeCount, func() proto.NodeConn {
+			ncp = c.newPipe(func() proto.NodeConn {
 				return newNodeConn(c, toAddr)
 			})
 			go c.pipeEvent(ncp.ErrorEvent())
@@ -227,6 +408,7 @@ func (c *cluster) initSlotNode(nSlots *nodeSlots) {
 			return
 		}
 	}
+	unused := c.initReplicaPipes(sn, osn)
 	c.servers = masters
 	c.slotNode.Store(sn)
 	for addr, ncp := range oncp {
@@ -235,6 +417,20 @@ func (c *cluster) initSlotNode(nSlots *nodeSlots) {
 			log.Infof("Redis Cluster renew slot node and close addr:%s", addr)
 		}
 	}
+	for addr, ncp := range unused {
+		ncp.Close()
+		if log.V(4) {
+			log.Infof("Redis Cluster renew slot node and close replica addr:%s", addr)
+		}
+	}
+}
+
+// newPipe new the pipe of node, which is served by pool if not nil.
+func (c *cluster) newPipe(newNc func() proto.NodeConn) *proto.NodeConnPipe {
+	if c.pool != nil {
+		return c.pool.NewNodeConnPipe(c.conns, c.conns, c.pipeCount, 0, newNc)
+	}
+	return proto.NewNodeConnPipe(c.conns, c.pipeCount, newNc)
 }
 
 func (c *cluster) pipeEvent(errCh <-chan error) {
@@ -291,4 +487,6 @@ func (c *cluster) fake(listen string) {
 type slotNode struct {
 	nSlots   *nodeSlots
 	nodePipe map[string]*proto.NodeConnPipe
+	// replicaPipe is used to route reads by read preference.
+	replicaPipe map[string]*proto.NodeConnPipe
 }
@@ -0,0 +1,125 @@
+package cluster
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"overlord/proxy/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		d := jitter(time.Second)
+		assert.True(t, d >= 500*time.Millisecond && d <= time.Second, d)
+	}
+}
+
+func TestParseRedirect(t *testing.T) {
+	addr, slot, isAsk, err := parseRedirect([]byte("MOVED 3999 127.0.0.1:6381"))
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:6381", string(addr))
+	assert.Equal(t, 3999, slot)
+	assert.False(t, isAsk)
+
+	addr, slot, isAsk, err = parseRedirect([]byte("ASK 3999 127.0.0.1:6381"))
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:6381", string(addr))
+	assert.True(t, isAsk)
+}
+
+func TestFetchprocRefresh(t *testing.T) {
+	var fetches int32
+	addr, closeServer := _nodesServer(t, &fetches)
+	defer closeServer()
+
+	c := &cluster{
+		name:      "test",
+		servers:   []string{addr},
+		conns:     1,
+		pipeCount: 1,
+		dto:       time.Second,
+		rto:       time.Second,
+		wto:       time.Second,
+		action:    make(chan struct{}),
+		refresh:   10 * time.Millisecond,
+	}
+	defer c.Close()
+	go c.fetchproc()
+	for i := 0; i < 300 && atomic.LoadInt32(&fetches) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, atomic.LoadInt32(&fetches) >= 2, "refresh periodically")
+	sn, ok := c.slotNode.Load().(*slotNode)
+	assert.True(t, ok)
+	assert.Equal(t, addr, sn.nSlots.slots[0])
+}
+
+func TestClusterWorkerPool(t *testing.T) {
+	var fetches int32
+	addr, closeServer := _nodesServer(t, &fetches)
+	defer closeServer()
+
+	pool := proto.NewWorkerPool(1, 0)
+	c := &cluster{
+		name:      "test",
+		servers:   []string{addr},
+		conns:     1,
+		pipeCount: 1,
+		dto:       time.Second,
+		rto:       time.Second,
+		wto:       time.Second,
+		action:    make(chan struct{}),
+		pool:      pool,
+	}
+	assert.True(t, c.tryFetch())
+	sn, ok := c.slotNode.Load().(*slotNode)
+	assert.True(t, ok)
+	// NOTE: the conns served by pool are opened on demand
+	conns, _, _ := sn.nodePipe[addr].Stats()
+	assert.Equal(t, int32(0), conns)
+
+	assert.NoError(t, c.Close())
+	m := proto.GetMsgs(1)[0]
+	wg := &sync.WaitGroup{}
+	m.WithWaitGroup(wg)
+	sn.nodePipe[addr].Push(m)
+	wg.Wait()
+	assert.Error(t, m.Err())
+}
+
+func _nodesServer(t *testing.T, fetches *int32) (addr string, closeServer func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr = l.Addr().String()
+	nodes := "0000000000000000000000000000000000000001 " + addr + " myself,master - 0 0 1 connected 0-16383\n"
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				buf := make([]byte, 1024)
+				for {
+					n, err := conn.Read(buf)
+					if err != nil {
+						return
+					}
+					if strings.Contains(string(buf[:n]), "NODES") {
+						atomic.AddInt32(fetches, 1)
+						fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(nodes), nodes)
+					}
+				}
+			}(conn)
+		}
+	}()
+	return addr, func() { l.Close() }
+}
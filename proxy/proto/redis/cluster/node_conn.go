@@ -41,7 +41,7 @@ func newNodeConn(c *cluster, addr string) (nc proto.NodeConn) {
 	nc = &nodeConn{
 		c:    c,
 		addr: addr,
-		nc:   redis.NewNodeConn(c.name, addr, c.dto, c.rto, c.wto),
+		nc:   redis.NewNodeConn(c.name, addr, c.auth, 0, c.dto, c.rto, c.wto),
 	}
 	return
 }
@@ -72,7 +72,7 @@ func (nc *nodeConn) Read(m *proto.Message) (err error) {
 	}
 	req := m.Request().(*redis.Request)
 	// check request
-	if !req.IsSupport() || req.IsCtl() {
+	if req.IsLocal() {
 		return
 	}
 	reply := req.Reply()
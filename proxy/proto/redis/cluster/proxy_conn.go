@@ -36,7 +36,7 @@ func NewProxyConn(conn *libnet.Conn, fer proto.Forwarder) proto.ProxyConn {
 	}
 	r := &proxyConn{
 		c:  c,
-		pc: redis.NewProxyConn(conn, false),
+		pc: redis.NewProxyConn(conn, true),
 	}
 	return r
 }
@@ -79,3 +79,25 @@ func (pc *proxyConn) Encode(m *proto.Message) (err error) {
 func (pc *proxyConn) Flush() (err error) {
 	return pc.pc.Flush()
 }
+
+// BufferSizes impl proto.BufferSizer.
+func (pc *proxyConn) BufferSizes() (rbuf, wbuf int) {
+	if bs, ok := pc.pc.(proto.BufferSizer); ok {
+		return bs.BufferSizes()
+	}
+	return
+}
+
+// PrefixKeys impl proto.KeyPrefixer.
+func (pc *proxyConn) PrefixKeys(prefix []byte) {
+	if kp, ok := pc.pc.(proto.KeyPrefixer); ok {
+		kp.PrefixKeys(prefix)
+	}
+}
+
+// LimitSize impl proto.SizeLimiter.
+func (pc *proxyConn) LimitSize(maxKeyLen, maxValueSize int) {
+	if sl, ok := pc.pc.(proto.SizeLimiter); ok {
+		sl.LimitSize(maxKeyLen, maxValueSize)
+	}
+}
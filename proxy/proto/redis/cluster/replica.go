@@ -0,0 +1,228 @@
+package cluster
+
+import (
+	errs "errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"overlord/pkg/log"
+	libnet "overlord/pkg/net"
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/redis"
+)
+
+// read preferences of redis cluster.
+const (
+	ReadMaster        = "master"
+	ReadReplica       = "replica"
+	ReadPreferReplica = "prefer-replica"
+	ReadNearest       = "nearest"
+)
+
+const (
+	// probeInterval is the interval to measure the rtts of nodes.
+	probeInterval = time.Second
+	// rttWeight is the reciprocal of the weight of latest rtt.
+	rttWeight = 8
+)
+
+// errors
+var (
+	ErrNoReplica = errs.New("no replica of the slot")
+)
+
+var (
+	pingBytes = []byte("*1\r\n$4\r\nPING\r\n")
+)
+
+// ValidReadPreference returns whether or not the read preference is supported.
+func ValidReadPreference(pref string) bool {
+	switch pref {
+	case "", ReadMaster, ReadReplica, ReadPreferReplica, ReadNearest:
+		return true
+	}
+	return false
+}
+
+func newReplicaNodeConn(c *cluster, addr string) (nc proto.NodeConn) {
+	nc = &nodeConn{
+		c:    c,
+		addr: addr,
+		nc:   redis.NewReplicaNodeConn(c.name, addr, c.auth, c.dto, c.rto, c.wto),
+	}
+	return
+}
+
+// readPipe returns the pipe which the read of slot is routed to by read
+// preference, master pipe is returned when not ok.
+func (c *cluster) readPipe(sn *slotNode, slot int) (ncp *proto.NodeConnPipe, err error) {
+	master := sn.nSlots.slots[slot]
+	var replicas []string
+	for _, addr := range sn.nSlots.slaveSlots[slot] {
+		if _, ok := sn.replicaPipe[addr]; ok {
+			replicas = append(replicas, addr)
+		}
+	}
+	switch c.readPref {
+	case ReadReplica, ReadPreferReplica:
+		if len(replicas) > 0 {
+			return sn.replicaPipe[replicas[rand.Intn(len(replicas))]], nil
+		}
+		if c.readPref == ReadReplica {
+			return nil, ErrNoReplica
+		}
+	case ReadNearest:
+		rtts, _ := c.rtts.Load().(map[string]time.Duration)
+		nearest, min := "", rtts[master]
+		for _, addr := range replicas {
+			if rtt, ok := rtts[addr]; ok && (min == 0 || rtt < min) {
+				nearest, min = addr, rtt
+			}
+		}
+		if nearest != "" {
+			return sn.replicaPipe[nearest], nil
+		}
+	}
+	return sn.nodePipe[master], nil
+}
+
+// initReplicaPipes creates the pipes to replicas and reuses the old ones,
+// the old pipes not used are returned to be closed.
+func (c *cluster) initReplicaPipes(sn, osn *slotNode) (unused map[string]*proto.NodeConnPipe) {
+	unused = map[string]*proto.NodeConnPipe{}
+	if osn != nil {
+		for addr, ncp := range osn.replicaPipe {
+			unused[addr] = ncp
+		}
+	}
+	sn.replicaPipe = make(map[string]*proto.NodeConnPipe)
+	if c.readPref == "" || c.readPref == ReadMaster {
+		return
+	}
+	for _, addrs := range sn.nSlots.slaveSlots {
+		for _, addr := range addrs {
+			if _, ok := sn.replicaPipe[addr]; ok {
+				continue
+			}
+			ncp, ok := unused[addr]
+			if ok {
+				delete(unused, addr)
+			} else {
+				toAddr := addr // NOTE: avoid closure
+				ncp = c.newPipe(func() proto.NodeConn {
+					return newReplicaNodeConn(c, toAddr)
+				})
+				go c.pipeEvent(ncp.ErrorEvent())
+				if log.V(4) {
+					log.Infof("Redis Cluster renew slot node and add replica addr:%s", toAddr)
+				}
+			}
+			sn.replicaPipe[addr] = ncp
+		}
+	}
+	return
+}
+
+// probeproc measures the rtts of nodes periodically for nearest read, out of
+// the slots refreshing. The rtts are smoothed and the nodes failed are not
+// routed to until they answer again.
+func (c *cluster) probeproc() {
+	ticker := time.NewTicker(probeInterval)
+	defer ticker.Stop()
+	conns := make(map[string]*libnet.Conn)
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	for {
+		if atomic.LoadInt32(&c.state) == closed {
+			return
+		}
+		c.probe(conns)
+		<-ticker.C
+	}
+}
+
+// probe measures the rtts of all the nodes in parallel by the probe conns.
+func (c *cluster) probe(conns map[string]*libnet.Conn) {
+	sn, ok := c.slotNode.Load().(*slotNode)
+	if !ok || sn == nil {
+		return
+	}
+	var addrs []string
+	for addr := range sn.nodePipe {
+		addrs = append(addrs, addr)
+	}
+	for addr := range sn.replicaPipe {
+		addrs = append(addrs, addr)
+	}
+	var (
+		probes  = make([]*libnet.Conn, len(addrs))
+		samples = make([]time.Duration, len(addrs))
+		wg      sync.WaitGroup
+	)
+	for i, addr := range addrs {
+		probes[i] = conns[addr]
+		delete(conns, addr)
+		wg.Add(1)
+		go func(i int, addr string) {
+			defer wg.Done()
+			if probes[i] == nil {
+				probes[i] = libnet.DialWithTimeout(addr, c.dto, c.rto, c.wto)
+			}
+			samples[i] = rtt(probes[i])
+		}(i, addr)
+	}
+	wg.Wait()
+	// NOTE: the conns left are of the nodes removed
+	for addr, conn := range conns {
+		conn.Close()
+		delete(conns, addr)
+	}
+	old, _ := c.rtts.Load().(map[string]time.Duration)
+	rtts := make(map[string]time.Duration, len(addrs))
+	for i, addr := range addrs {
+		if samples[i] == 0 {
+			probes[i].Close()
+			continue
+		}
+		conns[addr] = probes[i]
+		if avg, ok := old[addr]; ok {
+			rtts[addr] = avg + (samples[i]-avg)/rttWeight
+		} else {
+			rtts[addr] = samples[i]
+		}
+	}
+	c.rtts.Store(rtts)
+}
+
+// rtt measures the round trip time of PING by conn, 0 if failed.
+func rtt(conn *libnet.Conn) time.Duration {
+	buf := make([]byte, 64)
+	start := time.Now()
+	if _, err := conn.Write(pingBytes); err != nil {
+		return 0
+	}
+	// NOTE: +PONG or -NOAUTH are both ok to measure rtt, the whole line must
+	// be read to keep the conn for the next probe.
+	for n := 0; ; {
+		m, err := conn.Read(buf[n:])
+		if err != nil {
+			return 0
+		}
+		if n += m; n > 0 && buf[n-1] == '\n' {
+			break
+		}
+		if n == len(buf) {
+			return 0
+		}
+	}
+	d := time.Since(start)
+	if d <= 0 {
+		d = 1
+	}
+	return d
+}
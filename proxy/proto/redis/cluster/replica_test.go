@@ -0,0 +1,111 @@
+package cluster
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	libnet "overlord/pkg/net"
+	"overlord/proxy/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func _slotNode() (sn *slotNode, master, replica *proto.NodeConnPipe) {
+	master, replica = &proto.NodeConnPipe{}, &proto.NodeConnPipe{}
+	slots := make([]string, slotsCount)
+	slaveSlots := make([][]string, slotsCount)
+	for i := range slots {
+		slots[i] = "m:1"
+	}
+	slaveSlots[1] = []string{"r:1"}
+	sn = &slotNode{
+		nSlots:      &nodeSlots{slots: slots, slaveSlots: slaveSlots},
+		nodePipe:    map[string]*proto.NodeConnPipe{"m:1": master},
+		replicaPipe: map[string]*proto.NodeConnPipe{"r:1": replica},
+	}
+	return
+}
+
+func TestReadPipeOk(t *testing.T) {
+	sn, master, replica := _slotNode()
+
+	c := &cluster{readPref: ReadReplica}
+	ncp, err := c.readPipe(sn, 1)
+	assert.NoError(t, err)
+	assert.True(t, ncp == replica)
+	_, err = c.readPipe(sn, 2)
+	assert.Equal(t, ErrNoReplica, err)
+
+	c.readPref = ReadPreferReplica
+	ncp, err = c.readPipe(sn, 2)
+	assert.NoError(t, err)
+	assert.True(t, ncp == master)
+
+	c.readPref = ReadNearest
+	ncp, _ = c.readPipe(sn, 1)
+	assert.True(t, ncp == master)
+	c.rtts.Store(map[string]time.Duration{"m:1": 2 * time.Millisecond, "r:1": time.Millisecond})
+	ncp, _ = c.readPipe(sn, 1)
+	assert.True(t, ncp == replica)
+	c.rtts.Store(map[string]time.Duration{"m:1": 2 * time.Millisecond, "r:1": 3 * time.Millisecond})
+	ncp, _ = c.readPipe(sn, 1)
+	assert.True(t, ncp == master)
+}
+
+func TestParseSlotsIgnoreFailedSlave(t *testing.T) {
+	data := "m1 127.0.0.1:7000@17000 myself,master - 0 0 1 connected 0-16383\n" +
+		"s1 127.0.0.1:7001@17001 slave m1 0 0 1 connected\n" +
+		"s2 127.0.0.1:7002@17002 slave,fail m1 0 0 1 disconnected\n"
+	ns, err := parseSlots([]byte(data))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.1:7001"}, ns.slaveSlots[0])
+}
+
+func TestProbe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				buf := make([]byte, 64)
+				for {
+					if _, err := conn.Read(buf); err != nil {
+						return
+					}
+					conn.Write([]byte("+PONG\r\n"))
+				}
+			}(conn)
+		}
+	}()
+	live, dead := l.Addr().String(), "127.0.0.1:1"
+	c := &cluster{dto: 100 * time.Millisecond, rto: 100 * time.Millisecond, wto: 100 * time.Millisecond}
+	c.slotNode.Store(&slotNode{
+		nodePipe:    map[string]*proto.NodeConnPipe{live: nil},
+		replicaPipe: map[string]*proto.NodeConnPipe{dead: nil},
+	})
+	conns := make(map[string]*libnet.Conn)
+	c.probe(conns)
+	rtts := c.rtts.Load().(map[string]time.Duration)
+	assert.NotZero(t, rtts[live])
+	_, ok := rtts[dead]
+	assert.False(t, ok)
+	assert.Len(t, conns, 1)
+
+	// NOTE: the conn is kept and the rtt is smoothed
+	probe := conns[live]
+	c.probe(conns)
+	assert.True(t, probe == conns[live])
+	assert.NotZero(t, c.rtts.Load().(map[string]time.Duration)[live])
+
+	c.slotNode.Store(&slotNode{})
+	c.probe(conns)
+	assert.Len(t, conns, 0)
+	assert.Len(t, c.rtts.Load().(map[string]time.Duration), 0)
+}
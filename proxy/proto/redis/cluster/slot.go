@@ -59,9 +59,9 @@ func parseSlots(data []byte) (*nodeSlots, error) {
 			slots[slot] = node.addr
 		}
 	}
-	// full fill slave slots
+	// full fill slave slots, the failed slaves are ignored
 	for _, node := range nodes {
-		if node.role != roleSlave {
+		if node.role != roleSlave || !node.isNormal() {
 			continue
 		}
 		if mn, ok := masterIDMap[node.slaveOf]; ok {
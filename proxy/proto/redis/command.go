@@ -0,0 +1,307 @@
+package redis
+
+import (
+	"strconv"
+	"strings"
+)
+
+var (
+	cmdCommandBytes = []byte("7\r\nCOMMAND")
+
+	commandNotSupportBytes = []byte("Error: COMMAND subcommand not support")
+)
+
+// commandInfo is the static reply of COMMAND INFO in the format of redis 5,
+// which is understood by all the smart clients.
+type commandInfo struct {
+	name  string
+	arity int
+	// flags are separated by space.
+	flags             string
+	first, last, step int
+	group             string
+}
+
+// commandTable is the commands supported by proxy, keys of the commands
+// with movablekeys are not described like redis.
+var commandTable = []*commandInfo{
+	{"dump", 2, "readonly", 1, 1, 1, "generic"},
+	{"exists", -2, "readonly fast", 1, -1, 1, "generic"},
+	{"pttl", 2, "readonly random fast", 1, 1, 1, "generic"},
+	{"ttl", 2, "readonly random fast", 1, 1, 1, "generic"},
+	{"type", 2, "readonly fast", 1, 1, 1, "generic"},
+	{"object", -2, "readonly random", 2, 2, 1, "generic"},
+	{"expiretime", 2, "readonly random fast", 1, 1, 1, "generic"},
+	{"pexpiretime", 2, "readonly random fast", 1, 1, 1, "generic"},
+	{"scan", -2, "readonly random", 0, 0, 0, "generic"},
+	{"del", -2, "write", 1, -1, 1, "generic"},
+	{"expire", 3, "write fast", 1, 1, 1, "generic"},
+	{"expireat", 3, "write fast", 1, 1, 1, "generic"},
+	{"persist", 2, "write fast", 1, 1, 1, "generic"},
+	{"pexpire", 3, "write fast", 1, 1, 1, "generic"},
+	{"pexpireat", 3, "write fast", 1, 1, 1, "generic"},
+	{"restore", -4, "write denyoom", 1, 1, 1, "generic"},
+	{"sort", -2, "write denyoom", 1, 1, 1, "generic"},
+	{"copy", -3, "write denyoom", 1, 2, 1, "generic"},
+	{"bitcount", -2, "readonly", 1, 1, 1, "bitmap"},
+	{"bitpos", -3, "readonly", 1, 1, 1, "bitmap"},
+	{"getbit", 3, "readonly fast", 1, 1, 1, "bitmap"},
+	{"setbit", 4, "write denyoom", 1, 1, 1, "bitmap"},
+	{"bitfield", -2, "write denyoom", 1, 1, 1, "bitmap"},
+	{"bitfield_ro", -2, "readonly fast", 1, 1, 1, "bitmap"},
+	{"get", 2, "readonly fast", 1, 1, 1, "string"},
+	{"getrange", 4, "readonly", 1, 1, 1, "string"},
+	{"mget", -2, "readonly fast", 1, -1, 1, "string"},
+	{"strlen", 2, "readonly fast", 1, 1, 1, "string"},
+	{"append", 3, "write denyoom fast", 1, 1, 1, "string"},
+	{"decr", 2, "write denyoom fast", 1, 1, 1, "string"},
+	{"decrby", 3, "write denyoom fast", 1, 1, 1, "string"},
+	{"getset", 3, "write denyoom fast", 1, 1, 1, "string"},
+	{"getex", -2, "write fast", 1, 1, 1, "string"},
+	{"getdel", 2, "write fast", 1, 1, 1, "string"},
+	{"incr", 2, "write denyoom fast", 1, 1, 1, "string"},
+	{"incrby", 3, "write denyoom fast", 1, 1, 1, "string"},
+	{"incrbyfloat", 3, "write denyoom fast", 1, 1, 1, "string"},
+	{"mset", -3, "write denyoom", 1, -1, 2, "string"},
+	{"psetex", 4, "write denyoom", 1, 1, 1, "string"},
+	{"set", -3, "write denyoom", 1, 1, 1, "string"},
+	{"setex", 4, "write denyoom", 1, 1, 1, "string"},
+	{"setnx", 3, "write denyoom fast", 1, 1, 1, "string"},
+	{"setrange", 4, "write denyoom", 1, 1, 1, "string"},
+	{"hexists", 3, "readonly fast", 1, 1, 1, "hash"},
+	{"hget", 3, "readonly fast", 1, 1, 1, "hash"},
+	{"hgetall", 2, "readonly random", 1, 1, 1, "hash"},
+	{"hkeys", 2, "readonly sort_for_script", 1, 1, 1, "hash"},
+	{"hlen", 2, "readonly fast", 1, 1, 1, "hash"},
+	{"hmget", -3, "readonly fast", 1, 1, 1, "hash"},
+	{"hstrlen", 3, "readonly fast", 1, 1, 1, "hash"},
+	{"hvals", 2, "readonly sort_for_script", 1, 1, 1, "hash"},
+	{"hscan", -3, "readonly random", 1, 1, 1, "hash"},
+	{"hrandfield", -2, "readonly random", 1, 1, 1, "hash"},
+	{"hdel", -3, "write fast", 1, 1, 1, "hash"},
+	{"hincrby", 4, "write denyoom fast", 1, 1, 1, "hash"},
+	{"hincrbyfloat", 4, "write denyoom fast", 1, 1, 1, "hash"},
+	{"hmset", -4, "write denyoom fast", 1, 1, 1, "hash"},
+	{"hset", -4, "write denyoom fast", 1, 1, 1, "hash"},
+	{"hsetnx", 4, "write denyoom fast", 1, 1, 1, "hash"},
+	{"lindex", 3, "readonly", 1, 1, 1, "list"},
+	{"llen", 2, "readonly fast", 1, 1, 1, "list"},
+	{"lrange", 4, "readonly", 1, 1, 1, "list"},
+	{"lpos", -3, "readonly", 1, 1, 1, "list"},
+	{"linsert", 5, "write denyoom", 1, 1, 1, "list"},
+	{"lpop", 2, "write fast", 1, 1, 1, "list"},
+	{"lpush", -3, "write denyoom fast", 1, 1, 1, "list"},
+	{"lpushx", -3, "write denyoom fast", 1, 1, 1, "list"},
+	{"lrem", 4, "write", 1, 1, 1, "list"},
+	{"lset", 4, "write denyoom", 1, 1, 1, "list"},
+	{"ltrim", 4, "write", 1, 1, 1, "list"},
+	{"rpop", 2, "write fast", 1, 1, 1, "list"},
+	{"rpoplpush", 3, "write denyoom", 1, 2, 1, "list"},
+	{"rpush", -3, "write denyoom fast", 1, 1, 1, "list"},
+	{"rpushx", -3, "write denyoom fast", 1, 1, 1, "list"},
+	{"lmove", 5, "write denyoom", 1, 2, 1, "list"},
+	{"lmpop", -4, "write movablekeys", 0, 0, 0, "list"},
+	{"blpop", -3, "write noscript", 1, -2, 1, "list"},
+	{"brpop", -3, "write noscript", 1, -2, 1, "list"},
+	{"brpoplpush", 4, "write denyoom noscript", 1, 2, 1, "list"},
+	{"blmove", 6, "write denyoom noscript", 1, 2, 1, "list"},
+	{"blmpop", -5, "write movablekeys", 0, 0, 0, "list"},
+	{"scard", 2, "readonly fast", 1, 1, 1, "set"},
+	{"sdiff", -2, "readonly sort_for_script", 1, -1, 1, "set"},
+	{"sinter", -2, "readonly sort_for_script", 1, -1, 1, "set"},
+	{"sismember", 3, "readonly fast", 1, 1, 1, "set"},
+	{"smismember", -3, "readonly fast", 1, 1, 1, "set"},
+	{"sintercard", -3, "readonly movablekeys", 0, 0, 0, "set"},
+	{"smembers", 2, "readonly sort_for_script", 1, 1, 1, "set"},
+	{"srandmember", -2, "readonly random", 1, 1, 1, "set"},
+	{"sunion", -2, "readonly sort_for_script", 1, -1, 1, "set"},
+	{"sscan", -3, "readonly random", 1, 1, 1, "set"},
+	{"sadd", -3, "write denyoom fast", 1, 1, 1, "set"},
+	{"smove", 4, "write fast", 1, 2, 1, "set"},
+	{"spop", -2, "write random fast", 1, 1, 1, "set"},
+	{"srem", -3, "write fast", 1, 1, 1, "set"},
+	{"sunionstore", -3, "write denyoom", 1, -1, 1, "set"},
+	{"zcard", 2, "readonly fast", 1, 1, 1, "sorted-set"},
+	{"zcount", 4, "readonly fast", 1, 1, 1, "sorted-set"},
+	{"zlexcount", 4, "readonly fast", 1, 1, 1, "sorted-set"},
+	{"zrange", -4, "readonly", 1, 1, 1, "sorted-set"},
+	{"zrangebylex", -4, "readonly", 1, 1, 1, "sorted-set"},
+	{"zrangebyscore", -4, "readonly", 1, 1, 1, "sorted-set"},
+	{"zrank", 3, "readonly fast", 1, 1, 1, "sorted-set"},
+	{"zrevrange", -4, "readonly", 1, 1, 1, "sorted-set"},
+	{"zrevrangebylex", -4, "readonly", 1, 1, 1, "sorted-set"},
+	{"zrevrangebyscore", -4, "readonly", 1, 1, 1, "sorted-set"},
+	{"zrevrank", 3, "readonly fast", 1, 1, 1, "sorted-set"},
+	{"zscore", 3, "readonly fast", 1, 1, 1, "sorted-set"},
+	{"zscan", -3, "readonly random", 1, 1, 1, "sorted-set"},
+	{"zmscore", -3, "readonly fast", 1, 1, 1, "sorted-set"},
+	{"zrandmember", -2, "readonly random", 1, 1, 1, "sorted-set"},
+	{"zinter", -3, "readonly movablekeys", 0, 0, 0, "sorted-set"},
+	{"zunion", -3, "readonly movablekeys", 0, 0, 0, "sorted-set"},
+	{"zdiff", -3, "readonly movablekeys", 0, 0, 0, "sorted-set"},
+	{"zintercard", -3, "readonly movablekeys", 0, 0, 0, "sorted-set"},
+	{"zadd", -4, "write denyoom fast", 1, 1, 1, "sorted-set"},
+	{"zincrby", 4, "write denyoom fast", 1, 1, 1, "sorted-set"},
+	{"zinterstore", -4, "write denyoom movablekeys", 0, 0, 0, "sorted-set"},
+	{"zrem", -3, "write fast", 1, 1, 1, "sorted-set"},
+	{"zremrangebylex", 4, "write", 1, 1, 1, "sorted-set"},
+	{"zremrangebyrank", 4, "write", 1, 1, 1, "sorted-set"},
+	{"zremrangebyscore", 4, "write", 1, 1, 1, "sorted-set"},
+	{"zunionstore", -4, "write denyoom movablekeys", 0, 0, 0, "sorted-set"},
+	{"bzpopmin", -3, "write noscript fast", 1, -2, 1, "sorted-set"},
+	{"bzpopmax", -3, "write noscript fast", 1, -2, 1, "sorted-set"},
+	{"bzmpop", -5, "write movablekeys", 0, 0, 0, "sorted-set"},
+	{"zrangestore", -5, "write denyoom", 1, 2, 1, "sorted-set"},
+	{"zmpop", -4, "write movablekeys", 0, 0, 0, "sorted-set"},
+	{"geoadd", -5, "write denyoom", 1, 1, 1, "geo"},
+	{"geopos", -2, "readonly", 1, 1, 1, "geo"},
+	{"geodist", -4, "readonly", 1, 1, 1, "geo"},
+	{"geohash", -2, "readonly", 1, 1, 1, "geo"},
+	{"geosearch", -7, "readonly", 1, 1, 1, "geo"},
+	{"geosearchstore", -8, "write denyoom", 1, 2, 1, "geo"},
+	{"georadius_ro", -6, "readonly", 1, 1, 1, "geo"},
+	{"georadiusbymember_ro", -5, "readonly", 1, 1, 1, "geo"},
+	{"pfcount", -2, "readonly", 1, -1, 1, "hyperloglog"},
+	{"pfadd", -2, "write denyoom fast", 1, 1, 1, "hyperloglog"},
+	{"pfmerge", -2, "write denyoom", 1, -1, 1, "hyperloglog"},
+	{"xadd", -5, "write denyoom random fast", 1, 1, 1, "stream"},
+	{"xdel", -3, "write fast", 1, 1, 1, "stream"},
+	{"xtrim", -4, "write random", 1, 1, 1, "stream"},
+	{"xlen", 2, "readonly fast", 1, 1, 1, "stream"},
+	{"xrange", -4, "readonly", 1, 1, 1, "stream"},
+	{"xrevrange", -4, "readonly", 1, 1, 1, "stream"},
+	{"xread", -4, "readonly movablekeys", 0, 0, 0, "stream"},
+	{"xreadgroup", -7, "write movablekeys", 0, 0, 0, "stream"},
+	{"xack", -4, "write random fast", 1, 1, 1, "stream"},
+	{"xclaim", -6, "write random fast", 1, 1, 1, "stream"},
+	{"xautoclaim", -6, "write random fast", 1, 1, 1, "stream"},
+	{"xpending", -3, "readonly random", 1, 1, 1, "stream"},
+	{"xsetid", 3, "write denyoom fast", 1, 1, 1, "stream"},
+	{"xgroup", -2, "write denyoom", 2, 2, 1, "stream"},
+	{"xinfo", -2, "readonly random", 2, 2, 1, "stream"},
+	{"eval", -3, "noscript movablekeys", 0, 0, 0, "scripting"},
+	{"evalsha", -3, "noscript movablekeys", 0, 0, 0, "scripting"},
+	{"publish", 3, "pubsub loading stale fast", 0, 0, 0, "pubsub"},
+	{"subscribe", -2, "pubsub noscript loading stale", 0, 0, 0, "pubsub"},
+	{"psubscribe", -2, "pubsub noscript loading stale", 0, 0, 0, "pubsub"},
+	{"unsubscribe", -1, "pubsub noscript loading stale", 0, 0, 0, "pubsub"},
+	{"punsubscribe", -1, "pubsub noscript loading stale", 0, 0, 0, "pubsub"},
+	{"quit", -1, "loading stale fast", 0, 0, 0, "connection"},
+	{"ping", -1, "stale fast", 0, 0, 0, "connection"},
+	{"echo", 2, "fast", 0, 0, 0, "connection"},
+	{"auth", -2, "noscript loading stale fast", 0, 0, 0, "connection"},
+	{"select", 2, "loading stale fast", 0, 0, 0, "connection"},
+	{"hello", -1, "noscript loading stale fast", 0, 0, 0, "connection"},
+	{"client", -2, "admin noscript random loading stale", 0, 0, 0, "connection"},
+	{"slowlog", -2, "admin random loading stale", 0, 0, 0, "server"},
+	{"command", -1, "random loading stale", 0, 0, 0, "server"},
+	{"info", -1, "random loading stale", 0, 0, 0, "server"},
+	{"time", 1, "random loading stale fast", 0, 0, 0, "server"},
+	{"multi", 1, "noscript loading stale fast", 0, 0, 0, "transactions"},
+	{"exec", 1, "noscript loading stale skip_slowlog", 0, 0, 0, "transactions"},
+	{"discard", 1, "noscript loading stale fast", 0, 0, 0, "transactions"},
+	{"watch", -2, "noscript loading stale fast", 1, -1, 1, "transactions"},
+	{"unwatch", 1, "noscript loading stale fast", 0, 0, 0, "transactions"},
+}
+
+var commandMap = map[string]*commandInfo{}
+
+func init() {
+	for _, ci := range commandTable {
+		commandMap[ci.name] = ci
+	}
+}
+
+// SetCommand resets resp as the reply of COMMAND, COMMAND COUNT, COMMAND
+// LIST, COMMAND INFO and COMMAND DOCS with args by the command table.
+func (r *RESP) SetCommand(args []*RESP) {
+	if len(args) == 0 {
+		r.setCommandInfos(nil)
+		return
+	}
+	names := make([]string, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		names = append(names, strings.ToLower(string(bulkData(arg))))
+	}
+	switch strings.ToUpper(string(bulkData(args[0]))) {
+	case "COUNT":
+		r.SetInt(int64(len(commandTable)))
+	case "LIST":
+		r.reset()
+		r.respType = respArray
+		for _, ci := range commandTable {
+			r.next().SetBulk([]byte(ci.name))
+		}
+		r.data = strconv.AppendInt(r.data, int64(r.arraySize), 10)
+	case "INFO":
+		r.setCommandInfos(names)
+	case "DOCS":
+		r.setCommandDocs(names)
+	default:
+		r.SetError(commandNotSupportBytes)
+	}
+}
+
+// setCommandInfos sets the infos of names, the unknown command is replied
+// by null and all the commands are replied if names is empty.
+func (r *RESP) setCommandInfos(names []string) {
+	r.reset()
+	r.respType = respArray
+	if len(names) == 0 {
+		for _, ci := range commandTable {
+			r.next().setCommandInfo(ci)
+		}
+	}
+	for _, name := range names {
+		ci, ok := commandMap[name]
+		if !ok {
+			r.next().SetNullBulk()
+			continue
+		}
+		r.next().setCommandInfo(ci)
+	}
+	r.data = strconv.AppendInt(r.data, int64(r.arraySize), 10)
+}
+
+func (r *RESP) setCommandInfo(ci *commandInfo) {
+	r.reset()
+	r.respType = respArray
+	r.next().SetBulk([]byte(ci.name))
+	r.next().SetInt(int64(ci.arity))
+	flags := r.next()
+	flags.respType = respArray
+	for _, flag := range strings.Fields(ci.flags) {
+		flags.next().SetString([]byte(flag))
+	}
+	flags.data = strconv.AppendInt(flags.data, int64(flags.arraySize), 10)
+	r.next().SetInt(int64(ci.first))
+	r.next().SetInt(int64(ci.last))
+	r.next().SetInt(int64(ci.step))
+	r.data = strconv.AppendInt(r.data, int64(r.arraySize), 10)
+}
+
+// setCommandDocs sets the flat array of name and docs of names, only the
+// group is documented and the unknown commands are ignored like redis.
+func (r *RESP) setCommandDocs(names []string) {
+	r.reset()
+	r.respType = respArray
+	docs := func(ci *commandInfo) {
+		r.next().SetBulk([]byte(ci.name))
+		doc := r.next()
+		doc.respType = respArray
+		doc.next().SetBulk([]byte("group"))
+		doc.next().SetBulk([]byte(ci.group))
+		doc.data = strconv.AppendInt(doc.data, int64(doc.arraySize), 10)
+	}
+	if len(names) == 0 {
+		for _, ci := range commandTable {
+			docs(ci)
+		}
+	}
+	for _, name := range names {
+		if ci, ok := commandMap[name]; ok {
+			docs(ci)
+		}
+	}
+	r.data = strconv.AppendInt(r.data, int64(r.arraySize), 10)
+}
@@ -0,0 +1,48 @@
+package redis
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"overlord/pkg/mockconn"
+	libnet "overlord/pkg/net"
+	"overlord/proxy/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandTable(t *testing.T) {
+	for cmd := range reqSupportCmdMap {
+		name := strings.ToLower(cmd[bytes.IndexByte([]byte(cmd), '\n')+1:])
+		_, ok := commandMap[name]
+		assert.True(t, ok, name)
+	}
+	assert.Len(t, commandMap, len(commandTable))
+}
+
+func TestEncodeCommand(t *testing.T) {
+	conn, buf := mockconn.CreateDownStreamConn()
+	pc := NewProxyConn(libnet.NewConn(conn, time.Second, time.Second), true)
+	for _, cmd := range []string{"command count", "command info get nosuch", "command docs mset nosuch", "command getkeys get a"} {
+		rpc := NewProxyConn(libnet.NewConn(mockconn.CreateConn([]byte(cmd+"\r\n"), 1), time.Second, time.Second), true)
+		msgs, err := rpc.Decode(proto.GetMsgs(1))
+		assert.NoError(t, err)
+		assert.NoError(t, pc.Encode(msgs[0]))
+	}
+	assert.NoError(t, pc.Flush())
+	assert.Equal(t, ":"+strconv.Itoa(len(commandTable))+"\r\n"+
+		"*2\r\n*6\r\n$3\r\nget\r\n:2\r\n*2\r\n+readonly\r\n+fast\r\n:1\r\n:1\r\n:1\r\n$-1\r\n"+
+		"*2\r\n$4\r\nmset\r\n*2\r\n$5\r\ngroup\r\n$6\r\nstring\r\n"+
+		"-Error: COMMAND subcommand not support\r\n", buf.String())
+
+	rpc := NewProxyConn(libnet.NewConn(mockconn.CreateConn([]byte("*1\r\n$7\r\nCOMMAND\r\n"), 1), time.Second, time.Second), true)
+	msgs, err := rpc.Decode(proto.GetMsgs(1))
+	assert.NoError(t, err)
+	assert.NoError(t, pc.Encode(msgs[0]))
+	req := msgs[0].Request().(*Request)
+	assert.Equal(t, len(commandTable), req.reply.arraySize)
+	assert.Equal(t, commandTable[len(commandTable)-1].name, string(bulkData(req.reply.array[len(commandTable)-1].array[0])))
+}
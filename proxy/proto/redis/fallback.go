@@ -0,0 +1,74 @@
+package redis
+
+import (
+	"bytes"
+	"strconv"
+	"time"
+
+	"overlord/proxy/proto"
+)
+
+var pxBytes = []byte("PX")
+
+// Missed impl proto.Fallbacker, only GET and the single key MGET splitted
+// from MGET are missed by the null value.
+func (r *Request) Missed() bool {
+	if !r.IsGet() {
+		return false
+	}
+	v := r.value()
+	return v != nil && ((v.respType == respBulk && len(v.data) == 0) || v.respType == respNull)
+}
+
+// Fallback impl proto.Fallbacker.
+func (r *Request) Fallback() proto.Request {
+	c := getReq()
+	c.resp.copy(r.resp)
+	return c
+}
+
+// Answer impl proto.Fallbacker, the value is written back by SET with PX
+// if ttl is positive.
+func (r *Request) Answer(fr proto.Request, ttl time.Duration) proto.Request {
+	o, ok := fr.(*Request)
+	if !ok {
+		return nil
+	}
+	fv, v := o.value(), r.value()
+	if fv == nil || v == nil || fv.respType != respBulk || len(fv.data) == 0 {
+		return nil
+	}
+	v.copy(fv)
+	w := getReq()
+	w.resp.respType = respArray
+	cmd := w.resp.next()
+	cmd.respType = respBulk
+	cmd.data = append(cmd.data, cmdSetBytes...)
+	w.resp.next().copy(r.resp.array[1])
+	w.resp.next().copy(fv)
+	if ms := int64(ttl / time.Millisecond); ms > 0 {
+		w.resp.next().SetBulk(pxBytes)
+		w.resp.next().SetBulk(strconv.AppendInt(nil, ms, 10))
+	}
+	w.resp.data = strconv.AppendInt(w.resp.data, int64(w.resp.arraySize), 10)
+	return w
+}
+
+// value returns the value of key in the reply, which is in the reply of
+// the request merged into if merged.
+func (r *Request) value() *resp {
+	reply, idx := r.reply, 0
+	if r.merged && r.mergedTo != nil {
+		reply, idx = r.mergedTo.reply, r.mergedIdx
+	}
+	if reply.respType != respArray {
+		if bytes.Equal(r.resp.array[0].data, cmdMGetBytes) {
+			return nil
+		}
+		return reply
+	}
+	if idx >= reply.arraySize {
+		return nil
+	}
+	return reply.array[idx]
+}
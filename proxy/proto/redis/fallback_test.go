@@ -0,0 +1,57 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"overlord/proxy/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func args(r *Request) (as []string) {
+	for _, a := range r.resp.array[:r.resp.arraySize] {
+		as = append(as, string(bulkData(a)))
+	}
+	return
+}
+
+func TestRequestFallbackMerged(t *testing.T) {
+	msgs := decodeMsgs(t, "MGET a b c\r\n", 1)
+	subs := msgs[0].Batch()
+	ra, rb, rc := subs[0].Request().(*Request), subs[1].Request().(*Request), subs[2].Request().(*Request)
+	assert.NoError(t, ra.Merge([]proto.Request{rc}))
+	setReply(t, ra.reply, "*2\r\n$2\r\nva\r\n$-1\r\n")
+	setReply(t, rb.reply, "*1\r\n$-1\r\n")
+	assert.False(t, ra.Missed())
+	assert.True(t, rb.Missed())
+	assert.True(t, rc.Missed())
+
+	fr := rc.Fallback().(*Request)
+	assert.Equal(t, []string{"MGET", "c"}, args(fr))
+	setReply(t, fr.reply, "*1\r\n$2\r\nvc\r\n")
+	w := rc.Answer(fr, 2*time.Second).(*Request)
+	assert.True(t, w.IsWrite())
+	assert.Equal(t, []string{"SET", "c", "vc", "PX", "2000"}, args(w))
+
+	fr = rb.Fallback().(*Request)
+	setReply(t, fr.reply, "*1\r\n$-1\r\n")
+	assert.Nil(t, rb.Answer(fr, 0))
+	assert.Equal(t, "*3\r\n$2\r\nva\r\n$-1\r\n$2\r\nvc\r\n", encodeMsg(t, msgs[0]))
+}
+
+func TestRequestFallbackGet(t *testing.T) {
+	msgs := decodeMsgs(t, "GET a\r\nHGET a b\r\n", 2)
+	r := msgs[0].Request().(*Request)
+	setReply(t, r.reply, "$-1\r\n")
+	assert.True(t, r.Missed())
+	fr := r.Fallback().(*Request)
+	setReply(t, fr.reply, "$2\r\nva\r\n")
+	w := r.Answer(fr, 0).(*Request)
+	assert.Equal(t, []string{"SET", "a", "va"}, args(w))
+	assert.Equal(t, "$2\r\nva\r\n", encodeMsg(t, msgs[0]))
+
+	r = msgs[1].Request().(*Request)
+	setReply(t, r.reply, "$-1\r\n")
+	assert.False(t, r.Missed())
+}
@@ -0,0 +1,62 @@
+package redis
+
+import (
+	"bytes"
+	"strconv"
+)
+
+var (
+	cmdHelloBytes = []byte("5\r\nHELLO")
+)
+
+// HelloInfo is the properties of proxy replied by HELLO.
+type HelloInfo struct {
+	Server  string
+	Version string
+	Proto   int
+	ID      int64
+	Mode    string
+	Role    string
+}
+
+// IsHello is HELLO command which answered by proxy itself.
+func (r *Request) IsHello() bool {
+	return r.resp.arraySize > 0 && bytes.Equal(r.resp.array[0].data, cmdHelloBytes)
+}
+
+// SetHello resets resp as the reply of HELLO, it's a map in RESP3 and a
+// flat array of key and value in RESP2.
+func (r *RESP) SetHello(hi *HelloInfo) {
+	r.reset()
+	r.respType = respArray
+	if hi.Proto == 3 {
+		r.respType = respMap
+	}
+	bulk := func(v string) { r.next().SetBulk([]byte(v)) }
+	integer := func(i int64) {
+		ir := r.next()
+		ir.respType = respInt
+		ir.data = strconv.AppendInt(ir.data, i, 10)
+	}
+	bulk("server")
+	bulk(hi.Server)
+	bulk("version")
+	bulk(hi.Version)
+	bulk("proto")
+	integer(int64(hi.Proto))
+	bulk("id")
+	integer(hi.ID)
+	bulk("mode")
+	bulk(hi.Mode)
+	bulk("role")
+	bulk(hi.Role)
+	bulk("modules")
+	modules := r.next()
+	modules.respType = respArray
+	modules.data = append(modules.data, '0')
+	if hi.Proto == 3 {
+		r.data = strconv.AppendInt(r.data, int64(r.arraySize/2), 10)
+	} else {
+		r.data = strconv.AppendInt(r.data, int64(r.arraySize), 10)
+	}
+}
@@ -0,0 +1,157 @@
+package redis
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"overlord/proxy/proto"
+)
+
+var (
+	cmdInfoBytes = []byte("4\r\nINFO")
+
+	infoSectionBytes = []byte("# ")
+	infoAvgPrefix    = "avg_"
+)
+
+// IsInfo is INFO command which answered by proxy itself, it is sent to the
+// nodes only if the sections of nodes are merged.
+func (r *Request) IsInfo() bool {
+	return r.resp.arraySize > 0 && bytes.Equal(r.resp.array[0].data, cmdInfoBytes)
+}
+
+// InfoSections returns the lower case sections of INFO, empty means the
+// default sections.
+func (r *Request) InfoSections() (sections []string) {
+	for _, arg := range r.resp.array[1:r.resp.arraySize] {
+		sections = append(sections, strings.ToLower(string(bulkData(arg))))
+	}
+	return
+}
+
+// WithInfoReqs makes INFO message m to be batch of n same requests which
+// are sent to n nodes.
+func WithInfoReqs(m *proto.Message, n int) {
+	req, ok := m.Request().(*Request)
+	if !ok {
+		return
+	}
+	for i := len(m.Requests()); i < n; i++ {
+		r := getReq()
+		r.resp.copy(req.resp)
+		m.WithRequest(r)
+	}
+}
+
+// infoField is the field of INFO section, the values are in the order of
+// nodes.
+type infoField struct {
+	name   string
+	values []string
+}
+
+// MergeInfo merges sections of the INFO replies of batch m, the replies not
+// bulk such as error are ignored. The integer values are summed except the
+// avg_ ones and the others are kept as the first node, the values like
+// db0:keys=1,expires=0 are merged by each key.
+func MergeInfo(m *proto.Message, sections []string) []byte {
+	var (
+		names  []string
+		fields = map[string][]*infoField{}
+		index  = map[string]*infoField{}
+	)
+	wanted := map[string]bool{}
+	for _, s := range sections {
+		wanted[s] = true
+	}
+	for _, r := range m.Requests() {
+		req, ok := r.(*Request)
+		if !ok || req.reply.respType != respBulk || len(req.reply.data) == 0 {
+			continue
+		}
+		var section string
+		for _, line := range bytes.Split(bulkData(req.reply), crlfBytes) {
+			if bytes.HasPrefix(line, infoSectionBytes) {
+				section = string(line[len(infoSectionBytes):])
+				if _, ok := fields[section]; !ok && wanted[strings.ToLower(section)] {
+					names = append(names, section)
+					fields[section] = nil
+				}
+				continue
+			}
+			idx := bytes.IndexByte(line, ':')
+			if idx <= 0 || !wanted[strings.ToLower(section)] {
+				continue
+			}
+			key := section + "\n" + string(line[:idx])
+			f, ok := index[key]
+			if !ok {
+				f = &infoField{name: string(line[:idx])}
+				index[key] = f
+				fields[section] = append(fields[section], f)
+			}
+			f.values = append(f.values, string(line[idx+1:]))
+		}
+	}
+	var buf bytes.Buffer
+	for i, section := range names {
+		if i > 0 {
+			buf.Write(crlfBytes)
+		}
+		buf.Write(infoSectionBytes)
+		buf.WriteString(section)
+		buf.Write(crlfBytes)
+		for _, f := range fields[section] {
+			buf.WriteString(f.name)
+			buf.WriteByte(':')
+			buf.WriteString(mergeInfoValue(f.name, f.values))
+			buf.Write(crlfBytes)
+		}
+	}
+	return buf.Bytes()
+}
+
+func mergeInfoValue(name string, values []string) string {
+	if strings.Contains(values[0], "=") {
+		return mergeInfoPairs(values)
+	}
+	if strings.HasPrefix(name, infoAvgPrefix) {
+		return values[0]
+	}
+	var sum int64
+	for _, v := range values {
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return values[0]
+		}
+		sum += i
+	}
+	return strconv.FormatInt(sum, 10)
+}
+
+// mergeInfoPairs merges the values like keys=1,expires=0 of nodes.
+func mergeInfoPairs(values []string) string {
+	var (
+		keys   []string
+		merged = map[string][]string{}
+	)
+	for _, v := range values {
+		for _, pair := range strings.Split(v, ",") {
+			idx := strings.IndexByte(pair, '=')
+			if idx <= 0 {
+				continue
+			}
+			k := pair[:idx]
+			if _, ok := merged[k]; !ok {
+				keys = append(keys, k)
+			}
+			merged[k] = append(merged[k], pair[idx+1:])
+		}
+	}
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+mergeInfoValue(k, merged[k]))
+	}
+	return strings.Join(pairs, ",")
+}
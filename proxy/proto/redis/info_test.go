@@ -0,0 +1,32 @@
+package redis
+
+import (
+	"testing"
+
+	"overlord/proxy/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeInfo(t *testing.T) {
+	msg := proto.NewMessage()
+	req := getReq()
+	req.resp.respType = respArray
+	req.resp.data = append(req.resp.data, '1')
+	req.resp.next().SetBulk([]byte("INFO"))
+	req.resp.array[0].data = append(req.resp.array[0].data[:0], cmdInfoBytes...)
+	msg.WithRequest(req)
+	assert.True(t, req.IsInfo())
+	assert.Len(t, req.InfoSections(), 0)
+
+	WithInfoReqs(msg, 3)
+	reqs := msg.Requests()
+	assert.Len(t, reqs, 3)
+	reqs[0].(*Request).reply.SetBulk([]byte("# Server\r\nredis_version:6.0.0\r\n\r\n# Memory\r\nused_memory:100\r\nused_memory_human:100B\r\n\r\n# Keyspace\r\ndb0:keys=2,expires=1,avg_ttl=10\r\n"))
+	reqs[1].(*Request).reply.SetBulk([]byte("# Memory\r\nused_memory:50\r\nused_memory_human:50B\r\n\r\n# Keyspace\r\ndb0:keys=3,expires=0,avg_ttl=20\r\ndb1:keys=1,expires=0,avg_ttl=0\r\n"))
+	reqs[2].(*Request).reply.SetError([]byte("ERR"))
+
+	merged := MergeInfo(msg, []string{"memory", "keyspace"})
+	assert.Equal(t, "# Memory\r\nused_memory:150\r\nused_memory_human:100B\r\n\r\n# Keyspace\r\ndb0:keys=5,expires=1,avg_ttl=10\r\ndb1:keys=1,expires=0,avg_ttl=0\r\n", string(merged))
+	assert.Len(t, MergeInfo(msg, []string{"stats"}), 0)
+}
@@ -0,0 +1,609 @@
+package redis
+
+import (
+	"bytes"
+	errs "errors"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"overlord/pkg/bufio"
+	"overlord/pkg/conv"
+	libnet "overlord/pkg/net"
+	"overlord/proxy/proto"
+
+	"github.com/pkg/errors"
+)
+
+// the translation of redis string commands into memcache text protocol:
+//
+//	GET|MGET <key>*            get <key>*
+//	EXISTS <key>*              get <key>*, counts the found
+//	SET <key> <value> [EX|PX|EXAT|PXAT <time>] [NX|XX]
+//	                           set|add|replace <key> 0 <exptime> <bytes>
+//	SETEX|PSETEX|SETNX         set|add
+//	MSET <key> <value>*        set for every key
+//	DEL <key>*                 delete for every key
+//	INCR|DECR|INCRBY|DECRBY    incr|decr <key> <delta>
+//	EXPIRE <key> <seconds>     touch <key> <exptime>
+//
+// The flags of memcache are ignored. Unlike redis, INCR of key not exists
+// is replied with error and DECR never decreases below 0 as memcached. The
+// other commands are replied with error.
+var (
+	cmdSetExBytes  = []byte("5\r\nSETEX")
+	cmdPSetExBytes = []byte("6\r\nPSETEX")
+	cmdSetNxBytes  = []byte("5\r\nSETNX")
+	cmdIncrBytes   = []byte("4\r\nINCR")
+	cmdDecrBytes   = []byte("4\r\nDECR")
+	cmdIncrByBytes = []byte("6\r\nINCRBY")
+	cmdDecrByBytes = []byte("6\r\nDECRBY")
+	cmdExpireBytes = []byte("6\r\nEXPIRE")
+
+	mcGetBytes     = []byte("get")
+	mcSetBytes     = []byte("set")
+	mcAddBytes     = []byte("add")
+	mcReplaceBytes = []byte("replace")
+	mcDeleteBytes  = []byte("delete")
+	mcIncrBytes    = []byte("incr")
+	mcDecrBytes    = []byte("decr")
+	mcTouchBytes   = []byte("touch")
+
+	mcValueBytes       = []byte("VALUE ")
+	mcEndBytes         = []byte("END\r\n")
+	mcStoredBytes      = []byte("STORED\r\n")
+	mcDeletedBytes     = []byte("DELETED\r\n")
+	mcTouchedBytes     = []byte("TOUCHED\r\n")
+	mcNotFoundBytes    = []byte("NOT_FOUND\r\n")
+	mcClientErrorBytes = []byte("CLIENT_ERROR")
+
+	spaceBytes = []byte(" ")
+	zeroBytes  = []byte("0")
+)
+
+// errors
+var (
+	ErrMemcacheUnsupported = errs.New("ERR command not supported by memcache backend")
+	ErrMemcacheBadKey      = errs.New("ERR invalid key for memcache backend")
+	ErrMemcacheSyntax      = errs.New("ERR syntax error")
+	ErrMemcacheExpire      = errs.New("ERR invalid expire time")
+	ErrMemcacheNoKey       = errs.New("ERR no such key")
+)
+
+// maxRelativeExptime is the max exptime in seconds taken as relative by
+// memcached, the larger is taken as unix time.
+const maxRelativeExptime = 60 * 60 * 24 * 30
+
+// mcOp is the kind of memcache command translated from redis.
+type mcOp uint8
+
+const (
+	mcOpGet mcOp = iota
+	mcOpExists
+	mcOpStore
+	mcOpDelete
+	mcOpIncr
+	mcOpTouch
+)
+
+// mcCall is the memcache commands of one redis request.
+type mcCall struct {
+	op     mcOp
+	cmd    []byte
+	keys   [][]byte
+	values [][]byte
+	// exptime is the exptime of store and touch, delta of incr or decr.
+	exptime int64
+	delta   []byte
+	// array is true if replied as array such as MGET, count is true if
+	// replied as integer 1 or 0 such as SETNX.
+	array, count bool
+}
+
+type mcNodeConn struct {
+	cluster string
+	addr    string
+	conn    *libnet.Conn
+	bw      *bufio.Writer
+	br      *bufio.Reader
+
+	state int32
+}
+
+// NewMemcacheNodeConn create the node conn which translates the redis
+// requests into memcache text protocol and the replies back.
+func NewMemcacheNodeConn(cluster, addr string, dialTimeout, readTimeout, writeTimeout time.Duration) proto.NodeConn {
+	conn := libnet.DialWithTimeout(addr, dialTimeout, readTimeout, writeTimeout)
+	return newMemcacheNodeConn(cluster, addr, conn)
+}
+
+func newMemcacheNodeConn(cluster, addr string, conn *libnet.Conn) *mcNodeConn {
+	return &mcNodeConn{
+		cluster: cluster,
+		addr:    addr,
+		conn:    conn,
+		br:      bufio.NewReader(conn, bufio.Get(nodeReadBufSize)),
+		bw:      bufio.NewWriter(conn),
+	}
+}
+
+func (nc *mcNodeConn) Addr() string {
+	return nc.addr
+}
+
+func (nc *mcNodeConn) Cluster() string {
+	return nc.cluster
+}
+
+func (nc *mcNodeConn) Write(m *proto.Message) (err error) {
+	if nc.Closed() {
+		err = errors.WithStack(ErrNodeConnClosed)
+		return
+	}
+	req, ok := m.Request().(*Request)
+	if !ok {
+		err = errors.WithStack(ErrBadAssert)
+		return
+	}
+	if req.IsLocal() {
+		return
+	}
+	call, cerr := translateMemcache(req)
+	if cerr != nil {
+		// NOTE: replied by Read without sending
+		return
+	}
+	switch call.op {
+	case mcOpGet, mcOpExists:
+		_ = nc.bw.Write(mcGetBytes)
+		for _, key := range call.keys {
+			_ = nc.bw.Write(spaceBytes)
+			_ = nc.bw.Write(key)
+		}
+		err = nc.bw.Write(crlfBytes)
+	case mcOpStore:
+		for i, key := range call.keys {
+			nc.writeLine(call.cmd, key, zeroBytes, strconv.AppendInt(nil, call.exptime, 10), strconv.AppendInt(nil, int64(len(call.values[i])), 10))
+			_ = nc.bw.Write(call.values[i])
+			err = nc.bw.Write(crlfBytes)
+		}
+	case mcOpDelete:
+		for _, key := range call.keys {
+			err = nc.writeLine(mcDeleteBytes, key)
+		}
+	case mcOpIncr:
+		err = nc.writeLine(call.cmd, call.keys[0], call.delta)
+	case mcOpTouch:
+		err = nc.writeLine(mcTouchBytes, call.keys[0], strconv.AppendInt(nil, call.exptime, 10))
+	}
+	return
+}
+
+func (nc *mcNodeConn) writeLine(fields ...[]byte) error {
+	for i, field := range fields {
+		if i > 0 {
+			_ = nc.bw.Write(spaceBytes)
+		}
+		_ = nc.bw.Write(field)
+	}
+	return nc.bw.Write(crlfBytes)
+}
+
+func (nc *mcNodeConn) Flush() error {
+	if nc.Closed() {
+		return errors.WithStack(ErrNodeConnClosed)
+	}
+	return nc.bw.Flush()
+}
+
+func (nc *mcNodeConn) Read(m *proto.Message) (err error) {
+	if nc.Closed() {
+		err = errors.WithStack(ErrNodeConnClosed)
+		return
+	}
+	req, ok := m.Request().(*Request)
+	if !ok {
+		err = errors.WithStack(ErrBadAssert)
+		return
+	}
+	if req.IsLocal() {
+		return
+	}
+	call, cerr := translateMemcache(req)
+	if cerr != nil {
+		req.reply.SetError([]byte(cerr.Error()))
+		return
+	}
+	switch call.op {
+	case mcOpGet, mcOpExists:
+		return nc.readValues(req, call)
+	case mcOpStore:
+		return nc.readStored(req, call)
+	case mcOpDelete:
+		var deleted int64
+		for range call.keys {
+			var line []byte
+			if line, err = nc.readLine(); err != nil {
+				return
+			}
+			if bytes.Equal(line, mcDeletedBytes) {
+				deleted++
+			}
+		}
+		req.reply.SetInt(deleted)
+	case mcOpIncr:
+		var line []byte
+		if line, err = nc.readLine(); err != nil {
+			return
+		}
+		switch {
+		case bytes.Equal(line, mcNotFoundBytes):
+			req.reply.SetError([]byte(ErrMemcacheNoKey.Error()))
+		case bytes.HasPrefix(line, mcClientErrorBytes):
+			req.reply.SetError([]byte(ErrBadNumKeys.Error()))
+		default:
+			if n, perr := conv.Btoi(bytes.TrimSpace(line)); perr == nil {
+				req.reply.SetInt(n)
+			} else {
+				nc.replyError(req, line)
+			}
+		}
+	case mcOpTouch:
+		var line []byte
+		if line, err = nc.readLine(); err != nil {
+			return
+		}
+		if bytes.Equal(line, mcTouchedBytes) {
+			req.reply.SetInt(1)
+		} else if bytes.Equal(line, mcNotFoundBytes) {
+			req.reply.SetInt(0)
+		} else {
+			nc.replyError(req, line)
+		}
+	}
+	return
+}
+
+// readValues reads the values of get until END, the values are replied in
+// the order of keys, or the count of found keys for EXISTS.
+func (nc *mcNodeConn) readValues(req *Request, call *mcCall) (err error) {
+	values := make([][]byte, len(call.keys))
+	found := make([]bool, len(call.keys))
+	var errLine []byte
+	for {
+		var line []byte
+		if line, err = nc.readLine(); err != nil {
+			return
+		}
+		if bytes.Equal(line, mcEndBytes) {
+			break
+		}
+		if !bytes.HasPrefix(line, mcValueBytes) {
+			// NOTE: ERROR or SERVER_ERROR replied by node
+			errLine = line
+			break
+		}
+		fields := bytes.Fields(line[len(mcValueBytes):])
+		if len(fields) < 3 {
+			err = errors.WithStack(ErrBadRequest)
+			return
+		}
+		length, perr := strconv.Atoi(string(fields[2]))
+		if perr != nil || length < 0 {
+			err = errors.WithStack(ErrBadRequest)
+			return
+		}
+		var data []byte
+		if data, err = nc.readExact(length + 2); err != nil {
+			return
+		}
+		for i, key := range call.keys {
+			if !found[i] && bytes.Equal(key, fields[0]) {
+				found[i] = true
+				values[i] = append([]byte(nil), data[:length]...)
+				break
+			}
+		}
+	}
+	if errLine != nil {
+		nc.replyError(req, errLine)
+		return
+	}
+	if call.op == mcOpExists {
+		var n int64
+		for _, f := range found {
+			if f {
+				n++
+			}
+		}
+		req.reply.SetInt(n)
+		return
+	}
+	if !call.array {
+		if found[0] {
+			req.reply.SetBulk(values[0])
+		} else {
+			req.reply.SetNullBulk()
+		}
+		return
+	}
+	req.reply.reset()
+	req.reply.respType = respArray
+	req.reply.data = strconv.AppendInt(req.reply.data, int64(len(values)), 10)
+	for i, v := range values {
+		if found[i] {
+			req.reply.next().SetBulk(v)
+		} else {
+			req.reply.next().SetNullBulk()
+		}
+	}
+	return
+}
+
+// readStored reads the reply of every stored key, replied OK if all are
+// stored, null or 0 if any is not stored.
+func (nc *mcNodeConn) readStored(req *Request, call *mcCall) (err error) {
+	stored := true
+	var errLine []byte
+	for range call.keys {
+		var line []byte
+		if line, err = nc.readLine(); err != nil {
+			return
+		}
+		if !bytes.Equal(line, mcStoredBytes) {
+			stored = false
+			if !bytes.HasPrefix(line, []byte("NOT_STORED")) && errLine == nil {
+				errLine = line
+			}
+		}
+	}
+	switch {
+	case errLine != nil:
+		nc.replyError(req, errLine)
+	case call.count && stored:
+		req.reply.SetInt(1)
+	case call.count:
+		req.reply.SetInt(0)
+	case stored:
+		req.reply.SetString(justOkBytes)
+	default:
+		req.reply.SetNullBulk()
+	}
+	return
+}
+
+func (nc *mcNodeConn) replyError(req *Request, line []byte) {
+	req.reply.SetError(append([]byte("ERR "), bytes.TrimSpace(line)...))
+}
+
+func (nc *mcNodeConn) readLine() (line []byte, err error) {
+	for {
+		if line, err = nc.br.ReadLine(); err == bufio.ErrBufferFull {
+			if err = nc.br.Read(); err != nil {
+				err = errors.WithStack(err)
+				return
+			}
+			continue
+		} else if err != nil {
+			err = errors.WithStack(err)
+		}
+		return
+	}
+}
+
+func (nc *mcNodeConn) readExact(n int) (data []byte, err error) {
+	for {
+		if data, err = nc.br.ReadExact(n); err == bufio.ErrBufferFull {
+			if err = nc.br.Read(); err != nil {
+				err = errors.WithStack(err)
+				return
+			}
+			continue
+		} else if err != nil {
+			err = errors.WithStack(err)
+		}
+		return
+	}
+}
+
+// SetReadTimeout impl proto.ReadTimeouter.
+func (nc *mcNodeConn) SetReadTimeout(timeout time.Duration) {
+	nc.conn.SetReadTimeout(timeout)
+}
+
+func (nc *mcNodeConn) Close() (err error) {
+	if atomic.CompareAndSwapInt32(&nc.state, opened, closed) {
+		return nc.conn.Close()
+	}
+	return
+}
+
+func (nc *mcNodeConn) Closed() bool {
+	return atomic.LoadInt32(&nc.state) == closed
+}
+
+// translateMemcache returns the memcache commands of req, the error is
+// replied to client if req can't be translated.
+func translateMemcache(req *Request) (call *mcCall, err error) {
+	args := req.resp.array[:req.resp.arraySize]
+	if len(args) < 2 {
+		return nil, ErrMemcacheUnsupported
+	}
+	cmd := args[0].data
+	call = &mcCall{}
+	for _, k := range args[1:] {
+		call.keys = append(call.keys, bulkData(k))
+	}
+	switch {
+	case bytes.Equal(cmd, cmdGetBytes):
+		if len(args) != 2 {
+			return nil, ErrWrongParamCount
+		}
+		call.op = mcOpGet
+	case bytes.Equal(cmd, cmdMGetBytes):
+		call.op, call.array = mcOpGet, true
+	case bytes.Equal(cmd, cmdExistsBytes):
+		call.op = mcOpExists
+	case bytes.Equal(cmd, cmdDelBytes):
+		call.op = mcOpDelete
+	case bytes.Equal(cmd, cmdMSetBytes):
+		if len(args)%2 == 0 {
+			return nil, ErrWrongParamCount
+		}
+		call.op, call.cmd, call.keys = mcOpStore, mcSetBytes, nil
+		for i := 1; i < len(args); i += 2 {
+			call.keys = append(call.keys, bulkData(args[i]))
+			call.values = append(call.values, bulkData(args[i+1]))
+		}
+	case bytes.Equal(cmd, cmdSetBytes):
+		if err = call.set(args); err != nil {
+			return nil, err
+		}
+	case bytes.Equal(cmd, cmdSetExBytes), bytes.Equal(cmd, cmdPSetExBytes):
+		if len(args) != 4 {
+			return nil, ErrWrongParamCount
+		}
+		call.op, call.cmd = mcOpStore, mcSetBytes
+		call.keys, call.values = call.keys[:1], [][]byte{bulkData(args[3])}
+		if call.exptime, err = mcExptime(bulkData(args[2]), bytes.Equal(cmd, cmdPSetExBytes), false); err != nil {
+			return nil, err
+		}
+	case bytes.Equal(cmd, cmdSetNxBytes):
+		if len(args) != 3 {
+			return nil, ErrWrongParamCount
+		}
+		call.op, call.cmd, call.count = mcOpStore, mcAddBytes, true
+		call.keys, call.values = call.keys[:1], [][]byte{bulkData(args[2])}
+	case bytes.Equal(cmd, cmdIncrBytes), bytes.Equal(cmd, cmdDecrBytes):
+		if len(args) != 2 {
+			return nil, ErrWrongParamCount
+		}
+		call.op, call.cmd, call.delta = mcOpIncr, mcIncrBytes, []byte("1")
+		if bytes.Equal(cmd, cmdDecrBytes) {
+			call.cmd = mcDecrBytes
+		}
+	case bytes.Equal(cmd, cmdIncrByBytes), bytes.Equal(cmd, cmdDecrByBytes):
+		if len(args) != 3 {
+			return nil, ErrWrongParamCount
+		}
+		call.op, call.cmd, call.keys = mcOpIncr, mcIncrBytes, call.keys[:1]
+		if bytes.Equal(cmd, cmdDecrByBytes) {
+			call.cmd = mcDecrBytes
+		}
+		delta := bulkData(args[2])
+		if len(delta) > 0 && delta[0] == '-' {
+			// NOTE: INCRBY key -n is DECRBY key n
+			delta = delta[1:]
+			if bytes.Equal(call.cmd, mcIncrBytes) {
+				call.cmd = mcDecrBytes
+			} else {
+				call.cmd = mcIncrBytes
+			}
+		}
+		if _, perr := strconv.ParseUint(string(delta), 10, 64); perr != nil {
+			return nil, ErrBadNumKeys
+		}
+		call.delta = delta
+	case bytes.Equal(cmd, cmdExpireBytes):
+		if len(args) != 3 {
+			return nil, ErrWrongParamCount
+		}
+		call.op, call.keys = mcOpTouch, call.keys[:1]
+		sec, perr := strconv.ParseInt(string(bulkData(args[2])), 10, 64)
+		if perr != nil {
+			return nil, ErrBadNumKeys
+		}
+		if sec <= 0 {
+			// NOTE: the key is expired as soon as touched in the past
+			sec = -1
+		} else if sec > maxRelativeExptime {
+			sec += time.Now().Unix()
+		}
+		call.exptime = sec
+	default:
+		return nil, ErrMemcacheUnsupported
+	}
+	for _, key := range call.keys {
+		if !mcLegalKey(key) {
+			return nil, ErrMemcacheBadKey
+		}
+	}
+	return
+}
+
+// set parses SET key value [EX seconds|PX milliseconds|EXAT timestamp|PXAT timestamp] [NX|XX].
+func (c *mcCall) set(args []*resp) (err error) {
+	if len(args) < 3 {
+		return ErrWrongParamCount
+	}
+	c.op, c.cmd = mcOpStore, mcSetBytes
+	c.keys, c.values = c.keys[:1], [][]byte{bulkData(args[2])}
+	var expired bool
+	for i := 3; i < len(args); i++ {
+		opt := strings.ToUpper(string(bulkData(args[i])))
+		switch opt {
+		case "NX", "XX":
+			if !bytes.Equal(c.cmd, mcSetBytes) {
+				return ErrMemcacheSyntax
+			}
+			c.cmd = mcAddBytes
+			if opt == "XX" {
+				c.cmd = mcReplaceBytes
+			}
+		case "EX", "PX", "EXAT", "PXAT":
+			if expired || i+1 >= len(args) {
+				return ErrMemcacheSyntax
+			}
+			i++
+			if c.exptime, err = mcExptime(bulkData(args[i]), opt[0] == 'P', strings.HasSuffix(opt, "AT")); err != nil {
+				return
+			}
+			expired = true
+		default:
+			// NOTE: KEEPTTL and GET are not supported by memcache
+			return ErrMemcacheUnsupported
+		}
+	}
+	return
+}
+
+// mcExptime converts the expire time of redis into the exptime of memcache,
+// milli is rounded up to seconds.
+func mcExptime(bs []byte, milli, at bool) (exptime int64, err error) {
+	t, perr := strconv.ParseInt(string(bs), 10, 64)
+	if perr != nil {
+		return 0, ErrBadNumKeys
+	}
+	if t <= 0 {
+		return 0, ErrMemcacheExpire
+	}
+	if milli {
+		t = (t + 999) / 1000
+	}
+	if at {
+		// NOTE: the unix time in the past is expired by memcached
+		if t <= maxRelativeExptime {
+			t = -1
+		}
+		return t, nil
+	}
+	if t > maxRelativeExptime {
+		t += time.Now().Unix()
+	}
+	return t, nil
+}
+
+// mcLegalKey reports whether key is accepted by memcached, which is no
+// longer than 250 and has no control characters or whitespace.
+func mcLegalKey(key []byte) bool {
+	if len(key) == 0 || len(key) > 250 {
+		return false
+	}
+	for _, c := range key {
+		if c <= ' ' || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
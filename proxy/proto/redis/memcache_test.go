@@ -0,0 +1,88 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"overlord/pkg/mockconn"
+	libnet "overlord/pkg/net"
+	"overlord/proxy/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func _createMemcacheNodeConn(data string) *mcNodeConn {
+	conn := libnet.NewConn(mockconn.CreateConn([]byte(data), 1), time.Second, time.Second)
+	return newMemcacheNodeConn("clusterA", "127.0.0.1:11211", conn)
+}
+
+func TestMemcacheNodeConnWrite(t *testing.T) {
+	ts := []struct {
+		name   string
+		args   []string
+		except string
+	}{
+		{name: "get", args: []string{"GET", "a"}, except: "get a\r\n"},
+		{name: "mget", args: []string{"MGET", "a", "b"}, except: "get a b\r\n"},
+		{name: "set", args: []string{"SET", "a", "ab"}, except: "set a 0 0 2\r\nab\r\n"},
+		{name: "set ex nx", args: []string{"SET", "a", "ab", "ex", "10", "nx"}, except: "add a 0 10 2\r\nab\r\n"},
+		{name: "set px xx", args: []string{"SET", "a", "ab", "PX", "1500", "XX"}, except: "replace a 0 2 2\r\nab\r\n"},
+		{name: "setex", args: []string{"SETEX", "a", "10", "ab"}, except: "set a 0 10 2\r\nab\r\n"},
+		{name: "setnx", args: []string{"SETNX", "a", "ab"}, except: "add a 0 0 2\r\nab\r\n"},
+		{name: "mset", args: []string{"MSET", "a", "1", "b", "2"}, except: "set a 0 0 1\r\n1\r\nset b 0 0 1\r\n2\r\n"},
+		{name: "del", args: []string{"DEL", "a", "b"}, except: "delete a\r\ndelete b\r\n"},
+		{name: "exists", args: []string{"EXISTS", "a"}, except: "get a\r\n"},
+		{name: "incr", args: []string{"INCR", "a"}, except: "incr a 1\r\n"},
+		{name: "incrby negative", args: []string{"INCRBY", "a", "-5"}, except: "decr a 5\r\n"},
+		{name: "expire", args: []string{"EXPIRE", "a", "10"}, except: "touch a 10\r\n"},
+		{name: "hset", args: []string{"HSET", "a", "f", "v"}, except: ""},
+		{name: "bad key", args: []string{"GET", "a b"}, except: ""},
+	}
+	for _, tt := range ts {
+		t.Run(tt.name, func(t *testing.T) {
+			nc := _createMemcacheNodeConn("")
+			msg := proto.NewMessage()
+			msg.WithRequest(newRequest(tt.args[0], tt.args[1:]...))
+			assert.NoError(t, nc.Write(msg))
+			assert.NoError(t, nc.Flush())
+			m := nc.conn.Conn.(*mockconn.MockConn)
+			assert.Equal(t, tt.except, m.Wbuf.String())
+		})
+	}
+}
+
+func TestMemcacheNodeConnRead(t *testing.T) {
+	ts := []struct {
+		name   string
+		args   []string
+		reply  string
+		except string
+	}{
+		{name: "get hit", args: []string{"GET", "a"}, reply: "VALUE a 0 2\r\nab\r\nEND\r\n", except: "$2\r\nab\r\n"},
+		{name: "get miss", args: []string{"GET", "a"}, reply: "END\r\n", except: "$-1\r\n"},
+		{name: "mget", args: []string{"MGET", "a", "b", "c"}, reply: "VALUE c 0 1\r\n3\r\nVALUE a 0 1\r\n1\r\nEND\r\n", except: "*3\r\n$1\r\n1\r\n$-1\r\n$1\r\n3\r\n"},
+		{name: "set", args: []string{"SET", "a", "ab"}, reply: "STORED\r\n", except: "+OK\r\n"},
+		{name: "set nx exists", args: []string{"SET", "a", "ab", "NX"}, reply: "NOT_STORED\r\n", except: "$-1\r\n"},
+		{name: "setnx", args: []string{"SETNX", "a", "ab"}, reply: "STORED\r\n", except: ":1\r\n"},
+		{name: "del", args: []string{"DEL", "a", "b"}, reply: "DELETED\r\nNOT_FOUND\r\n", except: ":1\r\n"},
+		{name: "exists", args: []string{"EXISTS", "a", "b"}, reply: "VALUE b 0 1\r\n1\r\nEND\r\n", except: ":1\r\n"},
+		{name: "incr", args: []string{"INCR", "a"}, reply: "12\r\n", except: ":12\r\n"},
+		{name: "incr miss", args: []string{"INCR", "a"}, reply: "NOT_FOUND\r\n", except: "-ERR no such key\r\n"},
+		{name: "incr non-numeric", args: []string{"INCR", "a"}, reply: "CLIENT_ERROR cannot increment or decrement non-numeric value\r\n", except: "-ERR value is not an integer or out of range\r\n"},
+		{name: "expire", args: []string{"EXPIRE", "a", "10"}, reply: "TOUCHED\r\n", except: ":1\r\n"},
+		{name: "expire miss", args: []string{"EXPIRE", "a", "10"}, reply: "NOT_FOUND\r\n", except: ":0\r\n"},
+		{name: "server error", args: []string{"GET", "a"}, reply: "SERVER_ERROR out of memory\r\n", except: "-ERR SERVER_ERROR out of memory\r\n"},
+		{name: "lpush", args: []string{"LPUSH", "a", "v"}, except: "-ERR command not supported by memcache backend\r\n"},
+		{name: "set keepttl", args: []string{"SET", "a", "ab", "KEEPTTL"}, except: "-ERR command not supported by memcache backend\r\n"},
+	}
+	for _, tt := range ts {
+		t.Run(tt.name, func(t *testing.T) {
+			nc := _createMemcacheNodeConn(tt.reply)
+			req := newRequest(tt.args[0], tt.args[1:]...)
+			msg := proto.NewMessage()
+			msg.WithRequest(req)
+			assert.NoError(t, nc.Read(msg))
+			assert.Equal(t, tt.except, encodeReply(t, req.reply))
+		})
+	}
+}
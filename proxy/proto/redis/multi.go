@@ -0,0 +1,329 @@
+package redis
+
+import (
+	"bytes"
+	"strconv"
+
+	"overlord/pkg/bufio"
+	libnet "overlord/pkg/net"
+	"overlord/proxy/proto"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	txReadBufSize = 4096
+)
+
+var (
+	cmdMultiBytes   = []byte("5\r\nMULTI")
+	cmdExecBytes    = []byte("4\r\nEXEC")
+	cmdDiscardBytes = []byte("7\r\nDISCARD")
+	cmdWatchBytes   = []byte("5\r\nWATCH")
+	cmdUnwatchBytes = []byte("7\r\nUNWATCH")
+
+	multiReqBytes = []byte("*1\r\n$5\r\nMULTI\r\n")
+	execReqBytes  = []byte("*1\r\n$4\r\nEXEC\r\n")
+
+	queuedBytes    = []byte("QUEUED")
+	execAbortBytes = []byte("EXECABORT Transaction discarded because of previous errors.")
+	watchArgsBytes = []byte("ERR wrong number of arguments for 'watch' command")
+)
+
+// IsMulti is MULTI command which starts the transaction of client.
+func (r *Request) IsMulti() bool {
+	return r.resp.arraySize > 0 && bytes.Equal(r.resp.array[0].data, cmdMultiBytes)
+}
+
+// IsExec is EXEC command which executes the transaction of client.
+func (r *Request) IsExec() bool {
+	return r.resp.arraySize > 0 && bytes.Equal(r.resp.array[0].data, cmdExecBytes)
+}
+
+// IsDiscard is DISCARD command which discards the transaction of client.
+func (r *Request) IsDiscard() bool {
+	return r.resp.arraySize > 0 && bytes.Equal(r.resp.array[0].data, cmdDiscardBytes)
+}
+
+// IsWatch is WATCH command which pins the client to the node of keys.
+func (r *Request) IsWatch() bool {
+	return r.resp.arraySize > 0 && bytes.Equal(r.resp.array[0].data, cmdWatchBytes)
+}
+
+// IsUnwatch is UNWATCH command which releases the pinned node of WATCH.
+func (r *Request) IsUnwatch() bool {
+	return r.resp.arraySize > 0 && bytes.Equal(r.resp.array[0].data, cmdUnwatchBytes)
+}
+
+// WatchTarget returns the target of the keys of WATCH by route, ok is false
+// and the error is replied if the keys are routed into more than one target.
+func (r *Request) WatchTarget(route func(key []byte) string) (target string, ok bool) {
+	keys := txKeys(r)
+	if len(keys) == 0 {
+		r.reply.SetError(watchArgsBytes)
+		return "", false
+	}
+	for i, k := range keys {
+		t := route(bulkData(k))
+		if i == 0 {
+			target = t
+		} else if t != target {
+			r.reply.SetError(crossSlotBytes)
+			return "", false
+		}
+	}
+	return target, true
+}
+
+// Tx is the transaction of client between MULTI and EXEC. The commands are
+// queued by proxy, and sent into the node of their keys wrapped by MULTI
+// and EXEC on a dedicated connection, so the keys must be routed into the
+// same target.
+type Tx struct {
+	reqs    []*Request
+	target  string
+	keyed   bool
+	aborted bool
+}
+
+// NewTx creates the transaction.
+func NewTx() *Tx {
+	return &Tx{}
+}
+
+// WithTarget limits the keys of t to target, such as the node pinned by
+// WATCH.
+func (t *Tx) WithTarget(target string) {
+	t.target, t.keyed = target, true
+}
+
+// Queue copies the command of m into t and replies QUEUED, route maps key
+// to the target of key. The keys routed into another target are replied
+// with CROSSSLOT and the transaction is aborted.
+func (t *Tx) Queue(m *proto.Message, route func(key []byte) string) {
+	reqs := m.Requests()
+	first := reqs[0].(*Request)
+	req := getReq()
+	if m.IsBatch() {
+		req.resp.reset()
+		req.resp.respType = respArray
+		cmd := req.resp.next()
+		switch first.mType {
+		case mergeTypeStream:
+			req.resp.copy(first.resp)
+			req.appendStreams(reqs[1:])
+		case mergeTypeOK:
+			cmd.respType = respBulk
+			cmd.data = append(cmd.data, cmdMSetBytes...)
+		case mergeTypeJoin:
+			cmd.respType = respBulk
+			cmd.data = append(cmd.data, cmdMGetBytes...)
+		default:
+			cmd.copy(first.resp.array[0])
+		}
+		if first.mType != mergeTypeStream {
+			for _, r := range reqs {
+				sub := r.(*Request).resp
+				for i := 1; i < sub.arraySize; i++ {
+					req.resp.next().copy(sub.array[i])
+				}
+			}
+			req.resp.data = strconv.AppendInt(req.resp.data, int64(req.resp.arraySize), 10)
+		}
+		// NOTE: the batch is replied as one command.
+		first.mType = mergeTypeNo
+	} else {
+		req.resp.copy(first.resp)
+	}
+	if !t.route(req, route) {
+		t.aborted = true
+		first.reply.SetError(crossSlotBytes)
+		req.Put()
+		return
+	}
+	t.reqs = append(t.reqs, req)
+	first.reply.SetString(queuedBytes)
+}
+
+func (t *Tx) route(req *Request, route func(key []byte) string) bool {
+	for _, k := range txKeys(req) {
+		target := route(bulkData(k))
+		if !t.keyed {
+			t.target, t.keyed = target, true
+		} else if target != t.target {
+			return false
+		}
+	}
+	return true
+}
+
+// txKeys returns the keys of queued req, the command is routed by the first
+// key except the multi-key and batch commands.
+func txKeys(req *Request) []*resp {
+	args := req.resp.array[1:req.resp.arraySize]
+	if len(args) == 0 {
+		return nil
+	}
+	cmd := req.resp.array[0].data
+	switch {
+	case req.IsMultiKey():
+		keys, _ := req.multiKeys()
+		return keys
+	case req.IsXRead():
+		if idx := streamsIndex(req.resp); idx > 0 {
+			return args[idx : idx+(len(args)-idx)/2]
+		}
+	case bytes.Equal(cmd, cmdMSetBytes):
+		keys := make([]*resp, 0, len(args)/2)
+		for i := 0; i < len(args); i += 2 {
+			keys = append(keys, args[i])
+		}
+		return keys
+	case bytes.Equal(cmd, cmdMGetBytes), bytes.Equal(cmd, cmdDelBytes), bytes.Equal(cmd, cmdExistsBytes),
+		bytes.Equal(cmd, cmdWatchBytes):
+		return args
+	}
+	return args[:1]
+}
+
+// Abort marks the transaction aborted by the error of queued command.
+func (t *Tx) Abort() {
+	t.aborted = true
+}
+
+// Key returns the key by which the node of transaction is pinned, ok is
+// false if EXEC needs not to be sent into node.
+func (t *Tx) Key() (key []byte, ok bool) {
+	if t.aborted || len(t.reqs) == 0 {
+		return nil, false
+	}
+	for _, req := range t.reqs {
+		if req.resp.arraySize > 1 {
+			return req.Key(), true
+		}
+	}
+	return t.reqs[0].Key(), true
+}
+
+// Exec sends the queued commands wrapped by MULTI and EXEC into node and
+// sets the reply of EXEC into reply. The aborted or empty transaction is
+// replied without node.
+func (t *Tx) Exec(node *libnet.Conn, reply *RESP) (err error) {
+	if t.reply(reply) {
+		return
+	}
+	br := bufio.NewReader(node, bufio.Get(txReadBufSize))
+	defer bufio.Put(br.Buffer())
+	return t.exec(br, bufio.NewWriter(node), reply)
+}
+
+// reply replies the aborted or empty transaction, it returns false if the
+// transaction should be sent into node.
+func (t *Tx) reply(reply *RESP) bool {
+	if t.aborted {
+		reply.SetError(execAbortBytes)
+		return true
+	}
+	if len(t.reqs) == 0 {
+		reply.reset()
+		reply.respType = respArray
+		reply.data = append(reply.data, '0')
+		return true
+	}
+	return false
+}
+
+func (t *Tx) exec(br *bufio.Reader, bw *bufio.Writer, reply *RESP) (err error) {
+	_ = bw.Write(multiReqBytes)
+	for _, req := range t.reqs {
+		if err = req.resp.encode(bw); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	_ = bw.Write(execReqBytes)
+	if err = bw.Flush(); err != nil {
+		return errors.WithStack(err)
+	}
+	// NOTE: the replies of MULTI and queued commands are skipped, the EXEC
+	// replies EXECABORT if any of them failed.
+	for i := 0; i < len(t.reqs)+2; i++ {
+		if err = readReply(br, reply); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func readReply(br *bufio.Reader, reply *RESP) (err error) {
+	for {
+		if err = reply.decode(br); err == bufio.ErrBufferFull {
+			if err = br.Read(); err != nil {
+				return errors.WithStack(err)
+			}
+			continue
+		} else if err != nil {
+			return errors.WithStack(err)
+		}
+		return
+	}
+}
+
+// Close releases the queued commands.
+func (t *Tx) Close() {
+	for _, req := range t.reqs {
+		req.Put()
+	}
+	t.reqs = nil
+}
+
+// Watch is the dedicated node connection pinned by WATCH, the client keeps
+// it until EXEC, DISCARD or UNWATCH so that the transaction is executed on
+// the connection which watched the keys.
+type Watch struct {
+	node   *libnet.Conn
+	br     *bufio.Reader
+	bw     *bufio.Writer
+	target string
+}
+
+// NewWatch creates the watch on the pinned node connection of target.
+func NewWatch(node *libnet.Conn, target string) *Watch {
+	return &Watch{
+		node:   node,
+		br:     bufio.NewReader(node, bufio.Get(txReadBufSize)),
+		bw:     bufio.NewWriter(node),
+		target: target,
+	}
+}
+
+// Target returns the target of the watched keys.
+func (w *Watch) Target() string {
+	return w.target
+}
+
+// Send sends WATCH req into the node and reads the reply into req.
+func (w *Watch) Send(req *Request) (err error) {
+	if err = req.resp.encode(w.bw); err != nil {
+		return errors.WithStack(err)
+	}
+	if err = w.bw.Flush(); err != nil {
+		return errors.WithStack(err)
+	}
+	return readReply(w.br, req.reply)
+}
+
+// Exec executes t on the node like Tx.Exec, the EXEC is replied with null
+// if any of the watched keys changed.
+func (w *Watch) Exec(t *Tx, reply *RESP) (err error) {
+	if t.reply(reply) {
+		return
+	}
+	return t.exec(w.br, w.bw, reply)
+}
+
+// Close closes the pinned node connection, the keys are unwatched by node.
+func (w *Watch) Close() error {
+	err := w.node.Close()
+	bufio.Put(w.br.Buffer())
+	return err
+}
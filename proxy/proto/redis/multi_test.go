@@ -0,0 +1,75 @@
+package redis
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"overlord/pkg/bufio"
+	"overlord/pkg/mockconn"
+	libnet "overlord/pkg/net"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func txRoute(key []byte) string {
+	if bytes.HasPrefix(key, []byte("a")) {
+		return "n1"
+	}
+	return "n2"
+}
+
+func encodeReply(t *testing.T, r *RESP) string {
+	conn, buf := mockconn.CreateDownStreamConn()
+	w := bufio.NewWriter(libnet.NewConn(conn, time.Second, time.Second))
+	assert.NoError(t, r.encode(w))
+	assert.NoError(t, w.Flush())
+	return buf.String()
+}
+
+func TestTxQueueExec(t *testing.T) {
+	msgs := decodeMsgs(t, "MULTI\r\nSET a 1\r\nMGET a ab\r\nEXEC\r\n", 4)
+	assert.True(t, msgs[0].Request().(*Request).IsMulti())
+	assert.True(t, msgs[3].Request().(*Request).IsExec())
+
+	tx := NewTx()
+	_, ok := tx.Key()
+	assert.False(t, ok)
+	tx.Queue(msgs[1], txRoute)
+	tx.Queue(msgs[2], txRoute)
+	for _, msg := range msgs[1:3] {
+		assert.Equal(t, "+QUEUED\r\n", encodeReply(t, msg.Request().(*Request).reply))
+	}
+	key, ok := tx.Key()
+	assert.True(t, ok)
+	assert.Equal(t, "a", string(key))
+
+	conn := mockconn.CreateConn([]byte("+OK\r\n+QUEUED\r\n+QUEUED\r\n*2\r\n+OK\r\n*2\r\n$1\r\n1\r\n$-1\r\n"), 1)
+	reply := &RESP{}
+	assert.NoError(t, tx.Exec(libnet.NewConn(conn, time.Second, time.Second), reply))
+	assert.Equal(t, "*2\r\n+OK\r\n*2\r\n$1\r\n1\r\n$-1\r\n", encodeReply(t, reply))
+	assert.Equal(t, "*1\r\n$5\r\nMULTI\r\n*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\n1\r\n*3\r\n$4\r\nMGET\r\n$1\r\na\r\n$2\r\nab\r\n*1\r\n$4\r\nEXEC\r\n",
+		conn.(*mockconn.MockConn).Wbuf.String())
+	tx.Close()
+
+	tx = NewTx()
+	assert.NoError(t, tx.Exec(nil, reply))
+	assert.Equal(t, "*0\r\n", encodeReply(t, reply))
+}
+
+func TestTxQueueCrossSlot(t *testing.T) {
+	msgs := decodeMsgs(t, "SET a 1\r\nDEL a b\r\nEVAL s 2 a1 a2\r\n", 3)
+	tx := NewTx()
+	tx.Queue(msgs[0], txRoute)
+	tx.Queue(msgs[2], txRoute)
+	assert.Equal(t, "+QUEUED\r\n", encodeReply(t, msgs[2].Request().(*Request).reply))
+	tx.Queue(msgs[1], txRoute)
+	assert.Equal(t, "-"+string(crossSlotBytes)+"\r\n", encodeReply(t, msgs[1].Request().(*Request).reply))
+	_, ok := tx.Key()
+	assert.False(t, ok)
+
+	reply := &RESP{}
+	assert.NoError(t, tx.Exec(nil, reply))
+	assert.Equal(t, "-"+string(execAbortBytes)+"\r\n", encodeReply(t, reply))
+	tx.Close()
+}
@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"overlord/pkg/bufio"
+	"overlord/pkg/conv"
+	"overlord/pkg/log"
 	libnet "overlord/pkg/net"
 	"overlord/proxy/proto"
 
@@ -42,9 +44,29 @@ type nodeConn struct {
 	state int32
 }
 
-// NewNodeConn create the node conn from proxy to redis
-func NewNodeConn(cluster, addr string, dialTimeout, readTimeout, writeTimeout time.Duration) (nc proto.NodeConn) {
+// NewNodeConn create the node conn from proxy to redis, and prepare it
+// by auth and db if the backend is protected by password or not use db 0.
+func NewNodeConn(cluster, addr, auth string, db int, dialTimeout, readTimeout, writeTimeout time.Duration) (nc proto.NodeConn) {
 	conn := libnet.DialWithTimeout(addr, dialTimeout, readTimeout, writeTimeout)
+	if err := Prepare(conn, auth, db); err != nil {
+		log.Errorf("cluster(%s) fail to prepare node(%s) error:%v", cluster, addr, err)
+		_ = conn.Close()
+	}
+	return newNodeConn(cluster, addr, conn)
+}
+
+// NewReplicaNodeConn create the node conn from proxy to redis cluster replica
+// which is enabled to serve reads by READONLY.
+func NewReplicaNodeConn(cluster, addr, auth string, dialTimeout, readTimeout, writeTimeout time.Duration) (nc proto.NodeConn) {
+	conn := libnet.DialWithTimeout(addr, dialTimeout, readTimeout, writeTimeout)
+	err := Prepare(conn, auth, 0)
+	if err == nil {
+		err = Readonly(conn)
+	}
+	if err != nil {
+		log.Errorf("cluster(%s) fail to prepare replica node(%s) error:%v", cluster, addr, err)
+		_ = conn.Close()
+	}
 	return newNodeConn(cluster, addr, conn)
 }
 
@@ -76,7 +98,7 @@ func (nc *nodeConn) Write(m *proto.Message) (err error) {
 		err = errors.WithStack(ErrBadAssert)
 		return
 	}
-	if !req.IsSupport() || req.IsCtl() {
+	if req.IsLocal() {
 		return
 	}
 	if err = req.resp.encode(nc.bw); err != nil {
@@ -102,9 +124,15 @@ func (nc *nodeConn) Read(m *proto.Message) (err error) {
 		err = errors.WithStack(ErrBadAssert)
 		return
 	}
-	if !req.IsSupport() || req.IsCtl() {
+	if req.IsLocal() {
 		return
 	}
+	if st := m.Streamer(); st != nil && req.mType == mergeTypeNo {
+		var ok bool
+		if ok, err = nc.readStream(m, req, st); ok || err != nil {
+			return
+		}
+	}
 	for {
 		if err = req.reply.decode(nc.br); err == bufio.ErrBufferFull {
 			if err = nc.br.Read(); err != nil {
@@ -120,6 +148,46 @@ func (nc *nodeConn) Read(m *proto.Message) (err error) {
 	}
 }
 
+// readStream reads the header of bulk reply larger than threshold, and
+// leaves the rest to be streamed. ok is false if reply should be fully read.
+func (nc *nodeConn) readStream(m *proto.Message, req *Request, st *proto.Streamer) (ok bool, err error) {
+	var line []byte
+	for {
+		if line, err = nc.br.ReadLine(); err == bufio.ErrBufferFull {
+			if err = nc.br.Read(); err != nil {
+				err = errors.WithStack(err)
+				return
+			}
+			continue
+		} else if err != nil {
+			err = errors.WithStack(err)
+			return
+		}
+		break
+	}
+	nc.br.Advance(-len(line))
+	if line[0] != respBulk {
+		return
+	}
+	length, err := conv.Btoi(line[1 : len(line)-2])
+	if err != nil || length <= int64(st.Threshold) {
+		err = nil
+		return
+	}
+	nc.br.Advance(len(line))
+	req.reply.reset()
+	req.reply.respType = respBulk
+	req.reply.data = append(req.reply.data, line[1:]...)
+	m.WithStream(st.NewStream(nc.br, int(length)+2))
+	ok = true
+	return
+}
+
+// SetReadTimeout impl proto.ReadTimeouter.
+func (nc *nodeConn) SetReadTimeout(timeout time.Duration) {
+	nc.conn.SetReadTimeout(timeout)
+}
+
 func (nc *nodeConn) Close() (err error) {
 	if atomic.CompareAndSwapInt32(&nc.state, opened, closed) {
 		return nc.conn.Close()
@@ -42,7 +42,7 @@ func (*mockCmd) Put() {
 func (*mockCmd) Slowlog() *proto.SlowlogEntry { return nil }
 
 func TestNodeConnNewNodeConn(t *testing.T) {
-	nc := NewNodeConn("test", "127.0.0.1:12345", time.Second, time.Second, time.Second)
+	nc := NewNodeConn("test", "127.0.0.1:12345", "", 0, time.Second, time.Second, time.Second)
 	assert.NotNil(t, nc)
 	rnc := nc.(*nodeConn)
 	assert.NotNil(t, rnc.Bw())
@@ -133,6 +133,46 @@ func TestReadOk(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestReadStream(t *testing.T) {
+	value := bytes.Repeat([]byte("a"), 2000)
+	data := "$2000\r\n" + string(value) + "\r\n:1\r\n$3\r\nabc\r\n"
+	conn := libnet.NewConn(mockconn.CreateConn([]byte(data), 1), time.Second, time.Second)
+	nc := newNodeConn("baka", "127.0.0.1:12345", conn)
+	st := &proto.Streamer{Threshold: 1024, Buffer: 1024}
+
+	msg := proto.NewMessage()
+	req := newRequest("GET", "a")
+	req.mType = mergeTypeNo
+	msg.WithRequest(req)
+	msg.WithStreamer(st)
+	err := nc.Read(msg)
+	assert.NoError(t, err)
+	assert.Equal(t, "2000\r\n", string(req.reply.data))
+	s := msg.Stream()
+	assert.NotNil(t, s)
+	go s.Pump()
+
+	dconn, buf := mockconn.CreateDownStreamConn()
+	pc := NewProxyConn(libnet.NewConn(dconn, time.Second, time.Second), true)
+	err = pc.Encode(msg)
+	assert.NoError(t, err)
+	err = pc.Flush()
+	assert.NoError(t, err)
+	assert.Equal(t, "$2000\r\n"+string(value)+"\r\n", buf.String())
+
+	for _, expect := range []string{"1", "3\r\nabc"} {
+		msg = proto.NewMessage()
+		req = newRequest("GET", "a")
+		req.mType = mergeTypeNo
+		msg.WithRequest(req)
+		msg.WithStreamer(st)
+		err = nc.Read(msg)
+		assert.NoError(t, err)
+		assert.Nil(t, msg.Stream())
+		assert.Equal(t, expect, string(req.reply.data))
+	}
+}
+
 func TestReadWithBadAssert(t *testing.T) {
 	nc := newNodeConn("baka", "127.0.0.1:12345", libnet.NewConn(mockconn.CreateConn([]byte(":123\r\n"), 1), time.Second, time.Second))
 	msg := proto.NewMessage()
@@ -0,0 +1,35 @@
+package redis
+
+// Broken impl proto.Partialer, the reply of the request merged into is
+// checked by itself.
+func (r *Request) Broken() bool {
+	if r.merged {
+		return false
+	}
+	switch r.mType {
+	case mergeTypeJoin:
+		if r.reply.respType == respError {
+			return true
+		}
+		// NOTE: one value per key, in the order of keys
+		return r.reply.respType == respArray && r.reply.arraySize != r.resp.arraySize-1
+	case mergeTypeCount:
+		return r.reply.respType != respInt
+	}
+	return false
+}
+
+// Partial impl proto.Partialer, the keys of MGET are answered as nils and
+// DEL or EXISTS are counted as 0. The requests merged into r are answered
+// by the reply of r.
+func (r *Request) Partial() bool {
+	switch r.mType {
+	case mergeTypeJoin:
+		r.reply.SetNullBulk()
+	case mergeTypeCount:
+		r.reply.SetInt(0)
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,262 @@
+package redis
+
+import (
+	"bytes"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"overlord/proxy/proto"
+)
+
+var (
+	matchBytes = []byte("MATCH")
+
+	cmdRandomKeyBytes = []byte("9\r\nRANDOMKEY")
+	scanBytes         = []byte("SCAN")
+	countBytes        = []byte("COUNT")
+	// randomKeyCountBytes is the COUNT of each SCAN emulating RANDOMKEY.
+	randomKeyCountBytes = []byte("1000")
+
+	// storeNumKeysCmds are the commands of destination key followed by
+	// numkeys and the keys, such as ZUNIONSTORE.
+	storeNumKeysCmds = map[string]struct{}{
+		"11\r\nZINTERSTORE": {},
+		"11\r\nZUNIONSTORE": {},
+	}
+	// keyReplyCmds are the commands whose reply is an array led by key,
+	// such as BLPOP.
+	keyReplyCmds = map[string]struct{}{
+		"5\r\nBLPOP":    {},
+		"5\r\nBRPOP":    {},
+		"8\r\nBZPOPMIN": {},
+		"8\r\nBZPOPMAX": {},
+		"5\r\nLMPOP":    {},
+		"6\r\nBLMPOP":   {},
+		"5\r\nZMPOP":    {},
+		"6\r\nBZMPOP":   {},
+	}
+)
+
+// PrefixKeys impl proto.KeyPrefixer.
+func (pc *proxyConn) PrefixKeys(prefix []byte) {
+	pc.keyPrefix = prefix
+}
+
+func (pc *proxyConn) prefixKeys(msg *proto.Message) {
+	for _, req := range msg.Requests() {
+		r := req.(*Request)
+		if r.isRandomKey() {
+			r.prefixRandomKey(pc.keyPrefix)
+			continue
+		}
+		if r.IsScan() {
+			r.prefixScan(pc.keyPrefix)
+			continue
+		}
+		for _, idx := range r.keyIndexes() {
+			r.resp.array[idx].prefix(pc.keyPrefix)
+		}
+	}
+}
+
+// keyIndexes returns the indexes of the keys in the arguments of r by the
+// key specs of command table, the keys of the commands with movablekeys are
+// parsed from the arguments.
+func (r *Request) keyIndexes() (idxs []int) {
+	if r.resp.arraySize < 2 {
+		return nil
+	}
+	cmd := string(r.resp.array[0].data)
+	if idx, ok := numKeysIndex[cmd]; ok {
+		n, err := r.numKeys()
+		if err != nil {
+			return nil
+		}
+		for i := idx + 1; i <= idx+n; i++ {
+			idxs = append(idxs, i)
+		}
+		return
+	}
+	if _, ok := storeNumKeysCmds[cmd]; ok {
+		idxs = append(idxs, 1)
+		if r.resp.arraySize < 3 {
+			return
+		}
+		n, err := strconv.Atoi(string(bulkData(r.resp.array[2])))
+		if err != nil || n < 0 || 3+n > r.resp.arraySize {
+			return
+		}
+		for i := 3; i < 3+n; i++ {
+			idxs = append(idxs, i)
+		}
+		return
+	}
+	if r.IsXRead() {
+		idx := streamsIndex(r.resp)
+		if idx < 0 {
+			return nil
+		}
+		for i := idx + 1; i < idx+1+(r.resp.arraySize-idx-1)/2; i++ {
+			idxs = append(idxs, i)
+		}
+		return
+	}
+	ci, ok := commandMap[strings.ToLower(string(r.Cmd()))]
+	if !ok || ci.first <= 0 {
+		return nil
+	}
+	last := ci.last
+	if last < 0 {
+		last += r.resp.arraySize
+	}
+	for i := ci.first; i <= last && i < r.resp.arraySize; i += ci.step {
+		idxs = append(idxs, i)
+	}
+	return
+}
+
+// prefixScan limits SCAN to the keys of prefix by MATCH.
+func (r *Request) prefixScan(prefix []byte) {
+	pattern := make([]byte, 0, len(prefix)*2+1)
+	for _, c := range prefix {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			pattern = append(pattern, '\\')
+		}
+		pattern = append(pattern, c)
+	}
+	for i := 2; i+1 < r.resp.arraySize; i++ {
+		if bytes.EqualFold(bulkData(r.resp.array[i]), matchBytes) {
+			// NOTE: never reuse data of arg which may refer to the read buffer
+			arg := &resp{}
+			arg.SetBulk(append(pattern, bulkData(r.resp.array[i+1])...))
+			r.resp.array[i+1] = arg
+			return
+		}
+	}
+	r.resp.next().SetBulk(matchBytes)
+	r.resp.next().SetBulk(append(pattern, '*'))
+	r.resp.data, r.resp.ref = strconv.AppendInt(nil, int64(r.resp.arraySize), 10), false
+}
+
+func (r *Request) isRandomKey() bool {
+	return r.resp.arraySize == 1 && bytes.Equal(r.resp.array[0].data, cmdRandomKeyBytes)
+}
+
+// prefixRandomKey emulates RANDOMKEY by SCAN MATCH prefix* from a random
+// cursor, for the key of other prefixes must never be returned. The cursor
+// is random in both the node and the cursor of the node.
+func (r *Request) prefixRandomKey(prefix []byte) {
+	// NOTE: never reuse data of arg which may refer to the read buffer
+	arg := &resp{}
+	arg.SetBulk(scanBytes)
+	r.resp.array[0] = arg
+	r.resp.next().SetBulk(strconv.AppendInt(nil, rand.Int63n(1<<40), 10))
+	r.resp.next().SetBulk(countBytes)
+	r.resp.next().SetBulk(randomKeyCountBytes)
+	r.prefixScan(prefix)
+	r.randomKey = true
+}
+
+// NextRandomKey continues the RANDOMKEY emulated by SCAN if no key found,
+// the cursor is moved to the next one and the request must be forwarded
+// again. The scan restarts from the first node once after the last node
+// finished, and no key is found after all.
+func (r *Request) NextRandomKey() bool {
+	if !r.randomKey || r.reply.respType != respArray || r.reply.arraySize != 2 || r.reply.array[1].arraySize > 0 {
+		return false
+	}
+	cursor, err := strconv.ParseUint(string(bulkData(r.reply.array[0])), 10, 64)
+	if err != nil {
+		return false
+	}
+	cursor, ok := r.proxyCursor(cursor)
+	if !ok || (cursor == 0 && r.randomWrapped) {
+		return false
+	}
+	if cursor == 0 {
+		r.randomWrapped = true
+	}
+	arg := &resp{}
+	arg.SetBulk(strconv.AppendUint(nil, cursor, 10))
+	r.resp.array[1] = arg
+	return true
+}
+
+// randomKeyReply replies one of the keys found by RANDOMKEY randomly with
+// prefix stripped, or nil if none.
+func (r *Request) randomKeyReply(prefix []byte) {
+	if r.reply.respType != respArray || r.reply.arraySize != 2 {
+		return
+	}
+	keys := r.reply.array[1]
+	if keys.arraySize == 0 {
+		r.reply.reset()
+		r.reply.respType = respBulk
+		return
+	}
+	key := &resp{}
+	key.copy(keys.array[rand.Intn(keys.arraySize)])
+	key.strip(prefix)
+	r.reply.copy(key)
+}
+
+// stripKeys strips prefix from the keys in the reply of r.
+func (r *Request) stripKeys(prefix []byte) {
+	if r.randomKey {
+		r.randomKeyReply(prefix)
+		return
+	}
+	reply := r.reply
+	if reply.respType != respArray {
+		return
+	}
+	cmd := string(r.resp.array[0].data)
+	switch {
+	case r.IsScan():
+		if reply.arraySize == 2 {
+			for _, k := range reply.array[1].array[:reply.array[1].arraySize] {
+				k.strip(prefix)
+			}
+		}
+	case r.IsXRead():
+		for _, s := range reply.array[:reply.arraySize] {
+			if s.arraySize > 0 {
+				s.array[0].strip(prefix)
+			}
+		}
+	default:
+		if _, ok := keyReplyCmds[cmd]; ok && reply.arraySize > 0 {
+			reply.array[0].strip(prefix)
+		}
+	}
+}
+
+// prefix prepends p to the bulk data of r.
+func (r *resp) prefix(p []byte) {
+	key := bulkData(r)
+	data := make([]byte, 0, len(p)+len(key)+8)
+	data = strconv.AppendInt(data, int64(len(p)+len(key)), 10)
+	data = append(data, crlfBytes...)
+	data = append(data, p...)
+	data = append(data, key...)
+	r.respType, r.data, r.ref = respBulk, data, false
+}
+
+// strip removes p from the head of the bulk data of r if any.
+func (r *resp) strip(p []byte) {
+	if r.respType != respBulk || bytes.IndexByte(r.data, '\n') < 0 {
+		return
+	}
+	key := bulkData(r)
+	if !bytes.HasPrefix(key, p) {
+		return
+	}
+	key = key[len(p):]
+	data := make([]byte, 0, len(key)+8)
+	data = strconv.AppendInt(data, int64(len(key)), 10)
+	data = append(data, crlfBytes...)
+	data = append(data, key...)
+	r.data, r.ref = data, false
+}
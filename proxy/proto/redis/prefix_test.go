@@ -0,0 +1,120 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"overlord/pkg/mockconn"
+	libnet "overlord/pkg/net"
+	"overlord/proxy/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decodePrefixed(t *testing.T, prefix, data string, n int) []*proto.Message {
+	conn := libnet.NewConn(mockconn.CreateConn([]byte(data), 1), time.Second, time.Second)
+	pc := NewProxyConn(conn, true)
+	pc.(proto.KeyPrefixer).PrefixKeys([]byte(prefix))
+	msgs, err := pc.Decode(proto.GetMsgs(n))
+	assert.NoError(t, err)
+	assert.Len(t, msgs, n)
+	return msgs
+}
+
+func TestPrefixKeys(t *testing.T) {
+	msgs := decodePrefixed(t, "t:", "GET a\r\nMSET a 1 b 2\r\nEVAL s 2 a b x\r\nZUNIONSTORE d 2 a b WEIGHTS 1 2\r\nXREAD COUNT 1 STREAMS a 0\r\nOBJECT ENCODING a\r\nPING\r\nSMOVE a b m\r\n", 8)
+	args := func(msg *proto.Message) string {
+		return encodeReply(t, msg.Request().(*Request).resp)
+	}
+	assert.Equal(t, "*2\r\n$3\r\nGET\r\n$3\r\nt:a\r\n", args(msgs[0]))
+	assert.Equal(t, "t:a", string(msgs[0].Request().Key()))
+	subs := msgs[1].Batch()
+	assert.Equal(t, "*3\r\n$4\r\nMSET\r\n$3\r\nt:a\r\n$1\r\n1\r\n", args(subs[0]))
+	assert.Equal(t, "*3\r\n$4\r\nMSET\r\n$3\r\nt:b\r\n$1\r\n2\r\n", args(subs[1]))
+	assert.Equal(t, "*6\r\n$4\r\nEVAL\r\n$1\r\ns\r\n$1\r\n2\r\n$3\r\nt:a\r\n$3\r\nt:b\r\n$1\r\nx\r\n", args(msgs[2]))
+	assert.Equal(t, "*8\r\n$11\r\nZUNIONSTORE\r\n$3\r\nt:d\r\n$1\r\n2\r\n$3\r\nt:a\r\n$3\r\nt:b\r\n$7\r\nWEIGHTS\r\n$1\r\n1\r\n$1\r\n2\r\n", args(msgs[3]))
+	assert.Equal(t, "*6\r\n$5\r\nXREAD\r\n$5\r\nCOUNT\r\n$1\r\n1\r\n$7\r\nSTREAMS\r\n$3\r\nt:a\r\n$1\r\n0\r\n", args(msgs[4]))
+	assert.Equal(t, "*3\r\n$6\r\nOBJECT\r\n$8\r\nENCODING\r\n$3\r\nt:a\r\n", args(msgs[5]))
+	assert.Equal(t, "*1\r\n$4\r\nPING\r\n", args(msgs[6]))
+	assert.Equal(t, "*4\r\n$5\r\nSMOVE\r\n$3\r\nt:a\r\n$3\r\nt:b\r\n$1\r\nm\r\n", args(msgs[7]))
+}
+
+func TestPrefixScan(t *testing.T) {
+	msgs := decodePrefixed(t, "t*:", "SCAN 0\r\nSCAN 0 match u* COUNT 10\r\n", 2)
+	args := func(msg *proto.Message) string {
+		return encodeReply(t, msg.Request().(*Request).resp)
+	}
+	assert.Equal(t, "*4\r\n$4\r\nSCAN\r\n$1\r\n0\r\n$5\r\nMATCH\r\n$5\r\nt\\*:*\r\n", args(msgs[0]))
+	assert.Equal(t, "*6\r\n$4\r\nSCAN\r\n$1\r\n0\r\n$5\r\nmatch\r\n$6\r\nt\\*:u*\r\n$5\r\nCOUNT\r\n$2\r\n10\r\n", args(msgs[1]))
+
+	req := msgs[0].Request().(*Request)
+	setReply(t, req.reply, "*2\r\n$1\r\n0\r\n*2\r\n$4\r\nt*:a\r\n$1\r\nb\r\n")
+	req.stripKeys([]byte("t*:"))
+	assert.Equal(t, "*2\r\n$1\r\n0\r\n*2\r\n$1\r\na\r\n$1\r\nb\r\n", encodeReply(t, req.reply))
+}
+
+func TestPrefixStripReply(t *testing.T) {
+	msgs := decodePrefixed(t, "t:", "BLPOP a b 0\r\nXREAD STREAMS a 0\r\nXREAD STREAMS a b 0 0\r\nLRANGE a 0 -1\r\n", 4)
+	mconn, buf := mockconn.CreateDownStreamConn()
+	pc := NewProxyConn(libnet.NewConn(mconn, time.Second, time.Second), true)
+	pc.(proto.KeyPrefixer).PrefixKeys([]byte("t:"))
+
+	setReply(t, msgs[0].Request().(*Request).reply, "*2\r\n$3\r\nt:b\r\n$1\r\nv\r\n")
+	setReply(t, msgs[1].Request().(*Request).reply, "*1\r\n*2\r\n$3\r\nt:a\r\n*0\r\n")
+	subs := msgs[2].Batch()
+	setReply(t, subs[0].Request().(*Request).reply, "*1\r\n*2\r\n$3\r\nt:a\r\n*0\r\n")
+	setReply(t, subs[1].Request().(*Request).reply, "*1\r\n*2\r\n$3\r\nt:b\r\n*0\r\n")
+	setReply(t, msgs[3].Request().(*Request).reply, "*1\r\n$3\r\nt:v\r\n")
+	for _, msg := range msgs {
+		assert.NoError(t, pc.Encode(msg))
+	}
+	assert.NoError(t, pc.Flush())
+	assert.Equal(t, "*2\r\n$1\r\nb\r\n$1\r\nv\r\n"+
+		"*1\r\n*2\r\n$1\r\na\r\n*0\r\n"+
+		"*2\r\n*2\r\n$1\r\na\r\n*0\r\n*2\r\n$1\r\nb\r\n*0\r\n"+
+		"*1\r\n$3\r\nt:v\r\n", buf.String())
+}
+
+func TestPrefixRandomKey(t *testing.T) {
+	msgs := decodePrefixed(t, "t:", "RANDOMKEY\r\nrandomkey\r\n", 2)
+	req := msgs[0].Request().(*Request)
+	assert.True(t, req.IsScan())
+	assert.Equal(t, "SCAN", string(req.Cmd()))
+	args := req.resp.array[:req.resp.arraySize]
+	assert.Len(t, args, 6)
+	assert.Equal(t, "$5\r\nCOUNT\r\n$4\r\n1000\r\n$5\r\nMATCH\r\n$3\r\nt:*\r\n",
+		encodeReply(t, args[2])+encodeReply(t, args[3])+encodeReply(t, args[4])+encodeReply(t, args[5]))
+
+	// NOTE: the last node is finished, restart from the first node once.
+	req.scanNodes, req.scanIdx = 2, 1
+	setReply(t, req.reply, "*2\r\n$1\r\n0\r\n*0\r\n")
+	assert.True(t, req.NextRandomKey())
+	assert.Equal(t, "0", string(bulkData(req.resp.array[1])))
+	idx, ok := req.ScanNode(2)
+	assert.True(t, ok)
+	assert.Equal(t, 0, idx)
+	setReply(t, req.reply, "*2\r\n$1\r\n5\r\n*0\r\n")
+	assert.True(t, req.NextRandomKey())
+	assert.Equal(t, "10", string(bulkData(req.resp.array[1])))
+	_, _ = req.ScanNode(2)
+	setReply(t, req.reply, "*2\r\n$1\r\n0\r\n*0\r\n")
+	assert.True(t, req.NextRandomKey())
+	assert.Equal(t, "1", string(bulkData(req.resp.array[1])))
+	_, _ = req.ScanNode(2)
+	setReply(t, req.reply, "*2\r\n$1\r\n0\r\n*0\r\n")
+	assert.False(t, req.NextRandomKey(), "all scanned")
+
+	found := msgs[1].Request().(*Request)
+	found.scanNodes, found.scanIdx = 2, 0
+	setReply(t, found.reply, "*2\r\n$1\r\n3\r\n*1\r\n$5\r\nt:t:a\r\n")
+	assert.False(t, found.NextRandomKey())
+
+	mconn, buf := mockconn.CreateDownStreamConn()
+	pc := NewProxyConn(libnet.NewConn(mconn, time.Second, time.Second), true)
+	pc.(proto.KeyPrefixer).PrefixKeys([]byte("t:"))
+	for _, msg := range msgs {
+		assert.NoError(t, pc.Encode(msg))
+	}
+	assert.NoError(t, pc.Flush())
+	assert.Equal(t, "$-1\r\n$3\r\nt:a\r\n", buf.String())
+}
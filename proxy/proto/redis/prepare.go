@@ -0,0 +1,77 @@
+package redis
+
+import (
+	"bytes"
+	errs "errors"
+	"fmt"
+	"strconv"
+
+	"overlord/pkg/bufio"
+	libnet "overlord/pkg/net"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	prepareBufferSize = 128
+)
+
+// errors
+var (
+	ErrAuthFailed     = errs.New("redis backend auth failed")
+	ErrSelectFailed   = errs.New("redis backend select failed")
+	ErrReadonlyFailed = errs.New("redis backend readonly failed")
+)
+
+// Auth authenticates the conn to backend redis by password before any
+// command be sent.
+func Auth(conn *libnet.Conn, password string) error {
+	return callOK(conn, ErrAuthFailed, "AUTH", password)
+}
+
+// Select switches the conn to the logical database db of backend redis.
+func Select(conn *libnet.Conn, db int) error {
+	return callOK(conn, ErrSelectFailed, "SELECT", strconv.Itoa(db))
+}
+
+// Readonly enables the read queries of the conn to a redis cluster replica.
+func Readonly(conn *libnet.Conn) error {
+	return callOK(conn, ErrReadonlyFailed, "READONLY")
+}
+
+// Prepare authenticates and selects db of the conn if needed.
+func Prepare(conn *libnet.Conn, auth string, db int) (err error) {
+	if auth != "" {
+		if err = Auth(conn, auth); err != nil {
+			return
+		}
+	}
+	if db != 0 {
+		err = Select(conn, db)
+	}
+	return
+}
+
+// callOK sends the cmd with args and expects +OK as reply.
+func callOK(conn *libnet.Conn, failed error, cmd string, args ...string) (err error) {
+	bw := bufio.NewWriter(conn)
+	_ = bw.Write([]byte(fmt.Sprintf("*%d\r\n$%d\r\n%s\r\n", len(args)+1, len(cmd), cmd)))
+	for _, arg := range args {
+		_ = bw.Write([]byte(fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)))
+	}
+	if err = bw.Flush(); err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+	br := bufio.NewReader(conn, bufio.NewBuffer(prepareBufferSize))
+	_ = br.Read()
+	data, err := br.ReadLine()
+	if err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+	if !bytes.Equal(data, authOkBytes) {
+		err = errors.Wrapf(failed, "reply:%s", bytes.TrimSpace(data))
+	}
+	return
+}
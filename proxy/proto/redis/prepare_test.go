@@ -0,0 +1,48 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"overlord/pkg/mockconn"
+	libnet "overlord/pkg/net"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthOk(t *testing.T) {
+	conn := libnet.NewConn(mockconn.CreateConn(authOkBytes, 1), time.Second, time.Second)
+	err := Auth(conn, "pass")
+	assert.NoError(t, err)
+	mc := conn.Conn.(*mockconn.MockConn)
+	assert.Equal(t, "*2\r\n$4\r\nAUTH\r\n$4\r\npass\r\n", mc.Wbuf.String())
+}
+
+func TestAuthFailed(t *testing.T) {
+	conn := libnet.NewConn(mockconn.CreateConn([]byte("-ERR invalid password\r\n"), 1), time.Second, time.Second)
+	err := Auth(conn, "wrong")
+	assert.Equal(t, ErrAuthFailed, errors.Cause(err))
+}
+
+func TestPrepareAuthAndSelect(t *testing.T) {
+	conn := libnet.NewConn(mockconn.CreateConn(authOkBytes, 2), time.Second, time.Second)
+	err := Prepare(conn, "pass", 3)
+	assert.NoError(t, err)
+	mc := conn.Conn.(*mockconn.MockConn)
+	assert.Equal(t, "*2\r\n$4\r\nAUTH\r\n$4\r\npass\r\n*2\r\n$6\r\nSELECT\r\n$1\r\n3\r\n", mc.Wbuf.String())
+}
+
+func TestSelectFailed(t *testing.T) {
+	conn := libnet.NewConn(mockconn.CreateConn([]byte("-ERR DB index is out of range\r\n"), 1), time.Second, time.Second)
+	err := Select(conn, 100)
+	assert.Equal(t, ErrSelectFailed, errors.Cause(err))
+}
+
+func TestReadonlyOk(t *testing.T) {
+	conn := libnet.NewConn(mockconn.CreateConn(authOkBytes, 1), time.Second, time.Second)
+	err := Readonly(conn)
+	assert.NoError(t, err)
+	mc := conn.Conn.(*mockconn.MockConn)
+	assert.Equal(t, "*1\r\n$8\r\nREADONLY\r\n", mc.Wbuf.String())
+}
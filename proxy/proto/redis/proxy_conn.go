@@ -3,6 +3,7 @@ package redis
 import (
 	"bytes"
 	"strconv"
+	"time"
 
 	"overlord/pkg/bufio"
 	"overlord/pkg/conv"
@@ -20,9 +21,11 @@ const (
 var (
 	nullBytes           = []byte("-1\r\n")
 	okBytes             = []byte("OK\r\n")
+	authOkBytes         = []byte("+OK\r\n")
 	pongDataBytes       = []byte("PONG")
 	justOkBytes         = []byte("OK")
 	notSupportDataBytes = []byte("Error: command not support")
+	echoArgsBytes       = []byte("ERR wrong number of arguments for 'echo' command")
 )
 
 // ProxyConn is export for redis cluster.
@@ -42,6 +45,11 @@ type proxyConn struct {
 
 	mgetCmd []byte
 	msetCmd []byte
+
+	maxKeyLen    int
+	maxValueSize int
+	// keyPrefix is prepended to keys of requests and stripped from replies.
+	keyPrefix []byte
 }
 
 // NewProxyConn creates new redis Encoder and Decoder.
@@ -62,6 +70,11 @@ func NewProxyConn(conn *libnet.Conn, useBatchCmd bool) proto.ProxyConn {
 	return r
 }
 
+// LimitSize impl proto.SizeLimiter.
+func (pc *proxyConn) LimitSize(maxKeyLen, maxValueSize int) {
+	pc.maxKeyLen, pc.maxValueSize = maxKeyLen, maxValueSize
+}
+
 func (pc *proxyConn) Decode(msgs []*proto.Message) ([]*proto.Message, error) {
 	var err error
 	if pc.completed {
@@ -79,18 +92,159 @@ func (pc *proxyConn) Decode(msgs []*proto.Message) ([]*proto.Message, error) {
 		} else if err != nil {
 			return nil, err
 		}
+		// NOTE: the request refers to the read buffer until msg reset.
+		msgs[i].WithBuffer(pc.br.Retain())
+		if pc.maxKeyLen > 0 || pc.maxValueSize > 0 {
+			pc.checkSize(msgs[i])
+		}
+		if pc.keyPrefix != nil {
+			pc.prefixKeys(msgs[i])
+		}
 		msgs[i].MarkStart()
 	}
 	return msgs, nil
 }
 
+func (pc *proxyConn) checkSize(msg *proto.Message) {
+	for _, req := range msg.Requests() {
+		r := req.(*Request)
+		if pc.maxKeyLen > 0 && r.resp.arraySize > 1 && len(r.Key()) > pc.maxKeyLen {
+			msg.WithError(ErrKeyTooLong)
+			return
+		}
+		if pc.maxValueSize == 0 {
+			continue
+		}
+		for _, arg := range r.resp.array[1:r.resp.arraySize] {
+			if arg.respType == respBulk && bulkLen(arg.data) > pc.maxValueSize {
+				msg.WithError(ErrValueTooLarge)
+				return
+			}
+		}
+	}
+}
+
+// bulkLen returns the length of bulk data formed as "<length>\r\n<data>".
+func bulkLen(data []byte) int {
+	return len(data) - bytes.IndexByte(data, '\n') - 1
+}
+
+// oversized reports whether the buffered but incomplete request has an
+// argument larger than max, so it can be skipped before fully buffered.
+func oversized(bs []byte, max int) bool {
+	line := bytes.Index(bs, crlfBytes)
+	if line < 2 || bs[0] != respArray {
+		return false
+	}
+	n, err := conv.Btoi(bs[1:line])
+	if err != nil {
+		return false
+	}
+	pos := line + 2
+	for i := 0; i < int(n) && pos < len(bs); i++ {
+		line = bytes.Index(bs[pos:], crlfBytes)
+		if line < 2 || bs[pos] != respBulk {
+			return false
+		}
+		l, err := conv.Btoi(bs[pos+1 : pos+line])
+		if err != nil {
+			return false
+		}
+		if int(l) > max {
+			return true
+		}
+		pos += line + 2 + int(l) + 2
+	}
+	return false
+}
+
+// skipOversized swallows the request which has an argument larger than
+// maxValueSize without buffering it, the command and key are kept to
+// reply the error.
+func (pc *proxyConn) skipOversized(msg *proto.Message) (err error) {
+	line, err := pc.readLine()
+	if err != nil {
+		return
+	}
+	n, err := conv.Btoi(line[1 : len(line)-2])
+	if err != nil {
+		return
+	}
+	r := nextReq(msg)
+	r.resp.reset()
+	r.resp.respType = respArray
+	for i := 0; i < int(n); i++ {
+		if line, err = pc.readLine(); err != nil {
+			return
+		}
+		var l int64
+		if l, err = conv.Btoi(line[1 : len(line)-2]); err != nil {
+			return
+		}
+		var data []byte
+		if int(l) > pc.maxValueSize {
+			err = pc.br.Discard(int(l) + 2)
+		} else {
+			data, err = pc.readExact(int(l) + 2)
+		}
+		if err != nil {
+			return
+		}
+		if i < 2 {
+			if len(data) > 0 {
+				data = data[:len(data)-2]
+			}
+			arg := r.resp.next()
+			arg.respType = respBulk
+			arg.data = strconv.AppendInt(arg.data, int64(len(data)), 10)
+			arg.data = append(arg.data, crlfBytes...)
+			arg.data = append(arg.data, data...)
+		}
+	}
+	r.resp.data = strconv.AppendInt(r.resp.data, int64(r.resp.arraySize), 10)
+	if r.resp.arraySize > 0 {
+		conv.UpdateToUpper(r.resp.array[0].data)
+	}
+	msg.WithError(ErrValueTooLarge)
+	return
+}
+
+func (pc *proxyConn) readLine() (line []byte, err error) {
+	for {
+		if line, err = pc.br.ReadLine(); err != bufio.ErrBufferFull {
+			break
+		}
+		if err = pc.br.Read(); err != nil {
+			return
+		}
+	}
+	if err == nil && len(line) < 3 {
+		err = ErrBadRequest
+	}
+	return
+}
+
+func (pc *proxyConn) readExact(n int) (data []byte, err error) {
+	for {
+		if data, err = pc.br.ReadExact(n); err != bufio.ErrBufferFull {
+			return
+		}
+		if err = pc.br.Read(); err != nil {
+			return
+		}
+	}
+}
+
 func (pc *proxyConn) decode(msg *proto.Message) (err error) {
 	// for migrate sync PING process
 	for {
 		mark := pc.br.Mark()
-		if err = pc.resp.decode(pc.br); err != nil {
+		if err = pc.resp.decodeRef(pc.br); err != nil {
 			if err == bufio.ErrBufferFull {
 				pc.br.AdvanceTo(mark)
+				if pc.maxValueSize > 0 && oversized(pc.br.Buffer().Bytes(), pc.maxValueSize) {
+					return pc.skipOversized(msg)
+				}
 			}
 			return
 		}
@@ -102,7 +256,7 @@ func (pc *proxyConn) decode(msg *proto.Message) (err error) {
 
 	if pc.resp.arraySize < 1 {
 		r := nextReq(msg)
-		r.resp.copy(pc.resp)
+		r.resp.refer(pc.resp)
 		return
 	}
 	conv.UpdateToUpper(pc.resp.array[0].data)
@@ -128,10 +282,10 @@ func (pc *proxyConn) decode(msg *proto.Message) (err error) {
 			nre1.data = append(nre1.data, pc.msetCmd...)
 			// array resp: key
 			nre2 := r.resp.next() // NOTE: $klen\r\nkey\r\n
-			nre2.copy(pc.resp.array[i*2+1])
+			nre2.refer(pc.resp.array[i*2+1])
 			// array resp: value
 			nre3 := r.resp.next() // NOTE: $vlen\r\nvalue\r\n
-			nre3.copy(pc.resp.array[i*2+2])
+			nre3.refer(pc.resp.array[i*2+2])
 		}
 	} else if bytes.Equal(cmd, cmdMGetBytes) {
 		if pc.resp.arraySize < 2 {
@@ -152,7 +306,7 @@ func (pc *proxyConn) decode(msg *proto.Message) (err error) {
 			nre1.data = append(nre1.data, pc.mgetCmd...)
 			// array resp: key
 			nre2 := r.resp.next() // NOTE: $klen\r\nkey\r\n
-			nre2.copy(pc.resp.array[i])
+			nre2.refer(pc.resp.array[i])
 		}
 	} else if bytes.Equal(cmd, cmdDelBytes) || bytes.Equal(cmd, cmdExistsBytes) {
 		if pc.resp.arraySize < 2 {
@@ -168,14 +322,16 @@ func (pc *proxyConn) decode(msg *proto.Message) (err error) {
 			r.resp.data = append(r.resp.data, arrayLenTwo...)
 			// array resp: get
 			nre1 := r.resp.next() // NOTE: $3\r\nDEL\r\n | $6\r\nEXISTS\r\n
-			nre1.copy(pc.resp.array[0])
+			nre1.refer(pc.resp.array[0])
 			// array resp: key
 			nre2 := r.resp.next() // NOTE: $klen\r\nkey\r\n
-			nre2.copy(pc.resp.array[i])
+			nre2.refer(pc.resp.array[i])
 		}
+	} else if bytes.Equal(cmd, cmdXReadBytes) || bytes.Equal(cmd, cmdXReadGroupBytes) {
+		pc.decodeXRead(msg)
 	} else {
 		r := nextReq(msg)
-		r.resp.copy(pc.resp)
+		r.resp.refer(pc.resp)
 	}
 	return
 }
@@ -189,6 +345,9 @@ func nextReq(m *proto.Message) *Request {
 	}
 	r := req.(*Request)
 	r.mType = mergeTypeNo
+	r.merged = false
+	r.mergedTo, r.mergedIdx = nil, 0
+	r.scanNodes, r.scanIdx = 0, 0
 	return r
 }
 
@@ -211,6 +370,8 @@ func (pc *proxyConn) Encode(m *proto.Message) (err error) {
 		err = pc.mergeJoin(m)
 	case mergeTypeCount:
 		err = pc.mergeCount(m)
+	case mergeTypeStream:
+		err = pc.mergeStream(m)
 	default:
 		if !req.IsSupport() {
 			req.reply.respType = respError
@@ -222,11 +383,36 @@ func (pc *proxyConn) Encode(m *proto.Message) (err error) {
 				req.reply.respType = respString
 				req.reply.data = req.reply.data[:0]
 				req.reply.data = append(req.reply.data, pongDataBytes...)
+			} else if bytes.Equal(reqData, cmdEchoBytes) {
+				if req.resp.arraySize != 2 {
+					req.reply.SetError(echoArgsBytes)
+				} else {
+					req.reply.SetBulk(bulkData(req.resp.array[1]))
+				}
+			} else if bytes.Equal(reqData, cmdTimeBytes) {
+				req.reply.SetTime(time.Now())
 			} else if bytes.Equal(reqData, cmdQuitBytes) {
 				req.reply.respType = respString
 				req.reply.data = req.reply.data[:0]
 				req.reply.data = append(req.reply.data, justOkBytes...)
+			} else if bytes.Equal(reqData, cmdCommandBytes) {
+				req.reply.SetCommand(req.resp.array[1:req.resp.arraySize])
+			} else if !req.replied() {
+				// NOTE: CLIENT, AUTH, SELECT and SLOWLOG are answered by handler, otherwise not support
+				req.reply.respType = respError
+				req.reply.data = append(req.reply.data[:0], notSupportDataBytes...)
+			}
+		} else if req.scanNodes > 0 {
+			req.scanCursor()
+		} else if s := m.Stream(); s != nil {
+			_ = pc.bw.Write(respBulkBytes)
+			if err = pc.bw.Write(req.reply.data); err == nil {
+				err = s.WriteTo(pc.bw)
 			}
+			break
+		}
+		if pc.keyPrefix != nil {
+			req.stripKeys(pc.keyPrefix)
 		}
 		err = req.reply.encode(pc.bw)
 	}
@@ -264,50 +450,36 @@ func (pc *proxyConn) mergeCount(m *proto.Message) (err error) {
 	return
 }
 
+// mergeJoin joins the replies of sub requests in the order of keys, the
+// reply of merged request is picked from the request merged into.
 func (pc *proxyConn) mergeJoin(m *proto.Message) (err error) {
 	reqs := m.Requests()
-
-	var finalReqs []*Request
-	sum := 0
+	_ = pc.bw.Write(respArrayBytes)
+	if len(reqs) == 0 {
+		err = pc.bw.Write(nullBytes)
+		return
+	}
+	_ = pc.bw.Write([]byte(strconv.Itoa(len(reqs))))
+	if err = pc.bw.Write(crlfBytes); err != nil {
+		return
+	}
 	for _, mreq := range reqs {
 		req, ok := mreq.(*Request)
 		if !ok {
 			return ErrBadAssert
 		}
-		if req.merged {
-			continue
+		reply, idx := req.reply, 0
+		if req.merged && req.mergedTo != nil {
+			reply, idx = req.mergedTo.reply, req.mergedIdx
 		}
-
-		finalReqs = append(finalReqs, req)
-		if req.reply.respType == respArray {
-			ival, err := conv.Btoi(req.reply.data)
-			if err != nil {
+		if reply.respType == respArray {
+			if idx >= reply.arraySize {
 				return ErrBadCount
 			}
-			sum += int(ival)
-		} else {
-			sum += 1
+			reply = reply.array[idx]
 		}
-	}
-
-	_ = pc.bw.Write(respArrayBytes)
-	if len(finalReqs) == 0 {
-		err = pc.bw.Write(nullBytes)
-		return
-	}
-	_ = pc.bw.Write([]byte(strconv.Itoa(sum)))
-	if err = pc.bw.Write(crlfBytes); err != nil {
-		return
-	}
-	for _, req := range finalReqs {
-		if req.reply.respType == respArray {
-			if err = req.reply.encodeArrayData(pc.bw); err != nil {
-				return
-			}
-		} else {
-			if err = req.reply.encode(pc.bw); err != nil {
-				return
-			}
+		if err = reply.encode(pc.bw); err != nil {
+			return
 		}
 	}
 	return
@@ -316,3 +488,8 @@ func (pc *proxyConn) mergeJoin(m *proto.Message) (err error) {
 func (pc *proxyConn) Flush() (err error) {
 	return pc.bw.Flush()
 }
+
+// BufferSizes impl proto.BufferSizer.
+func (pc *proxyConn) BufferSizes() (rbuf, wbuf int) {
+	return pc.br.Size(), pc.bw.Buffered()
+}
@@ -2,6 +2,7 @@ package redis
 
 import (
 	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -299,6 +300,32 @@ func TestEncodeMergeOk(t *testing.T) {
 	}
 }
 
+func TestEncodeMergeJoinOrder(t *testing.T) {
+	data := "*4\r\n$4\r\nMGET\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n"
+	conn := libnet.NewConn(mockconn.CreateConn([]byte(data), 1), time.Second, time.Second)
+	msgs, err := NewProxyConn(conn, true).Decode(proto.GetMsgs(1))
+	assert.NoError(t, err)
+	subs := msgs[0].Batch()
+	assert.Len(t, subs, 3)
+	// NOTE: a and c are on the same node
+	ra, rb := subs[0].Request().(*Request), subs[1].Request().(*Request)
+	assert.NoError(t, ra.Merge([]proto.Request{subs[2].Request()}))
+	assert.Equal(t, 3, ra.resp.arraySize)
+
+	ra.reply.respType = respArray
+	ra.reply.data = []byte("2")
+	va, vc := ra.reply.next(), ra.reply.next()
+	va.respType, va.data = respBulk, []byte("2\r\nva")
+	vc.respType, vc.data = respBulk, nil
+	rb.reply.SetBulk([]byte("vb"))
+
+	mconn, buf := mockconn.CreateDownStreamConn()
+	pc := NewProxyConn(libnet.NewConn(mconn, time.Second, time.Second), true)
+	assert.NoError(t, pc.Encode(msgs[0]))
+	assert.NoError(t, pc.Flush())
+	assert.Equal(t, "*3\r\n$2\r\nva\r\n$2\r\nvb\r\n$-1\r\n", buf.String())
+}
+
 func TestEncodeWithError(t *testing.T) {
 	msg := proto.NewMessage()
 	req := getReq()
@@ -353,3 +380,99 @@ func TestEncodeWithPing(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "+PONG\r\n", string(data[:size]))
 }
+
+func TestDecodeLimitSize(t *testing.T) {
+	value := strings.Repeat("a", 4096)
+	data := "*3\r\n$3\r\nset\r\n$1\r\na\r\n$4096\r\n" + value + "\r\n" +
+		"*2\r\n$3\r\nget\r\n$5\r\nkkkkk\r\n" +
+		"*3\r\n$4\r\nmset\r\n$1\r\nb\r\n$6\r\nbbbbbb\r\n" +
+		"*2\r\n$3\r\nget\r\n$1\r\nb\r\n"
+	conn := libnet.NewConn(mockconn.CreateConn([]byte(data), 1), time.Second, time.Second)
+	pc := NewProxyConn(conn, true)
+	pc.(proto.SizeLimiter).LimitSize(4, 5)
+
+	var msgs []*proto.Message
+	for len(msgs) < 4 {
+		nmsgs, err := pc.Decode(proto.GetMsgs(4))
+		assert.NoError(t, err)
+		msgs = append(msgs, nmsgs...)
+	}
+	assert.Equal(t, ErrValueTooLarge, msgs[0].Err())
+	assert.Equal(t, "SET", msgs[0].Request().CmdString())
+	assert.Equal(t, "a", string(msgs[0].Request().Key()))
+	assert.Equal(t, ErrKeyTooLong, msgs[1].Err())
+	assert.Equal(t, ErrValueTooLarge, msgs[2].Err())
+	assert.NoError(t, msgs[3].Err())
+	assert.True(t, pc.(*proxyConn).br.Size() < 4096)
+
+	dconn, buf := mockconn.CreateDownStreamConn()
+	epc := NewProxyConn(libnet.NewConn(dconn, time.Second, time.Second), true)
+	err := epc.Encode(msgs[0])
+	assert.Equal(t, ErrValueTooLarge, err)
+	assert.NoError(t, epc.Flush())
+	assert.Equal(t, "-ERR value too large\r\n", buf.String())
+}
+
+func TestOversized(t *testing.T) {
+	assert.True(t, oversized([]byte("*3\r\n$3\r\nSET\r\n$1\r\na\r\n$10\r\nabc"), 5))
+	assert.False(t, oversized([]byte("*3\r\n$3\r\nSET\r\n$1\r\na\r\n$5\r\nabc"), 5))
+	assert.False(t, oversized([]byte("*3\r\n$3\r\nSET\r\n$1\r\na"), 5))
+	assert.False(t, oversized([]byte("set a b"), 5))
+}
+
+func TestDecodeRefersBuffer(t *testing.T) {
+	data := "*2\r\n$3\r\nget\r\n$1\r\na\r\n*3\r\n$4\r\nMGET\r\n$1\r\nb\r\n$1\r\nc\r\n"
+	nmsgs := _decodeMessage(t, data)
+	assert.Len(t, nmsgs, 2)
+
+	req := nmsgs[0].Request().(*Request)
+	assert.True(t, req.resp.array[1].ref)
+	assert.Equal(t, "GET", req.CmdString())
+	assert.Equal(t, "a", string(req.Key()))
+	for i, key := range []string{"b", "c"} {
+		req = nmsgs[1].Requests()[i].(*Request)
+		assert.True(t, req.resp.array[1].ref)
+		assert.False(t, req.resp.array[0].ref)
+		assert.Equal(t, key, string(req.Key()))
+	}
+	for _, msg := range nmsgs {
+		msg.Reset()
+	}
+}
+
+func BenchmarkDecodeMGet(b *testing.B) {
+	data := []byte("*4\r\n$4\r\nMGET\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n")
+	conn := libnet.NewConn(mockconn.CreateConn(data, b.N), time.Second, time.Second)
+	pc := NewProxyConn(conn, true)
+	a := proto.NewArena()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		msgs, err := pc.Decode(a.Msgs(1))
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, msg := range msgs {
+			msg.Batch()
+			msg.ResetSubs()
+			msg.Reset()
+		}
+	}
+	a.Release()
+}
+
+func TestEncodeEchoTime(t *testing.T) {
+	conn, buf := mockconn.CreateDownStreamConn()
+	pc := NewProxyConn(libnet.NewConn(conn, time.Second, time.Second), true)
+	for _, cmd := range []string{"ping", "echo hello", "echo", "time"} {
+		rpc := NewProxyConn(libnet.NewConn(mockconn.CreateConn([]byte(cmd+"\r\n"), 1), time.Second, time.Second), true)
+		msgs, err := rpc.Decode(proto.GetMsgs(1))
+		assert.NoError(t, err)
+		assert.True(t, msgs[0].Request().(*Request).IsLocal())
+		assert.NoError(t, pc.Encode(msgs[0]))
+	}
+	assert.NoError(t, pc.Flush())
+	out := buf.String()
+	prefix := "+PONG\r\n$5\r\nhello\r\n-" + string(echoArgsBytes) + "\r\n*2\r\n$"
+	assert.True(t, strings.HasPrefix(out, prefix), out)
+}
@@ -0,0 +1,279 @@
+package redis
+
+import (
+	"bytes"
+	errs "errors"
+	"sync"
+	"time"
+
+	"overlord/pkg/bufio"
+	libnet "overlord/pkg/net"
+	"overlord/proxy/proto"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	pubsubReadBufSize = 4096
+)
+
+// errors
+var (
+	ErrPubSubClosed = errs.New("pubsub node connection closed")
+)
+
+var (
+	cmdSubscribeBytes    = []byte("9\r\nSUBSCRIBE")
+	cmdPSubscribeBytes   = []byte("10\r\nPSUBSCRIBE")
+	cmdUnsubscribeBytes  = []byte("11\r\nUNSUBSCRIBE")
+	cmdPUnsubscribeBytes = []byte("12\r\nPUNSUBSCRIBE")
+	cmdResetBytes        = []byte("5\r\nRESET")
+
+	pushMessageBytes  = []byte("7\r\nmessage")
+	pushPMessageBytes = []byte("8\r\npmessage")
+
+	pubsubNotAllowedBytes = []byte("-ERR only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context\r\n")
+	pubsubQuitBytes       = []byte("+OK\r\n")
+)
+
+// IsSubscribe is SUBSCRIBE or PSUBSCRIBE command which makes the client
+// enter into pubsub.
+func (r *Request) IsSubscribe() bool {
+	if r.resp.arraySize < 2 {
+		return false
+	}
+	cmd := r.resp.array[0].data
+	return bytes.Equal(cmd, cmdSubscribeBytes) || bytes.Equal(cmd, cmdPSubscribeBytes)
+}
+
+// PubSub is the state of client connection which subscribed channels.
+// The client is pinned to a dedicated backend connection until all the
+// subscriptions are cancelled, the commands of client are sent into the
+// node by caller goroutine and the replies and pushed messages are sent
+// back by the pump goroutine.
+type PubSub struct {
+	client *libnet.Conn
+	node   *libnet.Conn
+	nbr    *bufio.Reader
+	nbw    *bufio.Writer
+
+	lock     sync.Mutex
+	cw       *bufio.Writer
+	channels map[string]struct{}
+	patterns map[string]struct{}
+	// pending is the number of replies not be sent back.
+	pending int
+	closing bool
+	done    chan struct{}
+	err     error
+}
+
+// NewPubSub creates the pubsub between client and the pinned node conn.
+func NewPubSub(client, node *libnet.Conn) *PubSub {
+	ps := &PubSub{
+		client:   client,
+		node:     node,
+		nbr:      bufio.NewReader(node, bufio.Get(pubsubReadBufSize)),
+		nbw:      bufio.NewWriter(node),
+		cw:       bufio.NewWriter(client),
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+		done:     make(chan struct{}),
+	}
+	go ps.pump()
+	return ps
+}
+
+// Send sends the pubsub commands of msgs into node and rejects the others.
+// It returns exit as true when all the subscriptions are cancelled, and
+// proto.ErrQuit when client sends QUIT.
+func (ps *PubSub) Send(msgs []*proto.Message) (exit bool, err error) {
+	for _, msg := range msgs {
+		var send bool
+		if send, err = ps.accept(msg); err != nil {
+			return
+		}
+		if !send {
+			continue
+		}
+		// NOTE: never hold the lock when writing node, pump may be blocked
+		// by the client and the node may wait for being read.
+		req := msg.Request().(*Request)
+		if err = req.resp.encode(ps.nbw); err != nil {
+			err = errors.WithStack(err)
+			return
+		}
+		if err = ps.nbw.Flush(); err != nil {
+			err = errors.WithStack(err)
+			return
+		}
+	}
+	ps.lock.Lock()
+	if len(ps.channels)+len(ps.patterns) == 0 {
+		ps.closing = true
+		exit = true
+	}
+	ps.lock.Unlock()
+	return
+}
+
+// accept tracks msg and returns send as true if it should be sent into node.
+func (ps *PubSub) accept(msg *proto.Message) (send bool, err error) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	if ps.err != nil {
+		err = ps.err
+		return
+	}
+	req, ok := msg.Request().(*Request)
+	if !ok || msg.IsBatch() {
+		err = ps.reject()
+		return
+	}
+	if req.resp.arraySize > 0 && bytes.Equal(req.resp.array[0].data, cmdQuitBytes) {
+		_ = ps.cw.Write(pubsubQuitBytes)
+		_ = ps.cw.Flush()
+		err = proto.ErrQuit
+		return
+	}
+	n, ok := ps.track(req)
+	if !ok {
+		err = ps.reject()
+		return
+	}
+	ps.pending += n
+	send = true
+	return
+}
+
+func (ps *PubSub) reject() (err error) {
+	_ = ps.cw.Write(pubsubNotAllowedBytes)
+	if err = ps.cw.Flush(); err != nil {
+		err = errors.WithStack(err)
+	}
+	return
+}
+
+// track updates the subscriptions by req and returns the number of replies.
+func (ps *PubSub) track(req *Request) (n int, ok bool) {
+	args := req.resp.array[1:req.resp.arraySize]
+	cmd := req.resp.array[0].data
+	switch {
+	case bytes.Equal(cmd, cmdSubscribeBytes), bytes.Equal(cmd, cmdPSubscribeBytes):
+		subs := ps.channels
+		if bytes.Equal(cmd, cmdPSubscribeBytes) {
+			subs = ps.patterns
+		}
+		for _, arg := range args {
+			subs[string(bulkData(arg))] = struct{}{}
+		}
+		return len(args), len(args) > 0
+	case bytes.Equal(cmd, cmdUnsubscribeBytes), bytes.Equal(cmd, cmdPUnsubscribeBytes):
+		subs := ps.channels
+		if bytes.Equal(cmd, cmdPUnsubscribeBytes) {
+			subs = ps.patterns
+		}
+		if len(args) == 0 {
+			// NOTE: unsubscribe all replies one for each subscription, at least one
+			n = len(subs)
+			if n == 0 {
+				n = 1
+			}
+			for sub := range subs {
+				delete(subs, sub)
+			}
+			return n, true
+		}
+		for _, arg := range args {
+			delete(subs, string(bulkData(arg)))
+		}
+		return len(args), true
+	case bytes.Equal(cmd, cmdResetBytes):
+		ps.channels = make(map[string]struct{})
+		ps.patterns = make(map[string]struct{})
+		return 1, true
+	case bytes.Equal(cmd, cmdPingBytes):
+		return 1, true
+	}
+	return 0, false
+}
+
+// Close waits all the replies are sent back to client when exit and
+// closes the node conn.
+func (ps *PubSub) Close() error {
+	ps.lock.Lock()
+	wait := ps.closing && ps.err == nil && ps.pending > 0
+	ps.lock.Unlock()
+	if wait {
+		<-ps.done
+	}
+	ps.lock.Lock()
+	ps.closing = true
+	ps.lock.Unlock()
+	// NOTE: the pinned node conn never times out reading, so the deadline
+	// wakes up the pump which is joined before the conn closed.
+	_ = ps.node.SetReadDeadline(time.Now())
+	<-ps.done
+	err := ps.node.Close()
+	bufio.Put(ps.nbr.Buffer())
+	return err
+}
+
+func (ps *PubSub) pump() {
+	defer close(ps.done)
+	reply := &resp{}
+	for {
+		mark := ps.nbr.Mark()
+		err := reply.decode(ps.nbr)
+		if err == bufio.ErrBufferFull {
+			ps.nbr.AdvanceTo(mark)
+			if err = ps.nbr.Read(); err == nil {
+				continue
+			}
+		}
+		ps.lock.Lock()
+		if err != nil {
+			closing := ps.closing
+			if !closing {
+				ps.err = errors.Wrap(ErrPubSubClosed, err.Error())
+			}
+			ps.lock.Unlock()
+			if !closing {
+				ps.wakeClient()
+			}
+			return
+		}
+		if !isPush(reply) {
+			ps.pending--
+		}
+		if err = reply.encode(ps.cw); err == nil {
+			err = ps.cw.Flush()
+		}
+		if err != nil {
+			ps.err = errors.WithStack(err)
+			ps.lock.Unlock()
+			ps.wakeClient()
+			return
+		}
+		finished := ps.closing && ps.pending <= 0
+		ps.lock.Unlock()
+		if finished {
+			return
+		}
+	}
+}
+
+// wakeClient wakes up the client reading goroutine blocked by the client
+// conn which never times out in pubsub, then it gets the error and exits.
+// NOTE: the conn is never closed here, which is owned by that goroutine.
+func (ps *PubSub) wakeClient() {
+	_ = ps.client.SetReadDeadline(time.Now())
+}
+
+func isPush(r *resp) bool {
+	if r.respType != respArray || r.arraySize == 0 {
+		return false
+	}
+	kind := r.array[0].data
+	return bytes.Equal(kind, pushMessageBytes) || bytes.Equal(kind, pushPMessageBytes)
+}
@@ -0,0 +1,86 @@
+package redis
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"overlord/pkg/mockconn"
+	libnet "overlord/pkg/net"
+	"overlord/proxy/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeMsgs(t *testing.T, data string, n int) []*proto.Message {
+	conn := libnet.NewConn(mockconn.CreateConn([]byte(data), 1), time.Second, time.Second)
+	pc := NewProxyConn(conn, true)
+	msgs, err := pc.Decode(proto.GetMsgs(n))
+	assert.NoError(t, err)
+	assert.Len(t, msgs, n)
+	return msgs
+}
+
+func TestRequestIsSubscribe(t *testing.T) {
+	msgs := decodeMsgs(t, "*2\r\n$9\r\nsubscribe\r\n$1\r\na\r\n*2\r\n$10\r\nPSUBSCRIBE\r\n$2\r\na*\r\n*1\r\n$9\r\nSUBSCRIBE\r\n*3\r\n$7\r\nPUBLISH\r\n$1\r\na\r\n$1\r\nb\r\n", 4)
+	assert.True(t, msgs[0].Request().(*Request).IsSubscribe())
+	assert.True(t, msgs[1].Request().(*Request).IsSubscribe())
+	assert.False(t, msgs[2].Request().(*Request).IsSubscribe())
+	assert.False(t, msgs[3].Request().(*Request).IsSubscribe())
+	assert.Equal(t, []byte("a"), msgs[3].Request().Key())
+}
+
+func TestPubSubTrack(t *testing.T) {
+	ps := &PubSub{channels: map[string]struct{}{}, patterns: map[string]struct{}{}}
+	msgs := decodeMsgs(t, "*3\r\n$9\r\nSUBSCRIBE\r\n$1\r\na\r\n$1\r\nb\r\n*2\r\n$10\r\nPSUBSCRIBE\r\n$2\r\na*\r\n*2\r\n$11\r\nUNSUBSCRIBE\r\n$1\r\na\r\n*1\r\n$4\r\nPING\r\n*1\r\n$12\r\nPUNSUBSCRIBE\r\n*1\r\n$3\r\nGET\r\n", 6)
+	expect := []int{2, 1, 1, 1, 1, 0}
+	for i, msg := range msgs {
+		n, ok := ps.track(msg.Request().(*Request))
+		assert.Equal(t, expect[i], n)
+		assert.Equal(t, expect[i] > 0, ok)
+	}
+	assert.Len(t, ps.channels, 1)
+	assert.Len(t, ps.patterns, 0)
+}
+
+func TestPubSubSendOk(t *testing.T) {
+	server, node := net.Pipe()
+	cconn, cbuf := mockconn.CreateDownStreamConn()
+	ps := NewPubSub(libnet.NewConn(cconn, time.Second, time.Second), libnet.NewConn(node, 0, time.Second))
+
+	sub := "*3\r\n$9\r\nSUBSCRIBE\r\n$1\r\na\r\n$1\r\nb\r\n"
+	unsub := "*1\r\n$11\r\nUNSUBSCRIBE\r\n"
+	go func() {
+		buf := make([]byte, len(sub))
+		_, _ = io.ReadFull(server, buf)
+		_, _ = server.Write([]byte("*3\r\n$9\r\nsubscribe\r\n$1\r\na\r\n:1\r\n*3\r\n$9\r\nsubscribe\r\n$1\r\nb\r\n:2\r\n"))
+		_, _ = server.Write([]byte("*3\r\n$7\r\nmessage\r\n$1\r\na\r\n$5\r\nhello\r\n"))
+		buf = make([]byte, len(unsub))
+		_, _ = io.ReadFull(server, buf)
+		_, _ = server.Write([]byte("*3\r\n$11\r\nunsubscribe\r\n$1\r\na\r\n:1\r\n*3\r\n$11\r\nunsubscribe\r\n$1\r\nb\r\n:0\r\n"))
+	}()
+
+	exit, err := ps.Send(decodeMsgs(t, sub+"*2\r\n$3\r\nGET\r\n$1\r\na\r\n", 2))
+	assert.NoError(t, err)
+	assert.False(t, exit)
+	exit, err = ps.Send(decodeMsgs(t, unsub, 1))
+	assert.NoError(t, err)
+	assert.True(t, exit)
+	assert.NoError(t, ps.Close())
+
+	replies := cbuf.String()
+	assert.Contains(t, replies, string(pubsubNotAllowedBytes))
+	assert.Contains(t, replies, "$5\r\nhello\r\n")
+	assert.Contains(t, replies, "$11\r\nunsubscribe\r\n$1\r\nb\r\n:0\r\n")
+}
+
+func TestPubSubSendQuit(t *testing.T) {
+	_, node := net.Pipe()
+	cconn, cbuf := mockconn.CreateDownStreamConn()
+	ps := NewPubSub(libnet.NewConn(cconn, time.Second, time.Second), libnet.NewConn(node, 0, time.Second))
+	_, err := ps.Send(decodeMsgs(t, "*1\r\n$4\r\nQUIT\r\n", 1))
+	assert.Equal(t, proto.ErrQuit, err)
+	assert.NoError(t, ps.Close())
+	assert.Equal(t, "+OK\r\n", cbuf.String())
+}
@@ -7,40 +7,91 @@ import (
 	"strconv"
 	"sync"
 
+	"overlord/pkg/conv"
 	"overlord/pkg/types"
 	"overlord/proxy/proto"
 )
 
 var (
-	emptyBytes = []byte("")
-	crlfBytes  = []byte("\r\n")
+	emptyBytes     = []byte("")
+	crossSlotBytes = []byte("CROSSSLOT Keys in request don't hash to the same node")
+	crlfBytes      = []byte("\r\n")
 
 	arrayLenTwo   = []byte("2")
 	arrayLenThree = []byte("3")
 
-	cmdEvalBytes   = []byte("4\r\nEVAL")
-	cmdQuitBytes   = []byte("4\r\nQUIT")
-	cmdPingBytes   = []byte("4\r\nPING")
-	cmdMSetBytes   = []byte("4\r\nMSET")
-	cmdMGetBytes   = []byte("4\r\nMGET")
-	cmdSetBytes    = []byte("3\r\nSET")
-	cmdGetBytes    = []byte("3\r\nGET")
-	cmdDelBytes    = []byte("3\r\nDEL")
-	cmdExistsBytes = []byte("6\r\nEXISTS")
+	cmdEvalBytes    = []byte("4\r\nEVAL")
+	cmdEvalShaBytes = []byte("7\r\nEVALSHA")
+	cmdQuitBytes    = []byte("4\r\nQUIT")
+	cmdPingBytes    = []byte("4\r\nPING")
+	cmdEchoBytes    = []byte("4\r\nECHO")
+	cmdTimeBytes    = []byte("4\r\nTIME")
+	cmdClientBytes  = []byte("6\r\nCLIENT")
+	cmdAuthBytes    = []byte("4\r\nAUTH")
+	cmdSelectBytes  = []byte("6\r\nSELECT")
+	cmdMSetBytes    = []byte("4\r\nMSET")
+	cmdMGetBytes    = []byte("4\r\nMGET")
+	cmdSetBytes     = []byte("3\r\nSET")
+	cmdGetBytes     = []byte("3\r\nGET")
+	cmdDelBytes     = []byte("3\r\nDEL")
+	cmdExistsBytes  = []byte("6\r\nEXISTS")
+	cmdHGetBytes    = []byte("4\r\nHGET")
+	cmdHMGetBytes   = []byte("5\r\nHMGET")
+
+	// numKeysIndex is the index of numkeys argument of the commands like
+	// EVAL, which is followed by the keys.
+	numKeysIndex = map[string]int{
+		"4\r\nEVAL":        2,
+		"7\r\nEVALSHA":     2,
+		"10\r\nSINTERCARD": 1,
+		"10\r\nZINTERCARD": 1,
+		"6\r\nZINTER":      1,
+		"6\r\nZUNION":      1,
+		"5\r\nZDIFF":       1,
+		"5\r\nLMPOP":       1,
+		"5\r\nZMPOP":       1,
+		"6\r\nBLMPOP":      2,
+		"6\r\nBZMPOP":      2,
+	}
+	// subKeyCmds are the commands of subcommand followed by the key.
+	subKeyCmds = map[string]struct{}{
+		"6\r\nOBJECT": {},
+		"6\r\nXGROUP": {},
+		"5\r\nXINFO":  {},
+	}
+	// sameSlotCmds are the commands of two keys which must be routed into
+	// the same node.
+	sameSlotCmds = map[string]struct{}{
+		"4\r\nCOPY":            {},
+		"11\r\nZRANGESTORE":    {},
+		"5\r\nLMOVE":           {},
+		"10\r\nBRPOPLPUSH":     {},
+		"6\r\nBLMOVE":          {},
+		"14\r\nGEOSEARCHSTORE": {},
+	}
 
 	reqSupportCmdMap = map[string]struct{}{}
 	reqControlCmdMap = map[string]struct{}{}
+	reqReadCmdMap    = map[string]struct{}{}
+	reqWriteCmdMap   = map[string]struct{}{}
 )
 
 func init() {
 	supports := append(readCmds, writeCmds...)
 	supports = append(supports, controlCmds...)
+	supports = append(supports, proxyCmds...)
 	for _, key := range supports {
 		reqSupportCmdMap[key] = struct{}{}
 	}
 	for _, key := range controlCmds {
 		reqControlCmdMap[key] = struct{}{}
 	}
+	for _, key := range readCmds {
+		reqReadCmdMap[key] = struct{}{}
+	}
+	for _, key := range writeCmds {
+		reqWriteCmdMap[key] = struct{}{}
+	}
 }
 
 // errors
@@ -50,6 +101,10 @@ var (
 	ErrBadRequest      = errs.New("bad request")
 	ErrWrongParamCount = errs.New("wrong param count")
 	ErrIgnoreMerged    = errs.New("ignore merged request")
+	ErrBadNumKeys      = errs.New("ERR value is not an integer or out of range")
+	ErrTooManyNumKeys  = errs.New("ERR Number of keys can't be greater than number of args")
+	ErrKeyTooLong      = errs.New("ERR key too long")
+	ErrValueTooLarge   = errs.New("ERR value too large")
 )
 
 // mergeType is used to decript the merge operation.
@@ -61,6 +116,7 @@ const (
 	mergeTypeCount
 	mergeTypeOK
 	mergeTypeJoin
+	mergeTypeStream
 )
 
 // Request is the type of a complete redis command
@@ -70,6 +126,15 @@ type Request struct {
 	mType        mergeType
 	merged       bool
 	batchOpCount int
+	// mergedTo and mergedIdx are the request merged into and the index of
+	// the reply in its reply array.
+	mergedTo  *Request
+	mergedIdx int
+	// scanNodes and scanIdx are the node count and index of SCAN.
+	scanNodes, scanIdx int
+	// randomKey is the RANDOMKEY emulated by SCAN under key prefix, and
+	// randomWrapped is set once the scan restarted from the first node.
+	randomKey, randomWrapped bool
 }
 
 var reqPool = &sync.Pool{
@@ -129,15 +194,184 @@ func (r *Request) Key() []byte {
 	}
 
 	k := r.resp.array[1]
-	// SUPPORT EVAL command
-	const evalArgsMinCount int = 4
-	if r.resp.arraySize >= evalArgsMinCount {
-		if bytes.Equal(r.resp.array[0].data, cmdEvalBytes) {
-			// find the 4th key with index 3
-			k = r.resp.array[3]
+	// SUPPORT EVAL/EVALSHA and the commands of numkeys, route by the first key if exists
+	if idx, ok := numKeysIndex[string(r.resp.array[0].data)]; ok {
+		if n, err := r.numKeys(); err == nil && n > 0 {
+			k = r.resp.array[idx+1]
+		}
+	} else if _, ok := subKeyCmds[string(r.resp.array[0].data)]; ok && r.resp.arraySize > 2 {
+		// NOTE: OBJECT ENCODING key
+		k = r.resp.array[2]
+	} else if r.IsXRead() {
+		if key := r.streamKey(); key != nil {
+			return key
+		}
+	}
+	return bulkData(k)
+}
+
+// IsScript is EVAL or EVALSHA command.
+func (r *Request) IsScript() bool {
+	if r.resp.arraySize < 1 {
+		return false
+	}
+	cmd := r.resp.array[0].data
+	return bytes.Equal(cmd, cmdEvalBytes) || bytes.Equal(cmd, cmdEvalShaBytes)
+}
+
+// IsMultiKey is the command of more than one key which must be routed into
+// the same node, such as EVAL and COPY.
+func (r *Request) IsMultiKey() bool {
+	if r.resp.arraySize < 1 {
+		return false
+	}
+	cmd := string(r.resp.array[0].data)
+	if _, ok := numKeysIndex[cmd]; ok {
+		return true
+	}
+	if _, ok := lastTimeoutCmds[cmd]; ok {
+		return true
+	}
+	_, ok := sameSlotCmds[cmd]
+	return ok
+}
+
+// numKeys parses the numkeys argument of EVAL/EVALSHA and the like.
+func (r *Request) numKeys() (int, error) {
+	idx := numKeysIndex[string(r.resp.array[0].data)]
+	if r.resp.arraySize < idx+1 {
+		return 0, ErrWrongParamCount
+	}
+	n, err := conv.Btoi(bulkData(r.resp.array[idx]))
+	if err != nil || n < 0 {
+		return 0, ErrBadNumKeys
+	}
+	if int(n) > r.resp.arraySize-idx-1 {
+		return 0, ErrTooManyNumKeys
+	}
+	return int(n), nil
+}
+
+// multiKeys returns the keys of the command IsMultiKey.
+func (r *Request) multiKeys() ([]*resp, error) {
+	if idx, ok := numKeysIndex[string(r.resp.array[0].data)]; ok {
+		n, err := r.numKeys()
+		if err != nil {
+			return nil, err
+		}
+		return r.resp.array[idx+1 : idx+1+n], nil
+	}
+	if r.resp.arraySize < 3 {
+		return nil, ErrWrongParamCount
+	}
+	if _, ok := lastTimeoutCmds[string(r.resp.array[0].data)]; ok {
+		return r.resp.array[1 : r.resp.arraySize-1], nil
+	}
+	return r.resp.array[1:3], nil
+}
+
+// CheckKeys checks the keys of the command IsMultiKey are all routed into
+// the same target by route, it replies error and returns false if not, and
+// the request must not be forwarded.
+func (r *Request) CheckKeys(route func(key []byte) string) bool {
+	keys, err := r.multiKeys()
+	if err != nil {
+		r.reply.SetError([]byte(err.Error()))
+		return false
+	}
+	var target string
+	for i, k := range keys {
+		t := route(bulkData(k))
+		if i == 0 {
+			target = t
+		} else if t != target {
+			r.reply.SetError(crossSlotBytes)
+			return false
 		}
 	}
+	return true
+}
+
+// IsGet is GET or the single key MGET splitted from MGET.
+func (r *Request) IsGet() bool {
+	if r.resp.arraySize != 2 {
+		return false
+	}
+	cmd := r.resp.array[0].data
+	return bytes.Equal(cmd, cmdGetBytes) || bytes.Equal(cmd, cmdMGetBytes)
+}
+
+// IsRead is the command which only reads the value of key.
+func (r *Request) IsRead() bool {
+	if r.resp.arraySize < 1 {
+		return false
+	}
+	_, ok := reqReadCmdMap[string(r.resp.array[0].data)]
+	return ok
+}
 
+// IsWrite is the command which may change the value of key.
+func (r *Request) IsWrite() bool {
+	if r.resp.arraySize < 1 {
+		return false
+	}
+	_, ok := reqWriteCmdMap[string(r.resp.array[0].data)]
+	return ok
+}
+
+// Values walks the keys and values replied by GET or MGET, the keys not
+// exist are ignored.
+func (r *Request) Values(fn func(key, value []byte)) {
+	if r.merged || r.resp.arraySize < 2 {
+		return
+	}
+	keys := r.resp.array[1:r.resp.arraySize]
+	switch r.reply.respType {
+	case respBulk:
+		if len(keys) == 1 && len(r.reply.data) > 0 {
+			fn(bulkData(keys[0]), bulkData(r.reply))
+		}
+	case respArray:
+		if r.reply.arraySize != len(keys) {
+			return
+		}
+		for i, v := range r.reply.array[:r.reply.arraySize] {
+			if v.respType == respBulk && len(v.data) > 0 {
+				fn(bulkData(keys[i]), bulkData(v))
+			}
+		}
+	}
+}
+
+// Hits impl proto.Hitter, only GET, MGET, HGET and HMGET are counted and
+// the null values are missed.
+func (r *Request) Hits() (hits, misses int) {
+	if r.merged || r.resp.arraySize < 2 {
+		return
+	}
+	cmd := r.resp.array[0].data
+	if !bytes.Equal(cmd, cmdGetBytes) && !bytes.Equal(cmd, cmdMGetBytes) &&
+		!bytes.Equal(cmd, cmdHGetBytes) && !bytes.Equal(cmd, cmdHMGetBytes) {
+		return
+	}
+	count := func(v *resp) {
+		if (v.respType == respBulk && len(v.data) > 0) || v.respType == respString {
+			hits++
+		} else if v.respType == respBulk || v.respType == respNull {
+			misses++
+		}
+	}
+	if r.reply.respType == respArray {
+		for _, v := range r.reply.array[:r.reply.arraySize] {
+			count(v)
+		}
+		return
+	}
+	count(r.reply)
+	return
+}
+
+func bulkData(k *resp) []byte {
 	var pos int
 	if k.respType == respBulk {
 		pos = bytes.Index(k.data, crlfBytes) + 2
@@ -151,17 +385,47 @@ func (r *Request) Put() {
 	r.reply.reset()
 	r.mType = mergeTypeNo
 	r.merged = false
+	r.mergedTo, r.mergedIdx = nil, 0
 	r.batchOpCount = 0
+	r.scanNodes, r.scanIdx = 0, 0
+	r.randomKey, r.randomWrapped = false, false
 	reqPool.Put(r)
 }
 
+// Size impl proto.Sizer.
+func (r *Request) Size() (req, reply int) {
+	return r.resp.size(), r.reply.size()
+}
+
+// Clone impl proto.Hedger.
+func (r *Request) Clone() proto.Request {
+	c := getReq()
+	c.resp.copy(r.resp)
+	c.mType = r.mType
+	c.scanNodes, c.scanIdx = r.scanNodes, r.scanIdx
+	c.randomKey, c.randomWrapped = r.randomKey, r.randomWrapped
+	return c
+}
+
+// CopyReply impl proto.Hedger.
+func (r *Request) CopyReply(o proto.Request) {
+	if or, ok := o.(*Request); ok {
+		r.reply.copy(or.reply)
+	}
+}
+
 func (r *Request) Merge(reqs []proto.Request) (err error) {
+	if r.mType == mergeTypeStream {
+		r.mergeStream(reqs)
+		return
+	}
 	for i := range reqs {
 		req := reqs[i].(*Request)
 		if (req.resp.arraySize-1)%r.batchOpCount != 0 {
 			return ErrWrongParamCount
 		}
 		req.merged = true
+		req.mergedTo, req.mergedIdx = r, (r.resp.arraySize-1)/r.batchOpCount
 		for i := 1; i < req.resp.arraySize; i++ {
 			nr := r.resp.next()
 			nr.copy(req.resp.array[i])
@@ -205,6 +469,36 @@ func (r *Request) IsCtl() bool {
 	return ok
 }
 
+// IsLocal impl proto.Localer, the control commands such as PING and the
+// commands not supported are answered by proxy itself.
+func (r *Request) IsLocal() bool {
+	return !r.IsSupport() || r.IsCtl()
+}
+
+// IsClient is CLIENT command which answered by proxy itself.
+func (r *Request) IsClient() bool {
+	return r.resp.arraySize > 0 && bytes.Equal(r.resp.array[0].data, cmdClientBytes)
+}
+
+// IsAuth is AUTH command which answered by proxy itself.
+func (r *Request) IsAuth() bool {
+	return r.resp.arraySize > 0 && bytes.Equal(r.resp.array[0].data, cmdAuthBytes)
+}
+
+// IsSelect is SELECT command which answered by proxy itself.
+func (r *Request) IsSelect() bool {
+	return r.resp.arraySize > 0 && bytes.Equal(r.resp.array[0].data, cmdSelectBytes)
+}
+
+// replied checks whether the control command was answered before encode.
+func (r *Request) replied() bool {
+	switch r.reply.respType {
+	case respString, respError, respInt, respBulk, respArray, respMap:
+		return true
+	}
+	return false
+}
+
 const maxArray = 32
 
 func collapseArray(rs []*resp) (collapsed []string) {
@@ -236,8 +530,12 @@ var (
 		"4\r\nPTTL",
 		"3\r\nTTL",
 		"4\r\nTYPE",
+		"6\r\nOBJECT",
+		"10\r\nEXPIRETIME",
+		"11\r\nPEXPIRETIME",
 		"8\r\nBITCOUNT",
 		"6\r\nBITPOS",
+		"11\r\nBITFIELD_RO",
 		"3\r\nGET",
 		"6\r\nGETBIT",
 		"8\r\nGETRANGE",
@@ -252,10 +550,13 @@ var (
 		"7\r\nHSTRLEN",
 		"5\r\nHVALS",
 		"5\r\nHSCAN",
+		"10\r\nHRANDFIELD",
 		"5\r\nSCARD",
 		"5\r\nSDIFF",
 		"6\r\nSINTER",
 		"9\r\nSISMEMBER",
+		"10\r\nSMISMEMBER",
+		"10\r\nSINTERCARD",
 		"8\r\nSMEMBERS",
 		"11\r\nSRANDMEMBER",
 		"6\r\nSUNION",
@@ -273,10 +574,30 @@ var (
 		"8\r\nZREVRANK",
 		"6\r\nZSCORE",
 		"5\r\nZSCAN",
+		"7\r\nZMSCORE",
+		"11\r\nZRANDMEMBER",
+		"6\r\nZINTER",
+		"6\r\nZUNION",
+		"5\r\nZDIFF",
+		"10\r\nZINTERCARD",
 		"6\r\nLINDEX",
 		"4\r\nLLEN",
 		"6\r\nLRANGE",
+		"4\r\nLPOS",
+		"4\r\nXLEN",
+		"6\r\nXRANGE",
+		"9\r\nXREVRANGE",
+		"5\r\nXREAD",
+		"8\r\nXPENDING",
+		"5\r\nXINFO",
+		"6\r\nGEOPOS",
+		"7\r\nGEODIST",
+		"7\r\nGEOHASH",
+		"9\r\nGEOSEARCH",
+		"12\r\nGEORADIUS_RO",
+		"20\r\nGEORADIUSBYMEMBER_RO",
 		"7\r\nPFCOUNT",
+		"4\r\nSCAN",
 	}
 	writeCmds = []string{
 		"3\r\nDEL",
@@ -287,10 +608,13 @@ var (
 		"9\r\nPEXPIREAT",
 		"7\r\nRESTORE",
 		"4\r\nSORT",
+		"4\r\nCOPY",
 		"6\r\nAPPEND",
 		"4\r\nDECR",
 		"6\r\nDECRBY",
 		"6\r\nGETSET",
+		"5\r\nGETEX",
+		"6\r\nGETDEL",
 		"4\r\nINCR",
 		"6\r\nINCRBY",
 		"11\r\nINCRBYFLOAT",
@@ -298,6 +622,7 @@ var (
 		"6\r\nPSETEX",
 		"3\r\nSET",
 		"6\r\nSETBIT",
+		"8\r\nBITFIELD",
 		"5\r\nSETEX",
 		"5\r\nSETNX",
 		"8\r\nSETRANGE",
@@ -318,6 +643,8 @@ var (
 		"9\r\nRPOPLPUSH",
 		"5\r\nRPUSH",
 		"6\r\nRPUSHX",
+		"5\r\nLMOVE",
+		"5\r\nLMPOP",
 		"4\r\nSADD",
 		"5\r\nSMOVE",
 		"4\r\nSPOP",
@@ -332,39 +659,70 @@ var (
 		"5\r\nPFADD",
 		"7\r\nPFMERGE",
 		"4\r\nEVAL",
+		"7\r\nEVALSHA",
 		"11\r\nSUNIONSTORE",
 		"11\r\nZUNIONSTORE",
+		"11\r\nZRANGESTORE",
+		"5\r\nZMPOP",
+		"5\r\nBLPOP",
+		"5\r\nBRPOP",
+		"10\r\nBRPOPLPUSH",
+		"6\r\nBLMOVE",
+		"6\r\nBLMPOP",
+		"8\r\nBZPOPMIN",
+		"8\r\nBZPOPMAX",
+		"6\r\nBZMPOP",
+		"6\r\nGEOADD",
+		"14\r\nGEOSEARCHSTORE",
+		"4\r\nXADD",
+		"4\r\nXDEL",
+		"5\r\nXTRIM",
+		"4\r\nXACK",
+		"6\r\nXCLAIM",
+		"10\r\nXAUTOCLAIM",
+		"6\r\nXSETID",
+		"6\r\nXGROUP",
+		"10\r\nXREADGROUP",
+		"7\r\nPUBLISH",
 	}
 	notSupportCmds = []string{
 		"6\r\nMSETNX",
 		"10\r\nSDIFFSTORE",
 		"11\r\nSINTERSTORE",
-		"5\r\nBLPOP",
-		"5\r\nBRPOP",
-		"10\r\nBRPOPLPUSH",
 		"4\r\nKEYS",
 		"7\r\nMIGRATE",
 		"4\r\nMOVE",
-		"6\r\nOBJECT",
 		"9\r\nRANDOMKEY",
 		"6\r\nRENAME",
 		"8\r\nRENAMENX",
-		"4\r\nSCAN",
 		"4\r\nWAIT",
 		"5\r\nBITOP",
-		"7\r\nEVALSHA",
-		"4\r\nAUTH",
-		"4\r\nECHO",
-		"4\r\nINFO",
 		"5\r\nPROXY",
-		"7\r\nSLOWLOG",
-		"6\r\nSELECT",
-		"4\r\nTIME",
 		"6\r\nCONFIG",
-		"8\r\nCOMMANDS",
 	}
 	controlCmds = []string{
 		"4\r\nQUIT",
 		"4\r\nPING",
+		"4\r\nECHO",
+		"4\r\nTIME",
+		"6\r\nCLIENT",
+		"4\r\nAUTH",
+		"6\r\nSELECT",
+		"9\r\nSUBSCRIBE",
+		"10\r\nPSUBSCRIBE",
+		"11\r\nUNSUBSCRIBE",
+		"12\r\nPUNSUBSCRIBE",
+		"5\r\nHELLO",
+		"7\r\nSLOWLOG",
+		"7\r\nCOMMAND",
+		"5\r\nMULTI",
+		"4\r\nEXEC",
+		"7\r\nDISCARD",
+		"5\r\nWATCH",
+		"7\r\nUNWATCH",
+	}
+	// proxyCmds are answered by handler and may be sent to nodes.
+	proxyCmds = []string{
+		"4\r\nINFO",
 	}
 )
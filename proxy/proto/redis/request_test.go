@@ -28,6 +28,12 @@ func TestRequestNewRequest(t *testing.T) {
 	assert.Equal(t, "mylist", string(req.Key()))
 	assert.True(t, req.IsSupport())
 	assert.False(t, req.IsCtl())
+	reqBytes, replyBytes := req.Size()
+	assert.Equal(t, len(bs), reqBytes)
+	assert.Equal(t, 0, replyBytes)
+	req.reply.SetInteger(12)
+	_, replyBytes = req.Size()
+	assert.Equal(t, len(":12\r\n"), replyBytes)
 }
 
 func TestMergeRequest(t *testing.T) {
@@ -50,7 +56,7 @@ func TestMergeRequest(t *testing.T) {
 	mainReq := reqs[0].(*Request)
 	err = mainReq.Merge(reqs[1:])
 	assert.NoError(t, err)
-	assert.Len(t, mainReq.resp.array, 7)
+	assert.Equal(t, 7, mainReq.resp.arraySize)
 	assert.Equal(t, []byte("7"), mainReq.resp.data)
 	assert.Equal(t, []byte("4\r\nMSET"), mainReq.resp.array[0].data)
 	assert.Equal(t, []byte("2\r\nk1"), mainReq.resp.array[1].data)
@@ -70,3 +76,151 @@ func BenchmarkCmdTypeCheck(b *testing.B) {
 		req.IsSupport()
 	}
 }
+
+func TestRequestScriptKeys(t *testing.T) {
+	route := func(key []byte) string {
+		return string(key[:1])
+	}
+	msgs := _decodeMessage(t, "eval s 2 a1 a2 argv\r\nevalsha sha 0 argv\r\neval s 2 a1 b1\r\neval s 3 a1\r\neval s x a1\r\n")
+	assert.Len(t, msgs, 5)
+
+	req := msgs[0].Request().(*Request)
+	assert.True(t, req.IsScript())
+	assert.Equal(t, "a1", string(req.Key()))
+	assert.True(t, req.CheckKeys(route))
+
+	req = msgs[1].Request().(*Request)
+	assert.True(t, req.IsScript())
+	assert.True(t, req.IsSupport())
+	assert.Equal(t, "sha", string(req.Key()))
+	assert.True(t, req.CheckKeys(route))
+
+	req = msgs[2].Request().(*Request)
+	assert.False(t, req.CheckKeys(route))
+	assert.Equal(t, crossSlotBytes, req.reply.data)
+
+	req = msgs[3].Request().(*Request)
+	assert.False(t, req.CheckKeys(route))
+	assert.Equal(t, ErrTooManyNumKeys.Error(), string(req.reply.data))
+
+	req = msgs[4].Request().(*Request)
+	assert.False(t, req.CheckKeys(route))
+	assert.Equal(t, ErrBadNumKeys.Error(), string(req.reply.data))
+}
+
+func TestRequestHits(t *testing.T) {
+	req := newRequest("GET", "a")
+	req.reply.SetBulk([]byte("1"))
+	hits, misses := req.Hits()
+	assert.Equal(t, 1, hits)
+	assert.Equal(t, 0, misses)
+
+	req.reply = &resp{respType: respBulk}
+	hits, misses = req.Hits()
+	assert.Equal(t, 0, hits)
+	assert.Equal(t, 1, misses)
+
+	req = newRequest("HMGET", "h", "a", "b")
+	req.reply = newresp(respArray, nil)
+	req.reply.array = append(req.reply.array, newresp(respBulk, []byte("1\r\n1")), newresp(respBulk, nil))
+	req.reply.arraySize = 2
+	hits, misses = req.Hits()
+	assert.Equal(t, 1, hits)
+	assert.Equal(t, 1, misses)
+
+	req = newRequest("SET", "a", "1")
+	req.reply.SetString([]byte("OK"))
+	hits, misses = req.Hits()
+	assert.Equal(t, 0, hits+misses)
+}
+
+func TestRequestMultiKeys(t *testing.T) {
+	route := func(key []byte) string {
+		return string(key[:1])
+	}
+	msgs := _decodeMessage(t, "copy a1 a2\r\ncopy a1 b1\r\nsintercard 2 a1 a2 limit 1\r\nlmpop 1 b1 left\r\nzrangestore a1\r\nobject encoding k1\r\nobject help\r\ngetdel a1\r\n")
+	assert.Len(t, msgs, 8)
+
+	req := msgs[0].Request().(*Request)
+	assert.True(t, req.IsMultiKey())
+	assert.True(t, req.IsWrite())
+	assert.Equal(t, "a1", string(req.Key()))
+	assert.True(t, req.CheckKeys(route))
+
+	req = msgs[1].Request().(*Request)
+	assert.False(t, req.CheckKeys(route))
+	assert.Equal(t, crossSlotBytes, req.reply.data)
+
+	req = msgs[2].Request().(*Request)
+	assert.True(t, req.IsMultiKey())
+	assert.True(t, req.IsRead())
+	assert.Equal(t, "a1", string(req.Key()))
+	assert.True(t, req.CheckKeys(route))
+
+	req = msgs[3].Request().(*Request)
+	assert.True(t, req.IsWrite())
+	assert.Equal(t, "b1", string(req.Key()))
+	assert.True(t, req.CheckKeys(route))
+
+	req = msgs[4].Request().(*Request)
+	assert.False(t, req.CheckKeys(route))
+	assert.Equal(t, ErrWrongParamCount.Error(), string(req.reply.data))
+
+	req = msgs[5].Request().(*Request)
+	assert.True(t, req.IsSupport())
+	assert.True(t, req.IsRead())
+	assert.False(t, req.IsMultiKey())
+	assert.Equal(t, "k1", string(req.Key()))
+	assert.Equal(t, "help", string(msgs[6].Request().(*Request).Key()))
+
+	req = msgs[7].Request().(*Request)
+	assert.True(t, req.IsWrite())
+	assert.False(t, req.IsMultiKey())
+}
+
+func TestRequestGeo(t *testing.T) {
+	route := func(key []byte) string {
+		return string(key[:1])
+	}
+	msgs := _decodeMessage(t, "geoadd a1 13.36 38.11 p\r\ngeosearch a1 fromlonlat 15 37 byradius 200 km\r\ngeosearchstore a2 a1 frommember p bybox 400 400 km\r\ngeosearchstore b1 a1 frommember p bybox 400 400 km\r\ngeoradius_ro a1 15 37 200 km\r\n")
+	assert.Len(t, msgs, 5)
+
+	req := msgs[0].Request().(*Request)
+	assert.True(t, req.IsWrite())
+	assert.False(t, req.IsMultiKey())
+	assert.Equal(t, "a1", string(req.Key()))
+
+	req = msgs[1].Request().(*Request)
+	assert.True(t, req.IsRead())
+	assert.Equal(t, "a1", string(req.Key()))
+
+	req = msgs[2].Request().(*Request)
+	assert.True(t, req.IsWrite())
+	assert.True(t, req.IsMultiKey())
+	assert.Equal(t, "a2", string(req.Key()))
+	assert.True(t, req.CheckKeys(route))
+
+	req = msgs[3].Request().(*Request)
+	assert.False(t, req.CheckKeys(route))
+	assert.Equal(t, crossSlotBytes, req.reply.data)
+
+	assert.True(t, msgs[4].Request().(*Request).IsRead())
+}
+
+func TestRequestBitfield(t *testing.T) {
+	msgs := _decodeMessage(t, "bitfield k1 incrby u2 100 1 get u4 0\r\nbitfield_ro k1 get u8 0\r\nsrandmember k2 -3\r\nhrandfield k3 2 withvalues\r\n")
+	assert.Len(t, msgs, 4)
+	assert.True(t, msgs[0].Request().(*Request).IsWrite())
+	for _, msg := range msgs[1:] {
+		assert.True(t, msg.Request().(*Request).IsRead())
+	}
+	for i, k := range []string{"k1", "k1", "k2", "k3"} {
+		assert.Equal(t, k, string(msgs[i].Request().Key()))
+	}
+
+	// NOTE: the array replies are passed through
+	for i, reply := range []string{"*2\r\n:1\r\n:0\r\n", "*1\r\n:-1\r\n", "*3\r\n$1\r\na\r\n$1\r\na\r\n$1\r\nb\r\n", "*4\r\n$1\r\nf\r\n$1\r\nv\r\n$1\r\ng\r\n$1\r\nw\r\n"} {
+		setReply(t, msgs[i].Request().(*Request).reply, reply)
+		assert.Equal(t, reply, encodeMsg(t, msgs[i]))
+	}
+}
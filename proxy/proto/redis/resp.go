@@ -6,6 +6,7 @@ import (
 	"overlord/pkg/bufio"
 	"overlord/pkg/conv"
 	"strconv"
+	"time"
 )
 
 // respType is the type of redis resp
@@ -19,6 +20,18 @@ const (
 	respInt     respType = ':'
 	respBulk    respType = '$'
 	respArray   respType = '*'
+
+	// RESP3 types
+	respNull      respType = '_'
+	respDouble    respType = ','
+	respBoolean   respType = '#'
+	respBigNumber respType = '('
+	respBlobError respType = '!'
+	respVerbatim  respType = '='
+	respMap       respType = '%'
+	respSet       respType = '~'
+	respPush      respType = '>'
+	respAttribute respType = '|'
 )
 
 var (
@@ -28,9 +41,22 @@ var (
 	respBulkBytes   = []byte("$")
 	respArrayBytes  = []byte("*")
 
+	respNullBytes      = []byte("_")
+	respDoubleBytes    = []byte(",")
+	respBooleanBytes   = []byte("#")
+	respBigNumberBytes = []byte("(")
+	respBlobErrorBytes = []byte("!")
+	respVerbatimBytes  = []byte("=")
+	respMapBytes       = []byte("%")
+	respSetBytes       = []byte("~")
+	respPushBytes      = []byte(">")
+
 	nullDataBytes = []byte("-1")
 )
 
+// respSlab is the min number of sub resps allocated at once.
+const respSlab = 4
+
 // RESP is resp export type.
 type RESP = resp
 
@@ -59,6 +85,52 @@ func (r *RESP) Encode(w *bufio.Writer) (err error) {
 	return r.encode(w)
 }
 
+// SetBulk resets resp as bulk string with data.
+func (r *RESP) SetBulk(data []byte) {
+	r.reset()
+	r.respType = respBulk
+	r.data = strconv.AppendInt(r.data, int64(len(data)), 10)
+	r.data = append(r.data, crlfBytes...)
+	r.data = append(r.data, data...)
+}
+
+// SetNullBulk resets resp as null bulk string.
+func (r *RESP) SetNullBulk() {
+	r.reset()
+	r.respType = respBulk
+}
+
+// SetString resets resp as simple string with data.
+func (r *RESP) SetString(data []byte) {
+	r.reset()
+	r.respType = respString
+	r.data = append(r.data, data...)
+}
+
+// SetError resets resp as error with message.
+func (r *RESP) SetError(msg []byte) {
+	r.reset()
+	r.respType = respError
+	r.data = append(r.data, msg...)
+}
+
+// SetInt resets resp as integer i.
+func (r *RESP) SetInt(i int64) {
+	r.reset()
+	r.respType = respInt
+	r.data = strconv.AppendInt(r.data, i, 10)
+}
+
+// SetTime resets resp as the reply of TIME, which is the array of unix
+// seconds and microseconds of t.
+func (r *RESP) SetTime(t time.Time) {
+	r.reset()
+	r.respType = respArray
+	r.next().SetBulk(strconv.AppendInt(nil, t.Unix(), 10))
+	r.next().SetBulk(strconv.AppendInt(nil, int64(t.Nanosecond()/1000), 10))
+	r.data = append(r.data, arrayLenTwo...)
+}
+
 // resp is a redis server protocol item.
 type resp struct {
 	respType respType
@@ -68,14 +140,50 @@ type resp struct {
 	array []*resp
 	// in order to reuse array.use arraySize to mark current obj.
 	arraySize int
+	// ref marks data refers to the read buffer instead of owned by r.
+	ref bool
 }
 
 func (r *resp) reset() {
 	r.respType = respUnknown
-	r.data = r.data[:0]
+	if r.ref {
+		r.data, r.ref = nil, false
+	} else {
+		r.data = r.data[:0]
+	}
 	r.arraySize = 0
 }
 
+// setData sets data into r, it is copied unless ref. The referred data is
+// capped so that appending to it never overwrites the read buffer.
+func (r *resp) setData(data []byte, ref bool) {
+	if ref {
+		r.data, r.ref = data[:len(data):len(data)], true
+		return
+	}
+	r.data = append(r.data, data...)
+}
+
+// size returns the bytes of r encoded.
+func (r *resp) size() (n int) {
+	switch r.respType {
+	case respInt, respString, respError, respNull, respDouble, respBoolean, respBigNumber:
+		return 1 + len(r.data) + len(crlfBytes)
+	case respBulk, respBlobError, respVerbatim:
+	case respArray, respMap, respSet, respPush:
+		for _, sub := range r.array[:r.arraySize] {
+			n += sub.size()
+		}
+	default:
+		return
+	}
+	n += 1 + len(r.data) + len(crlfBytes)
+	if len(r.data) == 0 {
+		n += len(nullDataBytes)
+	}
+	return
+}
+
 func (r *resp) copy(re *resp) {
 	r.reset()
 	r.respType = re.respType
@@ -86,6 +194,18 @@ func (r *resp) copy(re *resp) {
 	}
 }
 
+// refer is like copy, but the data referred to the read buffer is shared
+// instead of copied.
+func (r *resp) refer(re *resp) {
+	r.reset()
+	r.respType = re.respType
+	r.setData(re.data, re.ref)
+	for i := 0; i < re.arraySize; i++ {
+		nre := r.next()
+		nre.refer(re.array[i])
+	}
+}
+
 func (r *resp) next() *resp {
 	if r.arraySize < len(r.array) {
 		subResp := r.array[r.arraySize]
@@ -93,14 +213,32 @@ func (r *resp) next() *resp {
 		r.arraySize++
 		return subResp
 	}
-	subResp := &resp{}
+	// NOTE: alloc the sub resps in slab, as many as allocated before.
+	n := len(r.array)
+	if n < respSlab {
+		n = respSlab
+	}
+	slab := make([]resp, n)
+	for i := range slab {
+		r.array = append(r.array, &slab[i])
+	}
+	subResp := r.array[r.arraySize]
 	subResp.reset()
-	r.array = append(r.array, subResp)
 	r.arraySize++
 	return subResp
 }
 
 func (r *resp) decode(br *bufio.Reader) (err error) {
+	return r.decodeData(br, false)
+}
+
+// decodeRef is like decode, but the data refers to the read buffer of br
+// without copying, the buffer must be retained until r is reset.
+func (r *resp) decodeRef(br *bufio.Reader) (err error) {
+	return r.decodeData(br, true)
+}
+
+func (r *resp) decodeData(br *bufio.Reader, ref bool) (err error) {
 	r.reset()
 	// start read
 	line, err := br.ReadLine()
@@ -110,12 +248,16 @@ func (r *resp) decode(br *bufio.Reader) (err error) {
 	respType := line[0]
 	r.respType = respType
 	switch respType {
-	case respString, respInt, respError:
-		r.data = append(r.data, line[1:len(line)-2]...)
-	case respBulk:
-		err = r.decodeBulk(line, br)
-	case respArray:
-		err = r.decodeArray(line, br)
+	case respString, respInt, respError, respNull, respDouble, respBoolean, respBigNumber:
+		r.setData(line[1:len(line)-2], ref)
+	case respBulk, respBlobError, respVerbatim:
+		err = r.decodeBulk(line, br, ref)
+	case respArray, respSet, respPush:
+		err = r.decodeArray(line, br, 1, ref)
+	case respMap:
+		err = r.decodeArray(line, br, 2, ref)
+	case respAttribute:
+		err = r.decodeAttribute(line, br, ref)
 	default:
 		err = r.decodeInline(line)
 	}
@@ -145,7 +287,7 @@ func (r *resp) decodeInline(line []byte) (err error) {
 	return
 }
 
-func (r *resp) decodeBulk(line []byte, br *bufio.Reader) (err error) {
+func (r *resp) decodeBulk(line []byte, br *bufio.Reader, ref bool) (err error) {
 	ls := len(line)
 	bulkLengthBytes := line[1 : ls-2]
 	bulkLength, err := conv.Btoi(bulkLengthBytes)
@@ -164,11 +306,13 @@ func (r *resp) decodeBulk(line []byte, br *bufio.Reader) (err error) {
 	} else if err != nil {
 		return
 	}
-	r.data = append(r.data, data[1:len(data)-2]...)
+	r.setData(data[1:len(data)-2], ref)
 	return
 }
 
-func (r *resp) decodeArray(line []byte, br *bufio.Reader) (err error) {
+// decodeArray decodes the aggregate types, the count of elements is
+// length*n, such as map is a list of key and value.
+func (r *resp) decodeArray(line []byte, br *bufio.Reader, n int, ref bool) (err error) {
 	ls := len(line)
 	arrayLengthBytes := line[1 : ls-2]
 	arrayLength, err := conv.Btoi(arrayLengthBytes)
@@ -179,11 +323,11 @@ func (r *resp) decodeArray(line []byte, br *bufio.Reader) (err error) {
 		r.data = r.data[:0]
 		return
 	}
-	r.data = append(r.data, arrayLengthBytes...)
+	r.setData(arrayLengthBytes, ref)
 	mark := br.Mark()
-	for i := 0; i < int(arrayLength); i++ {
+	for i := 0; i < int(arrayLength)*n; i++ {
 		nre := r.next()
-		if err = nre.decode(br); err != nil {
+		if err = nre.decodeData(br, ref); err != nil {
 			br.AdvanceTo(mark)
 			br.Advance(-ls)
 			return
@@ -192,27 +336,35 @@ func (r *resp) decodeArray(line []byte, br *bufio.Reader) (err error) {
 	return
 }
 
+// decodeAttribute skips the attribute and decodes the reply following it,
+// the attributes are auxiliary data which can be ignored by proxy.
+func (r *resp) decodeAttribute(line []byte, br *bufio.Reader, ref bool) (err error) {
+	mark := br.Mark()
+	attr := &resp{}
+	if err = attr.decodeArray(line, br, 2, ref); err != nil {
+		return
+	}
+	if err = r.decodeData(br, ref); err != nil {
+		br.AdvanceTo(mark)
+		br.Advance(-len(line))
+	}
+	return
+}
+
 func (r *resp) encode(w *bufio.Writer) (err error) {
 	switch r.respType {
-	case respInt, respString, respError:
+	case respInt, respString, respError, respNull, respDouble, respBoolean, respBigNumber:
 		err = r.encodePlain(w)
-	case respBulk:
+	case respBulk, respBlobError, respVerbatim:
 		err = r.encodeBulk(w)
-	case respArray:
+	case respArray, respMap, respSet, respPush:
 		err = r.encodeArray(w)
 	}
 	return
 }
 
 func (r *resp) encodePlain(w *bufio.Writer) (err error) {
-	switch r.respType {
-	case respInt:
-		_ = w.Write(respIntBytes)
-	case respError:
-		_ = w.Write(respErrorBytes)
-	case respString:
-		_ = w.Write(respStringBytes)
-	}
+	_ = w.Write(typeBytes(r.respType))
 	if len(r.data) > 0 {
 		_ = w.Write(r.data)
 	}
@@ -221,7 +373,7 @@ func (r *resp) encodePlain(w *bufio.Writer) (err error) {
 }
 
 func (r *resp) encodeBulk(w *bufio.Writer) (err error) {
-	_ = w.Write(respBulkBytes)
+	_ = w.Write(typeBytes(r.respType))
 	if len(r.data) > 0 {
 		_ = w.Write(r.data)
 	} else {
@@ -232,7 +384,7 @@ func (r *resp) encodeBulk(w *bufio.Writer) (err error) {
 }
 
 func (r *resp) encodeArray(w *bufio.Writer) (err error) {
-	_ = w.Write(respArrayBytes)
+	_ = w.Write(typeBytes(r.respType))
 	if len(r.data) > 0 {
 		_ = w.Write(r.data)
 	} else {
@@ -243,6 +395,40 @@ func (r *resp) encodeArray(w *bufio.Writer) (err error) {
 	return
 }
 
+func typeBytes(rt respType) []byte {
+	switch rt {
+	case respString:
+		return respStringBytes
+	case respError:
+		return respErrorBytes
+	case respInt:
+		return respIntBytes
+	case respBulk:
+		return respBulkBytes
+	case respArray:
+		return respArrayBytes
+	case respNull:
+		return respNullBytes
+	case respDouble:
+		return respDoubleBytes
+	case respBoolean:
+		return respBooleanBytes
+	case respBigNumber:
+		return respBigNumberBytes
+	case respBlobError:
+		return respBlobErrorBytes
+	case respVerbatim:
+		return respVerbatimBytes
+	case respMap:
+		return respMapBytes
+	case respSet:
+		return respSetBytes
+	case respPush:
+		return respPushBytes
+	}
+	return emptyBytes
+}
+
 func (r *resp) encodeArrayData(w *bufio.Writer) (err error) {
 	for i := 0; i < r.arraySize; i++ {
 		if err = r.array[i].encode(w); err != nil {
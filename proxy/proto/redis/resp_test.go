@@ -1,6 +1,9 @@
 package redis
 
 import (
+	"bytes"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -82,6 +85,58 @@ func TestRespDecode(t *testing.T) {
 				[]byte("2"),
 			},
 		},
+		{
+			Name:       "resp3 double",
+			Bytes:      []byte(",3.14\r\n"),
+			ExpectTp:   respDouble,
+			ExpectData: []byte("3.14"),
+		},
+		{
+			Name:       "resp3 null",
+			Bytes:      []byte("_\r\n"),
+			ExpectTp:   respNull,
+			ExpectData: nil,
+		},
+		{
+			Name:       "resp3 verbatim",
+			Bytes:      []byte("=9\r\ntxt:hello\r\n"),
+			ExpectTp:   respVerbatim,
+			ExpectData: []byte("9\r\ntxt:hello"),
+		},
+		{
+			Name:       "resp3 map",
+			Bytes:      []byte("%2\r\n+a\r\n:1\r\n+b\r\n#t\r\n"),
+			ExpectTp:   respMap,
+			ExpectLen:  4,
+			ExpectData: []byte("2"),
+			ExpectArr: [][]byte{
+				[]byte("a"),
+				[]byte("1"),
+				[]byte("b"),
+				[]byte("t"),
+			},
+		},
+		{
+			Name:       "resp3 push",
+			Bytes:      []byte(">2\r\n+message\r\n(12345678901234567890\r\n"),
+			ExpectTp:   respPush,
+			ExpectLen:  2,
+			ExpectData: []byte("2"),
+			ExpectArr: [][]byte{
+				[]byte("message"),
+				[]byte("12345678901234567890"),
+			},
+		},
+		{
+			Name:       "resp3 attribute",
+			Bytes:      []byte("|1\r\n+ttl\r\n:3600\r\n~1\r\n$1\r\na\r\n"),
+			ExpectTp:   respSet,
+			ExpectLen:  1,
+			ExpectData: []byte("1"),
+			ExpectArr: [][]byte{
+				[]byte("1\r\na"),
+			},
+		},
 	}
 	for _, tt := range ts {
 		t.Run(tt.Name, func(t *testing.T) {
@@ -266,3 +321,66 @@ func TestRESPExportFunc(t *testing.T) {
 	err = r.encode(bw)
 	assert.NoError(t, err)
 }
+
+func TestRespEncodeRESP3(t *testing.T) {
+	data := []byte("%2\r\n+a\r\n,1.5\r\n=9\r\ntxt:hello\r\n>2\r\n_\r\n!3\r\nerr\r\n")
+	conn := libnet.NewConn(mockconn.CreateConn(data, 1), time.Second, time.Second)
+	br := bufio.NewReader(conn, bufio.Get(1024))
+	br.Read()
+	r := &resp{}
+	assert.NoError(t, r.decode(br))
+
+	wconn := libnet.NewConn(mockconn.CreateConn(nil, 1), time.Second, time.Second)
+	bw := bufio.NewWriter(wconn)
+	assert.NoError(t, r.encode(bw))
+	assert.NoError(t, bw.Flush())
+	assert.Equal(t, data, wconn.Conn.(*mockconn.MockConn).Wbuf.Bytes())
+}
+
+func TestRespSetHello(t *testing.T) {
+	hi := &HelloInfo{Server: "overlord", Version: "1.9.0", Proto: 3, ID: 7, Mode: "standalone", Role: "master"}
+	for _, ver := range []int{2, 3} {
+		hi.Proto = ver
+		r := &resp{}
+		r.SetHello(hi)
+		conn := libnet.NewConn(mockconn.CreateConn(nil, 1), time.Second, time.Second)
+		bw := bufio.NewWriter(conn)
+		assert.NoError(t, r.encode(bw))
+		assert.NoError(t, bw.Flush())
+		out := conn.Conn.(*mockconn.MockConn).Wbuf.String()
+		if ver == 3 {
+			assert.True(t, strings.HasPrefix(out, "%7\r\n$6\r\nserver\r\n$8\r\noverlord\r\n"))
+		} else {
+			assert.True(t, strings.HasPrefix(out, "*14\r\n"))
+		}
+		assert.Contains(t, out, "$5\r\nproto\r\n:"+strconv.Itoa(ver)+"\r\n")
+		assert.True(t, strings.HasSuffix(out, "$7\r\nmodules\r\n*0\r\n"))
+	}
+}
+
+func TestRespDecodeRef(t *testing.T) {
+	br := bufio.NewReader(bytes.NewBuffer([]byte("*2\r\n$3\r\nGET\r\n$1\r\na\r\n")), bufio.Get(1024))
+	_ = br.Read()
+	r := &resp{}
+	err := r.decodeRef(br)
+	assert.NoError(t, err)
+	assert.Equal(t, "2", string(r.data))
+	key := r.array[1]
+	assert.True(t, key.ref)
+	assert.Equal(t, "1\r\na", string(key.data))
+	assert.Equal(t, len(key.data), cap(key.data))
+
+	c := &resp{}
+	c.refer(r)
+	assert.True(t, c.array[1].ref)
+	assert.True(t, &c.array[1].data[0] == &key.data[0])
+
+	c.copy(r)
+	assert.False(t, c.array[1].ref)
+	assert.False(t, &c.array[1].data[0] == &key.data[0])
+	assert.Equal(t, "1\r\na", string(c.array[1].data))
+
+	key.reset()
+	assert.False(t, key.ref)
+	assert.Nil(t, key.data)
+}
@@ -0,0 +1,80 @@
+package redis
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+)
+
+var (
+	cmdScanBytes = []byte("4\r\nSCAN")
+
+	scanInvalidCursorBytes = []byte("ERR invalid cursor")
+	scanCursorOverflow     = []byte("ERR cursor out of range")
+)
+
+// IsScan is SCAN command which iterates the keyspace of all the nodes.
+func (r *Request) IsScan() bool {
+	return r.resp.arraySize > 1 && bytes.Equal(r.resp.array[0].data, cmdScanBytes)
+}
+
+// ScanNode decodes the cursor of SCAN into the index of node and the cursor
+// of the node, the cursor is encoded as nodeCursor*nodes+index. The cursor
+// argument is replaced by the node cursor and the reply cursor will be
+// encoded back when replied. It replies error and returns false if the
+// cursor is invalid, and the request must not be forwarded.
+func (r *Request) ScanNode(nodes int) (idx int, ok bool) {
+	if nodes <= 0 {
+		r.reply.SetError(scanInvalidCursorBytes)
+		return
+	}
+	cursor, err := strconv.ParseUint(string(bulkData(r.resp.array[1])), 10, 64)
+	if err != nil {
+		r.reply.SetError(scanInvalidCursorBytes)
+		return
+	}
+	idx = int(cursor % uint64(nodes))
+	// NOTE: never reuse data of arg which may refer to the read buffer
+	arg := &resp{}
+	arg.SetBulk(strconv.AppendUint(nil, cursor/uint64(nodes), 10))
+	r.resp.array[1] = arg
+	r.scanNodes, r.scanIdx = nodes, idx
+	ok = true
+	return
+}
+
+// scanCursor encodes the node cursor of SCAN reply into the proxy cursor.
+func (r *Request) scanCursor() {
+	if r.reply.respType != respArray || r.reply.arraySize != 2 {
+		return
+	}
+	cursor, err := strconv.ParseUint(string(bulkData(r.reply.array[0])), 10, 64)
+	if err != nil {
+		r.reply.SetError(scanInvalidCursorBytes)
+		return
+	}
+	if cursor, ok := r.proxyCursor(cursor); ok {
+		arg := &resp{}
+		arg.SetBulk(strconv.AppendUint(nil, cursor, 10))
+		r.reply.array[0] = arg
+		return
+	}
+	r.reply.SetError(scanCursorOverflow)
+}
+
+// proxyCursor encodes the node cursor of SCAN into the proxy cursor, it
+// returns false if overflow.
+func (r *Request) proxyCursor(cursor uint64) (uint64, bool) {
+	nodes, idx := uint64(r.scanNodes), uint64(r.scanIdx)
+	if cursor == 0 {
+		// NOTE: the node is finished, move to the next node or finish all.
+		if idx+1 < nodes {
+			return idx + 1, true
+		}
+		return 0, true
+	}
+	if cursor > (math.MaxUint64-idx)/nodes {
+		return 0, false
+	}
+	return cursor*nodes + idx, true
+}
@@ -0,0 +1,52 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func scanReply(cursor string) *resp {
+	reply := &resp{respType: respArray, data: []byte("2")}
+	reply.next().SetBulk([]byte(cursor))
+	keys := reply.next()
+	keys.respType = respArray
+	keys.data = []byte("1")
+	keys.next().SetBulk([]byte("a"))
+	return reply
+}
+
+func TestRequestScanNode(t *testing.T) {
+	msgs := decodeMsgs(t, "*2\r\n$4\r\nscan\r\n$1\r\n0\r\n*4\r\n$4\r\nSCAN\r\n$2\r\n22\r\n$5\r\nCOUNT\r\n$2\r\n10\r\n*2\r\n$4\r\nSCAN\r\n$1\r\nx\r\n", 3)
+
+	req := msgs[0].Request().(*Request)
+	assert.True(t, req.IsScan())
+	idx, ok := req.ScanNode(3)
+	assert.True(t, ok)
+	assert.Equal(t, 0, idx)
+	// node 0 finished and move to node 1
+	req.reply = scanReply("0")
+	req.scanCursor()
+	assert.Equal(t, []byte("1\r\n1"), req.reply.array[0].data)
+
+	req = msgs[1].Request().(*Request)
+	idx, ok = req.ScanNode(3)
+	assert.True(t, ok)
+	assert.Equal(t, 1, idx)
+	assert.Equal(t, []byte("1\r\n7"), req.resp.array[1].data)
+	assert.Equal(t, []byte("2\r\n10"), req.resp.array[3].data)
+	req.reply = scanReply("9")
+	req.scanCursor()
+	assert.Equal(t, []byte("2\r\n28"), req.reply.array[0].data)
+
+	// the last node finished
+	req.scanIdx = 2
+	req.reply = scanReply("0")
+	req.scanCursor()
+	assert.Equal(t, []byte("1\r\n0"), req.reply.array[0].data)
+
+	req = msgs[2].Request().(*Request)
+	_, ok = req.ScanNode(3)
+	assert.False(t, ok)
+	assert.Equal(t, respError, req.reply.respType)
+}
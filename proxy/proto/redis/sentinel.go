@@ -0,0 +1,152 @@
+package redis
+
+import (
+	"bytes"
+	errs "errors"
+	"fmt"
+	"net"
+	"time"
+
+	"overlord/pkg/bufio"
+	libnet "overlord/pkg/net"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	sentinelBufferSize = 512
+)
+
+// errors
+var (
+	ErrSentinelBadReply = errs.New("redis sentinel reply is bad")
+	ErrSentinelNoMaster = errs.New("redis sentinel master is unknown")
+)
+
+var (
+	switchMasterBytes = []byte("+switch-master")
+	messageBytes      = []byte("message")
+	subscribeBytes    = []byte("subscribe")
+)
+
+// Sentinel is the client of redis sentinel which resolves and follows the
+// address of masters.
+type Sentinel struct {
+	conn *libnet.Conn
+
+	br *bufio.Reader
+	bw *bufio.Writer
+}
+
+// NewSentinel new a sentinel client by conn.
+func NewSentinel(conn *libnet.Conn) *Sentinel {
+	return &Sentinel{
+		conn: conn,
+		br:   bufio.NewReader(conn, bufio.NewBuffer(sentinelBufferSize)),
+		bw:   bufio.NewWriter(conn),
+	}
+}
+
+// MasterAddr queries the current address of master name.
+func (s *Sentinel) MasterAddr(name string) (addr string, err error) {
+	if err = s.call("SENTINEL", "get-master-addr-by-name", name); err != nil {
+		return
+	}
+	reply, err := s.read()
+	if err != nil {
+		return
+	}
+	if reply.respType == respError {
+		err = errors.Wrapf(ErrSentinelBadReply, "reply:%s", reply.data)
+		return
+	}
+	// NOTE: null reply if the master name is unknown by sentinel
+	if reply.respType != respArray || reply.arraySize != 2 {
+		err = errors.Wrapf(ErrSentinelNoMaster, "master:%s", name)
+		return
+	}
+	addr = net.JoinHostPort(string(bulkData(reply.array[0])), string(bulkData(reply.array[1])))
+	return
+}
+
+// Subscribe subscribes the +switch-master events, the conn can only be used
+// by SwitchMaster after subscribed.
+func (s *Sentinel) Subscribe() (err error) {
+	if err = s.call("SUBSCRIBE", string(switchMasterBytes)); err != nil {
+		return
+	}
+	reply, err := s.read()
+	if err != nil {
+		return
+	}
+	if reply.respType != respArray || reply.arraySize != 3 || !bytes.Equal(bulkData(reply.array[0]), subscribeBytes) {
+		err = errors.Wrapf(ErrSentinelBadReply, "subscribe reply type:%c", reply.respType)
+	}
+	return
+}
+
+// SwitchMaster blocks until the next +switch-master event and returns the
+// master name and its new address.
+func (s *Sentinel) SwitchMaster() (name, addr string, err error) {
+	for {
+		var reply *resp
+		if reply, err = s.read(); err != nil {
+			return
+		}
+		if reply.respType != respArray || reply.arraySize != 3 ||
+			!bytes.Equal(bulkData(reply.array[0]), messageBytes) ||
+			!bytes.Equal(bulkData(reply.array[1]), switchMasterBytes) {
+			continue
+		}
+		// NOTE: <master name> <oldip> <oldport> <newip> <newport>
+		fields := bytes.Fields(bulkData(reply.array[2]))
+		if len(fields) != 5 {
+			err = errors.Wrapf(ErrSentinelBadReply, "switch-master:%s", bulkData(reply.array[2]))
+			return
+		}
+		return string(fields[0]), net.JoinHostPort(string(fields[3]), string(fields[4])), nil
+	}
+}
+
+// Interrupt wakes up SwitchMaster blocked by reading the conn, which returns
+// the error then. It's safe to be called by any goroutine, but the conn must
+// be closed by the goroutine reading it.
+func (s *Sentinel) Interrupt() {
+	_ = s.conn.SetReadDeadline(time.Now())
+}
+
+// Close closes the conn to sentinel.
+func (s *Sentinel) Close() error {
+	return s.conn.Close()
+}
+
+func (s *Sentinel) call(cmd string, args ...string) (err error) {
+	_ = s.bw.Write([]byte(fmt.Sprintf("*%d\r\n$%d\r\n%s\r\n", len(args)+1, len(cmd), cmd)))
+	for _, arg := range args {
+		_ = s.bw.Write([]byte(fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)))
+	}
+	if err = s.bw.Flush(); err != nil {
+		err = errors.WithStack(err)
+	}
+	return
+}
+
+// read decodes the buffered reply first and only reads the conn when there
+// is no whole reply buffered.
+func (s *Sentinel) read() (*resp, error) {
+	reply := &resp{}
+	for {
+		mark := s.br.Mark()
+		err := reply.decode(s.br)
+		if err != bufio.ErrBufferFull {
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			return reply, nil
+		}
+		s.br.AdvanceTo(mark)
+		if err = s.br.Read(); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"overlord/pkg/mockconn"
+	libnet "overlord/pkg/net"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSentinelMasterAddrOk(t *testing.T) {
+	conn := libnet.NewConn(mockconn.CreateConn([]byte("*2\r\n$9\r\n127.0.0.1\r\n$4\r\n6379\r\n"), 1), time.Second, time.Second)
+	s := NewSentinel(conn)
+	addr, err := s.MasterAddr("mymaster")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:6379", addr)
+	mc := conn.Conn.(*mockconn.MockConn)
+	assert.Equal(t, "*3\r\n$8\r\nSENTINEL\r\n$23\r\nget-master-addr-by-name\r\n$8\r\nmymaster\r\n", mc.Wbuf.String())
+}
+
+func TestSentinelMasterAddrUnknown(t *testing.T) {
+	conn := libnet.NewConn(mockconn.CreateConn([]byte("*-1\r\n"), 1), time.Second, time.Second)
+	_, err := NewSentinel(conn).MasterAddr("unknown")
+	assert.Equal(t, ErrSentinelNoMaster, errors.Cause(err))
+
+	conn = libnet.NewConn(mockconn.CreateConn([]byte("-ERR unknown command\r\n"), 1), time.Second, time.Second)
+	_, err = NewSentinel(conn).MasterAddr("mymaster")
+	assert.Equal(t, ErrSentinelBadReply, errors.Cause(err))
+}
+
+func TestSentinelSwitchMasterOk(t *testing.T) {
+	data := "*3\r\n$9\r\nsubscribe\r\n$14\r\n+switch-master\r\n:1\r\n" +
+		"*3\r\n$7\r\nmessage\r\n$14\r\n+switch-master\r\n$42\r\nmymaster 127.0.0.1 6379 127.0.0.1 6380 xxx\r\n" +
+		"*3\r\n$7\r\nmessage\r\n$14\r\n+switch-master\r\n$38\r\nmymaster 127.0.0.1 6379 127.0.0.1 6380\r\n"
+	conn := libnet.NewConn(mockconn.CreateConn([]byte(data), 1), time.Second, time.Second)
+	s := NewSentinel(conn)
+	assert.NoError(t, s.Subscribe())
+	mc := conn.Conn.(*mockconn.MockConn)
+	assert.Equal(t, "*2\r\n$9\r\nSUBSCRIBE\r\n$14\r\n+switch-master\r\n", mc.Wbuf.String())
+
+	_, _, err := s.SwitchMaster()
+	assert.Equal(t, ErrSentinelBadReply, errors.Cause(err))
+	name, addr, err := s.SwitchMaster()
+	assert.NoError(t, err)
+	assert.Equal(t, "mymaster", name)
+	assert.Equal(t, "127.0.0.1:6380", addr)
+
+	_, _, err = s.SwitchMaster()
+	assert.Error(t, err)
+	assert.NoError(t, s.Close())
+}
@@ -0,0 +1,56 @@
+package redis
+
+import (
+	"bytes"
+	"strconv"
+)
+
+var (
+	cmdSlowlogBytes = []byte("7\r\nSLOWLOG")
+)
+
+// SlowlogInfo is the entry replied by SLOWLOG GET.
+type SlowlogInfo struct {
+	ID       int64
+	Time     int64
+	Duration int64
+	Args     []string
+	Addr     string
+	Name     string
+}
+
+// IsSlowlog is SLOWLOG command which answered by proxy itself.
+func (r *Request) IsSlowlog() bool {
+	return r.resp.arraySize > 0 && bytes.Equal(r.resp.array[0].data, cmdSlowlogBytes)
+}
+
+// SetInteger resets resp as integer.
+func (r *RESP) SetInteger(i int64) {
+	r.reset()
+	r.respType = respInt
+	r.data = strconv.AppendInt(r.data, i, 10)
+}
+
+// SetSlowlog resets resp as the reply of SLOWLOG GET, each entry is an
+// array of id, unix time, duration in microseconds, args, addr and name.
+func (r *RESP) SetSlowlog(sis []*SlowlogInfo) {
+	r.reset()
+	r.respType = respArray
+	for _, si := range sis {
+		e := r.next()
+		e.respType = respArray
+		e.next().SetInteger(si.ID)
+		e.next().SetInteger(si.Time)
+		e.next().SetInteger(si.Duration)
+		args := e.next()
+		args.respType = respArray
+		for _, arg := range si.Args {
+			args.next().SetBulk([]byte(arg))
+		}
+		args.data = strconv.AppendInt(args.data, int64(args.arraySize), 10)
+		e.next().SetBulk([]byte(si.Addr))
+		e.next().SetBulk([]byte(si.Name))
+		e.data = strconv.AppendInt(e.data, int64(e.arraySize), 10)
+	}
+	r.data = strconv.AppendInt(r.data, int64(r.arraySize), 10)
+}
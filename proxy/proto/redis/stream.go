@@ -0,0 +1,169 @@
+package redis
+
+import (
+	"bytes"
+	errs "errors"
+	"strconv"
+
+	"overlord/proxy/proto"
+)
+
+// errors
+var (
+	ErrStreamBlock = errs.New("ERR BLOCK of XREAD and XREADGROUP is not supported")
+)
+
+var (
+	cmdXReadBytes      = []byte("5\r\nXREAD")
+	cmdXReadGroupBytes = []byte("10\r\nXREADGROUP")
+
+	streamsBytes = []byte("STREAMS")
+	blockBytes   = []byte("BLOCK")
+)
+
+// IsXRead is XREAD or XREADGROUP command.
+func (r *Request) IsXRead() bool {
+	if r.resp.arraySize < 1 {
+		return false
+	}
+	cmd := r.resp.array[0].data
+	return bytes.Equal(cmd, cmdXReadBytes) || bytes.Equal(cmd, cmdXReadGroupBytes)
+}
+
+// streamsIndex returns the index of STREAMS option of XREAD and XREADGROUP,
+// or -1 if not found. The keys and ids are followed in pairs.
+func streamsIndex(r *resp) int {
+	for i := 1; i < r.arraySize; i++ {
+		if bytes.EqualFold(bulkData(r.array[i]), streamsBytes) {
+			return i
+		}
+	}
+	return -1
+}
+
+// hasBlock returns whether or not the options of XREAD before STREAMS
+// contain BLOCK.
+func hasBlock(r *resp, streams int) bool {
+	for i := 1; i < streams; i++ {
+		if bytes.EqualFold(bulkData(r.array[i]), blockBytes) {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeXRead splits XREAD and XREADGROUP of more than one stream into the
+// sub requests of each stream key, which are merged by node when sending.
+func (pc *proxyConn) decodeXRead(msg *proto.Message) {
+	idx := streamsIndex(pc.resp)
+	if idx > 0 && hasBlock(pc.resp, idx) {
+		r := nextReq(msg)
+		r.resp.refer(pc.resp)
+		msg.WithError(ErrStreamBlock)
+		return
+	}
+	n := pc.resp.arraySize - idx - 1
+	if idx < 0 || n <= 2 || n%2 != 0 {
+		// NOTE: the single stream and bad syntax are left to the node
+		r := nextReq(msg)
+		r.resp.refer(pc.resp)
+		return
+	}
+	n /= 2
+	for i := 0; i < n; i++ {
+		r := nextReq(msg)
+		r.mType = mergeTypeStream
+		r.resp.reset()
+		r.resp.respType = respArray
+		for _, opt := range pc.resp.array[:idx+1] {
+			r.resp.next().refer(opt)
+		}
+		r.resp.next().refer(pc.resp.array[idx+1+i])
+		r.resp.next().refer(pc.resp.array[idx+1+n+i])
+		r.resp.data = strconv.AppendInt(r.resp.data, int64(r.resp.arraySize), 10)
+	}
+}
+
+// streamKey returns the first stream key of XREAD and XREADGROUP.
+func (r *Request) streamKey() []byte {
+	idx := streamsIndex(r.resp)
+	if idx < 0 || idx+1 >= r.resp.arraySize {
+		return nil
+	}
+	return bulkData(r.resp.array[idx+1])
+}
+
+// mergeStream merges the sub requests of XREAD into r.
+func (r *Request) mergeStream(reqs []proto.Request) {
+	r.appendStreams(reqs)
+	for i := range reqs {
+		req := reqs[i].(*Request)
+		req.merged = true
+		req.mergedTo = r
+	}
+}
+
+// appendStreams appends the stream keys and ids of reqs into r, they are
+// placed as STREAMS k1 k2 id1 id2.
+func (r *Request) appendStreams(reqs []proto.Request) {
+	ids := []*resp{{}}
+	ids[0].copy(r.resp.array[r.resp.arraySize-1])
+	r.resp.arraySize--
+	for i := range reqs {
+		req := reqs[i].(*Request)
+		r.resp.next().copy(req.resp.array[req.resp.arraySize-2])
+		ids = append(ids, req.resp.array[req.resp.arraySize-1])
+	}
+	for _, id := range ids {
+		r.resp.next().copy(id)
+	}
+	r.resp.data = strconv.AppendInt(r.resp.data[:0], int64(r.resp.arraySize), 10)
+}
+
+// mergeStream replies the streams found in the replies of sub requests in
+// the order of keys, null if none, the first error is replied if any.
+func (pc *proxyConn) mergeStream(m *proto.Message) (err error) {
+	var found []*resp
+	for _, mreq := range m.Requests() {
+		req, ok := mreq.(*Request)
+		if !ok {
+			return ErrBadAssert
+		}
+		reply := req.reply
+		if req.merged && req.mergedTo != nil {
+			reply = req.mergedTo.reply
+		}
+		if reply.respType == respError {
+			return reply.encode(pc.bw)
+		}
+		if reply.respType != respArray {
+			continue
+		}
+		key := req.streamKey()
+		for _, s := range reply.array[:reply.arraySize] {
+			if s.arraySize > 0 && bytes.Equal(bulkData(s.array[0]), key) {
+				found = append(found, s)
+				break
+			}
+		}
+	}
+	if pc.keyPrefix != nil {
+		for _, s := range found {
+			s.array[0].strip(pc.keyPrefix)
+		}
+	}
+	_ = pc.bw.Write(respArrayBytes)
+	if len(found) == 0 {
+		return pc.bw.Write(nullBytes)
+	}
+	_ = pc.bw.Write([]byte(strconv.Itoa(len(found))))
+	if err = pc.bw.Write(crlfBytes); err != nil {
+		return
+	}
+	for _, s := range found {
+		if err = s.encode(pc.bw); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,81 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"overlord/pkg/bufio"
+	"overlord/pkg/mockconn"
+	libnet "overlord/pkg/net"
+	"overlord/proxy/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setReply(t *testing.T, r *RESP, data string) {
+	conn := libnet.NewConn(mockconn.CreateConn([]byte(data), 1), time.Second, time.Second)
+	assert.NoError(t, readReply(bufio.NewReader(conn, bufio.Get(1024)), r))
+}
+
+func encodeMsg(t *testing.T, msg *proto.Message) string {
+	mconn, buf := mockconn.CreateDownStreamConn()
+	pc := NewProxyConn(libnet.NewConn(mconn, time.Second, time.Second), true)
+	assert.NoError(t, pc.Encode(msg))
+	assert.NoError(t, pc.Flush())
+	return buf.String()
+}
+
+func TestDecodeXRead(t *testing.T) {
+	msgs := decodeMsgs(t, "XREAD COUNT 2 STREAMS a b c 0 1 2\r\nXREAD STREAMS a 0\r\nXREADGROUP GROUP g c STREAMS a b > >\r\nXLEN a\r\nXGROUP CREATE a g $\r\n", 5)
+	subs := msgs[0].Batch()
+	assert.Len(t, subs, 3)
+	for i, k := range []string{"a", "b", "c"} {
+		req := subs[i].Request().(*Request)
+		assert.Equal(t, mergeTypeStream, req.mType)
+		assert.Equal(t, k, string(req.Key()))
+		assert.Equal(t, 6, req.resp.arraySize)
+	}
+	assert.False(t, msgs[1].IsBatch())
+	assert.Equal(t, "a", string(msgs[1].Request().Key()))
+	assert.Len(t, msgs[2].Batch(), 2)
+	assert.Equal(t, "b", string(msgs[2].Batch()[1].Request().Key()))
+	assert.Equal(t, "a", string(msgs[3].Request().Key()))
+	assert.Equal(t, "a", string(msgs[4].Request().Key()))
+
+	// NOTE: a and c are on the same node
+	ra := subs[0].Request().(*Request)
+	assert.NoError(t, ra.Merge([]proto.Request{subs[2].Request()}))
+	assert.Equal(t, 8, ra.resp.arraySize)
+	for i, arg := range []string{"a", "c", "0", "2"} {
+		assert.Equal(t, arg, string(bulkData(ra.resp.array[4+i])))
+	}
+	assert.Equal(t, "8", string(ra.resp.data))
+}
+
+func TestDecodeXReadBlock(t *testing.T) {
+	msgs := decodeMsgs(t, "XREAD BLOCK 0 STREAMS a b 0 0\r\n", 1)
+	assert.False(t, msgs[0].IsBatch())
+	assert.Equal(t, ErrStreamBlock, msgs[0].Err())
+}
+
+func TestEncodeMergeStream(t *testing.T) {
+	msgs := decodeMsgs(t, "XREAD STREAMS a b c 0 0 0\r\nXREAD STREAMS a b 0 0\r\nXREAD STREAMS a b 0 0\r\n", 3)
+	subs := msgs[0].Batch()
+	ra, rb := subs[0].Request().(*Request), subs[1].Request().(*Request)
+	assert.NoError(t, ra.Merge([]proto.Request{subs[2].Request()}))
+	setReply(t, ra.reply, "*2\r\n*2\r\n$1\r\nc\r\n*1\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n*2\r\n$1\r\na\r\n*0\r\n")
+	setReply(t, rb.reply, "*-1\r\n")
+	assert.Equal(t, "*2\r\n*2\r\n$1\r\na\r\n*0\r\n*2\r\n$1\r\nc\r\n*1\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n",
+		encodeMsg(t, msgs[0]))
+
+	subs = msgs[1].Batch()
+	for _, sub := range subs {
+		setReply(t, sub.Request().(*Request).reply, "*-1\r\n")
+	}
+	assert.Equal(t, "*-1\r\n", encodeMsg(t, msgs[1]))
+
+	subs = msgs[2].Batch()
+	setReply(t, subs[0].Request().(*Request).reply, "*-1\r\n")
+	setReply(t, subs[1].Request().(*Request).reply, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+	assert.Equal(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", encodeMsg(t, msgs[2]))
+}
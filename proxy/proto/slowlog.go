@@ -28,6 +28,7 @@ func NewSlowlogEntry(ctype types.CacheType) *SlowlogEntry {
 
 // SlowlogEntry is each slowlog item
 type SlowlogEntry struct {
+	ID        int64  `json:",omitempty"`
 	Cluster   string `json:"cluster,omitempty"`
 	CacheType types.CacheType
 	Cmd       []string
@@ -40,6 +41,7 @@ type SlowlogEntry struct {
 	PipeDur      time.Duration
 	InputDur     time.Duration
 	Addr         string
+	TraceID      string          `json:",omitempty"`
 	Subs         []*SlowlogEntry `json:"Subs,omitempty"`
 }
 
@@ -0,0 +1,164 @@
+package proto
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"overlord/pkg/bufio"
+)
+
+const (
+	streamChunkSize      = 64 * 1024
+	defaultStreamTimeout = time.Second
+)
+
+// errors
+var (
+	ErrStreamClosed  = errors.New("stream is closed")
+	ErrStreamTimeout = errors.New("stream is timeout")
+)
+
+// Streamer is the config of streaming the large value of reply,
+// the value larger than Threshold is sent to client chunk by chunk
+// with at most Buffer bytes in flight.
+type Streamer struct {
+	Threshold int
+	Buffer    int
+	// Timeout is the max time node conn waits client to take a chunk.
+	Timeout time.Duration
+}
+
+// NewStream creates a stream of the rest n bytes of value in br.
+func (st *Streamer) NewStream(br *bufio.Reader, n int) *Stream {
+	chunk := streamChunkSize
+	if st.Buffer > 0 && st.Buffer < chunk {
+		chunk = st.Buffer
+	}
+	size := st.Buffer / chunk
+	if size < 1 {
+		size = 1
+	}
+	timeout := st.Timeout
+	if timeout <= 0 {
+		timeout = defaultStreamTimeout
+	}
+	return &Stream{
+		br:      br,
+		remain:  n,
+		chunk:   chunk,
+		timeout: timeout,
+		chunks:  make(chan []byte, size),
+		done:    make(chan struct{}),
+	}
+}
+
+// Stream is the large value being read from node and written into client.
+type Stream struct {
+	br      *bufio.Reader
+	remain  int
+	chunk   int
+	timeout time.Duration
+
+	chunks chan []byte
+	done   chan struct{}
+	once   sync.Once
+	err    error
+}
+
+// Pump reads the rest of value from node and sends it to client.
+// The value is always drained from node even if client is gone,
+// so the returned error only means the node conn is broken.
+func (s *Stream) Pump() (err error) {
+	var werr error
+	for s.remain > 0 {
+		n := s.chunk
+		if n > s.remain {
+			n = s.remain
+		}
+		var data []byte
+		if data, err = s.br.ReadAtMost(n); err == bufio.ErrBufferFull {
+			if err = s.br.Read(); err != nil {
+				break
+			}
+			continue
+		} else if err != nil {
+			break
+		}
+		s.remain -= len(data)
+		if werr == nil {
+			werr = s.write(data)
+		}
+	}
+	if err != nil {
+		s.closeWrite(err)
+	} else {
+		s.closeWrite(werr)
+	}
+	return
+}
+
+func (s *Stream) write(data []byte) error {
+	bs := make([]byte, len(data))
+	copy(bs, data)
+	t := time.NewTimer(s.timeout)
+	defer t.Stop()
+	select {
+	case s.chunks <- bs:
+		return nil
+	case <-s.done:
+		return ErrStreamClosed
+	case <-t.C:
+		return ErrStreamTimeout
+	}
+}
+
+func (s *Stream) closeWrite(err error) {
+	s.err = err
+	close(s.chunks)
+}
+
+// Next returns the next chunk of value, io.EOF if all chunks are taken.
+func (s *Stream) Next() ([]byte, error) {
+	bs, ok := <-s.chunks
+	if ok {
+		return bs, nil
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	return nil, io.EOF
+}
+
+// Close stops taking the chunks.
+func (s *Stream) Close() {
+	s.once.Do(func() {
+		close(s.done)
+	})
+}
+
+type flushWriter interface {
+	Write(p []byte) error
+	Flush() error
+}
+
+// WriteTo writes all chunks into w and flushes every chunk, so that
+// the memory is bounded by the in flight buffer.
+func (s *Stream) WriteTo(w flushWriter) (err error) {
+	defer s.Close()
+	for {
+		var bs []byte
+		if bs, err = s.Next(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return
+		}
+		if err = w.Write(bs); err != nil {
+			return
+		}
+		if err = w.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package proto
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"overlord/pkg/bufio"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockFlushWriter struct {
+	buf     bytes.Buffer
+	flushed int
+}
+
+func (w *mockFlushWriter) Write(p []byte) error {
+	_, err := w.buf.Write(p)
+	return err
+}
+
+func (w *mockFlushWriter) Flush() error {
+	w.flushed++
+	return nil
+}
+
+func _streamData(n int) []byte {
+	return bytes.Repeat([]byte("0123456789"), n/10)
+}
+
+func _lastErr(s *Stream) (err error) {
+	for err == nil {
+		_, err = s.Next()
+	}
+	return
+}
+
+func TestStreamPumpOk(t *testing.T) {
+	data := _streamData(200 * 1024)
+	br := bufio.NewReader(bytes.NewReader(data), bufio.NewBuffer(1024))
+	st := &Streamer{Threshold: 1, Buffer: 4096}
+	s := st.NewStream(br, len(data))
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.Pump() }()
+	w := &mockFlushWriter{}
+	err := s.WriteTo(w)
+	assert.NoError(t, err)
+	assert.NoError(t, <-errCh)
+	assert.Equal(t, data, w.buf.Bytes())
+	assert.True(t, w.flushed > 1)
+	assert.Equal(t, 1024, br.Size())
+}
+
+func TestStreamClosedDrain(t *testing.T) {
+	data := _streamData(10 * 1024)
+	br := bufio.NewReader(bytes.NewReader(data), bufio.NewBuffer(1024))
+	st := &Streamer{Threshold: 1, Buffer: 1024}
+	s := st.NewStream(br, len(data))
+	s.Close()
+
+	err := s.Pump()
+	assert.NoError(t, err)
+	_, err = br.ReadAtMost(1)
+	assert.Equal(t, bufio.ErrBufferFull, err)
+	assert.Equal(t, ErrStreamClosed, _lastErr(s))
+}
+
+func TestStreamTimeout(t *testing.T) {
+	data := _streamData(10 * 1024)
+	br := bufio.NewReader(bytes.NewReader(data), bufio.NewBuffer(1024))
+	st := &Streamer{Threshold: 1, Buffer: 1024, Timeout: 10 * time.Millisecond}
+	s := st.NewStream(br, len(data))
+
+	err := s.Pump()
+	assert.NoError(t, err)
+	assert.Equal(t, ErrStreamTimeout, _lastErr(s))
+}
+
+func TestStreamNodeErr(t *testing.T) {
+	data := _streamData(1024)
+	br := bufio.NewReader(bytes.NewReader(data), bufio.NewBuffer(1024))
+	st := &Streamer{Threshold: 1, Buffer: 4096}
+	s := st.NewStream(br, len(data)+10)
+
+	err := s.Pump()
+	assert.Error(t, err)
+	assert.Equal(t, err, _lastErr(s))
+}
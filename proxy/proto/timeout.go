@@ -0,0 +1,87 @@
+package proto
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"overlord/pkg/prom"
+)
+
+const (
+	timeoutSamples = 1024
+	// timeoutRecalc is the number of samples to recalculate the timeout.
+	timeoutRecalc = 64
+	// timeoutPercentile is the percentile of latencies multiplied.
+	timeoutPercentile = 99
+)
+
+// ReadTimeouter is the NodeConn whose read timeout can be changed, which
+// is called by the goroutine reading it.
+type ReadTimeouter interface {
+	SetReadTimeout(timeout time.Duration)
+}
+
+// AdaptiveTimeout is the read timeout of a node computed from the recent
+// latencies, which is the p99 multiplied by factor and clamped to min and
+// max. It's max until enough latencies observed.
+type AdaptiveTimeout struct {
+	cluster, addr string
+	factor        float64
+	min, max      time.Duration
+
+	lock    sync.Mutex
+	samples []time.Duration
+	idx     int
+	count   int
+	timeout int64
+}
+
+// NewAdaptiveTimeout new the adaptive read timeout of node addr.
+func NewAdaptiveTimeout(cluster, addr string, factor float64, min, max time.Duration) *AdaptiveTimeout {
+	return &AdaptiveTimeout{
+		cluster: cluster,
+		addr:    addr,
+		factor:  factor,
+		min:     min,
+		max:     max,
+		samples: make([]time.Duration, 0, timeoutSamples),
+		timeout: int64(max),
+	}
+}
+
+// Observe records the latency d of one message read from node.
+func (at *AdaptiveTimeout) Observe(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	at.lock.Lock()
+	defer at.lock.Unlock()
+	if len(at.samples) < timeoutSamples {
+		at.samples = append(at.samples, d)
+	} else {
+		at.samples[at.idx] = d
+		at.idx = (at.idx + 1) % timeoutSamples
+	}
+	if at.count++; at.count%timeoutRecalc != 0 {
+		return
+	}
+	sorted := append([]time.Duration(nil), at.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	timeout := time.Duration(float64(sorted[len(sorted)*timeoutPercentile/100]) * at.factor)
+	if timeout < at.min {
+		timeout = at.min
+	} else if timeout > at.max {
+		timeout = at.max
+	}
+	atomic.StoreInt64(&at.timeout, int64(timeout))
+	if prom.On {
+		prom.ReadTimeout(at.cluster, at.addr, int64(timeout/time.Millisecond))
+	}
+}
+
+// Timeout returns the read timeout of node.
+func (at *AdaptiveTimeout) Timeout() time.Duration {
+	return time.Duration(atomic.LoadInt64(&at.timeout))
+}
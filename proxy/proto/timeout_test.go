@@ -0,0 +1,53 @@
+package proto
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdaptiveTimeout(t *testing.T) {
+	at := NewAdaptiveTimeout("c", "n", 3, 5*time.Millisecond, 100*time.Millisecond)
+	assert.Equal(t, 100*time.Millisecond, at.Timeout())
+	for i := 0; i < timeoutRecalc; i++ {
+		at.Observe(4 * time.Millisecond)
+	}
+	assert.Equal(t, 12*time.Millisecond, at.Timeout())
+
+	// NOTE: clamped to min
+	at.Observe(-time.Millisecond)
+	for i := 0; i < timeoutSamples; i++ {
+		at.Observe(time.Millisecond)
+	}
+	assert.Equal(t, 5*time.Millisecond, at.Timeout())
+
+	// NOTE: clamped to max
+	for i := 0; i < timeoutSamples; i++ {
+		at.Observe(time.Second)
+	}
+	assert.Equal(t, 100*time.Millisecond, at.Timeout())
+}
+
+// timeoutNodeConn records the read timeout set.
+type timeoutNodeConn struct {
+	mockNodeConn
+	timeouts chan time.Duration
+}
+
+func (n *timeoutNodeConn) SetReadTimeout(timeout time.Duration) {
+	n.timeouts <- timeout
+}
+
+func TestPipeAdaptiveTimeout(t *testing.T) {
+	nc := &timeoutNodeConn{timeouts: make(chan time.Duration, 1)}
+	ncp := NewNodeConnPipe(1, 32, func() NodeConn {
+		return nc
+	})
+	defer ncp.Close()
+	ncp.SetTimeout(NewAdaptiveTimeout("c", "n", 2, time.Millisecond, 50*time.Millisecond))
+	assert.Equal(t, 50*time.Millisecond, ncp.ReadTimeout())
+	_, wg := pushKey(ncp, "a")
+	assert.True(t, waitTimeout(wg, time.Second))
+	assert.Equal(t, 50*time.Millisecond, <-nc.timeouts)
+}
@@ -2,6 +2,9 @@ package proto
 
 import (
 	"errors"
+	"time"
+
+	libnet "overlord/pkg/net"
 )
 
 // defined common errors
@@ -25,6 +28,37 @@ type Request interface {
 	Slowlogger
 }
 
+// Classifier is the Request which knows whether it reads or writes the
+// value of key, requests neither read nor write are such as PING.
+type Classifier interface {
+	IsRead() bool
+	IsWrite() bool
+}
+
+// Hedger is the Request which can be cloned to hedge slow reads, the
+// reply of the clone answered first is copied back.
+type Hedger interface {
+	Clone() Request
+	CopyReply(Request)
+}
+
+// Hitter is the Request which reads values of keys and knows how many of
+// them are found in its reply, both are zero for the other requests.
+type Hitter interface {
+	Hits() (hits, misses int)
+}
+
+// Localer is the Request which may be answered by proxy itself such as
+// PING, the local request is never forwarded to nodes.
+type Localer interface {
+	IsLocal() bool
+}
+
+// Sizer is the Request which knows the bytes of itself and its reply.
+type Sizer interface {
+	Size() (req, reply int)
+}
+
 // ProxyConn decode bytes from client and encode write to conn.
 type ProxyConn interface {
 	Decode([]*Message) ([]*Message, error)
@@ -32,6 +66,58 @@ type ProxyConn interface {
 	Flush() error
 }
 
+// BufferSizer is the ProxyConn which can report the allocated size of
+// read buffer and the bytes waiting to be flushed of write buffer.
+type BufferSizer interface {
+	BufferSizes() (rbuf, wbuf int)
+}
+
+// SizeLimiter is the ProxyConn which rejects the request whose key is
+// longer than maxKeyLen or value is larger than maxValueSize while decoding,
+// the rejected message is decoded with error and never forwarded.
+// Zero means no limit.
+type SizeLimiter interface {
+	LimitSize(maxKeyLen, maxValueSize int)
+}
+
+// KeyPrefixer is the ProxyConn which prepends prefix to the keys of
+// requests while decoding and strips it from the keys in replies, so that
+// clusters of different prefix share the same nodes.
+type KeyPrefixer interface {
+	PrefixKeys(prefix []byte)
+}
+
+// Fallbacker is the Request which reads the value of one key such as GET,
+// its miss can be read from another cluster and filled back.
+type Fallbacker interface {
+	// Missed reports whether the key is not found by the reply.
+	Missed() bool
+	// Fallback returns the request reading the key from another cluster.
+	Fallback() Request
+	// Answer copies the value read by the fallback request into the reply,
+	// and returns the request writing it back with ttl, nil if not found.
+	Answer(fr Request, ttl time.Duration) Request
+}
+
+// Partialer is the sub Request splitted from multi-key command such as
+// MGET, whose failure can be answered as empty instead of failing the
+// whole command.
+type Partialer interface {
+	// Broken reports whether the reply doesn't match the keys, such as the
+	// error or the array of wrong length replied to MGET.
+	Broken() bool
+	// Partial resets the reply as the empty one such as nils of MGET and 0
+	// of DEL, returns false if the command must fail as a whole like MSET.
+	Partial() bool
+}
+
+// Capturer is the Request which can be appended to buf in the wire format
+// of its protocol for replay, the values are masked by the same length if
+// keyOnly.
+type Capturer interface {
+	Capture(buf []byte, keyOnly bool) []byte
+}
+
 // NodeConn handle Msg to backend cache server and read response.
 type NodeConn interface {
 	Write(*Message) error
@@ -48,6 +134,39 @@ type Pinger interface {
 	Close() error
 }
 
+// Pinner is the Forwarder which can create a dedicated connection to the
+// node of key, the client will be pinned to it such as pubsub.
+type Pinner interface {
+	Pin(key []byte) (*libnet.Conn, error)
+}
+
+// Router is the Forwarder which tells the target of key, the keys of the
+// same target are always served by the same node.
+type Router interface {
+	Route(key []byte) string
+}
+
+// NodeStat is the health and pool stats of a backend node.
+type NodeStat struct {
+	Addr  string
+	Alias string
+	Role  string
+	// Up is false if the node is ejected by ping.
+	Up                  bool
+	Conns, Busy, Queued int32
+	// Breaker is the state of circuit breaker, empty if disabled.
+	Breaker string
+	// ReadTimeout is the adaptive read timeout, zero if not adaptive.
+	ReadTimeout time.Duration
+	// Latency is the moving average latency of node.
+	Latency time.Duration
+}
+
+// NodeStater is the Forwarder which reports the stats of its nodes.
+type NodeStater interface {
+	NodeStats() []*NodeStat
+}
+
 // Forwarder is the interface for backend run and process the messages.
 type Forwarder interface {
 	Forward([]*Message) error
@@ -0,0 +1,276 @@
+package proto
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WorkerPool is a fixed number of workers shared by the node pipes created
+// by it. Unlike the pipe owning one goroutine per conn, the conns of these
+// pipes are idle in the free list of pipe, any worker takes the pipe with
+// ready slots and sends them by a free conn, so the number of goroutines is
+// bounded by the workers rather than the conns of all the nodes.
+//
+// NOTE: the reads are blocking as the pipe owning conns, the worker is taken
+// until the replies are read, so the slow node takes at most its max conns
+// workers and the round trips of all nodes are bounded by the workers.
+type WorkerPool struct {
+	workers     int
+	idleTimeout time.Duration
+
+	lock  sync.Mutex
+	queue []*NodeConnPipe
+	pipes map[*NodeConnPipe]struct{}
+	wake  chan struct{}
+	done  chan struct{}
+	once  sync.Once
+}
+
+// idleConn is the free conn and the time it's put back.
+type idleConn struct {
+	nc    NodeConn
+	since time.Time
+}
+
+// NewWorkerPool new a WorkerPool with workers. The conns more than the min
+// conns of pipe are closed after idle for idleTimeout, never closed if zero.
+func NewWorkerPool(workers int, idleTimeout time.Duration) *WorkerPool {
+	if workers <= 0 {
+		panic("the number of workers cannot be zero")
+	}
+	wp := &WorkerPool{
+		workers:     workers,
+		idleTimeout: idleTimeout,
+		pipes:       make(map[*NodeConnPipe]struct{}),
+		wake:        make(chan struct{}, workers),
+		done:        make(chan struct{}),
+	}
+	for i := 0; i < workers; i++ {
+		go wp.run()
+	}
+	if idleTimeout > 0 {
+		go wp.reap()
+	}
+	return wp
+}
+
+// NewNodeConnPipe new NodeConnPipe served by the workers, the conns are
+// opened on demand up to maxConns and at least minConns are kept once
+// opened. The messages more than waitQueue are failed,
+// pipeMaxCount*pipeMaxCount*16 per max conn if zero.
+func (wp *WorkerPool) NewNodeConnPipe(minConns, maxConns int32, pipeMaxCount, waitQueue int, newNc func() NodeConn) (ncp *NodeConnPipe) {
+	if maxConns <= 0 {
+		panic("the number of connections cannot be zero")
+	}
+	if minConns > maxConns {
+		minConns = maxConns
+	}
+	if waitQueue <= 0 {
+		waitQueue = pipeMaxCount * pipeMaxCount * 16 * int(maxConns)
+	}
+	ncp = &NodeConnPipe{
+		minConns:     minConns,
+		maxConns:     maxConns,
+		waitQueue:    int32(waitQueue),
+		idleTimeout:  wp.idleTimeout,
+		newNc:        newNc,
+		slots:        make([]*pipeSlot, maxConns*slotsPerConn),
+		done:         make(chan struct{}),
+		errCh:        make(chan error, 1),
+		pipeMaxCount: pipeMaxCount,
+		pool:         wp,
+		free:         make(chan *idleConn, maxConns),
+	}
+	for i := range ncp.slots {
+		ncp.slots[i] = &pipeSlot{}
+	}
+	ncp.ready = make(chan *pipeSlot, len(ncp.slots))
+	wp.lock.Lock()
+	wp.pipes[ncp] = struct{}{}
+	wp.lock.Unlock()
+	return
+}
+
+// Close stops the workers, the pipes must be closed by themselves.
+func (wp *WorkerPool) Close() {
+	wp.once.Do(func() {
+		close(wp.done)
+	})
+}
+
+// schedule queues ncp which has ready slots.
+func (wp *WorkerPool) schedule(ncp *NodeConnPipe) {
+	wp.lock.Lock()
+	wp.queue = append(wp.queue, ncp)
+	wp.lock.Unlock()
+	select {
+	case wp.wake <- struct{}{}:
+	default:
+		// NOTE: all the workers are going to check queue
+	}
+}
+
+// remove forgets the closed pipe ncp.
+func (wp *WorkerPool) remove(ncp *NodeConnPipe) {
+	wp.lock.Lock()
+	delete(wp.pipes, ncp)
+	wp.lock.Unlock()
+}
+
+func (wp *WorkerPool) next() (ncp *NodeConnPipe) {
+	wp.lock.Lock()
+	if len(wp.queue) > 0 {
+		ncp = wp.queue[0]
+		wp.queue[0] = nil
+		wp.queue = wp.queue[1:]
+	}
+	wp.lock.Unlock()
+	return
+}
+
+func (wp *WorkerPool) run() {
+	var (
+		batch []*Message
+		owned []*pipeSlot
+	)
+	for {
+		if ncp := wp.next(); ncp != nil {
+			batch, owned = ncp.serve(batch, owned)
+			continue
+		}
+		select {
+		case <-wp.wake:
+		case <-wp.done:
+			return
+		}
+	}
+}
+
+// reap closes the free conns idle for idleTimeout periodically.
+func (wp *WorkerPool) reap() {
+	ticker := time.NewTicker(wp.idleTimeout / 2)
+	defer ticker.Stop()
+	var pipes []*NodeConnPipe
+	for {
+		select {
+		case now := <-ticker.C:
+			wp.lock.Lock()
+			for ncp := range wp.pipes {
+				pipes = append(pipes, ncp)
+			}
+			wp.lock.Unlock()
+			for i, ncp := range pipes {
+				ncp.reap(now)
+				pipes[i] = nil
+			}
+			pipes = pipes[:0]
+		case <-wp.done:
+			return
+		}
+	}
+}
+
+// serve sends the ready slots by a free conn, the slots are left to the
+// busy conns if no conn is free.
+func (ncp *NodeConnPipe) serve(batch []*Message, owned []*pipeSlot) ([]*Message, []*pipeSlot) {
+	if ncp.isClosed() {
+		return batch, owned
+	}
+	var ic *idleConn
+	select {
+	case ic = <-ncp.free:
+	default:
+		if !ncp.open() {
+			return batch, owned
+		}
+		ic = &idleConn{nc: ncp.newNc(), since: time.Now()}
+	}
+	var s *pipeSlot
+	select {
+	case s = <-ncp.ready:
+	default:
+		ncp.put(ic)
+		return batch, owned
+	}
+	if batch == nil {
+		batch = make([]*Message, 0, ncp.pipeMaxCount)
+	}
+	ic.nc, batch, owned = ncp.send(ic.nc, s, batch, owned)
+	ncp.stat(ic.nc)
+	ic.since = time.Now()
+	ncp.put(ic)
+	if len(ncp.ready) > 0 {
+		ncp.pool.schedule(ncp)
+	}
+	return batch, owned
+}
+
+// open returns true if one more conn could be opened.
+func (ncp *NodeConnPipe) open() bool {
+	for {
+		conns := atomic.LoadInt32(&ncp.conns)
+		if conns >= ncp.maxConns {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&ncp.conns, conns, conns+1) {
+			return true
+		}
+	}
+}
+
+// put puts ic back into free list, or closes it if pipe is closed.
+func (ncp *NodeConnPipe) put(ic *idleConn) {
+	ncp.l.RLock()
+	if ncp.state == opened {
+		// NOTE: never blocked because at most maxConns are opened
+		ncp.free <- ic
+		ncp.l.RUnlock()
+		return
+	}
+	ncp.l.RUnlock()
+	atomic.AddInt32(&ncp.conns, -1)
+	ic.nc.Close()
+}
+
+// reap closes the free conns idle for idleTimeout until minConns left.
+func (ncp *NodeConnPipe) reap(now time.Time) {
+	for n := len(ncp.free); n > 0; n-- {
+		var ic *idleConn
+		select {
+		case ic = <-ncp.free:
+		default:
+			return
+		}
+		if now.Sub(ic.since) < ncp.idleTimeout || !ncp.shrink() {
+			ncp.put(ic)
+			continue
+		}
+		ic.nc.Close()
+		ncp.stat(ic.nc)
+	}
+	// NOTE: the workers may skip ncp while its free conns are taken here
+	if len(ncp.ready) > 0 {
+		ncp.pool.schedule(ncp)
+	}
+}
+
+func (ncp *NodeConnPipe) isClosed() bool {
+	ncp.l.RLock()
+	closed := ncp.state != opened
+	ncp.l.RUnlock()
+	return closed
+}
+
+// closeFree closes the free conns after pipe closed.
+func (ncp *NodeConnPipe) closeFree() {
+	for {
+		select {
+		case ic := <-ncp.free:
+			atomic.AddInt32(&ncp.conns, -1)
+			ic.nc.Close()
+		default:
+			return
+		}
+	}
+}
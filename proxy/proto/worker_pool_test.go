@@ -0,0 +1,122 @@
+package proto
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkerPool(t *testing.T) {
+	wp := NewWorkerPool(2, 0)
+	defer wp.Close()
+	var (
+		release = make(chan struct{})
+		lock    = &sync.Mutex{}
+		order   []string
+		slowNc  = &slowNodeConn{release: release, lock: lock, order: &order}
+		fastNc  = &slowNodeConn{release: release, lock: lock, order: &order}
+	)
+	slow := wp.NewNodeConnPipe(0, 1, 32, 0, func() NodeConn { return slowNc })
+	fast := wp.NewNodeConnPipe(0, 1, 32, 0, func() NodeConn { return fastNc })
+	conns, _, _ := slow.Stats()
+	assert.Equal(t, int32(0), conns)
+
+	_, swg := pushKey(slow, "slow")
+	time.Sleep(10 * time.Millisecond)
+	_, same := pushKey(slow, "a")
+	// NOTE: the other node is served by another worker
+	var fwgs []*sync.WaitGroup
+	for _, key := range []string{"b", "c", "d"} {
+		_, wg := pushKey(fast, key)
+		fwgs = append(fwgs, wg)
+	}
+	for _, wg := range fwgs {
+		assert.True(t, waitTimeout(wg, time.Second))
+	}
+	// NOTE: the only conn of slow node is busy
+	assert.False(t, waitTimeout(same, 50*time.Millisecond))
+	conns, busy, queued := slow.Stats()
+	assert.Equal(t, int32(1), conns)
+	assert.Equal(t, int32(1), busy)
+	assert.Equal(t, int32(1), queued)
+
+	close(release)
+	assert.True(t, waitTimeout(swg, time.Second))
+	assert.True(t, waitTimeout(same, time.Second))
+	lock.Lock()
+	assert.Equal(t, "slow", order[0])
+	assert.Equal(t, "a", order[len(order)-1])
+	lock.Unlock()
+
+	slow.Close()
+	assert.True(t, slowNc.closed)
+	closed, cwg := pushKey(slow, "e")
+	assert.True(t, waitTimeout(cwg, time.Second))
+	assert.Equal(t, errPipeClosed, closed.Err())
+	fast.Close()
+	assert.True(t, fastNc.closed)
+}
+
+func TestWorkerPoolError(t *testing.T) {
+	wp := NewWorkerPool(1, 0)
+	defer wp.Close()
+	nc := &mockNodeConn{num: 3}
+	nc.err = errPipeChanFull
+	ncp := wp.NewNodeConnPipe(0, 1, 32, 0, func() NodeConn { return nc })
+	defer ncp.Close()
+	wg := &sync.WaitGroup{}
+	var msgs []*Message
+	for i := 0; i < 10; i++ {
+		m := getMsg()
+		m.WithRequest(&keyRequest{key: "a"})
+		m.WithWaitGroup(wg)
+		ncp.Push(m)
+		msgs = append(msgs, m)
+	}
+	assert.True(t, waitTimeout(wg, time.Second))
+	var failed int
+	for _, m := range msgs {
+		if m.Err() != nil {
+			failed++
+		}
+	}
+	assert.NotZero(t, failed)
+	select {
+	case err := <-ncp.ErrorEvent():
+		assert.Equal(t, errPipeChanFull, err)
+	case <-time.After(time.Second):
+		t.Fatal("no error event")
+	}
+}
+
+func TestWorkerPoolIdle(t *testing.T) {
+	wp := NewWorkerPool(2, 50*time.Millisecond)
+	defer wp.Close()
+	var (
+		release = make(chan struct{})
+		lock    = &sync.Mutex{}
+		order   []string
+	)
+	ncp := wp.NewNodeConnPipe(1, 2, 32, 0, func() NodeConn {
+		return &slowNodeConn{release: release, lock: lock, order: &order}
+	})
+	defer ncp.Close()
+
+	_, slow := pushKey(ncp, "slow")
+	time.Sleep(10 * time.Millisecond)
+	_, fast := pushKey(ncp, "fast")
+	assert.True(t, waitTimeout(fast, time.Second))
+	conns, _, _ := ncp.Stats()
+	assert.Equal(t, int32(2), conns)
+	close(release)
+	assert.True(t, waitTimeout(slow, time.Second))
+
+	// NOTE: the conn more than min is closed after idle
+	time.Sleep(200 * time.Millisecond)
+	conns, _, _ = ncp.Stats()
+	assert.Equal(t, int32(1), conns)
+	_, again := pushKey(ncp, "again")
+	assert.True(t, waitTimeout(again, time.Second))
+}
@@ -4,20 +4,13 @@ import (
 	errs "errors"
 	"net"
 	"path/filepath"
-	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"overlord/pkg/log"
-	libnet "overlord/pkg/net"
-	"overlord/pkg/prom"
-	"overlord/pkg/types"
+	"overlord/proxy/hotkey"
 	"overlord/proxy/proto"
-	"overlord/proxy/proto/memcache"
-	mcbin "overlord/proxy/proto/memcache/binary"
-	"overlord/proxy/proto/redis"
-	rclstr "overlord/proxy/proto/redis/cluster"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/pkg/errors"
@@ -26,8 +19,11 @@ import (
 // proxy errors
 var (
 	ErrProxyMoreMaxConns = errs.New("Proxy accept more than max connextions")
+	ErrProxyMoreIPConns  = errs.New("Proxy accept more than max connextions per ip")
 	ErrProxyReloadIgnore = errs.New("Proxy reload cluster config is ignored")
 	ErrProxyReloadFail   = errs.New("Proxy reload cluster config is failed")
+	ErrProxySentinelStop = errs.New("Proxy sentinel is stopped")
+	ErrProxyClusterStop  = errs.New("Proxy cluster is stopped by reload")
 )
 
 // Proxy is proxy.
@@ -37,11 +33,30 @@ type Proxy struct {
 	ccs []*ClusterConfig
 
 	forwarders map[string]proto.Forwarder
+	sentinels  map[string]*sentinel
+	discovers  map[string]*discovery
+	listeners  map[string]net.Listener
+	sockets    map[string]net.Listener // NOTE: listeners without tls
+	shares     map[string]net.Listener
 	lock       sync.Mutex
+	reloadLock sync.Mutex
 
 	conns int32
 
-	closed bool
+	clients    map[string]*Handler
+	clientLock sync.RWMutex
+
+	start time.Time
+	stats map[string]*clusterStat
+
+	history     *configHistory
+	historyOnce sync.Once
+
+	// reweights are the reweights of nodes in progress.
+	reweights map[string]*reweighting
+
+	// closed is atomic since it's checked by the accepting goroutines.
+	closed int32
 }
 
 // New new a proxy by config.
@@ -50,7 +65,7 @@ func New(c *Config) (p *Proxy, err error) {
 		err = errors.WithStack(err)
 		return
 	}
-	p = &Proxy{}
+	p = &Proxy{start: time.Now()}
 	p.c = c
 	return
 }
@@ -63,31 +78,97 @@ func (p *Proxy) Serve(ccs []*ClusterConfig) {
 	}
 	p.lock.Lock()
 	p.forwarders = map[string]proto.Forwarder{}
+	p.sentinels = map[string]*sentinel{}
+	p.discovers = map[string]*discovery{}
+	p.listeners = map[string]net.Listener{}
+	p.sockets = map[string]net.Listener{}
 	p.lock.Unlock()
 	for _, cc := range ccs {
 		log.Infof("start to serve cluster[%s] with configs %v", cc.Name, *cc)
-		p.serve(cc)
+		if err := p.serve(cc); err != nil {
+			panic(err)
+		}
+		p.versions().record(cc, versionSourceServe)
 	}
 }
 
-func (p *Proxy) serve(cc *ClusterConfig) {
-	forwarder := NewForwarder(cc)
-	p.forwarders[cc.Name] = forwarder
+func (p *Proxy) serve(cc *ClusterConfig) (err error) {
 	// listen
 	l, err := Listen(cc.ListenProto, cc.ListenAddr)
 	if err != nil {
-		panic(err)
+		return
+	}
+	sock := l
+	if l, err = listenTLS(cc, l); err != nil {
+		_ = l.Close()
+		return
+	}
+	limiter, err := newRateLimiter(cc)
+	if err != nil {
+		_ = l.Close()
+		return
+	}
+	var s *sentinel
+	if len(cc.Sentinels) > 0 {
+		s = newSentinel(cc)
+		if _, err := s.resolve(s.names()); err != nil {
+			log.Warnf("overlord proxy cluster[%s] resolve masters by sentinels error:%v and use servers configured", cc.Name, err)
+		}
+		cc.Servers = s.rewrite(cc.Servers)
+	}
+	var d *discovery
+	if cc.Discovery != "" {
+		if d, err = newDiscovery(cc); err == nil {
+			err = d.init()
+		}
+		if err != nil {
+			_ = l.Close()
+			return
+		}
+		cc.Servers = d.rewrite(cc.Servers)
+	}
+	forwarder := NewForwarder(cc)
+	p.lock.Lock()
+	p.forwarders[cc.Name] = forwarder
+	p.listeners[cc.Name] = l
+	p.sockets[cc.Name] = sock
+	if s != nil {
+		p.sentinels[cc.Name] = s
+	}
+	if d != nil {
+		p.discovers[cc.Name] = d
+	}
+	p.lock.Unlock()
+	if s != nil {
+		go p.watchSentinel(cc, s)
+	}
+	if d != nil {
+		go p.watchDiscovery(cc, d)
 	}
 	log.Infof("overlord proxy cluster[%s] addr(%s) start listening", cc.Name, cc.ListenAddr)
 	if cc.SlowlogSlowerThan != 0 {
 		log.Infof("overlord start slowlog to [%s] with threshold [%d]us", cc.Name, cc.SlowlogSlowerThan)
 	}
-	go p.accept(cc, l, forwarder)
+	if cc.faulty() {
+		log.Warnf("overlord proxy cluster[%s] injects faults latency(%dms:%v) reset(%v) corrupt(%v), only for testing",
+			cc.Name, cc.FaultLatency, cc.FaultLatencyRate, cc.FaultResetRate, cc.FaultCorruptRate)
+	}
+	var cache *hotkey.Cache
+	if cc.HotKeyThreshold > 0 {
+		cache = hotkey.New(&hotkey.Config{
+			Threshold: cc.HotKeyThreshold,
+			TTL:       time.Duration(cc.HotKeyTTL) * time.Millisecond,
+			MaxMemory: cc.HotKeyMaxMemory,
+		})
+		log.Infof("overlord start hot key cache to [%s] with threshold [%d]/s", cc.Name, cc.HotKeyThreshold)
+	}
+	go p.accept(cc, l, forwarder, cache, limiter, newConnLimiter(cc), newAdmitter(cc), newHedger(cc), newBlocker(cc), newCommandACL(cc), newShadower(p, cc), newMirrorer(p, cc), newFallbacker(p, cc), newPrefixMetrics(cc))
+	return
 }
 
-func (p *Proxy) accept(cc *ClusterConfig, l net.Listener, forwarder proto.Forwarder) {
+func (p *Proxy) accept(cc *ClusterConfig, l net.Listener, forwarder proto.Forwarder, cache *hotkey.Cache, limiter *rateLimiter, connLimit *connLimiter, adm *admitter, hg *hedger, bl *blocker, acl *commandACL, sh, mr *shadower, fb *fallbacker, pm *prefixMetrics) {
 	for {
-		if p.closed {
+		if p.isClosed() {
 			log.Infof("overlord proxy cluster[%s] addr(%s) stop listen", cc.Name, cc.ListenAddr)
 			return
 		}
@@ -96,51 +177,66 @@ func (p *Proxy) accept(cc *ClusterConfig, l net.Listener, forwarder proto.Forwar
 			if conn != nil {
 				_ = conn.Close()
 			}
+			if !p.listening(cc.Name, l) {
+				log.Infof("overlord proxy cluster[%s] addr(%s) stop listen", cc.Name, cc.ListenAddr)
+				return
+			}
 			log.Errorf("cluster(%s) addr(%s) accept connection error:%+v", cc.Name, cc.ListenAddr, err)
 			continue
 		}
 		if p.c.Proxy.MaxConnections > 0 {
 			if conns := atomic.LoadInt32(&p.conns); conns > p.c.Proxy.MaxConnections {
-				// cache type
-				var encoder proto.ProxyConn
-				switch cc.CacheType {
-				case types.CacheTypeMemcache:
-					encoder = memcache.NewProxyConn(libnet.NewConn(conn, time.Second, time.Second))
-				case types.CacheTypeMemcacheBinary:
-					encoder = mcbin.NewProxyConn(libnet.NewConn(conn, time.Second, time.Second))
-				case types.CacheTypeRedis:
-					encoder = redis.NewProxyConn(libnet.NewConn(conn, time.Second, time.Second), true)
-				case types.CacheTypeRedisCluster:
-					encoder = rclstr.NewProxyConn(libnet.NewConn(conn, time.Second, time.Second), nil)
-				}
-				if encoder != nil {
-					_ = encoder.Encode(proto.ErrMessage(ErrProxyMoreMaxConns))
-					_ = encoder.Flush()
-				}
-				_ = conn.Close()
-				if log.V(4) {
-					log.Warnf("proxy reject connection count(%d) due to more than max(%d)", conns, p.c.Proxy.MaxConnections)
-				}
+				reject(cc, conn, ErrProxyMoreMaxConns)
 				continue
 			}
 		}
+		addr := conn.RemoteAddr().String()
+		if err = connLimit.acquire(addr); err != nil {
+			reject(cc, conn, err)
+			continue
+		}
 		atomic.AddInt32(&p.conns, 1)
-		NewHandler(p, cc, conn, forwarder).Handle()
+		h := NewHandler(p, cc, conn, forwarder)
+		h.cache = cache
+		h.limiter = limiter
+		h.connLimit = connLimit
+		h.admitter = adm
+		h.hedger = hg
+		h.blocker = bl
+		h.acl = acl
+		h.shadower = sh
+		h.mirrorer = mr
+		h.fallback = fb
+		h.prefix = pm
+		h.Handle()
 	}
 }
 
 // Close close proxy resource.
 func (p *Proxy) Close() error {
-	if p.closed {
+	if !atomic.CompareAndSwapInt32(&p.closed, 0, 1) {
 		return nil
 	}
 	for _, forwarder := range p.forwarders {
 		forwarder.Close()
 	}
-	p.closed = true
+	for _, s := range p.sentinels {
+		s.close()
+	}
+	for _, d := range p.discovers {
+		d.close()
+	}
+	p.closeReweights()
+	for _, l := range p.listeners {
+		_ = l.Close()
+	}
 	return nil
 }
 
+func (p *Proxy) isClosed() bool {
+	return atomic.LoadInt32(&p.closed) == 1
+}
+
 // MonitorConfChange reload servers.
 func (p *Proxy) MonitorConfChange(ccf string) {
 	p.ccf = ccf
@@ -162,7 +258,7 @@ func (p *Proxy) MonitorConfChange(ccf string) {
 	}
 	log.Infof("proxy is watching changes cluster config absolute path as %s", absPath)
 	for {
-		if p.closed {
+		if p.isClosed() {
 			log.Infof("proxy is closed and exit configure file:%s monitor", p.ccf)
 			return
 		}
@@ -170,21 +266,10 @@ func (p *Proxy) MonitorConfChange(ccf string) {
 		case ev := <-watch.Events:
 			if ev.Op&fsnotify.Create == fsnotify.Create || ev.Op&fsnotify.Write == fsnotify.Write || ev.Op&fsnotify.Rename == fsnotify.Rename {
 				time.Sleep(time.Second)
-				newConfs, err := LoadClusterConf(p.ccf)
-				if err != nil {
-					prom.ErrIncr(p.ccf, p.ccf, "config reload", err.Error())
-					log.Errorf("failed to load conf file:%s and got error:%v", p.ccf, err)
+				if err := p.Reload(p.ccf); err != nil {
+					log.Errorf("failed to reload conf file:%s and got error:%v", p.ccf, err)
 					continue
 				}
-				changed := parseChanged(newConfs, p.ccs)
-				for _, conf := range changed {
-					if err = p.updateConfig(conf); err == nil {
-						log.Infof("reload successful cluster:%s config succeed", conf.Name)
-					} else {
-						prom.ErrIncr(conf.Name, conf.Name, "cluster reload", err.Error())
-						log.Errorf("reload failed cluster:%s config and get error:%v", conf.Name, err)
-					}
-				}
 				log.Infof("watcher file:%s occurs event:%s and reload finish", ev.Name, ev.String())
 				continue
 			}
@@ -206,6 +291,12 @@ func (p *Proxy) updateConfig(conf *ClusterConfig) (err error) {
 		err = errors.Wrapf(ErrProxyReloadIgnore, "cluster:%s", conf.Name)
 		return
 	}
+	if s, ok := p.sentinels[conf.Name]; ok {
+		conf.Servers = s.rewrite(conf.Servers)
+	}
+	if d, ok := p.discovers[conf.Name]; ok {
+		conf.Servers = d.rewrite(conf.Servers)
+	}
 	if err = f.Update(conf.Servers); err != nil {
 		err = errors.Wrapf(ErrProxyReloadFail, "cluster:%s error:%v", conf.Name, err)
 		return
@@ -221,32 +312,6 @@ func (p *Proxy) updateConfig(conf *ClusterConfig) (err error) {
 	return
 }
 
-func parseChanged(newConfs, oldConfs []*ClusterConfig) (changed []*ClusterConfig) {
-
-	changed = make([]*ClusterConfig, 0, len(oldConfs))
-	for _, cf := range newConfs {
-		sort.Strings(cf.Servers)
-	}
-
-	for _, cf := range oldConfs {
-		sort.Strings(cf.Servers)
-	}
-
-	for _, newConf := range newConfs {
-		for _, oldConf := range oldConfs {
-			if newConf.Name != oldConf.Name {
-				continue
-			}
-
-			if !deepEqualOrderedStringSlice(newConf.Servers, oldConf.Servers) {
-				changed = append(changed, newConf)
-			}
-			break
-		}
-	}
-	return
-}
-
 func deepEqualOrderedStringSlice(a, b []string) bool {
 	if len(a) != len(b) {
 		return false
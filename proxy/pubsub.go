@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	errs "errors"
+
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/redis"
+)
+
+// errors
+var (
+	ErrPubSubNotSupport = errs.New("forwarder not support pubsub")
+)
+
+// subscribeIndex returns the index of the first SUBSCRIBE or PSUBSCRIBE in
+// msgs, or -1 if none.
+func subscribeIndex(msgs []*proto.Message) int {
+	for i, msg := range msgs {
+		if msg.IsBatch() {
+			continue
+		}
+		if req, ok := msg.Request().(*redis.Request); ok && req.IsSubscribe() {
+			return i
+		}
+	}
+	return -1
+}
+
+// subscribe pins the client to a dedicated node connection chosen by the
+// first channel of msgs[0], then serves the client commands in pubsub
+// until all the subscriptions are cancelled.
+//
+// NOTE: PUBLISH is routed by channel, so the later subscriptions should
+// share the node of the first channel by hash tag, and the patterns only
+// match the channels of the pinned node.
+func (h *Handler) subscribe(messages, msgs []*proto.Message) (err error) {
+	pinner, ok := h.forwarder.(proto.Pinner)
+	if !ok {
+		return ErrPubSubNotSupport
+	}
+	req := msgs[0].Request().(*redis.Request)
+	node, err := pinner.Pin(req.Key())
+	if err != nil {
+		return
+	}
+	// NOTE: subscribed client may be idle for a long time
+	h.conn.SetReadTimeout(0)
+	ps := redis.NewPubSub(h.conn, node)
+	for {
+		exit, serr := ps.Send(msgs)
+		for _, msg := range msgs {
+			msg.ResetSubs()
+			msg.Reset()
+		}
+		h.stat.flushed()
+		if serr != nil || exit {
+			cerr := ps.Close()
+			if serr != nil {
+				return serr
+			}
+			if cerr != nil {
+				return cerr
+			}
+			break
+		}
+		if msgs, err = h.pc.Decode(messages); err != nil {
+			_ = ps.Close()
+			return
+		}
+		h.stat.decoded(msgs)
+	}
+	h.conn.SetReadTimeout(h.readTimeout)
+	return
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	libnet "overlord/pkg/net"
+	"overlord/pkg/types"
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/redis"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlerSubscribeOutlivesReadTimeout(t *testing.T) {
+	cli, sock := net.Pipe()
+	server, node := net.Pipe()
+	defer cli.Close()
+	defer server.Close()
+	_ = cli.SetDeadline(time.Now().Add(time.Second))
+	f := &_txForwarder{node: node}
+	h := &Handler{cc: &ClusterConfig{CacheType: types.CacheTypeRedis}, forwarder: f, readTimeout: 20 * time.Millisecond}
+	h.conn = libnet.NewConn(sock, h.readTimeout, time.Second)
+	h.pc = redis.NewProxyConn(h.conn, true)
+
+	sub := "*2\r\n$9\r\nSUBSCRIBE\r\n$1\r\na\r\n"
+	unsub := "*1\r\n$11\r\nUNSUBSCRIBE\r\n"
+	go func() {
+		buf := make([]byte, len(sub))
+		_, _ = io.ReadFull(server, buf)
+		_, _ = server.Write([]byte("*3\r\n$9\r\nsubscribe\r\n$1\r\na\r\n:1\r\n"))
+		buf = make([]byte, len(unsub))
+		_, _ = io.ReadFull(server, buf)
+		_, _ = server.Write([]byte("*3\r\n$11\r\nunsubscribe\r\n$1\r\na\r\n:0\r\n"))
+	}()
+	go func() { _, _ = cli.Write([]byte(sub)) }()
+	messages := proto.GetMsgs(1)
+	msgs, err := h.pc.Decode(messages)
+	assert.NoError(t, err)
+
+	errc := make(chan error, 1)
+	go func() { errc <- h.subscribe(messages, msgs) }()
+	br := bufio.NewReader(cli)
+	readReply := func(kind string) {
+		lines := ""
+		for i := 0; i < 6; i++ {
+			line, err := br.ReadString('\n')
+			assert.NoError(t, err)
+			lines += line
+		}
+		assert.Contains(t, lines, kind)
+	}
+	readReply("subscribe")
+	// idle longer than the read timeout of client.
+	time.Sleep(100 * time.Millisecond)
+	_, err = cli.Write([]byte(unsub))
+	assert.NoError(t, err)
+	readReply("unsubscribe")
+	select {
+	case err = <-errc:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("subscribe not exit")
+	}
+	assert.Equal(t, "a", string(f.pinned))
+}
@@ -0,0 +1,30 @@
+package proxy
+
+import (
+	"sync"
+
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/redis"
+)
+
+// randomKey continues the RANDOMKEY emulated by SCAN under key_prefix until
+// one key is found or all the nodes are scanned.
+func (h *Handler) randomKey(wg *sync.WaitGroup, msgs []*proto.Message) {
+	if h.cc.KeyPrefix == "" {
+		return
+	}
+	for {
+		var next []*proto.Message
+		for _, m := range msgs {
+			if req, ok := m.Request().(*redis.Request); ok && !m.IsBatch() && m.Err() == nil && req.NextRandomKey() {
+				next = append(next, m)
+			}
+		}
+		if len(next) == 0 {
+			return
+		}
+		_ = h.forwarder.Forward(next)
+		wg.Wait()
+		msgs = next
+	}
+}
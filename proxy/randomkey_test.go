@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"overlord/pkg/mockconn"
+	libnet "overlord/pkg/net"
+	"overlord/pkg/types"
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/redis"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// _scanServer replies SCAN of cursor 0 by keys and the others by nothing,
+// every cursor finishes the node.
+func _scanServer(t *testing.T, keys ...string) (l net.Listener, addr string) {
+	reply := "*2\r\n$1\r\n0\r\n*0\r\n"
+	if len(keys) > 0 {
+		reply = "*2\r\n$1\r\n0\r\n*" + strconv.Itoa(len(keys)) + "\r\n"
+		for _, key := range keys {
+			reply += "$" + strconv.Itoa(len(key)) + "\r\n" + key + "\r\n"
+		}
+	}
+	l = _redisServer(t, func(args []string) string {
+		if len(args) > 1 && strings.EqualFold(args[0], "SCAN") {
+			if args[1] == "0" {
+				return reply
+			}
+			return "*2\r\n$1\r\n0\r\n*0\r\n"
+		}
+		return "+OK\r\n"
+	})
+	return l, l.Addr().String()
+}
+
+func _randomKeyReply(t *testing.T, servers ...string) string {
+	cc := &ClusterConfig{Name: "randomkey", CacheType: types.CacheTypeRedis, KeyPrefix: "t:", Servers: servers}
+	cc.SetDefault()
+	f := NewForwarder(cc)
+	defer f.Close()
+	h := &Handler{cc: cc, forwarder: f}
+
+	rpc := redis.NewProxyConn(libnet.NewConn(mockconn.CreateConn([]byte("RANDOMKEY\r\n"), 1), time.Second, time.Second), true)
+	rpc.(proto.KeyPrefixer).PrefixKeys([]byte(cc.KeyPrefix))
+	msgs, err := rpc.Decode(proto.GetMsgs(1))
+	assert.NoError(t, err)
+	wg := &sync.WaitGroup{}
+	msgs[0].WithWaitGroup(wg)
+	assert.NoError(t, f.Forward(msgs))
+	wg.Wait()
+	h.randomKey(wg, msgs)
+
+	mconn, buf := mockconn.CreateDownStreamConn()
+	wpc := redis.NewProxyConn(libnet.NewConn(mconn, time.Second, time.Second), true)
+	wpc.(proto.KeyPrefixer).PrefixKeys([]byte(cc.KeyPrefix))
+	assert.NoError(t, wpc.Encode(msgs[0]))
+	assert.NoError(t, wpc.Flush())
+	return buf.String()
+}
+
+func TestHandlerRandomKey(t *testing.T) {
+	la, aa := _scanServer(t)
+	defer la.Close()
+	lb, ab := _scanServer(t, "t:x")
+	defer lb.Close()
+	// NOTE: started from any node and cursor, the key of the other node is found.
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, "$1\r\nx\r\n", _randomKeyReply(t, aa+":1", ab+":1"))
+	}
+	assert.Equal(t, "$-1\r\n", _randomKeyReply(t, aa+":1"), "no key of prefix")
+}
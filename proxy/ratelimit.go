@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	errs "errors"
+	"strconv"
+	"strings"
+
+	"overlord/pkg/prom"
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/redis"
+	"overlord/proxy/ratelimit"
+
+	"github.com/pkg/errors"
+)
+
+type rateLimiter struct {
+	*ratelimit.Limiter
+	err error
+}
+
+// RateLimitRules parses ratelimit_prefixes as "{prefix} {read} {write}".
+func (cc *ClusterConfig) RateLimitRules() ([]ratelimit.Rule, error) {
+	rules := make([]ratelimit.Rule, 0, len(cc.RateLimitPrefixes))
+	for _, s := range cc.RateLimitPrefixes {
+		fs := strings.Fields(s)
+		if len(fs) != 3 {
+			return nil, errors.Wrapf(ErrClusterConfInvalid, "ratelimit_prefixes:%s", s)
+		}
+		read, rerr := strconv.Atoi(fs[1])
+		write, werr := strconv.Atoi(fs[2])
+		if rerr != nil || werr != nil || read < 0 || write < 0 {
+			return nil, errors.Wrapf(ErrClusterConfInvalid, "ratelimit_prefixes:%s", s)
+		}
+		rules = append(rules, ratelimit.Rule{Prefix: fs[0], Read: read, Write: write})
+	}
+	return rules, nil
+}
+
+func newRateLimiter(cc *ClusterConfig) (*rateLimiter, error) {
+	if cc.RateLimitRead == 0 && cc.RateLimitWrite == 0 && len(cc.RateLimitPrefixes) == 0 {
+		return nil, nil
+	}
+	rules, err := cc.RateLimitRules()
+	if err != nil {
+		return nil, err
+	}
+	return &rateLimiter{
+		Limiter: ratelimit.New(cc.RateLimitRead, cc.RateLimitWrite, rules),
+		err:     errs.New(cc.RateLimitError),
+	}, nil
+}
+
+// rateLimit replies the messages exceeded the limits with error, it returns
+// the messages which need to be forwarded.
+func (h *Handler) rateLimit(msgs []*proto.Message) []*proto.Message {
+	if h.limiter == nil {
+		return msgs
+	}
+	fwd := msgs[:0:0]
+	for _, msg := range msgs {
+		if h.allow(msg) {
+			fwd = append(fwd, msg)
+			continue
+		}
+		msg.WithError(h.limiter.err)
+		if prom.On {
+			prom.ErrIncr(h.cc.Name, h.cc.Name, msg.Request().CmdString(), "rate limited")
+		}
+	}
+	return fwd
+}
+
+func (h *Handler) allow(msg *proto.Message) bool {
+	for _, req := range msg.Requests() {
+		c, ok := req.(proto.Classifier)
+		if !ok {
+			continue
+		}
+		if write := c.IsWrite(); (write || c.IsRead()) && !h.limiter.Allow(req.Key(), write) {
+			return false
+		}
+	}
+	return true
+}
+
+// errReplied reports whether err is replied to client as a normal error and
+// the client conn keeps alive.
+func (h *Handler) errReplied(err error) bool {
+	switch err {
+	case ErrAuthRequired, ErrCommandDenied, ErrWritesPaused, redis.ErrKeyTooLong, redis.ErrValueTooLarge, redis.ErrStreamBlock:
+		return true
+	}
+	return h.limiter != nil && err == h.limiter.err
+}
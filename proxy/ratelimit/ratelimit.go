@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket which is refilled rate tokens per second and
+// holds at most rate tokens.
+type Bucket struct {
+	lock   sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket new a full token bucket.
+func NewBucket(rate int) *Bucket {
+	return &Bucket{rate: float64(rate), tokens: float64(rate)}
+}
+
+// Allow takes a token from bucket if any.
+func (b *Bucket) Allow(now time.Time) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.rate {
+			b.tokens = b.rate
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Rule is the limits per second of keys with prefix, 0 means unlimited.
+type Rule struct {
+	Prefix string
+	Read   int
+	Write  int
+}
+
+type buckets struct {
+	prefix      string
+	read, write *Bucket
+}
+
+func newBuckets(prefix string, read, write int) *buckets {
+	bs := &buckets{prefix: prefix}
+	if read > 0 {
+		bs.read = NewBucket(read)
+	}
+	if write > 0 {
+		bs.write = NewBucket(write)
+	}
+	return bs
+}
+
+func (bs *buckets) get(write bool) *Bucket {
+	if write {
+		return bs.write
+	}
+	return bs.read
+}
+
+// Limiter limits the reads and writes of a cluster, and the keys matched
+// the longest prefix of rules are limited by the rule again.
+type Limiter struct {
+	all   *buckets
+	rules []*buckets
+
+	now func() time.Time
+}
+
+// New new a limiter, read and write are limits per second of all keys and 0
+// means unlimited.
+func New(read, write int, rules []Rule) *Limiter {
+	l := &Limiter{all: newBuckets("", read, write), now: time.Now}
+	for _, r := range rules {
+		l.rules = append(l.rules, newBuckets(r.Prefix, r.Read, r.Write))
+	}
+	sort.SliceStable(l.rules, func(i, j int) bool {
+		return len(l.rules[i].prefix) > len(l.rules[j].prefix)
+	})
+	return l
+}
+
+// Allow reports whether the read or write of key is allowed now.
+//
+// NOTE: the token taken by prefix rule is not given back when the cluster
+// limit is exceeded.
+func (l *Limiter) Allow(key []byte, write bool) bool {
+	now := l.now()
+	for _, bs := range l.rules {
+		if strings.HasPrefix(string(key), bs.prefix) {
+			if b := bs.get(write); b != nil && !b.Allow(now) {
+				return false
+			}
+			break
+		}
+	}
+	if b := l.all.get(write); b != nil {
+		return b.Allow(now)
+	}
+	return true
+}
@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucketAllow(t *testing.T) {
+	now := time.Unix(100, 0)
+	b := NewBucket(2)
+	assert.True(t, b.Allow(now))
+	assert.True(t, b.Allow(now))
+	assert.False(t, b.Allow(now))
+
+	now = now.Add(500 * time.Millisecond)
+	assert.True(t, b.Allow(now))
+	assert.False(t, b.Allow(now))
+
+	now = now.Add(time.Hour)
+	assert.True(t, b.Allow(now))
+	assert.True(t, b.Allow(now))
+	assert.False(t, b.Allow(now), "burst is limited by rate")
+}
+
+func TestLimiterAllow(t *testing.T) {
+	now := time.Unix(100, 0)
+	l := New(0, 3, []Rule{
+		{Prefix: "user:", Read: 1},
+		{Prefix: "user:vip:"},
+	})
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 10; i++ {
+		assert.True(t, l.Allow([]byte("other"), false), "reads unlimited")
+	}
+	assert.True(t, l.Allow([]byte("user:1"), false))
+	assert.False(t, l.Allow([]byte("user:2"), false))
+	assert.True(t, l.Allow([]byte("user:vip:1"), false), "longest prefix matched")
+
+	assert.True(t, l.Allow([]byte("user:1"), true))
+	assert.True(t, l.Allow([]byte("a"), true))
+	assert.True(t, l.Allow([]byte("b"), true))
+	assert.False(t, l.Allow([]byte("c"), true))
+}
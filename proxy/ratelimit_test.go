@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"overlord/pkg/mockconn"
+	libnet "overlord/pkg/net"
+	"overlord/pkg/types"
+	"overlord/proxy/proto/redis"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClusterConfigRateLimitRules(t *testing.T) {
+	rules, err := (&ClusterConfig{RateLimitPrefixes: []string{"user: 100 10"}}).RateLimitRules()
+	assert.NoError(t, err)
+	assert.Len(t, rules, 1)
+	assert.Equal(t, "user:", rules[0].Prefix)
+	assert.Equal(t, 100, rules[0].Read)
+	assert.Equal(t, 10, rules[0].Write)
+
+	for _, s := range []string{"user: 100", "user: a 10", "user: 1 -1"} {
+		_, err = (&ClusterConfig{RateLimitPrefixes: []string{s}}).RateLimitRules()
+		assert.Error(t, err, s)
+	}
+}
+
+func TestHandlerRateLimitOk(t *testing.T) {
+	cc := &ClusterConfig{CacheType: types.CacheTypeRedis, RateLimitWrite: 1, RateLimitError: "ERR rate limited"}
+	limiter, err := newRateLimiter(cc)
+	assert.NoError(t, err)
+	h := &Handler{cc: cc, limiter: limiter}
+
+	msgs := _decodeRedis(t, "*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\nb\r\n")
+	assert.Len(t, h.rateLimit(msgs), 1)
+	msgs = _decodeRedis(t, "*2\r\n$3\r\nGET\r\n$1\r\na\r\n")
+	assert.Len(t, h.rateLimit(msgs), 1, "reads unlimited")
+
+	msgs = _decodeRedis(t, "*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\nb\r\n")
+	assert.Len(t, h.rateLimit(msgs), 0)
+	assert.True(t, h.errReplied(msgs[0].Err()))
+
+	mconn, buf := mockconn.CreateDownStreamConn()
+	wpc := redis.NewProxyConn(libnet.NewConn(mconn, time.Second, time.Second), true)
+	_ = wpc.Encode(msgs[0])
+	assert.NoError(t, wpc.Flush())
+	assert.Equal(t, "-ERR rate limited\r\n", buf.String())
+}
@@ -0,0 +1,178 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"sort"
+
+	"overlord/pkg/log"
+	"overlord/pkg/prom"
+
+	"github.com/pkg/errors"
+)
+
+// Reload re-parses the cluster config file ccf and applies the difference
+// in place: the clusters added are served, the clusters removed are stopped,
+// the clusters with only servers changed are updated and the others are
+// restarted. The clients of clusters not restarted are kept.
+func (p *Proxy) Reload(ccf string) (err error) {
+	newConfs, err := LoadClusterConf(ccf)
+	if err != nil {
+		prom.ErrIncr(ccf, ccf, "config reload", err.Error())
+		return errors.Wrapf(ErrProxyReloadFail, "file:%s error:%v", ccf, err)
+	}
+	return p.apply(newConfs)
+}
+
+// apply applies the difference between newConfs and the serving clusters.
+func (p *Proxy) apply(newConfs []*ClusterConfig) (err error) {
+	p.reloadLock.Lock()
+	defer p.reloadLock.Unlock()
+	return p.applyConfs(newConfs, versionSourceReload)
+}
+
+// applyConfs is apply with reloadLock held, the applied configs are
+// recorded as the versions of source.
+func (p *Proxy) applyConfs(newConfs []*ClusterConfig, source string) (err error) {
+	p.lock.Lock()
+	oldConfs := make(map[string]*ClusterConfig, len(p.ccs))
+	for _, cc := range p.ccs {
+		oldConfs[cc.Name] = cc
+	}
+	p.lock.Unlock()
+	var (
+		starts  []*ClusterConfig
+		updates []*ClusterConfig
+		stops   []*ClusterConfig
+	)
+	for _, cc := range newConfs {
+		oldConf, ok := oldConfs[cc.Name]
+		delete(oldConfs, cc.Name)
+		switch {
+		case !ok:
+			starts = append(starts, cc)
+		case !equalExceptServers(oldConf, cc):
+			stops = append(stops, oldConf)
+			starts = append(starts, cc)
+		case !equalServers(oldConf.Servers, cc.Servers):
+			updates = append(updates, cc)
+		}
+	}
+	for _, cc := range oldConfs {
+		stops = append(stops, cc)
+	}
+	// NOTE: stop first to release the listen addr for the restarted
+	for _, cc := range stops {
+		p.stop(cc)
+		log.Infof("reload stop cluster:%s addr:%s", cc.Name, cc.ListenAddr)
+	}
+	for _, cc := range updates {
+		if e := p.updateConfig(cc); e != nil {
+			prom.ErrIncr(cc.Name, cc.Name, "cluster reload", e.Error())
+			log.Errorf("reload failed cluster:%s config and get error:%v", cc.Name, e)
+			err = e
+			continue
+		}
+		log.Infof("reload successful cluster:%s config succeed", cc.Name)
+		p.lock.Lock()
+		if cur := p.clusterConfig(cc.Name); cur != nil {
+			p.versions().record(cur, source)
+		}
+		p.lock.Unlock()
+	}
+	for _, cc := range starts {
+		if e := p.serve(cc); e != nil {
+			prom.ErrIncr(cc.Name, cc.Name, "cluster reload", e.Error())
+			log.Errorf("reload failed to serve cluster:%s and get error:%v", cc.Name, e)
+			err = errors.Wrapf(ErrProxyReloadFail, "cluster:%s error:%v", cc.Name, e)
+			continue
+		}
+		p.lock.Lock()
+		p.ccs = append(p.ccs, cc)
+		p.lock.Unlock()
+		p.versions().record(cc, source)
+		log.Infof("reload serve cluster:%s addr:%s", cc.Name, cc.ListenAddr)
+	}
+	return
+}
+
+// ReloadHandler returns the http handler which reloads the cluster configs
+// by reload when POST, such as Reload of cluster config file.
+func ReloadHandler(reload func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := reload(); err != nil {
+			http.Error(w, fmt.Sprintf("%s", err), http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}
+}
+
+// stop stops the listener, sentinel, discovery and forwarder of cluster cc
+// and closes its clients.
+func (p *Proxy) stop(cc *ClusterConfig) {
+	p.lock.Lock()
+	l, f, s, d := p.listeners[cc.Name], p.forwarders[cc.Name], p.sentinels[cc.Name], p.discovers[cc.Name]
+	delete(p.listeners, cc.Name)
+	delete(p.sockets, cc.Name)
+	delete(p.forwarders, cc.Name)
+	delete(p.sentinels, cc.Name)
+	delete(p.discovers, cc.Name)
+	for i, oldConf := range p.ccs {
+		if oldConf == cc {
+			p.ccs = append(p.ccs[:i], p.ccs[i+1:]...)
+			break
+		}
+	}
+	p.lock.Unlock()
+	if l != nil {
+		_ = l.Close()
+	}
+	if s != nil {
+		s.close()
+	}
+	if d != nil {
+		d.close()
+	}
+	p.clientLock.RLock()
+	var hs []*Handler
+	for _, h := range p.clients {
+		if h.cc == cc {
+			hs = append(hs, h)
+		}
+	}
+	p.clientLock.RUnlock()
+	for _, h := range hs {
+		h.closeWithError(errors.WithStack(ErrProxyClusterStop))
+	}
+	if f != nil {
+		_ = f.Close()
+	}
+}
+
+// listening returns true if l is still the listener of cluster name.
+func (p *Proxy) listening(name string, l net.Listener) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.listeners[name] == l
+}
+
+func equalExceptServers(a, b *ClusterConfig) bool {
+	ac, bc := *a, *b
+	ac.Servers, bc.Servers = nil, nil
+	return reflect.DeepEqual(ac, bc)
+}
+
+func equalServers(a, b []string) bool {
+	as := append([]string(nil), a...)
+	bs := append([]string(nil), b...)
+	sort.Strings(as)
+	sort.Strings(bs)
+	return deepEqualOrderedStringSlice(as, bs)
+}
@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"overlord/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func _freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func _clusters(clusters ...[3]string) (ccs []*ClusterConfig) {
+	for _, c := range clusters {
+		cc := &ClusterConfig{
+			Name:            c[0],
+			CacheType:       types.CacheTypeMemcache,
+			ListenProto:     "tcp",
+			ListenAddr:      c[1],
+			DialTimeout:     100,
+			ReadTimeout:     100,
+			WriteTimeout:    100,
+			NodeConnections: 1,
+			Servers:         []string{c[2]},
+		}
+		cc.SetDefault()
+		ccs = append(ccs, cc)
+	}
+	return
+}
+
+func _clusterClients(p *Proxy, name string) int {
+	time.Sleep(50 * time.Millisecond)
+	return len(p.Clients(name, ""))
+}
+
+func TestProxyReloadApply(t *testing.T) {
+	addrA, addrB, addrC := _freeAddr(t), _freeAddr(t), _freeAddr(t)
+	p, err := New(DefaultConfig())
+	assert.NoError(t, err)
+	defer p.Close()
+	p.Serve(_clusters([3]string{"a", addrA, "127.0.0.1:1:1"}, [3]string{"b", addrB, "127.0.0.1:1:1"}))
+
+	connA, err := net.Dial("tcp", addrA)
+	assert.NoError(t, err)
+	defer connA.Close()
+	assert.Equal(t, 1, _clusterClients(p, "a"))
+
+	// NOTE: a updates servers in place, b is removed and c is added
+	assert.NoError(t, p.apply(_clusters([3]string{"a", addrA, "127.0.0.1:2:1"}, [3]string{"c", addrC, "127.0.0.1:1:1"})))
+	assert.Equal(t, 1, _clusterClients(p, "a"))
+	p.lock.Lock()
+	assert.Len(t, p.ccs, 2)
+	assert.Equal(t, []string{"127.0.0.1:2:1"}, p.ccs[0].Servers)
+	assert.NotNil(t, p.forwarders["a"])
+	assert.NotNil(t, p.forwarders["c"])
+	assert.Nil(t, p.forwarders["b"])
+	p.lock.Unlock()
+	_, err = net.Dial("tcp", addrB)
+	assert.Error(t, err)
+	connC, err := net.Dial("tcp", addrC)
+	assert.NoError(t, err)
+	connC.Close()
+
+	// NOTE: a is restarted and its clients are closed
+	addrA2 := _freeAddr(t)
+	assert.NoError(t, p.apply(_clusters([3]string{"a", addrA2, "127.0.0.1:2:1"}, [3]string{"c", addrC, "127.0.0.1:1:1"})))
+	assert.Equal(t, 0, _clusterClients(p, "a"))
+	connA2, err := net.Dial("tcp", addrA2)
+	assert.NoError(t, err)
+	connA2.Close()
+
+	assert.Error(t, p.apply(_clusters([3]string{"a", addrA2, "127.0.0.1:2:1"}, [3]string{"d", "bad", "127.0.0.1:2:1"})))
+}
+
+func TestProxyReloadHandler(t *testing.T) {
+	p := &Proxy{}
+	w := httptest.NewRecorder()
+	ReloadHandler(func() error { return p.Reload("") })(w, httptest.NewRequest(http.MethodGet, "/reload", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	w = httptest.NewRecorder()
+	ReloadHandler(func() error { return p.Reload("/not/exist.toml") })(w, httptest.NewRequest(http.MethodPost, "/reload", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
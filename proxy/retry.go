@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	libnet "overlord/pkg/net"
+	"overlord/pkg/prom"
+	"overlord/proxy/proto"
+
+	"github.com/pkg/errors"
+)
+
+// retry re-forwards the reads failed by transient backend errors up to
+// retry_times, the backoff starts from retry_backoff and doubles each time.
+// The reads are hashed again, so they are retried on the next node if the
+// failed node is ejected.
+func (h *Handler) retry(wg *sync.WaitGroup, msgs []*proto.Message) {
+	if h.cc.RetryTimes <= 0 {
+		return
+	}
+	backoff := time.Duration(h.cc.RetryBackoff) * time.Millisecond
+	for i := 0; i < h.cc.RetryTimes; i++ {
+		var retries []*proto.Message
+		for _, m := range msgs {
+			if !retryable(m) {
+				continue
+			}
+			if prom.On {
+				prom.RetryIncr(h.cc.Name, m.Addr())
+			}
+			m.WithError(nil)
+			retries = append(retries, m)
+		}
+		if len(retries) == 0 {
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+		_ = h.forwarder.Forward(retries)
+		wg.Wait()
+		msgs = retries
+	}
+}
+
+// retryable returns true if m is a read failed by transient backend error,
+// the batch is never retried because its subs are merged by node.
+func retryable(m *proto.Message) bool {
+	if m.IsBatch() || m.Err() == nil {
+		return false
+	}
+	if c, ok := m.Request().(proto.Classifier); !ok || !c.IsRead() {
+		return false
+	}
+	return isTransient(m.Err())
+}
+
+// isTransient returns true if err is timeout, reset or dial failure.
+func isTransient(err error) bool {
+	switch cause := errors.Cause(err); cause {
+	case io.EOF, io.ErrUnexpectedEOF, libnet.ErrConnClosed:
+		return true
+	default:
+		_, ok := cause.(net.Error)
+		return ok
+	}
+}
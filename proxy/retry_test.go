@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"io"
+	"sync"
+	"testing"
+
+	libnet "overlord/pkg/net"
+	"overlord/pkg/types"
+	"overlord/proxy/proto"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// _failForwarder fails the messages with err for fails times.
+type _failForwarder struct {
+	proto.Forwarder
+	err      error
+	fails    int
+	forwards int
+}
+
+func (f *_failForwarder) Forward(msgs []*proto.Message) error {
+	f.forwards++
+	for _, m := range msgs {
+		m.Add()
+		if f.forwards <= f.fails {
+			m.WithError(f.err)
+		}
+		m.Done()
+	}
+	return nil
+}
+
+func _retryHandler(fwd proto.Forwarder) *Handler {
+	cc := &ClusterConfig{CacheType: types.CacheTypeRedis, RetryTimes: 2, RetryBackoff: 1}
+	return &Handler{cc: cc, forwarder: fwd}
+}
+
+func _retryMsgs(t *testing.T, cmd string) ([]*proto.Message, *sync.WaitGroup) {
+	wg := &sync.WaitGroup{}
+	msgs := _decodeRedis(t, cmd)
+	for _, m := range msgs {
+		m.WithWaitGroup(wg)
+	}
+	return msgs, wg
+}
+
+func TestHandlerRetryRead(t *testing.T) {
+	fwd := &_failForwarder{err: errors.WithStack(io.EOF), fails: 2}
+	h := _retryHandler(fwd)
+	msgs, wg := _retryMsgs(t, "*2\r\n$3\r\nGET\r\n$1\r\na\r\n")
+	_ = fwd.Forward(msgs)
+	h.retry(wg, msgs)
+	assert.Equal(t, 3, fwd.forwards)
+	assert.NoError(t, msgs[0].Err())
+
+	// NOTE: the error is kept after retry_times
+	fwd = &_failForwarder{err: errors.WithStack(libnet.ErrConnClosed), fails: 3}
+	h = _retryHandler(fwd)
+	msgs, wg = _retryMsgs(t, "*2\r\n$3\r\nGET\r\n$1\r\na\r\n")
+	_ = fwd.Forward(msgs)
+	h.retry(wg, msgs)
+	assert.Equal(t, 3, fwd.forwards)
+	assert.Equal(t, libnet.ErrConnClosed, errors.Cause(msgs[0].Err()))
+}
+
+func TestHandlerRetryIgnore(t *testing.T) {
+	for _, c := range []struct {
+		cmd string
+		err error
+	}{
+		{"*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\nb\r\n", io.EOF},
+		{"*3\r\n$4\r\nMGET\r\n$1\r\na\r\n$1\r\nb\r\n", io.EOF},
+		{"*2\r\n$3\r\nGET\r\n$1\r\na\r\n", ErrForwarderHashNoNode},
+	} {
+		fwd := &_failForwarder{err: c.err, fails: 1}
+		h := _retryHandler(fwd)
+		msgs, wg := _retryMsgs(t, c.cmd)
+		_ = fwd.Forward(msgs)
+		h.retry(wg, msgs)
+		assert.Equal(t, 1, fwd.forwards, c.cmd)
+	}
+}
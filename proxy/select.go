@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"strconv"
+
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/redis"
+)
+
+var (
+	selectInvalidBytes    = []byte("ERR invalid DB index")
+	selectOutOfRangeBytes = []byte("ERR DB index is out of range")
+	selectWrongArgsBytes  = []byte("ERR wrong number of arguments for 'select' command")
+)
+
+// replySelect answers SELECT of redis clients. The backend connections
+// are shared by all the clients and pinned to the db of cluster config,
+// so only that db can be selected.
+func (h *Handler) replySelect(msg *proto.Message) {
+	if msg.IsBatch() {
+		return
+	}
+	req, ok := msg.Request().(*redis.Request)
+	if !ok || !req.IsSelect() {
+		return
+	}
+	args := req.RESP().Array()
+	if len(args) != 2 {
+		req.Reply().SetError(selectWrongArgsBytes)
+		return
+	}
+	db, err := strconv.Atoi(string(bulkData(args[1].Data())))
+	if err != nil {
+		req.Reply().SetError(selectInvalidBytes)
+		return
+	}
+	if db != h.cc.DB {
+		req.Reply().SetError(selectOutOfRangeBytes)
+		return
+	}
+	req.Reply().SetString(okBytes)
+}
@@ -0,0 +1,29 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"overlord/pkg/mockconn"
+	libnet "overlord/pkg/net"
+	"overlord/pkg/types"
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/redis"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlerReplySelect(t *testing.T) {
+	h := &Handler{cc: &ClusterConfig{CacheType: types.CacheTypeRedis, DB: 3}}
+	mconn, buf := mockconn.CreateDownStreamConn()
+	wpc := redis.NewProxyConn(libnet.NewConn(mconn, time.Second, time.Second), true)
+	for _, cmd := range []string{"select 3", "select 0", "select x", "select"} {
+		rpc := redis.NewProxyConn(libnet.NewConn(mockconn.CreateConn([]byte(cmd+"\r\n"), 1), time.Second, time.Second), true)
+		msgs, err := rpc.Decode(proto.GetMsgs(1))
+		assert.NoError(t, err)
+		h.replySelect(msgs[0])
+		assert.NoError(t, wpc.Encode(msgs[0]))
+	}
+	assert.NoError(t, wpc.Flush())
+	assert.Equal(t, "+OK\r\n-ERR DB index is out of range\r\n-ERR invalid DB index\r\n-ERR wrong number of arguments for 'select' command\r\n", buf.String())
+}
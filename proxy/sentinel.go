@@ -0,0 +1,228 @@
+package proxy
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"overlord/pkg/log"
+	libnet "overlord/pkg/net"
+	"overlord/pkg/types"
+	"overlord/proxy/proto/redis"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	sentinelMinInterval = time.Second
+	sentinelMaxInterval = 30 * time.Second
+)
+
+// validateSentinels checks the servers are named by master names if the
+// sentinels are set.
+func (cc *ClusterConfig) validateSentinels() error {
+	if len(cc.Sentinels) == 0 {
+		return nil
+	}
+	if cc.CacheType != types.CacheTypeRedis {
+		return errors.Wrapf(ErrClusterConfInvalid, "sentinels only support by %s", types.CacheTypeRedis)
+	}
+	for _, saddr := range cc.Sentinels {
+		if _, _, err := net.SplitHostPort(saddr); err != nil {
+			return errors.Wrapf(ErrClusterConfInvalid, "sentinel:%s", saddr)
+		}
+	}
+	for _, svr := range cc.Servers {
+		if len(strings.Split(svr, " ")) != 2 {
+			return errors.Wrapf(ErrClusterConfInvalid, "server:%s must be aliased by master name with sentinels", svr)
+		}
+	}
+	return nil
+}
+
+// sentinel follows the masters of standalone redis by redis sentinels, the
+// alias of servers is the master name monitored by sentinels.
+type sentinel struct {
+	cc *ClusterConfig
+
+	lock    sync.Mutex
+	masters map[string]string
+	conn    *redis.Sentinel
+	closed  bool
+}
+
+func newSentinel(cc *ClusterConfig) *sentinel {
+	return &sentinel{cc: cc, masters: make(map[string]string)}
+}
+
+// names returns the master names of servers.
+func (s *sentinel) names() (names []string) {
+	for _, svr := range s.cc.Servers {
+		if ss := strings.Split(svr, " "); len(ss) == 2 {
+			names = append(names, ss[1])
+		}
+	}
+	return
+}
+
+// resolve queries the masters from the first available sentinel and returns
+// true if any master is changed.
+func (s *sentinel) resolve(names []string) (changed bool, err error) {
+	dto := time.Duration(s.cc.DialTimeout) * time.Millisecond
+	rto := time.Duration(s.cc.ReadTimeout) * time.Millisecond
+	wto := time.Duration(s.cc.WriteTimeout) * time.Millisecond
+	for _, saddr := range s.cc.Sentinels {
+		conn := redis.NewSentinel(libnet.DialWithTimeout(saddr, dto, rto, wto))
+		masters := make(map[string]string, len(names))
+		for _, name := range names {
+			var addr string
+			if addr, err = conn.MasterAddr(name); err != nil {
+				break
+			}
+			masters[name] = addr
+		}
+		_ = conn.Close()
+		if err != nil {
+			log.Warnf("cluster(%s) resolve masters from sentinel(%s) error:%v", s.cc.Name, saddr, err)
+			continue
+		}
+		for name, addr := range masters {
+			changed = s.setMaster(name, addr) || changed
+		}
+		return
+	}
+	return
+}
+
+// setMaster records the addr of master name and returns true if changed.
+func (s *sentinel) setMaster(name, addr string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.masters[name] == addr {
+		return false
+	}
+	s.masters[name] = addr
+	return true
+}
+
+// rewrite replaces the address of servers by the masters known and keeps
+// the weight and alias.
+func (s *sentinel) rewrite(servers []string) []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	rewrited := make([]string, 0, len(servers))
+	for _, svr := range servers {
+		ss := strings.Split(svr, " ")
+		if len(ss) != 2 {
+			rewrited = append(rewrited, svr)
+			continue
+		}
+		addr, ok := s.masters[ss[1]]
+		idx := strings.LastIndexByte(ss[0], ':')
+		if !ok || idx < 0 {
+			rewrited = append(rewrited, svr)
+			continue
+		}
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			rewrited = append(rewrited, svr)
+			continue
+		}
+		rewrited = append(rewrited, host+":"+port+ss[0][idx:]+" "+ss[1])
+	}
+	return rewrited
+}
+
+// subscribe subscribes the +switch-master events of sentinel saddr.
+func (s *sentinel) subscribe(saddr string) (conn *redis.Sentinel, err error) {
+	dto := time.Duration(s.cc.DialTimeout) * time.Millisecond
+	wto := time.Duration(s.cc.WriteTimeout) * time.Millisecond
+	nc := libnet.DialWithTimeout(saddr, dto, time.Duration(s.cc.ReadTimeout)*time.Millisecond, wto)
+	conn = redis.NewSentinel(nc)
+	if err = conn.Subscribe(); err != nil {
+		_ = conn.Close()
+		return
+	}
+	// NOTE: events are pushed at any time after subscribed
+	nc.SetReadTimeout(0)
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		_ = conn.Close()
+		return nil, errors.WithStack(ErrProxySentinelStop)
+	}
+	s.conn = conn
+	s.lock.Unlock()
+	return
+}
+
+func (s *sentinel) isClosed() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.closed
+}
+
+// close stops following the sentinels, the conn subscribed is closed by the
+// watching goroutine once interrupted.
+func (s *sentinel) close() {
+	s.lock.Lock()
+	s.closed = true
+	if s.conn != nil {
+		s.conn.Interrupt()
+	}
+	s.lock.Unlock()
+}
+
+// watchSentinel follows the master switches of cluster cc and rewires the
+// servers of forwarder until the proxy is closed.
+func (p *Proxy) watchSentinel(cc *ClusterConfig, s *sentinel) {
+	interval := sentinelMinInterval
+	for i := 0; ; i++ {
+		if s.isClosed() {
+			return
+		}
+		saddr := cc.Sentinels[i%len(cc.Sentinels)]
+		conn, err := s.subscribe(saddr)
+		if err == nil {
+			interval = sentinelMinInterval
+			// NOTE: masters may be switched before subscribed
+			p.lock.Lock()
+			names := s.names()
+			p.lock.Unlock()
+			var changed bool
+			if changed, err = s.resolve(names); err == nil && changed {
+				p.switchMaster(cc)
+			}
+			for {
+				var name, addr string
+				if name, addr, err = conn.SwitchMaster(); err != nil {
+					break
+				}
+				log.Infof("cluster(%s) sentinel(%s) switch master:%s to addr:%s", cc.Name, saddr, name, addr)
+				if s.setMaster(name, addr) {
+					p.switchMaster(cc)
+				}
+			}
+			_ = conn.Close()
+		}
+		if s.isClosed() {
+			return
+		}
+		log.Errorf("cluster(%s) watch sentinel(%s) error:%v and retry after %v", cc.Name, saddr, err, interval)
+		time.Sleep(interval)
+		if interval *= 2; interval > sentinelMaxInterval {
+			interval = sentinelMaxInterval
+		}
+	}
+}
+
+// switchMaster updates the servers of cluster cc by the masters known.
+func (p *Proxy) switchMaster(cc *ClusterConfig) {
+	p.lock.Lock()
+	servers := cc.Servers
+	p.lock.Unlock()
+	if err := p.updateConfig(&ClusterConfig{Name: cc.Name, Servers: servers}); err != nil {
+		log.Errorf("cluster(%s) switch master error:%v", cc.Name, err)
+	}
+}
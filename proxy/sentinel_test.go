@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"overlord/pkg/types"
+	"overlord/proxy/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type _updateForwarder struct {
+	servers chan []string
+}
+
+func (f *_updateForwarder) Forward([]*proto.Message) error { return nil }
+func (f *_updateForwarder) Close() error                   { return nil }
+func (f *_updateForwarder) Update(servers []string) error {
+	f.servers <- servers
+	return nil
+}
+
+// _sentinelServer replies the master addr and pushes a switch-master event
+// after subscribed.
+func _sentinelServer(t *testing.T, master, switched string) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				for {
+					line, err := br.ReadString('\n')
+					if err != nil {
+						return
+					}
+					switch {
+					case strings.HasPrefix(line, "get-master-addr-by-name"):
+						host, port, _ := net.SplitHostPort(master)
+						conn.Write([]byte("*2\r\n$" + strconv.Itoa(len(host)) + "\r\n" + host + "\r\n$" + strconv.Itoa(len(port)) + "\r\n" + port + "\r\n"))
+					case strings.HasPrefix(line, "+switch-master"):
+						conn.Write([]byte("*3\r\n$9\r\nsubscribe\r\n$14\r\n+switch-master\r\n:1\r\n"))
+						time.Sleep(100 * time.Millisecond)
+						msg := "mymaster " + strings.Replace(master, ":", " ", 1) + " " + strings.Replace(switched, ":", " ", 1)
+						conn.Write([]byte("*3\r\n$7\r\nmessage\r\n$14\r\n+switch-master\r\n$" + strconv.Itoa(len(msg)) + "\r\n" + msg + "\r\n"))
+					}
+				}
+			}(conn)
+		}
+	}()
+	return l
+}
+
+func TestValidateSentinels(t *testing.T) {
+	cc := &ClusterConfig{CacheType: types.CacheTypeRedis, Sentinels: []string{"127.0.0.1:26379"}, Servers: []string{"127.0.0.1:6379:1 mymaster"}}
+	assert.NoError(t, cc.validateSentinels())
+	cc.Servers = []string{"127.0.0.1:6379:1"}
+	assert.Error(t, cc.validateSentinels())
+	cc.Servers = []string{"127.0.0.1:6379:1 mymaster"}
+	cc.Sentinels = []string{"127.0.0.1"}
+	assert.Error(t, cc.validateSentinels())
+	cc.Sentinels = []string{"127.0.0.1:26379"}
+	cc.CacheType = types.CacheTypeMemcache
+	assert.Error(t, cc.validateSentinels())
+}
+
+func TestSentinelRewrite(t *testing.T) {
+	s := newSentinel(&ClusterConfig{})
+	assert.True(t, s.setMaster("a", "127.0.0.2:6380"))
+	assert.False(t, s.setMaster("a", "127.0.0.2:6380"))
+	servers := s.rewrite([]string{"127.0.0.1:6379:2 a", "127.0.0.1:6381:1 b"})
+	assert.Equal(t, []string{"127.0.0.2:6380:2 a", "127.0.0.1:6381:1 b"}, servers)
+}
+
+func TestWatchSentinelSwitchMaster(t *testing.T) {
+	l := _sentinelServer(t, "127.0.0.1:6379", "127.0.0.1:6380")
+	defer l.Close()
+	cc := &ClusterConfig{
+		Name:         "sentinel",
+		CacheType:    types.CacheTypeRedis,
+		DialTimeout:  1000,
+		ReadTimeout:  1000,
+		WriteTimeout: 1000,
+		Sentinels:    []string{l.Addr().String()},
+		Servers:      []string{"127.0.0.2:6379:1 mymaster"},
+	}
+	s := newSentinel(cc)
+	changed, err := s.resolve(s.names())
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	cc.Servers = s.rewrite(cc.Servers)
+	assert.Equal(t, []string{"127.0.0.1:6379:1 mymaster"}, cc.Servers)
+
+	f := &_updateForwarder{servers: make(chan []string, 1)}
+	p := &Proxy{ccs: []*ClusterConfig{cc}, forwarders: map[string]proto.Forwarder{cc.Name: f}, sentinels: map[string]*sentinel{cc.Name: s}}
+	done := make(chan struct{})
+	go func() {
+		p.watchSentinel(cc, s)
+		close(done)
+	}()
+	select {
+	case servers := <-f.servers:
+		assert.Equal(t, []string{"127.0.0.1:6380:1 mymaster"}, servers)
+	case <-time.After(3 * time.Second):
+		t.Fatal("switch master timeout")
+	}
+	// the watching is stopped by close.
+	s.close()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("watch sentinel not stopped")
+	}
+}
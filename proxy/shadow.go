@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	"overlord/pkg/prom"
+	"overlord/proxy/proto"
+)
+
+// shadower mirrors the writes of a cluster into its shadow cluster, which
+// is forwarded by the pool of the shadow cluster without waiting. The
+// failed and dropped writes are only counted. It's also the mirrorer which
+// mirrors the sampled reads and writes into a staging cluster.
+type shadower struct {
+	p       *Proxy
+	kind    string
+	cluster string
+	shadow  string
+	max     int32
+	pending int32
+	// percent is the percentage of messages mirrored.
+	percent       int
+	reads, writes bool
+
+	mirrored, failed, dropped int64
+}
+
+func newShadower(p *Proxy, cc *ClusterConfig) *shadower {
+	if cc.ShadowCluster == "" {
+		return nil
+	}
+	return &shadower{
+		p:       p,
+		kind:    "shadow",
+		cluster: cc.Name,
+		shadow:  cc.ShadowCluster,
+		max:     int32(cc.ShadowMaxPending),
+		percent: 100,
+		writes:  true,
+	}
+}
+
+// mirror forwards the clones of writes of msgs succeeded into the shadow
+// cluster, the writes more than max pending are dropped.
+func (s *shadower) mirror(msgs []*proto.Message) {
+	var (
+		cms []*proto.Message
+		wg  = &sync.WaitGroup{}
+	)
+	for _, m := range msgs {
+		if m.Err() != nil {
+			continue
+		}
+		if s.percent < 100 && rand.Intn(100) >= s.percent {
+			continue
+		}
+		for _, req := range m.Requests() {
+			if !s.mirrorable(req) {
+				continue
+			}
+			if atomic.AddInt32(&s.pending, 1) > s.max {
+				atomic.AddInt32(&s.pending, -1)
+				s.count(&s.dropped, s.kind+" dropped", 1)
+				continue
+			}
+			cm := proto.NewMessage()
+			cm.Type = m.Type
+			cm.WithRequest(req.(proto.Hedger).Clone())
+			cm.WithWaitGroup(wg)
+			cms = append(cms, cm)
+		}
+	}
+	if len(cms) == 0 {
+		return
+	}
+	go s.forward(cms, wg)
+}
+
+func (s *shadower) forward(cms []*proto.Message, wg *sync.WaitGroup) {
+	defer atomic.AddInt32(&s.pending, -int32(len(cms)))
+	f, ok := s.p.forwarder(s.shadow)
+	if !ok {
+		s.count(&s.failed, s.kind+" failed", len(cms))
+		return
+	}
+	_ = f.Forward(cms)
+	wg.Wait()
+	var failed int
+	for _, cm := range cms {
+		if cm.Err() != nil {
+			failed++
+		}
+		cm.Request().Put()
+	}
+	atomic.AddInt64(&s.mirrored, int64(len(cms)-failed))
+	if failed > 0 {
+		s.count(&s.failed, s.kind+" failed", failed)
+	}
+}
+
+func (s *shadower) count(n *int64, err string, delta int) {
+	atomic.AddInt64(n, int64(delta))
+	if prom.On {
+		prom.ErrAdd(s.cluster, s.shadow, "", err, delta)
+	}
+}
+
+// mirrorable returns true if req is the read or write to be mirrored.
+func (s *shadower) mirrorable(req proto.Request) bool {
+	c, ok := req.(proto.Classifier)
+	if !ok || !((s.writes && c.IsWrite()) || (s.reads && c.IsRead())) {
+		return false
+	}
+	_, ok = req.(proto.Hedger)
+	return ok
+}
+
+// forwarder returns the forwarder of cluster name.
+func (p *Proxy) forwarder(name string) (proto.Forwarder, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	f, ok := p.forwarders[name]
+	return f, ok
+}
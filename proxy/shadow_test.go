@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"overlord/pkg/types"
+	"overlord/proxy/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type _shadowForwarder struct {
+	_updateForwarder
+	lock sync.Mutex
+	cmds []string
+}
+
+func (f *_shadowForwarder) Forward(msgs []*proto.Message) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for _, m := range msgs {
+		f.cmds = append(f.cmds, string(m.Request().Key()))
+		if string(m.Request().Key()) == "bad" {
+			m.WithError(errors.New("mock error"))
+		}
+	}
+	return nil
+}
+
+func (f *_shadowForwarder) forwarded() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.cmds
+}
+
+func waitShadow(t *testing.T, s *shadower) {
+	for i := 0; i < 100 && atomic.LoadInt32(&s.pending) > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, int32(0), atomic.LoadInt32(&s.pending))
+}
+
+func TestShadowerMirror(t *testing.T) {
+	assert.Nil(t, newShadower(nil, &ClusterConfig{}))
+	f := &_shadowForwarder{}
+	p := &Proxy{forwarders: map[string]proto.Forwarder{"b": f}}
+	s := newShadower(p, &ClusterConfig{Name: "a", ShadowCluster: "b", ShadowMaxPending: 4})
+
+	msgs := decodeTx(t, "SET a 1\r\nGET a\r\nMSET b 1 c 2\r\nDEL bad\r\nPING\r\nSET d 1\r\n", 6)
+	msgs[5].WithError(errors.New("primary error"))
+	s.mirror(msgs)
+	waitShadow(t, s)
+	assert.Equal(t, []string{"a", "b", "c", "bad"}, f.forwarded())
+	assert.Equal(t, int64(3), atomic.LoadInt64(&s.mirrored))
+	assert.Equal(t, int64(1), atomic.LoadInt64(&s.failed))
+
+	// NOTE: the writes more than max pending are dropped
+	f.lock.Lock()
+	f.cmds = nil
+	f.lock.Unlock()
+	atomic.StoreInt32(&s.pending, 3)
+	msgs = decodeTx(t, "SET a 1\r\nSET b 1\r\n", 2)
+	s.mirror(msgs)
+	for i := 0; i < 100 && len(f.forwarded()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	atomic.AddInt32(&s.pending, -3)
+	waitShadow(t, s)
+	assert.Equal(t, []string{"a"}, f.forwarded())
+	assert.Equal(t, int64(1), atomic.LoadInt64(&s.dropped))
+
+	s = newShadower(p, &ClusterConfig{Name: "a", ShadowCluster: "c", ShadowMaxPending: 4})
+	s.mirror(decodeTx(t, "SET a 1\r\n", 1))
+	waitShadow(t, s)
+	assert.Equal(t, int64(1), atomic.LoadInt64(&s.failed))
+}
+
+func TestValidateShadow(t *testing.T) {
+	ccs := []*ClusterConfig{
+		{Name: "a", CacheType: types.CacheTypeRedis, ShadowCluster: "b"},
+		{Name: "b", CacheType: types.CacheTypeRedis},
+	}
+	assert.NoError(t, validateShadow(ccs))
+	ccs[1].CacheType = types.CacheTypeMemcache
+	assert.Error(t, validateShadow(ccs))
+	ccs[0].ShadowCluster = "c"
+	assert.Error(t, validateShadow(ccs))
+}
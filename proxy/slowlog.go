@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"bytes"
+	"strconv"
+	"time"
+
+	"overlord/pkg/conv"
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/redis"
+)
+
+// slowlogDefaultCount is the number of entries replied by SLOWLOG GET
+// without count, the same as redis.
+const slowlogDefaultCount = 10
+
+var (
+	slowlogGetBytes   = []byte("3\r\nGET")
+	slowlogLenBytes   = []byte("3\r\nLEN")
+	slowlogResetBytes = []byte("5\r\nRESET")
+
+	slowlogNotIntBytes    = []byte("ERR value is not an integer or out of range")
+	slowlogWrongArgsBytes = []byte("ERR Unknown SLOWLOG subcommand or wrong number of arguments")
+)
+
+// replySlowlog answers SLOWLOG GET [count], LEN and RESET of redis clients
+// by the slowlog of the cluster recorded by proxy.
+func (h *Handler) replySlowlog(msg *proto.Message) {
+	if msg.IsBatch() {
+		return
+	}
+	req, ok := msg.Request().(*redis.Request)
+	if !ok || !req.IsSlowlog() {
+		return
+	}
+	args := req.RESP().Array()
+	if len(args) < 2 {
+		req.Reply().SetError(slowlogWrongArgsBytes)
+		return
+	}
+	conv.UpdateToUpper(args[1].Data())
+	switch {
+	case bytes.Equal(args[1].Data(), slowlogGetBytes) && len(args) <= 3:
+		n := slowlogDefaultCount
+		if len(args) == 3 {
+			var err error
+			if n, err = strconv.Atoi(string(bulkData(args[2].Data()))); err != nil {
+				req.Reply().SetError(slowlogNotIntBytes)
+				return
+			}
+		}
+		var entries []*proto.SlowlogEntry
+		if h.slog != nil {
+			entries = h.slog.Get(n)
+		}
+		sis := make([]*redis.SlowlogInfo, 0, len(entries))
+		for _, entry := range entries {
+			sis = append(sis, slowlogInfo(h.cc.Name, entry))
+		}
+		req.Reply().SetSlowlog(sis)
+	case bytes.Equal(args[1].Data(), slowlogLenBytes) && len(args) == 2:
+		var n int
+		if h.slog != nil {
+			n = h.slog.Len()
+		}
+		req.Reply().SetInteger(int64(n))
+	case bytes.Equal(args[1].Data(), slowlogResetBytes) && len(args) == 2:
+		if h.slog != nil {
+			h.slog.Reset()
+		}
+		req.Reply().SetString(okBytes)
+	default:
+		req.Reply().SetError(slowlogWrongArgsBytes)
+	}
+}
+
+// slowlogInfo converts entry into the entry of SLOWLOG GET, the sub entries
+// of batch are joined as one command.
+func slowlogInfo(cluster string, entry *proto.SlowlogEntry) *redis.SlowlogInfo {
+	si := &redis.SlowlogInfo{ID: entry.ID, Name: cluster}
+	if len(entry.Subs) == 0 {
+		si.Time = entry.StartTime.Unix()
+		si.Duration = int64(entry.TotalDur / time.Microsecond)
+		si.Args = entry.Cmd
+		si.Addr = entry.Addr
+		return si
+	}
+	sub := entry.Subs[0]
+	si.Time = sub.StartTime.Unix()
+	si.Duration = int64(sub.TotalDur / time.Microsecond)
+	si.Addr = sub.Addr
+	for i, sub := range entry.Subs {
+		if i > 0 && len(sub.Cmd) > 0 {
+			si.Args = append(si.Args, sub.Cmd[1:]...)
+			continue
+		}
+		si.Args = append(si.Args, sub.Cmd...)
+	}
+	return si
+}
@@ -8,14 +8,15 @@ import (
 	"overlord/proxy/proto"
 )
 
-// showlog will show slowlog to http
-func showlog(w http.ResponseWriter, _req *http.Request) {
+// ServeHTTP will show slowlog to http, only of the cluster if given
+func ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	cluster := req.URL.Query().Get("cluster")
 	storeLock.RLock()
-	var slogs = make([]*proto.SlowlogEntries, len(storeMap))
-	idx := 0
-	for _, s := range storeMap {
-		slogs[idx] = s.Reply()
-		idx++
+	var slogs = make([]*proto.SlowlogEntries, 0, len(storeMap))
+	for name, s := range storeMap {
+		if cluster == "" || cluster == name {
+			slogs = append(slogs, s.Reply())
+		}
 	}
 	storeLock.RUnlock()
 
@@ -28,5 +29,5 @@ func showlog(w http.ResponseWriter, _req *http.Request) {
 
 // registerSlowlogHTTP will register slowlog by /slowlog
 func registerSlowlogHTTP() {
-	http.HandleFunc("/slowlog", showlog)
+	http.HandleFunc("/slowlog", ServeHTTP)
 }
@@ -22,6 +22,7 @@ func newStore(name string) *Store {
 type Store struct {
 	name   string
 	cursor uint32
+	reset  uint32
 	msgs   []atomic.Value
 }
 
@@ -30,34 +31,60 @@ func (s *Store) Record(msg *proto.SlowlogEntry) {
 	if msg == nil {
 		return
 	}
-
-	for {
-		if atomic.CompareAndSwapUint32(&s.cursor, s.cursor, s.cursor+1) {
-			idx := (s.cursor - 1) % slowlogMaxCount
-			s.msgs[idx].Store(msg)
-			if fh != nil {
-				fh.save(s.name, msg)
-			}
-			break
-		}
+	cursor := atomic.AddUint32(&s.cursor, 1)
+	msg.ID = int64(cursor)
+	s.msgs[(cursor-1)%slowlogMaxCount].Store(msg)
+	if fh != nil {
+		fh.save(s.name, msg)
 	}
 }
 
-// Reply impl the Replyer
-func (s *Store) Reply() *proto.SlowlogEntries {
-	entries := make([]*proto.SlowlogEntry, 0)
-	for _, msg := range s.msgs {
-		m := msg.Load()
+// Get returns the newest n entries from newest to oldest, all if n < 0.
+func (s *Store) Get(n int) []*proto.SlowlogEntry {
+	cursor := atomic.LoadUint32(&s.cursor)
+	reset := atomic.LoadUint32(&s.reset)
+	if l := s.length(cursor, reset); n < 0 || n > l {
+		n = l
+	}
+	entries := make([]*proto.SlowlogEntry, 0, n)
+	for i := 0; i < n; i++ {
+		m := s.msgs[(cursor-1-uint32(i))%slowlogMaxCount].Load()
 		if m == nil {
 			break
 		}
-		sentry := m.(*proto.SlowlogEntry)
-		entries = append(entries, sentry)
+		entry := m.(*proto.SlowlogEntry)
+		if entry.ID <= int64(reset) {
+			// NOTE: overwritten by the newer entry
+			break
+		}
+		entries = append(entries, entry)
 	}
+	return entries
+}
+
+// Len returns the number of entries.
+func (s *Store) Len() int {
+	return s.length(atomic.LoadUint32(&s.cursor), atomic.LoadUint32(&s.reset))
+}
 
+func (s *Store) length(cursor, reset uint32) int {
+	n := cursor - reset
+	if n > slowlogMaxCount {
+		n = slowlogMaxCount
+	}
+	return int(n)
+}
+
+// Reset clears all entries.
+func (s *Store) Reset() {
+	atomic.StoreUint32(&s.reset, atomic.LoadUint32(&s.cursor))
+}
+
+// Reply impl the Replyer
+func (s *Store) Reply() *proto.SlowlogEntries {
 	ses := &proto.SlowlogEntries{
 		Cluster: s.name,
-		Entries: entries,
+		Entries: s.Get(-1),
 	}
 	return ses
 }
@@ -70,6 +97,9 @@ var (
 // Handler is the handler which contains the store instance with async call
 type Handler interface {
 	Record(msg *proto.SlowlogEntry)
+	Get(n int) []*proto.SlowlogEntry
+	Len() int
+	Reset()
 	Reply() *proto.SlowlogEntries
 }
 
@@ -84,6 +114,9 @@ func Get(name string) Handler {
 
 	storeLock.Lock()
 	defer storeLock.Unlock()
+	if s, ok := storeMap[name]; ok {
+		return s
+	}
 	s := newStore(name)
 	storeMap[name] = s
 	return s
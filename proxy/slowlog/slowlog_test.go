@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"os"
+	"overlord/proxy/proto"
 	"sync/atomic"
 	"testing"
 )
@@ -47,3 +48,29 @@ func TestRecordWithCursorInt32(t *testing.T) {
 	}
 	assert.False(t, idxOk)
 }
+
+func TestStoreGetLenReset(t *testing.T) {
+	s := newStore("test")
+	assert.Equal(t, 0, s.Len())
+	assert.Len(t, s.Get(10), 0)
+	for i := 0; i < slowlogMaxCount+2; i++ {
+		s.Record(&proto.SlowlogEntry{})
+	}
+	assert.Equal(t, slowlogMaxCount, s.Len())
+	entries := s.Get(3)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, int64(slowlogMaxCount+2), entries[0].ID)
+	assert.Equal(t, int64(slowlogMaxCount), entries[2].ID)
+	entries = s.Get(-1)
+	assert.Len(t, entries, slowlogMaxCount)
+	assert.Equal(t, int64(3), entries[slowlogMaxCount-1].ID)
+
+	s.Reset()
+	assert.Equal(t, 0, s.Len())
+	assert.Len(t, s.Get(-1), 0)
+	s.Record(&proto.SlowlogEntry{})
+	assert.Equal(t, 1, s.Len())
+	entries = s.Reply().Entries
+	assert.Len(t, entries, 1)
+	assert.Equal(t, int64(slowlogMaxCount+3), entries[0].ID)
+}
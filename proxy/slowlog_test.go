@@ -0,0 +1,41 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"overlord/pkg/mockconn"
+	libnet "overlord/pkg/net"
+	"overlord/pkg/types"
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/redis"
+	"overlord/proxy/slowlog"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlerReplySlowlog(t *testing.T) {
+	h := &Handler{cc: &ClusterConfig{Name: "slowlog-test", CacheType: types.CacheTypeRedis}, slog: slowlog.Get("slowlog-test")}
+	start := time.Unix(1500000000, 0)
+	h.slog.Record(&proto.SlowlogEntry{Cmd: []string{"GET", "a"}, StartTime: start, TotalDur: 15 * time.Millisecond, Addr: "127.0.0.1:6379"})
+	h.slog.Record(&proto.SlowlogEntry{Subs: []*proto.SlowlogEntry{
+		{Cmd: []string{"MGET", "a"}, StartTime: start, TotalDur: 20 * time.Millisecond, Addr: "127.0.0.1:6379"},
+		{Cmd: []string{"MGET", "b"}, StartTime: start, TotalDur: 20 * time.Millisecond, Addr: "127.0.0.1:6380"},
+	}})
+	mconn, buf := mockconn.CreateDownStreamConn()
+	wpc := redis.NewProxyConn(libnet.NewConn(mconn, time.Second, time.Second), true)
+	for _, cmd := range []string{"slowlog len", "slowlog get 1", "slowlog get x", "slowlog reset", "slowlog get", "slowlog"} {
+		rpc := redis.NewProxyConn(libnet.NewConn(mockconn.CreateConn([]byte(cmd+"\r\n"), 1), time.Second, time.Second), true)
+		msgs, err := rpc.Decode(proto.GetMsgs(1))
+		assert.NoError(t, err)
+		h.replySlowlog(msgs[0])
+		assert.NoError(t, wpc.Encode(msgs[0]))
+	}
+	assert.NoError(t, wpc.Flush())
+	assert.Equal(t, ":2\r\n"+
+		"*1\r\n*6\r\n:2\r\n:1500000000\r\n:20000\r\n*3\r\n$4\r\nMGET\r\n$1\r\na\r\n$1\r\nb\r\n$14\r\n127.0.0.1:6379\r\n$12\r\nslowlog-test\r\n"+
+		"-ERR value is not an integer or out of range\r\n"+
+		"+OK\r\n"+
+		"*0\r\n"+
+		"-ERR Unknown SLOWLOG subcommand or wrong number of arguments\r\n", buf.String())
+}
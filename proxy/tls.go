@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	tlsVersions = map[string]uint16{
+		"1.0": tls.VersionTLS10,
+		"1.1": tls.VersionTLS11,
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	}
+	tlsCipherSuites = map[string]uint16{
+		"TLS_RSA_WITH_AES_128_CBC_SHA":            tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+		"TLS_RSA_WITH_AES_256_CBC_SHA":            tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+		"TLS_RSA_WITH_AES_128_GCM_SHA256":         tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+		"TLS_RSA_WITH_AES_256_GCM_SHA384":         tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+		"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA":    tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+		"TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA":    tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+		"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA":      tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+		"TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA":      tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+		"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256": tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384": tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256":   tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384":   tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305":    tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+		"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305":  tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+	}
+	// NOTE: the TLS 1.3 suites are not configurable and always enabled.
+	tls13CipherSuites = map[string]struct{}{
+		"TLS_AES_128_GCM_SHA256":       struct{}{},
+		"TLS_AES_256_GCM_SHA384":       struct{}{},
+		"TLS_CHACHA20_POLY1305_SHA256": struct{}{},
+	}
+)
+
+// TLSConfig builds the tls config of client side listener, nil if tls is
+// not enabled.
+func (cc *ClusterConfig) TLSConfig() (*tls.Config, error) {
+	if cc.TLSCert == "" && cc.TLSKey == "" {
+		return nil, nil
+	}
+	if cc.TLSCert == "" || cc.TLSKey == "" {
+		return nil, errors.Wrap(ErrClusterConfInvalid, "tls_cert and tls_key must be set both")
+	}
+	cert, err := tls.LoadX509KeyPair(cc.TLSCert, cc.TLSKey)
+	if err != nil {
+		return nil, errors.Wrapf(ErrClusterConfInvalid, "tls load key pair error:%v", err)
+	}
+	conf := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   cc.TLSALPN,
+	}
+	if cc.TLSMinVersion != "" {
+		ver, ok := tlsVersions[cc.TLSMinVersion]
+		if !ok {
+			return nil, errors.Wrapf(ErrClusterConfInvalid, "tls_min_version:%s", cc.TLSMinVersion)
+		}
+		conf.MinVersion = ver
+	}
+	for _, name := range cc.TLSCiphers {
+		if _, ok := tls13CipherSuites[name]; ok {
+			return nil, errors.Wrapf(ErrClusterConfInvalid, "tls_ciphers:%s is TLS 1.3 suite and not configurable", name)
+		}
+		cs, ok := tlsCipherSuites[name]
+		if !ok {
+			return nil, errors.Wrapf(ErrClusterConfInvalid, "tls_ciphers:%s", name)
+		}
+		conf.CipherSuites = append(conf.CipherSuites, cs)
+	}
+	return conf, nil
+}
+
+// listenTLS wraps l as tls listener if tls is enabled by cc.
+func listenTLS(cc *ClusterConfig, l net.Listener) (net.Listener, error) {
+	conf, err := cc.TLSConfig()
+	if err != nil || conf == nil {
+		return l, err
+	}
+	return tls.NewListener(l, conf), nil
+}
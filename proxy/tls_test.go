@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func _createKeyPair(t *testing.T) (dir, cert, key string) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "overlord"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	assert.NoError(t, err)
+	kder, err := x509.MarshalECPrivateKey(priv)
+	assert.NoError(t, err)
+
+	dir, err = ioutil.TempDir("", "overlord-tls")
+	assert.NoError(t, err)
+	cert = filepath.Join(dir, "cert.pem")
+	key = filepath.Join(dir, "key.pem")
+	assert.NoError(t, ioutil.WriteFile(cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, ioutil.WriteFile(key, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kder}), 0600))
+	return
+}
+
+func TestClusterConfigTLSConfig(t *testing.T) {
+	dir, cert, key := _createKeyPair(t)
+	defer os.RemoveAll(dir)
+
+	conf, err := (&ClusterConfig{}).TLSConfig()
+	assert.NoError(t, err)
+	assert.Nil(t, conf)
+
+	_, err = (&ClusterConfig{TLSCert: cert}).TLSConfig()
+	assert.Error(t, err)
+	_, err = (&ClusterConfig{TLSCert: cert, TLSKey: key, TLSMinVersion: "2.0"}).TLSConfig()
+	assert.Error(t, err)
+	_, err = (&ClusterConfig{TLSCert: cert, TLSKey: key, TLSCiphers: []string{"NOT_A_CIPHER"}}).TLSConfig()
+	assert.Error(t, err)
+	_, err = (&ClusterConfig{TLSCert: cert, TLSKey: key, TLSCiphers: []string{"TLS_AES_128_GCM_SHA256"}}).TLSConfig()
+	assert.Error(t, err)
+
+	conf, err = (&ClusterConfig{TLSCert: cert, TLSKey: key, TLSMinVersion: "1.2",
+		TLSCiphers: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}}).TLSConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), conf.MinVersion)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}, conf.CipherSuites)
+}
+
+func TestListenTLSOk(t *testing.T) {
+	dir, cert, key := _createKeyPair(t)
+	defer os.RemoveAll(dir)
+
+	l, err := Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	cc := &ClusterConfig{TLSCert: cert, TLSKey: key, TLSALPN: []string{"redis"}}
+	l, err = listenTLS(cc, l)
+	assert.NoError(t, err)
+	defer l.Close()
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		buf := make([]byte, 6)
+		if _, err = conn.Read(buf); err == nil {
+			_, _ = conn.Write([]byte("+PONG\r\n"))
+		}
+		conn.Close()
+	}()
+
+	conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"redis"}})
+	assert.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, "redis", conn.ConnectionState().NegotiatedProtocol)
+	_, err = conn.Write([]byte("PING\r\n"))
+	assert.NoError(t, err)
+	buf := make([]byte, 7)
+	_, err = conn.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "+PONG\r\n", string(buf))
+}
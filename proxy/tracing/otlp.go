@@ -0,0 +1,160 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"overlord/pkg/log"
+)
+
+const (
+	exchangeSize  = 4096
+	batchSize     = 512
+	flushInterval = time.Second
+	exportTimeout = 5 * time.Second
+)
+
+// span is the span of OTLP in json.
+type span struct {
+	TraceID           string  `json:"traceId"`
+	SpanID            string  `json:"spanId"`
+	ParentSpanID      string  `json:"parentSpanId,omitempty"`
+	Name              string  `json:"name"`
+	Kind              int     `json:"kind"`
+	StartTimeUnixNano string  `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string  `json:"endTimeUnixNano"`
+	Attributes        []attr  `json:"attributes,omitempty"`
+	Status            *status `json:"status,omitempty"`
+}
+
+type attr struct {
+	Key   string    `json:"key"`
+	Value attrValue `json:"value"`
+}
+
+type attrValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func newSpan(traceID, parentID, name string, kind int, start, end time.Time) *span {
+	return &span{
+		TraceID:           traceID,
+		SpanID:            newID(8),
+		ParentSpanID:      parentID,
+		Name:              name,
+		Kind:              kind,
+		StartTimeUnixNano: strconv.FormatInt(start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(end.UnixNano(), 10),
+	}
+}
+
+func (s *span) attr(key, val string) {
+	s.Attributes = append(s.Attributes, attr{Key: key, Value: attrValue{StringValue: val}})
+}
+
+// exporter posts spans to the OTLP/HTTP traces endpoint in json by batch.
+type exporter struct {
+	endpoint string
+	service  string
+	client   *http.Client
+	exchange chan []*span
+	dropped  int64
+}
+
+var exp *exporter
+
+// Init tracing with the OTLP/HTTP traces endpoint, such as
+// http://127.0.0.1:4318/v1/traces of OpenTelemetry collector or jaeger.
+func Init(endpoint, service string) {
+	if endpoint == "" {
+		return
+	}
+	log.Infof("setup tracing to [%s] as service [%s]", endpoint, service)
+	exp = &exporter{
+		endpoint: endpoint,
+		service:  service,
+		client:   &http.Client{Timeout: exportTimeout},
+		exchange: make(chan []*span, exchangeSize),
+	}
+	go exp.run()
+}
+
+// save never blocks the handler, the spans are dropped if the exporter
+// can't catch up.
+func (e *exporter) save(spans []*span) {
+	select {
+	case e.exchange <- spans:
+	default:
+		atomic.AddInt64(&e.dropped, 1)
+	}
+}
+
+func (e *exporter) run() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	batch := make([]*span, 0, batchSize)
+	for {
+		select {
+		case spans := <-e.exchange:
+			batch = append(batch, spans...)
+			if len(batch) < batchSize {
+				continue
+			}
+		case <-ticker.C:
+			if n := atomic.SwapInt64(&e.dropped, 0); n > 0 {
+				log.Warnf("tracing dropped %d traces because exporter is busy", n)
+			}
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		if err := e.export(batch); err != nil {
+			log.Errorf("fail to export %d spans due %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+}
+
+func (e *exporter) export(spans []*span) error {
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("endpoint replied %s", resp.Status)
+	}
+	return nil
+}
+
+// request is ExportTraceServiceRequest of OTLP in json.
+func (e *exporter) request(spans []*span) interface{} {
+	type scopeSpans struct {
+		Scope map[string]string `json:"scope"`
+		Spans []*span           `json:"spans"`
+	}
+	type resourceSpans struct {
+		Resource   map[string][]attr `json:"resource"`
+		ScopeSpans []scopeSpans      `json:"scopeSpans"`
+	}
+	return map[string][]resourceSpans{
+		"resourceSpans": {{
+			Resource:   map[string][]attr{"attributes": {{Key: "service.name", Value: attrValue{StringValue: e.service}}}},
+			ScopeSpans: []scopeSpans{{Scope: map[string]string{"name": "overlord/proxy"}, Spans: spans}},
+		}},
+	}
+}
@@ -0,0 +1,126 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"overlord/pkg/types"
+	"overlord/proxy/proto"
+
+	"github.com/pkg/errors"
+)
+
+// span kinds of OTLP.
+const (
+	kindInternal = 1
+	kindServer   = 2
+	kindClient   = 3
+
+	statusError = 2
+)
+
+// Tracer samples the messages of one cluster and exports their lifecycle
+// as spans.
+type Tracer struct {
+	cluster string
+	rate    float64
+	count   uint64
+}
+
+// Get returns the tracer of cluster sampled by rate, nil if rate is zero or
+// tracing is not inited.
+func Get(cluster string, rate float64) *Tracer {
+	if exp == nil || rate <= 0 {
+		return nil
+	}
+	return &Tracer{cluster: cluster, rate: rate}
+}
+
+// Sample marks msg traced by a new trace id if sampled, the messages are
+// sampled evenly by rate.
+func (t *Tracer) Sample(msg *proto.Message) {
+	if t.rate < 1 {
+		n := atomic.AddUint64(&t.count, 1)
+		if uint64(float64(n)*t.rate) == uint64(float64(n-1)*t.rate) {
+			return
+		}
+	}
+	msg.WithTraceID(newID(16))
+}
+
+// Finish exports the spans of msg traced after its reply encoded to client.
+func (t *Tracer) Finish(msg *proto.Message, client string) {
+	if msg.TraceID() == "" {
+		return
+	}
+	exp.save(t.spans(msg, client))
+}
+
+// spans builds the root span of msg with the children of lifecycle:
+// dispatch from decoded to forwarded, queue in node conn pipe, backend
+// round trip of each node and merge replies then encode.
+func (t *Tracer) spans(msg *proto.Message, client string) []*span {
+	tl := msg.Timeline()
+	traceID := msg.TraceID()
+	cmd := ""
+	if req := msg.Request(); req != nil {
+		cmd = req.CmdString()
+	}
+	root := newSpan(traceID, "", "overlord "+cmd, kindServer, tl.Start, tl.End)
+	root.attr("overlord.cluster", t.cluster)
+	root.attr("db.system", dbSystem(msg.Type))
+	root.attr("db.operation", cmd)
+	root.attr("net.peer.name", client)
+	if err := msg.Err(); err != nil {
+		root.Status = &status{Code: statusError, Message: errors.Cause(err).Error()}
+	}
+	spans := []*span{root}
+	child := func(name string, kind int, start, end time.Time) *span {
+		if start.Before(tl.Start) || end.Before(start) {
+			// NOTE: not passed through
+			return nil
+		}
+		s := newSpan(traceID, root.SpanID, name, kind, start, end)
+		spans = append(spans, s)
+		return s
+	}
+	child("dispatch", kindInternal, tl.Start, tl.Forward)
+	subs := []*proto.Message{msg}
+	if msg.IsBatch() {
+		subs = msg.Batch()
+	}
+	for i, sub := range subs {
+		stl := sub.Timeline()
+		if s := child("queue", kindInternal, stl.Queue, stl.Dequeue); s != nil && len(subs) > 1 {
+			s.attr("overlord.sub", strconv.Itoa(i))
+		}
+		if s := child("backend "+cmd, kindClient, stl.Write, stl.Read); s != nil {
+			s.attr("net.peer.name", sub.Addr())
+			if len(subs) > 1 {
+				s.attr("overlord.sub", strconv.Itoa(i))
+			}
+		}
+	}
+	child("merge", kindInternal, tl.Reply, tl.End)
+	return spans
+}
+
+func dbSystem(ct types.CacheType) string {
+	switch ct {
+	case types.CacheTypeRedis, types.CacheTypeRedisCluster:
+		return "redis"
+	case types.CacheTypeMemcache, types.CacheTypeMemcacheBinary:
+		return "memcached"
+	}
+	return string(ct)
+}
+
+// newID returns the random id of n bytes in hex.
+func newID(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,118 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"overlord/pkg/mockconn"
+	libnet "overlord/pkg/net"
+	"overlord/proxy/proto"
+	"overlord/proxy/proto/redis"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func _decode(t *testing.T, cmd string) *proto.Message {
+	rpc := redis.NewProxyConn(libnet.NewConn(mockconn.CreateConn([]byte(cmd), 1), time.Second, time.Second), true)
+	msgs, err := rpc.Decode(proto.GetMsgs(1))
+	assert.NoError(t, err)
+	return msgs[0]
+}
+
+func TestTracerSample(t *testing.T) {
+	tr := &Tracer{rate: 0.1}
+	var n int
+	for i := 0; i < 100; i++ {
+		msg := proto.NewMessage()
+		tr.Sample(msg)
+		if msg.TraceID() != "" {
+			assert.Len(t, msg.TraceID(), 32)
+			n++
+		}
+	}
+	assert.Equal(t, 10, n)
+}
+
+func TestTracerSpans(t *testing.T) {
+	tr := &Tracer{cluster: "test", rate: 1}
+	msg := _decode(t, "*2\r\n$3\r\nGET\r\n$1\r\na\r\n")
+	tr.Sample(msg)
+	for _, mark := range []func(){msg.MarkStartPipe, msg.MarkStartInput, msg.MarkEndInput, msg.MarkWrite, msg.MarkRead, msg.MarkEndPipe, msg.MarkEnd} {
+		time.Sleep(time.Millisecond)
+		mark()
+	}
+	msg.MarkAddr("127.0.0.1:6379")
+	msg.WithError(errors.New("timeout"))
+	spans := tr.spans(msg, "127.0.0.1:5000")
+	assert.Len(t, spans, 5)
+	root := spans[0]
+	assert.Equal(t, "overlord GET", root.Name)
+	assert.Equal(t, msg.TraceID(), root.TraceID)
+	assert.Equal(t, "", root.ParentSpanID)
+	assert.Equal(t, statusError, root.Status.Code)
+	assert.Equal(t, "timeout", root.Status.Message)
+	var names []string
+	for _, s := range spans[1:] {
+		assert.Equal(t, root.TraceID, s.TraceID)
+		assert.Equal(t, root.SpanID, s.ParentSpanID)
+		names = append(names, s.Name)
+	}
+	assert.Equal(t, []string{"dispatch", "queue", "backend GET", "merge"}, names)
+	assert.Equal(t, []attr{{Key: "net.peer.name", Value: attrValue{StringValue: "127.0.0.1:6379"}}}, spans[3].Attributes)
+	assert.Equal(t, msg.TraceID(), msg.Slowlog().TraceID)
+	msg.Reset()
+	assert.Equal(t, "", msg.TraceID())
+
+	// NOTE: answered by proxy itself
+	msg = _decode(t, "*1\r\n$4\r\nPING\r\n")
+	tr.Sample(msg)
+	msg.MarkEnd()
+	spans = tr.spans(msg, "127.0.0.1:5000")
+	assert.Len(t, spans, 1)
+}
+
+func TestExporter(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bs, _ := ioutil.ReadAll(r.Body)
+		bodies <- bs
+	}))
+	defer srv.Close()
+	assert.Nil(t, Get("test", 1))
+	Init(srv.URL, "overlord-test")
+	assert.Nil(t, Get("test", 0))
+	tr := Get("test", 1)
+	msg := _decode(t, "*2\r\n$3\r\nGET\r\n$1\r\na\r\n")
+	tr.Finish(msg, "127.0.0.1:5000")
+	tr.Sample(msg)
+	msg.MarkEnd()
+	tr.Finish(msg, "127.0.0.1:5000")
+
+	var req struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []attr `json:"attributes"`
+			} `json:"resource"`
+			ScopeSpans []struct {
+				Spans []*span `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	select {
+	case bs := <-bodies:
+		assert.NoError(t, json.Unmarshal(bs, &req))
+	case <-time.After(3 * flushInterval):
+		t.Fatal("spans not exported")
+	}
+	assert.Len(t, req.ResourceSpans, 1)
+	assert.Equal(t, "overlord-test", req.ResourceSpans[0].Resource.Attributes[0].Value.StringValue)
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	assert.Len(t, spans, 1)
+	assert.Equal(t, msg.TraceID(), spans[0].TraceID)
+	assert.Len(t, spans[0].SpanID, 16)
+}
@@ -0,0 +1,270 @@
+package proxy
+
+import (
+	errs "errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"overlord/pkg/log"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// listenFDsEnv passes the inherited listeners to the new process as
+	// proto://addr=fd separated by comma.
+	listenFDsEnv = "OVERLORD_LISTEN_FDS"
+	// readyFDEnv passes the pipe which the new process writes into once it
+	// serves with the inherited listeners.
+	readyFDEnv = "OVERLORD_READY_FD"
+
+	upgradeTimeout = 30 * time.Second
+	drainInterval  = 100 * time.Millisecond
+)
+
+// upgrade errors
+var (
+	ErrUpgradeNotReady = errs.New("Proxy upgrade new process is not ready")
+	ErrUpgradeNoFile   = errs.New("Proxy upgrade listener can't be inherited")
+)
+
+var (
+	inheritOnce sync.Once
+	inheritLock sync.Mutex
+	inherited   map[string]*os.File
+)
+
+// fdKey is the key of listener passed to the new process.
+func fdKey(proto, addr string) string {
+	return proto + "://" + addr
+}
+
+// parseListenFDs parses the value of listenFDsEnv.
+func parseListenFDs(val string) (fds map[string]int, err error) {
+	fds = map[string]int{}
+	if val == "" {
+		return
+	}
+	for _, kv := range strings.Split(val, ",") {
+		idx := strings.LastIndexByte(kv, '=')
+		if idx < 0 {
+			return nil, errors.Errorf("invalid inherited listener:%s", kv)
+		}
+		fd, err := strconv.Atoi(kv[idx+1:])
+		if err != nil {
+			return nil, errors.Errorf("invalid inherited listener:%s", kv)
+		}
+		fds[kv[:idx]] = fd
+	}
+	return
+}
+
+// inherit takes the listener of proto and addr inherited from the old
+// process if any.
+func inherit(proto, addr string) (l net.Listener, ok bool, err error) {
+	inheritOnce.Do(func() {
+		fds, err := parseListenFDs(os.Getenv(listenFDsEnv))
+		if err != nil {
+			log.Errorf("overlord proxy parse inherited listeners error:%v", err)
+		}
+		inheritLock.Lock()
+		inherited = make(map[string]*os.File, len(fds))
+		for key, fd := range fds {
+			inherited[key] = os.NewFile(uintptr(fd), key)
+		}
+		inheritLock.Unlock()
+	})
+	inheritLock.Lock()
+	key := fdKey(proto, addr)
+	f, ok := inherited[key]
+	delete(inherited, key)
+	inheritLock.Unlock()
+	if !ok {
+		return
+	}
+	defer f.Close()
+	if l, err = net.FileListener(f); err != nil {
+		err = errors.Wrapf(err, "Proxy Listen inherited %s", key)
+		return
+	}
+	log.Infof("overlord proxy inherit listener %s", key)
+	return
+}
+
+// Ready tells the old process that the new one serves with the inherited
+// listeners, the listeners inherited but not used are closed.
+func Ready() {
+	inheritLock.Lock()
+	for key, f := range inherited {
+		log.Warnf("overlord proxy inherited listener %s is not used and closed", key)
+		_ = f.Close()
+	}
+	inherited = nil
+	inheritLock.Unlock()
+	val := os.Getenv(readyFDEnv)
+	if val == "" {
+		return
+	}
+	fd, err := strconv.Atoi(val)
+	if err != nil {
+		log.Errorf("overlord proxy invalid %s:%s", readyFDEnv, val)
+		return
+	}
+	f := os.NewFile(uintptr(fd), "ready")
+	if _, err = f.Write([]byte{1}); err != nil {
+		log.Errorf("overlord proxy notify old process error:%v", err)
+	}
+	_ = f.Close()
+}
+
+// Share hands off the extra listener l of proto and addr, such as the stat
+// listener, to the new process when Upgrade.
+func (p *Proxy) Share(proto, addr string, l net.Listener) {
+	p.lock.Lock()
+	if p.shares == nil {
+		p.shares = map[string]net.Listener{}
+	}
+	p.shares[fdKey(proto, addr)] = l
+	p.lock.Unlock()
+}
+
+// Upgrade starts a new process of the running binary with the same args
+// which inherits the listeners, and waits until it's ready. The clients are
+// kept and Drain should be called later to hand off the new connections.
+func (p *Proxy) Upgrade() (pid int, err error) {
+	p.lock.Lock()
+	socks := make(map[string]net.Listener, len(p.sockets)+len(p.shares))
+	for key, l := range p.shares {
+		socks[key] = l
+	}
+	for _, cc := range p.ccs {
+		if l, ok := p.sockets[cc.Name]; ok {
+			socks[fdKey(cc.ListenProto, cc.ListenAddr)] = l
+		}
+	}
+	p.lock.Unlock()
+	r, w, err := os.Pipe()
+	if err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+	defer r.Close()
+	files := []*os.File{os.Stdin, os.Stdout, os.Stderr, w}
+	defer func() {
+		for _, f := range files[3:] {
+			_ = f.Close()
+		}
+	}()
+	fds := make([]string, 0, len(socks))
+	for key, l := range socks {
+		fl, ok := l.(interface {
+			File() (*os.File, error)
+		})
+		if !ok {
+			err = errors.Wrapf(ErrUpgradeNoFile, "listener:%s", key)
+			return
+		}
+		var f *os.File
+		if f, err = fl.File(); err != nil {
+			err = errors.Wrapf(err, "listener:%s", key)
+			return
+		}
+		fds = append(fds, fmt.Sprintf("%s=%d", key, len(files)))
+		files = append(files, f)
+	}
+	path, err := os.Executable()
+	if err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+	env := make([]string, 0, len(os.Environ())+2)
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, listenFDsEnv+"=") && !strings.HasPrefix(kv, readyFDEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+	env = append(env, listenFDsEnv+"="+strings.Join(fds, ","), readyFDEnv+"=3")
+	proc, err := os.StartProcess(path, os.Args, &os.ProcAttr{Env: env, Files: files})
+	if err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+	// NOTE: close the write end to read EOF if the new process exits
+	for _, f := range files[3:] {
+		_ = f.Close()
+	}
+	files = files[:3]
+	if err = waitReady(r, upgradeTimeout); err != nil {
+		_ = proc.Kill()
+		_, _ = proc.Wait()
+		err = errors.Wrapf(err, "pid:%d", proc.Pid)
+		return
+	}
+	go func() { _, _ = proc.Wait() }()
+	log.Infof("overlord proxy upgraded to new process:%d with listeners %v", proc.Pid, fds)
+	return proc.Pid, nil
+}
+
+func waitReady(r *os.File, timeout time.Duration) error {
+	ch := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		if n, err := r.Read(buf); n != 1 {
+			ch <- errors.Wrapf(ErrUpgradeNotReady, "%v", err)
+			return
+		}
+		ch <- nil
+	}()
+	select {
+	case err := <-ch:
+		return err
+	case <-time.After(timeout):
+		return errors.Wrapf(ErrUpgradeNotReady, "timeout after %v", timeout)
+	}
+}
+
+// Drain stops accepting new connections and waits until the clients are
+// closed or timeout, the listen addrs are kept for the new process.
+func (p *Proxy) Drain(timeout time.Duration) {
+	p.lock.Lock()
+	ls := make([]net.Listener, 0, len(p.listeners)+len(p.shares))
+	for _, l := range p.listeners {
+		ls = append(ls, l)
+	}
+	for _, l := range p.sockets {
+		// NOTE: keep the unix sock file for the new process
+		if ul, ok := l.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+	for _, l := range p.shares {
+		ls = append(ls, l)
+	}
+	p.listeners = map[string]net.Listener{}
+	p.sockets = map[string]net.Listener{}
+	p.shares = nil
+	p.lock.Unlock()
+	for _, l := range ls {
+		_ = l.Close()
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		p.clientLock.RLock()
+		n := len(p.clients)
+		p.clientLock.RUnlock()
+		if n == 0 {
+			log.Infof("overlord proxy drained all clients")
+			return
+		}
+		if time.Now().After(deadline) {
+			log.Warnf("overlord proxy drain timeout with %d clients", n)
+			return
+		}
+		time.Sleep(drainInterval)
+	}
+}
@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseListenFDs(t *testing.T) {
+	fds, err := parseListenFDs("")
+	assert.NoError(t, err)
+	assert.Len(t, fds, 0)
+
+	fds, err = parseListenFDs("tcp://0.0.0.0:21211=4,unix:///tmp/overlord.sock=5")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"tcp://0.0.0.0:21211": 4, "unix:///tmp/overlord.sock": 5}, fds)
+
+	_, err = parseListenFDs("tcp://0.0.0.0:21211")
+	assert.Error(t, err)
+	_, err = parseListenFDs("tcp://0.0.0.0:21211=x")
+	assert.Error(t, err)
+}
+
+func TestProxyHandoffAndDrain(t *testing.T) {
+	addr := _freeAddr(t)
+	ccs := _clusters([3]string{"a", addr, "127.0.0.1:1:1"})
+	old, err := New(DefaultConfig())
+	assert.NoError(t, err)
+	defer old.Close()
+	old.Serve(ccs)
+
+	conn, err := net.Dial("tcp", addr)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, _clusterClients(old, "a"))
+
+	// NOTE: hand off the listener like Upgrade does within one process
+	old.lock.Lock()
+	f, err := old.sockets["a"].(*net.TCPListener).File()
+	old.lock.Unlock()
+	assert.NoError(t, err)
+	inheritOnce.Do(func() {})
+	inheritLock.Lock()
+	inherited = map[string]*os.File{fdKey("tcp", addr): f}
+	inheritLock.Unlock()
+	p, err := New(DefaultConfig())
+	assert.NoError(t, err)
+	defer p.Close()
+	p.Serve(_clusters([3]string{"a", addr, "127.0.0.1:1:1"}))
+	Ready()
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		conn.Close()
+	}()
+	start := time.Now()
+	old.Drain(time.Second)
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Equal(t, 0, _clusterClients(old, "a"))
+
+	nconn, err := net.Dial("tcp", addr)
+	assert.NoError(t, err)
+	defer nconn.Close()
+	assert.Equal(t, 1, _clusterClients(p, "a"))
+	assert.Equal(t, 0, _clusterClients(old, "a"))
+}
+
+func TestProxyDrainTimeout(t *testing.T) {
+	addr := _freeAddr(t)
+	p, err := New(DefaultConfig())
+	assert.NoError(t, err)
+	defer p.Close()
+	p.Serve(_clusters([3]string{"a", addr, "127.0.0.1:1:1"}))
+	conn, err := net.Dial("tcp", addr)
+	assert.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, 1, _clusterClients(p, "a"))
+
+	p.Drain(200 * time.Millisecond)
+	assert.Equal(t, 1, _clusterClients(p, "a"))
+	_, err = net.Dial("tcp", addr)
+	assert.Error(t, err)
+}
+
+func TestWaitReady(t *testing.T) {
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	_, err = w.Write([]byte{1})
+	assert.NoError(t, err)
+	assert.NoError(t, waitReady(r, time.Second))
+	w.Close()
+	assert.Equal(t, ErrUpgradeNotReady, errors.Cause(waitReady(r, time.Second)))
+	r.Close()
+
+	r, w, err = os.Pipe()
+	assert.NoError(t, err)
+	defer r.Close()
+	defer w.Close()
+	assert.Equal(t, ErrUpgradeNotReady, errors.Cause(waitReady(r, 50*time.Millisecond)))
+}
@@ -0,0 +1,205 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"overlord/pkg/log"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	adminWeightsSuffix = "/weights"
+	// defaultWeightInterval is the ms between the steps of reweight by
+	// default.
+	defaultWeightInterval = 10000
+)
+
+// Reweight changes the weight of the node with the same alias (or address
+// if no alias) by admin api. The weight is changed by step each interval ms
+// if step is set, so that the traffic is shifted onto or off the node
+// gradually, such as warming up a new node.
+type Reweight struct {
+	Addr     string `json:"addr,omitempty"`
+	Alias    string `json:"alias,omitempty"`
+	Weight   int    `json:"weight"`
+	Step     int    `json:"step,omitempty"`
+	Interval int    `json:"interval,omitempty"`
+	// Current is the weight of node only shown while listing.
+	Current int `json:"current,omitempty"`
+}
+
+// reweighting is a reweight in progress of cluster name.
+type reweighting struct {
+	name string
+	rw   *Reweight
+	done chan struct{}
+}
+
+func (r *reweighting) key() string {
+	return r.name + " " + r.rw.Alias + " " + r.rw.Addr
+}
+
+func matchNode(n *Node, addr, alias string) bool {
+	return (alias != "" && n.Alias == alias) || (alias == "" && n.Addr == addr)
+}
+
+func nextWeight(cur, target, step int) int {
+	switch {
+	case step <= 0:
+		return target
+	case cur < target && cur+step < target:
+		return cur + step
+	case cur > target && cur-step > target:
+		return cur - step
+	}
+	return target
+}
+
+// Reweight changes the weight of node of cluster name by rw, the first step
+// is done at once and the others in background. The reweight in progress of
+// the same node is canceled.
+func (p *Proxy) Reweight(ccf, name string, rw *Reweight) error {
+	if rw.Weight < 0 || rw.Step < 0 || rw.Interval < 0 || (rw.Addr == "" && rw.Alias == "") {
+		return errors.Wrapf(ErrAdminNodeInvalid, "addr:%s alias:%s weight:%d step:%d interval:%d", rw.Addr, rw.Alias, rw.Weight, rw.Step, rw.Interval)
+	}
+	if rw.Step > 0 && rw.Interval == 0 {
+		rw.Interval = defaultWeightInterval
+	}
+	r := &reweighting{name: name, rw: rw, done: make(chan struct{})}
+	p.startReweight(r)
+	finished, err := p.reweightStep(ccf, r)
+	if err != nil || finished {
+		p.stopReweight(r)
+		return err
+	}
+	go p.reweightLoop(ccf, r)
+	return nil
+}
+
+// Reweights returns the reweights in progress of cluster name with the
+// current weights.
+func (p *Proxy) Reweights(name string) (rws []*Reweight, err error) {
+	nodes, err := p.Nodes(name)
+	if err != nil {
+		return
+	}
+	rws = []*Reweight{}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, r := range p.reweights {
+		if r.name != name {
+			continue
+		}
+		rw := *r.rw
+		for _, n := range nodes {
+			if matchNode(n, rw.Addr, rw.Alias) {
+				rw.Current = n.Weight
+			}
+		}
+		rws = append(rws, &rw)
+	}
+	return
+}
+
+// reweightStep changes the weight of node by a step and reports whether the
+// target weight is reached.
+func (p *Proxy) reweightStep(ccf string, r *reweighting) (finished bool, err error) {
+	rw := r.rw
+	err = p.changeNodes(ccf, r.name, func(nodes []*Node) ([]*Node, error) {
+		for _, n := range nodes {
+			if matchNode(n, rw.Addr, rw.Alias) {
+				n.Weight = nextWeight(n.Weight, rw.Weight, rw.Step)
+				finished = n.Weight == rw.Weight
+				return nodes, nil
+			}
+		}
+		return nil, errors.Wrapf(ErrAdminNodeNotFound, "addr:%s alias:%s", rw.Addr, rw.Alias)
+	})
+	return
+}
+
+func (p *Proxy) reweightLoop(ccf string, r *reweighting) {
+	defer p.stopReweight(r)
+	ticker := time.NewTicker(time.Duration(r.rw.Interval) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		}
+		select {
+		case <-r.done:
+			return
+		default:
+		}
+		finished, err := p.reweightStep(ccf, r)
+		if err != nil {
+			log.Errorf("admin reweight cluster:%s addr:%s alias:%s error:%v", r.name, r.rw.Addr, r.rw.Alias, err)
+			return
+		}
+		if finished {
+			log.Infof("admin reweight cluster:%s addr:%s alias:%s to weight:%d finished", r.name, r.rw.Addr, r.rw.Alias, r.rw.Weight)
+			return
+		}
+	}
+}
+
+// startReweight records r and cancels the previous one of the same node.
+func (p *Proxy) startReweight(r *reweighting) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.reweights == nil {
+		p.reweights = make(map[string]*reweighting)
+	}
+	if prev, ok := p.reweights[r.key()]; ok {
+		close(prev.done)
+	}
+	p.reweights[r.key()] = r
+}
+
+func (p *Proxy) stopReweight(r *reweighting) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.reweights[r.key()] == r {
+		delete(p.reweights, r.key())
+	}
+}
+
+// closeReweights cancels all the reweights in progress.
+func (p *Proxy) closeReweights() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for key, r := range p.reweights {
+		close(r.done)
+		delete(p.reweights, key)
+	}
+}
+
+func (p *Proxy) serveWeights(w http.ResponseWriter, req *http.Request, ccf, name string) {
+	var err error
+	switch req.Method {
+	case http.MethodGet:
+		var rws []*Reweight
+		if rws, err = p.Reweights(name); err == nil {
+			err = json.NewEncoder(w).Encode(rws)
+		}
+	case http.MethodPost:
+		rw := &Reweight{}
+		if err = json.NewDecoder(req.Body).Decode(rw); err != nil {
+			http.Error(w, fmt.Sprintf("%s", err), http.StatusBadRequest)
+			return
+		}
+		if err = p.Reweight(ccf, name, rw); err == nil {
+			_, _ = w.Write([]byte("ok"))
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	adminError(w, err)
+}
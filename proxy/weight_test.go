@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextWeight(t *testing.T) {
+	assert.Equal(t, 10, nextWeight(1, 10, 0))
+	assert.Equal(t, 4, nextWeight(1, 10, 3))
+	assert.Equal(t, 10, nextWeight(8, 10, 3))
+	assert.Equal(t, 7, nextWeight(10, 1, 3))
+	assert.Equal(t, 1, nextWeight(3, 1, 3))
+	assert.Equal(t, 5, nextWeight(5, 5, 3))
+}
+
+func TestProxyReweight(t *testing.T) {
+	p, f := _adminProxy("127.0.0.1:6379:10 r1", "127.0.0.1:6380:10 r2")
+	// at once without step.
+	assert.NoError(t, p.Reweight("", "admin", &Reweight{Alias: "r2", Weight: 5}))
+	assert.Equal(t, []string{"127.0.0.1:6379:10 r1", "127.0.0.1:6380:5 r2"}, <-f.servers)
+	rws, err := p.Reweights("admin")
+	assert.NoError(t, err)
+	assert.Empty(t, rws)
+
+	// gradually by step.
+	assert.NoError(t, p.Reweight("", "admin", &Reweight{Alias: "r2", Weight: 10, Step: 2, Interval: 10}))
+	assert.Equal(t, []string{"127.0.0.1:6379:10 r1", "127.0.0.1:6380:7 r2"}, <-f.servers)
+	assert.Equal(t, []string{"127.0.0.1:6379:10 r1", "127.0.0.1:6380:9 r2"}, <-f.servers)
+	assert.Equal(t, []string{"127.0.0.1:6379:10 r1", "127.0.0.1:6380:10 r2"}, <-f.servers)
+	time.Sleep(50 * time.Millisecond)
+	rws, err = p.Reweights("admin")
+	assert.NoError(t, err)
+	assert.Empty(t, rws)
+	assert.Len(t, f.servers, 0)
+
+	// canceled by the next reweight of the same node.
+	assert.NoError(t, p.Reweight("", "admin", &Reweight{Alias: "r1", Weight: 1, Step: 1, Interval: 60000}))
+	assert.Equal(t, []string{"127.0.0.1:6379:9 r1", "127.0.0.1:6380:10 r2"}, <-f.servers)
+	rws, err = p.Reweights("admin")
+	assert.NoError(t, err)
+	assert.Equal(t, []*Reweight{{Alias: "r1", Weight: 1, Step: 1, Interval: 60000, Current: 9}}, rws)
+	assert.NoError(t, p.Reweight("", "admin", &Reweight{Alias: "r1", Weight: 10}))
+	assert.Equal(t, []string{"127.0.0.1:6379:10 r1", "127.0.0.1:6380:10 r2"}, <-f.servers)
+	rws, err = p.Reweights("admin")
+	assert.NoError(t, err)
+	assert.Empty(t, rws)
+
+	err = p.Reweight("", "admin", &Reweight{Alias: "r3", Weight: 1})
+	assert.Equal(t, ErrAdminNodeNotFound, errors.Cause(err))
+	err = p.Reweight("", "admin", &Reweight{Alias: "r1", Weight: -1})
+	assert.Equal(t, ErrAdminNodeInvalid, errors.Cause(err))
+	err = p.Reweight("", "admin", &Reweight{Weight: 1})
+	assert.Equal(t, ErrAdminNodeInvalid, errors.Cause(err))
+	err = p.Reweight("", "unknown", &Reweight{Alias: "r1", Weight: 1})
+	assert.Equal(t, ErrAdminClusterNotFound, errors.Cause(err))
+}
+
+func TestProxyWeightsHandler(t *testing.T) {
+	p, f := _adminProxy("127.0.0.1:6379:1", "127.0.0.1:6380:1")
+	defer p.closeReweights()
+	h := p.NodesHandler("")
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodPost, "/api/v1/clusters/admin/weights", strings.NewReader(`{"addr":"127.0.0.1:6380","weight":10,"step":4}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"127.0.0.1:6379:1", "127.0.0.1:6380:5"}, <-f.servers)
+
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, "/api/v1/clusters/admin/weights", nil))
+	assert.Equal(t, `[{"addr":"127.0.0.1:6380","weight":10,"step":4,"interval":10000,"current":5}]`+"\n", w.Body.String())
+
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodPost, "/api/v1/clusters/admin/weights", strings.NewReader(`{"addr":"127.0.0.1:6381","weight":1}`)))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodPost, "/api/v1/clusters/admin/weights", strings.NewReader(`{"addr":"127.0.0.1:6380","weight":-1}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodDelete, "/api/v1/clusters/admin/weights", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
@@ -1,4 +1,5 @@
 import http from '@/http/service'
+import { getToken } from '@/http/token'
 
 // 根据关键字搜索获取 cluster 列表
 const getClusterListByQueryApi = params => {
@@ -19,6 +20,23 @@ const getJobsApi = params => {
   return http.get('api/v1/jobs')
 }
 
+// 获取 job 详情
+const getJobApi = jobId => {
+  return http.get(`api/v1/jobs/${jobId.replace(/\//g, '.')}`)
+}
+
+// 获取 job 执行日志
+const getJobLogsApi = jobId => {
+  return http.get(`api/v1/jobs/${jobId.replace(/\//g, '.')}/logs`)
+}
+
+// job 状态变更和执行日志的 SSE 推送地址，EventSource 无法设置请求头，token 放在 query 中
+const jobEventsUrl = jobId => {
+  const url = `/api/v1/jobs/${jobId.replace(/\//g, '.')}/events`
+  const token = getToken()
+  return token ? `${url}?token=${encodeURIComponent(token)}` : url
+}
+
 // 获取 version 列表
 const getVersionsApi = params => {
   return http.get('api/v1/versions')
@@ -56,6 +74,14 @@ const patchInstanceWeightApi = (clusterName, addr, params) => {
   return http.patch(`api/v1/clusters/${clusterName}/instances/${addr}`, params)
 }
 
+// 扩缩容 cluster
+const scaleClusterApi = (clusterName, params) => {
+  return http.patch(`api/v1/clusters/${clusterName}/instances`, {
+    name: clusterName,
+    ...params
+  })
+}
+
 // 创建 cluster
 const createClusterApi = params => {
   return http.post('api/v1/clusters', params)
@@ -80,6 +106,9 @@ export {
   getClusterListByQueryApi,
   getAppidsApi,
   getJobsApi,
+  getJobApi,
+  getJobLogsApi,
+  jobEventsUrl,
   getVersionsApi,
   getGroupsApi,
   getAppidDetailApi,
@@ -87,6 +116,7 @@ export {
   removeCorrelationApi,
   deleteClusterApi,
   patchInstanceWeightApi,
+  scaleClusterApi,
   createClusterApi,
   addCorrelationApi,
   addAppIdApi,
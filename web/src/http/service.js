@@ -1,12 +1,17 @@
 import axios from 'axios'
 import config from './config'
+import { getToken } from './token'
 // import { Message } from 'element-ui'
 
 const service = axios.create(config)
 
-// 添加请求拦截器
+// 添加请求拦截器，开启认证时携带 token
 service.interceptors.request.use(
   req => {
+    const token = getToken()
+    if (token) {
+      req.headers.Authorization = `Bearer ${token}`
+    }
     return req
   },
   error => {
@@ -0,0 +1,19 @@
+// apiserver 开启 [auth] 后请求需携带的 token，保存在浏览器本地
+const tokenKey = 'overlord_token'
+
+const getToken = () => {
+  return localStorage.getItem(tokenKey) || ''
+}
+
+const setToken = token => {
+  if (token) {
+    localStorage.setItem(tokenKey, token)
+  } else {
+    localStorage.removeItem(tokenKey)
+  }
+}
+
+export {
+  getToken,
+  setToken
+}